@@ -10,7 +10,7 @@ import (
 )
 
 // MockPolicyCache is mock for PolicyCache that only provides fake implementation
-// of LookupPod().
+// of LookupPod(), LookupPodsByNamespace() and ListAllPods().
 type MockPolicyCache struct {
 	pods map[podmodel.ID]*podmodel.Pod
 }
@@ -35,6 +35,11 @@ func (mpc *MockPolicyCache) AddPodConfig(id podmodel.ID, ipAddr string, labels .
 	mpc.pods[id] = pod
 }
 
+// RemovePodConfig removes fake pod data added using AddPodConfig.
+func (mpc *MockPolicyCache) RemovePodConfig(id podmodel.ID) {
+	delete(mpc.pods, id)
+}
+
 // Update is not implemented by the mock.
 func (mpc *MockPolicyCache) Update(dataChngEv datasync.ChangeEvent) error {
 	return nil
@@ -66,14 +71,23 @@ func (mpc *MockPolicyCache) LookupPodsByNsLabelSelector(podLabelSelector *policy
 	return nil
 }
 
-// LookupPodsByNamespace is not implemented by the mock.
+// LookupPodsByNamespace returns IDs of pods previously added using AddPodConfig
+// into the given namespace.
 func (mpc *MockPolicyCache) LookupPodsByNamespace(policyNamespace string) (pods []podmodel.ID) {
-	return nil
+	for id := range mpc.pods {
+		if id.Namespace == policyNamespace {
+			pods = append(pods, id)
+		}
+	}
+	return pods
 }
 
-// ListAllPods is not implemented by the mock.
+// ListAllPods returns IDs of all pods previously added using AddPodConfig.
 func (mpc *MockPolicyCache) ListAllPods() (pods []podmodel.ID) {
-	return nil
+	for id := range mpc.pods {
+		pods = append(pods, id)
+	}
+	return pods
 }
 
 // LookupPolicy is not implemented by the mock.
@@ -0,0 +1,201 @@
+package renderer
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/ligato/cn-infra/logging"
+)
+
+// FaultInjectingRenderer wraps any renderer and makes commits of its
+// transactions fail on demand, in order to exercise the error handling
+// of the layer above (retries, isolation of failing renderers).
+// A failed commit is not propagated into the wrapped renderer, i.e. its
+// configuration is left unchanged. Capabilities and optional transaction
+// interfaces of the wrapped renderer are passed through.
+type FaultInjectingRenderer struct {
+	lock      sync.Mutex
+	Log       logging.Logger
+	renderer  renderer.PolicyRendererAPI
+	failPods  map[podmodel.ID]struct{}
+	failAfter int // -1 = disabled
+	applies   int
+	failProb  float64
+	rand      *rand.Rand
+	transient bool
+	failures  int
+}
+
+// FaultInjectingTxn is a transaction of FaultInjectingRenderer.
+type FaultInjectingTxn struct {
+	renderer *FaultInjectingRenderer
+	txn      renderer.Txn
+	pods     map[podmodel.ID]struct{}
+	err      error
+}
+
+// NewFaultInjectingRenderer is a constructor for FaultInjectingRenderer.
+// No faults are injected until configured.
+func NewFaultInjectingRenderer(rndr renderer.PolicyRendererAPI, log logging.Logger) *FaultInjectingRenderer {
+	return &FaultInjectingRenderer{
+		Log:       log,
+		renderer:  rndr,
+		failPods:  make(map[podmodel.ID]struct{}),
+		failAfter: -1,
+	}
+}
+
+// FailPods makes every commit of a transaction rendering any of the given
+// pods fail. Call with no pods to stop failing.
+func (fr *FaultInjectingRenderer) FailPods(pods ...podmodel.ID) {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	fr.failPods = make(map[podmodel.ID]struct{})
+	for _, pod := range pods {
+		fr.failPods[pod] = struct{}{}
+	}
+}
+
+// FailAfter lets the given number of commits succeed (counted from now)
+// and makes all the following ones fail. Use negative number to stop failing.
+func (fr *FaultInjectingRenderer) FailAfter(applies int) {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	fr.failAfter = applies
+	fr.applies = 0
+}
+
+// FailIntermittently makes every commit fail with the given probability.
+// The failures are pseudo-random, the same seed gives the same sequence
+// of failures. Use zero probability to stop failing.
+func (fr *FaultInjectingRenderer) FailIntermittently(probability float64, seed int64) {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	fr.failProb = probability
+	fr.rand = rand.New(rand.NewSource(seed))
+}
+
+// SetTransient selects whether the injected errors implement renderer.TransientError
+// (i.e. may be retried by the layer above).
+func (fr *FaultInjectingRenderer) SetTransient(transient bool) {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	fr.transient = transient
+}
+
+// Failures returns the number of commits failed by the injected faults.
+func (fr *FaultInjectingRenderer) Failures() int {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	return fr.failures
+}
+
+// HasCapability returns capabilities of the wrapped renderer.
+func (fr *FaultInjectingRenderer) HasCapability(capability renderer.Capability) bool {
+	advertiser, canAdvertise := fr.renderer.(renderer.CapabilityAdvertiser)
+	return canAdvertise && advertiser.HasCapability(capability)
+}
+
+// NewTxn starts a new transaction of the wrapped renderer.
+func (fr *FaultInjectingRenderer) NewTxn(resync bool) renderer.Txn {
+	return &FaultInjectingTxn{
+		renderer: fr,
+		txn:      fr.renderer.NewTxn(resync),
+		pods:     make(map[podmodel.ID]struct{}),
+	}
+}
+
+// injectFault returns the error to fail the commit of a transaction
+// rendering the given pods with, or nil to let the commit proceed.
+func (fr *FaultInjectingRenderer) injectFault(pods map[podmodel.ID]struct{}) error {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	var reason string
+	for pod := range pods {
+		if _, fail := fr.failPods[pod]; fail {
+			reason = fmt.Sprintf("pod %s", pod)
+			break
+		}
+	}
+	if reason == "" && fr.failAfter >= 0 && fr.applies >= fr.failAfter {
+		reason = fmt.Sprintf("after %d applies", fr.failAfter)
+	}
+	if reason == "" && fr.failProb > 0 && fr.rand.Float64() < fr.failProb {
+		reason = "intermittent"
+	}
+	if reason == "" {
+		fr.applies++
+		return nil
+	}
+	fr.failures++
+	fr.Log.WithField("reason", reason).Debug("Injecting renderer failure")
+	if fr.transient {
+		return renderer.TransientErrorf("injected failure (%s)", reason)
+	}
+	return fmt.Errorf("injected failure (%s)", reason)
+}
+
+// Render passes the rules into the wrapped transaction.
+func (ft *FaultInjectingTxn) Render(pod podmodel.ID, podIP *net.IPNet, ingress []*renderer.ContivRule, egress []*renderer.ContivRule, removed bool) renderer.Txn {
+	ft.pods[pod] = struct{}{}
+	ft.txn.Render(pod, podIP, ingress, egress, removed)
+	return ft
+}
+
+// RenderGroups passes the rule groups into the wrapped transaction.
+func (ft *FaultInjectingTxn) RenderGroups(pod podmodel.ID, podIP *net.IPNet, ingress []*renderer.RuleGroup, egress []*renderer.RuleGroup, removed bool) renderer.Txn {
+	ft.pods[pod] = struct{}{}
+	if groupTxn, isGroupTxn := ft.txn.(renderer.GroupTxn); isGroupTxn {
+		groupTxn.RenderGroups(pod, podIP, ingress, egress, removed)
+	} else {
+		ft.err = fmt.Errorf("wrapped renderer does not support rule groups")
+	}
+	return ft
+}
+
+// RenderCombined passes the combined rules into the wrapped transaction.
+func (ft *FaultInjectingTxn) RenderCombined(pod podmodel.ID, podIP *net.IPNet, rules []*renderer.DirectedRule, removed bool) renderer.Txn {
+	ft.pods[pod] = struct{}{}
+	if combinedTxn, isCombinedTxn := ft.txn.(renderer.CombinedTxn); isCombinedTxn {
+		combinedTxn.RenderCombined(pod, podIP, rules, removed)
+	} else {
+		ft.err = fmt.Errorf("wrapped renderer does not support combined rules")
+	}
+	return ft
+}
+
+// RenderDelta passes the rule deltas into the wrapped transaction.
+func (ft *FaultInjectingTxn) RenderDelta(pod podmodel.ID, podIP *net.IPNet, ingress renderer.RuleDelta, egress renderer.RuleDelta) renderer.Txn {
+	ft.pods[pod] = struct{}{}
+	if deltaTxn, isDeltaTxn := ft.txn.(renderer.DeltaTxn); isDeltaTxn {
+		deltaTxn.RenderDelta(pod, podIP, ingress, egress)
+	} else {
+		ft.err = fmt.Errorf("wrapped renderer does not support incremental updates")
+	}
+	return ft
+}
+
+// SetConntrackZone passes the conntrack zone into the wrapped transaction.
+func (ft *FaultInjectingTxn) SetConntrackZone(pod podmodel.ID, zone renderer.ConntrackZone) renderer.Txn {
+	if zonedTxn, isZonedTxn := ft.txn.(renderer.ZonedTxn); isZonedTxn {
+		zonedTxn.SetConntrackZone(pod, zone)
+	} else {
+		ft.err = fmt.Errorf("wrapped renderer does not support conntrack zones")
+	}
+	return ft
+}
+
+// Commit commits the wrapped transaction unless a fault is injected.
+func (ft *FaultInjectingTxn) Commit() error {
+	if ft.err != nil {
+		return ft.err
+	}
+	if err := ft.renderer.injectFault(ft.pods); err != nil {
+		return err
+	}
+	return ft.txn.Commit()
+}
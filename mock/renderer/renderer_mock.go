@@ -40,10 +40,16 @@ const (
 // to simulate a traffic and test what the outcome would be with the rendered
 // configuration.
 type MockRenderer struct {
-	lock   sync.Mutex
-	name   string
-	Log    logging.Logger
-	config map[podmodel.ID]*PodConfig // Pod ID -> config
+	lock         sync.Mutex
+	name         string
+	Log          logging.Logger
+	config       map[podmodel.ID]*PodConfig // Pod ID -> config
+	capabilities map[renderer.Capability]struct{}
+	ruleFormat   renderer.RuleFormat
+	unordered    bool
+	commitErr    error
+	commitErrs   []error
+	commits      int // number of successful commits
 }
 
 // MockRendererTxn is a mock implementation for the renderer's transaction.
@@ -56,20 +62,97 @@ type MockRendererTxn struct {
 
 // PodConfig stores configuration for a single pod.
 type PodConfig struct {
-	ip      *net.IPNet
-	ingress []*renderer.ContivRule
-	egress  []*renderer.ContivRule
+	ip            *net.IPNet
+	ingress       []*renderer.ContivRule
+	egress        []*renderer.ContivRule
+	ingressGroups []*renderer.RuleGroup    // nil if rendered without groups
+	egressGroups  []*renderer.RuleGroup    // nil if rendered without groups
+	combined      []*renderer.DirectedRule // nil if rendered with separate lists
+	ingressDelta  *renderer.RuleDelta      // nil if rendered without delta
+	egressDelta   *renderer.RuleDelta      // nil if rendered without delta
+	zone          renderer.ConntrackZone   // zero if not assigned
+	ingressPrio   []renderer.RulePriority  // nil if not assigned
+	egressPrio    []renderer.RulePriority  // nil if not assigned
 }
 
 // NewMockRenderer is a constructor for MockRenderer.
 func NewMockRenderer(name string, log logging.Logger) *MockRenderer {
 	return &MockRenderer{
-		name:   name,
-		Log:    log,
-		config: make(map[podmodel.ID]*PodConfig),
+		name:         name,
+		Log:          log,
+		config:       make(map[podmodel.ID]*PodConfig),
+		capabilities: make(map[renderer.Capability]struct{}),
 	}
 }
 
+// SetCapabilities allows to select capabilities advertised by the mock renderer.
+func (mr *MockRenderer) SetCapabilities(capabilities ...renderer.Capability) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	mr.capabilities = make(map[renderer.Capability]struct{})
+	for _, capability := range capabilities {
+		mr.capabilities[capability] = struct{}{}
+	}
+}
+
+// SetRuleFormat allows to select the rule format advertised by the mock
+// renderer. By default, the current format is advertised.
+func (mr *MockRenderer) SetRuleFormat(format renderer.RuleFormat) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	mr.ruleFormat = format
+}
+
+// SetUnorderedRules allows to simulate a renderer which re-sorts the rules
+// (e.g. through renderer/cache), i.e. without the OrderedRules capability.
+// By default, the mock evaluates rules in the given order and advertises
+// OrderedRules regardless of SetCapabilities.
+func (mr *MockRenderer) SetUnorderedRules(unordered bool) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	mr.unordered = unordered
+}
+
+// SetCommitError allows to simulate failing renderer. Every following
+// Commit() will return the given error and leave the configuration unchanged.
+// Use nil to make the renderer succeed again.
+func (mr *MockRenderer) SetCommitError(err error) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	mr.commitErr = err
+}
+
+// SetCommitErrors allows to simulate renderer failing only a given number
+// of times. The errors are returned by the following Commit()-s, one per call,
+// before the renderer falls back to the error set by SetCommitError.
+func (mr *MockRenderer) SetCommitErrors(errs ...error) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	mr.commitErrs = errs
+}
+
+// HasCapability returns true if the capability was enabled using SetCapabilities,
+// and for OrderedRules unless disabled by SetUnorderedRules.
+func (mr *MockRenderer) HasCapability(capability renderer.Capability) bool {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	if capability == renderer.OrderedRules {
+		return !mr.unordered
+	}
+	_, hasCapability := mr.capabilities[capability]
+	return hasCapability
+}
+
+// SupportedRuleFormat returns the rule format selected using SetRuleFormat.
+func (mr *MockRenderer) SupportedRuleFormat() renderer.RuleFormat {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	if mr.ruleFormat == 0 {
+		return renderer.CurrentRuleFormat
+	}
+	return mr.ruleFormat
+}
+
 // NewTxn creates a new mock transaction.
 func (mr *MockRenderer) NewTxn(resync bool) renderer.Txn {
 	return &MockRendererTxn{
@@ -80,6 +163,14 @@ func (mr *MockRenderer) NewTxn(resync bool) renderer.Txn {
 	}
 }
 
+// GetCommitCount returns the number of transactions successfully committed
+// to the renderer.
+func (mr *MockRenderer) GetCommitCount() int {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	return mr.commits
+}
+
 // GetPodIP returns the pod IP + masklen as provided by the configurator.
 func (mr *MockRenderer) GetPodIP(pod podmodel.ID) (ip string, masklen int) {
 	mr.Log.WithFields(logging.Fields{
@@ -99,11 +190,106 @@ func (mr *MockRenderer) GetPodIP(pod podmodel.ID) (ip string, masklen int) {
 	return config.ip.IP.String(), masklen
 }
 
+// GetRules returns the ingress and egress rules as provided by the configurator.
+func (mr *MockRenderer) GetRules(pod podmodel.ID) (ingress, egress []*renderer.ContivRule) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	config, hasInterface := mr.config[pod]
+	if !hasInterface {
+		return nil, nil
+	}
+	return config.ingress, config.egress
+}
+
+// GetRuleGroups returns the ingress and egress rule groups as provided
+// by the configurator. Both are nil if the pod was rendered without groups.
+func (mr *MockRenderer) GetRuleGroups(pod podmodel.ID) (ingress, egress []*renderer.RuleGroup) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	config, hasInterface := mr.config[pod]
+	if !hasInterface {
+		return nil, nil
+	}
+	return config.ingressGroups, config.egressGroups
+}
+
+// GetCombinedRules returns the combined list of rules as provided
+// by the configurator. Returns nil if the pod was rendered with separate lists.
+func (mr *MockRenderer) GetCombinedRules(pod podmodel.ID) []*renderer.DirectedRule {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	config, hasInterface := mr.config[pod]
+	if !hasInterface {
+		return nil
+	}
+	return config.combined
+}
+
+// GetRuleDeltas returns the ingress and egress rule deltas as provided
+// by the configurator. Both are nil if the pod was rendered with full lists.
+func (mr *MockRenderer) GetRuleDeltas(pod podmodel.ID) (ingress, egress *renderer.RuleDelta) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	config, hasInterface := mr.config[pod]
+	if !hasInterface {
+		return nil, nil
+	}
+	return config.ingressDelta, config.egressDelta
+}
+
+// GetConntrackZone returns the conntrack zone as provided by the configurator.
+// Zero is returned if the pod was rendered without a zone.
+func (mr *MockRenderer) GetConntrackZone(pod podmodel.ID) renderer.ConntrackZone {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	config, hasInterface := mr.config[pod]
+	if !hasInterface {
+		return 0
+	}
+	return config.zone
+}
+
+// GetRulePriorities returns the priorities of the rules as provided
+// by the configurator. Nils are returned if the pod was rendered without
+// priorities.
+func (mr *MockRenderer) GetRulePriorities(pod podmodel.ID) (ingress, egress []renderer.RulePriority) {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	config, hasInterface := mr.config[pod]
+	if !hasInterface {
+		return nil, nil
+	}
+	return config.ingressPrio, config.egressPrio
+}
+
 // TestTraffic allows to simulate a traffic and test what the outcome would
 // be with the rendered configuration.
 // The direction is from the vswitch point of view!
+// Rules are evaluated regardless of the pod network they are scoped to.
 func (mr *MockRenderer) TestTraffic(pod podmodel.ID, direction TrafficDirection, srcIP *net.IP,
 	destIP *net.IP, protocol renderer.ProtocolType, srcPort uint16, destPort uint16) TrafficAction {
+	return mr.testTraffic(pod, nil, direction, srcIP, destIP, protocol, srcPort, destPort, false)
+}
+
+// TestFragment allows to simulate a non-initial fragment of a packet (without
+// the L4 header) and test what the outcome would be with the rendered
+// configuration. Only rules matching fragments (renderer.FragmentsOnly)
+// and rules not restricted by ports are evaluated.
+func (mr *MockRenderer) TestFragment(pod podmodel.ID, direction TrafficDirection, srcIP *net.IP,
+	destIP *net.IP, protocol renderer.ProtocolType) TrafficAction {
+	return mr.testTraffic(pod, nil, direction, srcIP, destIP, protocol, 0, 0, true)
+}
+
+// TestTrafficOnNetwork allows to simulate a traffic on the pod interface
+// connected into the given pod network. Only rules scoped to that network
+// or unscoped rules are evaluated.
+func (mr *MockRenderer) TestTrafficOnNetwork(pod podmodel.ID, network string, direction TrafficDirection,
+	srcIP *net.IP, destIP *net.IP, protocol renderer.ProtocolType, srcPort uint16, destPort uint16) TrafficAction {
+	return mr.testTraffic(pod, &network, direction, srcIP, destIP, protocol, srcPort, destPort, false)
+}
+
+func (mr *MockRenderer) testTraffic(pod podmodel.ID, network *string, direction TrafficDirection, srcIP *net.IP,
+	destIP *net.IP, protocol renderer.ProtocolType, srcPort uint16, destPort uint16, fragment bool) TrafficAction {
 	mr.lock.Lock()
 	defer mr.lock.Unlock()
 
@@ -120,6 +306,15 @@ func (mr *MockRenderer) TestTraffic(pod podmodel.ID, direction TrafficDirection,
 	}
 
 	for _, rule := range rules {
+		if network != nil && rule.Network != "" && rule.Network != *network {
+			continue
+		}
+		if !fragment && rule.Fragments == renderer.FragmentsOnly {
+			continue
+		}
+		if fragment && rule.Protocol != renderer.ANY && (rule.SrcPort != 0 || rule.DestPort != 0) {
+			continue
+		}
 		if len(rule.SrcNetwork.IP) > 0 && !rule.SrcNetwork.Contains(*srcIP) {
 			continue
 		}
@@ -157,8 +352,10 @@ func (mrt *MockRendererTxn) Render(pod podmodel.ID, podIP *net.IPNet, ingress []
 		"removed":  removed,
 	}).Debug("Mock RendererTxn Render()")
 	if removed {
-		if _, hasPod := mrt.config[pod]; hasPod {
+		if mrt.resync {
 			delete(mrt.config, pod)
+		} else {
+			mrt.config[pod] = nil
 		}
 	} else {
 		mrt.config[pod] = &PodConfig{ip: podIP, ingress: ingress, egress: egress}
@@ -166,6 +363,140 @@ func (mrt *MockRendererTxn) Render(pod podmodel.ID, podIP *net.IPNet, ingress []
 	return mrt
 }
 
+// RenderGroups stores config to be rendered, with the rules of the groups
+// concatenated.
+func (mrt *MockRendererTxn) RenderGroups(pod podmodel.ID, podIP *net.IPNet, ingress []*renderer.RuleGroup, egress []*renderer.RuleGroup, removed bool) renderer.Txn {
+	mrt.Log.WithFields(logging.Fields{
+		"renderer": mrt.renderer.name,
+		"pod":      pod,
+		"IP":       podIP,
+		"ingress":  ingress,
+		"egress":   egress,
+		"removed":  removed,
+	}).Debug("Mock RendererTxn RenderGroups()")
+	mrt.Render(pod, podIP, concatGroups(ingress), concatGroups(egress), removed)
+	if !removed {
+		mrt.config[pod].ingressGroups = ingress
+		mrt.config[pod].egressGroups = egress
+	}
+	return mrt
+}
+
+// RenderCombined stores config to be rendered, with the combined list split
+// into ingress and egress rules.
+func (mrt *MockRendererTxn) RenderCombined(pod podmodel.ID, podIP *net.IPNet, rules []*renderer.DirectedRule, removed bool) renderer.Txn {
+	mrt.Log.WithFields(logging.Fields{
+		"renderer": mrt.renderer.name,
+		"pod":      pod,
+		"IP":       podIP,
+		"rules":    rules,
+		"removed":  removed,
+	}).Debug("Mock RendererTxn RenderCombined()")
+	ingress := []*renderer.ContivRule{}
+	egress := []*renderer.ContivRule{}
+	for _, rule := range rules {
+		if rule.Direction == renderer.IngressRule {
+			ingress = append(ingress, rule.Rule)
+		} else {
+			egress = append(egress, rule.Rule)
+		}
+	}
+	mrt.Render(pod, podIP, ingress, egress, removed)
+	if !removed {
+		mrt.config[pod].combined = rules
+	}
+	return mrt
+}
+
+// RenderDelta stores config to be rendered, with the deltas applied
+// to the previously rendered rules.
+func (mrt *MockRendererTxn) RenderDelta(pod podmodel.ID, podIP *net.IPNet, ingress renderer.RuleDelta, egress renderer.RuleDelta) renderer.Txn {
+	mrt.Log.WithFields(logging.Fields{
+		"renderer": mrt.renderer.name,
+		"pod":      pod,
+		"IP":       podIP,
+		"ingress":  ingress,
+		"egress":   egress,
+	}).Debug("Mock RendererTxn RenderDelta()")
+	previous, hasPrevious := mrt.config[pod]
+	if !hasPrevious {
+		mrt.renderer.lock.Lock()
+		previous = mrt.renderer.config[pod]
+		mrt.renderer.lock.Unlock()
+	}
+	var prevIngress, prevEgress []*renderer.ContivRule
+	if previous != nil {
+		prevIngress, prevEgress = previous.ingress, previous.egress
+	}
+	mrt.Render(pod, podIP, applyDelta(prevIngress, ingress), applyDelta(prevEgress, egress), false)
+	mrt.config[pod].ingressDelta = &ingress
+	mrt.config[pod].egressDelta = &egress
+	return mrt
+}
+
+// SetConntrackZone stores the conntrack zone of a pod rendered in this
+// transaction.
+func (mrt *MockRendererTxn) SetConntrackZone(pod podmodel.ID, zone renderer.ConntrackZone) renderer.Txn {
+	mrt.Log.WithFields(logging.Fields{
+		"renderer": mrt.renderer.name,
+		"pod":      pod,
+		"zone":     zone,
+	}).Debug("Mock RendererTxn SetConntrackZone()")
+	if config := mrt.config[pod]; config != nil {
+		config.zone = zone
+	}
+	return mrt
+}
+
+// SetRulePriorities stores the priorities of the rules of a pod rendered
+// in this transaction.
+func (mrt *MockRendererTxn) SetRulePriorities(pod podmodel.ID, ingress, egress []renderer.RulePriority) renderer.Txn {
+	mrt.Log.WithFields(logging.Fields{
+		"renderer": mrt.renderer.name,
+		"pod":      pod,
+		"ingress":  ingress,
+		"egress":   egress,
+	}).Debug("Mock RendererTxn SetRulePriorities()")
+	if config := mrt.config[pod]; config != nil {
+		config.ingressPrio = ingress
+		config.egressPrio = egress
+	}
+	return mrt
+}
+
+// applyDelta returns the rules with the delta applied. Added rules are inserted
+// before the last rule.
+func applyDelta(rules []*renderer.ContivRule, delta renderer.RuleDelta) []*renderer.ContivRule {
+	result := []*renderer.ContivRule{}
+	for _, rule := range rules {
+		removed := false
+		for _, removedRule := range delta.Removed {
+			if rule.Compare(removedRule) == 0 {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			result = append(result, rule)
+		}
+	}
+	if len(result) == 0 {
+		return append(result, delta.Added...)
+	}
+	last := result[len(result)-1]
+	result = append(result[:len(result)-1], delta.Added...)
+	return append(result, last)
+}
+
+// concatGroups returns rules of the groups concatenated.
+func concatGroups(groups []*renderer.RuleGroup) []*renderer.ContivRule {
+	rules := []*renderer.ContivRule{}
+	for _, group := range groups {
+		rules = append(rules, group.Rules...)
+	}
+	return rules
+}
+
 // Commit runs mock rendering. The configuration is just stored in-memory.
 func (mrt *MockRendererTxn) Commit() error {
 	mrt.Log.WithFields(logging.Fields{
@@ -174,12 +505,25 @@ func (mrt *MockRendererTxn) Commit() error {
 
 	mrt.renderer.lock.Lock()
 	defer mrt.renderer.lock.Unlock()
+	if len(mrt.renderer.commitErrs) > 0 {
+		err := mrt.renderer.commitErrs[0]
+		mrt.renderer.commitErrs = mrt.renderer.commitErrs[1:]
+		return err
+	}
+	if mrt.renderer.commitErr != nil {
+		return mrt.renderer.commitErr
+	}
 	if mrt.resync {
 		mrt.renderer.config = mrt.config
 	} else {
 		for ifName, config := range mrt.config {
+			if config == nil {
+				delete(mrt.renderer.config, ifName)
+				continue
+			}
 			mrt.renderer.config[ifName] = config
 		}
 	}
+	mrt.renderer.commits++
 	return nil
 }
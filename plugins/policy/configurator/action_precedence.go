@@ -0,0 +1,169 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"sort"
+
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// MatchAction selects what happens with the traffic selected by a match.
+type MatchAction int
+
+const (
+	// MatchAllow allows the selected traffic.
+	MatchAllow MatchAction = iota
+
+	// MatchDeny denies the selected traffic, even if allowed by other matches
+	// (see ActionPrecedence).
+	MatchDeny
+)
+
+// String converts MatchAction into a human-readable string.
+func (ma MatchAction) String() string {
+	switch ma {
+	case MatchAllow:
+		return "ALLOW"
+	case MatchDeny:
+		return "DENY"
+	}
+	return "INVALID"
+}
+
+// ActionPrecedence selects which of overlapping allow and deny matches
+// (of the same or different policies of a pod) decides about the traffic
+// selected by both. The configurator orders the generated rules accordingly,
+// i.e. renderers evaluating the rules top-down (first match wins) yield
+// the intended result. Such rules are therefore given only to renderers
+// with the renderer.OrderedRules capability, for other renderers the commit
+// fails.
+type ActionPrecedence int
+
+const (
+	// DenyWins denies the traffic selected by any deny match, regardless
+	// of the allow matches: rules of all deny matches precede rules of all
+	// allow matches. ContivPolicy.Priority is ignored.
+	DenyWins ActionPrecedence = iota
+
+	// PriorityOrder lets the policy with the highest ContivPolicy.Priority
+	// decide: rules of policies with higher priority precede rules of those
+	// with lower priority. Among policies of the same priority deny wins.
+	// Rules injected by the configurator (NAT-loopback, cluster DNS, ...) rank
+	// as allow rules of priority zero.
+	PriorityOrder
+)
+
+// String converts ActionPrecedence into a human-readable string.
+func (ap ActionPrecedence) String() string {
+	switch ap {
+	case DenyWins:
+		return "DENY-WINS"
+	case PriorityOrder:
+		return "PRIORITY-ORDER"
+	}
+	return "INVALID"
+}
+
+// WithActionPrecedence selects how overlapping allow and deny matches are
+// resolved. Default is DenyWins. The rules are ordered by the precedence only
+// for pods with deny matches, all the DENY rules of such pods (including
+// the fragment rules of DenyFragments) then rank as rules of deny matches.
+// The deny-the-rest rule always stays the last. Within the rules of the same
+// rank, the order selected by WithRuleOrdering is applied. Pods with deny rules
+// preceding the last rule can be rendered only by renderers with
+// the renderer.OrderedRules capability, the commit fails otherwise. Renderers
+// based on renderer/cache do not have the capability, as the cache re-sorts
+// the rules and the allow rules could override the deny rules.
+func WithActionPrecedence(precedence ActionPrecedence) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.actionPrecedence = precedence
+	}
+}
+
+// precedenceOrdered returns the policies in the order in which their rules
+// should be generated: by priority with PriorityOrder if there are deny
+// matches (so that rules contributed by multiple policies keep the highest
+// rank), otherwise the same list.
+func (pc *PolicyConfigurator) precedenceOrdered(policies ContivPolicies) ContivPolicies {
+	if pc.actionPrecedence != PriorityOrder || !hasDenyMatch(policies) {
+		return policies
+	}
+	ordered := policies.Copy()
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority > ordered[j].Priority
+	})
+	return ordered
+}
+
+// orderByPrecedence sorts the rules (without deny-the-rest) by the action
+// precedence and then by specificity if SpecificityFirst is selected.
+// <priorities> are the priorities of the policies the rules were generated
+// from.
+func (pc *PolicyConfigurator) orderByPrecedence(rules ContivRules, priorities []int) {
+	type rankedRule struct {
+		rule     *renderer.ContivRule
+		priority int
+	}
+	ranked := make([]rankedRule, len(rules))
+	for idx, rule := range rules {
+		ranked[idx] = rankedRule{rule: rule}
+		if pc.actionPrecedence == PriorityOrder {
+			ranked[idx].priority = priorities[idx]
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].priority != ranked[j].priority {
+			return ranked[i].priority > ranked[j].priority
+		}
+		iDeny := ranked[i].rule.Action == renderer.ActionDeny
+		jDeny := ranked[j].rule.Action == renderer.ActionDeny
+		if iDeny != jDeny {
+			return iDeny
+		}
+		if pc.ruleOrdering == SpecificityFirst {
+			return ranked[i].rule.Compare(ranked[j].rule) < 0
+		}
+		return false
+	})
+	for idx := range ranked {
+		rules[idx] = ranked[idx].rule
+	}
+}
+
+// hasDenyMatch returns true if any of the policies has a deny match.
+func hasDenyMatch(policies ContivPolicies) bool {
+	for _, policy := range policies {
+		for _, match := range policy.Matches {
+			if match.Action == MatchDeny {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deniesBeforeLast returns true if any rule but the last one denies traffic,
+// i.e. the order of the rules matters.
+func deniesBeforeLast(rules ContivRules) bool {
+	for idx, rule := range rules {
+		if idx < len(rules)-1 && rule.Action == renderer.ActionDeny {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestActionPrecedence(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestActionPrecedence")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		deniedIP  = "10.1.1.1"
+		otherIP   = "10.2.2.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+
+	// ingress allowed from 10.0.0.0/8 on any TCP port
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:     MatchIngress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.0.0/8")}},
+				Ports:    []Port{{Protocol: TCP}},
+			},
+		},
+	}
+
+	// ingress denied from 10.1.1.1 on TCP:22
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:     MatchIngress,
+				Action:   MatchDeny,
+				IPBlocks: []IPBlock{{Network: parseIPNet(deniedIP + "/32")}},
+				Ports:    []Port{{Protocol: TCP, Number: 22}},
+			},
+		},
+	}
+	gomega.Expect(policy2.Matches[0].String()).To(gomega.HavePrefix("<Type:INGRESS, Action:DENY, "))
+	gomega.Expect(policy1.Matches[0].String()).ToNot(gomega.ContainSubstring("Action"))
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	newConfigurator := func(opts ...Option) (*PolicyConfigurator, *MockRenderer) {
+		renderer := NewMockRenderer("A", logger)
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, opts...)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator, renderer
+	}
+	toPod := func(renderer *MockRenderer, srcIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(srcIP), parseIP(pod1IP), rendererAPI.TCP, 123, port)
+	}
+
+	// The specific deny overrides the broader allow under deny-wins
+	// (the default), regardless of the rule ordering.
+	for _, ordering := range []RuleOrdering{DefaultOrdering, SpecificityFirst} {
+		configurator, renderer := newConfigurator(WithRuleOrdering(ordering))
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+		err := txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+
+		_, egress := renderer.GetRules(pod1)
+		gomega.Expect(egress).ToNot(gomega.BeEmpty())
+		gomega.Expect(egress[0].Action).To(gomega.Equal(rendererAPI.ActionDeny))
+		gomega.Expect(egress[0].SrcNetwork.String()).To(gomega.Equal(deniedIP + "/32"))
+		gomega.Expect(toPod(renderer, deniedIP, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+		gomega.Expect(toPod(renderer, deniedIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(toPod(renderer, otherIP, 22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(configurator.EvaluateFlow(Flow{SrcIP: net.ParseIP(deniedIP), DstIP: net.ParseIP(pod1IP),
+			Protocol: TCP, DstPort: 22})).To(gomega.BeFalse())
+	}
+
+	// The rules of all policies form a single group.
+	groupConfigurator, groupRenderer := newConfigurator(WithRuleGroups(true))
+	groupRenderer.SetCapabilities(rendererAPI.RuleGroups)
+	txn := groupConfigurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	err := txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	_, egressGroups := groupRenderer.GetRuleGroups(pod1)
+	gomega.Expect(egressGroups).To(gomega.HaveLen(1))
+	gomega.Expect(toPod(groupRenderer, deniedIP, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(groupRenderer, otherIP, 22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// With priority order, the allow of the higher priority wins.
+	configurator, renderer := newConfigurator(WithActionPrecedence(PriorityOrder))
+	prioritized := policy1.DeepCopy()
+	prioritized.Priority = 10
+	gomega.Expect(prioritized.String()).To(gomega.HaveSuffix(", Priority:10>"))
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{prioritized, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(renderer, deniedIP, 22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// ... and the deny with even higher priority overrides it again.
+	prioritizedDeny := policy2.DeepCopy()
+	prioritizedDeny.Priority = 20
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{prioritized, prioritizedDeny})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(renderer, deniedIP, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(renderer, deniedIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Deny-only policy allows nothing of its direction.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(renderer, otherIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Renderers re-sorting the rules cannot be given deny rules before allows.
+	configurator, renderer = newConfigurator()
+	renderer.SetUnorderedRules(true)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring("ORDERED-RULES"))
+	ingress, egress := renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+
+	// Allow-only rules do not depend on the order.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(renderer, deniedIP, 22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+}
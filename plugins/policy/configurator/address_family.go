@@ -0,0 +1,98 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+const (
+	// otherFamilyLabel labels the rule allowing traffic of an address family
+	// not restricted by any of the (family-scoped) policies.
+	otherFamilyLabel = "other-address-family"
+)
+
+// families returns the list of concrete address families selected by af.
+func (af AddressFamily) families() []AddressFamily {
+	if af == AddressFamilyBoth {
+		return []AddressFamily{AddressFamilyIPv4, AddressFamilyIPv6}
+	}
+	return []AddressFamily{af}
+}
+
+// familyOf returns the address family of the given IP network.
+// IPv4-mapped IPv6 networks with IPv6 netmask (see MappedAsIPv6) are IPv6.
+func familyOf(ipNet *net.IPNet) AddressFamily {
+	if ipNet.IP.To4() != nil && len(ipNet.Mask) != net.IPv6len {
+		return AddressFamilyIPv4
+	}
+	return AddressFamilyIPv6
+}
+
+// anyAddress returns the subnet with all addresses of the given family
+// (i.e. 0.0.0.0/0 or ::/0).
+func anyAddress(family AddressFamily) *net.IPNet {
+	if family == AddressFamilyIPv4 {
+		return &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, net.IPv4len*8)}
+	}
+	return &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, net.IPv6len*8)}
+}
+
+// scopeToFamily restricts the peer of a rule generated for the direction
+// of the attributes to their address family (that of the policy).
+// Returns false if the rule does not apply to the family at all.
+func (attrs ruleAttrs) scopeToFamily(rule *renderer.ContivRule) bool {
+	if attrs.family == AddressFamilyBoth {
+		return true
+	}
+	peer := &rule.DestNetwork
+	if attrs.direction == MatchIngress {
+		peer = &rule.SrcNetwork
+	}
+	if len((*peer).IP) == 0 {
+		*peer = anyAddress(attrs.family)
+		return true
+	}
+	return familyOf(*peer) == attrs.family
+}
+
+// otherFamilyRules returns rules for the given direction allowing all traffic
+// of address families not restricted by any policy so that family-scoped
+// policies do not make the other family denied by default.
+func otherFamilyRules(direction MatchType, restricted map[AddressFamily]bool) ContivRules {
+	rules := ContivRules{}
+	for _, family := range AddressFamilyBoth.families() {
+		if restricted[family] {
+			continue
+		}
+		rule := &renderer.ContivRule{
+			Action:      renderer.ActionPermit,
+			Protocol:    renderer.ANY,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: &net.IPNet{},
+		}
+		if direction == MatchIngress {
+			rule.SrcNetwork = anyAddress(family)
+		} else {
+			rule.DestNetwork = anyAddress(family)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
@@ -0,0 +1,177 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestAddressFamily(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestAddressFamily")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+		ext4IP    = "10.0.0.1"
+		ext6IP    = "2001:db8::1"
+		other6IP  = "2001:db9::1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// IPv4 only: ingress allowed from pod2 and from 2001:db8::/32 (ignored)
+	policy1 := &ContivPolicy{
+		ID:            policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:          PolicyIngress,
+		AddressFamily: AddressFamilyIPv4,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{pod2},
+				IPBlocks: []IPBlock{
+					{Network: *ipNetwork("2001:db8::/32")},
+				},
+			},
+		},
+	}
+
+	// IPv6 only: ingress allowed from 2001:db8::/32 on TCP:80
+	policy2 := &ContivPolicy{
+		ID:            policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type:          PolicyIngress,
+		AddressFamily: AddressFamilyIPv6,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				IPBlocks: []IPBlock{
+					{Network: *ipNetwork("2001:db8::/32")},
+				},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// IPv4 only: all egress allowed
+	policy3 := &ContivPolicy{
+		ID:            policymodel.ID{Name: "policy3", Namespace: namespace},
+		Type:          PolicyEgress,
+		AddressFamily: AddressFamilyIPv4,
+		Matches: []Match{
+			{
+				Type: MatchEgress,
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1, policy2})
+	txn.Configure(pod3, []*ContivPolicy{policy3})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Pod1: IPv4 restricted, IPv6 left open.
+	action := renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(ext4IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(ext6IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(other6IP), parseIP(pod1IP), rendererAPI.UDP, 123, 53)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	// Egress not restricted at all.
+	ingress, _ := renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+
+	// Pod2: both families restricted, each by its own policy.
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(ext4IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(ext6IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(ext6IP), parseIP(pod2IP), rendererAPI.TCP, 123, 81)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(other6IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Pod3: all IPv4 egress allowed, IPv6 not restricted -> nothing is denied.
+	action = renderer.TestTraffic(pod3, IngressTraffic,
+		parseIP(pod3IP), parseIP(ext4IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod3, IngressTraffic,
+		parseIP(pod3IP), parseIP(ext6IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).ToNot(gomega.BeEquivalentTo(DeniedTraffic))
+}
@@ -0,0 +1,122 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// AffectedPods computes the blast radius of a hypothetical policy change:
+// it returns the committed pods carrying the policy whose rules would change
+// if the policy was updated to <newPolicy> (nil = the policy removed).
+// The ID of <newPolicy> is ignored, the policy is always paired by <policyID>.
+// Versions equivalent after the normalization are skipped without generating
+// the rules, otherwise the rules of both versions are compared. Pods with
+// the same rules (e.g. the changed traffic is allowed by another policy
+// of the pod anyway) are therefore not reported.
+// The configuration is not modified.
+// The returned pods are sorted.
+func (pc *PolicyConfigurator) AffectedPods(policyID policymodel.ID, newPolicy *ContivPolicy) []podmodel.ID {
+	pc.Lock()
+	defer pc.Unlock()
+
+	var replacement *ContivPolicy
+	if newPolicy != nil {
+		replacement = pc.canonicalPolicies(ContivPolicies{newPolicy.DeepCopy()})[0]
+		replacement.ID = policyID
+	}
+
+	// Rules are generated in a scratch transaction, never committed.
+	pct := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	pct.podIPAddresses = pc.podIPAddresses.Copy()
+	pct.clusterDNSIP = pc.clusterDNSIP
+	for pod, policies := range pc.config {
+		if _, hasRules := pc.rules[pod]; !hasRules {
+			continue
+		}
+		updated, carried := replacePolicy(policies, policyID, replacement)
+		if !carried {
+			continue
+		}
+		pct.config[pod] = updated
+	}
+	pct.applyPolicyToggles()
+
+	affected := []podmodel.ID{}
+	for pod, updated := range pct.config {
+		oldPolicies := pct.effectivePolicies(pod, pc.config[pod])
+		newPolicies := pct.effectivePolicies(pod, updated)
+		if equivalentPolicies(oldPolicies, newPolicies) {
+			continue
+		}
+		if pct.generateRules(MatchIngress, oldPolicies).Equals(pct.generateRules(MatchIngress, newPolicies)) &&
+			pct.generateRules(MatchEgress, oldPolicies).Equals(pct.generateRules(MatchEgress, newPolicies)) {
+			continue
+		}
+		affected = append(affected, pod)
+	}
+	sortPodIDs(affected)
+	return affected
+}
+
+// replacePolicy returns a copy of the list with the policy of the given ID
+// replaced with <replacement> (or removed if nil). Returns false if the list
+// does not contain the policy.
+func replacePolicy(policies ContivPolicies, policyID policymodel.ID, replacement *ContivPolicy) (ContivPolicies, bool) {
+	updated := ContivPolicies{}
+	carried := false
+	for _, policy := range policies {
+		if policy.ID != policyID {
+			updated = append(updated, policy)
+			continue
+		}
+		carried = true
+		if replacement != nil {
+			updated = append(updated, replacement)
+		}
+	}
+	return updated, carried
+}
+
+// equivalentPolicies returns true if both (ordered) lists contain the same
+// policies up to the normalization, i.e. they certainly generate the same rules.
+func equivalentPolicies(policies1, policies2 ContivPolicies) bool {
+	if !policies1.sameIdentities(policies2) || !DiffPolicies(policies1, policies2).IsEmpty() {
+		return false
+	}
+	for idx := range policies1 {
+		// attributes not compared by DiffPolicies
+		if policies1[idx].AddressFamily != policies2[idx].AddressFamily {
+			return false
+		}
+	}
+	return true
+}
+
+// Equals returns true if both lists contain equal rules in the same order.
+func (cr ContivRules) Equals(cr2 ContivRules) bool {
+	if len(cr) != len(cr2) {
+		return false
+	}
+	for idx, rule := range cr {
+		if rule.Compare(cr2[idx]) != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestAffectedPods(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestAffectedPods")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed on TCP:80 from pod3 and from 10.0.0.0/8
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod3},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type:     MatchIngress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.0.0/8")}},
+				Ports:    []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// ingress allowed on TCP:80 from pod3 and on TCP:80 and TCP:8080
+	// from 10.0.0.0/8 (ordered before policy1)
+	policy0 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy0", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod3},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type:     MatchIngress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.0.0/8")}},
+				Ports:    []Port{{Protocol: TCP, Number: 80}, {Protocol: TCP, Number: 8080}},
+			},
+		},
+	}
+
+	// ingress allowed on TCP:22
+	policy3 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy3", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 22}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1, policy0})
+	txn.Configure(pod3, []*ContivPolicy{policy3})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	pod1Ingress, pod1Egress := renderer.GetRules(pod1)
+
+	// Unchanged policy.
+	gomega.Expect(configurator.AffectedPods(policy1.ID, policy1)).To(gomega.BeEmpty())
+
+	// Equivalent policy (reordered matches).
+	reordered := policy1.DeepCopy()
+	reordered.Matches[0], reordered.Matches[1] = reordered.Matches[1], reordered.Matches[0]
+	gomega.Expect(configurator.AffectedPods(policy1.ID, reordered)).To(gomega.BeEmpty())
+
+	// Equivalent policy (duplicate match, host bits set in the block).
+	duplicate := policy1.DeepCopy()
+	duplicate.Matches = append(duplicate.Matches, Match{
+		Type:     MatchIngress,
+		IPBlocks: []IPBlock{{Network: net.IPNet{IP: net.ParseIP("10.1.2.3").To4(), Mask: net.CIDRMask(8, 32)}}},
+		Ports:    []Port{{Protocol: TCP, Number: 80}},
+	})
+	gomega.Expect(configurator.AffectedPods(policy1.ID, duplicate)).To(gomega.BeEmpty())
+
+	// Port changed: pod2 gets the same rules from policy0.
+	changed := policy1.DeepCopy()
+	changed.Matches[1].Ports = []Port{{Protocol: TCP, Number: 8080}}
+	gomega.Expect(configurator.AffectedPods(policy1.ID, changed)).To(gomega.Equal([]podmodel.ID{pod1}))
+
+	// Policy removed: pod1 becomes unrestricted, pod2 gets the same rules from policy0.
+	gomega.Expect(configurator.AffectedPods(policy1.ID, nil)).To(gomega.Equal([]podmodel.ID{pod1}))
+
+	// Policy restricted to IPv6 - does not restrict IPv4 traffic of pod1.
+	restricted := policy1.DeepCopy()
+	restricted.AddressFamily = AddressFamilyIPv6
+	gomega.Expect(configurator.AffectedPods(policy1.ID, restricted)).To(gomega.Equal([]podmodel.ID{pod1}))
+
+	// Policy widened to all ports: both pods affected.
+	widened := policy1.DeepCopy()
+	widened.Matches[1].Ports = nil
+	gomega.Expect(configurator.AffectedPods(policy1.ID, widened)).To(gomega.Equal([]podmodel.ID{pod1, pod2}))
+
+	// Policy not carried by any pod.
+	unknown := policymodel.ID{Name: "unknown", Namespace: namespace}
+	gomega.Expect(configurator.AffectedPods(unknown, widened)).To(gomega.BeEmpty())
+
+	// The configuration was not modified.
+	gomega.Expect(configurator.config[pod1]).To(gomega.HaveLen(1))
+	gomega.Expect(configurator.config[pod1][0].Matches).To(gomega.HaveLen(2))
+	gomega.Expect(configurator.config[pod1][0].Matches[1].Ports).To(gomega.Equal([]Port{{Protocol: TCP, Number: 80}}))
+	ingress, egress := renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.Equal(pod1Ingress))
+	gomega.Expect(egress).To(gomega.Equal(pod1Egress))
+}
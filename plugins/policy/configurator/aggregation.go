@@ -0,0 +1,100 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+)
+
+// WithPodIPAggregation enables aggregation of IP addresses of pod peers
+// (Match.Pods) into CIDR rules. Whenever a contiguous and properly aligned
+// block of IP addresses is fully assigned to peer pods, a single rule
+// for the block is generated instead of one rule per pod.
+// The aggregation is lossless - rules never include IP addresses of non-peers.
+// Only IPv4 addresses are aggregated.
+func WithPodIPAggregation() Option {
+	return func(pc *PolicyConfigurator) {
+		pc.aggregatePodIPs = true
+	}
+}
+
+// peerNetworks returns networks covering exactly the IP addresses of the given
+// pod peers.
+func (pc *PolicyConfigurator) peerNetworks(peers []PeerPod) []*net.IPNet {
+	networks := []*net.IPNet{}
+	if !pc.aggregatePodIPs {
+		for _, peer := range peers {
+			networks = append(networks, peer.IPNet)
+		}
+		return networks
+	}
+
+	// Collect and sort IPv4 addresses, other addresses are left as they are.
+	ipv4 := []uint32{}
+	for _, peer := range peers {
+		ip := peer.IPNet.IP.To4()
+		if ip == nil {
+			networks = append(networks, peer.IPNet)
+			continue
+		}
+		ipv4 = append(ipv4, binary.BigEndian.Uint32(ip))
+	}
+	sort.Slice(ipv4, func(i, j int) bool { return ipv4[i] < ipv4[j] })
+	return append(aggregateIPv4(ipv4), networks...)
+}
+
+// aggregateIPv4 returns the smallest list of CIDR networks covering exactly
+// the given sorted IPv4 addresses (duplicates are allowed).
+func aggregateIPv4(ips []uint32) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for i := 0; i < len(ips); {
+		start := ips[i]
+
+		// Count consecutive addresses starting at <start>.
+		run := uint64(1)
+		j := i + 1
+		for ; j < len(ips); j++ {
+			if ips[j] == ips[j-1] {
+				continue
+			}
+			if uint64(ips[j]) != uint64(start)+run {
+				break
+			}
+			run++
+		}
+
+		// Select the largest block aligned at <start> and fully covered by the run.
+		size := uint64(1)
+		prefixLen := 32
+		for prefixLen > 0 && uint64(start)%(size*2) == 0 && size*2 <= run {
+			size *= 2
+			prefixLen--
+		}
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, start)
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(prefixLen, 32)})
+
+		// Skip addresses covered by the block.
+		end := uint64(start) + size
+		for i < len(ips) && uint64(ips[i]) < end {
+			i++
+		}
+	}
+	return networks
+}
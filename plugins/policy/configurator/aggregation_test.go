@@ -0,0 +1,127 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestPodIPAggregation(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPodIPAggregation")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		podName   = "pod"
+		podIP     = "10.1.2.1"
+	)
+	pod := podmodel.ID{Name: podName, Namespace: namespace}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod, podIP)
+
+	// Contiguous block 10.1.1.0 - 10.1.1.8, then a gap, then 10.1.1.10, 10.1.1.11 and 10.1.1.13.
+	block := []podmodel.ID{}
+	for i := 0; i <= 8; i++ {
+		peer := podmodel.ID{Name: fmt.Sprintf("block-%d", i), Namespace: namespace}
+		cache.AddPodConfig(peer, fmt.Sprintf("10.1.1.%d", i))
+		block = append(block, peer)
+	}
+	gaps := []podmodel.ID{}
+	for _, i := range []int{10, 11, 13} {
+		peer := podmodel.ID{Name: fmt.Sprintf("gaps-%d", i), Namespace: namespace}
+		cache.AddPodConfig(peer, fmt.Sprintf("10.1.1.%d", i))
+		gaps = append(gaps, peer)
+	}
+
+	// ingress allowed from all the peers
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: append(block, gaps...),
+			},
+		},
+	}
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithPodIPAggregation())
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// 10.1.1.0/29, 10.1.1.8/32, 10.1.1.10/31, 10.1.1.13/32
+	// + NAT-loopback + deny-the-rest
+	_, egress := renderer.GetRules(pod)
+	gomega.Expect(egress).To(gomega.HaveLen(6))
+	gomega.Expect(egress[0].SrcNetwork.String()).To(gomega.Equal("10.1.1.0/29"))
+	gomega.Expect(egress[1].SrcNetwork.String()).To(gomega.Equal("10.1.1.8/32"))
+	gomega.Expect(egress[2].SrcNetwork.String()).To(gomega.Equal("10.1.1.10/31"))
+	gomega.Expect(egress[3].SrcNetwork.String()).To(gomega.Equal("10.1.1.13/32"))
+
+	// Test with fake traffic.
+	for i := 0; i <= 15; i++ {
+		peerIP := fmt.Sprintf("10.1.1.%d", i)
+		expected := AllowedTraffic
+		if i == 9 || i == 12 || i > 13 {
+			// no over-inclusion
+			expected = DeniedTraffic
+		}
+		action := renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(peerIP), parseIP(podIP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(expected), peerIP)
+	}
+}
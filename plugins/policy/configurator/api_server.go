@@ -0,0 +1,134 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+
+	"github.com/ligato/cn-infra/logging"
+
+	"github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/contiv/vpp/plugins/policy/utils"
+)
+
+// APIServerEndpoint is a single endpoint (IP:port) of the Kubernetes API server.
+type APIServerEndpoint struct {
+	IP   net.IP
+	Port uint16 // TCP
+}
+
+// APIServerEndpointsProvider provides the current endpoints of the Kubernetes
+// API server (the "kubernetes" service in the "default" namespace).
+type APIServerEndpointsProvider interface {
+	// GetAPIServerEndpoints returns the endpoints the API server is currently
+	// reachable at.
+	GetAPIServerEndpoints() []APIServerEndpoint
+}
+
+// WithAPIServerEndpoints enables the API server selectors (Match.APIServerRef).
+// The endpoints are obtained from the given provider; whenever they change,
+// RefreshAPIServerEndpoints() should be called to update the rules.
+func WithAPIServerEndpoints(provider APIServerEndpointsProvider) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.apiServerProvider = provider
+	}
+}
+
+// RefreshAPIServerEndpoints re-reads endpoints of the API server from
+// the provider and if they have changed, re-renders rules of pods with policies
+// referencing the API server.
+func (pc *PolicyConfigurator) RefreshAPIServerEndpoints() error {
+	if pc.apiServerProvider == nil {
+		return nil
+	}
+	pc.Lock()
+	defer pc.Unlock()
+	endpoints := sortedAPIServerEndpoints(pc.apiServerProvider.GetAPIServerEndpoints())
+	if equalAPIServerEndpoints(endpoints, pc.apiServerEndpoints) {
+		return nil
+	}
+	pc.Log.WithField("endpoints", endpoints).Debug("API server endpoints have changed")
+	pc.apiServerEndpoints = endpoints
+
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for pod, policies := range pc.config {
+		if referencesAPIServer(policies) {
+			txn.configure(pod, policies)
+		}
+	}
+	return txn.commit()
+}
+
+// apiServerRules returns rules allowing traffic with the API server endpoints.
+// Egress is allowed to the endpoint IP and port, whereas for ingress the endpoint
+// IPs are combined with the ports of the match.
+func (pct *PolicyConfiguratorTxn) apiServerRules(direction MatchType, ports []Port) ContivRules {
+	pc := pct.configurator
+	if pc.apiServerProvider == nil {
+		pct.Log.Warn("API server endpoints provider is not configured")
+		return nil
+	}
+	rules := ContivRules{}
+	for _, endpoint := range pc.apiServerEndpoints {
+		endpointNet := utils.GetOneHostSubnetFromIP(endpoint.IP)
+		if direction == MatchIngress {
+			rules = append(rules, subnetRules(direction, endpointNet, ports)...)
+			continue
+		}
+		rules = append(rules, &renderer.ContivRule{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: endpointNet,
+			Protocol:    renderer.TCP,
+			SrcPort:     0,
+			DestPort:    endpoint.Port,
+		})
+	}
+	pct.Log.WithFields(logging.Fields{
+		"endpoints": pc.apiServerEndpoints,
+		"rules":     len(rules),
+	}).Debug("Expanded API server reference")
+	return rules
+}
+
+// referencesAPIServer returns true if any of the policies has a match
+// referencing the API server.
+func referencesAPIServer(policies []*ContivPolicy) bool {
+	for _, policy := range policies {
+		for _, match := range policy.Matches {
+			if match.APIServerRef {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equalAPIServerEndpoints returns true if the two lists contain the same
+// endpoints in the same order (the lists are expected to be sorted
+// by sortedAPIServerEndpoints).
+func equalAPIServerEndpoints(endpoints1, endpoints2 []APIServerEndpoint) bool {
+	if len(endpoints1) != len(endpoints2) {
+		return false
+	}
+	for idx := range endpoints1 {
+		if !endpoints1[idx].IP.Equal(endpoints2[idx].IP) || endpoints1[idx].Port != endpoints2[idx].Port {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+type fakeAPIServerProvider struct {
+	endpoints []APIServerEndpoint
+}
+
+func (fap *fakeAPIServerProvider) GetAPIServerEndpoints() []APIServerEndpoint {
+	return fap.endpoints
+}
+
+func TestAPIServerRef(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestAPIServerRef")
+
+	// Prepare input data.
+	const (
+		namespace   = "default"
+		pod1Name    = "pod1"
+		pod2Name    = "pod2"
+		pod1IP      = "192.168.1.1"
+		pod2IP      = "192.168.1.2"
+		apiServer1  = "10.20.0.1"
+		apiServer2  = "10.20.0.2"
+		apiServer3  = "10.20.0.3"
+		apiPort     = 6443
+		webhookPort = 8443
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// egress allowed to the API server, ingress allowed from the API server to TCP:8443
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyAll,
+		Matches: []Match{
+			{
+				Type:         MatchEgress,
+				APIServerRef: true,
+			},
+			{
+				Type:         MatchIngress,
+				APIServerRef: true,
+				Ports:        []Port{{Protocol: TCP, Number: webhookPort}},
+			},
+		},
+	}
+	gomega.Expect(policy1.Matches[0].String()).To(gomega.ContainSubstring(", APIServerRef"))
+	gomega.Expect(policy1.Matches[0].matchesAnyPeer()).To(gomega.BeFalse())
+
+	provider := &fakeAPIServerProvider{
+		endpoints: []APIServerEndpoint{
+			{IP: net.ParseIP(apiServer1), Port: apiPort},
+			{IP: net.ParseIP(apiServer2), Port: apiPort},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithAPIServerEndpoints(provider))
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Egress to the API server endpoints.
+	action := renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(apiServer1), rendererAPI.TCP, 123, apiPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(apiServer2), rendererAPI.TCP, 123, apiPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(apiServer1), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(apiServer1), rendererAPI.UDP, 123, apiPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(apiServer3), rendererAPI.TCP, 123, apiPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Ingress from the API server endpoints (e.g. webhooks).
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(apiServer1), parseIP(pod1IP), rendererAPI.TCP, 123, webhookPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(apiServer1), parseIP(pod1IP), rendererAPI.TCP, 123, apiPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, webhookPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Refresh without a change.
+	err = configurator.RefreshAPIServerEndpoints()
+	gomega.Expect(err).To(gomega.BeNil())
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(apiServer1), rendererAPI.TCP, 123, apiPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// API server endpoints change.
+	provider.endpoints = []APIServerEndpoint{
+		{IP: net.ParseIP(apiServer2), Port: apiPort},
+		{IP: net.ParseIP(apiServer3), Port: apiPort},
+	}
+	err = configurator.RefreshAPIServerEndpoints()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(apiServer1), rendererAPI.TCP, 123, apiPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(apiServer2), rendererAPI.TCP, 123, apiPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(apiServer3), rendererAPI.TCP, 123, apiPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(apiServer3), parseIP(pod1IP), rendererAPI.TCP, 123, webhookPort)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Pod2 without policies remains unrestricted.
+	ingress, egress := renderer.GetRules(pod2)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+}
@@ -0,0 +1,133 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"time"
+
+	"github.com/ligato/cn-infra/logging"
+
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// ApplyLimiter paces the applies of pod rules into renderers
+// (see WithApplyRateLimit).
+type ApplyLimiter interface {
+	// Acquire blocks until at least one more pod apply is allowed and returns
+	// the number of pod applies allowed now, at least 1 and at most <pending>.
+	Acquire(pending int) int
+}
+
+// WithApplyRateLimit caps the rate at which committed changes are pushed
+// to renderers to protect an overloaded network stack. At most <perSecond>
+// pods (with a burst of up to <perSecond> pods) are applied per second,
+// Commit() waits for the rest until they are allowed. The changes applied so
+// far are committed into the renderers before each wait, the final state
+// is the same as without the limit. Resync transactions replace the whole
+// configuration of the renderers and are therefore committed only once all
+// their pods are allowed. Changes triggered outside of transactions (e.g.
+// RequestResync, UnregisterRenderer) are not paced.
+// The time is measured by the clock of the configurator (see WithClock).
+// Note that the configurator stays locked while waiting.
+// Non-positive rate disables the limit.
+func WithApplyRateLimit(perSecond int) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.applyRateLimit = perSecond
+	}
+}
+
+// WithApplyLimiter replaces the limiter used to pace the applies of pod rules
+// into renderers, overriding WithApplyRateLimit. Intended for testing.
+func WithApplyLimiter(limiter ApplyLimiter) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.applyLimiter = limiter
+	}
+}
+
+// rateLimiter implements ApplyLimiter as a token bucket refilled with
+// the given rate, holding at most one second worth of tokens.
+type rateLimiter struct {
+	clock     Clock
+	perSecond float64
+	tokens    float64
+	last      time.Time
+}
+
+// newRateLimiter returns a new rate limiter with a full bucket.
+func newRateLimiter(perSecond int, clock Clock) *rateLimiter {
+	return &rateLimiter{
+		clock:     clock,
+		perSecond: float64(perSecond),
+		tokens:    float64(perSecond),
+		last:      clock.Now(),
+	}
+}
+
+// Acquire waits for at least one token and takes as many available tokens
+// as there are pending applies.
+func (rl *rateLimiter) Acquire(pending int) int {
+	rl.refill()
+	if rl.tokens < 1 {
+		wait := time.Duration((1 - rl.tokens) / rl.perSecond * float64(time.Second))
+		expired := make(chan struct{}, 1)
+		rl.clock.AfterFunc(wait, func() { expired <- struct{}{} })
+		<-expired
+		rl.refill()
+	}
+	allowed := int(rl.tokens)
+	if allowed > pending {
+		allowed = pending
+	}
+	if allowed < 1 {
+		/* rounding */
+		allowed = 1
+	}
+	rl.tokens -= float64(allowed)
+	return allowed
+}
+
+// refill adds the tokens for the time elapsed since the last refill.
+func (rl *rateLimiter) refill() {
+	now := rl.clock.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.perSecond
+	if rl.tokens > rl.perSecond {
+		rl.tokens = rl.perSecond
+	}
+	rl.last = now
+}
+
+// paceApply waits until the apply of the next pod is allowed by the limiter,
+// with <pending> pods at most remaining in the transaction. Unless resync,
+// the renderer transactions with the changes so far are committed before
+// waiting, returned are the transactions to continue with (nil if they should
+// be started anew).
+func (pct *PolicyConfiguratorTxn) paceApply(rendererTxns []renderer.Txn, pending int) ([]renderer.Txn, error) {
+	var err error
+	if pct.applyBudget <= 0 {
+		if !pct.resync && len(rendererTxns) > 0 {
+			err = pct.configurator.commitRenderers(rendererTxns)
+			rendererTxns = nil
+		}
+		pct.applyBudget = pct.configurator.applyLimiter.Acquire(pending)
+		pct.Log.WithFields(logging.Fields{
+			"pending": pending,
+			"allowed": pct.applyBudget,
+		}).Debug("Pacing applies of pods")
+	}
+	pct.applyBudget--
+	return rendererTxns, err
+}
@@ -0,0 +1,190 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// pendingTimers returns the number of timers of the fake clock not yet fired.
+func pendingTimers(clock *fakeClock) int {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return len(clock.timers)
+}
+
+func TestApplyRateLimit(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestApplyRateLimit")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		numPods   = 5
+	)
+	var pods []podmodel.ID
+	for i := 1; i <= numPods; i++ {
+		pods = append(pods, podmodel.ID{Name: fmt.Sprintf("pod%d", i), Namespace: namespace})
+	}
+
+	// ingress allowed only on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// ingress allowed only on TCP:443
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	for i, pod := range pods {
+		cache.AddPodConfig(pod, fmt.Sprintf("192.168.1.%d", i+1))
+	}
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	clock := newFakeClock()
+	renderer := NewMockRenderer("A", logger)
+	refRenderer := NewMockRenderer("B", logger)
+
+	// Initialize configurators: with 2 pods per second and without the limit.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithClock(clock), WithApplyRateLimit(2))
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	refConfigurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	refConfigurator.Init(false)
+	err = refConfigurator.RegisterRenderer(refRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	commit := func(configurator *PolicyConfigurator, resync bool, policies map[podmodel.ID]*ContivPolicy) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			txn := configurator.NewTxn(resync)
+			for _, pod := range pods {
+				txn.Configure(pod, []*ContivPolicy{policies[pod]})
+			}
+			done <- txn.Commit()
+		}()
+		return done
+	}
+	appliedPods := func() int {
+		applied := 0
+		for _, pod := range pods {
+			if _, egress := renderer.GetRules(pod); egress != nil {
+				applied++
+			}
+		}
+		return applied
+	}
+	expectSameRules := func() {
+		for _, pod := range pods {
+			ingress, egress := renderer.GetRules(pod)
+			refIngress, refEgress := refRenderer.GetRules(pod)
+			gomega.Expect(ingress).To(gomega.Equal(refIngress))
+			gomega.Expect(egress).To(gomega.Equal(refEgress))
+		}
+	}
+
+	// A burst of applies: 2 pods immediately, then 1 pod per 500ms.
+	policies := map[podmodel.ID]*ContivPolicy{}
+	for _, pod := range pods {
+		policies[pod] = policy1
+	}
+	done := commit(configurator, false, policies)
+	for step := 0; step < numPods-2; step++ {
+		gomega.Eventually(func() int { return pendingTimers(clock) }).Should(gomega.Equal(1))
+		gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(step + 1))
+		gomega.Expect(appliedPods()).To(gomega.Equal(step + 2))
+		// applied in order
+		_, egress := renderer.GetRules(pods[step+1])
+		gomega.Expect(egress).ToNot(gomega.BeNil())
+		gomega.Expect(done).ToNot(gomega.Receive())
+		clock.Advance(500 * time.Millisecond)
+	}
+	gomega.Eventually(done).Should(gomega.Receive(gomega.BeNil()))
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(numPods - 1))
+	gomega.Expect(<-commit(refConfigurator, false, policies)).To(gomega.BeNil())
+	expectSameRules()
+
+	// Resync replaces the configuration in one renderer commit once all pods are allowed.
+	clock.Advance(time.Second)
+	policies[pods[0]] = policy2
+	policies[pods[numPods-1]] = policy2
+	commitCount := renderer.GetCommitCount()
+	done = commit(configurator, true, policies)
+	for step := 0; step < numPods-2; step++ {
+		gomega.Eventually(func() int { return pendingTimers(clock) }).Should(gomega.Equal(1))
+		gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commitCount))
+		gomega.Expect(done).ToNot(gomega.Receive())
+		clock.Advance(500 * time.Millisecond)
+	}
+	gomega.Eventually(done).Should(gomega.Receive(gomega.BeNil()))
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commitCount + 1))
+	gomega.Expect(<-commit(refConfigurator, true, policies)).To(gomega.BeNil())
+	expectSameRules()
+	_, egress := renderer.GetRules(pods[0])
+	for _, rule := range egress {
+		gomega.Expect(rule.DestPort).ToNot(gomega.BeEquivalentTo(80))
+	}
+}
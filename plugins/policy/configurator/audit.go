@@ -0,0 +1,150 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// AuditSink receives a record of every successfully committed transaction
+// (see RegisterAuditSink), e.g. to keep an append-only audit log.
+type AuditSink interface {
+	// Record is called with the configurator locked, the sink must not call
+	// back into the configurator. An error returned by the sink is only logged,
+	// the commit is not affected.
+	Record(record *AuditRecord) error
+}
+
+// AuditRecord describes a single committed transaction.
+type AuditRecord struct {
+	// Timestamp is the time of the commit.
+	Timestamp time.Time
+
+	// Resync is true for a transaction which replaced the entire configuration.
+	Resync bool
+
+	// CorrelationIDs lists IDs attached to the committed transaction
+	// (see Txn.WithCorrelationID), possibly several if transactions were
+	// merged (debounced or queued for the maintenance window).
+	CorrelationIDs []string
+
+	// Pods lists IDs of policies (sorted) committed for every pod affected
+	// by the transaction. Pods removed from the configuration have nil list.
+	Pods map[podmodel.ID][]policymodel.ID
+
+	// Diffs describes for every pod with a changed set of policies
+	// the difference against the previously committed configuration.
+	Diffs map[podmodel.ID]PolicySetDiff
+}
+
+// RegisterAuditSink registers a sink receiving records of the committed
+// transactions.
+func (pc *PolicyConfigurator) RegisterAuditSink(sink AuditSink) {
+	pc.auditSinks = append(pc.auditSinks, sink)
+}
+
+// buildAuditRecord builds a record of the transaction. It is expected to be
+// called before the changes are saved to the configurator.
+func (pct *PolicyConfiguratorTxn) buildAuditRecord() *AuditRecord {
+	pc := pct.configurator
+	record := &AuditRecord{
+		Timestamp:      pc.clock.Now(),
+		Resync:         pct.resync,
+		CorrelationIDs: copyStrings(pct.correlationIDs),
+		Pods:           make(map[podmodel.ID][]policymodel.ID),
+		Diffs:          make(map[podmodel.ID]PolicySetDiff),
+	}
+	addPod := func(pod podmodel.ID, policies ContivPolicies) {
+		var ids []policymodel.ID
+		if policies != nil {
+			sorted := policies.Copy()
+			sort.Sort(sorted)
+			ids = []policymodel.ID{}
+			for _, policy := range sorted {
+				ids = append(ids, policy.ID)
+			}
+		}
+		record.Pods[pod] = ids
+		if diff := DiffPolicies(pc.config[pod], policies); !diff.IsEmpty() {
+			record.Diffs[pod] = diff.DeepCopy()
+		}
+	}
+	for pod, policies := range pct.config {
+		if _, hasIPAddr := pct.podIPAddresses[pod]; !hasIPAddr {
+			policies = nil
+		}
+		if _, committed := pc.config[pod]; !committed && policies == nil {
+			// never configured
+			continue
+		}
+		addPod(pod, policies)
+	}
+	if pct.resync {
+		for pod := range pc.config {
+			if _, configured := pct.config[pod]; !configured {
+				addPod(pod, nil)
+			}
+		}
+	}
+	return record
+}
+
+// recordAudit passes the record to all registered audit sinks.
+func (pc *PolicyConfigurator) recordAudit(record *AuditRecord) {
+	for _, sink := range pc.auditSinks {
+		if err := sink.Record(record); err != nil {
+			pc.Log.WithFields(logging.Fields{
+				"err":    err,
+				"resync": record.Resync,
+			}).Warn("Audit sink failed to record the transaction")
+		}
+	}
+}
+
+// DeepCopy returns a deep copy of the diff.
+func (psd PolicySetDiff) DeepCopy() PolicySetDiff {
+	diffCopy := PolicySetDiff{
+		Added:   deepCopyPolicies(psd.Added),
+		Removed: deepCopyPolicies(psd.Removed),
+	}
+	for _, policyDiff := range psd.Changed {
+		policyDiffCopy := policyDiff
+		policyDiffCopy.AddedMatches = deepCopyMatches(policyDiff.AddedMatches)
+		policyDiffCopy.RemovedMatches = deepCopyMatches(policyDiff.RemovedMatches)
+		diffCopy.Changed = append(diffCopy.Changed, policyDiffCopy)
+	}
+	return diffCopy
+}
+
+// deepCopyMatches returns a list with deep copies of the matches.
+// Nil list remains nil.
+func deepCopyMatches(matches []Match) []Match {
+	if matches == nil {
+		return nil
+	}
+	matchesCopy := make([]Match, len(matches))
+	for idx, match := range matches {
+		matchesCopy[idx] = match.DeepCopy()
+	}
+	return matchesCopy
+}
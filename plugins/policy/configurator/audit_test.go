@@ -0,0 +1,195 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// auditLog is an audit sink collecting the records.
+type auditLog struct {
+	records []*AuditRecord
+	err     error
+}
+
+func (al *auditLog) Record(record *AuditRecord) error {
+	al.records = append(al.records, record)
+	return al.err
+}
+
+func TestAuditLog(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestAuditLog")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// ingress allowed on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// policy1 updated to allow TCP:8080
+	policy1v2 := policy1.DeepCopy()
+	policy1v2.Matches[0].Ports = []Port{{Protocol: TCP, Number: 8080}}
+
+	// ingress allowed on TCP:443
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// The failing sink does not fail the commits nor the other sink.
+	failing := &auditLog{err: errors.New("disk full")}
+	configurator.RegisterAuditSink(failing)
+	log := &auditLog{}
+	configurator.RegisterAuditSink(log)
+
+	// Commit 1: policy1 for both pods.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Commit 2: policy1 updated and policy2 added for pod1.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2, policy1v2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Commit 3: resync without pod2.
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	gomega.Expect(failing.records).To(gomega.HaveLen(3))
+	gomega.Expect(log.records).To(gomega.HaveLen(3))
+	for idx, record := range log.records {
+		gomega.Expect(record.Timestamp.IsZero()).To(gomega.BeFalse())
+		gomega.Expect(record.Resync).To(gomega.Equal(idx == 2))
+		if idx > 0 {
+			gomega.Expect(record.Timestamp.Before(log.records[idx-1].Timestamp)).To(gomega.BeFalse())
+		}
+	}
+
+	// Commit 1
+	record := log.records[0]
+	gomega.Expect(record.Pods).To(gomega.Equal(map[podmodel.ID][]policymodel.ID{
+		pod1: {policy1.ID},
+		pod2: {policy1.ID},
+	}))
+	gomega.Expect(record.Diffs).To(gomega.HaveLen(2))
+	gomega.Expect(record.Diffs[pod1].Added).To(gomega.HaveLen(1))
+	gomega.Expect(record.Diffs[pod1].Added[0].ID).To(gomega.Equal(policy1.ID))
+	gomega.Expect(record.Diffs[pod1].Removed).To(gomega.BeEmpty())
+	gomega.Expect(record.Diffs[pod1].Changed).To(gomega.BeEmpty())
+
+	// Commit 2
+	record = log.records[1]
+	gomega.Expect(record.Pods).To(gomega.Equal(map[podmodel.ID][]policymodel.ID{
+		pod1: {policy1.ID, policy2.ID},
+	}))
+	gomega.Expect(record.Diffs).To(gomega.HaveLen(1))
+	diff := record.Diffs[pod1]
+	gomega.Expect(diff.Added).To(gomega.HaveLen(1))
+	gomega.Expect(diff.Added[0].ID).To(gomega.Equal(policy2.ID))
+	gomega.Expect(diff.Removed).To(gomega.BeEmpty())
+	gomega.Expect(diff.Changed).To(gomega.HaveLen(1))
+	gomega.Expect(diff.Changed[0].ID).To(gomega.Equal(policy1.ID))
+	gomega.Expect(diff.Changed[0].AddedMatches).To(gomega.HaveLen(1))
+	gomega.Expect(diff.Changed[0].AddedMatches[0].Ports).To(gomega.Equal([]Port{{Protocol: TCP, Number: 8080}}))
+	gomega.Expect(diff.Changed[0].RemovedMatches).To(gomega.HaveLen(1))
+	gomega.Expect(diff.Changed[0].RemovedMatches[0].Ports).To(gomega.Equal([]Port{{Protocol: TCP, Number: 80}}))
+
+	// Commit 3
+	record = log.records[2]
+	gomega.Expect(record.Pods).To(gomega.Equal(map[podmodel.ID][]policymodel.ID{
+		pod1: {policy2.ID},
+		pod2: nil,
+	}))
+	gomega.Expect(record.Diffs).To(gomega.HaveLen(2))
+	gomega.Expect(record.Diffs[pod1].Added).To(gomega.BeEmpty())
+	gomega.Expect(record.Diffs[pod1].Removed).To(gomega.HaveLen(1))
+	gomega.Expect(record.Diffs[pod1].Removed[0].ID).To(gomega.Equal(policy1.ID))
+	gomega.Expect(record.Diffs[pod2].Removed).To(gomega.HaveLen(1))
+	gomega.Expect(record.Diffs[pod2].Removed[0].ID).To(gomega.Equal(policy1.ID))
+
+	// Records are not backed by the committed configuration.
+	log.records[1].Diffs[pod1].Added[0].Matches = nil
+	gomega.Expect(configurator.config[pod1][0].ID).To(gomega.Equal(policy2.ID))
+	gomega.Expect(configurator.config[pod1][0].Matches).To(gomega.HaveLen(1))
+}
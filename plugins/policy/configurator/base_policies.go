@@ -0,0 +1,141 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ligato/cn-infra/logging"
+
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// RegisterBasePolicy registers (or replaces) a base policy which other policies
+// can inherit the matches from (see ContivPolicy.BaseRef), e.g. a base always
+// allowing DNS and monitoring. The base is identified by its ID. Inheritance
+// is resolved when the rules are generated, i.e. pods already configured with
+// policies inheriting from a replaced base pick up the change with their next
+// commit (or resync). Returns an error if the ID is empty or if the base would
+// make the inheritance cyclic.
+func (pc *PolicyConfigurator) RegisterBasePolicy(base *ContivPolicy) error {
+	pc.Lock()
+	defer pc.Unlock()
+
+	if base.ID == (policymodel.ID{}) {
+		return fmt.Errorf("base policy ID must not be empty")
+	}
+	baseCopy := base.DeepCopy()
+	if _, err := pc.baseChain(baseCopy, pc.registeredBase(baseCopy)); err != nil {
+		return err
+	}
+	pc.basePolicies[base.ID] = baseCopy
+	pc.Log.WithFields(logging.Fields{
+		"policy": base.ID,
+		"base":   base.BaseRef,
+	}).Debug("Registered base policy")
+	return nil
+}
+
+// checkBasePolicies returns an error if any of the policies in the transaction
+// inherits from a base cyclically.
+func (pct *PolicyConfiguratorTxn) checkBasePolicies() error {
+	checked := make(map[*ContivPolicy]struct{})
+	for _, policies := range pct.config {
+		for _, policy := range policies {
+			if _, isChecked := checked[policy]; isChecked || policy.BaseRef == (policymodel.ID{}) {
+				continue
+			}
+			checked[policy] = struct{}{}
+			if _, err := pct.configurator.baseChain(policy, pct.configurator.registeredBase(nil)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// inheritedPolicies returns the policies with the matches of their bases
+// appended. If no policy has a base, the same list is returned.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) inheritedPolicies(policies ContivPolicies) ContivPolicies {
+	var inherited ContivPolicies
+	for idx, policy := range policies {
+		if policy.BaseRef == (policymodel.ID{}) {
+			continue
+		}
+		chain, err := pc.baseChain(policy, pc.registeredBase(nil))
+		if err != nil {
+			pc.Log.WithField("err", err).Warn("Ignoring base policies")
+			continue
+		}
+		if len(chain) == 0 {
+			continue
+		}
+		if inherited == nil {
+			inherited = policies.Copy()
+		}
+		merged := *policy
+		merged.Matches = append([]Match{}, policy.Matches...)
+		for _, base := range chain {
+			merged.Matches = append(merged.Matches, base.Matches...)
+		}
+		inherited[idx] = &merged
+	}
+	if inherited == nil {
+		return policies
+	}
+	return inherited
+}
+
+// registeredBase returns a lookup of registered base policies, with <override>
+// (if not nil) used in place of the registered base with the same ID.
+func (pc *PolicyConfigurator) registeredBase(override *ContivPolicy) func(id policymodel.ID) *ContivPolicy {
+	return func(id policymodel.ID) *ContivPolicy {
+		if override != nil && override.ID == id {
+			return override
+		}
+		return pc.basePolicies[id]
+	}
+}
+
+// baseChain returns the bases of the policy, from the direct base to the most
+// distant one. Unregistered bases end the chain (with a warning). Returns
+// an error if the policy inherits from itself, directly or indirectly.
+func (pc *PolicyConfigurator) baseChain(policy *ContivPolicy, lookup func(id policymodel.ID) *ContivPolicy) ([]*ContivPolicy, error) {
+	var chain []*ContivPolicy
+	path := []string{policy.ID.String()}
+	visited := map[policymodel.ID]struct{}{policy.ID: {}}
+	for ref := policy.BaseRef; ref != (policymodel.ID{}); {
+		path = append(path, ref.String())
+		if _, cyclic := visited[ref]; cyclic {
+			return nil, fmt.Errorf("cyclic inheritance of policy %s: %s", policy.ID, strings.Join(path, " -> "))
+		}
+		visited[ref] = struct{}{}
+		base := lookup(ref)
+		if base == nil {
+			pc.Log.WithFields(logging.Fields{
+				"policy": policy.ID,
+				"base":   ref,
+			}).Warn("Referenced base policy is not registered")
+			break
+		}
+		chain = append(chain, base)
+		ref = base.BaseRef
+	}
+	return chain, nil
+}
@@ -0,0 +1,178 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestBasePolicies(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestBasePolicies")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1IP     = "192.168.1.1"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	dnsMatch := Match{
+		Type:  MatchIngress,
+		Ports: []Port{{Protocol: UDP, Number: 53}},
+	}
+	monitoringMatch := Match{
+		Type:  MatchIngress,
+		Ports: []Port{{Protocol: TCP, Number: 9100}},
+	}
+	webMatch := Match{
+		Type:  MatchIngress,
+		Ports: []Port{{Protocol: TCP, Number: 80}},
+	}
+
+	// base allowing DNS
+	dnsBase := &ContivPolicy{
+		ID:      policymodel.ID{Name: "dns-base", Namespace: namespace},
+		Type:    PolicyIngress,
+		Matches: []Match{dnsMatch},
+	}
+
+	// base allowing monitoring, inheriting from the DNS base
+	monitoringBase := &ContivPolicy{
+		ID:      policymodel.ID{Name: "monitoring-base", Namespace: namespace},
+		Type:    PolicyIngress,
+		Matches: []Match{monitoringMatch},
+		BaseRef: dnsBase.ID,
+	}
+
+	// derived policy allowing web traffic
+	derived := &ContivPolicy{
+		ID:      policymodel.ID{Name: "web", Namespace: namespace},
+		Type:    PolicyIngress,
+		Matches: []Match{webMatch},
+		BaseRef: monitoringBase.ID,
+	}
+	gomega.Expect(derived.String()).To(gomega.HaveSuffix(", BaseRef:default/monitoring-base>"))
+
+	// the same policy flattened by hand
+	flattened := &ContivPolicy{
+		ID:      derived.ID,
+		Type:    PolicyIngress,
+		Matches: []Match{webMatch, monitoringMatch, dnsMatch},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	newConfigurator := func(renderer *MockRenderer) *PolicyConfigurator {
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator
+	}
+
+	renderer := NewMockRenderer("A", logger)
+	configurator := newConfigurator(renderer)
+	err := configurator.RegisterBasePolicy(monitoringBase)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterBasePolicy(dnsBase)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	refRenderer := NewMockRenderer("B", logger)
+	refConfigurator := newConfigurator(refRenderer)
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{derived})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	txn = refConfigurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{flattened})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// The rules are the union of the matches of the policy and of its bases.
+	ingress, egress := renderer.GetRules(pod1)
+	refIngress, refEgress := refRenderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.Equal(refIngress))
+	gomega.Expect(egress).To(gomega.Equal(refEgress))
+	for _, port := range []uint16{80, 9100} {
+		gomega.Expect(renderer.TestTraffic(pod1, EgressTraffic, parseIP(externalIP), parseIP(pod1IP),
+			rendererAPI.TCP, 123, port)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	}
+	gomega.Expect(renderer.TestTraffic(pod1, EgressTraffic, parseIP(externalIP), parseIP(pod1IP),
+		rendererAPI.UDP, 123, 53)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(renderer.TestTraffic(pod1, EgressTraffic, parseIP(externalIP), parseIP(pod1IP),
+		rendererAPI.TCP, 123, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// The configured policy is not modified.
+	gomega.Expect(derived.Matches).To(gomega.Equal([]Match{webMatch}))
+
+	// Cycle between the bases is rejected.
+	cyclicBase := dnsBase.DeepCopy()
+	cyclicBase.BaseRef = monitoringBase.ID
+	err = configurator.RegisterBasePolicy(cyclicBase)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring("cyclic"))
+
+	// Policy inheriting from itself is rejected.
+	selfBase := &ContivPolicy{
+		ID:      policymodel.ID{Name: "self-base", Namespace: namespace},
+		Type:    PolicyIngress,
+		BaseRef: derived.ID,
+	}
+	err = configurator.RegisterBasePolicy(selfBase)
+	gomega.Expect(err).To(gomega.BeNil())
+	cyclic := derived.DeepCopy()
+	cyclic.BaseRef = selfBase.ID
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{cyclic})
+	err = txn.Commit()
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring("default/web -> default/self-base -> default/web"))
+
+	// The committed rules are preserved.
+	ingress, egress = renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.Equal(refIngress))
+	gomega.Expect(egress).To(gomega.Equal(refEgress))
+}
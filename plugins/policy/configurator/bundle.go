@@ -0,0 +1,182 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// bundleVersion is the version of the format produced by CompileBundle().
+const bundleVersion = 1
+
+// ruleBundleFile is the content of a bundle as serialized by CompileBundle().
+type ruleBundleFile struct {
+	Version int
+	Pods    []bundledPod
+}
+
+// bundledPod are the rules compiled for a single pod. Ingress and Egress are
+// from the vswitch point of view (as PodRules).
+type bundledPod struct {
+	Pod     podmodel.ID
+	PodIP   *cachedNetwork
+	Ingress []cachedRule
+	Egress  []cachedRule
+}
+
+// RuleBundle is a set of rules compiled ahead-of-time by CompileBundle(),
+// loaded by LoadBundle() on the side of an agent which only enforces
+// the policies.
+type RuleBundle struct {
+	pods []bundledRules
+}
+
+// bundledRules are the rules of a single pod of a loaded bundle.
+type bundledRules struct {
+	pod   podmodel.ID
+	podIP *net.IPNet
+	rules PodRules
+}
+
+// CompileBundle translates the given configuration (pod -> policies) into
+// rules the same way a commit would, without committing it, and serializes
+// the rules of every pod into a bundle to be loaded by LoadBundle(). Pods
+// and peers are looked up in the policy cache (Deps.Cache) and the rules are
+// affected by the options of the configurator as with a commit. The rules are
+// not adjusted to the capabilities of renderers, which are not known until
+// the bundle is applied (see ApplyTo()). The committed configuration is not
+// modified. The output is JSON, sorted by pod IDs.
+// Returns error (and no bundle) if any of the pods has no valid IP address.
+func (pc *PolicyConfigurator) CompileBundle(config map[podmodel.ID][]*ContivPolicy) ([]byte, error) {
+	policyLists := make([]ContivPolicies, 0, len(config))
+	for _, policies := range config {
+		policyLists = append(policyLists, policies)
+	}
+	pc.prefetchFQDNs(policyLists)
+
+	pc.Lock()
+	defer pc.Unlock()
+
+	// Rules are generated in a scratch transaction, never committed.
+	pct := pc.NewTxn(true).(*PolicyConfiguratorTxn)
+	pct.podIPAddresses = pc.podIPAddresses.Copy()
+	pct.clusterDNSIP = pc.clusterDNSIP
+	var missing []string
+	for pod, policies := range config {
+		found, podData := pc.Cache.LookupPod(pod)
+		if !found || podData.IpAddress == "" {
+			missing = append(missing, pod.String())
+			continue
+		}
+		podIPNet := pc.hostSubnet(podData.IpAddress)
+		if podIPNet == nil {
+			missing = append(missing, pod.String())
+			continue
+		}
+		pct.podIPAddresses[pod] = podIPNet
+		pct.config[pod] = pc.canonicalPolicies(deepCopyPolicies(policies))
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("pods without IP address: %s", strings.Join(missing, ", "))
+	}
+	pct.applyPolicyToggles()
+
+	bundle := ruleBundleFile{Version: bundleVersion}
+	for _, pod := range sortedPods(pct.config) {
+		policies := pct.effectivePolicies(pod, pct.config[pod])
+		ingress, egress := pct.generateDirectionRules(policies)
+		bundle.Pods = append(bundle.Pods, bundledPod{
+			Pod:     pod,
+			PodIP:   encodeCachedNetwork(pct.podIPAddresses[pod]),
+			Ingress: encodeCachedRules(ingress),
+			Egress:  encodeCachedRules(egress),
+		})
+	}
+	pc.Log.WithField("pods", len(bundle.Pods)).Debug("Compiled rule bundle")
+	return json.Marshal(bundle)
+}
+
+// LoadBundle parses a bundle serialized by CompileBundle().
+func LoadBundle(data []byte) (*RuleBundle, error) {
+	file := ruleBundleFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid rule bundle: %v", err)
+	}
+	if file.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported version of rule bundle: %d", file.Version)
+	}
+	bundle := &RuleBundle{}
+	for _, pod := range file.Pods {
+		ingress, ingressValid := decodeCachedRules(pod.Ingress)
+		egress, egressValid := decodeCachedRules(pod.Egress)
+		if pod.PodIP == nil || !ingressValid || !egressValid {
+			return nil, fmt.Errorf("invalid rules of pod %s in rule bundle", pod.Pod)
+		}
+		bundle.pods = append(bundle.pods, bundledRules{
+			pod:   pod.Pod,
+			podIP: decodeCachedNetwork(pod.PodIP),
+			rules: PodRules{Ingress: ingress, Egress: egress},
+		})
+	}
+	return bundle, nil
+}
+
+// Pods returns IDs of all pods of the bundle, sorted by namespace and name.
+func (rb *RuleBundle) Pods() []podmodel.ID {
+	pods := []podmodel.ID{}
+	for _, bundled := range rb.pods {
+		pods = append(pods, bundled.pod)
+	}
+	return pods
+}
+
+// ApplyTo renders the rules of all pods of the bundle into the given renderer
+// in a single resync transaction, without any translation of policies.
+// The renderer receives (copies of) the rules as flat lists, the same as
+// ReplayTo(). Pods with rules the renderer is not able to apply are skipped
+// and reported by the returned error, together with a failed commit.
+func (rb *RuleBundle) ApplyTo(rndr renderer.PolicyRendererAPI) error {
+	txn := rndr.NewTxn(true)
+	var failed []string
+	for _, bundled := range rb.pods {
+		ingress, egress := bundled.rules.Ingress, bundled.rules.Egress
+		err := checkCapabilities(rndr, ingress, egress)
+		if err == nil {
+			err = checkRuleFormat(rndr, ingress, egress)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", bundled.pod, err))
+			continue
+		}
+		txn.Render(bundled.pod, bundled.podIP, ingress.Copy(), egress.Copy(), false)
+	}
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to apply rule bundle for pods: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestRuleBundle(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRuleBundle")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	pod3 := podmodel.ID{Name: "pod3", Namespace: namespace}
+	unknownPod := podmodel.ID{Name: "unknown", Namespace: namespace}
+
+	// ingress allowed on TCP:80 from pod2
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	// egress allowed to 10.0.0.0/8 on UDP:53
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type:     MatchEgress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.0.0/8")}},
+				Ports:    []Port{{Protocol: UDP, Number: 53}},
+			},
+		},
+	}
+	config := map[podmodel.ID][]*ContivPolicy{
+		pod1: {policy1, policy2},
+		pod2: {policy2},
+		pod3: {},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	newConfigurator := func() *PolicyConfigurator {
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false)
+		return configurator
+	}
+
+	// Live translation.
+	liveRenderer := NewMockRenderer("A", logger)
+	live := newConfigurator()
+	err := live.RegisterRenderer(liveRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	txn := live.NewTxn(false)
+	for pod, policies := range config {
+		txn.Configure(pod, policies)
+	}
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Compile-time.
+	compiler := newConfigurator()
+	data, err := compiler.CompileBundle(config)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(compiler.ConfiguredPods()).To(gomega.BeEmpty())
+
+	// Enforce-time.
+	bundle, err := LoadBundle(data)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(bundle.Pods()).To(gomega.Equal([]podmodel.ID{pod1, pod2, pod3}))
+	agentRenderer := NewMockRenderer("B", logger)
+	err = bundle.ApplyTo(agentRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(agentRenderer.GetCommitCount()).To(gomega.Equal(1))
+
+	// The rules are identical to the live translation.
+	for pod := range config {
+		liveIngress, liveEgress := liveRenderer.GetRules(pod)
+		ingress, egress := agentRenderer.GetRules(pod)
+		gomega.Expect(ingress).To(gomega.Equal(liveIngress))
+		gomega.Expect(egress).To(gomega.Equal(liveEgress))
+		liveIP, liveMask := liveRenderer.GetPodIP(pod)
+		ip, mask := agentRenderer.GetPodIP(pod)
+		gomega.Expect(ip).To(gomega.Equal(liveIP))
+		gomega.Expect(mask).To(gomega.Equal(liveMask))
+	}
+	_, egress := agentRenderer.GetRules(pod1)
+	gomega.Expect(egress).ToNot(gomega.BeEmpty())
+
+	// Pods without IP address cannot be compiled.
+	_, err = compiler.CompileBundle(map[podmodel.ID][]*ContivPolicy{unknownPod: {policy1}})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(unknownPod.String()))
+
+	// Invalid bundles are refused.
+	_, err = LoadBundle([]byte("{"))
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	_, err = LoadBundle([]byte(`{"Version": 2}`))
+	gomega.Expect(err).ToNot(gomega.BeNil())
+}
@@ -0,0 +1,91 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// hasCapability returns true if the given renderer advertises the capability.
+func hasCapability(rndr renderer.PolicyRendererAPI, capability renderer.Capability) bool {
+	advertiser, isAdvertiser := rndr.(renderer.CapabilityAdvertiser)
+	if !isAdvertiser {
+		return false
+	}
+	return advertiser.HasCapability(capability)
+}
+
+// checkCapabilities returns an error if any of the given rules requires
+// a capability that the renderer does not have, or if the order of the rules
+// matters and the renderer does not preserve it.
+func checkCapabilities(rndr renderer.PolicyRendererAPI, ruleLists ...ContivRules) error {
+	for _, rules := range ruleLists {
+		if deniesBeforeLast(rules) && !hasCapability(rndr, renderer.OrderedRules) {
+			return fmt.Errorf("renderer does not support %s required by DENY rules preceding the last rule",
+				renderer.OrderedRules)
+		}
+		for _, rule := range rules {
+			for _, capability := range rule.RequiredCapabilities() {
+				if !hasCapability(rndr, capability) {
+					return fmt.Errorf("renderer does not support %s required by %s",
+						capability, rule)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// withoutRuleFeature returns the rules with a feature not supported
+// by a renderer removed. <hasFeature> selects the rules using the feature,
+// these are replaced with copies modified by <removeFeature>. Rules which
+// become duplicates are skipped. If none of the rules uses the feature,
+// the same list is returned.
+func withoutRuleFeature(rules ContivRules, hasFeature func(rule *renderer.ContivRule) bool,
+	removeFeature func(rule *renderer.ContivRule)) ContivRules {
+
+	used := false
+	for _, rule := range rules {
+		if hasFeature(rule) {
+			used = true
+			break
+		}
+	}
+	if !used {
+		return rules
+	}
+	stripped := ContivRules{}
+	for _, rule := range rules {
+		if hasFeature(rule) {
+			rule = rule.Copy()
+			removeFeature(rule)
+		}
+		duplicate := false
+		for _, added := range stripped {
+			if added.Compare(rule) == 0 {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			stripped = append(stripped, rule)
+		}
+	}
+	return stripped
+}
@@ -0,0 +1,195 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+)
+
+// CIDRTrie is a compact representation of the set of IP addresses allowed by
+// a list of IP blocks. It is a binary path-compressed (patricia) trie with
+// a separate root for each address family, where every node marked as allowed
+// covers its whole subtree. Exceptions are subtracted from their block before
+// the insertion, hence the trie only stores allowed prefixes and the lookup
+// cost depends on the address length rather than on the number of blocks.
+//
+// The trie is immutable once built and safe for concurrent queries.
+type CIDRTrie struct {
+	ipv4 *cidrTrieNode
+	ipv6 *cidrTrieNode
+}
+
+// cidrTrieNode is a single node of CIDRTrie.
+type cidrTrieNode struct {
+	prefix  net.IP // with host bits cleared, 4-byte for IPv4
+	length  int
+	allowed bool
+	child   [2]*cidrTrieNode
+}
+
+// BuildCIDRTrie builds a trie of the addresses allowed by the given IP blocks,
+// i.e. the union of the block networks each with its exceptions subtracted.
+// Exceptions are scoped to their block - an address excepted from one block
+// is still allowed if it is contained by another block.
+func BuildCIDRTrie(blocks []IPBlock) *CIDRTrie {
+	trie := &CIDRTrie{}
+	for _, block := range blocks {
+		for _, subnet := range subtractExcepts(canonicalBlock(block)) {
+			trie.insert(subnet)
+		}
+	}
+	return trie
+}
+
+// Contains returns true if the IP address is allowed by the IP blocks
+// the trie was built from.
+func (t *CIDRTrie) Contains(ip net.IP) bool {
+	node, addr := t.root(ip)
+	for node != nil {
+		if commonPrefixLen(node.prefix, addr, node.length) < node.length {
+			return false
+		}
+		if node.allowed {
+			return true
+		}
+		node = node.child[bitAt(addr, node.length)]
+	}
+	return false
+}
+
+// Prefixes returns the list of non-overlapping networks covering
+// exactly the allowed addresses (IPv4 first, in the ascending order).
+// Renderers able to install trie-based (longest-prefix) matches may use
+// the list instead of one rule per subnet.
+func (t *CIDRTrie) Prefixes() []*net.IPNet {
+	prefixes := []*net.IPNet{}
+	prefixes = t.ipv4.appendPrefixes(prefixes, net.IPv4len*8)
+	prefixes = t.ipv6.appendPrefixes(prefixes, net.IPv6len*8)
+	return prefixes
+}
+
+// root returns the root node for the family of the IP address together with
+// the address in the form matching the trie.
+func (t *CIDRTrie) root(ip net.IP) (*cidrTrieNode, net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return t.ipv4, ip4
+	}
+	if len(ip) != net.IPv6len {
+		return nil, nil
+	}
+	return t.ipv6, ip
+}
+
+// insert adds the subnet into the trie.
+func (t *CIDRTrie) insert(subnet *net.IPNet) {
+	ones, bits := subnet.Mask.Size()
+	root := &t.ipv6
+	if bits == net.IPv4len*8 {
+		root = &t.ipv4
+	}
+	if bits == 0 || len(subnet.IP) != bits/8 {
+		return
+	}
+	prefix := subnet.IP.Mask(subnet.Mask)
+
+	link := root
+	for {
+		node := *link
+		if node == nil {
+			*link = &cidrTrieNode{prefix: prefix, length: ones, allowed: true}
+			return
+		}
+		common := commonPrefixLen(node.prefix, prefix, minInt(node.length, ones))
+		if common == node.length {
+			if node.allowed {
+				// already covered
+				return
+			}
+			if ones == node.length {
+				// covers the whole subtree
+				node.allowed = true
+				node.child = [2]*cidrTrieNode{}
+				return
+			}
+			link = &node.child[bitAt(prefix, node.length)]
+			continue
+		}
+		leaf := &cidrTrieNode{prefix: prefix, length: ones, allowed: true}
+		if common == ones {
+			// the new subnet covers the node
+			*link = leaf
+			return
+		}
+		// split at the first differing bit
+		branch := &cidrTrieNode{
+			prefix: prefix.Mask(net.CIDRMask(common, bits)),
+			length: common,
+		}
+		branch.child[bitAt(node.prefix, common)] = node
+		branch.child[bitAt(prefix, common)] = leaf
+		*link = branch
+		return
+	}
+}
+
+// appendPrefixes appends networks of the allowed nodes of the subtree.
+func (n *cidrTrieNode) appendPrefixes(prefixes []*net.IPNet, bits int) []*net.IPNet {
+	if n == nil {
+		return prefixes
+	}
+	if n.allowed {
+		return append(prefixes, &net.IPNet{IP: n.prefix, Mask: net.CIDRMask(n.length, bits)})
+	}
+	prefixes = n.child[0].appendPrefixes(prefixes, bits)
+	return n.child[1].appendPrefixes(prefixes, bits)
+}
+
+// commonPrefixLen returns the number of leading bits (up to max) shared by
+// both addresses.
+func commonPrefixLen(ip1, ip2 net.IP, max int) int {
+	common := 0
+	for i := 0; i < len(ip1) && i < len(ip2) && common < max; i++ {
+		diff := ip1[i] ^ ip2[i]
+		for bit := uint(7); common < max; bit-- {
+			if diff&(1<<bit) != 0 {
+				return common
+			}
+			common++
+			if bit == 0 {
+				break
+			}
+		}
+	}
+	return common
+}
+
+// bitAt returns the value of the bit of the address at the given position
+// (counted from the most significant bit).
+func bitAt(ip net.IP, pos int) int {
+	if pos/8 >= len(ip) {
+		return 0
+	}
+	return int(ip[pos/8]>>uint(7-pos%8)) & 1
+}
+
+// minInt returns the smaller of the two integers.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
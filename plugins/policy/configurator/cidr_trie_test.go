@@ -0,0 +1,184 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+// containsLinear evaluates the IP blocks one by one.
+func containsLinear(blocks []IPBlock, ip net.IP) bool {
+	for _, block := range blocks {
+		if !block.Network.Contains(ip) {
+			continue
+		}
+		excepted := false
+		for _, except := range block.Except {
+			if except.Contains(ip) {
+				excepted = true
+				break
+			}
+		}
+		if !excepted {
+			return true
+		}
+	}
+	return false
+}
+
+// randomBlocks generates IPv4 blocks with random networks and exceptions.
+func randomBlocks(rnd *rand.Rand, count int) []IPBlock {
+	blocks := []IPBlock{}
+	for i := 0; i < count; i++ {
+		ones := 8 + rnd.Intn(17)
+		ip := net.IPv4(10, byte(rnd.Intn(256)), byte(rnd.Intn(256)), byte(rnd.Intn(256))).To4()
+		block := IPBlock{Network: net.IPNet{IP: ip.Mask(net.CIDRMask(ones, 32)), Mask: net.CIDRMask(ones, 32)}}
+		for j := rnd.Intn(3); j > 0; j-- {
+			exceptOnes := ones + 1 + rnd.Intn(8)
+			exceptIP := make(net.IP, net.IPv4len)
+			copy(exceptIP, block.Network.IP)
+			exceptIP[3] = byte(rnd.Intn(256))
+			exceptIP[2] |= byte(rnd.Intn(256)) & ^block.Network.Mask[2]
+			block.Except = append(block.Except,
+				net.IPNet{IP: exceptIP.Mask(net.CIDRMask(exceptOnes, 32)), Mask: net.CIDRMask(exceptOnes, 32)})
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// randomIPs generates IPv4 addresses inside and around 10.0.0.0/8.
+func randomIPs(rnd *rand.Rand, count int) []net.IP {
+	ips := []net.IP{}
+	for i := 0; i < count; i++ {
+		ips = append(ips, net.IPv4(byte(9+rnd.Intn(3)), byte(rnd.Intn(256)), byte(rnd.Intn(256)), byte(rnd.Intn(256))))
+	}
+	return ips
+}
+
+func TestCIDRTrie(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	blocks := []IPBlock{
+		{
+			Network: parseIPNet("10.0.0.0/8"),
+			Except:  []net.IPNet{parseIPNet("10.1.0.0/16"), parseIPNet("10.2.2.0/24")},
+		},
+		{
+			// re-allows part of the exception of the first block
+			Network: parseIPNet("10.1.0.0/16"),
+			Except:  []net.IPNet{parseIPNet("10.1.1.0/24")},
+		},
+		{
+			Network: parseIPNet("192.168.1.0/24"),
+		},
+		{
+			// covered by the previous block
+			Network: parseIPNet("192.168.1.128/25"),
+		},
+		{
+			Network: parseIPNet("2001:db8::/32"),
+			Except:  []net.IPNet{parseIPNet("2001:db8:1::/48")},
+		},
+	}
+	trie := BuildCIDRTrie(blocks)
+
+	gomega.Expect(trie.Contains(net.ParseIP("10.0.0.1"))).To(gomega.BeTrue())
+	gomega.Expect(trie.Contains(net.ParseIP("10.255.255.255"))).To(gomega.BeTrue())
+	gomega.Expect(trie.Contains(net.ParseIP("10.1.2.3"))).To(gomega.BeTrue())
+	gomega.Expect(trie.Contains(net.ParseIP("10.1.1.1"))).To(gomega.BeFalse())
+	gomega.Expect(trie.Contains(net.ParseIP("10.2.2.2"))).To(gomega.BeFalse())
+	gomega.Expect(trie.Contains(net.ParseIP("10.2.3.2"))).To(gomega.BeTrue())
+	gomega.Expect(trie.Contains(net.ParseIP("11.0.0.1"))).To(gomega.BeFalse())
+	gomega.Expect(trie.Contains(net.ParseIP("192.168.1.200"))).To(gomega.BeTrue())
+	gomega.Expect(trie.Contains(net.ParseIP("192.168.2.1"))).To(gomega.BeFalse())
+	gomega.Expect(trie.Contains(net.ParseIP("2001:db8::1"))).To(gomega.BeTrue())
+	gomega.Expect(trie.Contains(net.ParseIP("2001:db8:1::1"))).To(gomega.BeFalse())
+	gomega.Expect(trie.Contains(net.ParseIP("2001:db9::1"))).To(gomega.BeFalse())
+	gomega.Expect(trie.Contains(nil)).To(gomega.BeFalse())
+
+	// IPv4-mapped IPv6 address is looked up as IPv4
+	gomega.Expect(trie.Contains(net.ParseIP("::ffff:10.0.0.1"))).To(gomega.BeTrue())
+
+	// prefixes do not overlap and cover the same addresses
+	prefixes := trie.Prefixes()
+	for i := range prefixes {
+		for j := range prefixes {
+			if i != j {
+				gomega.Expect(prefixes[i].Contains(prefixes[j].IP)).To(gomega.BeFalse())
+			}
+		}
+	}
+	gomega.Expect(prefixes[0].String()).To(gomega.Equal("10.0.0.0/16"))
+	gomega.Expect(prefixes[len(prefixes)-1].String()).To(gomega.Equal("2001:db8:8000::/33"))
+	gomega.Expect(BuildCIDRTrie(nil).Prefixes()).To(gomega.BeEmpty())
+
+	// default route with an exception
+	trie = BuildCIDRTrie([]IPBlock{{
+		Network: parseIPNet("0.0.0.0/0"),
+		Except:  []net.IPNet{parseIPNet("10.0.0.0/8")},
+	}})
+	gomega.Expect(trie.Contains(net.ParseIP("8.8.8.8"))).To(gomega.BeTrue())
+	gomega.Expect(trie.Contains(net.ParseIP("10.0.0.1"))).To(gomega.BeFalse())
+	gomega.Expect(trie.Contains(net.ParseIP("2001:db8::1"))).To(gomega.BeFalse())
+}
+
+func TestCIDRTrieRandom(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	rnd := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		blocks := randomBlocks(rnd, 1+rnd.Intn(200))
+		trie := BuildCIDRTrie(blocks)
+		for _, ip := range randomIPs(rnd, 500) {
+			gomega.Expect(trie.Contains(ip)).To(gomega.Equal(containsLinear(blocks, ip)),
+				fmt.Sprintf("round %d, IP %s", round, ip))
+		}
+	}
+}
+
+func BenchmarkCIDRTrieContains(b *testing.B) {
+	for _, count := range []int{100, 1000, 5000} {
+		rnd := rand.New(rand.NewSource(1))
+		blocks := randomBlocks(rnd, count)
+		ips := randomIPs(rnd, 1024)
+		trie := BuildCIDRTrie(blocks)
+
+		b.Run(fmt.Sprintf("trie-%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				trie.Contains(ips[i%len(ips)])
+			}
+		})
+		b.Run(fmt.Sprintf("linear-%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				containsLinear(blocks, ips[i%len(ips)])
+			}
+		})
+	}
+}
+
+func BenchmarkBuildCIDRTrie(b *testing.B) {
+	blocks := randomBlocks(rand.New(rand.NewSource(1)), 5000)
+	for i := 0; i < b.N; i++ {
+		BuildCIDRTrie(blocks)
+	}
+}
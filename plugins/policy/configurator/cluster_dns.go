@@ -0,0 +1,125 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+
+	"github.com/ligato/cn-infra/logging"
+
+	"github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/contiv/vpp/plugins/policy/utils"
+)
+
+const (
+	// dnsPort is the port on which the cluster DNS service listens (both TCP and UDP).
+	dnsPort = 53
+
+	// clusterDNSLabel labels rules injected by the WithAutoAllowClusterDNS option.
+	clusterDNSLabel = "auto-allow-cluster-dns"
+)
+
+// ClusterDNSProvider provides the current IP addresses of the cluster DNS
+// service (kube-dns).
+type ClusterDNSProvider interface {
+	// GetClusterDNSIPs returns the IP addresses the cluster DNS service is
+	// currently reachable at.
+	GetClusterDNSIPs() []net.IP
+}
+
+// WithAutoAllowClusterDNS makes the configurator to always allow egress
+// to the cluster DNS service (TCP and UDP port 53) for pods with restricted
+// egress, even if none of the pod's policies explicitly allows it.
+// The DNS IP addresses are obtained from the given provider in Init().
+// The configurator does not watch the service: whoever watches it (e.g.
+// the service processor owning the provider) must call RefreshClusterDNS()
+// whenever the service changes, otherwise the rules keep allowing
+// the addresses read the last time. The injected rules are described
+// as "auto-allow-cluster-dns".
+func WithAutoAllowClusterDNS(dnsProvider ClusterDNSProvider) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.dnsProvider = dnsProvider
+	}
+}
+
+// RefreshClusterDNS re-reads IP addresses of the cluster DNS service
+// from the provider and if they have changed, re-renders rules of all
+// configured pods.
+func (pc *PolicyConfigurator) RefreshClusterDNS() error {
+	if pc.dnsProvider == nil {
+		return nil
+	}
+	pc.Lock()
+	defer pc.Unlock()
+	dnsIPs := sortedIPs(pc.dnsProvider.GetClusterDNSIPs())
+	if equalIPs(dnsIPs, pc.clusterDNSIP) {
+		return nil
+	}
+	pc.Log.WithField("dnsIPs", dnsIPs).Debug("Cluster DNS IP addresses have changed")
+	pc.clusterDNSIP = dnsIPs
+	return pc.rerender()
+}
+
+// rerender re-generates and re-renders rules for all configured pods
+// from the committed configuration.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) rerender() error {
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for pod, policies := range pc.config {
+		txn.configure(pod, policies)
+	}
+	return txn.commit()
+}
+
+// clusterDNSRules returns rules allowing to access the cluster DNS service.
+// Returns nil if the option WithAutoAllowClusterDNS is not enabled.
+func (pct *PolicyConfiguratorTxn) clusterDNSRules() []*renderer.ContivRule {
+	var rules []*renderer.ContivRule
+	for _, dnsIP := range pct.clusterDNSIP {
+		for _, protocol := range []renderer.ProtocolType{renderer.UDP, renderer.TCP} {
+			rule := &renderer.ContivRule{
+				Action:      renderer.ActionPermit,
+				SrcNetwork:  &net.IPNet{},
+				DestNetwork: utils.GetOneHostSubnetFromIP(dnsIP),
+				Protocol:    protocol,
+				SrcPort:     0,
+				DestPort:    dnsPort,
+				Description: clusterDNSLabel,
+			}
+			pct.Log.WithFields(logging.Fields{
+				"label": clusterDNSLabel,
+				"rule":  rule,
+			}).Debug("Injecting rule allowing access to the cluster DNS")
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// equalIPs returns true if the two lists contain the same IP addresses
+// in the same order (the lists are expected to be sorted by sortedIPs).
+func equalIPs(ips1, ips2 []net.IP) bool {
+	if len(ips1) != len(ips2) {
+		return false
+	}
+	for idx := range ips1 {
+		if !ips1[idx].Equal(ips2[idx]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+type fakeDNSProvider struct {
+	ips []net.IP
+}
+
+func (fdp *fakeDNSProvider) GetClusterDNSIPs() []net.IP {
+	return fdp.ips
+}
+
+func TestAutoAllowClusterDNS(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestAutoAllowClusterDNS")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+		dnsIP     = "10.96.0.10"
+		newDNSIP  = "10.96.0.20"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// egress restricted to pod2:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type: MatchEgress,
+				Pods: []podmodel.ID{
+					pod2,
+				},
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+
+	// egress denied completely
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyEgress,
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	dnsProvider := &fakeDNSProvider{ips: []net.IP{net.ParseIP(dnsIP)}}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithAutoAllowClusterDNS(dnsProvider))
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod3, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Test with fake traffic.
+	for _, pod := range []podmodel.ID{pod1, pod3} {
+		podIP := pod1IP
+		if pod == pod3 {
+			podIP = pod3IP
+		}
+
+		// Allowed cluster DNS.
+		action := renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(dnsIP), rendererAPI.UDP, 123, 53)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(dnsIP), rendererAPI.TCP, 123, 53)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+		// Other ports of the DNS service are still blocked.
+		action = renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(dnsIP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+		action = renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(dnsIP), rendererAPI.OTHER, 0, 0)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+		// DNS port elsewhere is blocked.
+		action = renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(newDNSIP), rendererAPI.UDP, 123, 53)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+
+	// Injected rules are described by the label.
+	for _, pod := range []podmodel.ID{pod1, pod3} {
+		// egress of the pod = ingress of the vswitch
+		ingress, _ := renderer.GetRules(pod)
+		dnsRules := 0
+		for _, rule := range ingress {
+			if rule.DestPort == 53 && rule.DestNetwork.IP.Equal(net.ParseIP(dnsIP)) {
+				gomega.Expect(rule.Description).To(gomega.Equal(clusterDNSLabel))
+				dnsRules++
+			}
+		}
+		gomega.Expect(dnsRules).To(gomega.Equal(2))
+	}
+
+	// Allowed by policy1.
+	action := renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Cluster DNS moves to another IP address.
+	dnsProvider.ips = []net.IP{net.ParseIP(newDNSIP)}
+	err = configurator.RefreshClusterDNS()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	for _, pod := range []podmodel.ID{pod1, pod3} {
+		podIP := pod1IP
+		if pod == pod3 {
+			podIP = pod3IP
+		}
+		action = renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(newDNSIP), rendererAPI.UDP, 123, 53)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(newDNSIP), rendererAPI.TCP, 123, 53)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(dnsIP), rendererAPI.UDP, 123, 53)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+
+	// Ingress remains unrestricted.
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod3IP), parseIP(pod1IP), rendererAPI.TCP, 123, 53)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+}
@@ -0,0 +1,149 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+
+	"github.com/ligato/cn-infra/logging"
+
+	"github.com/contiv/vpp/plugins/policy/utils"
+)
+
+// ClusterPodCIDRsProvider provides the CIDRs of the cluster pod network(s),
+// i.e. the address ranges pods of the cluster are assigned IPs from.
+type ClusterPodCIDRsProvider interface {
+	// GetClusterPodCIDRs returns the current pod CIDRs of the cluster.
+	GetClusterPodCIDRs() []net.IPNet
+}
+
+// WithClusterPodCIDRs enables the cluster pods and external selectors
+// (Match.ClusterPodsRef and Match.ExternalRef). The pod CIDRs are obtained
+// from the given provider; whenever they change, RefreshClusterPodCIDRs()
+// should be called to update the rules.
+func WithClusterPodCIDRs(provider ClusterPodCIDRsProvider) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.podCIDRProvider = provider
+	}
+}
+
+// RefreshClusterPodCIDRs re-reads the cluster pod CIDRs from the provider
+// and if they have changed, re-renders rules of pods with policies referencing
+// the cluster pods or the external addresses.
+func (pc *PolicyConfigurator) RefreshClusterPodCIDRs() error {
+	if pc.podCIDRProvider == nil {
+		return nil
+	}
+	pc.Lock()
+	defer pc.Unlock()
+	cidrs := normalizeIPNets(pc.podCIDRProvider.GetClusterPodCIDRs())
+	if equalIPNets(cidrs, pc.clusterPodCIDRs) {
+		return nil
+	}
+	pc.Log.WithField("cidrs", cidrs).Debug("Cluster pod CIDRs have changed")
+	pc.clusterPodCIDRs = cidrs
+
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for pod, policies := range pc.config {
+		if referencesClusterPods(policies) {
+			txn.configure(pod, policies)
+		}
+	}
+	return txn.commit()
+}
+
+// clusterPodsRules returns rules allowing traffic with the cluster pod CIDRs
+// (ClusterPodsRef) and/or with the addresses outside of them (ExternalRef),
+// combined with the ports of the match. Nothing is allowed while the pod CIDRs
+// are not known.
+func (pct *PolicyConfiguratorTxn) clusterPodsRules(direction MatchType, match Match) ContivRules {
+	pc := pct.configurator
+	if pc.podCIDRProvider == nil {
+		pct.Log.Warn("Cluster pod CIDRs provider is not configured")
+		return nil
+	}
+	if len(pc.clusterPodCIDRs) == 0 {
+		pct.Log.Warn("Cluster pod CIDRs are not known")
+		return nil
+	}
+	var blocks []IPBlock
+	if match.ClusterPodsRef {
+		for _, cidr := range pc.clusterPodCIDRs {
+			blocks = append(blocks, IPBlock{Network: cidr})
+		}
+	}
+	if match.ExternalRef {
+		for _, family := range AddressFamilyBoth.families() {
+			block := IPBlock{Network: *anyAddress(family)}
+			for _, cidr := range pc.clusterPodCIDRs {
+				if familyOf(&cidr) == family {
+					block.Except = append(block.Except, cidr)
+				}
+			}
+			blocks = append(blocks, block)
+		}
+	}
+	rules := ContivRules{}
+	for _, block := range blocks {
+		rules = append(rules, blockRules(direction, block, match.Ports)...)
+	}
+	pct.Log.WithFields(logging.Fields{
+		"cidrs":    pc.clusterPodCIDRs,
+		"cluster":  match.ClusterPodsRef,
+		"external": match.ExternalRef,
+		"rules":    len(rules),
+	}).Debug("Expanded cluster pods reference")
+	return rules
+}
+
+// referencesClusterPods returns true if any of the policies has a match
+// referencing the cluster pods or the external addresses.
+func referencesClusterPods(policies []*ContivPolicy) bool {
+	for _, policy := range policies {
+		for _, match := range policy.Matches {
+			if match.ClusterPodsRef || match.ExternalRef {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeIPNets returns sorted copies of the networks with the host bits
+// cleared, without duplicates.
+func normalizeIPNets(nets []net.IPNet) []net.IPNet {
+	var normalized []net.IPNet
+	for _, ipNet := range nets {
+		normalized = appendIPNet(normalized, normalizeIPNet(ipNet))
+	}
+	sortIPNets(normalized)
+	return normalized
+}
+
+// equalIPNets returns true if the two lists contain the same networks
+// in the same order.
+func equalIPNets(nets1, nets2 []net.IPNet) bool {
+	if len(nets1) != len(nets2) {
+		return false
+	}
+	for idx := range nets1 {
+		if utils.CompareIPNets(&nets1[idx], &nets2[idx]) != 0 {
+			return false
+		}
+	}
+	return true
+}
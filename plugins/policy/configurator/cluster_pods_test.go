@@ -0,0 +1,167 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+type fakePodCIDRsProvider struct {
+	cidrs []net.IPNet
+}
+
+func (fpp *fakePodCIDRsProvider) GetClusterPodCIDRs() []net.IPNet {
+	return fpp.cidrs
+}
+
+func TestClusterPodsRef(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestClusterPodsRef")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1Name   = "pod1"
+		pod2Name   = "pod2"
+		pod1IP     = "10.1.1.1"
+		pod2IP     = "10.1.1.2"
+		otherPodIP = "10.2.1.1"
+		externalIP = "8.8.8.8"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// ingress allowed from cluster pods on TCP:80, egress to external on TCP:443
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyAll,
+		Matches: []Match{
+			{
+				Type:           MatchIngress,
+				ClusterPodsRef: true,
+				Ports:          []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type:        MatchEgress,
+				ExternalRef: true,
+				Ports:       []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+	gomega.Expect(policy1.Matches[0].String()).To(gomega.ContainSubstring(", ClusterPodsRef"))
+	gomega.Expect(policy1.Matches[1].String()).To(gomega.ContainSubstring(", ExternalRef"))
+	gomega.Expect(policy1.Matches[0].matchesAnyPeer()).To(gomega.BeFalse())
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	provider := &fakePodCIDRsProvider{cidrs: []net.IPNet{parseIPNet("10.1.0.0/16")}}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithClusterPodCIDRs(provider))
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	ingressFrom := func(srcIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(srcIP), parseIP(pod1IP), rendererAPI.TCP, 123, port)
+	}
+	egressTo := func(dstIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod1, IngressTraffic,
+			parseIP(pod1IP), parseIP(dstIP), rendererAPI.TCP, 123, port)
+	}
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// ClusterPodsRef expands to the pod CIDR.
+	gomega.Expect(ingressFrom(pod2IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(ingressFrom(pod2IP, 81)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(ingressFrom(otherPodIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(ingressFrom(externalIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// ExternalRef expands to the complement of the pod CIDR.
+	gomega.Expect(egressTo(externalIP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(egressTo(otherPodIP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(egressTo(externalIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(egressTo(pod2IP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// The whole IPv6 is external with only IPv4 pod CIDRs.
+	ingress, _ := renderer.GetRules(pod1)
+	hasIPv6External := false
+	for _, rule := range ingress {
+		if rule.Action == rendererAPI.ActionPermit && rule.DestNetwork.String() == "::/0" && rule.DestPort == 443 {
+			hasIPv6External = true
+		}
+	}
+	gomega.Expect(hasIPv6External).To(gomega.BeTrue())
+
+	// Unchanged CIDRs do not trigger re-rendering.
+	commits := renderer.GetCommitCount()
+	err = configurator.RefreshClusterPodCIDRs()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits))
+
+	// Pod CIDR is changed, the rules are re-rendered.
+	provider.cidrs = []net.IPNet{parseIPNet("10.2.0.0/16")}
+	err = configurator.RefreshClusterPodCIDRs()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits + 1))
+	gomega.Expect(ingressFrom(otherPodIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(ingressFrom(pod2IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(egressTo(pod2IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(egressTo(otherPodIP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Unknown pod CIDRs select nothing.
+	provider.cidrs = nil
+	err = configurator.RefreshClusterPodCIDRs()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(ingressFrom(otherPodIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(egressTo(externalIP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+}
@@ -0,0 +1,100 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// DirectionOrder selects the order of directions in the combined list
+// of rules (see WithCombinedRules). The directions are from the vswitch
+// point of view.
+type DirectionOrder int
+
+const (
+	// IngressFirst puts all ingress rules before the egress rules.
+	IngressFirst DirectionOrder = iota
+
+	// EgressFirst puts all egress rules before the ingress rules.
+	EgressFirst
+)
+
+// String converts DirectionOrder into a human-readable string.
+func (do DirectionOrder) String() string {
+	switch do {
+	case IngressFirst:
+		return "INGRESS-FIRST"
+	case EgressFirst:
+		return "EGRESS-FIRST"
+	}
+	return "INVALID"
+}
+
+// WithCombinedRules enables rendering of ingress and egress rules of each pod
+// as a single list with the directions in the given order, for renderers
+// with the renderer.CombinedRules capability (see renderer.CombinedTxn).
+// Within each direction the rules keep their order (see WithRuleOrdering).
+// The other renderers receive the separate lists as usual, and so do
+// renderers given rule groups (see WithRuleGroups), which take precedence.
+func WithCombinedRules(order DirectionOrder) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.combinedRules = true
+		pc.directionOrder = order
+	}
+}
+
+// combineRules merges ingress and egress rules into one list tagged
+// with directions.
+func combineRules(ingress, egress ContivRules, order DirectionOrder) []*renderer.DirectedRule {
+	combined := make([]*renderer.DirectedRule, 0, len(ingress)+len(egress))
+	appendDirection := func(direction renderer.RuleDirection, rules ContivRules) {
+		for _, rule := range rules {
+			combined = append(combined, &renderer.DirectedRule{Direction: direction, Rule: rule})
+		}
+	}
+	if order == EgressFirst {
+		appendDirection(renderer.EgressRule, egress)
+		appendDirection(renderer.IngressRule, ingress)
+	} else {
+		appendDirection(renderer.IngressRule, ingress)
+		appendDirection(renderer.EgressRule, egress)
+	}
+	return combined
+}
+
+// renderCombined renders the rules as a single combined list if enabled
+// and supported by the renderer. Returns false if the rules were not rendered.
+func (pc *PolicyConfigurator) renderCombined(rTxn renderer.Txn, idx int, pod podmodel.ID, podIP *net.IPNet,
+	ingress, egress ContivRules, removed bool) bool {
+
+	if !pc.combinedRules || !hasCapability(pc.renderers[idx], renderer.CombinedRules) {
+		return false
+	}
+	combinedTxn, isCombinedTxn := rTxn.(renderer.CombinedTxn)
+	if !isCombinedTxn {
+		return false
+	}
+	if !pc.sharedRules {
+		ingress = ingress.Copy()
+		egress = egress.Copy()
+	}
+	combinedTxn.RenderCombined(pod, podIP, combineRules(ingress, egress, pc.directionOrder), removed)
+	return true
+}
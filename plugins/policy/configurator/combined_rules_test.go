@@ -0,0 +1,149 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestCombinedRules(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestCombinedRules")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod1IP    = "192.168.1.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+
+	// ingress allowed on TCP:80, egress allowed on UDP:53
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyAll,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type:  MatchEgress,
+				Ports: []Port{{Protocol: UDP, Number: 53}},
+			},
+		},
+	}
+
+	for _, order := range []DirectionOrder{IngressFirst, EgressFirst} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		combinedRenderer := NewMockRenderer("A", logger)
+		combinedRenderer.SetCapabilities(rendererAPI.CombinedRules)
+		separateRenderer := NewMockRenderer("B", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithCombinedRules(order))
+		err := configurator.RegisterRenderer(combinedRenderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(separateRenderer)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Renderer without the capability gets separate lists.
+		ingress, egress := separateRenderer.GetRules(pod1)
+		gomega.Expect(ingress).ToNot(gomega.BeEmpty())
+		gomega.Expect(egress).ToNot(gomega.BeEmpty())
+		gomega.Expect(separateRenderer.GetCombinedRules(pod1)).To(gomega.BeNil())
+
+		// Renderer with the capability gets the same rules combined.
+		combined := combinedRenderer.GetCombinedRules(pod1)
+		gomega.Expect(combined).To(gomega.HaveLen(len(ingress) + len(egress)))
+		first, second := ingress, egress
+		firstDir, secondDir := rendererAPI.IngressRule, rendererAPI.EgressRule
+		if order == EgressFirst {
+			first, second = egress, ingress
+			firstDir, secondDir = rendererAPI.EgressRule, rendererAPI.IngressRule
+		}
+		for idx, rule := range first {
+			gomega.Expect(combined[idx].Direction).To(gomega.Equal(firstDir), order.String())
+			gomega.Expect(combined[idx].Rule).To(gomega.BeIdenticalTo(rule))
+		}
+		for idx, rule := range second {
+			gomega.Expect(combined[len(first)+idx].Direction).To(gomega.Equal(secondDir), order.String())
+			gomega.Expect(combined[len(first)+idx].Rule).To(gomega.BeIdenticalTo(rule))
+		}
+
+		// Ingress-then-egress: first the permit of DNS + deny-rest from the pod.
+		if order == IngressFirst {
+			gomega.Expect(combined[0].Rule.Protocol).To(gomega.Equal(rendererAPI.UDP))
+			gomega.Expect(combined[0].Rule.DestPort).To(gomega.BeEquivalentTo(53))
+			gomega.Expect(combined[len(ingress)].Rule.Protocol).To(gomega.Equal(rendererAPI.TCP))
+			gomega.Expect(combined[len(ingress)].Rule.DestPort).To(gomega.BeEquivalentTo(80))
+		}
+
+		// Traffic is evaluated the same as with separate lists.
+		gomega.Expect(combinedRenderer.TestTraffic(pod1, EgressTraffic,
+			parseIP("10.0.0.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(combinedRenderer.TestTraffic(pod1, EgressTraffic,
+			parseIP("10.0.0.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 81)).To(gomega.BeEquivalentTo(DeniedTraffic))
+		gomega.Expect(combinedRenderer.TestTraffic(pod1, IngressTraffic,
+			parseIP(pod1IP), parseIP("10.0.0.1"), rendererAPI.UDP, 123, 53)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(combinedRenderer.TestTraffic(pod1, IngressTraffic,
+			parseIP(pod1IP), parseIP("10.0.0.1"), rendererAPI.UDP, 123, 54)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+		// Remove the pod.
+		cache.AddPodConfig(pod1, "")
+		txn = configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+		ip, _ := combinedRenderer.GetPodIP(pod1)
+		gomega.Expect(ip).To(gomega.BeEmpty())
+	}
+}
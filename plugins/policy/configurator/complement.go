@@ -0,0 +1,92 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+)
+
+// FlowUniverse bounds the traffic over which the complement of a policy
+// is computed (see Complement()): every peer is combined with every port.
+// Ports should be specific, port number zero stands for a port not selected
+// by any match with ports.
+type FlowUniverse struct {
+	Peers []net.IP
+	Ports []Port
+}
+
+// PolicyComplement lists the flows of a universe denied by a policy, for every
+// direction of the pod traffic. Peers are expressed as one-host subnets.
+// The flows of a direction can be turned back into a policy allowing exactly
+// them with SynthesizePolicy().
+type PolicyComplement struct {
+	Ingress []FlowSpec
+	Egress  []FlowSpec
+}
+
+// IsEmpty returns true if no flow of the universe is denied.
+func (pcm PolicyComplement) IsEmpty() bool {
+	return len(pcm.Ingress) == 0 && len(pcm.Egress) == 0
+}
+
+// Complement returns the flows of the universe which the policy, applied alone
+// to a pod, does not allow, i.e. the attack surface closed by the policy
+// within the universe. With the allow-only semantics, this is every flow
+// of a direction subject to the policy not selected by any of its matches.
+// Directions not subject to the policy are not restricted and contribute
+// no flows. Pods referenced by the matches are resolved to the committed
+// IP addresses. The configuration is not modified. The flows are listed
+// in the order of the universe, peer by peer.
+func (pc *PolicyConfigurator) Complement(policy *ContivPolicy, universe FlowUniverse) PolicyComplement {
+	pc.Lock()
+	defer pc.Unlock()
+
+	policies := pc.canonicalPolicies(ContivPolicies{policy.DeepCopy()})
+	policies = enabledPolicies(pc.inheritedPolicies(policies))
+
+	// Rules are generated in a scratch transaction, never committed.
+	pct := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	pct.podIPAddresses = pc.podIPAddresses.Copy()
+	pct.clusterDNSIP = pc.clusterDNSIP
+	ingressRules := pct.generateRules(MatchIngress, policies)
+	egressRules := pct.generateRules(MatchEgress, policies)
+
+	complement := PolicyComplement{}
+	for _, peer := range universe.Peers {
+		peerNet := hostNetwork(peer)
+		for _, port := range universe.Ports {
+			spec := FlowSpec{Peer: peerNet, Protocol: port.Protocol, Port: port.Number}
+			ingress := Flow{SrcIP: peer, Protocol: port.Protocol, DstPort: port.Number}
+			if !evaluateRules(ingressRules, ingress) {
+				complement.Ingress = append(complement.Ingress, spec)
+			}
+			egress := Flow{DstIP: peer, Protocol: port.Protocol, DstPort: port.Number}
+			if !evaluateRules(egressRules, egress) {
+				complement.Egress = append(complement.Egress, spec)
+			}
+		}
+	}
+	return complement
+}
+
+// hostNetwork returns the one-host subnet of the IP address.
+func hostNetwork(ip net.IP) net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return net.IPNet{IP: ip4, Mask: net.CIDRMask(net.IPv4len*8, net.IPv4len*8)}
+	}
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(net.IPv6len*8, net.IPv6len*8)}
+}
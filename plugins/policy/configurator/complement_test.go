@@ -0,0 +1,165 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestComplement(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestComplement")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		inside    = "10.0.0.1"
+		excepted  = "10.0.0.129"
+		outside   = "10.0.1.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress allowed on TCP:80 from 10.0.0.0/24 except 10.0.0.128/25,
+	// egress allowed to pod2 on UDP:53
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyAll,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				IPBlocks: []IPBlock{
+					{
+						Network: parseIPNet("10.0.0.0/24"),
+						Except:  []net.IPNet{parseIPNet("10.0.0.128/25")},
+					},
+				},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type:  MatchEgress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: UDP, Number: 53}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{})
+	txn.Configure(pod2, []*ContivPolicy{})
+	err := txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	universe := FlowUniverse{
+		Peers: []net.IP{net.ParseIP(inside), net.ParseIP(excepted), net.ParseIP(outside), net.ParseIP(pod2IP)},
+		Ports: []Port{{Protocol: TCP, Number: 80}, {Protocol: UDP, Number: 53}},
+	}
+	host := func(ip string) net.IPNet {
+		return parseIPNet(ip + "/32")
+	}
+	tcp80 := func(ip string) FlowSpec {
+		return FlowSpec{Peer: host(ip), Protocol: TCP, Port: 80}
+	}
+	udp53 := func(ip string) FlowSpec {
+		return FlowSpec{Peer: host(ip), Protocol: UDP, Port: 53}
+	}
+
+	// Everything but the allowed flow of each direction is denied.
+	complement := configurator.Complement(policy1, universe)
+	gomega.Expect(complement.IsEmpty()).To(gomega.BeFalse())
+	gomega.Expect(complement.Ingress).To(gomega.Equal([]FlowSpec{
+		udp53(inside),
+		tcp80(excepted), udp53(excepted),
+		tcp80(outside), udp53(outside),
+		tcp80(pod2IP), udp53(pod2IP),
+	}))
+	gomega.Expect(complement.Egress).To(gomega.Equal([]FlowSpec{
+		tcp80(inside), udp53(inside),
+		tcp80(excepted), udp53(excepted),
+		tcp80(outside), udp53(outside),
+		tcp80(pod2IP),
+	}))
+
+	// The committed policy denies exactly the flows of the complement.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	for _, peer := range universe.Peers {
+		for _, port := range universe.Ports {
+			spec := FlowSpec{Peer: host(peer.String()), Protocol: port.Protocol, Port: port.Number}
+			ingress := Flow{SrcIP: peer, DstIP: net.ParseIP(pod1IP), Protocol: port.Protocol, DstPort: port.Number}
+			gomega.Expect(configurator.EvaluateFlow(ingress)).To(gomega.Equal(!containsFlowSpec(complement.Ingress, spec)))
+			egress := Flow{SrcIP: net.ParseIP(pod1IP), DstIP: peer, Protocol: port.Protocol, DstPort: port.Number}
+			gomega.Expect(configurator.EvaluateFlow(egress)).To(gomega.Equal(!containsFlowSpec(complement.Egress, spec)))
+		}
+	}
+
+	// Directions not subject to the policy are not restricted.
+	policy1.Type = PolicyIngress
+	complement = configurator.Complement(policy1, universe)
+	gomega.Expect(complement.Ingress).To(gomega.HaveLen(7))
+	gomega.Expect(complement.Egress).To(gomega.BeEmpty())
+
+	// Disabled policy denies nothing.
+	policy1.Disabled = true
+	complement = configurator.Complement(policy1, universe)
+	gomega.Expect(complement.IsEmpty()).To(gomega.BeTrue())
+}
+
+func containsFlowSpec(flows []FlowSpec, flow FlowSpec) bool {
+	for _, other := range flows {
+		if other.Peer.String() == flow.Peer.String() && other.Protocol == flow.Protocol && other.Port == flow.Port {
+			return true
+		}
+	}
+	return false
+}
@@ -18,8 +18,12 @@ package configurator
 
 import (
 	"fmt"
+	"io"
 	"net"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
 	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
@@ -39,12 +43,27 @@ import (
 // renderers to group and share them across multiple interfaces (if supported
 // by the destination network stack)
 type PolicyConfiguratorAPI interface {
-	// RegisterRenderer registers a new renderer.
-	// The renderer will be receiving rules for all pods in this K8s node.
+	// RegisterRenderer registers a new default renderer.
+	// The renderer will be receiving rules for all pods in this K8s node
+	// not handled by any renderer registered with RegisterLabeledRenderer().
 	// It is up to the render to possibly filter out rules for pods without
 	// an inter-connection in the destination network stack.
 	RegisterRenderer(renderer renderer.PolicyRendererAPI) error
 
+	// RegisterLabeledRenderer registers a new renderer for pods with the given
+	// label. Pods handled by at least one labeled renderer are not passed to
+	// the default renderers.
+	RegisterLabeledRenderer(label podmodel.Pod_Label, renderer renderer.PolicyRendererAPI) error
+
+	// RequestResync can be called by a renderer (e.g. after a restart) to get
+	// rules of all pods it handles re-rendered from the committed state,
+	// using a resync transaction of this renderer only.
+	// Use empty label to select the default renderers.
+	// The call waits for an in-flight transaction to finish and the resync
+	// then includes its changes. It must not be therefore called from inside
+	// the Render() or Commit() method of a renderer transaction.
+	RequestResync(label podmodel.Pod_Label) error
+
 	// NewTxn starts a new transaction. The re-configuration executes only
 	// after Commit() is called.
 	// If <resync> is enabled, the supplied configuration will completely
@@ -58,9 +77,48 @@ type Txn interface {
 	// Configure applies the set of policies for a given pod.
 	// The existing policies are replaced.
 	// The order of policies is not important (it is a set).
+	// Pods configured repeatedly in the same transaction are handled
+	// as selected by WithIntraTxnConflict.
+	// The policies are deep-copied, modifying them afterwards has no effect
+	// on the transaction.
+	// The pod ID is rewritten if selected by WithPodIDRewriter.
 	Configure(pod podmodel.ID, policies []*ContivPolicy) Txn
 
+	// RemoveBySource removes policies contributed by the given source from all
+	// pods, whether configured by this transaction or already committed.
+	// The removal is evaluated during Commit(), i.e. after all Configure()-s.
+	// Pods which are left with no policies become unrestricted (empty set of
+	// policies), the same as if they were configured with no policies
+	// (see WithEmptySetDenyAll for the exception).
+	RemoveBySource(source string) Txn
+
+	// SetPolicyEnabled enables or disables the policy for all pods carrying it,
+	// whether configured by this transaction or already committed.
+	// The state is evaluated during Commit() and remembered by the configurator,
+	// i.e. it overrides ContivPolicy.Disabled also for the policy passed
+	// by later transactions, until changed again.
+	SetPolicyEnabled(policy policymodel.ID, enabled bool) Txn
+
+	// UnpinPolicy releases the pin of the policy (see ContivPolicy.Pinned)
+	// for all pods carrying it. The policy is then removed from pods whose
+	// configuration no longer includes it (it was retained only because
+	// of the pin). The release is evaluated during Commit() and takes
+	// precedence over ContivPolicy.Pinned of the policy in this transaction.
+	UnpinPolicy(policy policymodel.ID) Txn
+
+	// WithCorrelationID attaches an ID correlating the transaction with
+	// the event that caused it, e.g. in an upstream controller. The ID is
+	// added to the logs of the commit and passed with the audit record
+	// and the metrics of the commit. It has no effect on the rules.
+	WithCorrelationID(id string) Txn
+
+	// StagedPods returns the per-pod configuration staged by Configure()
+	// in this transaction, not yet committed. The returned policies are
+	// copies, modifying them has no effect on the transaction.
+	StagedPods() map[podmodel.ID][]*ContivPolicy
+
 	// Commit proceeds with the reconfiguration.
+	// Returns ErrReadOnly if the configurator is in the read-only mode.
 	Commit() error
 }
 
@@ -75,6 +133,8 @@ type Txn interface {
 // Traffic matched by a Contiv policy should by ALLOWED. Traffic not matched
 // by any policy from a **non-empty** set of policies assigned
 // to the source/destination pod should be DENIED.
+// Pods with an empty set of policies are not restricted, unless their namespace
+// is selected by WithEmptySetDenyAll.
 type ContivPolicy struct {
 	// ID should uniquely identify policy across all namespaces.
 	ID policymodel.ID
@@ -85,19 +145,181 @@ type ContivPolicy struct {
 	// Matches is an array of Match-es: predicates that select a subset of the
 	// traffic to be ALLOWED.
 	Matches []Match
+
+	// Source optionally identifies the controller which contributed the policy.
+	// Allows to selectively remove policies of a single controller
+	// using Txn.RemoveBySource().
+	Source string
+
+	// ExpiresAt optionally limits the lifetime of the policy (e.g. temporary
+	// break-glass access). Once expired, the policy is automatically removed
+	// and the affected pods are re-rendered. Expired policies are never applied.
+	// Zero value means no expiration.
+	ExpiresAt time.Time
+
+	// AddressFamily optionally limits the policy to IPv4 or IPv6 traffic
+	// of dual-stack pods. Traffic of the other family is left unaffected
+	// by the policy, i.e. the policy does not make it denied by default.
+	// Default is AddressFamilyBoth.
+	AddressFamily AddressFamily
+
+	// Disabled policy is retained in the configuration, but contributes
+	// no rules and does not make the traffic of the pod denied by default,
+	// i.e. it is evaluated as if it was not assigned to the pod.
+	// Zero value means enabled. See Txn.SetPolicyEnabled().
+	Disabled bool
+
+	// Pinned policy, once committed for a pod, cannot be removed from the pod
+	// by a configuration omitting it, not even by a resync (or RemoveBySource).
+	// The policy is retained (in the last committed version) until the pin
+	// is released by Txn.UnpinPolicy(). Intended for critical baseline rules.
+	// Rules generated from pinned policies are marked in the rule provenance.
+	Pinned bool
+
+	// Group optionally names a group of related policies (e.g. environment
+	// profiles). Exclusive policies of the same group are mutually exclusive:
+	// at most one of them is active for a pod, the one applied to the pod
+	// last (last-applied-wins), the others are deactivated (evaluated as if
+	// disabled) while it is present. A policy is applied to a pod when it is
+	// added into the configuration of the pod; if several are added in one
+	// transaction, the one given last to Configure() wins. Policies staying
+	// configured keep their order, i.e. re-applying a deactivated policy
+	// requires to remove it first.
+	Group     string
+	Exclusive bool
+
+	// RequirePodLabels and ExcludePodLabels gate the policy on the labels
+	// of the target pod (unlike Match, which selects the peers): the policy
+	// applies to a pod only if the pod carries all the required labels
+	// and none of the excluded labels. A label with empty Value matches
+	// any value of the key. The labels are evaluated at commit time (see
+	// WithPodLabels and RefreshPodLabels() for the re-evaluation). Pods not
+	// meeting the criteria are configured as if the policy was disabled.
+	RequirePodLabels []podmodel.Pod_Label
+	ExcludePodLabels []podmodel.Pod_Label
+
+	// NodeScope optionally limits the policy to pods on the selected nodes,
+	// evaluated against the identity of the local node (see WithLocalNode).
+	// On other nodes the policy is evaluated as if it was disabled, i.e. it
+	// contributes no rules and does not make the traffic denied by default.
+	// nil = the policy applies on all nodes.
+	NodeScope *NodeScope
+
+	// BaseRef optionally references a base policy registered with
+	// RegisterBasePolicy() which the policy inherits from: the matches
+	// of the base (and of its own base, recursively) are appended to the matches
+	// of the policy when the rules are generated. Other attributes of the base
+	// are ignored. Cyclic inheritance is rejected by Commit().
+	// Zero value means no base.
+	BaseRef policymodel.ID
+
+	// RequireTargetReady makes the ingress matches of the policy apply only
+	// while the target pod is ready (see WithPodReadiness and RefreshPodReadiness()).
+	// While the pod is not ready, the policy still isolates the pod, i.e. its
+	// ingress traffic is denied. Egress matches are not affected.
+	RequireTargetReady bool
+
+	// Priority of the policy, used to resolve overlapping allow and deny
+	// matches of different policies with the PriorityOrder precedence (see
+	// WithActionPrecedence): the higher the priority, the earlier the rules
+	// of the policy are evaluated. Ignored otherwise.
+	Priority int
+
+	// notReady marks the copy of a policy with RequireTargetReady generated
+	// for a pod which is not ready (ingress matches removed).
+	notReady bool
+
+	// Description is an optional human-readable description of the policy,
+	// passed to the generated rules (renderer.ContivRule.Description) of matches
+	// without their own description. Purely informational.
+	Description string
+}
+
+// Enabled returns true if the policy is not disabled.
+func (cp *ContivPolicy) Enabled() bool {
+	return !cp.Disabled
 }
 
 // String converts ContivPolicy into a human-readable string.
 func (cp ContivPolicy) String() string {
-	matches := ""
-	for idx, match := range cp.Matches {
-		matches += match.String()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	cp.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+// WriteTo writes the human-readable form of ContivPolicy (as returned by
+// String()) into the writer without building intermediate strings.
+func (cp ContivPolicy) WriteTo(w io.Writer) (int64, error) {
+	sw := &stringWriter{w: w}
+	cp.writeTo(sw)
+	return sw.n, sw.err
+}
+
+func (cp *ContivPolicy) writeTo(sw *stringWriter) {
+	sw.write("ContivPolicy ")
+	sw.write(cp.ID.Namespace)
+	sw.write("/")
+	sw.write(cp.ID.Name)
+	sw.write(" <Type:")
+	sw.write(cp.Type.String())
+	sw.write(", Matches:[")
+	for idx := range cp.Matches {
+		cp.Matches[idx].writeTo(sw)
 		if idx < len(cp.Matches)-1 {
-			matches += ", "
+			sw.write(", ")
+		}
+	}
+	sw.write("]")
+	if cp.Source != "" {
+		sw.write(", Source:")
+		sw.write(cp.Source)
+	}
+	if !cp.ExpiresAt.IsZero() {
+		sw.write(", ExpiresAt:")
+		sw.write(cp.ExpiresAt.UTC().Format(time.RFC3339Nano))
+	}
+	if cp.AddressFamily != AddressFamilyBoth {
+		sw.write(", AddressFamily:")
+		sw.write(cp.AddressFamily.String())
+	}
+	if cp.Disabled {
+		sw.write(", Disabled")
+	}
+	if cp.Pinned {
+		sw.write(", Pinned")
+	}
+	if cp.Group != "" {
+		sw.write(", Group:")
+		sw.write(cp.Group)
+		if cp.Exclusive {
+			sw.write(" (exclusive)")
 		}
 	}
-	return fmt.Sprintf("ContivPolicy %s <Type:%s, Matches:[%s]>",
-		cp.ID, cp.Type, matches)
+	writeLabels(sw, ", RequirePodLabels:", cp.RequirePodLabels)
+	writeLabels(sw, ", ExcludePodLabels:", cp.ExcludePodLabels)
+	if cp.NodeScope != nil {
+		sw.write(", NodeScope:")
+		cp.NodeScope.writeTo(sw)
+	}
+	if cp.BaseRef != (policymodel.ID{}) {
+		sw.write(", BaseRef:")
+		sw.write(cp.BaseRef.Namespace)
+		sw.write("/")
+		sw.write(cp.BaseRef.Name)
+	}
+	if cp.RequireTargetReady {
+		sw.write(", RequireTargetReady")
+	}
+	if cp.Priority != 0 {
+		sw.write(", Priority:")
+		sw.write(strconv.Itoa(cp.Priority))
+	}
+	if cp.Description != "" {
+		sw.write(", Description:")
+		sw.write(strconv.Quote(cp.Description))
+	}
+	sw.write(">")
 }
 
 // Match is a predicate that select a subset of the traffic.
@@ -105,61 +327,520 @@ type Match struct {
 	// Type selects the direction of the traffic.
 	Type MatchType
 
+	// Action selects whether the traffic selected by the match is allowed
+	// (the default) or denied. Overlapping allow and deny matches are resolved
+	// as selected by WithActionPrecedence. Deny matches do not allow any
+	// traffic, i.e. a policy with only deny matches denies all the traffic
+	// of its direction. Rules of deny matches preceding allow rules require
+	// renderers with the renderer.OrderedRules capability.
+	Action MatchAction
+
 	// Layer 3: destinations (egress) / sources (ingress)
-	// If both arrays are nils, then this predicate matches all
+	// If all arrays are nils, then this predicate matches all
 	// sources(ingress) / destinations(egress). Otherwise, this predicate
 	// applies to a given traffic only if the traffic matches at least one item
 	// in one of the lists.
+	// Pods without an IP address known to the configurator are handled
+	// as selected by WithUnknownPodHandling.
 	Pods     []podmodel.ID
 	IPBlocks []IPBlock
 
+	// IPMasks is an opt-in alternative to IPBlocks, selecting IP addresses
+	// by arbitrary (possibly non-contiguous) bit masks.
+	// Rules generated from masks can be rendered only by renderers with
+	// the renderer.MaskedMatch capability, the commit fails otherwise.
+	IPMasks []IPMask
+
+	// FQDNs select external peers by their fully qualified domain names.
+	// The names are resolved by the resolver passed to the configurator with
+	// WithFQDNResolver and periodically re-resolved as the IPs may change.
+	FQDNs []string
+
+	// APIServerRef selects the endpoints of the Kubernetes API server as peers.
+	// The endpoints are obtained from the provider passed to the configurator
+	// with WithAPIServerEndpoints and the rules are updated when they change.
+	// For egress, the traffic is allowed to the endpoint IPs and ports, Ports
+	// of the match are not applied. For ingress, the endpoint IPs are combined
+	// with Ports the same as for other peers.
+	APIServerRef bool
+
+	// ClusterPodsRef selects all addresses of the cluster pod network(s) as
+	// peers, ExternalRef selects all addresses outside of them. The pod CIDRs
+	// are obtained from the provider passed to the configurator with
+	// WithClusterPodCIDRs and the rules are updated when they change.
+	// Both are combined with Ports the same as IPBlocks.
+	ClusterPodsRef bool
+	ExternalRef    bool
+
+	// NamespaceSelector optionally selects as peers all pods in namespaces
+	// with matching labels. The labels are obtained from the provider passed
+	// to the configurator with WithNamespaceLabels and the rules are updated
+	// when the labels or the pods of the namespaces change. If combined
+	// with Pods (non-nil), only those of the Pods inside the selected
+	// namespaces are selected, as with namespaceSelector and podSelector
+	// in the same peer of K8s Network Policy.
+	NamespaceSelector *NamespaceSelector
+
+	// PodNamePatterns optionally select as peers all pods of a namespace
+	// with names matching a pattern, e.g. the pods of a StatefulSet
+	// or a Deployment, without enumerating them in Pods. The pods are looked
+	// up in the policy cache and the rules are updated by RefreshPodNames()
+	// whenever pods are added or removed. The selected pods are peers
+	// in addition to those of Pods and NamespaceSelector.
+	PodNamePatterns []PodNamePattern
+
 	// Layer 4: destination ports
 	// If the array is empty or nil, then this predicate matches all ports
 	// (traffic not restricted by port).
 	// If the array is non-empty, then this applies to a given traffic only
 	// if the traffic matches at least one port in the list.
 	Ports []Port
+
+	// PortSets reference by name sets of ports registered with RegisterPortSet.
+	// The ports of the referenced sets are merged with Ports (duplicates
+	// are removed) when the rules are generated. Unknown port-sets are
+	// ignored. If neither Ports nor any of the referenced port-sets
+	// contribute a port, the match does not apply to any traffic (unlike
+	// the empty Ports alone, which match all ports).
+	PortSets []string
+
+	// SourcePorts optionally restricts the match to traffic with the given
+	// L4 source ports (of the peer for ingress, of the pod for egress).
+	// If empty or nil, the traffic is not restricted by source port.
+	// Otherwise the traffic must match at least one source port in the list;
+	// when combined with Ports, only ports of the same protocol are paired.
+	// Passed to renderers with the renderer.SourcePortMatch capability. Other
+	// renderers ignore them, unless WithStrictSourcePorts is enabled, in which
+	// case the commit fails.
+	SourcePorts []Port
+
+	// Network optionally scopes the match to one of the pod networks
+	// for pods attached into multiple networks (multiple interfaces).
+	// Rules generated from the match are then installed only on the pod
+	// interface connected into the given network, which requires renderers
+	// with the renderer.NetworkScoping capability.
+	// If empty, the match applies to all networks of the pod.
+	Network string
+
+	// RateLimit optionally polices the traffic allowed by the match.
+	// The traffic is still allowed, only limited in rate. Rate limits are
+	// passed to renderers with the renderer.Policing capability. Other
+	// renderers ignore them, unless WithStrictPolicing is enabled, in which
+	// case the commit fails.
+	RateLimit *RateSpec
+
+	// ConnRateLimit optionally limits the rate of new connections allowed
+	// by the match, e.g. for basic DoS protection. Connections above the rate
+	// are dropped. Passed to renderers with the renderer.ConnRateLimiting
+	// capability. Other renderers ignore it, unless WithStrictConnRateLimits
+	// is enabled, in which case the commit fails.
+	ConnRateLimit *ConnRateSpec
+
+	// PacketLen optionally restricts the match to packets with the length
+	// (in bytes, the whole IP packet) within the given range.
+	// Passed to renderers with the renderer.PacketLength capability. Other
+	// renderers ignore it (i.e. match packets of any length), unless
+	// WithStrictPacketLength is enabled, in which case the commit fails.
+	PacketLen *LenRange
+
+	// Fragments optionally selects how non-initial fragments of IP packets
+	// (without the L4 header) of the traffic selected by the match are treated.
+	// With AllowFragments or DenyFragments, a separate rule permitting
+	// or denying the fragments is generated for every rule of the match.
+	// The fragment rules are passed to renderers with
+	// the renderer.FragmentMatching capability. Other renderers are not given
+	// them (i.e. the fragments are treated by the network stack as usual),
+	// unless WithStrictFragments is enabled, in which case the commit fails.
+	Fragments FragmentPolicy
+
+	// L7 optionally restricts the traffic allowed by the match to HTTP
+	// requests with the given attributes. It is a hint for L7-aware renderers
+	// (with the renderer.L7Filtering capability), e.g. those configuring
+	// an Envoy sidecar of the pod. Other renderers ignore it (i.e. allow
+	// the traffic at L4), unless WithStrictL7 is enabled, in which case
+	// the commit fails.
+	L7 *L7Match
+
+	// TCPFlags optionally restricts the match to TCP segments with the given
+	// flags set and cleared, e.g. to allow only established connections
+	// (ACK required) or to block connection attempts (SYN required, ACK
+	// forbidden, with a deny policy). It applies only to the TCP ports
+	// of the match (including those from PortSets and combined with
+	// SourcePorts), other ports and matches without ports are not restricted.
+	// Rules are applied to the traffic subject to the policy, i.e. the flags
+	// do not affect reply traffic of connections allowed by the renderer
+	// (reflective rules). Passed to renderers with the renderer.TCPFlagMatching
+	// capability. Other renderers ignore it (i.e. match segments with any
+	// flags), unless WithStrictTCPFlags is enabled, in which case the commit
+	// fails.
+	TCPFlags *TCPFlagMatch
+
+	// TunnelVNI optionally restricts the match to traffic encapsulated
+	// in GENEVE/VXLAN tunnel with the given VNI, for overlay-aware policies.
+	// It applies to all the rules generated for the match. Passed to renderers
+	// with the renderer.TunnelMatching capability. Other renderers ignore it
+	// (i.e. match the traffic of any tunnel and the unencapsulated traffic),
+	// unless WithStrictTunnelVNI is enabled, in which case the commit fails.
+	TunnelVNI *uint32
+
+	// Description is an optional human-readable description of the match,
+	// passed to the generated rules (renderer.ContivRule.Description).
+	// Purely informational, it does not affect the traffic matched.
+	// Like rules, matches differing only in the description are equivalent
+	// (see Normalize and DiffPolicies), a change of the description alone
+	// is therefore not a change of the policy.
+	Description string
 }
 
 // String converts Match into a human-readable string.
 func (m Match) String() string {
-	pods := "<nil>"
-	if m.Pods != nil {
-		pods = "["
+	buf := getBuffer()
+	defer putBuffer(buf)
+	m.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+// WriteTo writes the human-readable form of Match (as returned by String())
+// into the writer without building intermediate strings.
+func (m Match) WriteTo(w io.Writer) (int64, error) {
+	sw := &stringWriter{w: w}
+	m.writeTo(sw)
+	return sw.n, sw.err
+}
+
+func (m *Match) writeTo(sw *stringWriter) {
+	sw.write("<Type:")
+	sw.write(m.Type.String())
+	if m.Action != MatchAllow {
+		sw.write(", Action:")
+		sw.write(m.Action.String())
+	}
+
+	sw.write(", Pods:")
+	if m.Pods == nil {
+		sw.write("<nil>")
+	} else {
+		sw.write("[")
 		for idx, pod := range m.Pods {
-			pods += pod.String()
+			sw.write(pod.Namespace)
+			sw.write("/")
+			sw.write(pod.Name)
 			if idx < len(m.Pods)-1 {
-				pods += ", "
+				sw.write(", ")
 			}
 		}
-		pods += "]"
+		sw.write("]")
 	}
 
-	blocks := "<nil>"
-	if m.IPBlocks != nil {
-		blocks = "["
-		for idx, block := range m.IPBlocks {
-			blocks += block.String()
+	sw.write(", Blocks:")
+	if m.IPBlocks == nil {
+		sw.write("<nil>")
+	} else {
+		sw.write("[")
+		for idx := range m.IPBlocks {
+			m.IPBlocks[idx].writeTo(sw)
 			if idx < len(m.IPBlocks)-1 {
-				blocks += ", "
+				sw.write(", ")
+			}
+		}
+		sw.write("]")
+	}
+
+	if m.IPMasks != nil {
+		sw.write(", Masks:[")
+		for idx, mask := range m.IPMasks {
+			sw.write(mask.String())
+			if idx < len(m.IPMasks)-1 {
+				sw.write(", ")
+			}
+		}
+		sw.write("]")
+	}
+
+	if m.FQDNs != nil {
+		sw.write(", FQDNs:[")
+		for idx, fqdn := range m.FQDNs {
+			sw.write(fqdn)
+			if idx < len(m.FQDNs)-1 {
+				sw.write(", ")
 			}
 		}
-		blocks += "]"
+		sw.write("]")
 	}
 
-	ports := "<nil>"
-	if m.Ports != nil {
-		ports = "["
+	if m.APIServerRef {
+		sw.write(", APIServerRef")
+	}
+	if m.ClusterPodsRef {
+		sw.write(", ClusterPodsRef")
+	}
+	if m.ExternalRef {
+		sw.write(", ExternalRef")
+	}
+
+	if m.NamespaceSelector != nil {
+		sw.write(", NamespaceSelector:")
+		m.NamespaceSelector.writeTo(sw)
+	}
+
+	if m.PodNamePatterns != nil {
+		sw.write(", PodNamePatterns:[")
+		for idx, pattern := range m.PodNamePatterns {
+			sw.write(pattern.String())
+			if idx < len(m.PodNamePatterns)-1 {
+				sw.write(", ")
+			}
+		}
+		sw.write("]")
+	}
+
+	sw.write(", Ports:")
+	if m.Ports == nil {
+		sw.write("<nil>")
+	} else {
+		sw.write("[")
 		for idx, port := range m.Ports {
-			ports += port.String()
+			port.writeTo(sw)
 			if idx < len(m.Ports)-1 {
-				ports += ", "
+				sw.write(", ")
+			}
+		}
+		sw.write("]")
+	}
+	if m.PortSets != nil {
+		sw.write(", PortSets:[")
+		for idx, name := range m.PortSets {
+			sw.write(name)
+			if idx < len(m.PortSets)-1 {
+				sw.write(", ")
+			}
+		}
+		sw.write("]")
+	}
+	if m.SourcePorts != nil {
+		sw.write(", SourcePorts:[")
+		for idx, port := range m.SourcePorts {
+			port.writeTo(sw)
+			if idx < len(m.SourcePorts)-1 {
+				sw.write(", ")
 			}
 		}
-		ports += "]"
+		sw.write("]")
+	}
+
+	if m.Network != "" {
+		sw.write(", Network:")
+		sw.write(m.Network)
+	}
+	if m.RateLimit != nil {
+		sw.write(", RateLimit:")
+		m.RateLimit.writeTo(sw)
+	}
+	if m.ConnRateLimit != nil {
+		sw.write(", ConnRateLimit:")
+		m.ConnRateLimit.writeTo(sw)
+	}
+	if m.PacketLen != nil {
+		sw.write(", PacketLen:")
+		m.PacketLen.writeTo(sw)
+	}
+	if m.Fragments != AnyFragments {
+		sw.write(", Fragments:")
+		sw.write(m.Fragments.String())
+	}
+	if m.L7 != nil {
+		sw.write(", L7:")
+		m.L7.writeTo(sw)
+	}
+	if m.TCPFlags != nil {
+		sw.write(", TCPFlags:")
+		m.TCPFlags.writeTo(sw)
+	}
+	if m.TunnelVNI != nil {
+		sw.write(", TunnelVNI:")
+		sw.writeUint(uint64(*m.TunnelVNI))
+	}
+	if m.Description != "" {
+		sw.write(", Description:")
+		sw.write(strconv.Quote(m.Description))
+	}
+	sw.write(">")
+}
+
+// RateSpec describes a policer: the allowed rate of the traffic and the burst
+// size.
+type RateSpec struct {
+	BitsPerSecond uint64
+	BurstBytes    uint64
+}
+
+// String return a human-readable string representation of the RateSpec.
+func (rs RateSpec) String() string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	rs.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+func (rs *RateSpec) writeTo(sw *stringWriter) {
+	sw.writeUint(rs.BitsPerSecond)
+	sw.write("bps/")
+	sw.writeUint(rs.BurstBytes)
+	sw.write("B")
+}
+
+// ConnRateSpec describes a connection-rate policer: the allowed rate of new
+// connections and the burst size.
+type ConnRateSpec struct {
+	ConnsPerSecond uint64
+	Burst          uint64
+
+	// PerPeer applies the rate to each peer separately instead of to all
+	// connections allowed by the match together.
+	PerPeer bool
+}
+
+// String return a human-readable string representation of the ConnRateSpec.
+func (crs ConnRateSpec) String() string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	crs.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+func (crs *ConnRateSpec) writeTo(sw *stringWriter) {
+	sw.writeUint(crs.ConnsPerSecond)
+	sw.write("cps/")
+	sw.writeUint(crs.Burst)
+	if crs.PerPeer {
+		sw.write("/peer")
 	}
-	return fmt.Sprintf("<Type:%s, Pods:%s, Blocks:%s, Ports:%s>",
-		m.Type, pods, blocks, ports)
+}
+
+// FragmentPolicy selects how fragments of IP packets are treated by a match.
+type FragmentPolicy int
+
+const (
+	// AnyFragments does not treat fragments explicitly (the default).
+	AnyFragments FragmentPolicy = iota
+
+	// AllowFragments allows non-initial fragments of the selected traffic.
+	AllowFragments
+
+	// DenyFragments denies non-initial fragments of the selected traffic.
+	DenyFragments
+)
+
+// String converts FragmentPolicy into a human-readable string.
+func (fp FragmentPolicy) String() string {
+	switch fp {
+	case AnyFragments:
+		return "ANY"
+	case AllowFragments:
+		return "ALLOW-FRAGMENTS"
+	case DenyFragments:
+		return "DENY-FRAGMENTS"
+	}
+	return "INVALID"
+}
+
+// LenRange is an inclusive range of packet lengths in bytes.
+type LenRange struct {
+	Min uint16
+	Max uint16
+}
+
+// String return a human-readable string representation of the LenRange.
+func (lr LenRange) String() string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	lr.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+func (lr *LenRange) writeTo(sw *stringWriter) {
+	sw.writeUint(uint64(lr.Min))
+	sw.write("-")
+	sw.writeUint(uint64(lr.Max))
+	sw.write("B")
+}
+
+// L7Match describes HTTP requests. Empty fields match anything.
+type L7Match struct {
+	// Method is the HTTP method, e.g. GET.
+	Method string
+
+	// PathPrefix is a prefix of the request path, e.g. /api/.
+	PathPrefix string
+
+	// Host is the host requested (the Host header).
+	Host string
+}
+
+// String return a human-readable string representation of the L7Match.
+func (lm L7Match) String() string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	lm.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+func (lm *L7Match) writeTo(sw *stringWriter) {
+	sw.write("<Method:")
+	sw.write(lm.Method)
+	sw.write(", PathPrefix:")
+	sw.write(lm.PathPrefix)
+	sw.write(", Host:")
+	sw.write(lm.Host)
+	sw.write(">")
+}
+
+// TCPFlags is a set of TCP flags.
+type TCPFlags uint8
+
+const (
+	// TCPFlagFIN is the FIN flag.
+	TCPFlagFIN TCPFlags = 0x01
+
+	// TCPFlagSYN is the SYN flag.
+	TCPFlagSYN TCPFlags = 0x02
+
+	// TCPFlagRST is the RST flag.
+	TCPFlagRST TCPFlags = 0x04
+
+	// TCPFlagACK is the ACK flag.
+	TCPFlagACK TCPFlags = 0x10
+)
+
+// String converts TCPFlags into a human-readable string, e.g. SYN|ACK.
+func (tf TCPFlags) String() string {
+	return renderer.TCPFlags(tf).String()
+}
+
+// TCPFlagMatch describes TCP segments by flags which must be set
+// and flags which must be cleared. Other flags may have any value.
+type TCPFlagMatch struct {
+	// Required flags must be set.
+	Required TCPFlags
+
+	// Forbidden flags must be cleared.
+	Forbidden TCPFlags
+}
+
+// String return a human-readable string representation of the TCPFlagMatch.
+func (tfm TCPFlagMatch) String() string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	tfm.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+func (tfm *TCPFlagMatch) writeTo(sw *stringWriter) {
+	sw.write("<Required:")
+	sw.write(tfm.Required.String())
+	sw.write(", Forbidden:")
+	sw.write(tfm.Forbidden.String())
+	sw.write(">")
 }
 
 // PolicyType selects the rule types that the network policy relates to.
@@ -190,6 +871,33 @@ func (pt PolicyType) String() string {
 	return "INVALID"
 }
 
+// AddressFamily selects the IP address family that a policy applies to.
+type AddressFamily int
+
+const (
+	// AddressFamilyBoth tells policy to apply to both IPv4 and IPv6 traffic.
+	AddressFamilyBoth AddressFamily = iota
+
+	// AddressFamilyIPv4 tells policy to apply to IPv4 traffic only.
+	AddressFamilyIPv4
+
+	// AddressFamilyIPv6 tells policy to apply to IPv6 traffic only.
+	AddressFamilyIPv6
+)
+
+// String converts AddressFamily into a human-readable string.
+func (af AddressFamily) String() string {
+	switch af {
+	case AddressFamilyBoth:
+		return "BOTH"
+	case AddressFamilyIPv4:
+		return "IPv4"
+	case AddressFamilyIPv6:
+		return "IPv6"
+	}
+	return "INVALID"
+}
+
 // MatchType selects the direction of the traffic to apply a Match to.
 // The direction is from the Pod point of view!
 type MatchType int
@@ -235,6 +943,19 @@ func (pt ProtocolType) String() string {
 	return "INVALID"
 }
 
+// ParseProtocolType converts the string representation of a protocol,
+// as returned by ProtocolType.String(), back to ProtocolType.
+// The conversion is case-insensitive.
+func ParseProtocolType(s string) (ProtocolType, error) {
+	switch strings.ToUpper(s) {
+	case "TCP":
+		return TCP, nil
+	case "UDP":
+		return UDP, nil
+	}
+	return 0, fmt.Errorf("invalid protocol: %q", s)
+}
+
 // Port represent a TCP or UDP port.
 // Number=0 represents all ports for a given protocol.
 type Port struct {
@@ -250,6 +971,41 @@ func (port Port) String() string {
 	return port.Protocol.String() + ":" + strconv.Itoa(int(port.Number))
 }
 
+func (port Port) writeTo(sw *stringWriter) {
+	sw.write(port.Protocol.String())
+	if port.Number == 0 {
+		sw.write(":ANY")
+		return
+	}
+	sw.write(":")
+	sw.writeUint(uint64(port.Number))
+}
+
+// ParsePort converts the string representation of a port, as returned
+// by Port.String(), back to Port. The expected format is
+// "<protocol>:<number>" or "<protocol>:ANY", e.g. "TCP:443" or "UDP:ANY".
+func ParsePort(s string) (Port, error) {
+	sep := strings.LastIndex(s, ":")
+	if sep == -1 {
+		return Port{}, fmt.Errorf("invalid port %q: expected <protocol>:<number>", s)
+	}
+	protocol, err := ParseProtocolType(s[:sep])
+	if err != nil {
+		return Port{}, fmt.Errorf("invalid port %q: %v", s, err)
+	}
+	port := Port{Protocol: protocol}
+	number := s[sep+1:]
+	if strings.ToUpper(number) == "ANY" {
+		return port, nil
+	}
+	value, err := strconv.ParseUint(number, 10, 16)
+	if err != nil {
+		return Port{}, fmt.Errorf("invalid port number %q: expected 0-65535 or ANY", number)
+	}
+	port.Number = uint16(value)
+	return port, nil
+}
+
 // IPBlock selects a particular CIDR with possible exceptions.
 type IPBlock struct {
 	Network net.IPNet
@@ -258,14 +1014,200 @@ type IPBlock struct {
 
 // String return a human-readable string representation of the IP Block.
 func (ipb IPBlock) String() string {
-	excepts := ""
-	for idx, except := range ipb.Except {
-		excepts += except.String()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	ipb.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+// WriteTo writes the human-readable form of IPBlock (as returned by String())
+// into the writer without building intermediate strings.
+func (ipb IPBlock) WriteTo(w io.Writer) (int64, error) {
+	sw := &stringWriter{w: w}
+	ipb.writeTo(sw)
+	return sw.n, sw.err
+}
+
+func (ipb *IPBlock) writeTo(sw *stringWriter) {
+	// Network is printed the way fmt prints the net.IPNet struct.
+	sw.write("<Net:{")
+	sw.write(ipb.Network.IP.String())
+	sw.write(" ")
+	sw.write(ipb.Network.Mask.String())
+	sw.write("}, Except:[")
+	for idx := range ipb.Except {
+		sw.write(ipb.Except[idx].String())
 		if idx < len(ipb.Except)-1 {
-			excepts += ", "
+			sw.write(", ")
+		}
+	}
+	sw.write("]>")
+}
+
+// IPMask selects IP addresses using a bit mask which, unlike the netmask
+// of IPBlock, need not be contiguous (i.e. a wildcard mask).
+// IP address X is matched if and only if X & Mask == Address & Mask.
+// For example, Address=10.0.0.1 with Mask=255.0.0.255 matches all addresses
+// of the form 10.*.*.1.
+type IPMask struct {
+	Address net.IP
+	Mask    net.IPMask
+}
+
+// Network returns the IP mask expressed as (possibly non-canonical) IP network.
+func (ipm IPMask) Network() *net.IPNet {
+	address := ipm.Address
+	if len(ipm.Mask) == net.IPv4len && address.To4() != nil {
+		address = address.To4()
+	}
+	return &net.IPNet{IP: address.Mask(ipm.Mask), Mask: ipm.Mask}
+}
+
+// String return a human-readable string representation of the IP Mask.
+func (ipm IPMask) String() string {
+	return fmt.Sprintf("<Addr:%s, Mask:%s>", ipm.Address, net.IP(ipm.Mask))
+}
+
+// NodeScope selects nodes by name or by labels: a node is selected if its name
+// is listed in Nodes or if Selector (non-nil) selects its labels, with
+// the semantics of NamespaceSelector. Empty scope selects no node.
+type NodeScope struct {
+	Nodes    []string
+	Selector *NamespaceSelector
+}
+
+// String return a human-readable string representation of the scope.
+func (ns NodeScope) String() string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	ns.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+func (ns *NodeScope) writeTo(sw *stringWriter) {
+	sw.write("<Nodes:[")
+	for idx, node := range ns.Nodes {
+		sw.write(node)
+		if idx < len(ns.Nodes)-1 {
+			sw.write(", ")
 		}
 	}
-	return fmt.Sprintf("<Net:%s, Except:[%s]>",
-		ipb.Network, excepts)
+	sw.write("]")
+	if ns.Selector != nil {
+		sw.write(", Selector:")
+		ns.Selector.writeTo(sw)
+	}
+	sw.write(">")
+}
+
+// NamespaceSelector selects namespaces by their labels, with the semantics
+// of the K8s label selector: a namespace is selected if it has all the labels
+// of MatchLabels and satisfies all MatchExpressions.
+// Empty selector selects all namespaces.
+type NamespaceSelector struct {
+	MatchLabels      map[string]string
+	MatchExpressions []LabelRequirement
+}
 
+// String return a human-readable string representation of the selector.
+func (ns NamespaceSelector) String() string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	ns.writeTo(&stringWriter{w: buf})
+	return buf.String()
+}
+
+func (ns *NamespaceSelector) writeTo(sw *stringWriter) {
+	keys := make([]string, 0, len(ns.MatchLabels))
+	for key := range ns.MatchLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sw.write("<Labels:[")
+	for idx, key := range keys {
+		sw.write(key)
+		sw.write("=")
+		sw.write(ns.MatchLabels[key])
+		if idx < len(keys)-1 {
+			sw.write(", ")
+		}
+	}
+	sw.write("], Expressions:[")
+	for idx := range ns.MatchExpressions {
+		ns.MatchExpressions[idx].writeTo(sw)
+		if idx < len(ns.MatchExpressions)-1 {
+			sw.write(", ")
+		}
+	}
+	sw.write("]>")
+}
+
+// PodNamePattern selects pods of a namespace by their names. Name is a glob
+// pattern with the syntax of path.Match: '*' matches any sequence
+// of characters, '?' any single character and '[...]' a character class
+// (ranges and negation with '^' included), '\\' escapes the next character.
+// For example "web-*" selects all pods with names starting with "web-".
+// A name without wildcards selects a single pod. Malformed patterns select
+// no pod.
+type PodNamePattern struct {
+	Namespace string
+	Name      string
+}
+
+// String return a human-readable string representation of the pattern.
+func (pnp PodNamePattern) String() string {
+	return pnp.Namespace + "/" + pnp.Name
+}
+
+// LabelRequirement is a requirement on the value of a label.
+// Values are used only with the LabelIn and LabelNotIn operators.
+type LabelRequirement struct {
+	Key      string
+	Operator LabelOperator
+	Values   []string
+}
+
+func (lr *LabelRequirement) writeTo(sw *stringWriter) {
+	sw.write(lr.Key)
+	sw.write(" ")
+	sw.write(lr.Operator.String())
+	if lr.Operator == LabelIn || lr.Operator == LabelNotIn {
+		sw.write(" (")
+		sw.write(strings.Join(lr.Values, ", "))
+		sw.write(")")
+	}
+}
+
+// LabelOperator is the relation between the label and the values
+// of LabelRequirement.
+type LabelOperator int
+
+const (
+	// LabelIn requires the label to have one of the values.
+	LabelIn LabelOperator = iota
+
+	// LabelNotIn requires the label to be either not set or have none
+	// of the values.
+	LabelNotIn
+
+	// LabelExists requires the label to be set.
+	LabelExists
+
+	// LabelDoesNotExist requires the label not to be set.
+	LabelDoesNotExist
+)
+
+// String converts LabelOperator into a human-readable string.
+func (lo LabelOperator) String() string {
+	switch lo {
+	case LabelIn:
+		return "IN"
+	case LabelNotIn:
+		return "NOT-IN"
+	case LabelExists:
+		return "EXISTS"
+	case LabelDoesNotExist:
+		return "DOES-NOT-EXIST"
+	}
+	return "INVALID"
 }
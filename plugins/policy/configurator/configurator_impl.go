@@ -19,11 +19,14 @@ package configurator
 import (
 	"net"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/ligato/cn-infra/logging"
 
 	"github.com/contiv/vpp/plugins/contiv"
 	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
 	"github.com/contiv/vpp/plugins/policy/cache"
 	"github.com/contiv/vpp/plugins/policy/renderer"
 	"github.com/contiv/vpp/plugins/policy/utils"
@@ -39,10 +42,190 @@ import (
 // always results in the same list of rules.
 type PolicyConfigurator struct {
 	Deps
+	sync.Mutex
 
 	renderers         []renderer.PolicyRendererAPI
+	rendererLabels    []*podmodel.Pod_Label // nil for default renderers
+	rendererSplits    []rendererSplit
 	parallelRendering bool
+	sharedRules       bool
+	aggregatePodIPs   bool
+	ruleOrdering      RuleOrdering
+	actionPrecedence  ActionPrecedence
+	combinedRules     bool
+	directionOrder    DirectionOrder
+	allowedProtocols  map[ProtocolType]struct{} // nil = all allowed
+	retryAttempts     int
+	retryBackoff      BackoffStrategy
+	backingOff        bool       // a commit waits between retry attempts
+	retryDone         *sync.Cond // signalled when the commit resumes
+	strictPolicing    bool
+	strictConnRate    bool
+	strictFragments   bool
+	strictPacketLen   bool
+	strictL7          bool
+	strictSourcePorts bool
+	strictTCPFlags    bool
+	strictTunnelVNI   bool
+	strictRuleFormat  bool
+	coalesceMatches   bool
+	ruleGroups        bool
+	readOnly          bool
+	emptySetDenyAll   map[string]struct{} // namespaces
+	mappedAddresses   MappedAddressHandling
 	podIPAddresses    PodIPAddresses
+	config            map[podmodel.ID]ContivPolicies // committed config
+	rules             map[podmodel.ID]PodRules       // committed rules
+	groups            map[podmodel.ID]PodRuleGroups  // committed rule groups
+	assignments       map[podmodel.ID][]int          // pod -> indexes of renderers
+
+	// handling of pods of renderers removed by UnregisterRenderer
+	unregisteredRenderers UnregisteredRendererHandling
+
+	// handling of pods configured repeatedly in one transaction
+	intraTxnConflict IntraTxnConflictHandling
+
+	// cluster DNS
+	dnsProvider  ClusterDNSProvider
+	clusterDNSIP []net.IP
+
+	// rule provenance
+	trackProvenance bool
+	provenance      map[podmodel.ID][]ProvenanceRecord
+
+	// delayed teardown
+	clock           Clock
+	timerGeneration uint64 // generation of the last timer scheduled by afterFunc
+	gracePeriod     time.Duration
+	teardowns       map[podmodel.ID]*scheduledTimer // pod -> scheduled teardown
+
+	// API server endpoints
+	apiServerProvider  APIServerEndpointsProvider
+	apiServerEndpoints []APIServerEndpoint
+
+	// cluster pod CIDRs
+	podCIDRProvider ClusterPodCIDRsProvider
+	clusterPodCIDRs []net.IPNet
+
+	// namespace selectors
+	namespaceProvider NamespaceLabelsProvider
+	namespaceLabels   map[string]map[string]string // namespace -> labels
+
+	// pod label gates
+	podLabelsProvider PodLabelsProvider
+
+	// node-scoped policies
+	localNode *NodeIdentity
+
+	// federated pod IDs
+	podIDRewriter PodIDRewriter
+
+	// readiness-gated ingress
+	podReadinessProvider PodReadinessProvider
+
+	// pod phases
+	podPhaseProvider PodPhaseProvider
+	terminatedPods   TerminatedPodHandling
+	skippedPods      map[podmodel.ID]ContivPolicies // terminated pods not rendered
+
+	// FQDN resolution
+	fqdnResolver FQDNResolver
+	fqdnTTL      time.Duration
+	fqdnIPs      map[string][]net.IP // last-known-good
+	fqdnTimer    Timer
+
+	// policy expiration
+	expiryTimer *scheduledTimer
+
+	// policies toggled by SetPolicyEnabled (policy -> enabled)
+	policyToggles map[policymodel.ID]bool
+
+	// named port-sets (name -> ports)
+	portSets map[string][]Port
+
+	// persistent rule cache (digest of inputs -> rules)
+	ruleCacheFile  string
+	ruleCache      map[string]*ruleCacheEntry
+	ruleCacheStats RuleCacheStats
+
+	// pinned policies retained only because of the pin (not configured anymore)
+	retainedPolicies map[podmodel.ID]map[policymodel.ID]struct{}
+
+	// order in which exclusive policies were applied to pods
+	appliedAt    map[podmodel.ID]map[policymodel.ID]uint64
+	lastApplySeq uint64
+
+	// audit log
+	auditSinks []AuditSink
+
+	// metrics
+	metricsSinks  []MetricsSink
+	podAnonymizer PodAnonymizer
+
+	// rule-change events
+	ruleChangeBuffer      int
+	ruleChangeSubscribers []*ruleChangeSubscriber
+
+	// conntrack zones
+	conntrackZones map[podmodel.ID]renderer.ConntrackZone
+	zonesInUse     map[renderer.ConntrackZone]podmodel.ID
+
+	// explicit rule priorities
+	rulePriorities map[rulePrioritiesKey]*podRulePriorities
+
+	// unknown pods (peer -> referencing pods)
+	unknownPods  UnknownPodHandling
+	pendingPeers map[podmodel.ID]map[podmodel.ID]struct{}
+
+	// learning mode (pod -> observed flows)
+	observedFlows map[podmodel.ID]map[observedFlow]struct{}
+
+	// maintenance window
+	window      *MaintenanceWindow
+	windowTimer *scheduledTimer
+	queued      *PolicyConfiguratorTxn // changes deferred until the window opens
+
+	// commit debouncing
+	debouncePeriod time.Duration
+	debounceTimer  *scheduledTimer
+	debounced      *PolicyConfiguratorTxn // changes coalesced until the timer fires
+
+	// pacing of applies
+	applyRateLimit int
+	applyLimiter   ApplyLimiter
+
+	// pods with traced policy evaluation
+	tracedPods map[podmodel.ID]struct{}
+
+	// status of the last commit
+	statusLock     sync.Mutex
+	lastCommitTime time.Time
+	lastCommitErr  error
+
+	// statistics of the committed state (see Stats())
+	statsLock  sync.Mutex
+	stats      ConfiguratorStats
+	policyRefs map[policymodel.ID]int // policy -> number of pods
+
+	// base policies (see RegisterBasePolicy)
+	basePolicies map[policymodel.ID]*ContivPolicy
+}
+
+// Option is used to customize the behaviour of PolicyConfigurator.
+// Options are passed to Init().
+type Option func(pc *PolicyConfigurator)
+
+// WithSharedRules enables/disables sharing of generated rules between pods.
+// With sharing enabled (the default), pods with the same set of policies
+// are rendered with the very same list of rules (instances), generated only
+// once per commit. With sharing disabled, every pod and renderer receives its
+// own deep copy of the rules, allowing renderers to modify them in-place
+// at the cost of higher memory usage. What is allowed by the rules is
+// the same in both cases.
+func WithSharedRules(shared bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.sharedRules = shared
+	}
 }
 
 // Deps lists dependencies of PolicyConfigurator.
@@ -58,7 +241,47 @@ type PolicyConfiguratorTxn struct {
 	configurator   *PolicyConfigurator
 	resync         bool
 	config         map[podmodel.ID]ContivPolicies // config to render
+	teardown       map[podmodel.ID]struct{}       // pods to tear down
+	skipped        map[podmodel.ID]ContivPolicies // terminated pods not rendered
+	removedSources []string
+	correlationIDs []string
+	resyncScopes   map[string]struct{}      // namespaces (only with NewScopedResyncTxn)
+	rules          map[podmodel.ID]PodRules // rendered rules
+	assignments    map[podmodel.ID][]int    // pod -> indexes of renderers
 	podIPAddresses PodIPAddresses
+	clusterDNSIP   []net.IP
+
+	// policies toggled by SetPolicyEnabled (policy -> enabled)
+	toggledPolicies map[policymodel.ID]bool
+
+	// pods configured repeatedly with different policies (only with RejectConflicts)
+	conflicts []podmodel.ID
+
+	// policies unpinned by UnpinPolicy and pinned policies retained for pods
+	unpinnedPolicies map[policymodel.ID]struct{}
+	retainedPolicies map[podmodel.ID]map[policymodel.ID]struct{}
+
+	// order in which exclusive policies were applied to pods
+	appliedAt    map[podmodel.ID]map[policymodel.ID]uint64
+	lastApplySeq uint64
+
+	// rule groups (only with WithRuleGroups)
+	groups     map[podmodel.ID]PodRuleGroups  // rendered rule groups
+	ruleGroups map[string]*renderer.RuleGroup // groups generated in this txn
+
+	// matches already processed by generateRules (only with WithMatchCoalescing)
+	coalesced map[coalescedMatchKey]struct{}
+
+	// pod with traced evaluation (nil if not traced)
+	tracedPod *podmodel.ID
+
+	// pod applies allowed by the limiter (only with WithApplyRateLimit)
+	applyBudget int
+
+	// rule provenance (only with WithRuleProvenance)
+	origin     RuleContributor
+	origins    map[*renderer.ContivRule][]RuleContributor
+	provenance map[podmodel.ID][]ProvenanceRecord
 }
 
 // ContivPolicies is a list of policies that can be ordered by policy ID.
@@ -71,34 +294,130 @@ type ProcessedPolicySet struct {
 	policies ContivPolicies // ordered
 	ingress  ContivRules
 	egress   ContivRules
+	groups   PodRuleGroups
 }
 
 // ContivRules is a list of Contiv rules.
 type ContivRules []*renderer.ContivRule
 
+// PodRules stores ingress and egress rules rendered for a single pod.
+// The direction is from the vswitch point of view.
+type PodRules struct {
+	Ingress ContivRules
+	Egress  ContivRules
+}
+
 // PodIPAddresses is a map used to remember IP address for each configured pod.
 type PodIPAddresses map[podmodel.ID]*net.IPNet
 
 // Init initializes policy configurator.
-func (pc *PolicyConfigurator) Init(parallelRendering bool) error {
+func (pc *PolicyConfigurator) Init(parallelRendering bool, options ...Option) error {
 	pc.renderers = []renderer.PolicyRendererAPI{}
 	pc.parallelRendering = parallelRendering
+	pc.sharedRules = true
 	pc.podIPAddresses = make(PodIPAddresses)
+	pc.config = make(map[podmodel.ID]ContivPolicies)
+	pc.rules = make(map[podmodel.ID]PodRules)
+	pc.groups = make(map[podmodel.ID]PodRuleGroups)
+	pc.assignments = make(map[podmodel.ID][]int)
+	pc.provenance = make(map[podmodel.ID][]ProvenanceRecord)
+	pc.clock = realClock{}
+	pc.retryDone = sync.NewCond(&pc.Mutex)
+	pc.teardowns = make(map[podmodel.ID]*scheduledTimer)
+	pc.policyRefs = make(map[policymodel.ID]int)
+	pc.pendingPeers = make(map[podmodel.ID]map[podmodel.ID]struct{})
+	pc.portSets = make(map[string][]Port)
+	pc.basePolicies = make(map[policymodel.ID]*ContivPolicy)
+	for _, option := range options {
+		option(pc)
+	}
+	if pc.dnsProvider != nil {
+		pc.clusterDNSIP = sortedIPs(pc.dnsProvider.GetClusterDNSIPs())
+	}
+	if pc.apiServerProvider != nil {
+		pc.apiServerEndpoints = sortedAPIServerEndpoints(pc.apiServerProvider.GetAPIServerEndpoints())
+	}
+	if pc.podCIDRProvider != nil {
+		pc.clusterPodCIDRs = normalizeIPNets(pc.podCIDRProvider.GetClusterPodCIDRs())
+	}
+	if pc.namespaceProvider != nil {
+		pc.namespaceLabels = copyNamespaceLabels(pc.namespaceProvider.GetNamespaceLabels())
+	}
+	if pc.fqdnResolver != nil {
+		pc.fqdnIPs = make(map[string][]net.IP)
+		pc.scheduleFQDNRefresh()
+	}
+	if pc.ruleCacheFile != "" {
+		pc.loadRuleCache()
+	}
+	if pc.applyLimiter == nil && pc.applyRateLimit > 0 {
+		pc.applyLimiter = newRateLimiter(pc.applyRateLimit, pc.clock)
+	}
 	return nil
 }
 
-// RegisterRenderer registers a new renderer.
-// The renderer will be receiving rules for all pods in this K8s node.
+// RegisterRenderer registers a new default renderer.
+// The renderer will be receiving rules for all pods in this K8s node
+// not handled by any labeled renderer.
 // It is up to the render to possibly filter out rules for pods without
 // an inter-connection in the destination network stack.
 func (pc *PolicyConfigurator) RegisterRenderer(renderer renderer.PolicyRendererAPI) error {
 	pc.renderers = append(pc.renderers, renderer)
+	pc.rendererLabels = append(pc.rendererLabels, nil)
 	return nil
 }
 
 // Close deallocates resource held by the configurator.
 func (pc *PolicyConfigurator) Close() error {
-	return nil
+	pc.Lock()
+	defer pc.Unlock()
+	for pod, timer := range pc.teardowns {
+		timer.Stop()
+		delete(pc.teardowns, pod)
+	}
+	if pc.fqdnTimer != nil {
+		pc.fqdnTimer.Stop()
+		pc.fqdnTimer = nil
+	}
+	if pc.expiryTimer != nil {
+		pc.expiryTimer.Stop()
+		pc.expiryTimer = nil
+	}
+	if pc.windowTimer != nil {
+		pc.windowTimer.Stop()
+		pc.windowTimer = nil
+	}
+	pc.queued = nil
+	if pc.debounceTimer != nil {
+		pc.debounceTimer.Stop()
+		pc.debounceTimer = nil
+	}
+	pc.debounced = nil
+	pc.closeRuleChangeSubscribers()
+	return pc.saveRuleCache()
+}
+
+// ConfiguredPods returns IDs of all pods with committed configuration,
+// sorted by namespace and name.
+func (pc *PolicyConfigurator) ConfiguredPods() []podmodel.ID {
+	pc.Lock()
+	defer pc.Unlock()
+	pods := []podmodel.ID{}
+	for pod := range pc.config {
+		pods = append(pods, pod)
+	}
+	sortPodIDs(pods)
+	return pods
+}
+
+// sortPodIDs sorts pod IDs by namespace and name.
+func sortPodIDs(pods []podmodel.ID) {
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
 }
 
 // NewTxn starts a new transaction. The re-configuration executes only after
@@ -107,48 +426,159 @@ func (pc *PolicyConfigurator) Close() error {
 // transaction are left unchanged.
 func (pc *PolicyConfigurator) NewTxn(resync bool) Txn {
 	txn := &PolicyConfiguratorTxn{
-		Log:            pc.Log,
-		configurator:   pc,
-		resync:         resync,
-		config:         make(map[podmodel.ID]ContivPolicies),
-		podIPAddresses: pc.podIPAddresses.Copy(),
+		Log:          pc.Log,
+		configurator: pc,
+		resync:       resync,
+		config:       make(map[podmodel.ID]ContivPolicies),
+		teardown:     make(map[podmodel.ID]struct{}),
+		rules:        make(map[podmodel.ID]PodRules),
+		assignments:  make(map[podmodel.ID][]int),
+	}
+	if pc.ruleGroups {
+		txn.groups = make(map[podmodel.ID]PodRuleGroups)
+		txn.ruleGroups = make(map[string]*renderer.RuleGroup)
+	}
+	if pc.trackProvenance {
+		txn.origins = make(map[*renderer.ContivRule][]RuleContributor)
+		txn.provenance = make(map[podmodel.ID][]ProvenanceRecord)
 	}
 	return txn
 }
 
 // Configure applies the set of policies for a given pod. The existing policies
 // are replaced. The order of policies is not important (it is a set).
+// The policies are deep-copied, the caller may modify them afterwards.
+// The pod ID is rewritten if selected by WithPodIDRewriter.
 func (pct *PolicyConfiguratorTxn) Configure(pod podmodel.ID, policies []*ContivPolicy) Txn {
+	return pct.configure(pct.configurator.rewritePodID(pod), policies)
+}
+
+// configure implements Configure() for the pod ID already rewritten (used
+// internally to re-configure the committed pods).
+func (pct *PolicyConfiguratorTxn) configure(pod podmodel.ID, policies []*ContivPolicy) Txn {
 	pct.Log.WithFields(logging.Fields{
-		"pod":      pod,
+		"pod":      pct.configurator.logPod(pod),
 		"policies": policies,
 	}).Debug("PolicyConfigurator Configure()")
-	pct.config[pod] = policies
+	if !pct.inResyncScope(pod) {
+		pct.Log.WithField("pod", pct.configurator.logPod(pod)).Warn(
+			"Pod is outside of the scope of the resync, ignoring")
+		return pct
+	}
+	policiesCopy := pct.configurator.canonicalPolicies(deepCopyPolicies(policies))
+	if configured, isConfigured := pct.config[pod]; isConfigured {
+		policiesCopy = pct.resolveConflict(pod, configured, policiesCopy)
+	}
+	pct.config[pod] = policiesCopy
+	return pct
+}
+
+// RemoveBySource removes policies contributed by the given source from all
+// pods. The removal is evaluated during Commit().
+func (pct *PolicyConfiguratorTxn) RemoveBySource(source string) Txn {
+	pct.Log.WithField("source", source).Debug("PolicyConfigurator RemoveBySource()")
+	pct.removedSources = append(pct.removedSources, source)
 	return pct
 }
 
 // Commit proceeds with the reconfiguration.
 func (pct *PolicyConfiguratorTxn) Commit() error {
+	policyLists := make([]ContivPolicies, 0, len(pct.config))
+	for _, policies := range pct.config {
+		policyLists = append(policyLists, policies)
+	}
+	pct.configurator.prefetchFQDNs(policyLists)
+
+	pct.configurator.Lock()
+	defer pct.configurator.Unlock()
+	if pct.configurator.readOnly {
+		pct.Log.Warn("Refusing to commit policies, the configurator is read-only")
+		return ErrReadOnly
+	}
+	if err := pct.checkConflicts(); err != nil {
+		pct.Log.WithField("err", err).Error("Refusing to commit policies")
+		pct.configurator.setLastCommitStatus(err)
+		return err
+	}
+	if pct.configurator.debouncePeriod > 0 {
+		return pct.commitDebounced()
+	}
+	return pct.commitScheduled()
+}
+
+// commitScheduled commits the transaction now or in the maintenance window.
+// The configurator is expected to be locked by the caller.
+func (pct *PolicyConfiguratorTxn) commitScheduled() error {
+	if pct.configurator.window != nil {
+		return pct.commitInWindow()
+	}
+	return pct.commit()
+}
+
+// commit implements Commit() with the configurator already locked.
+func (pct *PolicyConfiguratorTxn) commit() error {
+	pct.configurator.waitForRetries()
+	pct.Log.WithFields(logging.Fields{
+		"pods":   len(pct.config),
+		"resync": pct.resync,
+	}).Debug("Committing transaction")
+	pct.podIPAddresses = pct.configurator.podIPAddresses.Copy()
+	pct.clusterDNSIP = pct.configurator.clusterDNSIP
+	pct.applyResyncScopes()
+	pct.applyRemovedSources()
+	pct.applyPinnedPolicies()
+	pct.applyPolicyToggles()
+	pct.orderExclusivePolicies()
+	pct.scheduleTeardowns()
+	pct.applyExpiration()
+	pct.skipTerminatedPods()
+	if err := pct.checkProtocols(); err != nil {
+		pct.Log.WithField("err", err).Error("Refusing to commit policies")
+		pct.configurator.setLastCommitStatus(err)
+		return err
+	}
+	if err := pct.checkBasePolicies(); err != nil {
+		pct.Log.WithField("err", err).Error("Refusing to commit policies")
+		pct.configurator.setLastCommitStatus(err)
+		return err
+	}
+	if err := pct.checkUnknownPods(); err != nil {
+		pct.Log.WithField("err", err).Error("Refusing to commit policies")
+		pct.configurator.setLastCommitStatus(err)
+		return err
+	}
+
 	// Remember processed sets of policies between iterations so that the same
 	// set will not be processed more than once.
 	processed := []ProcessedPolicySet{}
 
 	// Transactions of all registered renderers.
 	rendererTxns := []renderer.Txn{}
+	var wasError error
 
-	for pod, unorderedPolicies := range pct.config {
+	pods := sortedPods(pct.config)
+	for podIdx, pod := range pods {
+		unorderedPolicies := pct.config[pod]
 		var ingress ContivRules
 		var egress ContivRules
+		var groups PodRuleGroups
 		var delPodConfig bool
 
 		// Get target pod configuration.
 		podIPNet, hadIPAddr := pct.podIPAddresses[pod]
 		found, podData := pct.configurator.Cache.LookupPod(pod)
+		pct.startTrace(pod)
+		pct.trace(tracePodLookup, logging.Fields{
+			"found": found,
+			"ip":    podData.GetIpAddress(),
+		})
 
 		// Handle removed pod.
-		if !found || podData.IpAddress == "" {
+		_, teardown := pct.teardown[pod]
+		if teardown || !found || podData.IpAddress == "" {
 			if hadIPAddr {
-				pct.Log.WithField("pod", pod).Debug("Removing policies from the pod.")
+				pct.Log.WithField("pod", pct.configurator.logPod(pod)).Debug("Removing policies from the pod.")
+				pct.trace(traceRemoved, logging.Fields{"teardown": teardown})
 				delPodConfig = true
 				delete(pct.podIPAddresses, pod)
 			} else {
@@ -159,16 +589,16 @@ func (pct *PolicyConfiguratorTxn) Commit() error {
 
 		if !delPodConfig {
 			// Get pod IP address (expressed as one-host subnet).
-			podIPNet = utils.GetOneHostSubnet(podData.IpAddress)
+			podIPNet = pct.configurator.hostSubnet(podData.IpAddress)
 			if podIPNet == nil {
-				pct.Log.WithField("pod", pod).Warn("Pod has invalid IP address assigned")
+				pct.Log.WithField("pod", pct.configurator.logPod(pod)).Warn("Pod has invalid IP address assigned")
 				continue
 			}
 			pct.podIPAddresses[pod] = podIPNet
+			pct.configurator.assignConntrackZone(pod)
 
-			// Sort policies to get the same outcome for the same set.
-			policies := unorderedPolicies.Copy()
-			sort.Sort(policies)
+			policies := pct.effectivePolicies(pod, unorderedPolicies)
+			pct.trace(traceInputPolicies, logging.Fields{"policies": policies})
 
 			// Check if this set was already processed.
 			alreadyProcessed := false
@@ -176,26 +606,72 @@ func (pct *PolicyConfiguratorTxn) Commit() error {
 				if policySet.policies.Equals(policies) {
 					ingress = policySet.ingress
 					egress = policySet.egress
+					groups = policySet.groups
 					alreadyProcessed = true
 				}
 			}
+			pct.trace(traceProcessedSetLookup, logging.Fields{"found": alreadyProcessed})
 
 			// Generate rules for a set of policies not yet processed.
+			if alreadyProcessed && pct.tracedPod != nil {
+				// Re-generate only to trace the evaluation, the result is discarded.
+				origins := pct.origins
+				pct.origins = nil
+				pct.generateRules(MatchIngress, policies)
+				pct.generateRules(MatchEgress, policies)
+				pct.origins = origins
+			}
 			if !alreadyProcessed {
-				// Direction in policies is from the pod point of view, whereas rules
-				// are evaluated from the vswitch perspective.
-				egress = pct.generateRules(MatchIngress, policies)
-				ingress = pct.generateRules(MatchEgress, policies)
+				ingress, egress = pct.cachedRules(policies)
+				if pct.groups != nil {
+					groups = pct.generatePodRuleGroups(policies)
+				}
 				// Remember already processed set of policies.
 				processed = append(processed,
 					ProcessedPolicySet{
 						policies: policies,
 						ingress:  ingress,
 						egress:   egress,
+						groups:   groups,
 					})
 			}
 		}
 
+		var podGroups *PodRuleGroups
+		if !delPodConfig {
+			pct.rules[pod] = PodRules{Ingress: ingress, Egress: egress}
+			if pct.groups != nil {
+				pct.groups[pod] = groups
+				podGroups = &groups
+			}
+		}
+		pct.trace(traceFinalRules, logging.Fields{
+			"ingress": ingress,
+			"egress":  egress,
+		})
+
+		// Remember where the rules came from.
+		if pct.provenance != nil {
+			pct.provenance[pod] = pct.buildProvenance(ingress, egress)
+		}
+
+		// Select renderers for the pod.
+		var targets []int
+		if delPodConfig {
+			targets = pct.configurator.assignments[pod]
+		} else {
+			targets = pct.configurator.assignRenderers(podData)
+			pct.assignments[pod] = targets
+		}
+
+		// Wait until the apply is allowed by the rate limit.
+		if pct.configurator.applyLimiter != nil {
+			var err error
+			if rendererTxns, err = pct.paceApply(rendererTxns, len(pods)-podIdx); err != nil {
+				wasError = err
+			}
+		}
+
 		// Start transaction on every renderer if they are not running already.
 		if len(rendererTxns) == 0 {
 			for _, renderer := range pct.configurator.renderers {
@@ -204,40 +680,201 @@ func (pct *PolicyConfiguratorTxn) Commit() error {
 		}
 
 		// Add rules into the transactions.
-		for _, rTxn := range rendererTxns {
-			rTxn.Render(pod, podIPNet, ingress.Copy(), egress.Copy(), delPodConfig)
+		for _, idx := range targets {
+			previous := pct.previousRules(pod, idx, podIPNet)
+			err := pct.configurator.render(rendererTxns[idx], idx, pod, podIPNet, ingress, egress, podGroups, previous, delPodConfig)
+			if err != nil {
+				pct.Log.WithFields(logging.Fields{
+					"pod": pct.configurator.logPod(pod),
+					"err": err,
+				}).Error("Renderer is not able to install rules for the pod")
+				wasError = err
+			}
+		}
+
+		// Remove the pod from renderers it is no longer assigned to
+		// (resync removes them implicitly).
+		if !pct.resync && !delPodConfig {
+			for _, idx := range pct.configurator.assignments[pod] {
+				if !hasRenderer(targets, idx) {
+					pct.configurator.render(rendererTxns[idx], idx, pod, podIPNet, nil, nil, nil, nil, true)
+				}
+			}
 		}
 	}
 
+	pct.tracedPod = nil
+
 	// Commit all renderer transactions.
-	var wasError error
-	rndrChan := make(chan error)
-	for _, rTxn := range rendererTxns {
-		if pct.configurator.parallelRendering {
-			go func(txn renderer.Txn) {
-				err := txn.Commit()
-				rndrChan <- err
-			}(rTxn)
+	if err := pct.configurator.commitRenderers(rendererTxns); err != nil {
+		wasError = err
+	}
+
+	var audit *AuditRecord
+	if wasError == nil && len(pct.configurator.auditSinks) > 0 {
+		audit = pct.buildAuditRecord()
+	}
+	var metrics *CommitMetrics
+	if len(pct.configurator.metricsSinks) > 0 {
+		metrics = pct.buildCommitMetrics(wasError != nil)
+	}
+	var ruleChanges []RuleChangeEvent
+	if len(pct.configurator.ruleChangeSubscribers) > 0 {
+		ruleChanges = pct.buildRuleChangeEvents()
+	}
+
+	// Save changes to the configurator.
+	pct.saveStats()
+	pct.configurator.podIPAddresses = pct.podIPAddresses.Copy()
+	if pct.resync {
+		pct.configurator.config = make(map[podmodel.ID]ContivPolicies)
+	}
+	for pod, policies := range pct.config {
+		if _, hasIPAddr := pct.podIPAddresses[pod]; hasIPAddr {
+			pct.configurator.config[pod] = policies
 		} else {
-			err := rTxn.Commit()
-			if err != nil {
-				wasError = err
+			delete(pct.configurator.config, pod)
+		}
+	}
+	pct.saveSkippedPods()
+	pct.saveToggledPolicies()
+	pct.saveRetainedPolicies()
+	pct.saveExclusiveOrder()
+	pct.releaseConntrackZones()
+	pct.releaseRulePriorities()
+	pct.savePendingPeers()
+	if pct.resync {
+		pct.configurator.rules = make(map[podmodel.ID]PodRules)
+	}
+	for pod := range pct.config {
+		if rules, hasRules := pct.rules[pod]; hasRules {
+			pct.configurator.rules[pod] = rules
+		} else {
+			delete(pct.configurator.rules, pod)
+		}
+	}
+	if pct.resync {
+		pct.configurator.groups = make(map[podmodel.ID]PodRuleGroups)
+	}
+	for pod := range pct.config {
+		if groups, hasGroups := pct.groups[pod]; hasGroups {
+			pct.configurator.groups[pod] = groups
+		} else {
+			delete(pct.configurator.groups, pod)
+		}
+	}
+	if pct.resync {
+		pct.configurator.assignments = make(map[podmodel.ID][]int)
+	}
+	for pod := range pct.config {
+		if targets, assigned := pct.assignments[pod]; assigned {
+			pct.configurator.assignments[pod] = targets
+		} else {
+			delete(pct.configurator.assignments, pod)
+		}
+	}
+	if pct.provenance != nil {
+		if pct.resync {
+			pct.configurator.provenance = make(map[podmodel.ID][]ProvenanceRecord)
+		}
+		for pod, records := range pct.provenance {
+			if len(records) > 0 {
+				pct.configurator.provenance[pod] = records
+			} else {
+				delete(pct.configurator.provenance, pod)
 			}
 		}
 	}
-	if pct.configurator.parallelRendering {
-		for i := 0; i < len(rendererTxns); i++ {
-			err := <-rndrChan
-			if err != nil {
-				wasError = err
+
+	pct.configurator.scheduleExpiration()
+	pct.configurator.setLastCommitStatus(wasError)
+	if audit != nil {
+		pct.configurator.recordAudit(audit)
+	}
+	if metrics != nil {
+		pct.configurator.recordMetrics(metrics)
+	}
+	if len(ruleChanges) > 0 {
+		pct.configurator.publishRuleChanges(ruleChanges)
+	}
+	return wasError
+}
+
+// effectivePolicies returns the policies of the pod to generate the rules
+// from: ordered, with the matches of the base policies merged in, without
+// the disabled ones, those gated by the pod labels, those scoped to other
+// nodes and the deactivated exclusive ones, without the ingress matches
+// of those waiting for the pod readiness, and with the implicit ones added.
+func (pct *PolicyConfiguratorTxn) effectivePolicies(pod podmodel.ID, unorderedPolicies ContivPolicies) ContivPolicies {
+	// Sort policies to get the same outcome for the same set.
+	policies := unorderedPolicies.Copy()
+	sort.Sort(policies)
+	policies = pct.configurator.inheritedPolicies(policies)
+	policies = enabledPolicies(policies)
+	policies = pct.gatedPolicies(pod, policies)
+	policies = pct.nodeScopedPolicies(pod, policies)
+	policies = pct.readyPolicies(pod, policies)
+	policies = pct.activeExclusivePolicies(pod, policies)
+	return pct.configurator.implicitPolicies(pod, policies)
+}
+
+// applyRemovedSources filters out policies of sources removed by RemoveBySource()
+// from both the transaction and the committed configuration.
+func (pct *PolicyConfiguratorTxn) applyRemovedSources() {
+	if len(pct.removedSources) == 0 {
+		return
+	}
+	if !pct.resync {
+		// Pull affected committed pods into the transaction.
+		for pod, policies := range pct.configurator.config {
+			if _, configured := pct.config[pod]; !configured && pct.hasRemovedSource(policies) {
+				pct.config[pod] = policies
+			}
+		}
+		for pod, policies := range pct.configurator.skippedPods {
+			if _, configured := pct.config[pod]; !configured && pct.hasRemovedSource(policies) {
+				pct.config[pod] = policies
 			}
 		}
 	}
+	for pod, policies := range pct.config {
+		if !pct.hasRemovedSource(policies) {
+			continue
+		}
+		filtered := ContivPolicies{}
+		for _, policy := range policies {
+			if !pct.isRemovedSource(policy.Source) {
+				filtered = append(filtered, policy)
+			}
+		}
+		pct.Log.WithFields(logging.Fields{
+			"pod":       pct.configurator.logPod(pod),
+			"removed":   len(policies) - len(filtered),
+			"remaining": len(filtered),
+		}).Debug("Removed policies by source")
+		pct.config[pod] = filtered
+	}
+}
 
-	// Save changes to the configurator.
-	pct.configurator.podIPAddresses = pct.podIPAddresses.Copy()
+// hasRemovedSource returns true if any of the policies comes from a source
+// removed by RemoveBySource().
+func (pct *PolicyConfiguratorTxn) hasRemovedSource(policies ContivPolicies) bool {
+	for _, policy := range policies {
+		if pct.isRemovedSource(policy.Source) {
+			return true
+		}
+	}
+	return false
+}
 
-	return wasError
+// isRemovedSource returns true if the source was removed by RemoveBySource().
+func (pct *PolicyConfiguratorTxn) isRemovedSource(source string) bool {
+	for _, removed := range pct.removedSources {
+		if removed == source {
+			return true
+		}
+	}
+	return false
 }
 
 // PeerPod represents the opposite pod in the policy rule.
@@ -249,187 +886,303 @@ type PeerPod struct {
 // Generate a list of ingress or egress rules implementing a given list of policies.
 func (pct *PolicyConfiguratorTxn) generateRules(direction MatchType, policies ContivPolicies) ContivRules {
 	rules := ContivRules{}
-	hasPolicy := false
-	allAllowed := false
+	priorities := []int{}                      // priorities of the policies of the rules
+	restricted := make(map[AddressFamily]bool) // families restricted by policies
+	allowed := make(map[AddressFamily]bool)    // families with all traffic allowed
+	endCoalescing := pct.startCoalescing()
+	for _, policy := range pct.configurator.precedenceOrdered(policies) {
+		rules = pct.appendPolicyRules(rules, direction, policy, restricted, allowed)
+		for len(priorities) < len(rules) {
+			priorities = append(priorities, policy.Priority)
+		}
+	}
+	endCoalescing()
+	rules, denyRest := pct.appendInjectedRules(rules, direction, restricted, allowed)
+	for len(priorities) < len(rules) {
+		priorities = append(priorities, 0)
+	}
 
-	for _, policy := range policies {
-		if (policy.Type == PolicyIngress && direction == MatchEgress) ||
-			(policy.Type == PolicyEgress && direction == MatchIngress) {
-			// Policy does not apply to this direction.
+	orderedRules := rules
+	if denyRest {
+		// deny-the-rest stays the last
+		orderedRules = rules[:len(rules)-1]
+	}
+	if hasDenyMatch(policies) {
+		pct.configurator.orderByPrecedence(orderedRules, priorities)
+	} else if pct.configurator.ruleOrdering == SpecificityFirst {
+		sortBySpecificity(orderedRules)
+	}
+	pct.trace(traceDirectionRules, logging.Fields{
+		"direction": direction,
+		"rules":     rules,
+	})
+	return rules
+}
+
+// appendPolicyRules appends rules implementing the given policy for the given
+// direction into the list. Address families restricted by the policy
+// and those fully allowed by the policy are marked in the given maps.
+func (pct *PolicyConfiguratorTxn) appendPolicyRules(rules ContivRules, direction MatchType, policy *ContivPolicy,
+	restricted, allowed map[AddressFamily]bool) ContivRules {
+
+	if (policy.Type == PolicyIngress && direction == MatchEgress) ||
+		(policy.Type == PolicyEgress && direction == MatchIngress) {
+		// Policy does not apply to this direction.
+		return rules
+	}
+	pct.trace(tracePolicy, logging.Fields{
+		"direction": direction,
+		"policy":    policy.ID,
+		"type":      policy.Type,
+	})
+	for _, family := range policy.AddressFamily.families() {
+		restricted[family] = true
+	}
+
+	for matchIdx, match := range policy.Matches {
+		if match.Type != direction || pct.isCoalesced(policy.AddressFamily, match) {
 			continue
 		}
-		hasPolicy = true
-
-		for _, match := range policy.Matches {
-			if match.Type != direction {
+		pct.origin = RuleContributor{Policy: policy.ID, MatchIndex: matchIdx, Pinned: policy.Pinned}
+		attrs := ruleAttrs{
+			direction: direction,
+			family:    policy.AddressFamily,
+			network:   match.Network,
+			rateLimit: rendererRateSpec(match.RateLimit),
+			connRate:  rendererConnRateSpec(match.ConnRateLimit),
+			packetLen: rendererLenRange(match.PacketLen),
+			l7:        rendererL7Match(match.L7),
+			tcpFlags:  rendererTCPFlagMatch(match.TCPFlags),
+			tunnelVNI: rendererTunnelVNI(match.TunnelVNI),
+			srcPorts:  match.SourcePorts,
+			descr:     match.Description,
+			deny:      match.Action == MatchDeny,
+		}
+		if attrs.descr == "" {
+			attrs.descr = policy.Description
+		}
+		pct.trace(traceMatch, logging.Fields{
+			"direction": direction,
+			"policy":    policy.ID,
+			"match":     match,
+		})
+		if len(match.PortSets) > 0 {
+			match.Ports = pct.configurator.expandPortSets(match)
+			if len(match.Ports) == 0 {
+				pct.Log.WithFields(logging.Fields{
+					"policy":   policy.ID,
+					"portSets": match.PortSets,
+				}).Warn("Match references port-sets without any ports, skipping")
+				continue
+			}
+		}
+		if match.Action == MatchAllow && len(match.Ports) == 0 &&
+			pct.configurator.allowedProtocols != nil {
+			match.Ports = pct.configurator.allowedProtocolPorts()
+			if len(match.Ports) == 0 {
+				pct.Log.WithField("policy", policy.ID).
+					Warn("Match without ports while no protocol is allowed, skipping")
 				continue
 			}
+		}
+		numRules := len(rules)
 
-			// Collect IP addresses of all pod peers.
-			peers := []PeerPod{}
-			for _, peer := range match.Pods {
-				found, peerData := pct.configurator.Cache.LookupPod(peer)
-				if !found {
-					pct.Log.WithField("peer", peer).Warn("Peer pod data not found in the cache")
-					continue
-				}
-				if peerData.IpAddress == "" {
-					pct.Log.WithField("peer", peer).Warn("Peer pod has no IP address assigned")
-					continue
-				}
-				peerIPNet := utils.GetOneHostSubnet(peerData.IpAddress)
-				if peerIPNet == nil {
-					pct.Log.WithFields(logging.Fields{
-						"peer": peer,
-						"ip":   peerData.IpAddress}).Warn("Peer pod has invalid IP address assigned")
-					continue
-				}
-				peers = append(peers, PeerPod{ID: peer, IPNet: peerIPNet})
+		// Collect IP addresses of all pod peers.
+		peers := []PeerPod{}
+		for _, peer := range pct.peerPods(match) {
+			found, peerData := pct.configurator.Cache.LookupPod(peer)
+			pct.trace(tracePeerLookup, logging.Fields{
+				"peer":  pct.configurator.logPod(peer),
+				"found": found,
+				"ip":    peerData.GetIpAddress(),
+			})
+			if !found {
+				pct.logUnknownPeer(peer, "not found in the cache")
+				continue
 			}
+			if peerData.IpAddress == "" {
+				pct.logUnknownPeer(peer, "no IP address assigned")
+				continue
+			}
+			peerIPNet := pct.configurator.hostSubnet(peerData.IpAddress)
+			if peerIPNet == nil {
+				pct.Log.WithFields(logging.Fields{
+					"peer": pct.configurator.logPod(peer),
+					"ip":   peerData.IpAddress}).Warn("Peer pod has invalid IP address assigned")
+				continue
+			}
+			peers = append(peers, PeerPod{ID: peer, IPNet: peerIPNet})
+		}
+		sortPeerPods(peers)
 
-			// Collect all subnets from IPBlocks.
-			allSubnets := []*net.IPNet{}
-			for _, block := range match.IPBlocks {
-				subnets := []*net.IPNet{&block.Network}
-				for _, except := range block.Except {
-					subtracted := []*net.IPNet{}
-					for _, subnet := range subnets {
-						subtracted = append(subtracted, subtractSubnet(subnet, &except)...)
-					}
-					subnets = subtracted
-				}
-				allSubnets = append(allSubnets, subnets...)
+		// Collect all masked networks from IPMasks.
+		allSubnets := []*net.IPNet{}
+		for _, mask := range match.IPMasks {
+			allSubnets = append(allSubnets, mask.Network())
+		}
+
+		// Collect IP addresses resolved for FQDNs.
+		for _, fqdn := range match.FQDNs {
+			for _, ip := range pct.configurator.resolveFQDN(fqdn) {
+				allSubnets = append(allSubnets, utils.GetOneHostSubnetFromIP(ip))
 			}
+		}
 
-			// Handle undefined set of pods and IP blocks.
-			// = match anything on L3
-			if match.Pods == nil && match.IPBlocks == nil {
-				if len(match.Ports) == 0 {
-					// = match anything on L3 & L4
-					ruleAny := &renderer.ContivRule{
-						Action:      renderer.ActionPermit,
-						SrcNetwork:  &net.IPNet{},
-						DestNetwork: &net.IPNet{},
-						Protocol:    renderer.ANY,
-						SrcPort:     0,
-						DestPort:    0,
-					}
-					rules = pct.appendRules(rules, ruleAny)
-					allAllowed = true
-				} else {
-					// = match by L4
-					for _, port := range match.Ports {
-						rule := &renderer.ContivRule{
-							Action:      renderer.ActionPermit,
-							SrcNetwork:  &net.IPNet{},
-							DestNetwork: &net.IPNet{},
-							SrcPort:     0,
-							DestPort:    port.Number,
-						}
-						if port.Protocol == TCP {
-							rule.Protocol = renderer.TCP
-						} else {
-							rule.Protocol = renderer.UDP
-						}
-						rules = pct.appendRules(rules, rule)
+		// Handle undefined set of peers.
+		// = match anything on L3
+		if match.matchesAnyPeer() {
+			if len(match.Ports) == 0 {
+				// = match anything on L3 (& L4 unless restricted otherwise)
+				ruleAny := &renderer.ContivRule{
+					Action:      renderer.ActionPermit,
+					SrcNetwork:  &net.IPNet{},
+					DestNetwork: &net.IPNet{},
+					Protocol:    renderer.ANY,
+					SrcPort:     0,
+					DestPort:    0,
+				}
+				rules = pct.appendRules(rules, attrs, ruleAny)
+				if match.allowsAllTraffic() {
+					for _, family := range policy.AddressFamily.families() {
+						allowed[family] = true
 					}
 				}
-			}
-
-			// Combine pod peers with ports.
-			for _, peer := range peers {
-				if len(match.Ports) == 0 {
-					// Match all ports.
-					// = match by L3
-					ruleAny := &renderer.ContivRule{
+			} else {
+				// = match by L4
+				for _, port := range match.Ports {
+					rule := &renderer.ContivRule{
 						Action:      renderer.ActionPermit,
-						Protocol:    renderer.ANY,
 						SrcNetwork:  &net.IPNet{},
 						DestNetwork: &net.IPNet{},
 						SrcPort:     0,
-						DestPort:    0,
+						DestPort:    port.Number,
 					}
-					if direction == MatchIngress {
-						ruleAny.SrcNetwork = peer.IPNet
+					if port.Protocol == TCP {
+						rule.Protocol = renderer.TCP
 					} else {
-						ruleAny.DestNetwork = peer.IPNet
-					}
-					rules = pct.appendRules(rules, ruleAny)
-				} else {
-					// Combine each port with the peer.
-					// = match by L3 & L4
-					for _, port := range match.Ports {
-						rule := &renderer.ContivRule{
-							Action:      renderer.ActionPermit,
-							SrcNetwork:  &net.IPNet{},
-							DestNetwork: &net.IPNet{},
-							SrcPort:     0,
-							DestPort:    port.Number,
-						}
-						if direction == MatchIngress {
-							rule.SrcNetwork = peer.IPNet
-						} else {
-							rule.DestNetwork = peer.IPNet
-						}
-						if port.Protocol == TCP {
-							rule.Protocol = renderer.TCP
-						} else {
-							rule.Protocol = renderer.UDP
-						}
-						rules = pct.appendRules(rules, rule)
+						rule.Protocol = renderer.UDP
 					}
+					rules = pct.appendRules(rules, attrs, rule)
 				}
 			}
+		}
 
-			// Combine IPBlocks with ports.
-			for _, subnet := range allSubnets {
-				if len(match.Ports) == 0 {
-					// Handle IPBlock with no ports.
-					// = match by L3
-					ruleAny := &renderer.ContivRule{
+		// Combine pod peers with ports.
+		for _, peerNet := range pct.configurator.peerNetworks(peers) {
+			if len(match.Ports) == 0 {
+				// Match all ports.
+				// = match by L3
+				ruleAny := &renderer.ContivRule{
+					Action:      renderer.ActionPermit,
+					Protocol:    renderer.ANY,
+					SrcNetwork:  &net.IPNet{},
+					DestNetwork: &net.IPNet{},
+					SrcPort:     0,
+					DestPort:    0,
+				}
+				if direction == MatchIngress {
+					ruleAny.SrcNetwork = peerNet
+				} else {
+					ruleAny.DestNetwork = peerNet
+				}
+				rules = pct.appendRules(rules, attrs, ruleAny)
+			} else {
+				// Combine each port with the peer.
+				// = match by L3 & L4
+				for _, port := range match.Ports {
+					rule := &renderer.ContivRule{
 						Action:      renderer.ActionPermit,
-						Protocol:    renderer.ANY,
 						SrcNetwork:  &net.IPNet{},
 						DestNetwork: &net.IPNet{},
 						SrcPort:     0,
-						DestPort:    0,
+						DestPort:    port.Number,
 					}
 					if direction == MatchIngress {
-						ruleAny.SrcNetwork = subnet
+						rule.SrcNetwork = peerNet
 					} else {
-						ruleAny.DestNetwork = subnet
+						rule.DestNetwork = peerNet
 					}
-					rules = pct.appendRules(rules, ruleAny)
-				} else {
-					// Combine each port with the block.
-					// = match by L3 & L4
-					for _, port := range match.Ports {
-						rule := &renderer.ContivRule{
-							Action:      renderer.ActionPermit,
-							SrcNetwork:  &net.IPNet{},
-							DestNetwork: &net.IPNet{},
-							SrcPort:     0,
-							DestPort:    port.Number,
-						}
-						if direction == MatchIngress {
-							rule.SrcNetwork = subnet
-						} else {
-							rule.DestNetwork = subnet
-						}
-						if port.Protocol == TCP {
-							rule.Protocol = renderer.TCP
-						} else {
-							rule.Protocol = renderer.UDP
-						}
-						rules = pct.appendRules(rules, rule)
+					if port.Protocol == TCP {
+						rule.Protocol = renderer.TCP
+					} else {
+						rule.Protocol = renderer.UDP
 					}
+					rules = pct.appendRules(rules, attrs, rule)
 				}
 			}
 		}
+
+		// Combine IPBlocks with ports.
+		for _, block := range match.IPBlocks {
+			block = canonicalBlock(block)
+			if family, allowsAll := allowsFamily(block); allowsAll && match.allowsAllTraffic() &&
+				(attrs.family == AddressFamilyBoth || attrs.family == family) {
+				// = match anything of the family on L3 & L4
+				allowed[family] = true
+			}
+			rules = pct.appendRules(rules, attrs, blockRules(direction, block, match.Ports)...)
+		}
+
+		// Combine IPMasks and FQDNs with ports.
+		for _, subnet := range allSubnets {
+			rules = pct.appendRules(rules, attrs, subnetRules(direction, subnet, match.Ports)...)
+		}
+
+		// Expand reference to the API server.
+		if match.APIServerRef {
+			rules = pct.appendRules(rules, attrs, pct.apiServerRules(direction, match.Ports)...)
+		}
+
+		// Expand references to the cluster pod network and to the outside of it.
+		if match.ClusterPodsRef || match.ExternalRef {
+			rules = pct.appendRules(rules, attrs, pct.clusterPodsRules(direction, match)...)
+		}
+
+		// Generate rules for fragments of the traffic selected by the match.
+		if match.Fragments != AnyFragments {
+			fragments := match.Fragments
+			if attrs.deny {
+				// fragments of denied traffic are never allowed
+				fragments = DenyFragments
+			}
+			rules = pct.insertFragmentRules(rules, numRules, fragments)
+		}
+
+		pct.trace(traceMatchRules, logging.Fields{
+			"direction": direction,
+			"policy":    policy.ID,
+			"rules":     rules[numRules:],
+		})
+	}
+	return rules
+}
+
+// appendInjectedRules appends rules implied by the (non-)restricted address
+// families rather than by the policies: rules allowing the NAT-loopback,
+// the cluster DNS and the traffic of non-restricted families followed by
+// the final rule denying the rest. Nothing is appended if all the traffic
+// is allowed. Returns true if deny-the-rest was appended.
+func (pct *PolicyConfiguratorTxn) appendInjectedRules(rules ContivRules, direction MatchType,
+	restricted, allowed map[AddressFamily]bool) (ContivRules, bool) {
+
+	// Injected rules apply to all networks and address families
+	// and are not rate-limited.
+	attrs := ruleAttrs{direction: direction, family: AddressFamilyBoth}
+
+	denyRest := false
+	for family := range restricted {
+		if !allowed[family] {
+			denyRest = true
+		}
 	}
 
-	if hasPolicy && !allAllowed {
+	if denyRest {
+		// Allow traffic of families not restricted by any policy.
+		pct.origin = RuleContributor{MatchIndex: -1, Label: otherFamilyLabel}
+		rules = pct.appendRules(rules, attrs, otherFamilyRules(direction, restricted)...)
+
 		if direction == MatchIngress {
+			pct.origin = RuleContributor{MatchIndex: -1, Label: natLoopbackLabel}
 			// Allow connections from the virtual NAT-loopback (access to service from itself).
 			natLoopIP := pct.configurator.Contiv.GetNatLoopbackIP()
 			ruleAny := &renderer.ContivRule{
@@ -440,9 +1193,16 @@ func (pct *PolicyConfiguratorTxn) generateRules(direction MatchType, policies Co
 				SrcPort:     0,
 				DestPort:    0,
 			}
-			rules = pct.appendRules(rules, ruleAny)
+			rules = pct.appendRules(rules, attrs, ruleAny)
+		} else {
+			// Allow name resolution via the cluster DNS service.
+			pct.origin = RuleContributor{MatchIndex: -1, Label: clusterDNSLabel}
+			dnsAttrs := attrs
+			dnsAttrs.descr = clusterDNSLabel
+			rules = pct.appendRules(rules, dnsAttrs, pct.clusterDNSRules()...)
 		}
 		// Deny the rest.
+		pct.origin = RuleContributor{MatchIndex: -1, Label: denyRestLabel}
 		ruleNone := &renderer.ContivRule{
 			Action:      renderer.ActionDeny,
 			SrcNetwork:  &net.IPNet{},
@@ -451,31 +1211,146 @@ func (pct *PolicyConfiguratorTxn) generateRules(direction MatchType, policies Co
 			SrcPort:     0,
 			DestPort:    0,
 		}
-		rules = pct.appendRules(rules, ruleNone)
+		rules = pct.appendRules(rules, attrs, ruleNone)
 	}
 
+	return rules, denyRest
+}
+
+// subnetRules returns rules allowing traffic with a given subnet on the given
+// ports (all ports if the list is empty).
+func subnetRules(direction MatchType, subnet *net.IPNet, ports []Port) ContivRules {
+	rules := ContivRules{}
+	if len(ports) == 0 {
+		// Handle subnet with no ports.
+		// = match by L3
+		ruleAny := &renderer.ContivRule{
+			Action:      renderer.ActionPermit,
+			Protocol:    renderer.ANY,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: &net.IPNet{},
+			SrcPort:     0,
+			DestPort:    0,
+		}
+		if direction == MatchIngress {
+			ruleAny.SrcNetwork = subnet
+		} else {
+			ruleAny.DestNetwork = subnet
+		}
+		return append(rules, ruleAny)
+	}
+
+	// Combine each port with the subnet.
+	// = match by L3 & L4
+	for _, port := range ports {
+		rule := &renderer.ContivRule{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: &net.IPNet{},
+			SrcPort:     0,
+			DestPort:    port.Number,
+		}
+		if direction == MatchIngress {
+			rule.SrcNetwork = subnet
+		} else {
+			rule.DestNetwork = subnet
+		}
+		if port.Protocol == TCP {
+			rule.Protocol = renderer.TCP
+		} else {
+			rule.Protocol = renderer.UDP
+		}
+		rules = append(rules, rule)
+	}
 	return rules
 }
 
+// ruleAttrs are the attributes of the policy match being processed by
+// generateRules, applied by appendRule to every rule generated from the match.
+type ruleAttrs struct {
+	direction MatchType
+	family    AddressFamily
+	network   string
+	rateLimit *renderer.RateSpec
+	connRate  *renderer.ConnRateSpec
+	packetLen *renderer.LenRange
+	l7        *renderer.L7Match
+	tcpFlags  *renderer.TCPFlagMatch
+	tunnelVNI *uint32
+	srcPorts  []Port
+	descr     string
+	deny      bool
+}
+
 // Append rule into the list if it is not there already.
-func (pct *PolicyConfiguratorTxn) appendRule(rules []*renderer.ContivRule, newRule *renderer.ContivRule) []*renderer.ContivRule {
+// The rule is scoped to the network (and limited by the rate limit) of the match
+// and to the address family of the policy, as given by the attributes. With
+// source ports in the match, one rule per (compatible) source port is appended
+// instead. TCP rules are restricted by the TCP flags of the match.
+func (pct *PolicyConfiguratorTxn) appendRule(rules []*renderer.ContivRule, attrs ruleAttrs, newRule *renderer.ContivRule) []*renderer.ContivRule {
+	if !attrs.scopeToFamily(newRule) {
+		pct.Log.WithFields(logging.Fields{
+			"rule":   newRule,
+			"family": attrs.family,
+		}).Debug("Skipping rule of other address family")
+		return rules
+	}
+	newRule.Network = attrs.network
+	newRule.RateLimit = attrs.rateLimit
+	newRule.ConnRateLimit = attrs.connRate
+	newRule.PacketLen = attrs.packetLen
+	newRule.L7 = attrs.l7
+	newRule.TunnelVNI = attrs.tunnelVNI
+	newRule.Description = attrs.descr
+	if attrs.deny {
+		newRule.Action = renderer.ActionDeny
+	}
+	if len(attrs.srcPorts) > 0 {
+		for _, srcPortRule := range sourcePortRules(newRule, attrs.srcPorts) {
+			attrs.restrictTCPFlags(srcPortRule)
+			rules = pct.appendUniqueRule(rules, srcPortRule)
+		}
+		return rules
+	}
+	attrs.restrictTCPFlags(newRule)
+	return pct.appendUniqueRule(rules, newRule)
+}
+
+// appendUniqueRule appends the rule into the list unless it is already there.
+func (pct *PolicyConfiguratorTxn) appendUniqueRule(rules []*renderer.ContivRule, newRule *renderer.ContivRule) []*renderer.ContivRule {
 	for _, rule := range rules {
 		if rule.Compare(newRule) == 0 {
 			pct.Log.WithField("rule", newRule).Debug("Skipping duplicate rule")
+			pct.addContributor(rule)
 			return rules
 		}
 	}
+	pct.addContributor(newRule)
 	return append(rules, newRule)
 }
 
 // Append rules into the list. Skip those which are already there.
-func (pct *PolicyConfiguratorTxn) appendRules(rules []*renderer.ContivRule, newRules ...*renderer.ContivRule) []*renderer.ContivRule {
+func (pct *PolicyConfiguratorTxn) appendRules(rules []*renderer.ContivRule, attrs ruleAttrs, newRules ...*renderer.ContivRule) []*renderer.ContivRule {
 	for _, newRule := range newRules {
-		rules = pct.appendRule(rules, newRule)
+		rules = pct.appendRule(rules, attrs, newRule)
 	}
 	return rules
 }
 
+// matchesAnyPeer returns true if the match does not restrict peers on L3.
+func (m Match) matchesAnyPeer() bool {
+	return m.Pods == nil && m.IPBlocks == nil && m.IPMasks == nil && m.FQDNs == nil && !m.APIServerRef &&
+		!m.ClusterPodsRef && !m.ExternalRef && m.NamespaceSelector == nil && m.PodNamePatterns == nil
+}
+
+// allowsAllTraffic returns true if the match allows the traffic of the selected
+// peers and does not restrict it on L4, by packet length, fragmentation, on L7
+// or by the tunnel.
+func (m Match) allowsAllTraffic() bool {
+	return m.Action == MatchAllow && len(m.Ports) == 0 && len(m.PortSets) == 0 && len(m.SourcePorts) == 0 && m.PacketLen == nil && m.L7 == nil &&
+		m.Fragments != DenyFragments && m.TunnelVNI == nil
+}
+
 // Copy creates a shallow copy of ContivPolicies.
 func (cp ContivPolicies) Copy() ContivPolicies {
 	cpCopy := make(ContivPolicies, len(cp))
@@ -484,12 +1359,30 @@ func (cp ContivPolicies) Copy() ContivPolicies {
 }
 
 // Equals returns true for equal lists of policies.
+// Policies with the same ID may be contributed by different sources with
+// different content, therefore unless both lists refer to the same instance,
+// the policies are compared by their source and content as well.
 func (cp ContivPolicies) Equals(cp2 ContivPolicies) bool {
+	if !cp.sameIdentities(cp2) {
+		return false
+	}
+	for idx, policy := range cp {
+		if policy != cp2[idx] && policy.String() != cp2[idx].String() {
+			return false
+		}
+	}
+	return true
+}
+
+// sameIdentities returns true if both lists contain policies with the same
+// IDs and sources in the same order, no matter their content.
+func (cp ContivPolicies) sameIdentities(cp2 ContivPolicies) bool {
 	if len(cp) != len(cp2) {
 		return false
 	}
 	for idx, policy := range cp {
-		if policy.ID != cp2[idx].ID {
+		policy2 := cp2[idx]
+		if policy.ID != policy2.ID || policy.Source != policy2.Source || policy.notReady != policy2.notReady {
 			return false
 		}
 	}
@@ -506,17 +1399,20 @@ func (cp ContivPolicies) Swap(i, j int) {
 	cp[i], cp[j] = cp[j], cp[i]
 }
 
-// Less compares two policies by their IDs.
+// Less compares two policies by their IDs. Policies with the same ID
+// (from different sources) are ordered by the source and then by their
+// string representation, so that the order never depends on the input order.
 func (cp ContivPolicies) Less(i, j int) bool {
-	if cp[i].ID.Namespace < cp[j].ID.Namespace {
-		return true
+	if cp[i].ID.Namespace != cp[j].ID.Namespace {
+		return cp[i].ID.Namespace < cp[j].ID.Namespace
 	}
-	if cp[i].ID.Namespace == cp[j].ID.Namespace {
-		if cp[i].ID.Name < cp[j].ID.Name {
-			return true
-		}
+	if cp[i].ID.Name != cp[j].ID.Name {
+		return cp[i].ID.Name < cp[j].ID.Name
 	}
-	return false
+	if cp[i].Source != cp[j].Source {
+		return cp[i].Source < cp[j].Source
+	}
+	return cp[i].String() < cp[j].String()
 }
 
 // Copy creates a deep copy of ContivRules.
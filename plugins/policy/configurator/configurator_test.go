@@ -49,6 +49,50 @@ func parseIPNet(addr string) net.IPNet {
 	return *network
 }
 
+func ipNetwork(addr string) *net.IPNet {
+	if addr == "" {
+		return &net.IPNet{}
+	}
+	network := parseIPNet(addr)
+	return &network
+}
+
+// sameRuleList returns true if both lists are backed by the same array
+// of rules, i.e. the rules are shared and not just equal.
+func sameRuleList(rules1, rules2 []*rendererAPI.ContivRule) bool {
+	if len(rules1) != len(rules2) {
+		return false
+	}
+	return len(rules1) == 0 || &rules1[0] == &rules2[0]
+}
+
+// expectSharedRules asserts that the renderer was given the very same
+// (non-empty) instances of rule lists for both pods.
+func expectSharedRules(renderer *MockRenderer, pod1, pod2 podmodel.ID) {
+	pod1Ingress, pod1Egress := renderer.GetRules(pod1)
+	pod2Ingress, pod2Egress := renderer.GetRules(pod2)
+	gomega.Expect(len(pod1Ingress) + len(pod1Egress)).ToNot(gomega.BeZero())
+	gomega.Expect(sameRuleList(pod1Ingress, pod2Ingress)).To(gomega.BeTrue(),
+		"ingress rules of %s and %s are not shared", pod1, pod2)
+	gomega.Expect(sameRuleList(pod1Egress, pod2Egress)).To(gomega.BeTrue(),
+		"egress rules of %s and %s are not shared", pod1, pod2)
+}
+
+// expectNotSharedRules asserts that the renderer was given equal but distinct
+// instances of rule lists (and rules) for both pods.
+func expectNotSharedRules(renderer *MockRenderer, pod1, pod2 podmodel.ID) {
+	pod1Ingress, pod1Egress := renderer.GetRules(pod1)
+	pod2Ingress, pod2Egress := renderer.GetRules(pod2)
+	gomega.Expect(pod1Ingress).To(gomega.Equal(pod2Ingress))
+	gomega.Expect(pod1Egress).To(gomega.Equal(pod2Egress))
+	for idx := range pod1Ingress {
+		gomega.Expect(pod1Ingress[idx]).ToNot(gomega.BeIdenticalTo(pod2Ingress[idx]))
+	}
+	for idx := range pod1Egress {
+		gomega.Expect(pod1Egress[idx]).ToNot(gomega.BeIdenticalTo(pod2Egress[idx]))
+	}
+}
+
 func TestSinglePolicySinglePod(t *testing.T) {
 	gomega.RegisterTestingT(t)
 	logger := logrus.DefaultLogger()
@@ -1739,3 +1783,285 @@ func TestMultiplePodsSpecialCases(t *testing.T) {
 		parseIP(natLoopbackIP), parseIP(pod1IP), rendererAPI.OTHER, 0, 0)
 	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
 }
+
+func TestSinglePolicyWithIPMaskSinglePod(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSinglePolicyWithIPMaskSinglePod")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod1IP    = "192.168.1.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+
+	// non-contiguous mask: 10.*.*.1
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				IPMasks: []IPMask{
+					{
+						Address: net.ParseIP("10.1.2.1"),
+						Mask:    net.IPv4Mask(255, 0, 0, 255),
+					},
+				},
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+	pod1Policies := []*ContivPolicy{policy1}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	renderer.SetCapabilities(rendererAPI.MaskedMatch)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, pod1Policies)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Allowed by policy1.
+	action := renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP("10.5.6.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP("10.200.0.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Blocked by policy1 - masked bits do not match.
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP("10.5.6.2"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP("11.5.6.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Blocked by policy1 - port not allowed.
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP("10.5.6.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Renderer without the masked-match capability cannot render the policy.
+	renderer2 := NewMockRenderer("B", logger)
+	err = configurator.RegisterRenderer(renderer2)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, pod1Policies)
+	err = txn.Commit()
+	gomega.Expect(err).ToNot(gomega.BeNil())
+
+	action = renderer2.TestTraffic(pod1, EgressTraffic,
+		parseIP("10.5.6.2"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+}
+
+func TestRuleSharing(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRuleSharing")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 8080},
+				},
+			},
+		},
+	}
+	policies := []*ContivPolicy{policy1, policy2}
+
+	// The same set of policies, but ordered differently and with distinct instances.
+	policy1Copy := *policy1
+	policy2Copy := *policy2
+	equalPolicies := []*ContivPolicy{&policy2Copy, &policy1Copy}
+
+	for _, shared := range []bool{true, false} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer := NewMockRenderer("A", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithSharedRules(shared))
+
+		// Register one renderer.
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, policies)
+		txn.Configure(pod2, equalPolicies)
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+
+		_, pod1Egress := renderer.GetRules(pod1)
+		_, pod2Egress := renderer.GetRules(pod2)
+		gomega.Expect(pod1Egress).ToNot(gomega.BeEmpty())
+		gomega.Expect(pod1Egress).To(gomega.Equal(pod2Egress))
+		if shared {
+			gomega.Expect(pod1Egress[0]).To(gomega.BeIdenticalTo(pod2Egress[0]))
+			expectSharedRules(renderer, pod1, pod2)
+			continue
+		}
+		gomega.Expect(pod1Egress[0]).ToNot(gomega.BeIdenticalTo(pod2Egress[0]))
+		expectNotSharedRules(renderer, pod1, pod2)
+
+		// Modify rules of pod1 in-place - pod2 is not affected.
+		for _, rule := range pod1Egress {
+			rule.Action = rendererAPI.ActionDeny
+		}
+		action := renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+		action = renderer.TestTraffic(pod2, EgressTraffic,
+			parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer.TestTraffic(pod2, EgressTraffic,
+			parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 443)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+}
+
+func TestConfiguredPods(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestConfiguredPods")
+
+	// Prepare input data.
+	const (
+		namespace1 = "namespace1"
+		namespace2 = "namespace2"
+		pod1Name   = "pod1"
+		pod2Name   = "pod2"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		pod3IP     = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace2}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace1}
+	pod3 := podmodel.ID{Name: pod1Name, Namespace: namespace1}
+
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace1},
+		Type: PolicyIngress,
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Nothing committed yet.
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.BeEmpty())
+
+	// Configure all pods, uncommitted transaction is not reflected.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	txn.Configure(pod3, []*ContivPolicy{})
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.BeEmpty())
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{pod3, pod2, pod1}))
+
+	// Resync without pod2.
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod3, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{pod3, pod1}))
+}
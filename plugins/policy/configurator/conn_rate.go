@@ -0,0 +1,65 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithStrictConnRateLimits selects how connection rate limits
+// (Match.ConnRateLimit) are handled for renderers without
+// the renderer.ConnRateLimiting capability. By default the limits are not
+// passed to such renderers and the connections are only allowed. With strict
+// connection rate limits, the commit fails instead.
+func WithStrictConnRateLimits(strict bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.strictConnRate = strict
+	}
+}
+
+// rendererConnRateSpec converts connection rate limit of a match into
+// the renderer representation.
+func rendererConnRateSpec(connRateLimit *ConnRateSpec) *renderer.ConnRateSpec {
+	if connRateLimit == nil {
+		return nil
+	}
+	return &renderer.ConnRateSpec{
+		ConnsPerSecond: connRateLimit.ConnsPerSecond,
+		Burst:          connRateLimit.Burst,
+		PerPeer:        connRateLimit.PerPeer,
+	}
+}
+
+// withoutConnRateLimits returns the rules with connection rate limits removed.
+// Rules which become duplicates are skipped. If none of the rules is limited,
+// the same list is returned.
+func withoutConnRateLimits(rules ContivRules) ContivRules {
+	return withoutRuleFeature(rules,
+		func(rule *renderer.ContivRule) bool { return rule.ConnRateLimit != nil },
+		func(rule *renderer.ContivRule) { rule.ConnRateLimit = nil })
+}
+
+// hasConnRateLimits returns true if any of the rules is connection-rate
+// limited.
+func hasConnRateLimits(rules ContivRules) bool {
+	for _, rule := range rules {
+		if rule.ConnRateLimit != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"math"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithConntrackZones enables assignment of per-pod connection tracking zones
+// passed to renderers with the renderer.ConntrackZones capability
+// (see renderer.ZonedTxn and ConntrackZone()).
+func WithConntrackZones() Option {
+	return func(pc *PolicyConfigurator) {
+		pc.conntrackZones = make(map[podmodel.ID]renderer.ConntrackZone)
+		pc.zonesInUse = make(map[renderer.ConntrackZone]podmodel.ID)
+	}
+}
+
+// ConntrackZone returns the connection tracking zone assigned to the pod.
+// The zone is derived from the hash of the pod ID (with collisions resolved
+// by taking the next free zone) and kept for as long as the pod stays
+// configured, i.e. it is stable across commits and distinct for every
+// configured pod. Returns zero for pods without a zone (not configured
+// or WithConntrackZones not enabled).
+func (pc *PolicyConfigurator) ConntrackZone(pod podmodel.ID) renderer.ConntrackZone {
+	pc.Lock()
+	defer pc.Unlock()
+	return pc.conntrackZones[pod]
+}
+
+// assignConntrackZone assigns a zone to the pod if it does not have one yet.
+func (pc *PolicyConfigurator) assignConntrackZone(pod podmodel.ID) {
+	if pc.conntrackZones == nil {
+		return
+	}
+	if _, assigned := pc.conntrackZones[pod]; assigned {
+		return
+	}
+	numZones := uint32(math.MaxUint16) // without zero
+	preferred := podHash(pod) % numZones
+	for probe := uint32(0); probe < numZones; probe++ {
+		zone := renderer.ConntrackZone(1 + (preferred+probe)%numZones)
+		if _, inUse := pc.zonesInUse[zone]; !inUse {
+			pc.conntrackZones[pod] = zone
+			pc.zonesInUse[zone] = pod
+			return
+		}
+	}
+	pc.Log.WithField("pod", pc.logPod(pod)).Warn("No conntrack zone left for the pod")
+}
+
+// releaseConntrackZones releases zones of pods which are no longer configured.
+func (pct *PolicyConfiguratorTxn) releaseConntrackZones() {
+	pc := pct.configurator
+	release := func(pod podmodel.ID) {
+		if _, configured := pc.config[pod]; configured {
+			return
+		}
+		if zone, assigned := pc.conntrackZones[pod]; assigned {
+			delete(pc.zonesInUse, zone)
+			delete(pc.conntrackZones, pod)
+		}
+	}
+	if pct.resync {
+		for pod := range pc.conntrackZones {
+			release(pod)
+		}
+		return
+	}
+	for pod := range pct.config {
+		release(pod)
+	}
+}
+
+// renderConntrackZone passes the zone of the pod into the transaction
+// of the renderer with the given index if it has the capability.
+func (pc *PolicyConfigurator) renderConntrackZone(rTxn renderer.Txn, idx int, pod podmodel.ID) {
+	zone, assigned := pc.conntrackZones[pod]
+	if !assigned || !hasCapability(pc.renderers[idx], renderer.ConntrackZones) {
+		return
+	}
+	zonedTxn, isZoned := rTxn.(renderer.ZonedTxn)
+	if !isZoned {
+		pc.Log.WithField("renderer", idx).Warn(
+			"Renderer advertises conntrack zones without implementing ZonedTxn")
+		return
+	}
+	pc.Log.WithFields(logging.Fields{
+		"pod":  pc.logPod(pod),
+		"zone": zone,
+	}).Debug("Assigning conntrack zone")
+	zonedTxn.SetConntrackZone(pod, zone)
+}
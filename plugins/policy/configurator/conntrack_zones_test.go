@@ -0,0 +1,146 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestConntrackZones(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestConntrackZones")
+
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress allowed on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	zonedRenderer := NewMockRenderer("zoned", logger)
+	zonedRenderer.SetCapabilities(renderer.ConntrackZones)
+	plainRenderer := NewMockRenderer("plain", logger)
+
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithConntrackZones())
+	err := configurator.RegisterRenderer(zonedRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterRenderer(plainRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Distinct zones for different pods.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	zone1 := configurator.ConntrackZone(pod1)
+	zone2 := configurator.ConntrackZone(pod2)
+	gomega.Expect(zone1).ToNot(gomega.BeZero())
+	gomega.Expect(zone2).ToNot(gomega.BeZero())
+	gomega.Expect(zone1).ToNot(gomega.Equal(zone2))
+
+	// Only the renderer with the capability is given the zones.
+	gomega.Expect(zonedRenderer.GetConntrackZone(pod1)).To(gomega.Equal(zone1))
+	gomega.Expect(zonedRenderer.GetConntrackZone(pod2)).To(gomega.Equal(zone2))
+	gomega.Expect(plainRenderer.GetConntrackZone(pod1)).To(gomega.BeZero())
+
+	// The zone is stable across commits.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.ConntrackZone(pod1)).To(gomega.Equal(zone1))
+	gomega.Expect(zonedRenderer.GetConntrackZone(pod1)).To(gomega.Equal(zone1))
+
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.ConntrackZone(pod1)).To(gomega.Equal(zone1))
+	gomega.Expect(configurator.ConntrackZone(pod2)).To(gomega.Equal(zone2))
+	gomega.Expect(zonedRenderer.GetConntrackZone(pod2)).To(gomega.Equal(zone2))
+
+	// The zone of a removed pod is released.
+	cache.AddPodConfig(pod2, "")
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.ConntrackZone(pod2)).To(gomega.BeZero())
+	gomega.Expect(configurator.ConntrackZone(pod1)).To(gomega.Equal(zone1))
+
+	// Zones are not assigned unless enabled.
+	defaultConfigurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	defaultConfigurator.Init(false)
+	err = defaultConfigurator.RegisterRenderer(NewMockRenderer("default", logger))
+	gomega.Expect(err).To(gomega.BeNil())
+	txn = defaultConfigurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(defaultConfigurator.ConntrackZone(pod1)).To(gomega.BeZero())
+}
@@ -0,0 +1,156 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"net"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// ReachabilityContract declares flows which must be allowed and flows which
+// must be denied by the configuration (see CheckContract).
+type ReachabilityContract struct {
+	Requirements []FlowRequirement
+}
+
+// FlowRequirement requires the flows from every source to every destination
+// on the given port to be allowed or denied. Sources and destinations are
+// given as pods and/or IP addresses (e.g. of external endpoints).
+type FlowRequirement struct {
+	// Description is an optional human-readable description
+	// of the requirement, copied into the violations.
+	Description string
+
+	// From lists the sources of the flows.
+	From    []podmodel.ID
+	FromIPs []net.IP
+
+	// To lists the destinations of the flows.
+	To    []podmodel.ID
+	ToIPs []net.IP
+
+	// Port is the destination port of the flows. Port with zero number stands
+	// for any port not selected by port-specific rules.
+	Port Port
+
+	// Allowed selects whether the flows must be allowed (true) or denied.
+	Allowed bool
+}
+
+// ContractViolation describes a flow evaluated contrary to a requirement
+// of the contract.
+type ContractViolation struct {
+	// Requirement is the index of the violated requirement in the contract.
+	Requirement int
+	Description string
+
+	// From and To are the source and the destination pod of the flow
+	// (empty for IP addresses given directly).
+	From podmodel.ID
+	To   podmodel.ID
+	Flow Flow
+
+	// Allowed is the evaluated verdict of the flow.
+	Allowed bool
+}
+
+// String converts ContractViolation into a human-readable string.
+func (cv ContractViolation) String() string {
+	verdict, required := "denied", "allowed"
+	if cv.Allowed {
+		verdict, required = required, verdict
+	}
+	descr := ""
+	if cv.Description != "" {
+		descr = fmt.Sprintf(" (%s)", cv.Description)
+	}
+	return fmt.Sprintf("requirement %d%s: flow %s is %s, required %s",
+		cv.Requirement, descr, cv.Flow, verdict, required)
+}
+
+// contractEndpoint is a source or a destination of the required flows.
+type contractEndpoint struct {
+	pod podmodel.ID
+	ip  net.IP
+}
+
+// CheckContract evaluates the flows required by the contract against
+// the committed configuration (as EvaluateFlow() does) and returns
+// the violations, in the order of the requirements, sources and destinations.
+// Returns an error if a requirement has no sources or destinations, or if any
+// of the pods has no IP address assigned.
+// Neither the configuration nor the rules are modified.
+func (pc *PolicyConfigurator) CheckContract(contract ReachabilityContract) ([]ContractViolation, error) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	violations := []ContractViolation{}
+	for idx, requirement := range contract.Requirements {
+		sources, err := pc.contractEndpoints(requirement.From, requirement.FromIPs)
+		if err != nil {
+			return nil, fmt.Errorf("requirement %d: invalid source: %v", idx, err)
+		}
+		destinations, err := pc.contractEndpoints(requirement.To, requirement.ToIPs)
+		if err != nil {
+			return nil, fmt.Errorf("requirement %d: invalid destination: %v", idx, err)
+		}
+		for _, src := range sources {
+			for _, dst := range destinations {
+				flow := Flow{
+					SrcIP:    src.ip,
+					DstIP:    dst.ip,
+					Protocol: requirement.Port.Protocol,
+					DstPort:  requirement.Port.Number,
+				}
+				allowed := pc.evaluateFlow(flow)
+				if allowed == requirement.Allowed {
+					continue
+				}
+				violations = append(violations, ContractViolation{
+					Requirement: idx,
+					Description: requirement.Description,
+					From:        src.pod,
+					To:          dst.pod,
+					Flow:        flow,
+					Allowed:     allowed,
+				})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// contractEndpoints returns the endpoints for the given pods and IP addresses.
+func (pc *PolicyConfigurator) contractEndpoints(pods []podmodel.ID, ips []net.IP) ([]contractEndpoint, error) {
+	if len(pods) == 0 && len(ips) == 0 {
+		return nil, fmt.Errorf("no pods or IP addresses given")
+	}
+	var endpoints []contractEndpoint
+	for _, pod := range pods {
+		podIP, err := pc.getPodIP(pod)
+		if err != nil {
+			return nil, fmt.Errorf("pod %s: %v", pod, err)
+		}
+		endpoints = append(endpoints, contractEndpoint{pod: pod, ip: podIP})
+	}
+	for _, ip := range ips {
+		endpoints = append(endpoints, contractEndpoint{ip: ip})
+	}
+	return endpoints, nil
+}
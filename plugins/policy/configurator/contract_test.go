@@ -0,0 +1,144 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestCheckContract(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestCheckContract")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		pod3IP     = "192.168.1.3"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	pod3 := podmodel.ID{Name: "pod3", Namespace: namespace}
+
+	// ingress of pod1 allowed only from pod2 on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	contract := ReachabilityContract{
+		Requirements: []FlowRequirement{
+			{
+				Description: "web clients",
+				From:        []podmodel.ID{pod2},
+				To:          []podmodel.ID{pod1},
+				Port:        Port{Protocol: TCP, Number: 80},
+				Allowed:     true,
+			},
+			{
+				Description: "monitoring",
+				From:        []podmodel.ID{pod2, pod3},
+				FromIPs:     []net.IP{net.ParseIP(externalIP)},
+				To:          []podmodel.ID{pod1},
+				Port:        Port{Protocol: TCP, Number: 80},
+				Allowed:     false,
+			},
+		},
+	}
+
+	// Only the flow from pod2 violates the second requirement.
+	violations, err := configurator.CheckContract(contract)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(violations).To(gomega.HaveLen(1))
+	violation := violations[0]
+	gomega.Expect(violation.Requirement).To(gomega.Equal(1))
+	gomega.Expect(violation.Description).To(gomega.Equal("monitoring"))
+	gomega.Expect(violation.From).To(gomega.Equal(pod2))
+	gomega.Expect(violation.To).To(gomega.Equal(pod1))
+	gomega.Expect(violation.Flow.SrcIP.Equal(net.ParseIP(pod2IP))).To(gomega.BeTrue())
+	gomega.Expect(violation.Flow.DstIP.Equal(net.ParseIP(pod1IP))).To(gomega.BeTrue())
+	gomega.Expect(violation.Allowed).To(gomega.BeTrue())
+	gomega.Expect(violation.String()).To(gomega.HavePrefix("requirement 1 (monitoring): flow "))
+	gomega.Expect(violation.String()).To(gomega.HaveSuffix(" is allowed, required denied"))
+
+	// Contract satisfied by the configuration.
+	contract.Requirements[1].From = []podmodel.ID{pod3}
+	violations, err = configurator.CheckContract(contract)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(violations).To(gomega.BeEmpty())
+
+	// Invalid contracts.
+	contract.Requirements[1].From = []podmodel.ID{{Name: "unknown", Namespace: namespace}}
+	_, err = configurator.CheckContract(contract)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	contract.Requirements[1].From = nil
+	contract.Requirements[1].FromIPs = nil
+	_, err = configurator.CheckContract(contract)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+}
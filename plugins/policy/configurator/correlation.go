@@ -0,0 +1,119 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"strings"
+
+	"github.com/ligato/cn-infra/logging"
+)
+
+// WithCorrelationID attaches an ID correlating the transaction with the event
+// that caused it. The ID is added to the logs of the commit (as field
+// "correlationID") and passed with the audit record and the metrics.
+func (pct *PolicyConfiguratorTxn) WithCorrelationID(id string) Txn {
+	pct.correlationIDs = append(pct.correlationIDs, id)
+	pct.Log = &fieldLogger{
+		Logger: pct.configurator.Log,
+		fields: logging.Fields{"correlationID": strings.Join(pct.correlationIDs, ",")},
+	}
+	return pct
+}
+
+// copyStrings returns a copy of the list. Nil list remains nil.
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+// fieldLogger is a logger adding the given fields to every log entry.
+type fieldLogger struct {
+	logging.Logger
+	fields logging.Fields
+}
+
+// WithField creates an entry with the given field and the fields of the logger.
+func (fl *fieldLogger) WithField(key string, value interface{}) logging.LogWithLevel {
+	return fl.WithFields(logging.Fields{key: value})
+}
+
+// WithFields creates an entry with the given fields and the fields of the logger.
+func (fl *fieldLogger) WithFields(fields map[string]interface{}) logging.LogWithLevel {
+	merged := logging.Fields{}
+	for key, value := range fl.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return fl.Logger.WithFields(merged)
+}
+
+// entry creates an entry with the fields of the logger.
+func (fl *fieldLogger) entry() logging.LogWithLevel {
+	return fl.Logger.WithFields(fl.fields)
+}
+
+// Debug logs a message at the debug level.
+func (fl *fieldLogger) Debug(args ...interface{}) { fl.entry().Debug(args...) }
+
+// Debugf logs a formatted message at the debug level.
+func (fl *fieldLogger) Debugf(format string, args ...interface{}) { fl.entry().Debugf(format, args...) }
+
+// Info logs a message at the info level.
+func (fl *fieldLogger) Info(args ...interface{}) { fl.entry().Info(args...) }
+
+// Infof logs a formatted message at the info level.
+func (fl *fieldLogger) Infof(format string, args ...interface{}) { fl.entry().Infof(format, args...) }
+
+// Warn logs a message at the warning level.
+func (fl *fieldLogger) Warn(args ...interface{}) { fl.entry().Warn(args...) }
+
+// Warnf logs a formatted message at the warning level.
+func (fl *fieldLogger) Warnf(format string, args ...interface{}) { fl.entry().Warnf(format, args...) }
+
+// Error logs a message at the error level.
+func (fl *fieldLogger) Error(args ...interface{}) { fl.entry().Error(args...) }
+
+// Errorf logs a formatted message at the error level.
+func (fl *fieldLogger) Errorf(format string, args ...interface{}) { fl.entry().Errorf(format, args...) }
+
+// Fatal logs a message at the fatal level.
+func (fl *fieldLogger) Fatal(args ...interface{}) { fl.entry().Fatal(args...) }
+
+// Fatalf logs a formatted message at the fatal level.
+func (fl *fieldLogger) Fatalf(format string, args ...interface{}) { fl.entry().Fatalf(format, args...) }
+
+// Fatalln logs a message at the fatal level.
+func (fl *fieldLogger) Fatalln(args ...interface{}) { fl.entry().Fatalln(args...) }
+
+// Panic logs a message at the panic level.
+func (fl *fieldLogger) Panic(args ...interface{}) { fl.entry().Panic(args...) }
+
+// Panicf logs a formatted message at the panic level.
+func (fl *fieldLogger) Panicf(format string, args ...interface{}) { fl.entry().Panicf(format, args...) }
+
+// Print logs a message at the info level.
+func (fl *fieldLogger) Print(v ...interface{}) { fl.entry().Print(v...) }
+
+// Printf logs a formatted message at the info level.
+func (fl *fieldLogger) Printf(format string, v ...interface{}) { fl.entry().Printf(format, v...) }
+
+// Println logs a message at the info level.
+func (fl *fieldLogger) Println(v ...interface{}) { fl.entry().Println(v...) }
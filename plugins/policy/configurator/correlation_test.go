@@ -0,0 +1,132 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	lg "github.com/sirupsen/logrus"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// correlationHook collects messages logged with a correlation ID.
+type correlationHook struct {
+	messages map[string][]string // correlation ID -> messages
+}
+
+func (ch *correlationHook) Levels() []lg.Level {
+	return lg.AllLevels
+}
+
+func (ch *correlationHook) Fire(entry *lg.Entry) error {
+	if id, correlated := entry.Data["correlationID"]; correlated {
+		ch.messages[id.(string)] = append(ch.messages[id.(string)], entry.Message)
+	}
+	return nil
+}
+
+func TestCorrelationID(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.NewLogger("correlation-test")
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestCorrelationID")
+	hook := &correlationHook{messages: make(map[string][]string)}
+	logger.AddHook(hook)
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress allowed on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	audit := &auditLog{}
+	metrics := &metricsLog{}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	configurator.RegisterAuditSink(audit)
+	configurator.RegisterMetricsSink(metrics)
+
+	// Commit with a correlation ID.
+	txn := configurator.NewTxn(false).WithCorrelationID("event-1")
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(audit.records).To(gomega.HaveLen(1))
+	gomega.Expect(audit.records[0].CorrelationIDs).To(gomega.Equal([]string{"event-1"}))
+	gomega.Expect(metrics.commits).To(gomega.HaveLen(1))
+	gomega.Expect(metrics.commits[0].CorrelationIDs).To(gomega.Equal([]string{"event-1"}))
+	gomega.Expect(hook.messages["event-1"]).To(gomega.ContainElement("Committing transaction"))
+	ingress1, egress1 := renderer.GetRules(pod1)
+
+	// Commit without a correlation ID.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(audit.records).To(gomega.HaveLen(2))
+	gomega.Expect(audit.records[1].CorrelationIDs).To(gomega.BeNil())
+	gomega.Expect(hook.messages).To(gomega.HaveLen(1))
+
+	// The ID does not affect the rules.
+	ingress2, egress2 := renderer.GetRules(pod2)
+	gomega.Expect(ingress2).To(gomega.Equal(ingress1))
+	gomega.Expect(egress2).To(gomega.Equal(egress1))
+}
@@ -0,0 +1,70 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// RenderCost is the estimated cost of installing the rules of a pod.
+type RenderCost struct {
+	// Rules is the number of rules (ingress + egress) summed across
+	// the estimating renderers.
+	Rules int
+
+	// RuleCost is the cost of the rules summed across the estimating renderers.
+	renderer.RuleCost
+}
+
+// EstimateCost returns the estimated cost of installing the committed rules
+// of the pod into the renderers the pod is assigned to. Only renderers
+// implementing renderer.CostEstimator are considered; the rules are costed
+// in the form the renderer receives them, but in the flat form (i.e.
+// without any sharing of rules between pods done by some renderers).
+// Returns an error if the pod is not configured or if none of its renderers
+// estimates the cost. Neither the configuration nor the renderers are modified.
+func (pc *PolicyConfigurator) EstimateCost(pod podmodel.ID) (RenderCost, error) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	cost := RenderCost{}
+	rules, hasRules := pc.rules[pod]
+	if !hasRules {
+		return cost, fmt.Errorf("pod %s is not configured", pod)
+	}
+	estimated := false
+	for _, idx := range pc.assignments[pod] {
+		estimator, isEstimator := pc.renderers[idx].(renderer.CostEstimator)
+		if !isEstimator {
+			continue
+		}
+		estimated = true
+		for _, ruleList := range []ContivRules{rules.Ingress, rules.Egress} {
+			for _, rule := range pc.rendererRules(pc.renderers[idx], ruleList) {
+				cost.Rules++
+				cost.RuleCost = cost.RuleCost.Add(estimator.EstimateRuleCost(rule))
+			}
+		}
+	}
+	if !estimated {
+		return cost, fmt.Errorf("none of the renderers of pod %s estimates rule costs", pod)
+	}
+	return cost, nil
+}
@@ -0,0 +1,137 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// costRenderer is a mock renderer with a fixed cost per rule.
+type costRenderer struct {
+	*MockRenderer
+	perRule rendererAPI.RuleCost
+}
+
+// EstimateRuleCost returns the fixed per-rule cost.
+func (cr *costRenderer) EstimateRuleCost(rule *rendererAPI.ContivRule) rendererAPI.RuleCost {
+	return cr.perRule
+}
+
+func TestEstimateCost(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestEstimateCost")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress allowed from pod2 on TCP:80 and TCP:443
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}, {Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	estimating := &costRenderer{
+		MockRenderer: NewMockRenderer("A", logger),
+		perRule:      rendererAPI.RuleCost{TableEntries: 2, MemoryBytes: 64},
+	}
+	plain := NewMockRenderer("B", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Without an estimating renderer the cost is not known.
+	err := configurator.RegisterRenderer(plain)
+	gomega.Expect(err).To(gomega.BeNil())
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	_, err = configurator.EstimateCost(pod1)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring("estimates"))
+
+	// Register the estimating renderer and resync.
+	err = configurator.RegisterRenderer(estimating)
+	gomega.Expect(err).To(gomega.BeNil())
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	commits := estimating.GetCommitCount()
+
+	// Only the rules of the estimating renderer are costed.
+	ingress, egress := estimating.GetRules(pod1)
+	numRules := len(ingress) + len(egress)
+	gomega.Expect(numRules).To(gomega.BeNumerically(">", 0))
+	cost, err := configurator.EstimateCost(pod1)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(cost.Rules).To(gomega.Equal(numRules))
+	gomega.Expect(cost.TableEntries).To(gomega.BeEquivalentTo(2 * numRules))
+	gomega.Expect(cost.MemoryBytes).To(gomega.BeEquivalentTo(64 * numRules))
+
+	// Pods not configured cannot be estimated.
+	_, err = configurator.EstimateCost(pod2)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring("not configured"))
+
+	// The estimation is read-only.
+	gomega.Expect(estimating.GetCommitCount()).To(gomega.Equal(commits))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{pod1}))
+}
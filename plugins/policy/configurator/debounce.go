@@ -0,0 +1,114 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"time"
+
+	"github.com/ligato/cn-infra/logging"
+)
+
+// WithCommitDebounce coalesces transactions committed in rapid succession.
+// Commit() only merges the changes into a pending transaction and returns nil,
+// the pending transaction is applied once, the given period after the first
+// of the merged commits. Changes of the same pod collapse into the latest one
+// and a resync replaces everything pending before it. Changes configured after
+// a pending RemoveBySource() are not merged with it, the pending transaction
+// is applied first instead, so that the final state is always the same
+// as if the commits were applied one by one.
+// Errors of the deferred commit are logged and reported by LastCommitStatus().
+// With a maintenance window, the coalesced changes are further deferred
+// by the window. Changes triggered internally from the committed configuration
+// are applied immediately. While the configurator is read-only, the pending
+// changes wait for another period. FlushCommits() applies the pending changes
+// immediately, Close() discards them.
+// The period is measured by the clock of the configurator (see WithClock).
+// Non-positive period disables the debouncing.
+func WithCommitDebounce(period time.Duration) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.debouncePeriod = period
+	}
+}
+
+// FlushCommits applies the changes pending because of WithCommitDebounce
+// immediately.
+func (pc *PolicyConfigurator) FlushCommits() error {
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.readOnly {
+		pc.Log.Warn("Refusing to commit policies, the configurator is read-only")
+		return ErrReadOnly
+	}
+	return pc.flushDebounced()
+}
+
+// commitDebounced implements Commit() with the debouncing configured.
+// The configurator is expected to be locked by the caller.
+func (pct *PolicyConfiguratorTxn) commitDebounced() error {
+	pc := pct.configurator
+	if pc.debounced != nil && len(pc.debounced.removedSources) > 0 &&
+		len(pct.config) > 0 && !pct.resync {
+		// The removal would apply also to the policies configured afterwards.
+		if err := pc.flushDebounced(); err != nil {
+			pct.Log.WithField("err", err).Error("Failed to apply pending changes")
+		}
+	}
+	pc.debounced = pc.mergeTxn(pc.debounced, pct)
+	if pc.debounceTimer == nil {
+		pc.debounceTimer = pc.afterFunc(pc.debouncePeriod, pc.debounceExpired)
+	}
+	return nil
+}
+
+// debounceExpired applies the pending changes when the debounce period ends.
+func (pc *PolicyConfigurator) debounceExpired(generation uint64) {
+	pc.Lock()
+	defer pc.Unlock()
+	if !pc.debounceTimer.owns(generation) {
+		/* cancelled or re-scheduled in the meantime */
+		return
+	}
+	pc.debounceTimer = nil
+
+	if pc.readOnly {
+		pc.Log.Info("Pending changes not applied, the configurator is read-only")
+		pc.debounceTimer = pc.afterFunc(pc.debouncePeriod, pc.debounceExpired)
+		return
+	}
+	if err := pc.flushDebounced(); err != nil {
+		pc.Log.WithField("err", err).Error("Failed to apply coalesced changes")
+	}
+}
+
+// flushDebounced commits the pending changes.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) flushDebounced() error {
+	if pc.debounceTimer != nil {
+		pc.debounceTimer.Stop()
+		pc.debounceTimer = nil
+	}
+	txn := pc.debounced
+	pc.debounced = nil
+	if txn == nil {
+		return nil
+	}
+	pc.Log.WithFields(logging.Fields{
+		"pods":   len(txn.config),
+		"resync": txn.resync,
+	}).Debug("Applying coalesced changes")
+	return txn.commitScheduled()
+}
@@ -0,0 +1,184 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestCommitDebounce(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestCommitDebounce")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		period    = 10 * time.Millisecond
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	newPolicy := func(name, source string, port uint16) *ContivPolicy {
+		return &ContivPolicy{
+			ID:     policymodel.ID{Name: name, Namespace: namespace},
+			Source: source,
+			Type:   PolicyIngress,
+			Matches: []Match{
+				{
+					Type:  MatchIngress,
+					Ports: []Port{{Protocol: TCP, Number: port}},
+				},
+			},
+		}
+	}
+	policy1 := newPolicy("policy1", "", 80)
+	policy2 := newPolicy("policy2", "", 443)
+	policy3 := newPolicy("policy3", "", 8080)
+	policy4 := newPolicy("policy4", "ctrl", 9090)
+
+	// Initialize mocks and configurators, one with and one without debouncing.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	clock := newFakeClock()
+	newConfigurator := func(renderer *MockRenderer, options ...Option) *PolicyConfigurator {
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, append(options, WithClock(clock))...)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator
+	}
+	renderer := NewMockRenderer("A", logger)
+	configurator := newConfigurator(renderer, WithCommitDebounce(period))
+	refRenderer := NewMockRenderer("B", logger)
+	refConfigurator := newConfigurator(refRenderer)
+
+	commit := func(txnFn func(txn Txn)) {
+		for _, pc := range []*PolicyConfigurator{configurator, refConfigurator} {
+			txn := pc.NewTxn(false)
+			txnFn(txn)
+			err := txn.Commit()
+			gomega.Expect(err).To(gomega.BeNil())
+		}
+	}
+	expectSameRules := func(pods ...podmodel.ID) {
+		for _, pod := range pods {
+			ingress, egress := renderer.GetRules(pod)
+			refIngress, refEgress := refRenderer.GetRules(pod)
+			gomega.Expect(ingress).To(gomega.Equal(refIngress))
+			gomega.Expect(egress).To(gomega.Equal(refEgress))
+		}
+	}
+	testTraffic := func(port uint16) TrafficAction {
+		return renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, port)
+	}
+
+	// Three rapid commits to the same pod are applied at once.
+	commit(func(txn Txn) { txn.Configure(pod1, []*ContivPolicy{policy1}) })
+	clock.Advance(time.Millisecond)
+	commit(func(txn Txn) { txn.Configure(pod1, []*ContivPolicy{policy2}) })
+	clock.Advance(time.Millisecond)
+	commit(func(txn Txn) { txn.Configure(pod1, []*ContivPolicy{policy2, policy3}) })
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(0))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.BeEmpty())
+	gomega.Expect(testTraffic(443)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+
+	clock.Advance(period - 2*time.Millisecond)
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(1))
+	gomega.Expect(refRenderer.GetCommitCount()).To(gomega.Equal(3))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{pod1}))
+	gomega.Expect(testTraffic(80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(8080)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	expectSameRules(pod1)
+
+	// Nothing pending, nothing is applied.
+	clock.Advance(period)
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(1))
+
+	// Policies configured after a removal of their source are not removed.
+	commit(func(txn Txn) { txn.Configure(pod2, []*ContivPolicy{policy4}) })
+	commit(func(txn Txn) { txn.RemoveBySource("ctrl") })
+	commit(func(txn Txn) {
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		txn.Configure(pod2, []*ContivPolicy{policy4})
+	})
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(2)) /* removal flushed */
+	clock.Advance(period)
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(3))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{pod1, pod2}))
+	expectSameRules(pod1, pod2)
+
+	// Explicit flush.
+	commit(func(txn Txn) { txn.Configure(pod2, []*ContivPolicy{}) })
+	err := configurator.FlushCommits()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(4))
+	expectSameRules(pod1, pod2)
+
+	// The timer of the flushed changes firing late does not apply changes
+	// merged afterwards.
+	commit(func(txn Txn) { txn.Configure(pod2, []*ContivPolicy{policy2}) })
+	err = configurator.FlushCommits()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(5))
+	commit(func(txn Txn) { txn.Configure(pod2, []*ContivPolicy{}) })
+	clock.FireStopped()
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(5))
+	clock.Advance(period)
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(6))
+	expectSameRules(pod1, pod2)
+
+	// Pending changes are discarded by Close().
+	commit(func(txn Txn) { txn.Configure(pod1, []*ContivPolicy{}) })
+	err = configurator.Close()
+	gomega.Expect(err).To(gomega.BeNil())
+	clock.Advance(period)
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(6))
+	gomega.Expect(testTraffic(80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+}
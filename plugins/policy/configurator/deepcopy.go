@@ -0,0 +1,179 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// DeepCopy returns a deep copy of the policy, not sharing any slices
+// or IP addresses with the original.
+func (cp *ContivPolicy) DeepCopy() *ContivPolicy {
+	if cp == nil {
+		return nil
+	}
+	policyCopy := *cp
+	if cp.RequirePodLabels != nil {
+		policyCopy.RequirePodLabels = append([]podmodel.Pod_Label{}, cp.RequirePodLabels...)
+	}
+	if cp.ExcludePodLabels != nil {
+		policyCopy.ExcludePodLabels = append([]podmodel.Pod_Label{}, cp.ExcludePodLabels...)
+	}
+	if cp.NodeScope != nil {
+		policyCopy.NodeScope = cp.NodeScope.DeepCopy()
+	}
+	if cp.Matches != nil {
+		policyCopy.Matches = make([]Match, len(cp.Matches))
+		for idx, match := range cp.Matches {
+			policyCopy.Matches[idx] = match.DeepCopy()
+		}
+	}
+	return &policyCopy
+}
+
+// DeepCopy returns a deep copy of the match. Nil lists remain nil
+// (nil and empty lists of peers have different meaning).
+func (m Match) DeepCopy() Match {
+	matchCopy := m
+	if m.Pods != nil {
+		matchCopy.Pods = append([]podmodel.ID{}, m.Pods...)
+	}
+	if m.IPBlocks != nil {
+		matchCopy.IPBlocks = make([]IPBlock, len(m.IPBlocks))
+		for idx, block := range m.IPBlocks {
+			matchCopy.IPBlocks[idx] = block.DeepCopy()
+		}
+	}
+	if m.IPMasks != nil {
+		matchCopy.IPMasks = make([]IPMask, len(m.IPMasks))
+		for idx, mask := range m.IPMasks {
+			matchCopy.IPMasks[idx] = IPMask{
+				Address: append(net.IP(nil), mask.Address...),
+				Mask:    append(net.IPMask(nil), mask.Mask...),
+			}
+		}
+	}
+	if m.FQDNs != nil {
+		matchCopy.FQDNs = append([]string{}, m.FQDNs...)
+	}
+	if m.NamespaceSelector != nil {
+		matchCopy.NamespaceSelector = m.NamespaceSelector.DeepCopy()
+	}
+	if m.PodNamePatterns != nil {
+		matchCopy.PodNamePatterns = append([]PodNamePattern{}, m.PodNamePatterns...)
+	}
+	if m.Ports != nil {
+		matchCopy.Ports = append([]Port{}, m.Ports...)
+	}
+	if m.PortSets != nil {
+		matchCopy.PortSets = append([]string{}, m.PortSets...)
+	}
+	if m.SourcePorts != nil {
+		matchCopy.SourcePorts = append([]Port{}, m.SourcePorts...)
+	}
+	if m.RateLimit != nil {
+		rateLimit := *m.RateLimit
+		matchCopy.RateLimit = &rateLimit
+	}
+	if m.ConnRateLimit != nil {
+		connRateLimit := *m.ConnRateLimit
+		matchCopy.ConnRateLimit = &connRateLimit
+	}
+	if m.PacketLen != nil {
+		packetLen := *m.PacketLen
+		matchCopy.PacketLen = &packetLen
+	}
+	if m.L7 != nil {
+		l7 := *m.L7
+		matchCopy.L7 = &l7
+	}
+	if m.TCPFlags != nil {
+		tcpFlags := *m.TCPFlags
+		matchCopy.TCPFlags = &tcpFlags
+	}
+	if m.TunnelVNI != nil {
+		tunnelVNI := *m.TunnelVNI
+		matchCopy.TunnelVNI = &tunnelVNI
+	}
+	return matchCopy
+}
+
+// DeepCopy returns a deep copy of the IP block.
+func (ipb IPBlock) DeepCopy() IPBlock {
+	blockCopy := IPBlock{Network: copyIPNet(ipb.Network)}
+	if ipb.Except != nil {
+		blockCopy.Except = make([]net.IPNet, len(ipb.Except))
+		for idx, except := range ipb.Except {
+			blockCopy.Except[idx] = copyIPNet(except)
+		}
+	}
+	return blockCopy
+}
+
+// DeepCopy returns a deep copy of the node scope.
+func (ns *NodeScope) DeepCopy() *NodeScope {
+	scopeCopy := &NodeScope{}
+	if ns.Nodes != nil {
+		scopeCopy.Nodes = append([]string{}, ns.Nodes...)
+	}
+	if ns.Selector != nil {
+		scopeCopy.Selector = ns.Selector.DeepCopy()
+	}
+	return scopeCopy
+}
+
+// DeepCopy returns a deep copy of the namespace selector.
+func (ns *NamespaceSelector) DeepCopy() *NamespaceSelector {
+	selectorCopy := &NamespaceSelector{}
+	if ns.MatchLabels != nil {
+		selectorCopy.MatchLabels = make(map[string]string, len(ns.MatchLabels))
+		for key, value := range ns.MatchLabels {
+			selectorCopy.MatchLabels[key] = value
+		}
+	}
+	if ns.MatchExpressions != nil {
+		selectorCopy.MatchExpressions = make([]LabelRequirement, len(ns.MatchExpressions))
+		for idx, requirement := range ns.MatchExpressions {
+			requirement.Values = append([]string(nil), requirement.Values...)
+			selectorCopy.MatchExpressions[idx] = requirement
+		}
+	}
+	return selectorCopy
+}
+
+// deepCopyPolicies returns a list with deep copies of the policies.
+// Nil list remains nil.
+func deepCopyPolicies(policies []*ContivPolicy) ContivPolicies {
+	if policies == nil {
+		return nil
+	}
+	policiesCopy := make(ContivPolicies, len(policies))
+	for idx, policy := range policies {
+		policiesCopy[idx] = policy.DeepCopy()
+	}
+	return policiesCopy
+}
+
+// copyIPNet creates a deep copy of an IP network.
+func copyIPNet(ipNet net.IPNet) net.IPNet {
+	return net.IPNet{
+		IP:   append(net.IP(nil), ipNet.IP...),
+		Mask: append(net.IPMask(nil), ipNet.Mask...),
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestDeepCopy(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestDeepCopy")
+
+	pod1 := podmodel.ID{Name: "pod1", Namespace: "default"}
+	policy := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: "default"},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{pod1},
+				IPBlocks: []IPBlock{
+					{
+						Network: parseIPNet("10.0.0.0/16"),
+						Except:  []net.IPNet{parseIPNet("10.0.1.0/24")},
+					},
+				},
+				IPMasks: []IPMask{
+					{Address: net.ParseIP("10.1.0.1"), Mask: net.IPv4Mask(255, 0, 255, 0)},
+				},
+				FQDNs:     []string{"example.com"},
+				Ports:     []Port{{Protocol: TCP, Number: 80}},
+				RateLimit: &RateSpec{BitsPerSecond: 1000, BurstBytes: 100},
+			},
+			{
+				Type:     MatchEgress,
+				IPBlocks: []IPBlock{},
+			},
+		},
+	}
+	original := policy.String()
+
+	policyCopy := policy.DeepCopy()
+	gomega.Expect(policyCopy.String()).To(gomega.Equal(original))
+	gomega.Expect(policyCopy.Matches[1].Pods).To(gomega.BeNil())
+	gomega.Expect(policyCopy.Matches[1].IPBlocks).ToNot(gomega.BeNil())
+
+	// Modifying the copy does not affect the original.
+	match := &policyCopy.Matches[0]
+	match.Pods[0].Name = "pod2"
+	match.IPBlocks[0].Network.IP[1] = 1
+	match.IPBlocks[0].Network.Mask[1] = 0
+	match.IPBlocks[0].Except[0].IP[2] = 2
+	match.IPMasks[0].Address[15] = 2
+	match.IPMasks[0].Mask[0] = 0
+	match.FQDNs[0] = "example.org"
+	match.Ports[0].Number = 443
+	match.RateLimit.BitsPerSecond = 2000
+	policyCopy.Matches[1].Type = MatchIngress
+	gomega.Expect(policy.String()).To(gomega.Equal(original))
+
+	// IP block copy alone.
+	block := policy.Matches[0].IPBlocks[0]
+	blockCopy := block.DeepCopy()
+	blockCopy.Except[0].Mask[3] = 255
+	gomega.Expect(block.Except[0].Mask[3]).To(gomega.BeEquivalentTo(0))
+
+	var nilPolicy *ContivPolicy
+	gomega.Expect(nilPolicy.DeepCopy()).To(gomega.BeNil())
+}
+
+func TestConfigureCopiesPolicies(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestConfigureCopiesPolicies")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod1IP    = "192.168.1.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+
+	// ingress allowed only from 10.0.0.0/24 on port 80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:     MatchIngress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.0.0/24")}},
+				Ports:    []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	expectTraffic := func() {
+		action := renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP("10.0.0.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP("10.0.1.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+		action = renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP("10.0.0.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 443)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+
+	// Mutate the policy between Configure and Commit.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	policy1.Matches[0].Ports[0].Number = 443
+	gomega.Expect(txn.StagedPods()[pod1][0].Matches[0].Ports[0].Number).To(gomega.BeEquivalentTo(80))
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	expectTraffic()
+
+	// Mutate the policy after the commit and re-render the committed config.
+	policy1.Matches[0].IPBlocks[0].Network.IP[2] = 1
+	policy1.Matches = append(policy1.Matches, Match{Type: MatchIngress})
+	configurator.Lock()
+	err = configurator.rerender()
+	configurator.Unlock()
+	gomega.Expect(err).To(gomega.BeNil())
+	expectTraffic()
+	gomega.Expect(configurator.config[pod1][0].Matches).To(gomega.HaveLen(1))
+}
@@ -0,0 +1,58 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// EffectiveDefaultAction returns the action applied to the traffic of the pod
+// in the given direction (from the pod point of view) which is not matched
+// by any of its policies, according to the committed configuration:
+// renderer.ActionDeny if the pod is isolated in the direction by some enabled
+// policy (or by WithEmptySetDenyAll) which does not allow all the traffic,
+// renderer.ActionPermit otherwise (including pods not configured at all).
+// With policies limited to one address family (see ContivPolicy.AddressFamily),
+// ActionDeny is returned if the unmatched traffic of the family is denied,
+// even though the traffic of the other family is allowed.
+func (pc *PolicyConfigurator) EffectiveDefaultAction(pod podmodel.ID, direction MatchType) renderer.ActionType {
+	pc.Lock()
+	defer pc.Unlock()
+
+	rules, configured := pc.rules[pod]
+	if !configured {
+		return renderer.ActionPermit
+	}
+	// Direction in policies is from the pod point of view, whereas rules
+	// are evaluated from the vswitch perspective.
+	dirRules := rules.Ingress
+	if direction == MatchIngress {
+		dirRules = rules.Egress
+	}
+	if len(dirRules) > 0 && isDenyRest(dirRules[len(dirRules)-1]) {
+		return renderer.ActionDeny
+	}
+	return renderer.ActionPermit
+}
+
+// isDenyRest returns true for the rule denying all the traffic, which
+// the configurator puts at the end of the rules of isolated pods.
+func isDenyRest(rule *renderer.ContivRule) bool {
+	return rule.Action == renderer.ActionDeny && rule.Protocol == renderer.ANY &&
+		len(rule.SrcNetwork.IP) == 0 && len(rule.DestNetwork.IP) == 0
+}
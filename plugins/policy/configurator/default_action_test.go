@@ -0,0 +1,142 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestEffectiveDefaultAction(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestEffectiveDefaultAction")
+
+	// Prepare input data.
+	const (
+		namespace         = "default"
+		isolatedNamespace = "isolated"
+	)
+	restrictedPod := podmodel.ID{Name: "restricted", Namespace: namespace}
+	ipv4OnlyPod := podmodel.ID{Name: "ipv4-only", Namespace: namespace}
+	allowAllPod := podmodel.ID{Name: "allow-all", Namespace: namespace}
+	emptySetPod := podmodel.ID{Name: "empty-set", Namespace: namespace}
+	isolatedPod := podmodel.ID{Name: "isolated", Namespace: isolatedNamespace}
+	unconfiguredPod := podmodel.ID{Name: "unconfigured", Namespace: isolatedNamespace}
+
+	// ingress allowed on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// IPv4 egress allowed on TCP:443
+	policy2 := &ContivPolicy{
+		ID:            policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type:          PolicyEgress,
+		AddressFamily: AddressFamilyIPv4,
+		Matches: []Match{
+			{
+				Type:  MatchEgress,
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+
+	// all ingress and egress traffic allowed
+	policy3 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy3", Namespace: namespace},
+		Type: PolicyAll,
+		Matches: []Match{
+			{Type: MatchIngress},
+			{Type: MatchEgress},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(restrictedPod, "192.168.1.1")
+	cache.AddPodConfig(ipv4OnlyPod, "192.168.1.2")
+	cache.AddPodConfig(allowAllPod, "192.168.1.3")
+	cache.AddPodConfig(emptySetPod, "192.168.1.4")
+	cache.AddPodConfig(isolatedPod, "192.168.1.5")
+	cache.AddPodConfig(unconfiguredPod, "192.168.1.6")
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithEmptySetDenyAll(isolatedNamespace))
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(restrictedPod, []*ContivPolicy{policy1})
+	txn.Configure(ipv4OnlyPod, []*ContivPolicy{policy2})
+	txn.Configure(allowAllPod, []*ContivPolicy{policy1, policy3})
+	txn.Configure(emptySetPod, []*ContivPolicy{})
+	txn.Configure(isolatedPod, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	expectDefault := func(pod podmodel.ID, ingress, egress rendererAPI.ActionType) {
+		gomega.Expect(configurator.EffectiveDefaultAction(pod, MatchIngress)).To(gomega.Equal(ingress))
+		gomega.Expect(configurator.EffectiveDefaultAction(pod, MatchEgress)).To(gomega.Equal(egress))
+	}
+	expectDefault(restrictedPod, rendererAPI.ActionDeny, rendererAPI.ActionPermit)
+	expectDefault(ipv4OnlyPod, rendererAPI.ActionPermit, rendererAPI.ActionDeny)
+	expectDefault(allowAllPod, rendererAPI.ActionPermit, rendererAPI.ActionPermit)
+	expectDefault(emptySetPod, rendererAPI.ActionPermit, rendererAPI.ActionPermit)
+	expectDefault(isolatedPod, rendererAPI.ActionDeny, rendererAPI.ActionDeny)
+	expectDefault(unconfiguredPod, rendererAPI.ActionPermit, rendererAPI.ActionPermit)
+
+	// Disabled policy does not isolate the pod.
+	txn = configurator.NewTxn(false)
+	txn.SetPolicyEnabled(policy1.ID, false)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	expectDefault(restrictedPod, rendererAPI.ActionPermit, rendererAPI.ActionPermit)
+}
@@ -0,0 +1,81 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+)
+
+// Default-route IP blocks (0.0.0.0/0 and ::/0) contain all addresses of their
+// address family and are handled canonically as follows:
+//   - the network of the block is normalized (the host bits cleared), i.e. any
+//     block with a zero-length prefix is the default route of its family
+//   - exceptions not contained in the block (e.g. of the other family) have
+//     no effect and are dropped, the remaining ones are subtracted as for any
+//     other block, resulting in "everything except the exceptions"
+//   - a default-route block without (effective) exceptions and not restricted
+//     by ports allows all traffic of the family, exactly as a match with no
+//     peers restricted to the family would (in particular it counts as
+//     "all allowed" for the default-deny)
+//   - a match with default-route blocks of both families without exceptions
+//     matches all peers and is normalized into a match with no peers (nil lists),
+//     unless it references the API server (which is not scoped by the ports
+//     of the match)
+
+// isDefaultRoute returns true if the network contains all addresses of its
+// family (0.0.0.0/0 or ::/0).
+func isDefaultRoute(ipNet *net.IPNet) bool {
+	ones, bits := ipNet.Mask.Size()
+	return bits != 0 && ones == 0
+}
+
+// canonicalBlock returns the IP block with the network and the exceptions
+// normalized and the exceptions not contained in the block removed.
+func canonicalBlock(block IPBlock) IPBlock {
+	canonical := IPBlock{Network: normalizeIPNet(block.Network)}
+	blockOnes, blockBits := canonical.Network.Mask.Size()
+	for _, except := range block.Except {
+		except = normalizeIPNet(except)
+		exceptOnes, exceptBits := except.Mask.Size()
+		if exceptBits != blockBits || exceptOnes < blockOnes || !canonical.Network.Contains(except.IP) {
+			continue
+		}
+		canonical.Except = appendIPNet(canonical.Except, except)
+	}
+	return canonical
+}
+
+// allowsFamily returns the address family of the block if it is a (canonical)
+// default-route block without exceptions. Returns false otherwise.
+func allowsFamily(block IPBlock) (AddressFamily, bool) {
+	if !isDefaultRoute(&block.Network) || len(block.Except) > 0 {
+		return AddressFamilyBoth, false
+	}
+	return familyOf(&block.Network), true
+}
+
+// matchesAllAddresses returns true if the (canonical) blocks include default
+// routes of both families without exceptions.
+func matchesAllAddresses(blocks []IPBlock) bool {
+	allowed := make(map[AddressFamily]bool)
+	for _, block := range blocks {
+		if family, allowsAll := allowsFamily(block); allowsAll {
+			allowed[family] = true
+		}
+	}
+	return allowed[AddressFamilyIPv4] && allowed[AddressFamilyIPv6]
+}
@@ -0,0 +1,319 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestDefaultRouteBlocks(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestDefaultRouteBlocks")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod4Name  = "pod4"
+		pod5Name  = "pod5"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+		pod4IP    = "192.168.1.4"
+		pod5IP    = "192.168.1.5"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+	pod4 := podmodel.ID{Name: pod4Name, Namespace: namespace}
+	pod5 := podmodel.ID{Name: pod5Name, Namespace: namespace}
+
+	// ingress allowed from everywhere (IPv4) except 10.0.0.0/8 and pod2;
+	// the IPv6 exception is not contained in the block and has no effect
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{},
+				IPBlocks: []IPBlock{
+					{
+						Network: *ipNetwork("0.0.0.0/0"),
+						Except: []net.IPNet{
+							*ipNetwork("10.0.0.0/8"),
+							*ipNetwork(pod2IP + "/32"),
+							*ipNetwork("2001:db8::/32"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// ingress allowed from everywhere (IPv4), block with host bits set
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				IPBlocks: []IPBlock{
+					{
+						Network: net.IPNet{IP: net.ParseIP("10.1.2.3").To4(), Mask: net.CIDRMask(0, 32)},
+					},
+				},
+			},
+		},
+	}
+
+	// ingress allowed from everywhere (both families)
+	policy3 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy3", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{},
+				IPBlocks: []IPBlock{
+					{Network: *ipNetwork("0.0.0.0/0")},
+					{Network: *ipNetwork("::/0")},
+				},
+			},
+		},
+	}
+
+	// ingress allowed from everywhere except from everywhere
+	policy4 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy4", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				IPBlocks: []IPBlock{
+					{
+						Network: *ipNetwork("0.0.0.0/0"),
+						Except:  []net.IPNet{*ipNetwork("0.0.0.0/0")},
+					},
+				},
+			},
+		},
+	}
+
+	// ingress allowed on TCP:80 from everywhere (IPv6) except 2001:db8::/32
+	policy5 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy5", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				IPBlocks: []IPBlock{
+					{
+						Network: *ipNetwork("::/0"),
+						Except:  []net.IPNet{*ipNetwork("2001:db8::/32")},
+					},
+				},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+	cache.AddPodConfig(pod4, pod4IP)
+	cache.AddPodConfig(pod5, pod5IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy2})
+	txn.Configure(pod3, []*ContivPolicy{policy3})
+	txn.Configure(pod4, []*ContivPolicy{policy4})
+	txn.Configure(pod5, []*ContivPolicy{policy5})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	testTraffic := func(pod podmodel.ID, podIP, peerIP string, dstPort uint16) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(peerIP), parseIP(podIP), rendererAPI.TCP, 123, dstPort)
+	}
+
+	// Pod1: everything (IPv4) except 10.0.0.0/8 and pod2.
+	gomega.Expect(testTraffic(pod1, pod1IP, "8.8.8.8", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, "9.255.255.255", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, "11.0.0.0", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, "255.255.255.255", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, "0.0.0.0", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, pod3IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, "10.0.0.0", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, "10.1.2.3", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, "10.255.255.255", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, pod2IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, "2001:db9::1", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, "2001:db8::1", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	_, egress := renderer.GetRules(pod1)
+	for _, rule := range egress {
+		if rule.Action == rendererAPI.ActionPermit && len(rule.SrcNetwork.IP) > 0 {
+			// no rule generated for the IPv6 exception
+			gomega.Expect(rule.SrcNetwork.IP.To4()).ToNot(gomega.BeNil())
+		}
+	}
+
+	// Pod2: everything (IPv4), the block is used in the canonical form.
+	gomega.Expect(testTraffic(pod2, pod2IP, "8.8.8.8", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod2, pod2IP, "10.1.2.3", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod2, pod2IP, "2001:db9::1", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	_, egress = renderer.GetRules(pod2)
+	gomega.Expect(egress[0].SrcNetwork.String()).To(gomega.Equal("0.0.0.0/0"))
+
+	// Pod3: everything allowed -> no deny-the-rest.
+	gomega.Expect(testTraffic(pod3, pod3IP, "8.8.8.8", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod3, pod3IP, "2001:db9::1", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	_, egress = renderer.GetRules(pod3)
+	gomega.Expect(egress).To(gomega.HaveLen(2))
+	for _, rule := range egress {
+		gomega.Expect(rule.Action).To(gomega.BeEquivalentTo(rendererAPI.ActionPermit))
+	}
+
+	// Pod4: nothing allowed.
+	gomega.Expect(testTraffic(pod4, pod4IP, "8.8.8.8", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod4, pod4IP, pod1IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod4, pod4IP, "2001:db9::1", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Pod5: TCP:80 from everywhere (IPv6) except 2001:db8::/32.
+	gomega.Expect(testTraffic(pod5, pod5IP, "2001:db9::1", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod5, pod5IP, "::1", 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod5, pod5IP, "2001:db9::1", 81)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod5, pod5IP, "2001:db8::1", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod5, pod5IP, "2001:db8:ffff::1", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod5, pod5IP, "8.8.8.8", 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+}
+
+func TestNormalizeDefaultRouteBlocks(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	pod1 := podmodel.ID{Name: "pod1", Namespace: "default"}
+
+	// Default routes of both families -> match all peers.
+	match := Match{
+		Type: MatchIngress,
+		Pods: []podmodel.ID{pod1},
+		IPBlocks: []IPBlock{
+			{Network: *ipNetwork("::/0")},
+			{Network: net.IPNet{IP: net.ParseIP("10.1.2.3").To4(), Mask: net.CIDRMask(0, 32)}},
+		},
+		FQDNs: []string{"example.com"},
+		Ports: []Port{{Protocol: TCP, Number: 80}},
+	}
+	normalized := match.Normalize()
+	gomega.Expect(normalized.matchesAnyPeer()).To(gomega.BeTrue())
+	gomega.Expect(normalized).To(gomega.Equal(Match{
+		Type:  MatchIngress,
+		Ports: []Port{{Protocol: TCP, Number: 80}},
+	}))
+
+	// Exceptions outside of the block are dropped.
+	match = Match{
+		Type: MatchIngress,
+		IPBlocks: []IPBlock{
+			{Network: *ipNetwork("::/0")},
+			{
+				Network: *ipNetwork("0.0.0.0/0"),
+				Except:  []net.IPNet{*ipNetwork("2001:db8::/32")},
+			},
+		},
+	}
+	normalized = match.Normalize()
+	gomega.Expect(normalized.matchesAnyPeer()).To(gomega.BeTrue())
+
+	// Effective exception -> not all peers.
+	match = Match{
+		Type: MatchIngress,
+		IPBlocks: []IPBlock{
+			{Network: *ipNetwork("::/0")},
+			{
+				Network: *ipNetwork("0.0.0.0/0"),
+				Except:  []net.IPNet{*ipNetwork("10.0.0.0/8"), *ipNetwork("fd00::/8")},
+			},
+		},
+	}
+	normalized = match.Normalize()
+	gomega.Expect(normalized.matchesAnyPeer()).To(gomega.BeFalse())
+	gomega.Expect(normalized.IPBlocks).To(gomega.Equal([]IPBlock{
+		{Network: *ipNetwork("0.0.0.0/0"), Except: []net.IPNet{*ipNetwork("10.0.0.0/8")}},
+		{Network: *ipNetwork("::/0")},
+	}))
+
+	// Default route of one family only.
+	match = Match{
+		Type:     MatchIngress,
+		IPBlocks: []IPBlock{{Network: *ipNetwork("0.0.0.0/0")}},
+	}
+	normalized = match.Normalize()
+	gomega.Expect(normalized.matchesAnyPeer()).To(gomega.BeFalse())
+
+	// API server is not scoped by ports and remains referenced.
+	match = Match{
+		Type:         MatchEgress,
+		IPBlocks:     []IPBlock{{Network: *ipNetwork("0.0.0.0/0")}, {Network: *ipNetwork("::/0")}},
+		APIServerRef: true,
+		Ports:        []Port{{Protocol: TCP, Number: 80}},
+	}
+	normalized = match.Normalize()
+	gomega.Expect(normalized.IPBlocks).To(gomega.HaveLen(2))
+	gomega.Expect(normalized.APIServerRef).To(gomega.BeTrue())
+}
@@ -0,0 +1,185 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/contiv/vpp/plugins/policy/renderer/neutral"
+)
+
+func TestDescription(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestDescription")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// ingress allowed from pod2 on TCP:80, described by the match
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:        MatchIngress,
+				Pods:        []podmodel.ID{pod2},
+				Ports:       []Port{{Protocol: TCP, Number: 80}},
+				Description: "web from frontend",
+			},
+		},
+	}
+
+	// the same match with a different description, plus TCP:443 described
+	// only by the policy
+	policy2 := &ContivPolicy{
+		ID:          policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type:        PolicyIngress,
+		Description: "baseline",
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+	gomega.Expect(policy1.Matches[0].String()).To(gomega.HaveSuffix(`, Description:"web from frontend">`))
+	gomega.Expect(policy2.String()).To(gomega.HaveSuffix(`, Description:"baseline">`))
+	gomega.Expect(policy2.Matches[0].String()).ToNot(gomega.ContainSubstring("Description"))
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Matches differing only in the description share one rule.
+	_, egress := renderer.GetRules(pod1)
+	described := make(map[uint16][]string)
+	for _, rule := range egress {
+		if rule.Action == rendererAPI.ActionPermit && rule.SrcNetwork.String() == pod2IP+"/32" {
+			described[rule.DestPort] = append(described[rule.DestPort], rule.Description)
+		}
+	}
+	gomega.Expect(described).To(gomega.Equal(map[uint16][]string{
+		80:  {"web from frontend"},
+		443: {"baseline"},
+	}))
+	for _, rule := range egress {
+		if rule.Action == rendererAPI.ActionDeny {
+			gomega.Expect(rule.Description).To(gomega.BeEmpty())
+		}
+	}
+
+	// The description appears in the rule export.
+	exported := neutral.FromContivRules(nil, egress)
+	hasDescription := false
+	for _, rule := range exported {
+		if rule.DstPort == 80 && rule.Action == neutral.Permit {
+			gomega.Expect(rule.Description).To(gomega.Equal("web from frontend"))
+			gomega.Expect(rule.String()).To(gomega.HaveSuffix(` # "web from frontend">`))
+			hasDescription = true
+		}
+	}
+	gomega.Expect(hasDescription).To(gomega.BeTrue())
+	rule, err := neutral.ToContivRule(exported[0])
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(rule.Description).To(gomega.Equal(exported[0].Description))
+
+	// The description does not affect the rule equality.
+	for _, rule := range egress {
+		otherRule := rule.Copy()
+		otherRule.Description = "other"
+		gomega.Expect(rule.Compare(otherRule)).To(gomega.Equal(0))
+		gomega.Expect(rule.String()).To(gomega.Equal(otherRule.String()))
+	}
+
+	// Editing only the description is not a change of the policy.
+	edited := policy1.DeepCopy()
+	edited.Matches[0].Description = "edited"
+	gomega.Expect(DiffPolicies([]*ContivPolicy{policy1}, []*ContivPolicy{edited}).IsEmpty()).To(gomega.BeTrue())
+	gomega.Expect(edited.Normalize().Matches[0].key()).To(gomega.Equal(policy1.Normalize().Matches[0].key()))
+	gomega.Expect(configurator.AffectedPods(policy1.ID, edited)).To(gomega.BeEmpty())
+	duplicated := policy1.DeepCopy()
+	duplicated.Matches = append(duplicated.Matches, edited.Matches[0])
+	gomega.Expect(duplicated.Normalize().Matches).To(gomega.HaveLen(1))
+	gomega.Expect(duplicated.Normalize().Matches[0].Description).To(gomega.Equal("web from frontend"))
+
+	// The rules are the same, renderers are given an empty delta.
+	renderer.SetCapabilities(rendererAPI.IncrementalUpdate)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{edited, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	_, editedEgress := renderer.GetRules(pod1)
+	gomega.Expect(ContivRules(editedEgress).Equals(egress)).To(gomega.BeTrue())
+	ingressDelta, egressDelta := renderer.GetRuleDeltas(pod1)
+	for _, delta := range []*rendererAPI.RuleDelta{ingressDelta, egressDelta} {
+		gomega.Expect(delta).ToNot(gomega.BeNil())
+		gomega.Expect(delta.Added).To(gomega.BeEmpty())
+		gomega.Expect(delta.Removed).To(gomega.BeEmpty())
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"sort"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/utils"
+)
+
+// The generated rules must not depend on the order in which maps are iterated,
+// neither here nor in the callers and providers (e.g. pods selected by labels
+// are typically collected from maps). Every list whose order is not defined
+// by the policies themselves is therefore sorted before it is used to build
+// the rules, so that the same input always yields the very same rules
+// in the same order, also across restarts.
+
+// sortedPods returns the pods of the configuration sorted by namespace and name.
+func sortedPods(config map[podmodel.ID]ContivPolicies) []podmodel.ID {
+	pods := make([]podmodel.ID, 0, len(config))
+	for pod := range config {
+		pods = append(pods, pod)
+	}
+	sortPodIDs(pods)
+	return pods
+}
+
+// sortPeerPods sorts pod peers by their IP addresses and then by their IDs.
+func sortPeerPods(peers []PeerPod) {
+	sort.SliceStable(peers, func(i, j int) bool {
+		if order := utils.CompareIPNets(peers[i].IPNet, peers[j].IPNet); order != 0 {
+			return order < 0
+		}
+		if peers[i].ID.Namespace != peers[j].ID.Namespace {
+			return peers[i].ID.Namespace < peers[j].ID.Namespace
+		}
+		return peers[i].ID.Name < peers[j].ID.Name
+	})
+}
+
+// sortedIPs returns a sorted copy of the IP addresses.
+func sortedIPs(ips []net.IP) []net.IP {
+	if ips == nil {
+		return nil
+	}
+	sorted := append([]net.IP{}, ips...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareIPs(sorted[i], sorted[j]) < 0
+	})
+	return sorted
+}
+
+// sortedAPIServerEndpoints returns a copy of the endpoints sorted by IP
+// and port.
+func sortedAPIServerEndpoints(endpoints []APIServerEndpoint) []APIServerEndpoint {
+	if endpoints == nil {
+		return nil
+	}
+	sorted := append([]APIServerEndpoint{}, endpoints...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if order := compareIPs(sorted[i].IP, sorted[j].IP); order != 0 {
+			return order < 0
+		}
+		return sorted[i].Port < sorted[j].Port
+	})
+	return sorted
+}
+
+// compareIPs compares IP addresses as one-host subnets.
+func compareIPs(ip1, ip2 net.IP) int {
+	return utils.CompareIPNets(utils.GetOneHostSubnetFromIP(ip1), utils.GetOneHostSubnetFromIP(ip2))
+}
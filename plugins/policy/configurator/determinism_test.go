@@ -0,0 +1,204 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestDeterministicRules(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestDeterministicRules")
+
+	// Prepare input data.
+	const namespace = "default"
+	var pods, peers []podmodel.ID
+	for i := 1; i <= 3; i++ {
+		pods = append(pods, podmodel.ID{Name: fmt.Sprintf("pod%d", i), Namespace: namespace})
+	}
+	for i := 1; i <= 6; i++ {
+		peers = append(peers, podmodel.ID{Name: fmt.Sprintf("peer%d", i), Namespace: namespace})
+	}
+	dnsIPs := []net.IP{net.ParseIP("10.96.0.10"), net.ParseIP("10.96.0.11"), net.ParseIP("10.96.0.12")}
+	endpoints := []APIServerEndpoint{
+		{IP: net.ParseIP("10.0.0.1"), Port: 6443},
+		{IP: net.ParseIP("10.0.0.2"), Port: 6443},
+		{IP: net.ParseIP("10.0.0.1"), Port: 443},
+	}
+
+	// The input is the same in every iteration, only the order of lists
+	// which do not define any order (typically built from maps) differs.
+	newInput := func(rnd *rand.Rand) []*ContivPolicy {
+		shuffledPeers := func(peers []podmodel.ID) []podmodel.ID {
+			shuffled := append([]podmodel.ID{}, peers...)
+			rnd.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			return shuffled
+		}
+		policies := []*ContivPolicy{
+			{
+				ID:     policymodel.ID{Name: "policy1", Namespace: namespace},
+				Source: "k8s",
+				Type:   PolicyIngress,
+				Matches: []Match{
+					{
+						Type:        MatchIngress,
+						Pods:        shuffledPeers(peers),
+						Ports:       []Port{{Protocol: TCP, Number: 80}, {Protocol: TCP, Number: 443}},
+						Description: "web",
+					},
+				},
+			},
+			{
+				ID:     policymodel.ID{Name: "policy1", Namespace: namespace},
+				Source: "custom",
+				Type:   PolicyIngress,
+				Matches: []Match{
+					{
+						Type:        MatchIngress,
+						Pods:        shuffledPeers(peers[:3]),
+						Ports:       []Port{{Protocol: UDP, Number: 53}},
+						Description: "custom",
+					},
+				},
+			},
+			{
+				ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+				Type: PolicyEgress,
+				Matches: []Match{
+					{
+						Type:         MatchEgress,
+						APIServerRef: true,
+					},
+					{
+						Type: MatchEgress,
+						Pods: shuffledPeers(peers[2:]),
+					},
+				},
+			},
+		}
+		rnd.Shuffle(len(policies), func(i, j int) {
+			policies[i], policies[j] = policies[j], policies[i]
+		})
+		return policies
+	}
+	shuffledIPs := func(rnd *rand.Rand) []net.IP {
+		ips := append([]net.IP{}, dnsIPs...)
+		rnd.Shuffle(len(ips), func(i, j int) { ips[i], ips[j] = ips[j], ips[i] })
+		return ips
+	}
+	shuffledEndpoints := func(rnd *rand.Rand) []APIServerEndpoint {
+		shuffled := append([]APIServerEndpoint{}, endpoints...)
+		rnd.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		return shuffled
+	}
+
+	// dumpRules serializes the rules installed in the renderer, including
+	// the descriptions.
+	dumpRules := func(renderer *MockRenderer) []byte {
+		buf := &bytes.Buffer{}
+		for _, pod := range pods {
+			ingress, egress := renderer.GetRules(pod)
+			fmt.Fprintf(buf, "%s ingress:\n", pod)
+			for _, rule := range ingress {
+				fmt.Fprintf(buf, "  %s %s\n", rule, strconv.Quote(rule.Description))
+			}
+			fmt.Fprintf(buf, "%s egress:\n", pod)
+			for _, rule := range egress {
+				fmt.Fprintf(buf, "  %s %s\n", rule, strconv.Quote(rule.Description))
+			}
+		}
+		return buf.Bytes()
+	}
+
+	var expected []byte
+	for restart := 0; restart < 20; restart++ {
+		rnd := rand.New(rand.NewSource(int64(restart)))
+
+		// Initialize mocks (the order in which pods are added is shuffled too).
+		cache := NewMockPolicyCache()
+		allPods := append(append([]podmodel.ID{}, pods...), peers...)
+		rnd.Shuffle(len(allPods), func(i, j int) { allPods[i], allPods[j] = allPods[j], allPods[i] })
+		for _, pod := range allPods {
+			var podIdx int
+			fmt.Sscanf(pod.Name[len(pod.Name)-1:], "%d", &podIdx)
+			if pod.Name[:3] == "pod" {
+				cache.AddPodConfig(pod, fmt.Sprintf("192.168.1.%d", podIdx))
+			} else {
+				cache.AddPodConfig(pod, fmt.Sprintf("192.168.2.%d", podIdx))
+			}
+		}
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer := NewMockRenderer("A", logger)
+
+		// Initialize configurator ("restart").
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false,
+			WithAutoAllowClusterDNS(&fakeDNSProvider{ips: shuffledIPs(rnd)}),
+			WithAPIServerEndpoints(&fakeAPIServerProvider{endpoints: shuffledEndpoints(rnd)}))
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Generate the rules several times with the same configurator.
+		for iteration := 0; iteration < 5; iteration++ {
+			txn := configurator.NewTxn(true)
+			for _, pod := range pods {
+				txn.Configure(pod, newInput(rnd))
+			}
+			err = txn.Commit()
+			gomega.Expect(err).To(gomega.BeNil())
+
+			rules := dumpRules(renderer)
+			if expected == nil {
+				expected = rules
+				gomega.Expect(string(expected)).To(gomega.ContainSubstring("192.168.2.6/32"))
+				gomega.Expect(string(expected)).To(gomega.ContainSubstring("10.96.0.12/32"))
+				gomega.Expect(string(expected)).To(gomega.ContainSubstring("\"custom\""))
+				continue
+			}
+			gomega.Expect(string(rules)).To(gomega.Equal(string(expected)),
+				"restart %d, iteration %d", restart, iteration)
+		}
+	}
+}
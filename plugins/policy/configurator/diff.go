@@ -0,0 +1,125 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"sort"
+
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// PolicySetDiff describes the difference between two sets of policies
+// at the level of policies and matches.
+type PolicySetDiff struct {
+	// Added lists policies present only in the new set (sorted by ID).
+	Added []*ContivPolicy
+
+	// Removed lists policies present only in the old set (sorted by ID).
+	Removed []*ContivPolicy
+
+	// Changed lists policies present in both sets which differ in type
+	// or matches (sorted by ID).
+	Changed []PolicyDiff
+}
+
+// PolicyDiff describes the difference between two versions of the same policy.
+type PolicyDiff struct {
+	ID      policymodel.ID
+	OldType PolicyType
+	NewType PolicyType
+
+	// AddedMatches lists (normalized) matches present only in the new version.
+	AddedMatches []Match
+
+	// RemovedMatches lists (normalized) matches present only in the old version.
+	RemovedMatches []Match
+}
+
+// IsEmpty returns true if the sets of policies are equivalent.
+func (psd PolicySetDiff) IsEmpty() bool {
+	return len(psd.Added) == 0 && len(psd.Removed) == 0 && len(psd.Changed) == 0
+}
+
+// DiffPolicies computes the difference between two sets of policies.
+// Policies are paired by ID and compared in the normalized form, the order
+// of policies and matches is therefore irrelevant. The result is deterministic.
+// Attributes other than the type and the matches are not compared, neither
+// are the descriptions of the matches.
+func DiffPolicies(old, new []*ContivPolicy) PolicySetDiff {
+	diff := PolicySetDiff{}
+	oldPolicies := policiesByID(old)
+	newPolicies := policiesByID(new)
+
+	for id, oldPolicy := range oldPolicies {
+		newPolicy, inNew := newPolicies[id]
+		if !inNew {
+			diff.Removed = append(diff.Removed, oldPolicy)
+			continue
+		}
+		policyDiff := PolicyDiff{
+			ID:             id,
+			OldType:        oldPolicy.Type,
+			NewType:        newPolicy.Type,
+			AddedMatches:   subtractMatches(newPolicy.Normalize().Matches, oldPolicy.Normalize().Matches),
+			RemovedMatches: subtractMatches(oldPolicy.Normalize().Matches, newPolicy.Normalize().Matches),
+		}
+		if policyDiff.OldType != policyDiff.NewType ||
+			len(policyDiff.AddedMatches) > 0 || len(policyDiff.RemovedMatches) > 0 {
+			diff.Changed = append(diff.Changed, policyDiff)
+		}
+	}
+	for id, newPolicy := range newPolicies {
+		if _, inOld := oldPolicies[id]; !inOld {
+			diff.Added = append(diff.Added, newPolicy)
+		}
+	}
+
+	sort.Sort(ContivPolicies(diff.Added))
+	sort.Sort(ContivPolicies(diff.Removed))
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		if diff.Changed[i].ID.Namespace != diff.Changed[j].ID.Namespace {
+			return diff.Changed[i].ID.Namespace < diff.Changed[j].ID.Namespace
+		}
+		return diff.Changed[i].ID.Name < diff.Changed[j].ID.Name
+	})
+	return diff
+}
+
+// policiesByID builds a map of policies indexed by IDs.
+func policiesByID(policies []*ContivPolicy) map[policymodel.ID]*ContivPolicy {
+	byID := make(map[policymodel.ID]*ContivPolicy)
+	for _, policy := range policies {
+		byID[policy.ID] = policy
+	}
+	return byID
+}
+
+// subtractMatches returns (normalized) matches from <matches> not present
+// in <other>. Both lists are expected to be normalized and sorted.
+func subtractMatches(matches, other []Match) []Match {
+	otherKeys := make(map[string]struct{})
+	for _, match := range other {
+		otherKeys[match.key()] = struct{}{}
+	}
+	var result []Match
+	for _, match := range matches {
+		if _, inOther := otherKeys[match.key()]; !inOther {
+			result = append(result, match)
+		}
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	const namespace = "default"
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	match1 := Match{
+		Type: MatchIngress,
+		Pods: []podmodel.ID{pod1, pod2},
+		Ports: []Port{
+			{Protocol: TCP, Number: 80},
+			{Protocol: UDP, Number: 53},
+		},
+	}
+	match1Reordered := Match{
+		Type: MatchIngress,
+		Pods: []podmodel.ID{pod2, pod1, pod2},
+		Ports: []Port{
+			{Protocol: UDP, Number: 53},
+			{Protocol: TCP, Number: 80},
+		},
+	}
+	match2 := Match{
+		Type: MatchEgress,
+		IPBlocks: []IPBlock{
+			{
+				Network: *ipNetwork("10.0.0.0/8"),
+				Except:  []net.IPNet{*ipNetwork("10.1.0.0/16"), *ipNetwork("10.2.0.0/16")},
+			},
+		},
+		Ports: []Port{},
+	}
+	match2Reordered := Match{
+		Type: MatchEgress,
+		IPBlocks: []IPBlock{
+			{
+				Network: *ipNetwork("10.0.0.0/8"),
+				Except:  []net.IPNet{*ipNetwork("10.2.0.0/16"), *ipNetwork("10.1.0.0/16")},
+			},
+		},
+	}
+	match3 := Match{
+		Type: MatchEgress,
+		Pods: []podmodel.ID{pod1},
+	}
+
+	policy1 := &ContivPolicy{
+		ID:      policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:    PolicyAll,
+		Matches: []Match{match1, match2},
+	}
+	policy1Reordered := &ContivPolicy{
+		ID:      policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:    PolicyAll,
+		Matches: []Match{match2Reordered, match1Reordered, match1},
+	}
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+	}
+	policy3 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy3", Namespace: namespace},
+		Type: PolicyEgress,
+	}
+
+	// Reordered but equal sets.
+	diff := DiffPolicies([]*ContivPolicy{policy1, policy2}, []*ContivPolicy{policy2, policy1Reordered})
+	gomega.Expect(diff.IsEmpty()).To(gomega.BeTrue())
+	gomega.Expect(policy1.Normalize().String()).To(gomega.Equal(policy1Reordered.Normalize().String()))
+
+	// Added, removed and changed policies.
+	policy1Changed := &ContivPolicy{
+		ID:      policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:    PolicyAll,
+		Matches: []Match{match1Reordered, match3},
+	}
+	diff = DiffPolicies([]*ContivPolicy{policy1, policy2}, []*ContivPolicy{policy3, policy1Changed})
+	gomega.Expect(diff.IsEmpty()).To(gomega.BeFalse())
+	gomega.Expect(diff.Added).To(gomega.Equal([]*ContivPolicy{policy3}))
+	gomega.Expect(diff.Removed).To(gomega.Equal([]*ContivPolicy{policy2}))
+	gomega.Expect(diff.Changed).To(gomega.HaveLen(1))
+	gomega.Expect(diff.Changed[0].ID).To(gomega.Equal(policy1.ID))
+	gomega.Expect(diff.Changed[0].AddedMatches).To(gomega.Equal([]Match{match3.Normalize()}))
+	gomega.Expect(diff.Changed[0].RemovedMatches).To(gomega.Equal([]Match{match2.Normalize()}))
+
+	// Changed policy type.
+	policy2Changed := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyAll,
+	}
+	typeDiff := DiffPolicies([]*ContivPolicy{policy2}, []*ContivPolicy{policy2Changed})
+	gomega.Expect(typeDiff.Changed).To(gomega.HaveLen(1))
+	gomega.Expect(typeDiff.Changed[0].OldType).To(gomega.BeEquivalentTo(PolicyIngress))
+	gomega.Expect(typeDiff.Changed[0].NewType).To(gomega.BeEquivalentTo(PolicyAll))
+	gomega.Expect(typeDiff.Changed[0].AddedMatches).To(gomega.BeEmpty())
+
+	// Deterministic.
+	for i := 0; i < 10; i++ {
+		diff2 := DiffPolicies([]*ContivPolicy{policy1, policy2}, []*ContivPolicy{policy3, policy1Changed})
+		gomega.Expect(diff2).To(gomega.Equal(diff))
+	}
+}
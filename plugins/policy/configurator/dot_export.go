@@ -0,0 +1,185 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// dotNode is a node of the exported reachability graph.
+type dotNode struct {
+	name  string
+	shape string
+	ip    net.IP // representative address evaluated for the node
+	block bool
+}
+
+// ExportDOT exports the reachability between the given pods, and between
+// them and the IP blocks referenced by their committed policies, as a Graphviz
+// DOT graph. Nodes are the pods and the IP blocks, edges are the flows allowed
+// by the committed configuration (as evaluated by EvaluateFlow()), labeled
+// with the allowed destination ports. The ports probed are those referenced
+// by the policies of the given pods, TCP:ANY / UDP:ANY stand for the other
+// ports (a port allowed only through ANY is not listed separately).
+// IP blocks are evaluated for their lowest address not excluded by Except,
+// flows between IP blocks are not evaluated. The graph is limited to the given
+// pods, which must have an IP address assigned.
+// Neither the configuration nor the rules are modified.
+func (pc *PolicyConfigurator) ExportDOT(pods []podmodel.ID) ([]byte, error) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	var nodes []dotNode
+	seenPods := make(map[podmodel.ID]struct{})
+	blocks := make(map[string]IPBlock)
+	ports := make(map[Port]struct{})
+	for _, protocol := range []ProtocolType{TCP, UDP} {
+		ports[Port{Protocol: protocol}] = struct{}{}
+	}
+	for _, pod := range pods {
+		if _, duplicate := seenPods[pod]; duplicate {
+			continue
+		}
+		seenPods[pod] = struct{}{}
+		podIP, err := pc.getPodIP(pod)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export pod %s: %v", pod, err)
+		}
+		nodes = append(nodes, dotNode{name: pod.String(), shape: "box", ip: podIP})
+		for _, policy := range pc.inheritedPolicies(pc.config[pod]) {
+			for _, match := range policy.Matches {
+				for _, port := range pc.expandPortSets(match) {
+					ports[port] = struct{}{}
+				}
+				for _, block := range match.IPBlocks {
+					blocks[block.String()] = block
+				}
+			}
+		}
+	}
+	blockNames := make([]string, 0, len(blocks))
+	for name := range blocks {
+		blockNames = append(blockNames, name)
+	}
+	sort.Strings(blockNames)
+	for _, name := range blockNames {
+		if ip := blockRepresentative(blocks[name]); ip != nil {
+			nodes = append(nodes, dotNode{name: name, shape: "ellipse", ip: ip, block: true})
+		}
+	}
+	probed := make([]Port, 0, len(ports))
+	for port := range ports {
+		probed = append(probed, port)
+	}
+	sort.Slice(probed, func(i, j int) bool {
+		if probed[i].Protocol != probed[j].Protocol {
+			return probed[i].Protocol < probed[j].Protocol
+		}
+		return probed[i].Number < probed[j].Number
+	})
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("digraph reachability {\n")
+	for _, node := range nodes {
+		fmt.Fprintf(buf, "\t%s [shape=%s];\n", strconv.Quote(node.name), node.shape)
+	}
+	for _, src := range nodes {
+		for _, dst := range nodes {
+			if src.name == dst.name || (src.block && dst.block) {
+				continue
+			}
+			allowed := pc.allowedPorts(src.ip, dst.ip, probed)
+			if len(allowed) == 0 {
+				continue
+			}
+			fmt.Fprintf(buf, "\t%s -> %s [label=%s];\n",
+				strconv.Quote(src.name), strconv.Quote(dst.name), strconv.Quote(strings.Join(allowed, ", ")))
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// allowedPorts returns the probed ports (sorted, ANY first) allowed from <src>
+// to <dst>, without the ports of protocols allowed on any port.
+func (pc *PolicyConfigurator) allowedPorts(src, dst net.IP, probed []Port) []string {
+	var allowed []string
+	anyPort := make(map[ProtocolType]bool)
+	for _, port := range probed {
+		if anyPort[port.Protocol] {
+			continue
+		}
+		flow := Flow{SrcIP: src, DstIP: dst, Protocol: port.Protocol, DstPort: port.Number}
+		if !pc.evaluateFlow(flow) {
+			continue
+		}
+		if port.Number == 0 {
+			anyPort[port.Protocol] = true
+		}
+		allowed = append(allowed, port.String())
+	}
+	return allowed
+}
+
+// blockRepresentative returns the lowest address of the block not excluded
+// by Except, nil if there is none.
+func blockRepresentative(block IPBlock) net.IP {
+	ip := block.Network.IP.Mask(block.Network.Mask)
+	for ip != nil && block.Network.Contains(ip) {
+		excluded := false
+		for _, except := range block.Except {
+			if except.Contains(ip) {
+				ip = nextIP(lastIP(except))
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			return ip
+		}
+	}
+	return nil
+}
+
+// lastIP returns the highest address of the network.
+func lastIP(ipNet net.IPNet) net.IP {
+	ip := ipNet.IP.Mask(ipNet.Mask)
+	last := make(net.IP, len(ip))
+	for i := range ip {
+		last[i] = ip[i] | ^ipNet.Mask[i]
+	}
+	return last
+}
+
+// nextIP returns the address following the given one, nil on overflow.
+func nextIP(ip net.IP) net.IP {
+	next := append(net.IP{}, ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return nil
+}
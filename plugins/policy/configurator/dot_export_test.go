@@ -0,0 +1,140 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestExportDOT(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestExportDOT")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	pod3 := podmodel.ID{Name: "pod3", Namespace: namespace}
+
+	// ingress of pod1 allowed from pod2 on TCP:80 and from 10.0.0.0/8
+	// (except 10.0.0.0/24) on UDP:53
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type: MatchIngress,
+				IPBlocks: []IPBlock{
+					{
+						Network: parseIPNet("10.0.0.0/8"),
+						Except:  []net.IPNet{parseIPNet("10.0.0.0/24")},
+					},
+				},
+				Ports: []Port{{Protocol: UDP, Number: 53}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	dot, err := configurator.ExportDOT([]podmodel.ID{pod1, pod2, pod3, pod2})
+	gomega.Expect(err).To(gomega.BeNil())
+	graph := string(dot)
+	gomega.Expect(graph).To(gomega.HavePrefix("digraph reachability {\n"))
+	gomega.Expect(graph).To(gomega.HaveSuffix("}\n"))
+
+	// nodes
+	gomega.Expect(graph).To(gomega.ContainSubstring("\t\"default/pod1\" [shape=box];\n"))
+	gomega.Expect(graph).To(gomega.ContainSubstring("\t\"default/pod2\" [shape=box];\n"))
+	gomega.Expect(graph).To(gomega.ContainSubstring("\t\"default/pod3\" [shape=box];\n"))
+	block := policy1.Matches[1].IPBlocks[0].String()
+	gomega.Expect(graph).To(gomega.ContainSubstring("\t\"" + block + "\" [shape=ellipse];\n"))
+
+	// edges into the isolated pod1
+	gomega.Expect(graph).To(gomega.ContainSubstring("\t\"default/pod2\" -> \"default/pod1\" [label=\"TCP:80\"];\n"))
+	gomega.Expect(graph).To(gomega.ContainSubstring("\t\"" + block + "\" -> \"default/pod1\" [label=\"UDP:53\"];\n"))
+	gomega.Expect(graph).ToNot(gomega.ContainSubstring("\t\"default/pod3\" -> \"default/pod1\""))
+
+	// unrestricted edges
+	gomega.Expect(graph).To(gomega.ContainSubstring(
+		"\t\"default/pod1\" -> \"default/pod2\" [label=\"TCP:ANY, UDP:ANY\"];\n"))
+	gomega.Expect(graph).To(gomega.ContainSubstring(
+		"\t\"default/pod1\" -> \"" + block + "\" [label=\"TCP:ANY, UDP:ANY\"];\n"))
+	gomega.Expect(graph).To(gomega.ContainSubstring(
+		"\t\"default/pod3\" -> \"default/pod2\" [label=\"TCP:ANY, UDP:ANY\"];\n"))
+
+	// the graph is limited to the requested pods
+	dot, err = configurator.ExportDOT([]podmodel.ID{pod2, pod3})
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(string(dot)).ToNot(gomega.ContainSubstring("pod1"))
+	gomega.Expect(string(dot)).ToNot(gomega.ContainSubstring(block))
+
+	// pod without IP address
+	_, err = configurator.ExportDOT([]podmodel.ID{{Name: "unknown", Namespace: namespace}})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+}
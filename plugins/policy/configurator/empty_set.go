@@ -0,0 +1,66 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// emptySetDenyAllPolicy is the name of the implicit policy isolating pods
+// without policies in namespaces selected by WithEmptySetDenyAll.
+// The name is not a valid K8s name and cannot therefore clash with any policy.
+const emptySetDenyAllPolicy = "<empty-set-deny-all>"
+
+// WithEmptySetDenyAll inverts the semantics of an empty set of policies
+// for pods in the given namespaces: instead of allowing all traffic,
+// pods configured with no policies deny all traffic in both directions,
+// as if they were isolated by ingress and egress policies without any matches.
+// The rules injected for isolated pods are still installed, i.e. connections
+// from the NAT-loopback and to the cluster DNS (with WithAutoAllowClusterDNS)
+// are allowed.
+// A pod is affected only once it is configured (with Configure) with an empty
+// set of policies, or when all its policies are removed (e.g. expired
+// or removed by RemoveBySource). Pods never configured remain unrestricted.
+// Pods with at least one policy are unaffected.
+func WithEmptySetDenyAll(namespaces ...string) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.emptySetDenyAll = make(map[string]struct{})
+		for _, namespace := range namespaces {
+			pc.emptySetDenyAll[namespace] = struct{}{}
+		}
+	}
+}
+
+// implicitPolicies returns the policies to evaluate for the pod in place
+// of the configured (sorted) policies: the implicit deny-all policy for an empty
+// set in namespaces selected by WithEmptySetDenyAll, otherwise the configured
+// policies unchanged.
+func (pc *PolicyConfigurator) implicitPolicies(pod podmodel.ID, policies ContivPolicies) ContivPolicies {
+	if len(policies) > 0 {
+		return policies
+	}
+	if _, denyAll := pc.emptySetDenyAll[pod.Namespace]; !denyAll {
+		return policies
+	}
+	return ContivPolicies{
+		{
+			ID:   policymodel.ID{Namespace: pod.Namespace, Name: emptySetDenyAllPolicy},
+			Type: PolicyAll,
+		},
+	}
+}
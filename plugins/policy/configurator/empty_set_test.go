@@ -0,0 +1,146 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestEmptySetDenyAll(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestEmptySetDenyAll")
+
+	// Prepare input data.
+	const (
+		zeroTrustNs = "zero-trust"
+		defaultNs   = "default"
+		pod1Name    = "pod1"
+		pod2Name    = "pod2"
+		pod3Name    = "pod3"
+		pod1IP      = "192.168.1.1"
+		pod2IP      = "192.168.1.2"
+		pod3IP      = "192.168.1.3"
+		externalIP  = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: zeroTrustNs}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: defaultNs}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: zeroTrustNs}
+
+	// ingress allowed on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: zeroTrustNs},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithEmptySetDenyAll(zeroTrustNs))
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	toPod := func(pod podmodel.ID, podIP string, srcIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(srcIP), parseIP(podIP), rendererAPI.TCP, 123, port)
+	}
+	fromPod := func(pod podmodel.ID, podIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(externalIP), rendererAPI.TCP, 123, port)
+	}
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{})
+	txn.Configure(pod2, []*ContivPolicy{})
+	txn.Configure(pod3, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Empty set in the zero-trust namespace denies all.
+	gomega.Expect(toPod(pod1, pod1IP, externalIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, pod2IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(fromPod(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, natLoopbackIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Empty set in other namespaces still allows all.
+	ingress, egress := renderer.GetRules(pod2)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+	gomega.Expect(toPod(pod2, pod2IP, externalIP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	gomega.Expect(fromPod(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+
+	// Non-empty set in the zero-trust namespace is evaluated as usual.
+	gomega.Expect(toPod(pod3, pod3IP, externalIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod3, pod3IP, externalIP, 81)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(fromPod(pod3, pod3IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+
+	// The committed configuration is not altered.
+	gomega.Expect(configurator.config[pod1]).To(gomega.BeEmpty())
+
+	// Pod3 is left with no policies.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod3, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(pod3, pod3IP, externalIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(fromPod(pod3, pod3IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Pod1 gets a policy.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(pod1, pod1IP, externalIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(fromPod(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+}
@@ -0,0 +1,127 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"math"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// isExclusive returns true if the policy belongs to an exclusive group.
+func (cp *ContivPolicy) isExclusive() bool {
+	return cp.Group != "" && cp.Exclusive
+}
+
+// orderExclusivePolicies records the order in which exclusive policies
+// of the transaction were applied to the pods. Policies already committed
+// for a pod keep their order, newly added policies follow in the order
+// given to Configure().
+func (pct *PolicyConfiguratorTxn) orderExclusivePolicies() {
+	pc := pct.configurator
+	pct.appliedAt = make(map[podmodel.ID]map[policymodel.ID]uint64)
+	pct.lastApplySeq = pc.lastApplySeq
+	for pod, policies := range pct.config {
+		applied := make(map[policymodel.ID]uint64)
+		for _, policy := range policies {
+			if !policy.isExclusive() {
+				continue
+			}
+			if seq, committed := pc.appliedAt[pod][policy.ID]; committed {
+				applied[policy.ID] = seq
+				continue
+			}
+			pct.lastApplySeq++
+			applied[policy.ID] = pct.lastApplySeq
+		}
+		if len(applied) > 0 {
+			pct.appliedAt[pod] = applied
+		}
+	}
+}
+
+// saveExclusiveOrder remembers the order of exclusive policies applied
+// to the configured pods.
+func (pct *PolicyConfiguratorTxn) saveExclusiveOrder() {
+	pc := pct.configurator
+	if pct.resync || pc.appliedAt == nil {
+		pc.appliedAt = make(map[podmodel.ID]map[policymodel.ID]uint64)
+	}
+	pc.lastApplySeq = pct.lastApplySeq
+	for pod := range pct.config {
+		applied, hasApplied := pct.appliedAt[pod]
+		if _, configured := pc.config[pod]; configured && hasApplied {
+			pc.appliedAt[pod] = applied
+		} else {
+			delete(pc.appliedAt, pod)
+		}
+	}
+}
+
+// activeExclusivePolicies returns the policies without exclusive policies
+// deactivated by a policy of the same group applied to the pod later.
+// If no policy is deactivated, the same list is returned.
+func (pct *PolicyConfiguratorTxn) activeExclusivePolicies(pod podmodel.ID, policies ContivPolicies) ContivPolicies {
+	// group -> index of the policy applied last
+	winners := make(map[string]int)
+	for idx, policy := range policies {
+		if !policy.isExclusive() {
+			continue
+		}
+		winner, hasWinner := winners[policy.Group]
+		// with equal order the later policy (by ID) wins
+		if !hasWinner || pct.applySeq(pod, policy.ID) >= pct.applySeq(pod, policies[winner].ID) {
+			winners[policy.Group] = idx
+		}
+	}
+	if len(winners) == 0 {
+		return policies
+	}
+	var active ContivPolicies
+	for idx, policy := range policies {
+		if policy.isExclusive() && winners[policy.Group] != idx {
+			pct.Log.WithFields(logging.Fields{
+				"pod":    pct.configurator.logPod(pod),
+				"policy": policy.ID,
+				"group":  policy.Group,
+				"active": policies[winners[policy.Group]].ID,
+			}).Debug("Exclusive policy deactivated by another policy of the group")
+			continue
+		}
+		active = append(active, policy)
+	}
+	if len(active) == len(policies) {
+		return policies
+	}
+	return active
+}
+
+// applySeq returns the order in which the exclusive policy was applied
+// to the pod. Policies of unknown order (not processed by commit) are taken
+// as applied last.
+func (pct *PolicyConfiguratorTxn) applySeq(pod podmodel.ID, policy policymodel.ID) uint64 {
+	if seq, known := pct.appliedAt[pod][policy]; known {
+		return seq
+	}
+	if seq, known := pct.configurator.appliedAt[pod][policy]; known {
+		return seq
+	}
+	return math.MaxUint64
+}
@@ -0,0 +1,156 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestExclusiveGroups(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestExclusiveGroups")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1Name   = "pod1"
+		pod2Name   = "pod2"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		externalIP = "10.0.0.1"
+		group      = "environment"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// profile returns an exclusive policy of the group allowing ingress
+	// on the given TCP port.
+	profile := func(name string, port uint16) *ContivPolicy {
+		return &ContivPolicy{
+			ID:        policymodel.ID{Name: name, Namespace: namespace},
+			Type:      PolicyIngress,
+			Group:     group,
+			Exclusive: true,
+			Matches: []Match{
+				{
+					Type:  MatchIngress,
+					Ports: []Port{{Protocol: TCP, Number: port}},
+				},
+			},
+		}
+	}
+	profileA := profile("profile-a", 8080)
+	profileB := profile("profile-b", 9090)
+	gomega.Expect(profileA.String()).To(gomega.HaveSuffix(", Group:environment (exclusive)>"))
+
+	// non-exclusive policy of the same group, ingress allowed on TCP:22
+	common := &ContivPolicy{
+		ID:    policymodel.ID{Name: "common", Namespace: namespace},
+		Type:  PolicyIngress,
+		Group: group,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 22}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	toPod := func(pod podmodel.ID, podIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(externalIP), parseIP(podIP), rendererAPI.TCP, 123, port)
+	}
+	commit := func(pod podmodel.ID, policies ...*ContivPolicy) {
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod, policies)
+		err := txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+	}
+
+	// Profile A active on pod1.
+	commit(pod1, common, profileA)
+	gomega.Expect(toPod(pod1, pod1IP, 22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 8080)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 9090)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Applying profile B deactivates profile A (but not the common policy).
+	commit(pod1, profileA, common, profileB)
+	gomega.Expect(toPod(pod1, pod1IP, 22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 8080)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 9090)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Deactivated profile is kept in the configuration.
+	gomega.Expect(configurator.config[pod1]).To(gomega.HaveLen(3))
+
+	// Unrelated commit does not change the active profile.
+	commit(pod2, profileA)
+	gomega.Expect(toPod(pod1, pod1IP, 8080)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 9090)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 8080)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Removing profile B activates profile A again.
+	commit(pod1, common, profileA)
+	gomega.Expect(toPod(pod1, pod1IP, 8080)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 9090)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Both added in one transaction: the one given last wins.
+	commit(pod2)
+	commit(pod2, profileB, profileA)
+	gomega.Expect(toPod(pod2, pod2IP, 8080)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 9090)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	commit(pod2)
+	commit(pod2, profileA, profileB)
+	gomega.Expect(toPod(pod2, pod2IP, 8080)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 9090)).To(gomega.BeEquivalentTo(AllowedTraffic))
+}
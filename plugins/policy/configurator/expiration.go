@@ -0,0 +1,107 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"time"
+
+	"github.com/ligato/cn-infra/logging"
+)
+
+// applyExpiration filters out expired policies from the transaction.
+func (pct *PolicyConfiguratorTxn) applyExpiration() {
+	now := pct.configurator.clock.Now()
+	for pod, policies := range pct.config {
+		if !hasExpired(policies, now) {
+			continue
+		}
+		filtered := ContivPolicies{}
+		for _, policy := range policies {
+			if isExpired(policy, now) {
+				pct.Log.WithFields(logging.Fields{
+					"pod":       pct.configurator.logPod(pod),
+					"policy":    policy.ID,
+					"expiresAt": policy.ExpiresAt,
+				}).Debug("Skipping expired policy")
+				continue
+			}
+			filtered = append(filtered, policy)
+		}
+		pct.config[pod] = filtered
+	}
+}
+
+// scheduleExpiration (re-)schedules the timer for the earliest expiration
+// among the committed policies.
+func (pc *PolicyConfigurator) scheduleExpiration() {
+	if pc.expiryTimer != nil {
+		pc.expiryTimer.Stop()
+		pc.expiryTimer = nil
+	}
+	var earliest time.Time
+	for _, policies := range pc.config {
+		for _, policy := range policies {
+			if policy.ExpiresAt.IsZero() {
+				continue
+			}
+			if earliest.IsZero() || policy.ExpiresAt.Before(earliest) {
+				earliest = policy.ExpiresAt
+			}
+		}
+	}
+	if earliest.IsZero() {
+		return
+	}
+	pc.expiryTimer = pc.afterFunc(earliest.Sub(pc.clock.Now()), pc.expirePolicies)
+}
+
+// expirePolicies re-renders pods with expired policies.
+func (pc *PolicyConfigurator) expirePolicies(generation uint64) {
+	pc.Lock()
+	defer pc.Unlock()
+	if !pc.expiryTimer.owns(generation) {
+		/* cancelled or re-scheduled in the meantime */
+		return
+	}
+	pc.expiryTimer = nil
+
+	now := pc.clock.Now()
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for pod, policies := range pc.config {
+		if hasExpired(policies, now) {
+			txn.configure(pod, policies)
+		}
+	}
+	if err := txn.commit(); err != nil {
+		pc.Log.WithField("err", err).Error("Failed to re-render pods with expired policies")
+	}
+}
+
+// hasExpired returns true if at least one of the policies has expired.
+func hasExpired(policies ContivPolicies, now time.Time) bool {
+	for _, policy := range policies {
+		if isExpired(policy, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExpired returns true if the policy has expired.
+func isExpired(policy *ContivPolicy, now time.Time) bool {
+	return !policy.ExpiresAt.IsZero() && !now.Before(policy.ExpiresAt)
+}
@@ -0,0 +1,160 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestFaultInjectingRenderer(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestFaultInjectingRenderer")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress allowed on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	rendererA := NewMockRenderer("A", logger)
+	rendererA.SetCapabilities(rendererAPI.IncrementalUpdate)
+	faultyRenderer := NewFaultInjectingRenderer(rendererA, logger)
+	rendererB := NewMockRenderer("B", logger)
+
+	// Initialize configurator.
+	attempts := 0
+	backoff := func(attempt int) time.Duration {
+		attempts++
+		return 0
+	}
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithRetry(10, backoff))
+	err := configurator.RegisterRenderer(faultyRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterRenderer(rendererB)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Capabilities of the wrapped renderer are passed through.
+	gomega.Expect(faultyRenderer.HasCapability(rendererAPI.IncrementalUpdate)).To(gomega.BeTrue())
+	gomega.Expect(faultyRenderer.HasCapability(rendererAPI.RuleGroups)).To(gomega.BeFalse())
+
+	configure := func(pod podmodel.ID, ports ...Port) error {
+		policy := policy1.DeepCopy()
+		policy.Matches[0].Ports = append(policy.Matches[0].Ports, ports...)
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod, []*ContivPolicy{policy})
+		return txn.Commit()
+	}
+	allowed := func(rndr *MockRenderer, pod podmodel.ID, podIP string, port uint16) bool {
+		action := rndr.TestTraffic(pod, EgressTraffic,
+			parseIP("10.0.0.1"), parseIP(podIP), rendererAPI.TCP, 1024, port)
+		return action == AllowedTraffic
+	}
+
+	// Failing pod.
+	faultyRenderer.FailPods(pod2)
+	err = configure(pod1)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(allowed(rendererA, pod1, pod1IP, 80)).To(gomega.BeTrue())
+
+	err = configure(pod2)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(rendererAPI.IsTransient(err)).To(gomega.BeFalse())
+	gomega.Expect(attempts).To(gomega.Equal(0)) /* permanent error is not retried */
+	_, status := configurator.LastCommitStatus()
+	gomega.Expect(status).To(gomega.Equal(err))
+	// The failing renderer is left unchanged, the other one is not affected.
+	ingress, egress := rendererA.GetRules(pod2)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+	gomega.Expect(allowed(rendererB, pod2, pod2IP, 80)).To(gomega.BeTrue())
+	gomega.Expect(faultyRenderer.Failures()).To(gomega.Equal(1))
+
+	// Failing after N applies.
+	faultyRenderer.FailPods()
+	faultyRenderer.FailAfter(1)
+	err = configure(pod1, Port{Protocol: TCP, Number: 81})
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(allowed(rendererA, pod1, pod1IP, 81)).To(gomega.BeTrue())
+	err = configure(pod1, Port{Protocol: TCP, Number: 82})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(allowed(rendererA, pod1, pod1IP, 82)).To(gomega.BeFalse())
+	gomega.Expect(allowed(rendererB, pod1, pod1IP, 82)).To(gomega.BeTrue())
+	gomega.Expect(faultyRenderer.Failures()).To(gomega.Equal(2))
+
+	// Intermittent transient failures are retried (the deltas are passed
+	// through as well).
+	faultyRenderer.FailAfter(-1)
+	faultyRenderer.SetTransient(true)
+	faultyRenderer.FailIntermittently(0.5, 1)
+	for port := uint16(100); port < 110; port++ {
+		err = configure(pod1, Port{Protocol: TCP, Number: port})
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(allowed(rendererA, pod1, pod1IP, port)).To(gomega.BeTrue())
+	}
+	_, egressDelta := rendererA.GetRuleDeltas(pod1)
+	gomega.Expect(egressDelta).ToNot(gomega.BeNil())
+	gomega.Expect(attempts).ToNot(gomega.BeZero())
+	gomega.Expect(faultyRenderer.Failures()).To(gomega.Equal(2 + attempts))
+	_, status = configurator.LastCommitStatus()
+	gomega.Expect(status).To(gomega.BeNil())
+}
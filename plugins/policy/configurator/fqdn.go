@@ -0,0 +1,224 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"sort"
+	"time"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/utils"
+)
+
+// FQDNResolver resolves fully qualified domain names referenced by Match.FQDNs.
+type FQDNResolver interface {
+	// LookupIP returns the IP addresses the domain name resolves to.
+	LookupIP(fqdn string) ([]net.IP, error)
+}
+
+// minFQDNTTL is the shortest period of FQDN re-resolution.
+const minFQDNTTL = time.Second
+
+// WithFQDNResolver enables the FQDN selectors (Match.FQDNs).
+// Every referenced name is resolved when first committed and then re-resolved
+// every <ttl> (at least one second, shorter periods are raised). Pods with
+// policies referencing names whose IP addresses have changed are re-rendered.
+// If the resolution fails, the last known good set of IP addresses is retained.
+// Names which failed to resolve the first time match no IP addresses and are
+// not retried until the next re-resolution. The resolver is always called with
+// the configurator unlocked, i.e. slow lookups do not block other operations.
+func WithFQDNResolver(resolver FQDNResolver, ttl time.Duration) Option {
+	return func(pc *PolicyConfigurator) {
+		if ttl < minFQDNTTL {
+			ttl = minFQDNTTL
+		}
+		pc.fqdnResolver = resolver
+		pc.fqdnTTL = ttl
+	}
+}
+
+// resolveFQDN returns IP addresses the domain name resolved to the last time.
+// Names are resolved in advance by prefetchFQDNs() and refreshFQDNs(), a name
+// not resolved yet matches no IP addresses until the next re-resolution.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) resolveFQDN(fqdn string) []net.IP {
+	if pc.fqdnResolver == nil {
+		pc.Log.WithField("fqdn", fqdn).Warn("FQDN resolver is not configured")
+		return nil
+	}
+	ips, resolved := pc.fqdnIPs[fqdn]
+	if !resolved {
+		pc.Log.WithField("fqdn", fqdn).Warn("FQDN is not resolved yet")
+		pc.fqdnIPs[fqdn] = nil
+	}
+	return ips
+}
+
+// prefetchFQDNs resolves names referenced by the given policies which were not
+// resolved yet. Failed resolutions are cached as well (with no IP addresses)
+// until the next re-resolution.
+// The configurator must not be locked by the caller.
+func (pc *PolicyConfigurator) prefetchFQDNs(policyLists []ContivPolicies) {
+	if pc.fqdnResolver == nil {
+		return
+	}
+	pc.Lock()
+	unresolved := make(map[string]struct{})
+	for _, policies := range policyLists {
+		for _, policy := range pc.inheritedPolicies(policies) {
+			for _, match := range policy.Matches {
+				for _, fqdn := range match.FQDNs {
+					if _, resolved := pc.fqdnIPs[fqdn]; !resolved {
+						unresolved[fqdn] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+	pc.Unlock()
+	if len(unresolved) == 0 {
+		return
+	}
+
+	resolved := make(map[string][]net.IP)
+	for fqdn := range unresolved {
+		ips, _ := pc.lookupFQDN(fqdn) /* nil if failed */
+		resolved[fqdn] = ips
+	}
+
+	pc.Lock()
+	defer pc.Unlock()
+	for fqdn, ips := range resolved {
+		if _, resolvedMeanwhile := pc.fqdnIPs[fqdn]; !resolvedMeanwhile {
+			pc.fqdnIPs[fqdn] = ips
+		}
+	}
+}
+
+// lookupFQDN resolves the domain name using the resolver.
+// Returned IPs are sorted to allow comparison.
+func (pc *PolicyConfigurator) lookupFQDN(fqdn string) ([]net.IP, error) {
+	ips, err := pc.fqdnResolver.LookupIP(fqdn)
+	if err != nil {
+		pc.Log.WithFields(logging.Fields{
+			"fqdn": fqdn,
+			"err":  err,
+		}).Warn("Failed to resolve FQDN")
+		return nil, err
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return utils.CompareIPNets(utils.GetOneHostSubnetFromIP(ips[i]),
+			utils.GetOneHostSubnetFromIP(ips[j])) < 0
+	})
+	return ips, nil
+}
+
+// scheduleFQDNRefresh schedules the next re-resolution of FQDNs.
+func (pc *PolicyConfigurator) scheduleFQDNRefresh() {
+	pc.fqdnTimer = pc.clock.AfterFunc(pc.fqdnTTL, pc.refreshFQDNs)
+}
+
+// fqdnReferences returns pods of the committed configuration referencing each
+// of the FQDNs.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) fqdnReferences() map[string][]podmodel.ID {
+	references := make(map[string][]podmodel.ID)
+	for pod, policies := range pc.config {
+		for _, policy := range pc.inheritedPolicies(policies) {
+			for _, match := range policy.Matches {
+				for _, fqdn := range match.FQDNs {
+					references[fqdn] = append(references[fqdn], pod)
+				}
+			}
+		}
+	}
+	return references
+}
+
+// refreshFQDNs re-resolves all FQDNs referenced by the committed configuration
+// and re-renders pods affected by a change. The names are resolved with
+// the configurator unlocked.
+func (pc *PolicyConfigurator) refreshFQDNs() {
+	pc.Lock()
+	if pc.fqdnTimer == nil {
+		/* closed */
+		pc.Unlock()
+		return
+	}
+	references := pc.fqdnReferences()
+	pc.Unlock()
+
+	// Re-resolve.
+	resolved := make(map[string][]net.IP)
+	for fqdn := range references {
+		ips, err := pc.lookupFQDN(fqdn)
+		if err != nil {
+			/* keep the last known good */
+			continue
+		}
+		resolved[fqdn] = ips
+	}
+
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.fqdnTimer == nil {
+		/* closed meanwhile */
+		return
+	}
+	defer pc.scheduleFQDNRefresh()
+
+	// The configuration may have changed during the resolution.
+	references = pc.fqdnReferences()
+	changed := make(map[podmodel.ID]struct{})
+	for fqdn := range pc.fqdnIPs {
+		if _, referenced := references[fqdn]; !referenced {
+			delete(pc.fqdnIPs, fqdn)
+		}
+	}
+	for fqdn, ips := range resolved {
+		pods, referenced := references[fqdn]
+		if !referenced {
+			continue
+		}
+		if lastIPs, known := pc.fqdnIPs[fqdn]; known && equalIPs(ips, lastIPs) {
+			continue
+		}
+		pc.Log.WithFields(logging.Fields{
+			"fqdn": fqdn,
+			"ips":  ips,
+		}).Debug("FQDN resolves to new IP addresses")
+		pc.fqdnIPs[fqdn] = ips
+		for _, pod := range pods {
+			changed[pod] = struct{}{}
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	// Re-render affected pods.
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for pod := range changed {
+		txn.configure(pod, pc.config[pod])
+	}
+	if err := txn.commit(); err != nil {
+		pc.Log.WithField("err", err).Error("Failed to re-render pods after FQDN change")
+	}
+}
@@ -0,0 +1,282 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+type fakeResolver struct {
+	ips      map[string][]net.IP
+	err      error
+	lookups  int
+	onLookup func()
+}
+
+func (fr *fakeResolver) LookupIP(fqdn string) ([]net.IP, error) {
+	fr.lookups++
+	if fr.onLookup != nil {
+		fr.onLookup()
+	}
+	if fr.err != nil {
+		return nil, fr.err
+	}
+	return fr.ips[fqdn], nil
+}
+
+func TestFQDNEgress(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestFQDNEgress")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod1IP    = "192.168.1.1"
+		fqdn      = "api.example.com"
+		extIP1    = "93.184.216.34"
+		extIP2    = "93.184.216.35"
+		extIP3    = "93.184.216.36"
+		ttl       = 30 * time.Second
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+
+	// egress restricted to api.example.com:443
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type:  MatchEgress,
+				FQDNs: []string{fqdn},
+				Ports: []Port{
+					{Protocol: TCP, Number: 443},
+				},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	clock := newFakeClock()
+	resolver := &fakeResolver{
+		ips: map[string][]net.IP{fqdn: {net.ParseIP(extIP1)}},
+	}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithClock(clock), WithFQDNResolver(resolver, ttl))
+	defer configurator.Close()
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Test with fake traffic.
+	action := renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP1), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP1), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP2), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// FQDN now resolves to a different IP address.
+	resolver.ips[fqdn] = []net.IP{net.ParseIP(extIP2)}
+	clock.Advance(ttl)
+
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP2), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP1), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Resolution fails - the last known good IP address is retained.
+	resolver.ips[fqdn] = []net.IP{net.ParseIP(extIP3)}
+	resolver.err = errors.New("resolution failure")
+	clock.Advance(ttl)
+
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP2), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP3), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Resolution recovers.
+	resolver.err = nil
+	clock.Advance(ttl)
+
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP3), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP2), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+}
+
+func TestFQDNNegativeCaching(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestFQDNNegativeCaching")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		fqdn      = "api.example.com"
+		extIP     = "93.184.216.34"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// egress restricted to api.example.com:443
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type:  MatchEgress,
+				FQDNs: []string{fqdn},
+				Ports: []Port{
+					{Protocol: TCP, Number: 443},
+				},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	clock := newFakeClock()
+	resolver := &fakeResolver{
+		ips: map[string][]net.IP{fqdn: {net.ParseIP(extIP)}},
+		err: errors.New("resolution failure"),
+	}
+
+	// Initialize configurator with zero TTL.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithClock(clock), WithFQDNResolver(resolver, 0))
+	defer configurator.Close()
+	gomega.Expect(configurator.fqdnTTL).To(gomega.Equal(minFQDNTTL))
+
+	// The resolver is called with the configurator unlocked.
+	lockedDuringLookup := false
+	resolver.onLookup = func() {
+		unlocked := make(chan struct{})
+		go func() {
+			configurator.ConfiguredPods()
+			close(unlocked)
+		}()
+		select {
+		case <-unlocked:
+		case <-time.After(time.Second):
+			lockedDuringLookup = true
+		}
+	}
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// The first resolution fails.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(resolver.lookups).To(gomega.Equal(1))
+	action := renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// The failure is cached until the next re-resolution.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(resolver.lookups).To(gomega.Equal(1))
+	action = renderer.TestTraffic(pod2, IngressTraffic,
+		parseIP(pod2IP), parseIP(extIP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Resolution recovers with the next re-resolution.
+	resolver.err = nil
+	clock.Advance(minFQDNTTL)
+	gomega.Expect(resolver.lookups).To(gomega.Equal(2))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP(extIP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod2, IngressTraffic,
+		parseIP(pod2IP), parseIP(extIP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(lockedDuringLookup).To(gomega.BeFalse())
+}
@@ -0,0 +1,79 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithStrictFragments selects how fragment rules generated for matches with
+// AllowFragments or DenyFragments are handled for renderers without
+// the renderer.FragmentMatching capability. By default such renderers are not
+// given the fragment rules. With strict fragments, the commit fails instead.
+func WithStrictFragments(strict bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.strictFragments = strict
+	}
+}
+
+// insertFragmentRules inserts rules permitting or denying non-initial
+// fragments of the traffic matched by rules[from:] (generated for one match)
+// in front of those rules. Fragments carry no L4 header, the fragment rules
+// are therefore not restricted by ports, TCP flags nor on L7.
+func (pct *PolicyConfiguratorTxn) insertFragmentRules(rules ContivRules, from int, fragments FragmentPolicy) ContivRules {
+	action := renderer.ActionPermit
+	if fragments == DenyFragments {
+		action = renderer.ActionDeny
+	}
+	withFragments := append(ContivRules{}, rules[:from]...)
+	for _, rule := range rules[from:] {
+		fragmentRule := rule.Copy()
+		fragmentRule.Action = action
+		fragmentRule.SrcPort = 0
+		fragmentRule.DestPort = 0
+		fragmentRule.L7 = nil
+		fragmentRule.TCPFlags = nil
+		fragmentRule.Fragments = renderer.FragmentsOnly
+		withFragments = pct.appendUniqueRule(withFragments, fragmentRule)
+	}
+	return append(withFragments, rules[from:]...)
+}
+
+// withoutFragmentRules returns the rules without those matching only fragments.
+// If there are no such rules, the same list is returned.
+func withoutFragmentRules(rules ContivRules) ContivRules {
+	if !hasFragmentRules(rules) {
+		return rules
+	}
+	filtered := ContivRules{}
+	for _, rule := range rules {
+		if rule.Fragments != renderer.FragmentsOnly {
+			filtered = append(filtered, rule)
+		}
+	}
+	return filtered
+}
+
+// hasFragmentRules returns true if any of the rules matches only fragments.
+func hasFragmentRules(rules ContivRules) bool {
+	for _, rule := range rules {
+		if rule.Fragments == renderer.FragmentsOnly {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestFragments(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestFragments")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed from pod2 on UDP:5000 including fragments,
+	// from pod3 on any port but without fragments
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:      MatchIngress,
+				Pods:      []podmodel.ID{pod2},
+				Ports:     []Port{{Protocol: UDP, Number: 5000}},
+				Fragments: AllowFragments,
+			},
+			{
+				Type:      MatchIngress,
+				Pods:      []podmodel.ID{pod3},
+				Fragments: DenyFragments,
+			},
+		},
+	}
+	gomega.Expect(policy1.Matches[0].String()).To(gomega.HaveSuffix(", Fragments:ALLOW-FRAGMENTS>"))
+	gomega.Expect(policy1.Matches[1].String()).To(gomega.HaveSuffix(", Fragments:DENY-FRAGMENTS>"))
+	gomega.Expect(Match{Type: MatchIngress}.String()).ToNot(gomega.ContainSubstring("Fragments"))
+
+	for _, strict := range []bool{false, true} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+		cache.AddPodConfig(pod3, pod3IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer1 := NewMockRenderer("A", logger)
+		renderer1.SetCapabilities(rendererAPI.FragmentMatching)
+		renderer2 := NewMockRenderer("B", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithStrictFragments(strict))
+
+		// Register two renderers.
+		err := configurator.RegisterRenderer(renderer1)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(renderer2)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		if strict {
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("FRAGMENT-MATCHING"))
+		} else {
+			gomega.Expect(err).To(gomega.BeNil())
+		}
+
+		// Renderer with the FragmentMatching capability receives a separate
+		// fragment rule for each match, in front of the match rules.
+		_, egress := renderer1.GetRules(pod1)
+		var fragmentRules []*rendererAPI.ContivRule
+		for idx, rule := range egress {
+			if rule.Fragments != rendererAPI.FragmentsOnly {
+				continue
+			}
+			fragmentRules = append(fragmentRules, rule)
+			gomega.Expect(rule.DestPort).To(gomega.BeZero())
+			gomega.Expect(rule.String()).To(gomega.ContainSubstring(" fragments"))
+			gomega.Expect(rule.RequiredCapabilities()).To(gomega.ContainElement(rendererAPI.FragmentMatching))
+			gomega.Expect(idx+1 < len(egress)).To(gomega.BeTrue())
+			gomega.Expect(egress[idx+1].SrcNetwork.String()).To(gomega.Equal(rule.SrcNetwork.String()))
+			gomega.Expect(egress[idx+1].Fragments).To(gomega.Equal(rendererAPI.AllPackets))
+		}
+		gomega.Expect(fragmentRules).To(gomega.HaveLen(2))
+		gomega.Expect(fragmentRules[0].SrcNetwork.String()).To(gomega.Equal(pod2IP + "/32"))
+		gomega.Expect(fragmentRules[0].Protocol).To(gomega.Equal(rendererAPI.UDP))
+		gomega.Expect(fragmentRules[0].Action).To(gomega.Equal(rendererAPI.ActionPermit))
+		gomega.Expect(fragmentRules[1].SrcNetwork.String()).To(gomega.Equal(pod3IP + "/32"))
+		gomega.Expect(fragmentRules[1].Action).To(gomega.Equal(rendererAPI.ActionDeny))
+
+		fragment := func(renderer *MockRenderer, peerIP string, protocol rendererAPI.ProtocolType) TrafficAction {
+			return renderer.TestFragment(pod1, EgressTraffic, parseIP(peerIP), parseIP(pod1IP), protocol)
+		}
+		gomega.Expect(fragment(renderer1, pod2IP, rendererAPI.UDP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(fragment(renderer1, pod2IP, rendererAPI.TCP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+		gomega.Expect(fragment(renderer1, pod3IP, rendererAPI.UDP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+		gomega.Expect(renderer1.TestTraffic(pod1, EgressTraffic, parseIP(pod2IP), parseIP(pod1IP),
+			rendererAPI.UDP, 123, 5000)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(renderer1.TestTraffic(pod1, EgressTraffic, parseIP(pod3IP), parseIP(pod1IP),
+			rendererAPI.TCP, 123, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+		if strict {
+			// Renderer without the capability is not given any rules.
+			ingress, egress := renderer2.GetRules(pod1)
+			gomega.Expect(ingress).To(gomega.BeEmpty())
+			gomega.Expect(egress).To(gomega.BeEmpty())
+			continue
+		}
+
+		// Renderer without the capability receives the rules without
+		// the fragment rules.
+		_, egress = renderer2.GetRules(pod1)
+		gomega.Expect(egress).ToNot(gomega.BeEmpty())
+		for _, rule := range egress {
+			gomega.Expect(rule.Fragments).To(gomega.Equal(rendererAPI.AllPackets))
+		}
+		gomega.Expect(renderer2.TestTraffic(pod1, EgressTraffic, parseIP(pod2IP), parseIP(pod1IP),
+			rendererAPI.UDP, 123, 5000)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(renderer2.TestTraffic(pod1, EgressTraffic, parseIP(pod3IP), parseIP(pod1IP),
+			rendererAPI.TCP, 123, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(renderer2.TestTraffic(pod1, EgressTraffic, parseIP(pod2IP), parseIP(pod1IP),
+			rendererAPI.UDP, 123, 5001)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+}
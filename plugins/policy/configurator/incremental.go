@@ -0,0 +1,123 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/contiv/vpp/plugins/policy/utils"
+)
+
+// Renderers with the renderer.IncrementalUpdate capability are given only
+// the changes of the pod rules (see renderer.DeltaTxn) whenever the rules
+// were rendered by the previous commit for the same IP address and
+// the change can be expressed as a delta. Full lists are passed for resync,
+// after a failed commit (the state of the renderer is not known), for pods
+// newly assigned to the renderer and whenever the deny-the-rest rule
+// would be added or removed.
+
+// previousRules returns the committed rules of the pod if the renderer
+// of the given index may be given a delta against them. Returns nil otherwise.
+func (pct *PolicyConfiguratorTxn) previousRules(pod podmodel.ID, idx int, podIP *net.IPNet) *PodRules {
+	pc := pct.configurator
+	if pct.resync || podIP == nil || !hasRenderer(pc.assignments[pod], idx) {
+		return nil
+	}
+	if _, lastErr := pc.LastCommitStatus(); lastErr != nil {
+		return nil
+	}
+	committedIP, hasIP := pc.podIPAddresses[pod]
+	if !hasIP || utils.CompareIPNets(committedIP, podIP) != 0 {
+		return nil
+	}
+	rules, hasRules := pc.rules[pod]
+	if !hasRules {
+		return nil
+	}
+	return &rules
+}
+
+// renderDelta renders the changes of the rules against the previous rules
+// if supported by the renderer. Returns false if the rules were not rendered.
+func (pc *PolicyConfigurator) renderDelta(rTxn renderer.Txn, idx int, pod podmodel.ID, podIP *net.IPNet,
+	ingress, egress ContivRules, previous *PodRules) bool {
+
+	if previous == nil || !hasCapability(pc.renderers[idx], renderer.IncrementalUpdate) {
+		return false
+	}
+	deltaTxn, isDeltaTxn := rTxn.(renderer.DeltaTxn)
+	if !isDeltaTxn {
+		return false
+	}
+	ingressDelta, ingressOk := ruleDelta(pc.rendererRules(pc.renderers[idx], previous.Ingress), ingress)
+	egressDelta, egressOk := ruleDelta(pc.rendererRules(pc.renderers[idx], previous.Egress), egress)
+	if !ingressOk || !egressOk {
+		return false
+	}
+	if !pc.sharedRules {
+		ingressDelta.Added = ContivRules(ingressDelta.Added).Copy()
+		egressDelta.Added = ContivRules(egressDelta.Added).Copy()
+	}
+	deltaTxn.RenderDelta(pod, podIP, ingressDelta, egressDelta)
+	return true
+}
+
+// ruleDelta computes the changes between the old and the new list of rules.
+// Returns false if the change cannot be expressed as a delta, i.e. the lists
+// do not end with the same (deny-the-rest) rule or the order of the other
+// rules matters (some of them deny traffic).
+func ruleDelta(oldRules, newRules ContivRules) (renderer.RuleDelta, bool) {
+	delta := renderer.RuleDelta{}
+	if len(oldRules) == 0 || len(newRules) == 0 {
+		return delta, len(oldRules) == len(newRules)
+	}
+	if deniesBeforeLast(oldRules) || deniesBeforeLast(newRules) {
+		return delta, false
+	}
+	oldLast, newLast := oldRules[len(oldRules)-1], newRules[len(newRules)-1]
+	if oldLast.Action != renderer.ActionDeny || oldLast.Compare(newLast) != 0 {
+		return delta, false
+	}
+	return ruleSetDiff(oldRules, newRules), true
+}
+
+// ruleSetDiff returns rules of the new list not present in the old one
+// (Added) and rules of the old list not present in the new one (Removed),
+// each in the order of its list.
+func ruleSetDiff(oldRules, newRules ContivRules) renderer.RuleDelta {
+	delta := renderer.RuleDelta{}
+	oldKeys := make(map[string]struct{}, len(oldRules))
+	for _, rule := range oldRules {
+		oldKeys[rule.String()] = struct{}{}
+	}
+	newKeys := make(map[string]struct{}, len(newRules))
+	for _, rule := range newRules {
+		key := rule.String()
+		newKeys[key] = struct{}{}
+		if _, isOld := oldKeys[key]; !isOld {
+			delta.Added = append(delta.Added, rule)
+		}
+	}
+	for _, rule := range oldRules {
+		if _, isNew := newKeys[rule.String()]; !isNew {
+			delta.Removed = append(delta.Removed, rule)
+		}
+	}
+	return delta
+}
@@ -0,0 +1,184 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// ruleKeys returns string representations of the rules.
+func ruleKeys(rules []*rendererAPI.ContivRule) []string {
+	keys := []string{}
+	for _, rule := range rules {
+		keys = append(keys, rule.String())
+	}
+	return keys
+}
+
+func TestIncrementalUpdates(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestIncrementalUpdates")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod1IP    = "192.168.1.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+
+	policy := func(ports ...uint16) *ContivPolicy {
+		match := Match{Type: MatchIngress}
+		for _, port := range ports {
+			match.Ports = append(match.Ports, Port{Protocol: TCP, Number: port})
+		}
+		return &ContivPolicy{
+			ID:      policymodel.ID{Name: "policy1", Namespace: namespace},
+			Type:    PolicyIngress,
+			Matches: []Match{match},
+		}
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	incRenderer := NewMockRenderer("A", logger)
+	incRenderer.SetCapabilities(rendererAPI.IncrementalUpdate)
+	fullRenderer := NewMockRenderer("B", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(incRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterRenderer(fullRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	commit := func(resync bool, policies ...*ContivPolicy) {
+		txn := configurator.NewTxn(resync)
+		txn.Configure(pod1, policies)
+		err := txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+	}
+	expectSameRules := func() {
+		incIngress, incEgress := incRenderer.GetRules(pod1)
+		fullIngress, fullEgress := fullRenderer.GetRules(pod1)
+		gomega.Expect(ruleKeys(incIngress)).To(gomega.ConsistOf(ruleKeys(fullIngress)))
+		gomega.Expect(ruleKeys(incEgress)).To(gomega.ConsistOf(ruleKeys(fullEgress)))
+		if len(fullEgress) > 0 {
+			// deny-the-rest stays the last
+			gomega.Expect(incEgress[len(incEgress)-1].String()).To(gomega.Equal(fullEgress[len(fullEgress)-1].String()))
+		}
+	}
+
+	// The first commit renders full lists.
+	commit(false, policy(80))
+	ingressDelta, egressDelta := incRenderer.GetRuleDeltas(pod1)
+	gomega.Expect(ingressDelta).To(gomega.BeNil())
+	gomega.Expect(egressDelta).To(gomega.BeNil())
+	expectSameRules()
+
+	// Single port added = single rule added.
+	commit(false, policy(80, 8080))
+	ingressDelta, egressDelta = incRenderer.GetRuleDeltas(pod1)
+	gomega.Expect(ingressDelta).ToNot(gomega.BeNil())
+	gomega.Expect(ingressDelta.IsEmpty()).To(gomega.BeTrue())
+	gomega.Expect(egressDelta).ToNot(gomega.BeNil())
+	gomega.Expect(egressDelta.Removed).To(gomega.BeEmpty())
+	gomega.Expect(egressDelta.Added).To(gomega.HaveLen(1))
+	gomega.Expect(egressDelta.Added[0].Protocol).To(gomega.Equal(rendererAPI.TCP))
+	gomega.Expect(egressDelta.Added[0].DestPort).To(gomega.BeEquivalentTo(8080))
+	expectSameRules()
+
+	// The other renderer gets the full lists.
+	ingressDelta, egressDelta = fullRenderer.GetRuleDeltas(pod1)
+	gomega.Expect(ingressDelta).To(gomega.BeNil())
+	gomega.Expect(egressDelta).To(gomega.BeNil())
+
+	// Single port removed = single rule removed.
+	commit(false, policy(8080))
+	_, egressDelta = incRenderer.GetRuleDeltas(pod1)
+	gomega.Expect(egressDelta).ToNot(gomega.BeNil())
+	gomega.Expect(egressDelta.Added).To(gomega.BeEmpty())
+	gomega.Expect(egressDelta.Removed).To(gomega.HaveLen(1))
+	gomega.Expect(egressDelta.Removed[0].DestPort).To(gomega.BeEquivalentTo(80))
+	expectSameRules()
+	gomega.Expect(incRenderer.TestTraffic(pod1, EgressTraffic,
+		parseIP("10.0.0.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(incRenderer.TestTraffic(pod1, EgressTraffic,
+		parseIP("10.0.0.1"), parseIP(pod1IP), rendererAPI.TCP, 123, 8080)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Resync renders full lists.
+	commit(true, policy(80, 8080))
+	ingressDelta, egressDelta = incRenderer.GetRuleDeltas(pod1)
+	gomega.Expect(ingressDelta).To(gomega.BeNil())
+	gomega.Expect(egressDelta).To(gomega.BeNil())
+	expectSameRules()
+
+	// Pod becoming unrestricted cannot be expressed by a delta.
+	commit(false)
+	ingressDelta, egressDelta = incRenderer.GetRuleDeltas(pod1)
+	gomega.Expect(ingressDelta).To(gomega.BeNil())
+	gomega.Expect(egressDelta).To(gomega.BeNil())
+	expectSameRules()
+
+	// Neither being restricted again.
+	commit(false, policy(80))
+	ingressDelta, egressDelta = incRenderer.GetRuleDeltas(pod1)
+	gomega.Expect(ingressDelta).To(gomega.BeNil())
+	gomega.Expect(egressDelta).To(gomega.BeNil())
+	expectSameRules()
+
+	// After a failed commit, the state of the renderer is not known.
+	fullRenderer.SetCommitError(errors.New("commit failed"))
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy(80, 443)})
+	err = txn.Commit()
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	fullRenderer.SetCommitError(nil)
+	commit(false, policy(80, 443, 8080))
+	ingressDelta, egressDelta = incRenderer.GetRuleDeltas(pod1)
+	gomega.Expect(ingressDelta).To(gomega.BeNil())
+	gomega.Expect(egressDelta).To(gomega.BeNil())
+	expectSameRules()
+}
@@ -0,0 +1,48 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+)
+
+// blockRules returns rules allowing traffic with a given IP block on the given
+// ports. Exceptions are subtracted from the block first and each of the remaining
+// subnets is then combined with every port. With permit-only rules carrying
+// a single port each, scoping the block by ports before the subtraction
+// would result in the very same rules, only in a different order. There is
+// therefore no ordering to choose from and none is exposed.
+func blockRules(direction MatchType, block IPBlock, ports []Port) ContivRules {
+	rules := ContivRules{}
+	for _, subnet := range subtractExcepts(block) {
+		rules = append(rules, subnetRules(direction, subnet, ports)...)
+	}
+	return rules
+}
+
+// subtractExcepts returns subnets covering the block without the exceptions.
+func subtractExcepts(block IPBlock) []*net.IPNet {
+	subnets := []*net.IPNet{&block.Network}
+	for _, except := range block.Except {
+		subtracted := []*net.IPNet{}
+		for _, subnet := range subnets {
+			subtracted = append(subtracted, subtractSubnet(subnet, &except)...)
+		}
+		subnets = subtracted
+	}
+	return subnets
+}
@@ -0,0 +1,136 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestIPBlockRules(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestIPBlockRules")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod1IP    = "192.168.1.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+
+	// 10.0.0.0/24 without 3 excepts, each on 4 ports.
+	block := IPBlock{
+		Network: *ipNetwork("10.0.0.0/24"),
+		Except: []net.IPNet{
+			*ipNetwork("10.0.0.1/32"),
+			*ipNetwork("10.0.0.128/25"),
+			*ipNetwork("10.0.0.64/28"),
+		},
+	}
+	ports := []Port{
+		{Protocol: TCP, Number: 80},
+		{Protocol: TCP, Number: 443},
+		{Protocol: UDP, Number: 53},
+		{Protocol: UDP, Number: 123},
+	}
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type:     MatchEgress,
+				IPBlocks: []IPBlock{block},
+				Ports:    ports,
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Each subnet remaining after the subtraction is combined with every port.
+	gomega.Expect(blockRules(MatchEgress, block, ports)).To(gomega.HaveLen(8 * len(ports)))
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// 8 subnets remain after the subtraction, each combined with 4 ports,
+	// plus the deny-the-rest rule.
+	ingress, _ := renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.HaveLen(8*len(ports) + 1))
+
+	// Test with fake traffic.
+	action := renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP("10.0.0.2"), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP("10.0.0.100"), rendererAPI.UDP, 123, 123)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP("10.0.0.2"), rendererAPI.TCP, 123, 22)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	for _, except := range []string{"10.0.0.1", "10.0.0.200", "10.0.0.70"} {
+		for _, port := range ports {
+			protocol := rendererAPI.TCP
+			if port.Protocol == UDP {
+				protocol = rendererAPI.UDP
+			}
+			action = renderer.TestTraffic(pod1, IngressTraffic,
+				parseIP(pod1IP), parseIP(except), protocol, 123, port.Number)
+			gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+		}
+	}
+}
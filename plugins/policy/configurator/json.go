@@ -0,0 +1,119 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// JSON encoding of IP networks and masks. The address is given in the usual
+// text form and the mask in hex (it need not be contiguous), e.g.
+// "10.0.0.0/ffffff00". The length of the mask selects the length of the decoded
+// address, hence even IPv4 networks with 16-byte masks are decoded exactly.
+
+// MarshalJSON encodes the IP block as JSON.
+func (ipb IPBlock) MarshalJSON() ([]byte, error) {
+	except := make([]string, 0, len(ipb.Except))
+	for _, ipNet := range ipb.Except {
+		except = append(except, formatMaskedIP(ipNet.IP, ipNet.Mask))
+	}
+	return json.Marshal(struct {
+		Network string
+		Except  []string
+	}{
+		Network: formatMaskedIP(ipb.Network.IP, ipb.Network.Mask),
+		Except:  except,
+	})
+}
+
+// UnmarshalJSON decodes the IP block from JSON produced by MarshalJSON.
+func (ipb *IPBlock) UnmarshalJSON(data []byte) error {
+	var encoded struct {
+		Network string
+		Except  []string
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	ip, mask, err := parseMaskedIP(encoded.Network)
+	if err != nil {
+		return err
+	}
+	block := IPBlock{Network: net.IPNet{IP: ip, Mask: mask}}
+	for _, except := range encoded.Except {
+		ip, mask, err := parseMaskedIP(except)
+		if err != nil {
+			return err
+		}
+		block.Except = append(block.Except, net.IPNet{IP: ip, Mask: mask})
+	}
+	*ipb = block
+	return nil
+}
+
+// MarshalJSON encodes the IP mask as JSON string.
+func (ipm IPMask) MarshalJSON() ([]byte, error) {
+	return json.Marshal(formatMaskedIP(ipm.Address, ipm.Mask))
+}
+
+// UnmarshalJSON decodes the IP mask from JSON produced by MarshalJSON.
+func (ipm *IPMask) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	ip, mask, err := parseMaskedIP(encoded)
+	if err != nil {
+		return err
+	}
+	*ipm = IPMask{Address: ip, Mask: mask}
+	return nil
+}
+
+// formatMaskedIP returns "<ip>/<hex-mask>", or empty string if both are unset.
+func formatMaskedIP(ip net.IP, mask net.IPMask) string {
+	if len(ip) == 0 && len(mask) == 0 {
+		return ""
+	}
+	return ip.String() + "/" + hex.EncodeToString(mask)
+}
+
+// parseMaskedIP parses the output of formatMaskedIP.
+func parseMaskedIP(s string) (net.IP, net.IPMask, error) {
+	if s == "" {
+		return nil, nil, nil
+	}
+	slash := strings.LastIndex(s, "/")
+	if slash < 0 {
+		return nil, nil, fmt.Errorf("invalid masked IP address: %q", s)
+	}
+	ip := net.ParseIP(s[:slash])
+	mask, err := hex.DecodeString(s[slash+1:])
+	if ip == nil || err != nil || (len(mask) != net.IPv4len && len(mask) != net.IPv6len) {
+		return nil, nil, fmt.Errorf("invalid masked IP address: %q", s)
+	}
+	if len(mask) == net.IPv4len {
+		if ip = ip.To4(); ip == nil {
+			return nil, nil, fmt.Errorf("IPv6 address with IPv4 mask: %q", s)
+		}
+	}
+	return ip, mask, nil
+}
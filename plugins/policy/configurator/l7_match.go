@@ -0,0 +1,62 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithStrictL7 selects how L7 matches (Match.L7) are handled for renderers
+// without the renderer.L7Filtering capability. By default the L7 matches
+// are not passed to such renderers and the traffic is allowed at L4.
+// With strict L7, the commit fails instead.
+func WithStrictL7(strict bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.strictL7 = strict
+	}
+}
+
+// rendererL7Match converts L7 match into the renderer representation.
+func rendererL7Match(l7 *L7Match) *renderer.L7Match {
+	if l7 == nil {
+		return nil
+	}
+	return &renderer.L7Match{
+		Method:     l7.Method,
+		PathPrefix: l7.PathPrefix,
+		Host:       l7.Host,
+	}
+}
+
+// withoutL7Matches returns the rules with L7 matches removed. Rules which
+// become duplicates are skipped. If none of the rules is restricted on L7,
+// the same list is returned.
+func withoutL7Matches(rules ContivRules) ContivRules {
+	return withoutRuleFeature(rules,
+		func(rule *renderer.ContivRule) bool { return rule.L7 != nil },
+		func(rule *renderer.ContivRule) { rule.L7 = nil })
+}
+
+// hasL7Matches returns true if any of the rules is restricted on L7.
+func hasL7Matches(rules ContivRules) bool {
+	for _, rule := range rules {
+		if rule.L7 != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestL7Match(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestL7Match")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed from pod2 (GET /api/ only) and from pod3 (any request)
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+				L7:    &L7Match{Method: "GET", PathPrefix: "/api/"},
+			},
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod3},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	gomega.Expect(policy1.Matches[0].String()).To(
+		gomega.HaveSuffix(", L7:<Method:GET, PathPrefix:/api/, Host:>>"))
+	gomega.Expect(policy1.Matches[1].String()).ToNot(gomega.ContainSubstring("L7"))
+	gomega.Expect(policy1.DeepCopy().Matches[0].L7).ToNot(gomega.BeIdenticalTo(policy1.Matches[0].L7))
+
+	for _, strict := range []bool{false, true} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+		cache.AddPodConfig(pod3, pod3IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer1 := NewMockRenderer("A", logger)
+		renderer1.SetCapabilities(rendererAPI.L7Filtering)
+		renderer2 := NewMockRenderer("B", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithStrictL7(strict))
+
+		// Register two renderers.
+		err := configurator.RegisterRenderer(renderer1)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(renderer2)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		if strict {
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("L7-FILTERING"))
+		} else {
+			gomega.Expect(err).To(gomega.BeNil())
+		}
+
+		// L7-capable renderer receives the hint only for the rule of the match
+		// with the L7 qualifier.
+		_, egress := renderer1.GetRules(pod1)
+		restricted := 0
+		for _, rule := range egress {
+			if rule.L7 == nil {
+				continue
+			}
+			restricted++
+			gomega.Expect(rule.SrcNetwork.String()).To(gomega.Equal(pod2IP + "/32"))
+			gomega.Expect(rule.DestPort).To(gomega.BeEquivalentTo(80))
+			gomega.Expect(rule.String()).To(gomega.HaveSuffix(" l7=GET ANY/api/*>"))
+			gomega.Expect(*rule.L7).To(gomega.Equal(rendererAPI.L7Match{Method: "GET", PathPrefix: "/api/"}))
+			gomega.Expect(rule.RequiredCapabilities()).To(gomega.ConsistOf(rendererAPI.L7Filtering))
+		}
+		gomega.Expect(restricted).To(gomega.Equal(1))
+		action := renderer1.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod3IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+		if strict {
+			// Renderer without the capability is not given any rules.
+			ingress, egress := renderer2.GetRules(pod1)
+			gomega.Expect(ingress).To(gomega.BeEmpty())
+			gomega.Expect(egress).To(gomega.BeEmpty())
+			continue
+		}
+
+		// L4-only renderer applies the L4 portion of the match.
+		_, egress = renderer2.GetRules(pod1)
+		gomega.Expect(egress).ToNot(gomega.BeEmpty())
+		for _, rule := range egress {
+			gomega.Expect(rule.L7).To(gomega.BeNil())
+		}
+		action = renderer2.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer2.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 81)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+}
+
+func TestCompareL7Matches(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	anyRequest := &rendererAPI.ContivRule{Action: rendererAPI.ActionPermit, Protocol: rendererAPI.TCP,
+		SrcNetwork: ipNetwork("10.0.0.0/8"), DestNetwork: ipNetwork(""), DestPort: 80}
+	anyMethod := anyRequest.Copy()
+	anyMethod.L7 = &rendererAPI.L7Match{PathPrefix: "/api/"}
+	get := anyRequest.Copy()
+	get.L7 = &rendererAPI.L7Match{Method: "GET", PathPrefix: "/api/"}
+	getLonger := anyRequest.Copy()
+	getLonger.L7 = &rendererAPI.L7Match{Method: "GET", PathPrefix: "/api/v1/"}
+
+	gomega.Expect(get.Compare(anyMethod)).To(gomega.Equal(-1))
+	gomega.Expect(anyMethod.Compare(anyRequest)).To(gomega.Equal(-1))
+	gomega.Expect(getLonger.Compare(get)).To(gomega.Equal(-1))
+	gomega.Expect(anyRequest.Compare(get)).To(gomega.Equal(1))
+	gomega.Expect(get.Compare(get.Copy())).To(gomega.Equal(0))
+	gomega.Expect(get.Copy().L7).ToNot(gomega.BeIdenticalTo(get.L7))
+}
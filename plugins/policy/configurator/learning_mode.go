@@ -0,0 +1,120 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// suggestedPolicyPrefix is prepended to the pod name to obtain the name
+// of the policy returned by SuggestPolicy().
+const suggestedPolicyPrefix = "suggested-"
+
+// observedFlow is a flow of a pod passed to IngestObservedFlow().
+type observedFlow struct {
+	direction MatchType
+	peer      string // one-host subnet
+	port      Port
+}
+
+// WithLearningMode enables recording of flows passed to IngestObservedFlow(),
+// from which a policy allowing exactly the observed traffic can be suggested
+// by SuggestPolicy(). The learning mode is only an aid for authoring policies,
+// the observed flows have no effect on the rendered rules.
+func WithLearningMode() Option {
+	return func(pc *PolicyConfigurator) {
+		pc.observedFlows = make(map[podmodel.ID]map[observedFlow]struct{})
+	}
+}
+
+// IngestObservedFlow records a flow of the pod with the given peer in the given
+// direction (from the pod point of view), destined to the given port
+// (port of the peer for egress, port of the pod for ingress; zero for all
+// ports). The flow is ignored if the learning mode is not enabled
+// (see WithLearningMode).
+func (pc *PolicyConfigurator) IngestObservedFlow(pod podmodel.ID, direction MatchType, peer net.IP,
+	proto ProtocolType, port uint16) {
+
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.observedFlows == nil {
+		return
+	}
+	peerNet := pc.hostSubnet(peer.String())
+	if peerNet == nil {
+		pc.Log.WithFields(logging.Fields{
+			"pod":  pc.logPod(pod),
+			"peer": peer,
+		}).Warn("Ignoring observed flow with invalid peer IP address")
+		return
+	}
+	flows, hasFlows := pc.observedFlows[pod]
+	if !hasFlows {
+		flows = make(map[observedFlow]struct{})
+		pc.observedFlows[pod] = flows
+	}
+	flows[observedFlow{
+		direction: direction,
+		peer:      peerNet.String(),
+		port:      Port{Protocol: proto, Number: port},
+	}] = struct{}{}
+}
+
+// SuggestPolicy returns a policy for the pod allowing exactly the flows
+// recorded by IngestObservedFlow(), in the normalized form. Peers with
+// the same set of observed ports share a single match. Returns nil if no
+// flows were observed for the pod.
+func (pc *PolicyConfigurator) SuggestPolicy(pod podmodel.ID) *ContivPolicy {
+	pc.Lock()
+	defer pc.Unlock()
+	flows := pc.observedFlows[pod]
+	if len(flows) == 0 {
+		return nil
+	}
+
+	// Collect the observed flows of each direction.
+	directionFlows := make(map[MatchType][]FlowSpec)
+	for flow := range flows {
+		_, peerNet, _ := net.ParseCIDR(flow.peer)
+		directionFlows[flow.direction] = append(directionFlows[flow.direction], FlowSpec{
+			Peer:     *peerNet,
+			Protocol: flow.port.Protocol,
+			Port:     flow.port.Number,
+		})
+	}
+
+	policy := &ContivPolicy{
+		ID: policymodel.ID{Name: suggestedPolicyPrefix + pod.Name, Namespace: pod.Namespace},
+	}
+	for _, direction := range []MatchType{MatchIngress, MatchEgress} {
+		policy.Matches = append(policy.Matches, synthesizeMatches(direction, directionFlows[direction])...)
+	}
+	switch {
+	case len(directionFlows[MatchEgress]) == 0:
+		policy.Type = PolicyIngress
+	case len(directionFlows[MatchIngress]) == 0:
+		policy.Type = PolicyEgress
+	default:
+		policy.Type = PolicyAll
+	}
+	return policy.Normalize()
+}
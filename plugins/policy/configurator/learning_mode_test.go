@@ -0,0 +1,156 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestLearningMode(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestLearningMode")
+
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		peer1IP   = "10.0.0.1"
+		peer2IP   = "10.0.0.2"
+		peer3IP   = "10.0.0.3"
+		otherIP   = "10.0.0.4"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithLearningMode())
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Nothing observed yet.
+	gomega.Expect(configurator.SuggestPolicy(pod1)).To(gomega.BeNil())
+
+	configurator.IngestObservedFlow(pod1, MatchIngress, net.ParseIP(peer1IP), TCP, 80)
+	configurator.IngestObservedFlow(pod1, MatchIngress, net.ParseIP(peer2IP), TCP, 80)
+	configurator.IngestObservedFlow(pod1, MatchIngress, net.ParseIP(peer1IP), TCP, 80) /* duplicate */
+	configurator.IngestObservedFlow(pod1, MatchEgress, net.ParseIP(peer3IP), UDP, 53)
+	configurator.IngestObservedFlow(pod1, MatchEgress, net.ParseIP(peer3IP), TCP, 443)
+
+	// Peers with the same ports share a match.
+	suggested := configurator.SuggestPolicy(pod1)
+	expected := &ContivPolicy{
+		ID:   policymodel.ID{Name: "suggested-pod1", Namespace: namespace},
+		Type: PolicyAll,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				IPBlocks: []IPBlock{
+					{Network: parseIPNet(peer1IP + "/32")},
+					{Network: parseIPNet(peer2IP + "/32")},
+				},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type: MatchEgress,
+				IPBlocks: []IPBlock{
+					{Network: parseIPNet(peer3IP + "/32")},
+				},
+				Ports: []Port{
+					{Protocol: TCP, Number: 443},
+					{Protocol: UDP, Number: 53},
+				},
+			},
+		},
+	}
+	gomega.Expect(suggested.String()).To(gomega.Equal(expected.Normalize().String()))
+	gomega.Expect(suggested.String()).To(gomega.Equal(suggested.Normalize().String()))
+	gomega.Expect(configurator.SuggestPolicy(pod2)).To(gomega.BeNil())
+
+	// The suggested policy allows precisely the observed flows.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{suggested})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	for _, traffic := range []struct {
+		srcIP, dstIP string
+		direction    TrafficDirection
+		proto        rendererAPI.ProtocolType
+		dstPort      uint16
+		action       TrafficAction
+	}{
+		{peer1IP, pod1IP, EgressTraffic, rendererAPI.TCP, 80, AllowedTraffic},
+		{peer2IP, pod1IP, EgressTraffic, rendererAPI.TCP, 80, AllowedTraffic},
+		{peer1IP, pod1IP, EgressTraffic, rendererAPI.TCP, 81, DeniedTraffic},
+		{peer3IP, pod1IP, EgressTraffic, rendererAPI.TCP, 80, DeniedTraffic},
+		{otherIP, pod1IP, EgressTraffic, rendererAPI.TCP, 80, DeniedTraffic},
+		{pod1IP, peer3IP, IngressTraffic, rendererAPI.UDP, 53, AllowedTraffic},
+		{pod1IP, peer3IP, IngressTraffic, rendererAPI.TCP, 443, AllowedTraffic},
+		{pod1IP, peer3IP, IngressTraffic, rendererAPI.TCP, 53, DeniedTraffic},
+		{pod1IP, peer1IP, IngressTraffic, rendererAPI.UDP, 53, DeniedTraffic},
+	} {
+		action := renderer.TestTraffic(pod1, traffic.direction,
+			parseIP(traffic.srcIP), parseIP(traffic.dstIP), traffic.proto, 1024, traffic.dstPort)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(traffic.action))
+	}
+
+	// All-ports flow covers the specific ports of the protocol.
+	configurator.IngestObservedFlow(pod1, MatchEgress, net.ParseIP(peer3IP), TCP, 0)
+	suggested = configurator.SuggestPolicy(pod1)
+	gomega.Expect(suggested.Matches).To(gomega.HaveLen(2))
+	for _, match := range suggested.Matches {
+		if match.Type == MatchEgress {
+			gomega.Expect(match.Ports).To(gomega.Equal(
+				[]Port{{Protocol: TCP, Number: 0}, {Protocol: UDP, Number: 53}}))
+		}
+	}
+
+	// Flows are not recorded without the learning mode.
+	defaultConfigurator := &PolicyConfigurator{Deps: Deps{Log: logger, Cache: cache, Contiv: contiv}}
+	defaultConfigurator.Init(false)
+	defaultConfigurator.IngestObservedFlow(pod1, MatchIngress, net.ParseIP(peer1IP), TCP, 80)
+	gomega.Expect(defaultConfigurator.SuggestPolicy(pod1)).To(gomega.BeNil())
+}
@@ -0,0 +1,203 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"time"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+const day = 24 * time.Hour
+
+// MaintenanceWindow is a daily recurring period of time during which
+// the changes are allowed to be applied.
+type MaintenanceWindow struct {
+	// Start of the window as the time since midnight UTC.
+	Start time.Duration
+
+	// Duration of the window. Windows of 24 hours or longer are always open.
+	Duration time.Duration
+}
+
+// WithMaintenanceWindow defers transactions committed outside of the given
+// maintenance window. Commit() of such transaction only enqueues the changes
+// and returns nil; the queued changes are applied when the window opens
+// (or with the next Commit() inside the window). Queued changes of the same pod
+// collapse into the latest one. A queued resync transaction replaces everything
+// queued before it, changes queued after a resync are merged into it.
+// Sources removed by RemoveBySource() apply to the whole merged queue,
+// including policies queued afterwards.
+// Changes triggered internally from the committed configuration (delayed
+// teardowns, policy expiration, DNS, FQDN and API server refreshes)
+// are applied immediately. While the configurator is read-only, the queue
+// is not flushed and waits for the next window. Queued changes are discarded
+// by Close().
+// The window is evaluated against the clock of the configurator (see WithClock).
+// Window with non-positive duration is ignored.
+func WithMaintenanceWindow(window MaintenanceWindow) Option {
+	return func(pc *PolicyConfigurator) {
+		if window.Duration <= 0 {
+			pc.window = nil
+			return
+		}
+		pc.window = &window
+	}
+}
+
+// isOpen returns true if the time is inside the window.
+func (mw *MaintenanceWindow) isOpen(t time.Time) bool {
+	if mw.Duration >= day {
+		return true
+	}
+	midnight := t.UTC().Truncate(day)
+	for _, dayOffset := range []time.Duration{-day, 0} {
+		start := midnight.Add(dayOffset + mw.startOffset())
+		if !t.Before(start) && t.Before(start.Add(mw.Duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+// startOffset returns the start of the window normalized into <0, 24h).
+func (mw *MaintenanceWindow) startOffset() time.Duration {
+	offset := mw.Start % day
+	if offset < 0 {
+		offset += day
+	}
+	return offset
+}
+
+// nextStart returns the earliest start of the window after the given time.
+func (mw *MaintenanceWindow) nextStart(t time.Time) time.Time {
+	start := t.UTC().Truncate(day).Add(mw.startOffset())
+	if !start.After(t) {
+		start = start.Add(day)
+	}
+	return start
+}
+
+// QueuedPods returns IDs of pods with changes queued until the maintenance
+// window opens, sorted by namespace and name. For a queued resync transaction
+// the pods it configures are returned.
+func (pc *PolicyConfigurator) QueuedPods() []podmodel.ID {
+	pc.Lock()
+	defer pc.Unlock()
+	pods := []podmodel.ID{}
+	if pc.queued != nil {
+		for pod := range pc.queued.config {
+			pods = append(pods, pod)
+		}
+	}
+	sortPodIDs(pods)
+	return pods
+}
+
+// commitInWindow implements Commit() with the maintenance window configured.
+// The configurator is expected to be locked by the caller.
+func (pct *PolicyConfiguratorTxn) commitInWindow() error {
+	pc := pct.configurator
+	pc.enqueue(pct)
+	now := pc.clock.Now()
+	if !pc.window.isOpen(now) {
+		pct.Log.WithField("pods", len(pc.queued.config)).Info(
+			"Outside of the maintenance window, deferring the commit")
+		pc.scheduleWindowOpening(now)
+		return nil
+	}
+	return pc.flushQueued()
+}
+
+// enqueue merges the transaction into the queue.
+func (pc *PolicyConfigurator) enqueue(pct *PolicyConfiguratorTxn) {
+	pc.queued = pc.mergeTxn(pc.queued, pct)
+}
+
+// mergeTxn merges the transaction into the queued one (nil if nothing
+// is queued yet) and returns the merged transaction.
+func (pc *PolicyConfigurator) mergeTxn(queued, pct *PolicyConfiguratorTxn) *PolicyConfiguratorTxn {
+	if queued == nil || pct.resync {
+		queued = pc.NewTxn(pct.resync).(*PolicyConfiguratorTxn)
+	}
+	queued.mergeResyncScopes(pct)
+	for pod, policies := range pct.config {
+		queued.config[pod] = policies
+	}
+	queued.removedSources = append(queued.removedSources, pct.removedSources...)
+	for _, id := range pct.correlationIDs {
+		queued.WithCorrelationID(id)
+	}
+	for policy, enabled := range pct.toggledPolicies {
+		queued.SetPolicyEnabled(policy, enabled)
+	}
+	for policy := range pct.unpinnedPolicies {
+		queued.UnpinPolicy(policy)
+	}
+	return queued
+}
+
+// scheduleWindowOpening schedules the flush of the queue for the next
+// opening of the window, unless already scheduled.
+func (pc *PolicyConfigurator) scheduleWindowOpening(now time.Time) {
+	if pc.windowTimer != nil {
+		return
+	}
+	pc.windowTimer = pc.afterFunc(pc.window.nextStart(now).Sub(now), pc.openWindow)
+}
+
+// openWindow applies the queued changes when the window opens.
+func (pc *PolicyConfigurator) openWindow(generation uint64) {
+	pc.Lock()
+	defer pc.Unlock()
+	if !pc.windowTimer.owns(generation) {
+		/* cancelled or re-scheduled in the meantime */
+		return
+	}
+	pc.windowTimer = nil
+
+	now := pc.clock.Now()
+	if pc.readOnly || !pc.window.isOpen(now) {
+		pc.Log.Info("Queued changes not applied, waiting for the next maintenance window")
+		pc.scheduleWindowOpening(now)
+		return
+	}
+	if err := pc.flushQueued(); err != nil {
+		pc.Log.WithField("err", err).Error("Failed to apply changes queued for the maintenance window")
+	}
+}
+
+// flushQueued commits the queued changes.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) flushQueued() error {
+	if pc.windowTimer != nil {
+		pc.windowTimer.Stop()
+		pc.windowTimer = nil
+	}
+	txn := pc.queued
+	pc.queued = nil
+	if txn == nil {
+		return nil
+	}
+	pc.Log.WithFields(logging.Fields{
+		"pods":   len(txn.config),
+		"resync": txn.resync,
+	}).Info("Applying changes in the maintenance window")
+	return txn.commit()
+}
@@ -0,0 +1,194 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestMaintenanceWindowIsOpen(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	midnight := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 02:00 - 03:00
+	window := &MaintenanceWindow{Start: 2 * time.Hour, Duration: time.Hour}
+	gomega.Expect(window.isOpen(midnight)).To(gomega.BeFalse())
+	gomega.Expect(window.isOpen(midnight.Add(2 * time.Hour))).To(gomega.BeTrue())
+	gomega.Expect(window.isOpen(midnight.Add(3*time.Hour - time.Second))).To(gomega.BeTrue())
+	gomega.Expect(window.isOpen(midnight.Add(3 * time.Hour))).To(gomega.BeFalse())
+	gomega.Expect(window.nextStart(midnight)).To(gomega.Equal(midnight.Add(2 * time.Hour)))
+	gomega.Expect(window.nextStart(midnight.Add(2 * time.Hour))).To(gomega.Equal(midnight.Add(26 * time.Hour)))
+
+	// 23:00 - 01:00, across midnight
+	window = &MaintenanceWindow{Start: 23 * time.Hour, Duration: 2 * time.Hour}
+	gomega.Expect(window.isOpen(midnight.Add(30 * time.Minute))).To(gomega.BeTrue())
+	gomega.Expect(window.isOpen(midnight.Add(time.Hour))).To(gomega.BeFalse())
+	gomega.Expect(window.isOpen(midnight.Add(23 * time.Hour))).To(gomega.BeTrue())
+	gomega.Expect(window.nextStart(midnight.Add(time.Hour))).To(gomega.Equal(midnight.Add(23 * time.Hour)))
+
+	// always open
+	window = &MaintenanceWindow{Duration: 24 * time.Hour}
+	gomega.Expect(window.isOpen(midnight.Add(13 * time.Hour))).To(gomega.BeTrue())
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestMaintenanceWindow")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	clock := newFakeClock() // midnight
+
+	// Initialize configurator with window 02:00 - 03:00.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithClock(clock),
+		WithMaintenanceWindow(MaintenanceWindow{Start: 2 * time.Hour, Duration: time.Hour}))
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	testTraffic := func(pod podmodel.ID, podIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(pod2IP), parseIP(podIP), rendererAPI.TCP, 123, port)
+	}
+
+	// Commits outside of the window are deferred.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	gomega.Expect(configurator.QueuedPods()).To(gomega.Equal([]podmodel.ID{pod1, pod2}))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.BeEmpty())
+	gomega.Expect(testTraffic(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+
+	clock.Advance(time.Hour)
+	gomega.Expect(configurator.QueuedPods()).To(gomega.HaveLen(2))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.BeEmpty())
+
+	// The window opens, the queue collapsed to the latest changes is applied.
+	clock.Advance(time.Hour)
+	gomega.Expect(configurator.QueuedPods()).To(gomega.BeEmpty())
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{pod1, pod2}))
+	gomega.Expect(testTraffic(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(pod1, pod1IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Commits inside the window are applied immediately.
+	clock.Advance(30 * time.Minute)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.QueuedPods()).To(gomega.BeEmpty())
+	gomega.Expect(testTraffic(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// The window closes at 03:00, the next one opens at 02:00 next day.
+	clock.Advance(time.Hour)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.QueuedPods()).To(gomega.Equal([]podmodel.ID{pod1}))
+	gomega.Expect(testTraffic(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	clock.Advance(22*time.Hour + 29*time.Minute)
+	gomega.Expect(configurator.QueuedPods()).To(gomega.HaveLen(1))
+	clock.Advance(time.Minute)
+	gomega.Expect(configurator.QueuedPods()).To(gomega.BeEmpty())
+	gomega.Expect(testTraffic(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+
+	// Queued changes are discarded by Close().
+	clock.Advance(2 * time.Hour)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.Close()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.QueuedPods()).To(gomega.BeEmpty())
+	clock.Advance(24 * time.Hour)
+	gomega.Expect(testTraffic(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+}
@@ -0,0 +1,139 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"bytes"
+	"net"
+	"strings"
+
+	"github.com/contiv/vpp/plugins/policy/utils"
+)
+
+// MappedAddressHandling selects how IPv4-mapped IPv6 addresses
+// (::ffff:a.b.c.d) in policies and pod IPs are treated by the configurator
+// (see WithMappedAddresses).
+type MappedAddressHandling int
+
+const (
+	// MappedAsIPv4 converts IPv4-mapped IPv6 addresses and networks inside
+	// ::ffff:0:0/96 into their IPv4 form (e.g. ::ffff:10.0.0.0/104 into
+	// 10.0.0.0/8), so that they produce the same rules as the IPv4 input.
+	MappedAsIPv4 MappedAddressHandling = iota
+
+	// MappedAsIPv6 keeps IPv4-mapped addresses as IPv6, i.e. they belong
+	// to the IPv6 address family.
+	MappedAsIPv6
+)
+
+// mappedPrefix is the prefix of IPv4-mapped IPv6 addresses (::ffff:0:0/96).
+var mappedPrefix = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}
+
+// mappedPrefixLen is the length of the prefix of IPv4-mapped IPv6 addresses
+// in bits.
+const mappedPrefixLen = 96
+
+// String converts MappedAddressHandling into a human-readable string.
+func (mah MappedAddressHandling) String() string {
+	switch mah {
+	case MappedAsIPv4:
+		return "MAPPED-AS-IPv4"
+	case MappedAsIPv6:
+		return "MAPPED-AS-IPv6"
+	}
+	return "INVALID"
+}
+
+// WithMappedAddresses selects how IPv4-mapped IPv6 addresses are handled.
+// Default is MappedAsIPv4.
+func WithMappedAddresses(handling MappedAddressHandling) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.mappedAddresses = handling
+	}
+}
+
+// canonicalPolicies converts IPv4-mapped IPv6 networks and masks
+// of the policies according to WithMappedAddresses. The policies
+// are modified in-place and are expected to be deep copies.
+func (pc *PolicyConfigurator) canonicalPolicies(policies ContivPolicies) ContivPolicies {
+	if pc.mappedAddresses != MappedAsIPv4 {
+		return policies
+	}
+	for _, policy := range policies {
+		for matchIdx := range policy.Matches {
+			match := &policy.Matches[matchIdx]
+			for blockIdx := range match.IPBlocks {
+				block := &match.IPBlocks[blockIdx]
+				block.Network = mappedNetToIPv4(block.Network)
+				for exceptIdx := range block.Except {
+					block.Except[exceptIdx] = mappedNetToIPv4(block.Except[exceptIdx])
+				}
+			}
+			for maskIdx := range match.IPMasks {
+				match.IPMasks[maskIdx] = mappedMaskToIPv4(match.IPMasks[maskIdx])
+			}
+		}
+	}
+	return policies
+}
+
+// hostSubnet returns the one-host subnet of the given pod IP address
+// (nil if invalid) with IPv4-mapped addresses handled according to
+// WithMappedAddresses.
+func (pc *PolicyConfigurator) hostSubnet(address string) *net.IPNet {
+	ipNet := utils.GetOneHostSubnet(address)
+	if ipNet == nil || pc.mappedAddresses != MappedAsIPv6 {
+		// IPv4 subnet for the mapped address as well
+		return ipNet
+	}
+	if ipNet.IP.To4() != nil && strings.Contains(address, ":") {
+		ipNet.Mask = net.CIDRMask(net.IPv6len*8, net.IPv6len*8)
+	}
+	return ipNet
+}
+
+// mappedNetToIPv4 returns IPv4 form of an IPv4-mapped IPv6 network.
+// Other networks are returned unchanged.
+func mappedNetToIPv4(ipNet net.IPNet) net.IPNet {
+	ones, bits := ipNet.Mask.Size()
+	if bits != net.IPv6len*8 || ones < mappedPrefixLen || len(ipNet.IP) != net.IPv6len ||
+		!bytes.Equal(ipNet.IP[:len(mappedPrefix)], mappedPrefix) {
+		return ipNet
+	}
+	return net.IPNet{
+		IP:   ipNet.IP.To4(),
+		Mask: net.CIDRMask(ones-mappedPrefixLen, net.IPv4len*8),
+	}
+}
+
+// mappedMaskToIPv4 returns IPv4 form of an IP mask selecting only
+// IPv4-mapped IPv6 addresses. Other masks are returned unchanged.
+func mappedMaskToIPv4(mask IPMask) IPMask {
+	if len(mask.Mask) != net.IPv6len || len(mask.Address) != net.IPv6len ||
+		!bytes.Equal(mask.Address[:len(mappedPrefix)], mappedPrefix) {
+		return mask
+	}
+	for _, maskByte := range mask.Mask[:len(mappedPrefix)] {
+		if maskByte != 0xff {
+			return mask
+		}
+	}
+	return IPMask{
+		Address: mask.Address.To4(),
+		Mask:    mask.Mask[len(mappedPrefix):],
+	}
+}
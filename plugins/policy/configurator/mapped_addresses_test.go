@@ -0,0 +1,174 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestMappedNetToIPv4(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	mapped := mappedNetToIPv4(parseIPNet("::ffff:10.0.0.0/104"))
+	gomega.Expect(mapped.IP).To(gomega.HaveLen(net.IPv4len))
+	gomega.Expect(mapped.Mask).To(gomega.HaveLen(net.IPv4len))
+	gomega.Expect(mapped.String()).To(gomega.Equal("10.0.0.0/8"))
+	gomega.Expect(familyOf(&mapped)).To(gomega.Equal(AddressFamilyIPv4))
+
+	mapped = mappedNetToIPv4(parseIPNet("::ffff:0:0/96"))
+	gomega.Expect(mapped.String()).To(gomega.Equal("0.0.0.0/0"))
+	gomega.Expect(isDefaultRoute(&mapped)).To(gomega.BeTrue())
+
+	// Networks not inside ::ffff:0:0/96 are left unchanged.
+	for _, network := range []string{"::/0", "::ffff:0:0/80", "2001:db8::/32", "10.0.0.0/8"} {
+		ipNet := parseIPNet(network)
+		gomega.Expect(mappedNetToIPv4(ipNet)).To(gomega.Equal(ipNet))
+	}
+
+	// Mapped network kept as IPv6 belongs to the IPv6 family.
+	ipv6 := parseIPNet("::ffff:10.0.0.0/104")
+	gomega.Expect(familyOf(&ipv6)).To(gomega.Equal(AddressFamilyIPv6))
+
+	mask := mappedMaskToIPv4(IPMask{
+		Address: net.ParseIP("::ffff:10.0.0.1"),
+		Mask:    net.IPMask(net.ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ff00:ff")),
+	})
+	gomega.Expect(mask.Address).To(gomega.HaveLen(net.IPv4len))
+	gomega.Expect(mask.Network().String()).To(gomega.Equal("10.0.0.1/ff0000ff"))
+}
+
+func TestMappedAddresses(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestMappedAddresses")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "::ffff:192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// IPv4 ingress allowed on TCP:80 from 10.0.0.0/8 given in both forms
+	// and on TCP:22 from pod2 with IPv4-mapped IP address
+	policy1 := &ContivPolicy{
+		ID:            policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:          PolicyIngress,
+		AddressFamily: AddressFamilyIPv4,
+		Matches: []Match{
+			{
+				Type:     MatchIngress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("::ffff:10.0.0.0/104")}},
+				Ports:    []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type:     MatchIngress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.0.0/8")}},
+				Ports:    []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 22}},
+			},
+		},
+	}
+
+	for _, handling := range []MappedAddressHandling{MappedAsIPv4, MappedAsIPv6} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer := NewMockRenderer("A", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithMappedAddresses(handling))
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// The input policy is not modified.
+		gomega.Expect(policy1.Matches[0].IPBlocks[0].Network.IP).To(gomega.HaveLen(net.IPv6len))
+
+		_, egress := renderer.GetRules(pod1)
+		blockRules := 0
+		peerRules := 0
+		for _, rule := range egress {
+			if rule.Action != rendererAPI.ActionPermit {
+				continue
+			}
+			switch rule.DestPort {
+			case 80:
+				blockRules++
+				gomega.Expect(rule.SrcNetwork.String()).To(gomega.Equal("10.0.0.0/8"))
+			case 22:
+				peerRules++
+				gomega.Expect(rule.SrcNetwork.String()).To(gomega.Equal("192.168.1.2/32"))
+			}
+		}
+		if handling == MappedAsIPv4 {
+			// Both forms produce the same (single) IPv4 rule.
+			gomega.Expect(blockRules).To(gomega.Equal(1))
+			gomega.Expect(peerRules).To(gomega.Equal(1))
+			action := renderer.TestTraffic(pod1, EgressTraffic,
+				parseIP("192.168.1.2"), parseIP(pod1IP), rendererAPI.TCP, 123, 22)
+			gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		} else {
+			// Mapped addresses are IPv6, not selected by the IPv4 policy.
+			gomega.Expect(blockRules).To(gomega.Equal(1))
+			gomega.Expect(peerRules).To(gomega.Equal(0))
+		}
+		action := renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP("10.1.2.3"), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+)
+
+// WithMatchCoalescing enables/disables coalescing of identical matches across
+// the policies of a pod. With coalescing, a match identical to one already
+// processed for the same direction (and address family of the policy) is
+// skipped instead of generating rules which would be all dropped
+// as duplicates. The generated rules are unchanged, only the intermediate
+// work is reduced for pods with many similar policies. Coalescing is not
+// applied to traced pods and with WithRuleProvenance, where every contributing
+// match must be evaluated.
+func WithMatchCoalescing(enabled bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.coalesceMatches = enabled
+	}
+}
+
+// coalescedMatchKey identifies matches generating the same rules.
+type coalescedMatchKey struct {
+	family AddressFamily
+	match  string
+}
+
+// startCoalescing starts coalescing of matches for one generateRules run,
+// if enabled. The returned function ends it.
+func (pct *PolicyConfiguratorTxn) startCoalescing() func() {
+	if !pct.configurator.coalesceMatches || pct.tracedPod != nil || pct.origins != nil {
+		return func() {}
+	}
+	pct.coalesced = make(map[coalescedMatchKey]struct{})
+	return func() { pct.coalesced = nil }
+}
+
+// isCoalesced returns true if an identical match was already processed
+// since startCoalescing, otherwise the match is remembered.
+func (pct *PolicyConfiguratorTxn) isCoalesced(family AddressFamily, match Match) bool {
+	if pct.coalesced == nil {
+		return false
+	}
+	key := coalescedMatchKey{family: family, match: match.String()}
+	if _, processed := pct.coalesced[key]; processed {
+		pct.Log.WithFields(logging.Fields{
+			"direction": match.Type,
+			"match":     key.match,
+		}).Debug("Skipping match identical to an already processed one")
+		return true
+	}
+	pct.coalesced[key] = struct{}{}
+	return false
+}
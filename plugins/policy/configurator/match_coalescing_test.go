@@ -0,0 +1,173 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+const coalescingPolicies = 50
+
+// overlappingPolicies returns policies which all share the same matches,
+// every one of them with an extra match of its own, and a policy with
+// the shared matches restricted to IPv6.
+func overlappingPolicies(peers []podmodel.ID) ContivPolicies {
+	const namespace = "default"
+	shared := []Match{
+		{
+			Type:  MatchIngress,
+			Pods:  peers,
+			Ports: []Port{{Protocol: TCP, Number: 80}, {Protocol: TCP, Number: 443}},
+		},
+		{
+			Type: MatchIngress,
+			IPBlocks: []IPBlock{{
+				Network: parseIPNet("10.0.0.0/8"),
+				Except:  []net.IPNet{parseIPNet("10.1.0.0/16"), parseIPNet("10.2.0.0/16")},
+			}},
+			Ports:     []Port{{Protocol: UDP, Number: 53}},
+			Fragments: AllowFragments,
+		},
+		{
+			Type:  MatchEgress,
+			Pods:  peers,
+			Ports: []Port{{Protocol: TCP, Number: 5432}},
+		},
+	}
+	var policies ContivPolicies
+	for i := 0; i < coalescingPolicies; i++ {
+		matches := deepCopyMatches(shared)
+		matches = append(matches, Match{
+			Type:  MatchIngress,
+			Pods:  peers[:1],
+			Ports: []Port{{Protocol: TCP, Number: uint16(8000 + i)}},
+		})
+		policies = append(policies, &ContivPolicy{
+			ID:          policymodel.ID{Name: fmt.Sprintf("policy%02d", i), Namespace: namespace},
+			Type:        PolicyAll,
+			Matches:     matches,
+			Description: fmt.Sprintf("policy %d", i),
+		})
+	}
+	policies = append(policies, &ContivPolicy{
+		ID:            policymodel.ID{Name: "policy-ipv6", Namespace: namespace},
+		Type:          PolicyAll,
+		AddressFamily: AddressFamilyIPv6,
+		Matches:       deepCopyMatches(shared),
+	})
+	return policies
+}
+
+// newCoalescingTxn returns a transaction of a configurator with the given
+// peers in the cache.
+func newCoalescingTxn(peers []podmodel.ID, options ...Option) *PolicyConfiguratorTxn {
+	logger := logrus.DefaultLogger()
+	cache := NewMockPolicyCache()
+	for idx, peer := range peers {
+		cache.AddPodConfig(peer, fmt.Sprintf("192.168.1.%d", idx+1))
+	}
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, options...)
+	return configurator.NewTxn(false).(*PolicyConfiguratorTxn)
+}
+
+func coalescingPeers() []podmodel.ID {
+	var peers []podmodel.ID
+	for i := 0; i < 10; i++ {
+		peers = append(peers, podmodel.ID{Name: fmt.Sprintf("peer%d", i), Namespace: "default"})
+	}
+	return peers
+}
+
+func TestMatchCoalescing(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestMatchCoalescing")
+
+	peers := coalescingPeers()
+	policies := overlappingPolicies(peers)
+	reference := newCoalescingTxn(peers)
+	coalescing := newCoalescingTxn(peers, WithMatchCoalescing(true))
+
+	// The rules are unchanged.
+	for _, direction := range []MatchType{MatchIngress, MatchEgress} {
+		expected := reference.generateRules(direction, policies)
+		rules := coalescing.generateRules(direction, policies)
+		gomega.Expect(rules).To(gomega.Equal(expected))
+		for idx := range rules {
+			gomega.Expect(rules[idx].Description).To(gomega.Equal(expected[idx].Description))
+		}
+	}
+
+	// Coalescing ends with the generation.
+	gomega.Expect(coalescing.coalesced).To(gomega.BeNil())
+
+	// Coalescing reduces the intermediate allocations.
+	logger.SetLevel(logging.InfoLevel)
+	defer logger.SetLevel(logging.DebugLevel)
+	referenceAllocs := testing.AllocsPerRun(5, func() {
+		reference.generateRules(MatchIngress, policies)
+	})
+	coalescingAllocs := testing.AllocsPerRun(5, func() {
+		coalescing.generateRules(MatchIngress, policies)
+	})
+	gomega.Expect(coalescingAllocs).To(gomega.BeNumerically("<", referenceAllocs/2))
+
+	// Coalescing is not applied with rule provenance.
+	provenance := newCoalescingTxn(peers, WithMatchCoalescing(true), WithRuleProvenance())
+	gomega.Expect(provenance.origins).ToNot(gomega.BeNil())
+	record := provenance.buildProvenance(provenance.generateRules(MatchIngress, policies), nil)
+	gomega.Expect(record[0].Contributors).To(gomega.HaveLen(coalescingPolicies))
+}
+
+func BenchmarkMatchCoalescing(b *testing.B) {
+	logrus.DefaultLogger().SetLevel(logging.InfoLevel)
+	defer logrus.DefaultLogger().SetLevel(logging.DebugLevel)
+	peers := coalescingPeers()
+	policies := overlappingPolicies(peers)
+	for _, enabled := range []bool{false, true} {
+		txn := newCoalescingTxn(peers, WithMatchCoalescing(enabled))
+		b.Run(fmt.Sprintf("coalescing-%t", enabled), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				txn.generateRules(MatchIngress, policies)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"time"
+)
+
+// MetricsSink receives metrics of every commit (see RegisterMetricsSink),
+// e.g. to export them to a monitoring system.
+type MetricsSink interface {
+	// RecordCommit is called with the configurator locked, the sink must not
+	// call back into the configurator.
+	RecordCommit(metrics *CommitMetrics)
+}
+
+// CommitMetrics describes a single commit.
+type CommitMetrics struct {
+	// Timestamp is the time of the commit.
+	Timestamp time.Time
+
+	// Resync is true for a transaction which replaced the entire configuration.
+	Resync bool
+
+	// Failed is true if any of the renderers failed to apply the changes.
+	Failed bool
+
+	// CorrelationIDs lists IDs attached to the committed transaction
+	// (see AuditRecord.CorrelationIDs).
+	CorrelationIDs []string
+
+	// Pods contains metrics of every pod affected by the commit, keyed
+	// by "namespace/name" of the pod, or by its pseudonym if the pod
+	// anonymization is enabled (see WithPodAnonymizer).
+	Pods map[string]PodMetrics
+}
+
+// PodMetrics describes the configuration of a single pod after a commit.
+type PodMetrics struct {
+	// Policies is the number of policies configured for the pod.
+	Policies int
+
+	// IngressRules is the number of rules rendered for the ingress of the pod
+	// (vswitch egress).
+	IngressRules int
+
+	// EgressRules is the number of rules rendered for the egress of the pod
+	// (vswitch ingress).
+	EgressRules int
+
+	// Removed is true if the policies were removed from the pod.
+	Removed bool
+}
+
+// RegisterMetricsSink registers a sink receiving metrics of the commits.
+func (pc *PolicyConfigurator) RegisterMetricsSink(sink MetricsSink) {
+	pc.metricsSinks = append(pc.metricsSinks, sink)
+}
+
+// buildCommitMetrics builds metrics of the transaction. It is expected to be
+// called before the changes are saved to the configurator.
+func (pct *PolicyConfiguratorTxn) buildCommitMetrics(failed bool) *CommitMetrics {
+	pc := pct.configurator
+	metrics := &CommitMetrics{
+		Timestamp:      pc.clock.Now(),
+		Resync:         pct.resync,
+		Failed:         failed,
+		CorrelationIDs: copyStrings(pct.correlationIDs),
+		Pods:           make(map[string]PodMetrics),
+	}
+	for pod, policies := range pct.config {
+		if _, hasIPAddr := pct.podIPAddresses[pod]; hasIPAddr {
+			rules := pct.rules[pod]
+			metrics.Pods[pc.podLabel(pod)] = PodMetrics{
+				Policies:     len(policies),
+				IngressRules: len(rules.Egress),
+				EgressRules:  len(rules.Ingress),
+			}
+		} else if _, committed := pc.config[pod]; committed {
+			metrics.Pods[pc.podLabel(pod)] = PodMetrics{Removed: true}
+		}
+	}
+	if pct.resync {
+		for pod := range pc.config {
+			if _, configured := pct.config[pod]; !configured {
+				metrics.Pods[pc.podLabel(pod)] = PodMetrics{Removed: true}
+			}
+		}
+	}
+	return metrics
+}
+
+// recordMetrics passes the metrics to all registered metrics sinks.
+func (pc *PolicyConfigurator) recordMetrics(metrics *CommitMetrics) {
+	for _, sink := range pc.metricsSinks {
+		sink.RecordCommit(metrics)
+	}
+}
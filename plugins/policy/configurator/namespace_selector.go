@@ -0,0 +1,239 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"sort"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// NamespaceLabelsProvider provides the current labels of namespaces.
+type NamespaceLabelsProvider interface {
+	// GetNamespaceLabels returns labels of all existing namespaces
+	// (namespace -> label key -> label value).
+	GetNamespaceLabels() map[string]map[string]string
+}
+
+// WithNamespaceLabels enables the namespace selectors (Match.NamespaceSelector).
+// The labels of namespaces are obtained from the given provider; whenever they
+// change, RefreshNamespaceLabels() should be called to update the rules.
+// Pods of the selected namespaces are looked up in the policy cache; whenever
+// pods are added into or removed from a namespace, RefreshNamespacePods()
+// should be called.
+func WithNamespaceLabels(provider NamespaceLabelsProvider) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.namespaceProvider = provider
+	}
+}
+
+// RefreshNamespaceLabels re-reads labels of namespaces from the provider
+// and re-renders rules of pods with namespace selectors whose selection
+// of namespaces has changed as a result.
+func (pc *PolicyConfigurator) RefreshNamespaceLabels() error {
+	if pc.namespaceProvider == nil {
+		return nil
+	}
+	pc.Lock()
+	defer pc.Unlock()
+	labels := copyNamespaceLabels(pc.namespaceProvider.GetNamespaceLabels())
+	changed := changedNamespaces(pc.namespaceLabels, labels)
+	if len(changed) == 0 {
+		return nil
+	}
+	pc.Log.WithField("namespaces", changed).Debug("Labels of namespaces have changed")
+	oldLabels := pc.namespaceLabels
+	pc.namespaceLabels = labels
+
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for pod, policies := range pc.config {
+		for _, namespace := range changed {
+			if selectsNamespace(policies, namespace, oldLabels) != selectsNamespace(policies, namespace, labels) {
+				txn.configure(pod, policies)
+				break
+			}
+		}
+	}
+	return txn.commit()
+}
+
+// RefreshNamespacePods re-renders rules of pods with namespace selectors
+// selecting the given namespace, to reflect pods added into or removed
+// from the namespace.
+func (pc *PolicyConfigurator) RefreshNamespacePods(namespace string) error {
+	if pc.namespaceProvider == nil {
+		return nil
+	}
+	pc.Lock()
+	defer pc.Unlock()
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for pod, policies := range pc.config {
+		if selectsNamespace(policies, namespace, pc.namespaceLabels) {
+			txn.configure(pod, policies)
+		}
+	}
+	return txn.commit()
+}
+
+// namespacePeerPods returns the pod peers of the match: Pods, or with
+// the namespace selector, pods of the selected namespaces (only those from Pods
+// if non-nil).
+func (pct *PolicyConfiguratorTxn) namespacePeerPods(match Match) []podmodel.ID {
+	if match.NamespaceSelector == nil {
+		return match.Pods
+	}
+	pc := pct.configurator
+	if pc.namespaceProvider == nil {
+		pct.Log.Warn("Namespace labels provider is not configured")
+		return nil
+	}
+	selected := make(map[string]struct{})
+	for namespace, labels := range pc.namespaceLabels {
+		if match.NamespaceSelector.selects(labels) {
+			selected[namespace] = struct{}{}
+		}
+	}
+
+	var peers []podmodel.ID
+	if match.Pods != nil {
+		for _, pod := range match.Pods {
+			if _, isSelected := selected[pod.Namespace]; isSelected {
+				peers = append(peers, pod)
+			}
+		}
+	} else {
+		for namespace := range selected {
+			peers = append(peers, pc.Cache.LookupPodsByNamespace(namespace)...)
+		}
+		sort.Slice(peers, func(i, j int) bool {
+			if peers[i].Namespace != peers[j].Namespace {
+				return peers[i].Namespace < peers[j].Namespace
+			}
+			return peers[i].Name < peers[j].Name
+		})
+	}
+	pct.Log.WithFields(logging.Fields{
+		"selector": match.NamespaceSelector,
+		"peers":    peers,
+	}).Debug("Expanded namespace selector")
+	return peers
+}
+
+// selects returns true if the namespace with the given labels is selected.
+func (ns *NamespaceSelector) selects(labels map[string]string) bool {
+	for key, value := range ns.MatchLabels {
+		if labelValue, hasLabel := labels[key]; !hasLabel || labelValue != value {
+			return false
+		}
+	}
+	for _, requirement := range ns.MatchExpressions {
+		labelValue, hasLabel := labels[requirement.Key]
+		inValues := false
+		for _, value := range requirement.Values {
+			if hasLabel && labelValue == value {
+				inValues = true
+				break
+			}
+		}
+		switch requirement.Operator {
+		case LabelIn:
+			if !inValues {
+				return false
+			}
+		case LabelNotIn:
+			if inValues {
+				return false
+			}
+		case LabelExists:
+			if !hasLabel {
+				return false
+			}
+		case LabelDoesNotExist:
+			if hasLabel {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// selectsNamespace returns true if any of the policies has a match with
+// a namespace selector selecting the given namespace with the given labels
+// of namespaces.
+func selectsNamespace(policies []*ContivPolicy, namespace string, labels map[string]map[string]string) bool {
+	nsLabels, exists := labels[namespace]
+	if !exists {
+		return false
+	}
+	for _, policy := range policies {
+		for _, match := range policy.Matches {
+			if match.NamespaceSelector != nil && match.NamespaceSelector.selects(nsLabels) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// changedNamespaces returns namespaces (sorted) which were added, removed
+// or had their labels changed.
+func changedNamespaces(labels1, labels2 map[string]map[string]string) []string {
+	var changed []string
+	for namespace, nsLabels := range labels1 {
+		if otherLabels, exists := labels2[namespace]; !exists || !equalLabels(nsLabels, otherLabels) {
+			changed = append(changed, namespace)
+		}
+	}
+	for namespace := range labels2 {
+		if _, exists := labels1[namespace]; !exists {
+			changed = append(changed, namespace)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// copyNamespaceLabels returns a deep copy of the labels of namespaces
+// (the provider may modify them afterwards).
+func copyNamespaceLabels(labels map[string]map[string]string) map[string]map[string]string {
+	labelsCopy := make(map[string]map[string]string, len(labels))
+	for namespace, nsLabels := range labels {
+		nsLabelsCopy := make(map[string]string, len(nsLabels))
+		for key, value := range nsLabels {
+			nsLabelsCopy[key] = value
+		}
+		labelsCopy[namespace] = nsLabelsCopy
+	}
+	return labelsCopy
+}
+
+// equalLabels returns true if the two sets of labels are the same.
+func equalLabels(labels1, labels2 map[string]string) bool {
+	if len(labels1) != len(labels2) {
+		return false
+	}
+	for key, value := range labels1 {
+		if otherValue, hasLabel := labels2[key]; !hasLabel || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+type fakeNamespaceProvider struct {
+	labels map[string]map[string]string
+}
+
+func (fnp *fakeNamespaceProvider) GetNamespaceLabels() map[string]map[string]string {
+	return fnp.labels
+}
+
+func TestNamespaceSelector(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestNamespaceSelector")
+
+	// Prepare input data.
+	const (
+		pod1IP = "192.168.1.1"
+		podAIP = "192.168.2.1"
+		podBIP = "192.168.3.1"
+		podCIP = "192.168.2.2"
+		podDIP = "192.168.2.3"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: "default"}
+	podA := podmodel.ID{Name: "podA", Namespace: "prod"}
+	podB := podmodel.ID{Name: "podB", Namespace: "dev"}
+	podC := podmodel.ID{Name: "podC", Namespace: "prod"}
+	podD := podmodel.ID{Name: "podD", Namespace: "prod"}
+
+	// ingress allowed on TCP:80 from namespaces with env=prod
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: "default"},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				NamespaceSelector: &NamespaceSelector{
+					MatchLabels: map[string]string{"env": "prod"},
+				},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// ingress allowed on TCP:443 from podA and podB, but only inside
+	// namespaces which are not dev
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: "default"},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{podA, podB},
+				NamespaceSelector: &NamespaceSelector{
+					MatchExpressions: []LabelRequirement{
+						{Key: "env", Operator: LabelNotIn, Values: []string{"dev"}},
+					},
+				},
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(podA, podAIP)
+	cache.AddPodConfig(podB, podBIP)
+	cache.AddPodConfig(podC, podCIP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	provider := &fakeNamespaceProvider{
+		labels: map[string]map[string]string{
+			"default": {},
+			"prod":    {"env": "prod"},
+			"dev":     {"env": "dev"},
+		},
+	}
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithNamespaceLabels(provider))
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	testTraffic := func(srcIP string, dstPort uint16) TrafficAction {
+		return renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(srcIP), parseIP(pod1IP), rendererAPI.TCP, 1024, dstPort)
+	}
+
+	// Pods of the prod namespace are allowed.
+	gomega.Expect(testTraffic(podAIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(podCIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(podBIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Combined with pods, only those of the selected namespaces are allowed.
+	gomega.Expect(testTraffic(podAIP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(podBIP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(podCIP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// The dev namespace starts to match.
+	provider.labels = map[string]map[string]string{
+		"default": {},
+		"prod":    {"env": "prod"},
+		"dev":     {"env": "prod", "team": "web"},
+	}
+	err = configurator.RefreshNamespaceLabels()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(testTraffic(podBIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(podBIP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(podAIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// The prod namespace stops to match.
+	provider.labels = map[string]map[string]string{
+		"default": {},
+		"prod":    {"env": "dev"},
+		"dev":     {"env": "prod", "team": "web"},
+	}
+	err = configurator.RefreshNamespaceLabels()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(testTraffic(podAIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(podCIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(podAIP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(podBIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// And matches again; a pod added into the namespace meanwhile is allowed
+	// as well.
+	provider.labels["prod"] = map[string]string{"env": "prod"}
+	err = configurator.RefreshNamespaceLabels()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(testTraffic(podAIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(podDIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	cache.AddPodConfig(podD, podDIP)
+	err = configurator.RefreshNamespacePods("prod")
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(testTraffic(podDIP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Removed namespace is no longer selected.
+	delete(provider.labels, "dev")
+	err = configurator.RefreshNamespaceLabels()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(testTraffic(podBIP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+}
+
+func TestNamespaceSelectorNormalize(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	selector := &NamespaceSelector{
+		MatchLabels: map[string]string{"b": "2", "a": "1"},
+		MatchExpressions: []LabelRequirement{
+			{Key: "env", Operator: LabelIn, Values: []string{"prod", "dev", "prod"}},
+			{Key: "app", Operator: LabelExists, Values: []string{"ignored"}},
+			{Key: "env", Operator: LabelIn, Values: []string{"dev", "prod"}},
+		},
+	}
+	normalized := selector.Normalize()
+	gomega.Expect(normalized.String()).To(gomega.Equal(
+		"<Labels:[a=1, b=2], Expressions:[app EXISTS, env IN (dev, prod)]>"))
+	// The original is not modified.
+	gomega.Expect(selector.MatchExpressions).To(gomega.HaveLen(3))
+	gomega.Expect(selector.MatchExpressions[0].Values).To(gomega.Equal([]string{"prod", "dev", "prod"}))
+}
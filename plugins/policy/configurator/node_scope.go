@@ -0,0 +1,118 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// NodeIdentity identifies the local node for the node scopes of policies
+// (ContivPolicy.NodeScope).
+type NodeIdentity struct {
+	Name   string
+	Labels map[string]string
+}
+
+// WithLocalNode sets the identity of the local node, evaluated against
+// the node scopes of policies. Without the identity, node-scoped policies
+// do not apply on the node.
+func WithLocalNode(node NodeIdentity) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.localNode = node.copy()
+	}
+}
+
+// SetLocalNode updates the identity of the local node and re-renders the rules
+// of the committed pods with node-scoped policies.
+func (pc *PolicyConfigurator) SetLocalNode(node NodeIdentity) error {
+	pc.Lock()
+	defer pc.Unlock()
+	pc.localNode = node.copy()
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for pod, policies := range pc.config {
+		if hasNodeScopedPolicy(policies) {
+			txn.configure(pod, policies)
+		}
+	}
+	if len(txn.config) == 0 {
+		return nil
+	}
+	return txn.commit()
+}
+
+// nodeScopedPolicies returns the policies without those whose node scope does
+// not select the local node. If no policy is filtered out, the same list
+// is returned.
+func (pct *PolicyConfiguratorTxn) nodeScopedPolicies(pod podmodel.ID, policies ContivPolicies) ContivPolicies {
+	if !hasNodeScopedPolicy(policies) {
+		return policies
+	}
+	var scoped ContivPolicies
+	for _, policy := range policies {
+		if policy.NodeScope != nil && !policy.NodeScope.selects(pct.configurator.localNode) {
+			pct.Log.WithFields(logging.Fields{
+				"pod":    pct.configurator.logPod(pod),
+				"policy": policy.ID,
+				"scope":  policy.NodeScope,
+			}).Debug("Policy scoped out by the local node")
+			continue
+		}
+		scoped = append(scoped, policy)
+	}
+	if len(scoped) == len(policies) {
+		return policies
+	}
+	return scoped
+}
+
+// selects returns true if the scope selects the given node (nil = unknown
+// node, never selected).
+func (ns *NodeScope) selects(node *NodeIdentity) bool {
+	if node == nil {
+		return false
+	}
+	for _, name := range ns.Nodes {
+		if name == node.Name {
+			return true
+		}
+	}
+	return ns.Selector != nil && ns.Selector.selects(node.Labels)
+}
+
+// copy returns a copy of the node identity.
+func (node NodeIdentity) copy() *NodeIdentity {
+	nodeCopy := &NodeIdentity{Name: node.Name}
+	if node.Labels != nil {
+		nodeCopy.Labels = make(map[string]string, len(node.Labels))
+		for key, value := range node.Labels {
+			nodeCopy.Labels[key] = value
+		}
+	}
+	return nodeCopy
+}
+
+// hasNodeScopedPolicy returns true if any of the policies has a node scope.
+func hasNodeScopedPolicy(policies ContivPolicies) bool {
+	for _, policy := range policies {
+		if policy.NodeScope != nil {
+			return true
+		}
+	}
+	return false
+}
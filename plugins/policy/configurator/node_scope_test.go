@@ -0,0 +1,150 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestNodeScope(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestNodeScope")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1IP     = "192.168.1.1"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+
+	// ingress allowed only on TCP:80, only on node1
+	policy1 := &ContivPolicy{
+		ID:        policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:      PolicyIngress,
+		NodeScope: &NodeScope{Nodes: []string{"node1"}},
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	gomega.Expect(policy1.String()).To(gomega.HaveSuffix(", NodeScope:<Nodes:[node1]>>"))
+	gomega.Expect(policy1.DeepCopy()).To(gomega.Equal(policy1))
+
+	// ingress allowed only on TCP:22, only on edge nodes
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		NodeScope: &NodeScope{
+			Selector: &NamespaceSelector{MatchLabels: map[string]string{"role": "edge"}},
+		},
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 22}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	newConfigurator := func(renderer *MockRenderer, opts ...Option) *PolicyConfigurator {
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, opts...)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator
+	}
+	toPod := func(renderer *MockRenderer, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(externalIP), parseIP(pod1IP), rendererAPI.TCP, 123, port)
+	}
+
+	// node1 (not edge): only policy1 applies
+	renderer1 := NewMockRenderer("A", logger)
+	newConfigurator(renderer1, WithLocalNode(NodeIdentity{Name: "node1"}))
+	gomega.Expect(toPod(renderer1, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(renderer1, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// node2 (edge): only policy2 applies
+	renderer2 := NewMockRenderer("B", logger)
+	configurator2 := newConfigurator(renderer2,
+		WithLocalNode(NodeIdentity{Name: "node2", Labels: map[string]string{"role": "edge"}}))
+	gomega.Expect(toPod(renderer2, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(renderer2, 22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// node3: no policy applies, the pod is not isolated
+	renderer3 := NewMockRenderer("C", logger)
+	newConfigurator(renderer3, WithLocalNode(NodeIdentity{Name: "node3"}))
+	gomega.Expect(toPod(renderer3, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	gomega.Expect(toPod(renderer3, 443)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	ingress, egress := renderer3.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+
+	// unknown node: no node-scoped policy applies
+	renderer4 := NewMockRenderer("D", logger)
+	newConfigurator(renderer4)
+	ingress, egress = renderer4.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+
+	// node2 loses the label and is renamed to node1
+	err := configurator2.SetLocalNode(NodeIdentity{Name: "node1"})
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(renderer2, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(renderer2, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// node moved out of all scopes
+	err = configurator2.SetLocalNode(NodeIdentity{Name: "node3"})
+	gomega.Expect(err).To(gomega.BeNil())
+	ingress, egress = renderer2.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+}
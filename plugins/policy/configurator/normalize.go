@@ -0,0 +1,289 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/utils"
+)
+
+// Normalize returns a copy of the policy in the canonical form:
+// matches are normalized, sorted by their string representation
+// (without the description) and duplicates are removed.
+// Two policies allowing the same traffic by the same set of matches
+// (regardless of the order) have equal normalized forms, up to the descriptions
+// of the matches (of duplicates, the first description is kept).
+func (cp ContivPolicy) Normalize() *ContivPolicy {
+	normalized := cp
+	normalized.Matches = nil
+	keys := make(map[string]struct{})
+	for _, match := range cp.Matches {
+		match = match.Normalize()
+		key := match.key()
+		if _, duplicate := keys[key]; duplicate {
+			continue
+		}
+		keys[key] = struct{}{}
+		normalized.Matches = append(normalized.Matches, match)
+	}
+	sort.SliceStable(normalized.Matches, func(i, j int) bool {
+		return normalized.Matches[i].key() < normalized.Matches[j].key()
+	})
+	return &normalized
+}
+
+// key returns the string representation of the match without the description,
+// which does not distinguish otherwise equal matches (see Match.Description).
+func (m Match) key() string {
+	m.Description = ""
+	return m.String()
+}
+
+// Normalize returns a copy of the match in the canonical form:
+//   - all lists are sorted and without duplicates
+//   - IP networks have the host bits cleared and IPv4 addresses are in 4-byte form
+//   - exceptions not contained in their IP block are removed
+//   - match with default-route blocks of both families (see default_route.go)
+//     is replaced with a match of all peers
+//   - FQDNs are lower-cased
+//   - requirements of the namespace selector are sorted and without duplicates
+//   - empty list of ports is replaced with nil (both match all ports)
+//   - empty list of port-sets is replaced with nil
+//
+// Empty lists of peers are not replaced with nil, since nil has a different
+// meaning (match all) than an empty list.
+func (m Match) Normalize() Match {
+	normalized := m
+
+	if m.Pods != nil {
+		pods := make(map[podmodel.ID]struct{})
+		normalized.Pods = []podmodel.ID{}
+		for _, pod := range m.Pods {
+			if _, duplicate := pods[pod]; duplicate {
+				continue
+			}
+			pods[pod] = struct{}{}
+			normalized.Pods = append(normalized.Pods, pod)
+		}
+		sort.Slice(normalized.Pods, func(i, j int) bool {
+			if normalized.Pods[i].Namespace != normalized.Pods[j].Namespace {
+				return normalized.Pods[i].Namespace < normalized.Pods[j].Namespace
+			}
+			return normalized.Pods[i].Name < normalized.Pods[j].Name
+		})
+	}
+
+	if m.IPBlocks != nil {
+		normalized.IPBlocks = []IPBlock{}
+		for _, block := range m.IPBlocks {
+			normBlock := canonicalBlock(block)
+			sortIPNets(normBlock.Except)
+			normalized.IPBlocks = appendIPBlock(normalized.IPBlocks, normBlock)
+		}
+		sort.Slice(normalized.IPBlocks, func(i, j int) bool {
+			return normalized.IPBlocks[i].String() < normalized.IPBlocks[j].String()
+		})
+	}
+
+	if m.IPMasks != nil {
+		masks := make(map[string]struct{})
+		normalized.IPMasks = []IPMask{}
+		for _, mask := range m.IPMasks {
+			network := mask.Network()
+			normMask := IPMask{Address: network.IP, Mask: network.Mask}
+			key := normMask.String()
+			if _, duplicate := masks[key]; duplicate {
+				continue
+			}
+			masks[key] = struct{}{}
+			normalized.IPMasks = append(normalized.IPMasks, normMask)
+		}
+		sort.Slice(normalized.IPMasks, func(i, j int) bool {
+			return normalized.IPMasks[i].String() < normalized.IPMasks[j].String()
+		})
+	}
+
+	if m.FQDNs != nil {
+		fqdns := make(map[string]struct{})
+		normalized.FQDNs = []string{}
+		for _, fqdn := range m.FQDNs {
+			fqdn = strings.ToLower(fqdn)
+			if _, duplicate := fqdns[fqdn]; duplicate {
+				continue
+			}
+			fqdns[fqdn] = struct{}{}
+			normalized.FQDNs = append(normalized.FQDNs, fqdn)
+		}
+		sort.Strings(normalized.FQDNs)
+	}
+
+	if m.NamespaceSelector != nil {
+		normalized.NamespaceSelector = m.NamespaceSelector.Normalize()
+	}
+
+	if m.PodNamePatterns != nil {
+		patterns := make(map[PodNamePattern]struct{})
+		normalized.PodNamePatterns = []PodNamePattern{}
+		for _, pattern := range m.PodNamePatterns {
+			if _, duplicate := patterns[pattern]; duplicate {
+				continue
+			}
+			patterns[pattern] = struct{}{}
+			normalized.PodNamePatterns = append(normalized.PodNamePatterns, pattern)
+		}
+		sort.Slice(normalized.PodNamePatterns, func(i, j int) bool {
+			return normalized.PodNamePatterns[i].String() < normalized.PodNamePatterns[j].String()
+		})
+	}
+
+	if normalized.IPBlocks != nil && !m.APIServerRef && matchesAllAddresses(normalized.IPBlocks) {
+		normalized.Pods = nil
+		normalized.IPBlocks = nil
+		normalized.IPMasks = nil
+		normalized.FQDNs = nil
+		normalized.NamespaceSelector = nil
+		normalized.PodNamePatterns = nil
+		normalized.ClusterPodsRef = false
+		normalized.ExternalRef = false
+	}
+
+	normalized.Ports = normalizePorts(m.Ports)
+	normalized.PortSets = normalizeStrings(m.PortSets)
+	normalized.SourcePorts = normalizePorts(m.SourcePorts)
+	return normalized
+}
+
+// Normalize returns a copy of the selector with requirements (and their values)
+// sorted and without duplicates. Empty lists are replaced with nil.
+func (ns *NamespaceSelector) Normalize() *NamespaceSelector {
+	normalized := ns.DeepCopy()
+	if len(normalized.MatchLabels) == 0 {
+		normalized.MatchLabels = nil
+	}
+	requirements := normalized.MatchExpressions
+	for idx := range requirements {
+		requirements[idx].Values = normalizeStrings(requirements[idx].Values)
+		if requirements[idx].Operator != LabelIn && requirements[idx].Operator != LabelNotIn {
+			requirements[idx].Values = nil
+		}
+	}
+	sort.Slice(requirements, func(i, j int) bool {
+		return compareRequirements(requirements[i], requirements[j]) < 0
+	})
+	normalized.MatchExpressions = nil
+	for idx, requirement := range requirements {
+		if idx > 0 && compareRequirements(requirements[idx-1], requirement) == 0 {
+			continue
+		}
+		normalized.MatchExpressions = append(normalized.MatchExpressions, requirement)
+	}
+	return normalized
+}
+
+// compareRequirements returns -1, 0, 1 if <r1> is less than, equal to
+// or greater than <r2>, respectively.
+func compareRequirements(r1, r2 LabelRequirement) int {
+	if r1.Key != r2.Key {
+		return strings.Compare(r1.Key, r2.Key)
+	}
+	if r1.Operator != r2.Operator {
+		if r1.Operator < r2.Operator {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(strings.Join(r1.Values, ","), strings.Join(r2.Values, ","))
+}
+
+// normalizeStrings returns the strings sorted and with duplicates removed.
+func normalizeStrings(values []string) []string {
+	var normalized []string
+	seen := make(map[string]struct{})
+	for _, value := range values {
+		if _, duplicate := seen[value]; duplicate {
+			continue
+		}
+		seen[value] = struct{}{}
+		normalized = append(normalized, value)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// normalizePorts returns the ports sorted and with duplicates removed.
+func normalizePorts(ports []Port) []Port {
+	var normalized []Port
+	seen := make(map[Port]struct{})
+	for _, port := range ports {
+		if _, duplicate := seen[port]; duplicate {
+			continue
+		}
+		seen[port] = struct{}{}
+		normalized = append(normalized, port)
+	}
+	sort.Slice(normalized, func(i, j int) bool {
+		if normalized[i].Protocol != normalized[j].Protocol {
+			return normalized[i].Protocol < normalized[j].Protocol
+		}
+		return normalized[i].Number < normalized[j].Number
+	})
+	return normalized
+}
+
+// normalizeIPNet returns a copy of the network with the host bits cleared
+// and the IPv4 address in the 4-byte form.
+func normalizeIPNet(ipNet net.IPNet) net.IPNet {
+	ip := ipNet.IP
+	if len(ipNet.Mask) == net.IPv4len && ip.To4() != nil {
+		ip = ip.To4()
+	}
+	if len(ip) != len(ipNet.Mask) {
+		return ipNet
+	}
+	return net.IPNet{IP: ip.Mask(ipNet.Mask), Mask: ipNet.Mask}
+}
+
+// appendIPNet appends network into the list if it is not there already.
+func appendIPNet(nets []net.IPNet, ipNet net.IPNet) []net.IPNet {
+	for idx := range nets {
+		if utils.CompareIPNets(&nets[idx], &ipNet) == 0 {
+			return nets
+		}
+	}
+	return append(nets, ipNet)
+}
+
+// appendIPBlock appends block into the list if it is not there already.
+func appendIPBlock(blocks []IPBlock, block IPBlock) []IPBlock {
+	for _, existing := range blocks {
+		if existing.String() == block.String() {
+			return blocks
+		}
+	}
+	return append(blocks, block)
+}
+
+// sortIPNets sorts networks using utils.CompareIPNets.
+func sortIPNets(nets []net.IPNet) {
+	sort.Slice(nets, func(i, j int) bool {
+		return utils.CompareIPNets(&nets[i], &nets[j]) < 0
+	})
+}
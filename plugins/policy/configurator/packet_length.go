@@ -0,0 +1,63 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithStrictPacketLength selects how packet length ranges (Match.PacketLen)
+// are handled for renderers without the renderer.PacketLength capability.
+// By default the ranges are not passed to such renderers and the traffic
+// is matched regardless of the packet length. With strict packet length,
+// the commit fails instead.
+func WithStrictPacketLength(strict bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.strictPacketLen = strict
+	}
+}
+
+// rendererLenRange converts packet length range of a match into the renderer
+// representation.
+func rendererLenRange(packetLen *LenRange) *renderer.LenRange {
+	if packetLen == nil {
+		return nil
+	}
+	return &renderer.LenRange{
+		Min: packetLen.Min,
+		Max: packetLen.Max,
+	}
+}
+
+// withoutPacketLens returns the rules with packet length ranges removed.
+// Rules which become duplicates are skipped. If none of the rules is
+// restricted by length, the same list is returned.
+func withoutPacketLens(rules ContivRules) ContivRules {
+	return withoutRuleFeature(rules,
+		func(rule *renderer.ContivRule) bool { return rule.PacketLen != nil },
+		func(rule *renderer.ContivRule) { rule.PacketLen = nil })
+}
+
+// hasPacketLens returns true if any of the rules is restricted by length.
+func hasPacketLens(rules ContivRules) bool {
+	for _, rule := range rules {
+		if rule.PacketLen != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestPacketLength(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPacketLength")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed from pod2 (small packets only) and from pod3 (any length)
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:      MatchIngress,
+				Pods:      []podmodel.ID{pod2},
+				Ports:     []Port{{Protocol: UDP, Number: 53}},
+				PacketLen: &LenRange{Min: 28, Max: 512},
+			},
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod3},
+				Ports: []Port{{Protocol: UDP, Number: 53}},
+			},
+		},
+	}
+	gomega.Expect(policy1.Matches[0].String()).To(gomega.HaveSuffix(", PacketLen:28-512B>"))
+	gomega.Expect(policy1.Matches[1].String()).ToNot(gomega.ContainSubstring("PacketLen"))
+
+	for _, strict := range []bool{false, true} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+		cache.AddPodConfig(pod3, pod3IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer1 := NewMockRenderer("A", logger)
+		renderer1.SetCapabilities(rendererAPI.PacketLength)
+		renderer2 := NewMockRenderer("B", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithStrictPacketLength(strict))
+
+		// Register two renderers.
+		err := configurator.RegisterRenderer(renderer1)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(renderer2)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		if strict {
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("PACKET-LENGTH"))
+		} else {
+			gomega.Expect(err).To(gomega.BeNil())
+		}
+
+		// Renderer with the capability receives the length range
+		// only for the rule of the match with the range.
+		_, egress := renderer1.GetRules(pod1)
+		restricted := 0
+		for _, rule := range egress {
+			if rule.PacketLen == nil {
+				continue
+			}
+			restricted++
+			gomega.Expect(rule.SrcNetwork.String()).To(gomega.Equal(pod2IP + "/32"))
+			gomega.Expect(rule.String()).To(gomega.HaveSuffix(" len=28-512B>"))
+			gomega.Expect(*rule.PacketLen).To(gomega.Equal(rendererAPI.LenRange{Min: 28, Max: 512}))
+			gomega.Expect(rule.RequiredCapabilities()).To(gomega.ConsistOf(rendererAPI.PacketLength))
+		}
+		gomega.Expect(restricted).To(gomega.Equal(1))
+		action := renderer1.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod3IP), parseIP(pod1IP), rendererAPI.UDP, 123, 53)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+		if strict {
+			// Renderer without the capability is not given any rules.
+			ingress, egress := renderer2.GetRules(pod1)
+			gomega.Expect(ingress).To(gomega.BeEmpty())
+			gomega.Expect(egress).To(gomega.BeEmpty())
+			continue
+		}
+
+		// Renderer without the capability receives the rules without the range.
+		_, egress = renderer2.GetRules(pod1)
+		gomega.Expect(egress).ToNot(gomega.BeEmpty())
+		for _, rule := range egress {
+			gomega.Expect(rule.PacketLen).To(gomega.BeNil())
+		}
+		action = renderer2.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.UDP, 123, 53)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer2.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.UDP, 123, 54)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+}
+
+func TestCompareLenRanges(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	anyLen := &rendererAPI.ContivRule{Action: rendererAPI.ActionPermit, Protocol: rendererAPI.UDP,
+		SrcNetwork: ipNetwork("10.0.0.0/8"), DestNetwork: ipNetwork("")}
+	wide := anyLen.Copy()
+	wide.PacketLen = &rendererAPI.LenRange{Min: 0, Max: 1500}
+	narrow := anyLen.Copy()
+	narrow.PacketLen = &rendererAPI.LenRange{Min: 100, Max: 200}
+
+	gomega.Expect(narrow.Compare(wide)).To(gomega.Equal(-1))
+	gomega.Expect(wide.Compare(anyLen)).To(gomega.Equal(-1))
+	gomega.Expect(anyLen.Compare(narrow)).To(gomega.Equal(1))
+	gomega.Expect(narrow.Compare(narrow.Copy())).To(gomega.Equal(0))
+}
@@ -0,0 +1,262 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// FlowVerdict is the outcome of the evaluation of a flow found in a packet
+// capture.
+type FlowVerdict struct {
+	Flow    Flow
+	Allowed bool
+	Packets int // number of packets of the flow in the capture
+}
+
+// EvaluatePcap reads packets from a capture in the pcap format and evaluates
+// flows from and to the given pod against its committed rules.
+// Verdicts are returned per flow (5-tuple), in the order of the first packet
+// of each flow. Packets of other pods, packets other than TCP/UDP over
+// IPv4/IPv6 and non-first IP fragments are skipped. Supported link types are
+// Ethernet (with optional VLAN tags), Linux cooked capture and raw IP.
+// The capture is processed packet by packet, without loading it whole
+// into memory, and outside of the configurator lock.
+func (pc *PolicyConfigurator) EvaluatePcap(pod podmodel.ID, r io.Reader) ([]FlowVerdict, error) {
+	pc.Lock()
+	podIP, hasIPAddr := pc.podIPAddresses[pod]
+	rules, hasRules := pc.rules[pod]
+	pc.Unlock()
+	if !hasIPAddr || !hasRules {
+		return nil, fmt.Errorf("pod %s has no committed configuration", pod)
+	}
+
+	reader, err := newPcapReader(r)
+	if err != nil {
+		return nil, err
+	}
+	verdicts := []FlowVerdict{}
+	flowIndex := make(map[string]int) // flow -> index in verdicts
+	for {
+		packet, err := reader.nextPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		flow, isFlow := reader.packetFlow(packet)
+		if !isFlow {
+			continue
+		}
+		fromPod := podIP.IP.Equal(flow.SrcIP)
+		toPod := podIP.IP.Equal(flow.DstIP)
+		if !fromPod && !toPod {
+			continue
+		}
+		key := flow.String()
+		if idx, seen := flowIndex[key]; seen {
+			verdicts[idx].Packets++
+			continue
+		}
+		allowed := true
+		if fromPod {
+			// egress of the pod = ingress of the vswitch
+			allowed = evaluateRules(rules.Ingress, flow)
+		}
+		if toPod {
+			// ingress of the pod = egress of the vswitch
+			allowed = allowed && evaluateRules(rules.Egress, flow)
+		}
+		flowIndex[key] = len(verdicts)
+		verdicts = append(verdicts, FlowVerdict{Flow: flow, Allowed: allowed, Packets: 1})
+	}
+	return verdicts, nil
+}
+
+const (
+	pcapMagic        = 0xa1b2c3d4
+	pcapMagicNanosec = 0xa1b23c4d
+
+	pcapGlobalHeaderLen = 24
+	pcapPacketHeaderLen = 16
+	pcapMaxPacketLen    = 256 * 1024
+
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLinuxSLL = 113
+
+	etherTypeIPv4  = 0x0800
+	etherTypeIPv6  = 0x86DD
+	etherTypeVLAN  = 0x8100
+	etherTypeQinQ  = 0x88A8
+	ipProtocolTCP  = 6
+	ipProtocolUDP  = 17
+	ethernetHdrLen = 14
+	sllHdrLen      = 16
+	ipv4MinHdrLen  = 20
+	ipv6HdrLen     = 40
+)
+
+// pcapReader reads packets from a stream in the pcap format.
+type pcapReader struct {
+	r         io.Reader
+	byteOrder binary.ByteOrder
+	linkType  uint32
+	header    [pcapPacketHeaderLen]byte
+	packet    []byte // re-used between packets
+}
+
+// newPcapReader reads the global header of the capture.
+func newPcapReader(r io.Reader) (*pcapReader, error) {
+	header := make([]byte, pcapGlobalHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read pcap header: %v", err)
+	}
+	reader := &pcapReader{r: r}
+	for _, byteOrder := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		magic := byteOrder.Uint32(header[0:4])
+		if magic == pcapMagic || magic == pcapMagicNanosec {
+			reader.byteOrder = byteOrder
+		}
+	}
+	if reader.byteOrder == nil {
+		return nil, fmt.Errorf("not a pcap stream (magic number %#x)", header[0:4])
+	}
+	reader.linkType = reader.byteOrder.Uint32(header[20:24])
+	switch reader.linkType {
+	case linkTypeEthernet, linkTypeRaw, linkTypeLinuxSLL:
+	default:
+		return nil, fmt.Errorf("unsupported pcap link type %d", reader.linkType)
+	}
+	return reader, nil
+}
+
+// nextPacket returns data of the next captured packet, valid until the next
+// call. Returns io.EOF at the end of the capture.
+func (pr *pcapReader) nextPacket() ([]byte, error) {
+	if _, err := io.ReadFull(pr.r, pr.header[:]); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read pcap packet header: %v", err)
+	}
+	capturedLen := pr.byteOrder.Uint32(pr.header[8:12])
+	if capturedLen > pcapMaxPacketLen {
+		return nil, fmt.Errorf("invalid pcap packet length %d", capturedLen)
+	}
+	if cap(pr.packet) < int(capturedLen) {
+		pr.packet = make([]byte, capturedLen)
+	}
+	pr.packet = pr.packet[:capturedLen]
+	if _, err := io.ReadFull(pr.r, pr.packet); err != nil {
+		return nil, fmt.Errorf("failed to read pcap packet data: %v", err)
+	}
+	return pr.packet, nil
+}
+
+// packetFlow parses the 5-tuple of a captured packet. Returns false if
+// the packet is not a TCP/UDP packet carrying the L4 ports.
+func (pr *pcapReader) packetFlow(packet []byte) (flow Flow, isFlow bool) {
+	var etherType uint16
+	switch pr.linkType {
+	case linkTypeEthernet:
+		if len(packet) < ethernetHdrLen {
+			return flow, false
+		}
+		etherType = binary.BigEndian.Uint16(packet[12:14])
+		packet = packet[ethernetHdrLen:]
+		for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+			if len(packet) < 4 {
+				return flow, false
+			}
+			etherType = binary.BigEndian.Uint16(packet[2:4])
+			packet = packet[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(packet) < sllHdrLen {
+			return flow, false
+		}
+		etherType = binary.BigEndian.Uint16(packet[14:16])
+		packet = packet[sllHdrLen:]
+	case linkTypeRaw:
+		if len(packet) == 0 {
+			return flow, false
+		}
+		switch packet[0] >> 4 {
+		case 4:
+			etherType = etherTypeIPv4
+		case 6:
+			etherType = etherTypeIPv6
+		}
+	}
+	return ipFlow(etherType, packet)
+}
+
+// ipFlow parses the 5-tuple of an IP packet.
+func ipFlow(etherType uint16, packet []byte) (flow Flow, isFlow bool) {
+	var protocol byte
+	var l4 []byte
+	switch etherType {
+	case etherTypeIPv4:
+		if len(packet) < ipv4MinHdrLen {
+			return flow, false
+		}
+		hdrLen := int(packet[0]&0x0f) * 4
+		if hdrLen < ipv4MinHdrLen || len(packet) < hdrLen {
+			return flow, false
+		}
+		if binary.BigEndian.Uint16(packet[6:8])&0x1fff != 0 {
+			// non-first fragment
+			return flow, false
+		}
+		protocol = packet[9]
+		flow.SrcIP = append(net.IP(nil), packet[12:16]...)
+		flow.DstIP = append(net.IP(nil), packet[16:20]...)
+		l4 = packet[hdrLen:]
+	case etherTypeIPv6:
+		if len(packet) < ipv6HdrLen {
+			return flow, false
+		}
+		// extension headers are not supported
+		protocol = packet[6]
+		flow.SrcIP = append(net.IP(nil), packet[8:24]...)
+		flow.DstIP = append(net.IP(nil), packet[24:40]...)
+		l4 = packet[ipv6HdrLen:]
+	default:
+		return flow, false
+	}
+	switch protocol {
+	case ipProtocolTCP:
+		flow.Protocol = TCP
+	case ipProtocolUDP:
+		flow.Protocol = UDP
+	default:
+		return flow, false
+	}
+	if len(l4) < 4 {
+		return flow, false
+	}
+	flow.SrcPort = binary.BigEndian.Uint16(l4[0:2])
+	flow.DstPort = binary.BigEndian.Uint16(l4[2:4])
+	return flow, true
+}
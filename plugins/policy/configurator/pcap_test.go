@@ -0,0 +1,190 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// pcapWriter builds a synthetic capture with Ethernet frames.
+type pcapWriter struct {
+	buf       bytes.Buffer
+	byteOrder binary.ByteOrder
+}
+
+func newPcapWriter(byteOrder binary.ByteOrder) *pcapWriter {
+	pw := &pcapWriter{byteOrder: byteOrder}
+	header := make([]byte, pcapGlobalHeaderLen)
+	byteOrder.PutUint32(header[0:4], pcapMagic)
+	byteOrder.PutUint16(header[4:6], 2)
+	byteOrder.PutUint16(header[6:8], 4)
+	byteOrder.PutUint32(header[16:20], 65535)
+	byteOrder.PutUint32(header[20:24], linkTypeEthernet)
+	pw.buf.Write(header)
+	return pw
+}
+
+// writeIPv4 appends a frame with an IPv4 packet, optionally VLAN-tagged.
+func (pw *pcapWriter) writeIPv4(src, dst string, protocol byte, srcPort, dstPort uint16, vlan bool) {
+	frame := make([]byte, 12) // MACs
+	if vlan {
+		frame = append(frame, 0x81, 0x00, 0x00, 0x0a)
+	}
+	frame = append(frame, 0x08, 0x00)
+	ip := make([]byte, ipv4MinHdrLen)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], ipv4MinHdrLen+8)
+	ip[8] = 64
+	ip[9] = protocol
+	copy(ip[12:16], net.ParseIP(src).To4())
+	copy(ip[16:20], net.ParseIP(dst).To4())
+	l4 := make([]byte, 8)
+	binary.BigEndian.PutUint16(l4[0:2], srcPort)
+	binary.BigEndian.PutUint16(l4[2:4], dstPort)
+	frame = append(append(frame, ip...), l4...)
+
+	header := make([]byte, pcapPacketHeaderLen)
+	pw.byteOrder.PutUint32(header[8:12], uint32(len(frame)))
+	pw.byteOrder.PutUint32(header[12:16], uint32(len(frame)))
+	pw.buf.Write(header)
+	pw.buf.Write(frame)
+}
+
+func TestEvaluatePcap(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestEvaluatePcap")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed only from pod2 on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Commit policy for pod1.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Build the capture.
+	pcap := newPcapWriter(binary.LittleEndian)
+	pcap.writeIPv4(pod2IP, pod1IP, ipProtocolTCP, 40000, 80, false) // allowed
+	pcap.writeIPv4(pod3IP, pod1IP, ipProtocolTCP, 40001, 80, true)  // denied
+	pcap.writeIPv4(pod2IP, pod1IP, ipProtocolTCP, 40000, 80, true)  // allowed (2nd packet)
+	pcap.writeIPv4(pod2IP, pod1IP, ipProtocolUDP, 40002, 53, false) // denied
+	pcap.writeIPv4(pod1IP, pod3IP, ipProtocolUDP, 40003, 53, false) // allowed (egress)
+	pcap.writeIPv4(pod2IP, pod3IP, ipProtocolTCP, 40004, 80, false) // other pods
+	pcap.writeIPv4(pod3IP, pod1IP, 1 /* ICMP */, 0, 0, false)       // not TCP/UDP
+
+	verdicts, err := configurator.EvaluatePcap(pod1, bytes.NewReader(pcap.buf.Bytes()))
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(verdicts).To(gomega.HaveLen(4))
+
+	gomega.Expect(verdicts[0].Flow.String()).To(gomega.Equal("<192.168.1.2:40000 -> 192.168.1.1:80 TCP>"))
+	gomega.Expect(verdicts[0].Allowed).To(gomega.BeTrue())
+	gomega.Expect(verdicts[0].Packets).To(gomega.Equal(2))
+	gomega.Expect(verdicts[1].Flow.String()).To(gomega.Equal("<192.168.1.3:40001 -> 192.168.1.1:80 TCP>"))
+	gomega.Expect(verdicts[1].Allowed).To(gomega.BeFalse())
+	gomega.Expect(verdicts[1].Packets).To(gomega.Equal(1))
+	gomega.Expect(verdicts[2].Flow.String()).To(gomega.Equal("<192.168.1.2:40002 -> 192.168.1.1:53 UDP>"))
+	gomega.Expect(verdicts[2].Allowed).To(gomega.BeFalse())
+	gomega.Expect(verdicts[3].Flow.String()).To(gomega.Equal("<192.168.1.1:40003 -> 192.168.1.3:53 UDP>"))
+	gomega.Expect(verdicts[3].Allowed).To(gomega.BeTrue())
+
+	// Big-endian capture.
+	pcap = newPcapWriter(binary.BigEndian)
+	pcap.writeIPv4(pod3IP, pod1IP, ipProtocolTCP, 40001, 80, false)
+	verdicts, err = configurator.EvaluatePcap(pod1, bytes.NewReader(pcap.buf.Bytes()))
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(verdicts).To(gomega.HaveLen(1))
+	gomega.Expect(verdicts[0].Allowed).To(gomega.BeFalse())
+
+	// Truncated capture.
+	data := pcap.buf.Bytes()
+	_, err = configurator.EvaluatePcap(pod1, bytes.NewReader(data[:len(data)-1]))
+	gomega.Expect(err).ToNot(gomega.BeNil())
+
+	// Not a pcap.
+	_, err = configurator.EvaluatePcap(pod1, bytes.NewReader(make([]byte, pcapGlobalHeaderLen)))
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring("not a pcap"))
+
+	// Pod without committed configuration.
+	_, err = configurator.EvaluatePcap(pod3, bytes.NewReader(pcap.buf.Bytes()))
+	gomega.Expect(err).ToNot(gomega.BeNil())
+}
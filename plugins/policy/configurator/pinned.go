@@ -0,0 +1,171 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// UnpinPolicy releases the pin of the policy for all pods carrying it.
+// Pods on which the policy is retained only because of the pin are pulled
+// into the transaction to get the policy removed.
+func (pct *PolicyConfiguratorTxn) UnpinPolicy(policy policymodel.ID) Txn {
+	pct.Log.WithField("policy", policy).Debug("PolicyConfigurator UnpinPolicy()")
+	if pct.unpinnedPolicies == nil {
+		pct.unpinnedPolicies = make(map[policymodel.ID]struct{})
+	}
+	pct.unpinnedPolicies[policy] = struct{}{}
+	return pct
+}
+
+// applyPinnedPolicies adds pinned policies committed for pods back into
+// the configuration of the pods if omitted by the transaction, and releases
+// pins removed by UnpinPolicy(). Policies in the transaction which are
+// pinned for their pods get the Pinned flag set, unpinned ones get it cleared.
+func (pct *PolicyConfiguratorTxn) applyPinnedPolicies() {
+	pc := pct.configurator
+	pct.retainedPolicies = make(map[podmodel.ID]map[policymodel.ID]struct{})
+	for pod, committed := range pc.config {
+		if _, configured := pct.config[pod]; configured {
+			continue
+		}
+		if pct.resync && hasPinnedPolicy(committed) {
+			// full resync omitting the pod entirely
+			pct.config[pod] = ContivPolicies{}
+		}
+		if !pct.resync && pct.hasUnpinnedPolicy(committed) {
+			pct.config[pod] = committed
+		}
+	}
+	for pod, policies := range pct.config {
+		committed := pc.config[pod]
+		retained := make(map[policymodel.ID]struct{})
+		present := make(map[policymodel.ID]struct{})
+		var updated ContivPolicies
+		changed := false
+		for _, policy := range policies {
+			_, unpinned := pct.unpinnedPolicies[policy.ID]
+			committedPolicy := committed.lookup(policy.ID)
+			if policy == committedPolicy && pc.isRetained(pod, policy.ID) {
+				if unpinned {
+					pct.Log.WithFields(logging.Fields{
+						"pod":    pct.configurator.logPod(pod),
+						"policy": policy.ID,
+					}).Debug("Removing unpinned policy retained for the pod")
+					changed = true
+					continue
+				}
+				retained[policy.ID] = struct{}{}
+			}
+			present[policy.ID] = struct{}{}
+			pinned := !unpinned && (policy.Pinned || (committedPolicy != nil && committedPolicy.Pinned))
+			if pinned != policy.Pinned {
+				policyCopy := *policy
+				policyCopy.Pinned = pinned
+				policy = &policyCopy
+				changed = true
+			}
+			updated = append(updated, policy)
+		}
+		for _, policy := range committed {
+			_, unpinned := pct.unpinnedPolicies[policy.ID]
+			_, isPresent := present[policy.ID]
+			if !policy.Pinned || unpinned || isPresent {
+				continue
+			}
+			pct.Log.WithFields(logging.Fields{
+				"pod":    pct.configurator.logPod(pod),
+				"policy": policy.ID,
+			}).Debug("Retaining pinned policy omitted for the pod")
+			updated = append(updated, policy)
+			retained[policy.ID] = struct{}{}
+			changed = true
+		}
+		if changed {
+			if updated == nil {
+				updated = ContivPolicies{}
+			}
+			pct.config[pod] = updated
+		}
+		if len(retained) > 0 {
+			pct.retainedPolicies[pod] = retained
+		}
+	}
+}
+
+// hasUnpinnedPolicy returns true if any of the policies was unpinned
+// by UnpinPolicy() of this transaction.
+func (pct *PolicyConfiguratorTxn) hasUnpinnedPolicy(policies ContivPolicies) bool {
+	for _, policy := range policies {
+		if _, unpinned := pct.unpinnedPolicies[policy.ID]; unpinned {
+			return true
+		}
+	}
+	return false
+}
+
+// saveRetainedPolicies remembers which pinned policies were retained
+// for the configured pods only because of the pin.
+func (pct *PolicyConfiguratorTxn) saveRetainedPolicies() {
+	pc := pct.configurator
+	if pct.resync || pc.retainedPolicies == nil {
+		pc.retainedPolicies = make(map[podmodel.ID]map[policymodel.ID]struct{})
+	}
+	for pod := range pct.config {
+		delete(pc.retainedPolicies, pod)
+		for policy := range pct.retainedPolicies[pod] {
+			if pc.config[pod].lookup(policy) == nil {
+				// removed in the meantime (e.g. expired)
+				continue
+			}
+			if pc.retainedPolicies[pod] == nil {
+				pc.retainedPolicies[pod] = make(map[policymodel.ID]struct{})
+			}
+			pc.retainedPolicies[pod][policy] = struct{}{}
+		}
+	}
+}
+
+// isRetained returns true if the pinned policy is committed for the pod
+// only because of the pin.
+func (pc *PolicyConfigurator) isRetained(pod podmodel.ID, policy policymodel.ID) bool {
+	_, retained := pc.retainedPolicies[pod][policy]
+	return retained
+}
+
+// hasPinnedPolicy returns true if any of the policies is pinned.
+func hasPinnedPolicy(policies ContivPolicies) bool {
+	for _, policy := range policies {
+		if policy.Pinned {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the policy of the given ID from the list (nil if not found).
+func (cp ContivPolicies) lookup(policy policymodel.ID) *ContivPolicy {
+	for _, contivPolicy := range cp {
+		if contivPolicy.ID == policy {
+			return contivPolicy
+		}
+	}
+	return nil
+}
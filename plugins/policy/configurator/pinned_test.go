@@ -0,0 +1,179 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestPinnedPolicy(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPinnedPolicy")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1Name   = "pod1"
+		pod2Name   = "pod2"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// pinned baseline: ingress allowed on TCP:22
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 22}},
+			},
+		},
+		Pinned: true,
+	}
+
+	// ingress allowed on TCP:80
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	gomega.Expect(policy1.String()).To(gomega.HaveSuffix(", Pinned>"))
+	gomega.Expect(policy2.String()).ToNot(gomega.ContainSubstring("Pinned"))
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithRuleProvenance())
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	toPod1 := func(port uint16) TrafficAction {
+		return renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(externalIP), parseIP(pod1IP), rendererAPI.TCP, 123, port)
+	}
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	gomega.Expect(toPod1(22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod1(80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod1(443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Rules of the pinned policy are marked in the provenance.
+	pinnedRules := 0
+	for _, record := range configurator.RuleProvenance(pod1) {
+		for _, contributor := range record.Contributors {
+			if contributor.Policy == policy1.ID {
+				gomega.Expect(contributor.Pinned).To(gomega.BeTrue())
+				gomega.Expect(contributor.String()).To(gomega.HaveSuffix(", Pinned>"))
+				pinnedRules++
+			} else {
+				gomega.Expect(contributor.Pinned).To(gomega.BeFalse())
+			}
+		}
+	}
+	gomega.Expect(pinnedRules).To(gomega.Equal(1))
+
+	// Resync omitting pod1 retains the pinned policy (but not the other one).
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod2, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.ConsistOf(pod1, pod2))
+	gomega.Expect(configurator.config[pod1]).To(gomega.HaveLen(1))
+	gomega.Expect(configurator.config[pod1][0].ID).To(gomega.Equal(policy1.ID))
+	gomega.Expect(toPod1(22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod1(80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// The policy is also retained when omitted by Configure()
+	// (even if passed without the flag to another pod).
+	unpinned := *policy1
+	unpinned.Pinned = false
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	txn.Configure(pod2, []*ContivPolicy{&unpinned, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	gomega.Expect(toPod1(22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod1(80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(configurator.config[pod2]).To(gomega.HaveLen(2))
+	gomega.Expect(hasPinnedPolicy(configurator.config[pod2])).To(gomega.BeFalse())
+
+	// Explicit unpin removes the retained policy.
+	txn = configurator.NewTxn(false)
+	txn.UnpinPolicy(policy1.ID)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	gomega.Expect(configurator.config[pod1]).To(gomega.HaveLen(1))
+	gomega.Expect(configurator.config[pod1][0].ID).To(gomega.Equal(policy2.ID))
+	gomega.Expect(toPod1(22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod1(80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(configurator.config[pod2]).To(gomega.HaveLen(2))
+
+	// Once unpinned, the policy can be removed by resync.
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod2, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.ConsistOf(pod2))
+	gomega.Expect(configurator.retainedPolicies).To(gomega.BeEmpty())
+}
@@ -0,0 +1,83 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// PodAnonymizer replaces pod IDs with pseudonyms in the logs and metrics
+// emitted by the configurator (see WithPodAnonymizer).
+type PodAnonymizer interface {
+	// Anonymize returns pseudonym of the pod. The same pod has to be always
+	// given the same pseudonym.
+	Anonymize(pod podmodel.ID) string
+}
+
+// WithPodAnonymizer makes the configurator identify pods in the logs and
+// metrics by pseudonyms returned by the given anonymizer instead of their
+// names. The anonymization is disabled by default. The policies are
+// processed with the real pod IDs regardless of the anonymization.
+// Pods referenced from the content of logged policies and rules (debug level)
+// are not anonymized.
+func WithPodAnonymizer(anonymizer PodAnonymizer) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.podAnonymizer = anonymizer
+	}
+}
+
+// hashingPodAnonymizer derives pseudonyms from keyed hashes of pod IDs.
+type hashingPodAnonymizer struct {
+	key []byte
+}
+
+// NewHashingPodAnonymizer returns anonymizer deriving pseudonyms from
+// HMAC-SHA256 of the pod IDs. Pseudonyms are stable for the same key,
+// the key should be kept secret to prevent guessing of the pod names.
+func NewHashingPodAnonymizer(key []byte) PodAnonymizer {
+	return &hashingPodAnonymizer{key: append([]byte{}, key...)}
+}
+
+// Anonymize returns "pod-" followed by the first 8 bytes of the hash
+// in hex.
+func (hpa *hashingPodAnonymizer) Anonymize(pod podmodel.ID) string {
+	mac := hmac.New(sha256.New, hpa.key)
+	mac.Write([]byte(pod.Namespace))
+	mac.Write([]byte{0})
+	mac.Write([]byte(pod.Name))
+	return "pod-" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// podLabel returns the string identifying the pod in the metrics.
+func (pc *PolicyConfigurator) podLabel(pod podmodel.ID) string {
+	if pc.podAnonymizer != nil {
+		return pc.podAnonymizer.Anonymize(pod)
+	}
+	return pod.String()
+}
+
+// logPod returns the value identifying the pod in the logs.
+func (pc *PolicyConfigurator) logPod(pod podmodel.ID) interface{} {
+	if pc.podAnonymizer != nil {
+		return pc.podAnonymizer.Anonymize(pod)
+	}
+	return pod
+}
@@ -0,0 +1,157 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// metricsLog is a metrics sink collecting the emitted metrics.
+type metricsLog struct {
+	commits []*CommitMetrics
+}
+
+func (ml *metricsLog) RecordCommit(metrics *CommitMetrics) {
+	ml.commits = append(ml.commits, metrics)
+}
+
+func TestPodAnonymizer(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPodAnonymizer")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// ingress allowed from pod2 on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Pseudonyms are deterministic and keyed.
+	anonymizer := NewHashingPodAnonymizer([]byte("secret"))
+	pseudonym1 := anonymizer.Anonymize(pod1)
+	pseudonym2 := anonymizer.Anonymize(pod2)
+	gomega.Expect(pseudonym1).To(gomega.HavePrefix("pod-"))
+	gomega.Expect(pseudonym1).ToNot(gomega.ContainSubstring(pod1Name))
+	gomega.Expect(pseudonym1).To(gomega.Equal(NewHashingPodAnonymizer([]byte("secret")).Anonymize(pod1)))
+	gomega.Expect(pseudonym1).ToNot(gomega.Equal(pseudonym2))
+	gomega.Expect(pseudonym1).ToNot(gomega.Equal(NewHashingPodAnonymizer([]byte("other")).Anonymize(pod1)))
+
+	// Run the same transactions with and without the anonymization.
+	run := func(options ...Option) (*metricsLog, *MockRenderer) {
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer := NewMockRenderer("A", logger)
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, options...)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		metrics := &metricsLog{}
+		configurator.RegisterMetricsSink(metrics)
+
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		txn.Configure(pod2, []*ContivPolicy{})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+
+		cache.AddPodConfig(pod2, "") /* IP released */
+		txn = configurator.NewTxn(false)
+		txn.Configure(pod2, []*ContivPolicy{})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+		return metrics, renderer
+	}
+	plainMetrics, plainRenderer := run()
+	anonMetrics, anonRenderer := run(WithPodAnonymizer(anonymizer))
+
+	// Without the anonymization, pods are identified by their names.
+	gomega.Expect(plainMetrics.commits).To(gomega.HaveLen(2))
+	gomega.Expect(plainMetrics.commits[0].Failed).To(gomega.BeFalse())
+	gomega.Expect(plainMetrics.commits[0].Pods).To(gomega.HaveLen(2))
+	pod1Metrics := plainMetrics.commits[0].Pods[pod1.String()]
+	gomega.Expect(pod1Metrics.Policies).To(gomega.Equal(1))
+	gomega.Expect(pod1Metrics.IngressRules).To(gomega.BeNumerically(">", 0))
+	gomega.Expect(pod1Metrics.Removed).To(gomega.BeFalse())
+	gomega.Expect(plainMetrics.commits[1].Pods).To(gomega.Equal(
+		map[string]PodMetrics{pod2.String(): {Removed: true}}))
+
+	// With the anonymization, only the pseudonyms are used.
+	gomega.Expect(anonMetrics.commits).To(gomega.HaveLen(2))
+	for _, commit := range anonMetrics.commits {
+		for label := range commit.Pods {
+			gomega.Expect(label).To(gomega.HavePrefix("pod-"))
+			gomega.Expect(strings.Contains(label, namespace)).To(gomega.BeFalse())
+		}
+	}
+	gomega.Expect(anonMetrics.commits[0].Pods).To(gomega.Equal(map[string]PodMetrics{
+		pseudonym1: plainMetrics.commits[0].Pods[pod1.String()],
+		pseudonym2: plainMetrics.commits[0].Pods[pod2.String()],
+	}))
+	gomega.Expect(anonMetrics.commits[1].Pods).To(gomega.Equal(
+		map[string]PodMetrics{pseudonym2: {Removed: true}}))
+
+	// The rendered configuration is not affected.
+	plainIngress, plainEgress := plainRenderer.GetRules(pod1)
+	anonIngress, anonEgress := anonRenderer.GetRules(pod1)
+	gomega.Expect(anonIngress).To(gomega.Equal(plainIngress))
+	gomega.Expect(anonEgress).To(gomega.Equal(plainEgress))
+	ip, _ := anonRenderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+}
@@ -0,0 +1,55 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// PodIDRewriter rewrites the ID of a pod configured by Txn.Configure(),
+// e.g. prefixing the namespace of pods from remote clusters to avoid
+// collisions in a federated setup. The rewrite must be deterministic.
+type PodIDRewriter func(pod podmodel.ID) podmodel.ID
+
+// WithPodIDRewriter selects the rewriter of pod IDs applied to the target
+// of every Configure(). The pods are stored, looked up in the policy cache,
+// rendered and reported (ConfiguredPods(), StagedPods(), snapshots, ...)
+// exclusively under the rewritten IDs, which must be therefore used also
+// for all the other methods taking a pod ID. Pods referenced by the matches
+// of policies are not rewritten.
+func WithPodIDRewriter(rewriter PodIDRewriter) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.podIDRewriter = rewriter
+	}
+}
+
+// rewritePodID returns the pod ID rewritten by the configured rewriter.
+func (pc *PolicyConfigurator) rewritePodID(pod podmodel.ID) podmodel.ID {
+	if pc.podIDRewriter == nil {
+		return pod
+	}
+	rewritten := pc.podIDRewriter(pod)
+	if rewritten != pod {
+		pc.Log.WithFields(logging.Fields{
+			"pod":       pc.logPod(pod),
+			"rewritten": pc.logPod(rewritten),
+		}).Debug("Rewriting pod ID")
+	}
+	return rewritten
+}
@@ -0,0 +1,139 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestPodIDRewriter(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPodIDRewriter")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1IP     = "192.168.1.1"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	remotePod1 := podmodel.ID{Name: "pod1", Namespace: "remote-" + namespace}
+
+	// pods of the remote cluster are prefixed, already prefixed IDs are kept
+	rewrites := 0
+	rewriter := func(pod podmodel.ID) podmodel.ID {
+		rewrites++
+		if pod.Namespace == namespace {
+			pod.Namespace = "remote-" + pod.Namespace
+		}
+		return pod
+	}
+
+	// ingress allowed on TCP:80 once the pod is ready
+	policy1 := &ContivPolicy{
+		ID:                 policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:               PolicyIngress,
+		RequireTargetReady: true,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(remotePod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	provider := &fakePodReadinessProvider{
+		ready: map[podmodel.ID]bool{remotePod1: false},
+	}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithPodIDRewriter(rewriter), WithPodReadiness(provider))
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	toPod := func(pod podmodel.ID) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(externalIP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	}
+
+	// The pod is staged and configured under the rewritten ID.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	staged := txn.(*PolicyConfiguratorTxn).StagedPods()
+	gomega.Expect(staged).To(gomega.HaveLen(1))
+	gomega.Expect(staged).To(gomega.HaveKey(remotePod1))
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(rewrites).To(gomega.Equal(1))
+
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{remotePod1}))
+	ingress, egress := renderer.GetRules(remotePod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).ToNot(gomega.BeEmpty())
+	ingress, egress = renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+	gomega.Expect(toPod(remotePod1)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Refresh takes the stored ID, which is not rewritten again.
+	provider.ready[remotePod1] = true
+	err = configurator.RefreshPodReadiness(remotePod1)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(rewrites).To(gomega.Equal(1))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{remotePod1}))
+	gomega.Expect(toPod(remotePod1)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Removal goes through the rewriter as well.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(rewrites).To(gomega.Equal(2))
+	ingress, egress = renderer.GetRules(remotePod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+}
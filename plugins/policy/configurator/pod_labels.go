@@ -0,0 +1,157 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// PodLabelsProvider provides the current labels of pods, evaluated by the label
+// gates of policies (ContivPolicy.RequirePodLabels, ExcludePodLabels).
+type PodLabelsProvider interface {
+	// GetPodLabels returns the labels of the given pod.
+	GetPodLabels(pod podmodel.ID) []*podmodel.Pod_Label
+}
+
+// WithPodLabels selects the provider of pod labels for the label gates
+// of policies. By default, the labels are taken from the policy cache.
+// Whenever the labels of a pod change, RefreshPodLabels() should be called
+// to re-evaluate the gates.
+func WithPodLabels(provider PodLabelsProvider) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.podLabelsProvider = provider
+	}
+}
+
+// RefreshPodLabels re-evaluates the label gates of policies for the given
+// committed pods and re-renders their rules. Pods without gated policies
+// are skipped.
+func (pc *PolicyConfigurator) RefreshPodLabels(pods ...podmodel.ID) error {
+	pc.Lock()
+	defer pc.Unlock()
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for _, pod := range pods {
+		if policies, configured := pc.config[pod]; configured && hasGatedPolicy(policies) {
+			txn.configure(pod, policies)
+		}
+	}
+	if len(txn.config) == 0 {
+		return nil
+	}
+	return txn.commit()
+}
+
+// gatedPolicies returns the policies without those whose label gates are not
+// met by the pod. If no policy is gated out, the same list is returned.
+func (pct *PolicyConfiguratorTxn) gatedPolicies(pod podmodel.ID, policies ContivPolicies) ContivPolicies {
+	if !hasGatedPolicy(policies) {
+		return policies
+	}
+	labels := pct.configurator.podLabels(pod)
+	var gated ContivPolicies
+	for _, policy := range policies {
+		if !policy.gateAllows(labels) {
+			pct.Log.WithFields(logging.Fields{
+				"pod":    pct.configurator.logPod(pod),
+				"policy": policy.ID,
+				"labels": labels,
+			}).Debug("Policy gated out by the pod labels")
+			continue
+		}
+		gated = append(gated, policy)
+	}
+	if len(gated) == len(policies) {
+		return policies
+	}
+	return gated
+}
+
+// podLabels returns the current labels of the pod.
+func (pc *PolicyConfigurator) podLabels(pod podmodel.ID) []*podmodel.Pod_Label {
+	if pc.podLabelsProvider != nil {
+		return pc.podLabelsProvider.GetPodLabels(pod)
+	}
+	found, podData := pc.Cache.LookupPod(pod)
+	if !found {
+		return nil
+	}
+	return podData.Label
+}
+
+// isGated returns true if the policy has label gates.
+func (cp *ContivPolicy) isGated() bool {
+	return len(cp.RequirePodLabels) > 0 || len(cp.ExcludePodLabels) > 0
+}
+
+// gateAllows returns true if the pod with the given labels meets the label
+// gates of the policy.
+func (cp *ContivPolicy) gateAllows(labels []*podmodel.Pod_Label) bool {
+	for _, required := range cp.RequirePodLabels {
+		if !hasPodLabel(labels, required) {
+			return false
+		}
+	}
+	for _, excluded := range cp.ExcludePodLabels {
+		if hasPodLabel(labels, excluded) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasGatedPolicy returns true if any of the policies has label gates.
+func hasGatedPolicy(policies ContivPolicies) bool {
+	for _, policy := range policies {
+		if policy.isGated() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPodLabel returns true if the label is among the labels (empty value
+// of the label matches any value).
+func hasPodLabel(labels []*podmodel.Pod_Label, label podmodel.Pod_Label) bool {
+	for _, podLabel := range labels {
+		if podLabel.Key == label.Key && (label.Value == "" || podLabel.Value == label.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeLabels writes the labels prefixed with the given string, if there are any.
+func writeLabels(sw *stringWriter, prefix string, labels []podmodel.Pod_Label) {
+	if len(labels) == 0 {
+		return
+	}
+	sw.write(prefix)
+	sw.write("[")
+	for idx, label := range labels {
+		sw.write(label.Key)
+		if label.Value != "" {
+			sw.write("=")
+			sw.write(label.Value)
+		}
+		if idx < len(labels)-1 {
+			sw.write(", ")
+		}
+	}
+	sw.write("]")
+}
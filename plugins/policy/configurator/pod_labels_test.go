@@ -0,0 +1,193 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+type fakePodLabelsProvider struct {
+	labels map[podmodel.ID][]*podmodel.Pod_Label
+}
+
+func (fpl *fakePodLabelsProvider) GetPodLabels(pod podmodel.ID) []*podmodel.Pod_Label {
+	return fpl.labels[pod]
+}
+
+func TestPodLabelGates(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPodLabelGates")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	restricted := &podmodel.Pod_Label{Key: "security", Value: "restricted"}
+	public := &podmodel.Pod_Label{Key: "security", Value: "public"}
+	exempt := &podmodel.Pod_Label{Key: "exempt", Value: "yes"}
+
+	// ingress allowed on TCP:80, only for restricted pods
+	policy1 := &ContivPolicy{
+		ID:               policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:             PolicyIngress,
+		RequirePodLabels: []podmodel.Pod_Label{*restricted},
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	gomega.Expect(policy1.String()).To(gomega.HaveSuffix(", RequirePodLabels:[security=restricted]>"))
+
+	// ingress allowed on TCP:22, for pods not exempt (with any value)
+	policy2 := &ContivPolicy{
+		ID:               policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type:             PolicyIngress,
+		ExcludePodLabels: []podmodel.Pod_Label{{Key: exempt.Key}},
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 22}},
+			},
+		},
+	}
+
+	// ingress allowed on UDP:53 for all pods
+	policy3 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy3", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: UDP, Number: 53}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP, restricted)
+	cache.AddPodConfig(pod2, pod2IP, restricted, exempt)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	toPod := func(pod podmodel.ID, podIP string, proto rendererAPI.ProtocolType, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(externalIP), parseIP(podIP), proto, 123, port)
+	}
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2, policy3})
+	txn.Configure(pod2, []*ContivPolicy{policy1, policy2, policy3})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Both pods carry the required label, pod2 is exempt from policy2.
+	gomega.Expect(toPod(pod1, pod1IP, rendererAPI.TCP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, rendererAPI.TCP, 22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, rendererAPI.TCP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, rendererAPI.TCP, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Pod1 loses the required label.
+	cache.AddPodConfig(pod1, pod1IP, public)
+	err = configurator.RefreshPodLabels(pod1)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(pod1, pod1IP, rendererAPI.TCP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, rendererAPI.TCP, 22)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, rendererAPI.UDP, 53)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	ingress, egress := renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	for _, rule := range egress {
+		gomega.Expect(rule.DestPort).ToNot(gomega.BeEquivalentTo(80))
+	}
+	// pod2 is not affected
+	gomega.Expect(toPod(pod2, pod2IP, rendererAPI.TCP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// With all policies gated out the pod becomes unrestricted.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	ingress, egress = renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+
+	// Labels from a provider.
+	provider := &fakePodLabelsProvider{
+		labels: map[podmodel.ID][]*podmodel.Pod_Label{pod1: {restricted}},
+	}
+	providerRenderer := NewMockRenderer("B", logger)
+	providerConfigurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	providerConfigurator.Init(false, WithPodLabels(provider))
+	err = providerConfigurator.RegisterRenderer(providerRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	txn = providerConfigurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(providerRenderer.TestTraffic(pod1, EgressTraffic, parseIP(externalIP), parseIP(pod1IP),
+		rendererAPI.TCP, 123, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	provider.labels[pod1] = nil
+	err = providerConfigurator.RefreshPodLabels(pod1, pod2 /* not configured */)
+	gomega.Expect(err).To(gomega.BeNil())
+	ingress, egress = providerRenderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+}
@@ -0,0 +1,107 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"path"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// RefreshPodNames re-renders rules of pods with policies whose pod name
+// patterns (Match.PodNamePatterns) select any of the given pods, to reflect
+// the pods added into or removed from the policy cache.
+func (pc *PolicyConfigurator) RefreshPodNames(pods ...podmodel.ID) error {
+	pc.Lock()
+	defer pc.Unlock()
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for pod, policies := range pc.config {
+		for _, peer := range pods {
+			if selectsPodName(policies, peer) {
+				txn.configure(pod, policies)
+				break
+			}
+		}
+	}
+	if len(txn.config) == 0 {
+		return nil
+	}
+	return txn.commit()
+}
+
+// peerPods returns the pod peers of the match: those selected by Pods and
+// NamespaceSelector (see namespacePeerPods()), followed by the pods selected
+// by PodNamePatterns (sorted, without duplicates).
+func (pct *PolicyConfiguratorTxn) peerPods(match Match) []podmodel.ID {
+	peers := pct.namespacePeerPods(match)
+	if len(match.PodNamePatterns) == 0 {
+		return peers
+	}
+	included := make(map[podmodel.ID]struct{})
+	for _, peer := range peers {
+		included[peer] = struct{}{}
+	}
+	var selected []podmodel.ID
+	for _, pattern := range match.PodNamePatterns {
+		if _, err := path.Match(pattern.Name, ""); err != nil {
+			pct.Log.WithFields(logging.Fields{
+				"pattern": pattern,
+				"err":     err,
+			}).Warn("Malformed pod name pattern, skipping")
+			continue
+		}
+		for _, pod := range pct.configurator.Cache.LookupPodsByNamespace(pattern.Namespace) {
+			if _, duplicate := included[pod]; duplicate || !pattern.selects(pod) {
+				continue
+			}
+			included[pod] = struct{}{}
+			selected = append(selected, pod)
+		}
+	}
+	sortPodIDs(selected)
+	pct.Log.WithFields(logging.Fields{
+		"patterns": match.PodNamePatterns,
+		"peers":    selected,
+	}).Debug("Expanded pod name patterns")
+	return append(peers, selected...)
+}
+
+// selects returns true if the pattern selects the given pod.
+func (pnp PodNamePattern) selects(pod podmodel.ID) bool {
+	if pod.Namespace != pnp.Namespace {
+		return false
+	}
+	matched, err := path.Match(pnp.Name, pod.Name)
+	return err == nil && matched
+}
+
+// selectsPodName returns true if any of the policies has a match with a pod
+// name pattern selecting the given pod.
+func selectsPodName(policies []*ContivPolicy, pod podmodel.ID) bool {
+	for _, policy := range policies {
+		for _, match := range policy.Matches {
+			for _, pattern := range match.PodNamePatterns {
+				if pattern.selects(pod) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
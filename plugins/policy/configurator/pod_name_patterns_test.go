@@ -0,0 +1,135 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestPodNamePatterns(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPodNamePatterns")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		web0IP    = "192.168.1.2"
+		web1IP    = "192.168.1.3"
+		db0IP     = "192.168.1.4"
+		otherIP   = "192.168.2.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	web0 := podmodel.ID{Name: "web-0", Namespace: namespace}
+	web1 := podmodel.ID{Name: "web-1", Namespace: namespace}
+	db0 := podmodel.ID{Name: "db-0", Namespace: namespace}
+	otherWeb0 := podmodel.ID{Name: "web-0", Namespace: "other"}
+
+	// ingress allowed on TCP:80 from the web pods of the default namespace
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:            MatchIngress,
+				PodNamePatterns: []PodNamePattern{{Namespace: namespace, Name: "web-*"}},
+				Ports:           []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	gomega.Expect(policy1.String()).To(gomega.ContainSubstring("PodNamePatterns:[default/web-*]"))
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(web0, web0IP)
+	cache.AddPodConfig(db0, db0IP)
+	cache.AddPodConfig(otherWeb0, otherIP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	testTraffic := func(srcIP string) TrafficAction {
+		return renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(srcIP), parseIP(pod1IP), rendererAPI.TCP, 1024, 80)
+	}
+
+	// Only the matching pods of the namespace are allowed.
+	gomega.Expect(testTraffic(web0IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(web1IP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(db0IP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(otherIP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	_, egress := renderer.GetRules(pod1)
+	numRules := len(egress)
+
+	// Added pod matching the pattern adds its rule.
+	cache.AddPodConfig(web1, web1IP)
+	err = configurator.RefreshPodNames(web1)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(testTraffic(web1IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	_, egress = renderer.GetRules(pod1)
+	gomega.Expect(egress).To(gomega.HaveLen(numRules + 1))
+
+	// Pods not matching the pattern do not trigger re-rendering.
+	commits := renderer.GetCommitCount()
+	err = configurator.RefreshPodNames(db0, otherWeb0)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits))
+
+	// Removed pod matching the pattern removes its rule.
+	cache.RemovePodConfig(web0)
+	err = configurator.RefreshPodNames(web0)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(testTraffic(web0IP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(web1IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	_, egress = renderer.GetRules(pod1)
+	gomega.Expect(egress).To(gomega.HaveLen(numRules))
+}
@@ -0,0 +1,178 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// PodPhase is the lifecycle phase of a pod as seen by the configurator.
+type PodPhase int
+
+const (
+	// PodRunning is the phase of a pod running normally.
+	PodRunning PodPhase = iota
+
+	// PodPending is the phase of a pod not yet fully started.
+	PodPending
+
+	// PodTerminating is the phase of a pod which is being deleted but still
+	// has its IP address assigned.
+	PodTerminating
+
+	// PodFailed is the phase of a pod whose containers have terminated
+	// with a failure.
+	PodFailed
+)
+
+// String converts PodPhase into a human-readable string.
+func (pp PodPhase) String() string {
+	switch pp {
+	case PodRunning:
+		return "RUNNING"
+	case PodPending:
+		return "PENDING"
+	case PodTerminating:
+		return "TERMINATING"
+	case PodFailed:
+		return "FAILED"
+	}
+	return "INVALID"
+}
+
+// terminated returns true for the phases of pods which are not expected
+// to receive or send any more traffic.
+func (pp PodPhase) terminated() bool {
+	return pp == PodTerminating || pp == PodFailed
+}
+
+// PodPhaseProvider provides the current lifecycle phase of pods.
+type PodPhaseProvider interface {
+	// GetPodPhase returns the phase of the given pod.
+	GetPodPhase(pod podmodel.ID) PodPhase
+}
+
+// TerminatedPodHandling selects how the configurator treats changes
+// of policies for pods in the PodTerminating or PodFailed phase
+// (see WithPodPhases).
+type TerminatedPodHandling int
+
+const (
+	// RenderTerminatedPods renders the rules of terminated pods as of any
+	// other pod.
+	RenderTerminatedPods TerminatedPodHandling = iota
+
+	// SkipTerminatedPods leaves the rules of terminated pods untouched
+	// (as committed before the pod terminated). The changed configuration
+	// is remembered and rendered if the pod recovers. Removal of the pod
+	// (its IP address released) is still rendered.
+	SkipTerminatedPods
+)
+
+// String converts TerminatedPodHandling into a human-readable string.
+func (tph TerminatedPodHandling) String() string {
+	switch tph {
+	case RenderTerminatedPods:
+		return "RENDER-TERMINATED-PODS"
+	case SkipTerminatedPods:
+		return "SKIP-TERMINATED-PODS"
+	}
+	return "INVALID"
+}
+
+// WithPodPhases selects the provider of pod phases and the handling of pods
+// in the PodTerminating or PodFailed phase. This avoids re-rendering rules
+// of pods during mass pod deletion. Whenever a skipped pod recovers,
+// RefreshPodPhases() should be called to render its configuration.
+// Resync transactions always render all pods.
+func WithPodPhases(provider PodPhaseProvider, handling TerminatedPodHandling) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.podPhaseProvider = provider
+		pc.terminatedPods = handling
+	}
+}
+
+// RefreshPodPhases re-checks the phase of the given pods skipped for being
+// terminated and renders the configuration of those which have recovered.
+func (pc *PolicyConfigurator) RefreshPodPhases(pods ...podmodel.ID) error {
+	pc.Lock()
+	defer pc.Unlock()
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for _, pod := range pods {
+		policies, skipped := pc.skippedPods[pod]
+		if !skipped || pc.podPhaseProvider.GetPodPhase(pod).terminated() {
+			continue
+		}
+		pc.Log.WithField("pod", pc.logPod(pod)).Debug("Skipped pod has recovered")
+		txn.configure(pod, policies)
+	}
+	if len(txn.config) == 0 {
+		return nil
+	}
+	return txn.commit()
+}
+
+// skipTerminatedPods moves configuration of terminated pods out of the
+// transaction (see SkipTerminatedPods). Pods being removed are kept.
+func (pct *PolicyConfiguratorTxn) skipTerminatedPods() {
+	pc := pct.configurator
+	if pc.podPhaseProvider == nil || pc.terminatedPods != SkipTerminatedPods || pct.resync {
+		return
+	}
+	for pod, policies := range pct.config {
+		if _, teardown := pct.teardown[pod]; teardown {
+			continue
+		}
+		found, podData := pc.Cache.LookupPod(pod)
+		if !found || podData.IpAddress == "" {
+			continue
+		}
+		phase := pc.podPhaseProvider.GetPodPhase(pod)
+		if !phase.terminated() {
+			continue
+		}
+		pct.Log.WithFields(logging.Fields{
+			"pod":   pc.logPod(pod),
+			"phase": phase,
+		}).Debug("Skipping rendering of terminated pod")
+		if pct.skipped == nil {
+			pct.skipped = make(map[podmodel.ID]ContivPolicies)
+		}
+		pct.skipped[pod] = policies
+		delete(pct.config, pod)
+	}
+}
+
+// saveSkippedPods remembers configuration of skipped pods until they recover
+// or are configured again.
+func (pct *PolicyConfiguratorTxn) saveSkippedPods() {
+	pc := pct.configurator
+	if pct.resync {
+		pc.skippedPods = nil
+	}
+	for pod := range pct.config {
+		delete(pc.skippedPods, pod)
+	}
+	for pod, policies := range pct.skipped {
+		if pc.skippedPods == nil {
+			pc.skippedPods = make(map[podmodel.ID]ContivPolicies)
+		}
+		pc.skippedPods[pod] = policies
+	}
+}
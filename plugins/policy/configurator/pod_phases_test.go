@@ -0,0 +1,182 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+type fakePodPhaseProvider struct {
+	phases map[podmodel.ID]PodPhase
+}
+
+func (fpp *fakePodPhaseProvider) GetPodPhase(pod podmodel.ID) PodPhase {
+	return fpp.phases[pod]
+}
+
+func TestSkipTerminatedPods(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSkipTerminatedPods")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	newPolicy := func(name string, port uint16) *ContivPolicy {
+		return &ContivPolicy{
+			ID:   policymodel.ID{Name: name, Namespace: namespace},
+			Type: PolicyIngress,
+			Matches: []Match{
+				{
+					Type:  MatchIngress,
+					Ports: []Port{{Protocol: TCP, Number: port}},
+				},
+			},
+		}
+	}
+	policy1 := newPolicy("policy1", 80)
+	policy2 := newPolicy("policy2", 443)
+
+	gomega.Expect(PodTerminating.String()).To(gomega.Equal("TERMINATING"))
+	gomega.Expect(SkipTerminatedPods.String()).To(gomega.Equal("SKIP-TERMINATED-PODS"))
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	phases := &fakePodPhaseProvider{phases: map[podmodel.ID]PodPhase{}}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithPodPhases(phases, SkipTerminatedPods))
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	toPod := func(pod podmodel.ID, podIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(externalIP), parseIP(podIP), rendererAPI.TCP, 123, port)
+	}
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Changes of a terminating pod are skipped, a running pod proceeds normally.
+	phases.phases[pod1] = PodTerminating
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	txn.Configure(pod2, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// A commit with only terminated pods does not reach the renderer.
+	commits := renderer.GetCommitCount()
+	phases.phases[pod2] = PodFailed
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{})
+	txn.Configure(pod2, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits))
+	gomega.Expect(toPod(pod2, pod2IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Refresh of a pod still terminated does nothing.
+	err = configurator.RefreshPodPhases(pod1, pod2)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits))
+
+	// The recovered pod gets the last configuration rendered.
+	phases.phases[pod2] = PodRunning
+	err = configurator.RefreshPodPhases(pod1, pod2)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits + 1))
+	ingress, egress := renderer.GetRules(pod2)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+	gomega.Expect(toPod(pod1, pod1IP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Removal of a terminated pod is rendered.
+	cache.AddPodConfig(pod1, "") /* IP released */
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	ingress, egress = renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{pod2}))
+
+	// By default, terminated pods are rendered.
+	cache.AddPodConfig(pod1, pod1IP)
+	defaultRenderer := NewMockRenderer("B", logger)
+	defaultConfigurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	defaultConfigurator.Init(false, WithPodPhases(phases, RenderTerminatedPods))
+	err = defaultConfigurator.RegisterRenderer(defaultRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	txn = defaultConfigurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(defaultRenderer.TestTraffic(pod1, EgressTraffic, parseIP(externalIP), parseIP(pod1IP),
+		rendererAPI.TCP, 123, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+}
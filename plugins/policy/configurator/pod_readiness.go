@@ -0,0 +1,106 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// PodReadinessProvider provides the current readiness of pods, evaluated
+// for policies requiring the target pod to be ready (ContivPolicy.RequireTargetReady).
+type PodReadinessProvider interface {
+	// IsPodReady returns true if the given pod is ready to receive traffic.
+	IsPodReady(pod podmodel.ID) bool
+}
+
+// WithPodReadiness selects the provider of pod readiness for policies
+// with RequireTargetReady. Without the provider, all pods are treated as ready.
+// Whenever the readiness of a pod changes, RefreshPodReadiness() should be
+// called to re-render its rules.
+func WithPodReadiness(provider PodReadinessProvider) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.podReadinessProvider = provider
+	}
+}
+
+// RefreshPodReadiness re-evaluates the readiness of the given committed pods
+// and re-renders their rules. Pods without policies requiring the readiness
+// are skipped.
+func (pc *PolicyConfigurator) RefreshPodReadiness(pods ...podmodel.ID) error {
+	pc.Lock()
+	defer pc.Unlock()
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for _, pod := range pods {
+		if policies, configured := pc.config[pod]; configured && hasReadinessPolicy(policies) {
+			txn.configure(pod, policies)
+		}
+	}
+	if len(txn.config) == 0 {
+		return nil
+	}
+	return txn.commit()
+}
+
+// readyPolicies returns the policies with the ingress matches removed from
+// those requiring the readiness of the pod if the pod is not ready. The policies
+// still isolate the pod, i.e. the ingress traffic is denied until the pod
+// becomes ready. If no policy is changed, the same list is returned.
+func (pct *PolicyConfiguratorTxn) readyPolicies(pod podmodel.ID, policies ContivPolicies) ContivPolicies {
+	if !hasReadinessPolicy(policies) || pct.configurator.podReady(pod) {
+		return policies
+	}
+	var ready ContivPolicies
+	for idx, policy := range policies {
+		if !policy.RequireTargetReady {
+			continue
+		}
+		if ready == nil {
+			ready = policies.Copy()
+		}
+		withoutIngress := *policy
+		withoutIngress.notReady = true
+		withoutIngress.Matches = nil
+		for _, match := range policy.Matches {
+			if match.Type != MatchIngress {
+				withoutIngress.Matches = append(withoutIngress.Matches, match)
+			}
+		}
+		ready[idx] = &withoutIngress
+	}
+	pct.Log.WithField("pod", pct.configurator.logPod(pod)).
+		Debug("Ingress of the pod denied until it is ready")
+	return ready
+}
+
+// podReady returns true if the pod is ready (or the readiness is not known).
+func (pc *PolicyConfigurator) podReady(pod podmodel.ID) bool {
+	if pc.podReadinessProvider == nil {
+		return true
+	}
+	return pc.podReadinessProvider.IsPodReady(pod)
+}
+
+// hasReadinessPolicy returns true if any of the policies requires
+// the readiness of the target pod.
+func hasReadinessPolicy(policies ContivPolicies) bool {
+	for _, policy := range policies {
+		if policy.RequireTargetReady {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+type fakePodReadinessProvider struct {
+	ready map[podmodel.ID]bool
+}
+
+func (fpr *fakePodReadinessProvider) IsPodReady(pod podmodel.ID) bool {
+	return fpr.ready[pod]
+}
+
+func TestPodReadiness(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPodReadiness")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress allowed on TCP:80 once the pod is ready, egress on TCP:443
+	policy1 := &ContivPolicy{
+		ID:                 policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:               PolicyAll,
+		RequireTargetReady: true,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+			{
+				Type:  MatchEgress,
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+	gomega.Expect(policy1.String()).To(gomega.HaveSuffix(", RequireTargetReady>"))
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	provider := &fakePodReadinessProvider{
+		ready: map[podmodel.ID]bool{pod1: false, pod2: true},
+	}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithPodReadiness(provider))
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	toPod := func(pod podmodel.ID, podIP string) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(externalIP), parseIP(podIP), rendererAPI.TCP, 123, 80)
+	}
+	fromPod := func(pod podmodel.ID, podIP string) TrafficAction {
+		return renderer.TestTraffic(pod, IngressTraffic,
+			parseIP(podIP), parseIP(externalIP), rendererAPI.TCP, 123, 443)
+	}
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Pod1 is not ready: ingress denied, egress not affected.
+	gomega.Expect(toPod(pod1, pod1IP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(fromPod(pod1, pod1IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(fromPod(pod2, pod2IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Pod1 becomes ready.
+	provider.ready[pod1] = true
+	err = configurator.RefreshPodReadiness(pod1)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(pod1, pod1IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(fromPod(pod1, pod1IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Pod1 is no longer ready, pod2 is not refreshed.
+	provider.ready[pod1] = false
+	provider.ready[pod2] = false
+	err = configurator.RefreshPodReadiness(pod1)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(pod1, pod1IP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(fromPod(pod1, pod1IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Pods without the readiness-gated policies are skipped.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	commits := renderer.GetCommitCount()
+	err = configurator.RefreshPodReadiness(pod2)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits))
+}
@@ -0,0 +1,62 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithStrictPolicing selects how rate limits (Match.RateLimit) are handled
+// for renderers without the renderer.Policing capability. By default
+// the rate limits are not passed to such renderers and the traffic is only
+// allowed. With strict policing, the commit fails instead.
+func WithStrictPolicing(strict bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.strictPolicing = strict
+	}
+}
+
+// rendererRateSpec converts rate limit of a match into the renderer
+// representation.
+func rendererRateSpec(rateLimit *RateSpec) *renderer.RateSpec {
+	if rateLimit == nil {
+		return nil
+	}
+	return &renderer.RateSpec{
+		BitsPerSecond: rateLimit.BitsPerSecond,
+		BurstBytes:    rateLimit.BurstBytes,
+	}
+}
+
+// withoutRateLimits returns the rules with rate limits removed. Rules which
+// become duplicates are skipped. If none of the rules is rate-limited,
+// the same list is returned.
+func withoutRateLimits(rules ContivRules) ContivRules {
+	return withoutRuleFeature(rules,
+		func(rule *renderer.ContivRule) bool { return rule.RateLimit != nil },
+		func(rule *renderer.ContivRule) { rule.RateLimit = nil })
+}
+
+// hasRateLimits returns true if any of the rules is rate-limited.
+func hasRateLimits(rules ContivRules) bool {
+	for _, rule := range rules {
+		if rule.RateLimit != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestRateLimit(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRateLimit")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed from pod2 (rate-limited) and from pod3 (not limited)
+	rateLimit := &RateSpec{BitsPerSecond: 1000000, BurstBytes: 10000}
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:      MatchIngress,
+				Pods:      []podmodel.ID{pod2},
+				Ports:     []Port{{Protocol: TCP, Number: 80}},
+				RateLimit: rateLimit,
+			},
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod3},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	gomega.Expect(policy1.Matches[0].String()).To(gomega.HaveSuffix(", RateLimit:1000000bps/10000B>"))
+	gomega.Expect(policy1.Matches[1].String()).ToNot(gomega.ContainSubstring("RateLimit"))
+
+	for _, strict := range []bool{false, true} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+		cache.AddPodConfig(pod3, pod3IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer1 := NewMockRenderer("A", logger)
+		renderer1.SetCapabilities(rendererAPI.Policing)
+		renderer2 := NewMockRenderer("B", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithStrictPolicing(strict))
+
+		// Register two renderers.
+		err := configurator.RegisterRenderer(renderer1)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(renderer2)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		if strict {
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("POLICING"))
+		} else {
+			gomega.Expect(err).To(gomega.BeNil())
+		}
+
+		// Renderer with the Policing capability receives the rate limit.
+		_, egress := renderer1.GetRules(pod1)
+		limited := 0
+		for _, rule := range egress {
+			if rule.RateLimit == nil {
+				continue
+			}
+			limited++
+			gomega.Expect(rule.SrcNetwork.String()).To(gomega.Equal(pod2IP + "/32"))
+			gomega.Expect(*rule.RateLimit).To(gomega.Equal(
+				rendererAPI.RateSpec{BitsPerSecond: 1000000, BurstBytes: 10000}))
+		}
+		gomega.Expect(limited).To(gomega.Equal(1))
+		action := renderer1.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+		if strict {
+			// Renderer without the capability is not given any rules.
+			ingress, egress := renderer2.GetRules(pod1)
+			gomega.Expect(ingress).To(gomega.BeEmpty())
+			gomega.Expect(egress).To(gomega.BeEmpty())
+			continue
+		}
+
+		// Renderer without the capability receives the rules without the rate limit.
+		_, egress = renderer2.GetRules(pod1)
+		gomega.Expect(egress).ToNot(gomega.BeEmpty())
+		for _, rule := range egress {
+			gomega.Expect(rule.RateLimit).To(gomega.BeNil())
+		}
+		action = renderer2.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer2.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod3IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer2.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 81)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// FlowSpec describes traffic of a pod with a network of peers (sources for
+// ingress, destinations for egress) on a given destination port (of the pod
+// for ingress, of the peer for egress).
+type FlowSpec struct {
+	Peer     net.IPNet
+	Protocol ProtocolType
+	Port     uint16 // 0 = all ports of the protocol
+}
+
+// SynthesizePolicy returns a normalized policy for the given direction
+// allowing exactly the given flows, i.e. the traffic of the direction which
+// is not listed is denied (no flows = all the traffic is denied).
+// Peers with the same set of ports share a single match and flows covered
+// by another flow (a larger peer network with the same or all ports) are
+// omitted. The policy ID is left unset. This is the inverse of the flow
+// simulation (see EvaluateFlow).
+func SynthesizePolicy(direction MatchType, allowed []FlowSpec) *ContivPolicy {
+	policy := &ContivPolicy{
+		Type:    PolicyIngress,
+		Matches: synthesizeMatches(direction, allowed),
+	}
+	if direction == MatchEgress {
+		policy.Type = PolicyEgress
+	}
+	return policy.Normalize()
+}
+
+// synthesizeMatches returns matches of the given direction allowing exactly
+// the given flows.
+func synthesizeMatches(direction MatchType, flows []FlowSpec) []Match {
+	// Collect ports of every peer network.
+	var peers []net.IPNet
+	peerPorts := make(map[string][]Port)
+	for _, flow := range flows {
+		peer := normalizeIPNet(flow.Peer)
+		key := peer.String()
+		if _, known := peerPorts[key]; !known {
+			peers = append(peers, peer)
+		}
+		peerPorts[key] = append(peerPorts[key], Port{Protocol: flow.Protocol, Number: flow.Port})
+	}
+	for key, ports := range peerPorts {
+		peerPorts[key] = withoutCoveredPorts(ports)
+	}
+
+	// Omit ports already allowed for a larger network containing the peer
+	// and group the peers with the same set of remaining ports.
+	var keys []string
+	matches := make(map[string]*Match)
+	for _, peer := range peers {
+		var ports []Port
+		for _, port := range peerPorts[peer.String()] {
+			covered := false
+			for _, other := range peers {
+				if containsNetwork(other, peer) && portCovered(port, peerPorts[other.String()]) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				ports = append(ports, port)
+			}
+		}
+		if len(ports) == 0 {
+			continue
+		}
+		key := portsKey(ports)
+		match, hasMatch := matches[key]
+		if !hasMatch {
+			match = &Match{Type: direction, IPBlocks: []IPBlock{}, Ports: ports}
+			matches[key] = match
+			keys = append(keys, key)
+		}
+		match.IPBlocks = append(match.IPBlocks, IPBlock{Network: peer})
+	}
+	sort.Strings(keys)
+
+	var result []Match
+	for _, key := range keys {
+		result = append(result, *matches[key])
+	}
+	return result
+}
+
+// containsNetwork returns true if the (normalized) network <outer> strictly
+// contains the (normalized) network <inner>.
+func containsNetwork(outer, inner net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes < innerOnes && outer.Contains(inner.IP)
+}
+
+// portCovered returns true if the port is in the list or all ports of its
+// protocol are.
+func portCovered(port Port, ports []Port) bool {
+	for _, other := range ports {
+		if other.Protocol == port.Protocol && (other.Number == 0 || other.Number == port.Number) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutCoveredPorts returns the ports normalized and without the ports
+// already covered by all-ports entry (port number zero) of their protocol.
+func withoutCoveredPorts(ports []Port) []Port {
+	ports = normalizePorts(ports)
+	var result []Port
+	for _, port := range ports {
+		if port.Number != 0 && portCovered(Port{Protocol: port.Protocol}, ports) {
+			continue
+		}
+		result = append(result, port)
+	}
+	return result
+}
+
+// portsKey returns string representation of a normalized list of ports.
+func portsKey(ports []Port) string {
+	var keys []string
+	for _, port := range ports {
+		keys = append(keys, port.String())
+	}
+	return strings.Join(keys, ",")
+}
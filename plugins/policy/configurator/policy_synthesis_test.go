@@ -0,0 +1,156 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestSynthesizePolicy(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSynthesizePolicy")
+
+	const (
+		namespace = "default"
+		podIP     = "192.168.1.1"
+	)
+	pod := podmodel.ID{Name: "pod1", Namespace: namespace}
+
+	// Initialize configurator for the round-trip through the simulator.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod, podIP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(NewMockRenderer("A", logger))
+	gomega.Expect(err).To(gomega.BeNil())
+
+	configure := func(policy *ContivPolicy) {
+		policy.ID = policymodel.ID{Name: "synthesized", Namespace: namespace}
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod, []*ContivPolicy{policy})
+		err := txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+	}
+	egressFlow := func(dstIP string, proto ProtocolType, port uint16) Flow {
+		return Flow{SrcIP: net.ParseIP(podIP), DstIP: net.ParseIP(dstIP), Protocol: proto, SrcPort: 1024, DstPort: port}
+	}
+	ingressFlow := func(srcIP string, proto ProtocolType, port uint16) Flow {
+		return Flow{SrcIP: net.ParseIP(srcIP), DstIP: net.ParseIP(podIP), Protocol: proto, SrcPort: 1024, DstPort: port}
+	}
+
+	// Egress spec.
+	policy := SynthesizePolicy(MatchEgress, []FlowSpec{
+		{Peer: parseIPNet("10.0.0.0/24"), Protocol: TCP, Port: 443},
+		{Peer: parseIPNet("10.0.1.5/32"), Protocol: UDP, Port: 53},
+		{Peer: parseIPNet("10.0.0.7/32"), Protocol: TCP, Port: 443}, /* covered by 10.0.0.0/24 */
+		{Peer: parseIPNet("10.0.2.1/24"), Protocol: TCP, Port: 443}, /* host bits cleared */
+		{Peer: parseIPNet("10.0.3.0/24"), Protocol: TCP, Port: 0},
+		{Peer: parseIPNet("10.0.3.0/24"), Protocol: TCP, Port: 80}, /* covered by all ports */
+	})
+	expected := &ContivPolicy{
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type: MatchEgress,
+				IPBlocks: []IPBlock{
+					{Network: parseIPNet("10.0.0.0/24")},
+					{Network: parseIPNet("10.0.2.0/24")},
+				},
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+			{
+				Type:     MatchEgress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.1.5/32")}},
+				Ports:    []Port{{Protocol: UDP, Number: 53}},
+			},
+			{
+				Type:     MatchEgress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.3.0/24")}},
+				Ports:    []Port{{Protocol: TCP, Number: 0}},
+			},
+		},
+	}
+	gomega.Expect(policy.String()).To(gomega.Equal(expected.Normalize().String()))
+	gomega.Expect(policy.String()).To(gomega.Equal(policy.Normalize().String()))
+
+	configure(policy)
+	for _, flow := range []Flow{
+		egressFlow("10.0.0.1", TCP, 443),
+		egressFlow("10.0.0.7", TCP, 443),
+		egressFlow("10.0.2.200", TCP, 443),
+		egressFlow("10.0.1.5", UDP, 53),
+		egressFlow("10.0.3.9", TCP, 1234),
+	} {
+		gomega.Expect(configurator.EvaluateFlow(flow)).To(gomega.BeTrue(), flow.String())
+	}
+	for _, flow := range []Flow{
+		egressFlow("10.0.0.1", TCP, 444),
+		egressFlow("10.0.0.1", UDP, 443),
+		egressFlow("10.0.1.6", UDP, 53),
+		egressFlow("10.0.1.5", TCP, 53),
+		egressFlow("10.0.3.9", UDP, 1234),
+		egressFlow("10.0.4.1", TCP, 443),
+	} {
+		gomega.Expect(configurator.EvaluateFlow(flow)).To(gomega.BeFalse(), flow.String())
+	}
+
+	// Ingress spec with both address families sharing the ports.
+	policy = SynthesizePolicy(MatchIngress, []FlowSpec{
+		{Peer: parseIPNet("192.168.2.0/24"), Protocol: TCP, Port: 8080},
+		{Peer: parseIPNet("fd00::/64"), Protocol: TCP, Port: 8080},
+	})
+	gomega.Expect(policy.Type).To(gomega.BeEquivalentTo(PolicyIngress))
+	gomega.Expect(policy.Matches).To(gomega.HaveLen(1))
+	gomega.Expect(policy.Matches[0].IPBlocks).To(gomega.HaveLen(2))
+
+	configure(policy)
+	gomega.Expect(configurator.EvaluateFlow(ingressFlow("192.168.2.5", TCP, 8080))).To(gomega.BeTrue())
+	gomega.Expect(configurator.EvaluateFlow(ingressFlow("192.168.2.5", TCP, 8081))).To(gomega.BeFalse())
+	gomega.Expect(configurator.EvaluateFlow(ingressFlow("192.168.3.5", TCP, 8080))).To(gomega.BeFalse())
+	gomega.Expect(configurator.EvaluateFlow(egressFlow("10.0.0.1", TCP, 443))).To(gomega.BeTrue()) /* egress not restricted */
+
+	// No flows: everything is denied.
+	policy = SynthesizePolicy(MatchIngress, nil)
+	gomega.Expect(policy.Matches).To(gomega.BeEmpty())
+	configure(policy)
+	gomega.Expect(configurator.EvaluateFlow(ingressFlow("192.168.2.5", TCP, 8080))).To(gomega.BeFalse())
+}
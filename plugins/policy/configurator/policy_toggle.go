@@ -0,0 +1,125 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// SetPolicyEnabled enables or disables the policy for all pods carrying it.
+// Disabled policy is kept in the configuration, but evaluated as if it was not
+// assigned to the pods, i.e. a pod with all its policies disabled becomes
+// unrestricted again (unless selected by WithEmptySetDenyAll).
+// The state is evaluated during Commit() and remembered afterwards, overriding
+// ContivPolicy.Disabled of the policy passed by later transactions.
+func (pct *PolicyConfiguratorTxn) SetPolicyEnabled(policy policymodel.ID, enabled bool) Txn {
+	pct.Log.WithFields(logging.Fields{
+		"policy":  policy,
+		"enabled": enabled,
+	}).Debug("PolicyConfigurator SetPolicyEnabled()")
+	if pct.toggledPolicies == nil {
+		pct.toggledPolicies = make(map[policymodel.ID]bool)
+	}
+	pct.toggledPolicies[policy] = enabled
+	return pct
+}
+
+// applyPolicyToggles updates the Disabled flag of policies in the transaction
+// according to SetPolicyEnabled() of this and of the previous transactions.
+// Committed pods carrying policies toggled by this transaction are pulled
+// into the transaction to get re-rendered.
+func (pct *PolicyConfiguratorTxn) applyPolicyToggles() {
+	if !pct.resync && len(pct.toggledPolicies) > 0 {
+		for pod, policies := range pct.configurator.config {
+			if _, configured := pct.config[pod]; !configured && pct.hasToggledPolicy(policies) {
+				pct.config[pod] = policies
+			}
+		}
+	}
+	for pod, policies := range pct.config {
+		var toggled ContivPolicies
+		for idx, policy := range policies {
+			enabled, hasState := pct.policyEnabled(policy.ID)
+			if !hasState || policy.Enabled() == enabled {
+				continue
+			}
+			if toggled == nil {
+				// do not modify the committed list
+				toggled = append(ContivPolicies{}, policies...)
+			}
+			policyCopy := *policy
+			policyCopy.Disabled = !enabled
+			toggled[idx] = &policyCopy
+		}
+		if toggled != nil {
+			pct.Log.WithField("pod", pct.configurator.logPod(pod)).Debug("Toggled policies of the pod")
+			pct.config[pod] = toggled
+		}
+	}
+}
+
+// hasToggledPolicy returns true if any of the policies was toggled
+// by SetPolicyEnabled() of this transaction.
+func (pct *PolicyConfiguratorTxn) hasToggledPolicy(policies ContivPolicies) bool {
+	for _, policy := range policies {
+		if _, toggled := pct.toggledPolicies[policy.ID]; toggled {
+			return true
+		}
+	}
+	return false
+}
+
+// policyEnabled returns the state of the policy set by SetPolicyEnabled()
+// of this or of some previous transaction (if any).
+func (pct *PolicyConfiguratorTxn) policyEnabled(policy policymodel.ID) (enabled bool, hasState bool) {
+	if enabled, hasState = pct.toggledPolicies[policy]; hasState {
+		return enabled, true
+	}
+	enabled, hasState = pct.configurator.policyToggles[policy]
+	return enabled, hasState
+}
+
+// saveToggledPolicies remembers the state of policies toggled by this
+// transaction.
+func (pct *PolicyConfiguratorTxn) saveToggledPolicies() {
+	for policy, enabled := range pct.toggledPolicies {
+		if pct.configurator.policyToggles == nil {
+			pct.configurator.policyToggles = make(map[policymodel.ID]bool)
+		}
+		pct.configurator.policyToggles[policy] = enabled
+	}
+}
+
+// enabledPolicies returns the policies without the disabled ones. If none
+// of the policies is disabled, the same list is returned.
+func enabledPolicies(policies ContivPolicies) ContivPolicies {
+	for idx, policy := range policies {
+		if policy.Enabled() {
+			continue
+		}
+		enabled := append(ContivPolicies{}, policies[:idx]...)
+		for _, policy := range policies[idx+1:] {
+			if policy.Enabled() {
+				enabled = append(enabled, policy)
+			}
+		}
+		return enabled
+	}
+	return policies
+}
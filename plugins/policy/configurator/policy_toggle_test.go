@@ -0,0 +1,169 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestSetPolicyEnabled(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSetPolicyEnabled")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1Name   = "pod1"
+		pod2Name   = "pod2"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// ingress allowed on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// ingress allowed on TCP:443
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	toPod := func(pod podmodel.ID, podIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP(externalIP), parseIP(podIP), rendererAPI.TCP, 123, port)
+	}
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	gomega.Expect(toPod(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 8080)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Disable policy1 for all pods.
+	txn = configurator.NewTxn(false)
+	txn.SetPolicyEnabled(policy1.ID, false)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Pod1 is left with no enabled policy - not restricted.
+	ingress, egress := renderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+	gomega.Expect(toPod(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 443)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+
+	// Pod2 is restricted only by policy2.
+	gomega.Expect(toPod(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// The disabled policy is retained in the configuration.
+	gomega.Expect(configurator.config[pod1]).To(gomega.HaveLen(1))
+	gomega.Expect(configurator.config[pod1][0].ID).To(gomega.Equal(policy1.ID))
+	gomega.Expect(configurator.config[pod1][0].Enabled()).To(gomega.BeFalse())
+	gomega.Expect(policy1.Enabled()).To(gomega.BeTrue())
+
+	// The state is remembered for the policy passed again.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(pod1, pod1IP, 443)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+
+	// Re-enable policy1.
+	txn = configurator.NewTxn(false)
+	txn.SetPolicyEnabled(policy1.ID, true)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	gomega.Expect(toPod(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod1, pod1IP, 443)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(toPod(pod2, pod2IP, 8080)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Policy disabled by the caller.
+	disabled := policy2.DeepCopy()
+	disabled.Disabled = true
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{disabled})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(toPod(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	gomega.Expect(disabled.String()).To(gomega.ContainSubstring(", Disabled>"))
+}
@@ -0,0 +1,157 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"math/bits"
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// PolicyWidthLimit bounds the width of a policy (see PolicyWidth()).
+// It equals the width of a match allowing all IPv4 peers on all ports.
+const PolicyWidthLimit = uint64(1) << 48
+
+// PolicyWidth returns the size of the space allowed by the policy, i.e. the
+// number of distinct peer address / destination port combinations permitted
+// by its matches, summed over the directions and bounded by PolicyWidthLimit.
+// Unrestricted peers count as the entire IPv4 address space, unrestricted
+// ports as all 65536 ports. The width is computed from the normalized
+// structure of the policy, with pods referenced by the matches resolved
+// to the committed IP addresses, not from live traffic. Overlaps between
+// matches are not subtracted and deny matches do not reduce the width,
+// therefore the value is an upper bound. A wide policy is potentially
+// over-permissive.
+func (pc *PolicyConfigurator) PolicyWidth(policy *ContivPolicy) uint64 {
+	pc.Lock()
+	defer pc.Unlock()
+	return pc.policyWidth(policy)
+}
+
+// RegisterPolicyWidthGauge registers with the given Prometheus registerer
+// the gauge "policy_allowed_space", reporting PolicyWidth() of every policy
+// committed for at least one pod, labeled by the policy ID ("namespace/name").
+// The gauge is evaluated on every scrape.
+func (pc *PolicyConfigurator) RegisterPolicyWidthGauge(registerer prometheus.Registerer) error {
+	return registerer.Register(&policyWidthCollector{
+		configurator: pc,
+		desc: prometheus.NewDesc("policy_allowed_space",
+			"Number of distinct peer address and port combinations allowed by the policy (bounded)",
+			[]string{"policy"}, nil),
+	})
+}
+
+// policyWidthCollector collects widths of the committed policies.
+type policyWidthCollector struct {
+	configurator *PolicyConfigurator
+	desc         *prometheus.Desc
+}
+
+// Describe sends the descriptor of the gauge.
+func (pwc *policyWidthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pwc.desc
+}
+
+// Collect sends the width of every committed policy.
+func (pwc *policyWidthCollector) Collect(ch chan<- prometheus.Metric) {
+	for policy, width := range pwc.configurator.committedPolicyWidths() {
+		ch <- prometheus.MustNewConstMetric(pwc.desc, prometheus.GaugeValue,
+			float64(width), policy.String())
+	}
+}
+
+// committedPolicyWidths returns widths of all policies committed for at least
+// one pod.
+func (pc *PolicyConfigurator) committedPolicyWidths() map[policymodel.ID]uint64 {
+	pc.Lock()
+	defer pc.Unlock()
+	widths := make(map[policymodel.ID]uint64)
+	for _, policies := range pc.config {
+		for _, policy := range policies {
+			if _, computed := widths[policy.ID]; !computed {
+				widths[policy.ID] = pc.policyWidth(policy)
+			}
+		}
+	}
+	return widths
+}
+
+// policyWidth implements PolicyWidth() with the configurator already locked.
+func (pc *PolicyConfigurator) policyWidth(policy *ContivPolicy) uint64 {
+	policies := pc.canonicalPolicies(ContivPolicies{policy.DeepCopy()})
+	policies = enabledPolicies(pc.inheritedPolicies(policies))
+
+	// Rules are generated in a scratch transaction, never committed.
+	pct := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	pct.podIPAddresses = pc.podIPAddresses.Copy()
+	pct.clusterDNSIP = pc.clusterDNSIP
+	var width uint64
+	for _, direction := range []MatchType{MatchIngress, MatchEgress} {
+		for _, policy := range policies {
+			rules := pct.appendPolicyRules(ContivRules{}, direction, policy,
+				make(map[AddressFamily]bool), make(map[AddressFamily]bool))
+			for _, rule := range rules {
+				if rule.Action != renderer.ActionPermit {
+					continue
+				}
+				peer := rule.SrcNetwork
+				if direction == MatchEgress {
+					peer = rule.DestNetwork
+				}
+				width = boundedSum(width, ruleWidth(peer, rule.DestPort))
+			}
+		}
+	}
+	return width
+}
+
+// ruleWidth returns the number of peer address / port combinations
+// of a single rule, bounded by PolicyWidthLimit.
+func ruleWidth(peer *net.IPNet, port uint16) uint64 {
+	hostBits := net.IPv4len * 8
+	if peer != nil && len(peer.IP) > 0 {
+		hostBits = len(peer.Mask) * 8
+		for _, octet := range peer.Mask {
+			// masks may be non-contiguous (IPMasks)
+			hostBits -= bits.OnesCount8(octet)
+		}
+	}
+	ports := uint64(1)
+	if port == 0 {
+		ports = 1 << 16
+	}
+	if hostBits >= 48 {
+		return PolicyWidthLimit
+	}
+	hosts := uint64(1) << uint(hostBits)
+	if hosts > PolicyWidthLimit/ports {
+		return PolicyWidthLimit
+	}
+	return hosts * ports
+}
+
+// boundedSum returns a+b bounded by PolicyWidthLimit.
+func boundedSum(a, b uint64) uint64 {
+	if a+b > PolicyWidthLimit {
+		return PolicyWidthLimit
+	}
+	return a + b
+}
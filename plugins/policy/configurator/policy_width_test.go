@@ -0,0 +1,148 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestPolicyWidth(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPolicyWidth")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// allow-all ingress
+	broadPolicy := &ContivPolicy{
+		ID:      policymodel.ID{Name: "broad", Namespace: namespace},
+		Type:    PolicyIngress,
+		Matches: []Match{{Type: MatchIngress}},
+	}
+	// ingress from a single host on a single port
+	narrowPolicy := &ContivPolicy{
+		ID:   policymodel.ID{Name: "narrow", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:     MatchIngress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.0.1/32")}},
+				Ports:    []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	// egress to a pod on two ports and to a /24 subnet on any port
+	mixedPolicy := &ContivPolicy{
+		ID:   policymodel.ID{Name: "mixed", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type:  MatchEgress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}, {Protocol: TCP, Number: 443}},
+			},
+			{
+				Type:     MatchEgress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.1.0.0/24")}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Widths computed from the policy structure.
+	gomega.Expect(configurator.PolicyWidth(broadPolicy)).To(gomega.Equal(PolicyWidthLimit))
+	gomega.Expect(configurator.PolicyWidth(narrowPolicy)).To(gomega.BeEquivalentTo(1))
+	gomega.Expect(configurator.PolicyWidth(mixedPolicy)).To(gomega.BeEquivalentTo(2 + 256*65536))
+
+	// The gauge reports only the committed policies.
+	registry := prometheus.NewRegistry()
+	err = configurator.RegisterPolicyWidthGauge(registry)
+	gomega.Expect(err).To(gomega.BeNil())
+	gauge := func() map[string]float64 {
+		families, err := registry.Gather()
+		gomega.Expect(err).To(gomega.BeNil())
+		values := make(map[string]float64)
+		for _, family := range families {
+			if family.GetName() != "policy_allowed_space" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				values[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+			}
+		}
+		return values
+	}
+	gomega.Expect(gauge()).To(gomega.BeEmpty())
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{broadPolicy, narrowPolicy})
+	txn.Configure(pod2, []*ContivPolicy{narrowPolicy})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(gauge()).To(gomega.Equal(map[string]float64{
+		"default/broad":  float64(PolicyWidthLimit),
+		"default/narrow": 1,
+	}))
+
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(gauge()).To(gomega.Equal(map[string]float64{"default/narrow": 1}))
+}
@@ -0,0 +1,66 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+)
+
+// RegisterPortSet registers (or replaces) a named set of ports which can be
+// referenced from Match.PortSets instead of repeating the ports in every
+// match. Port-sets are expanded when the rules are generated, i.e. pods
+// already configured with policies referencing a replaced port-set pick up
+// the change with their next commit (or resync).
+func (pc *PolicyConfigurator) RegisterPortSet(name string, ports []Port) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	pc.portSets[name] = append([]Port{}, ports...)
+	pc.Log.WithFields(logging.Fields{
+		"name":  name,
+		"ports": ports,
+	}).Debug("Registered port-set")
+}
+
+// expandPortSets returns the ports of the match merged with the ports
+// of the referenced port-sets. The order of the ports is preserved
+// and duplicates are removed.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) expandPortSets(match Match) []Port {
+	var ports []Port
+	seen := make(map[Port]struct{})
+	add := func(port Port) {
+		if _, duplicate := seen[port]; !duplicate {
+			seen[port] = struct{}{}
+			ports = append(ports, port)
+		}
+	}
+	for _, port := range match.Ports {
+		add(port)
+	}
+	for _, name := range match.PortSets {
+		portSet, registered := pc.portSets[name]
+		if !registered {
+			pc.Log.WithField("portSet", name).Warn("Referenced port-set is not registered")
+			continue
+		}
+		for _, port := range portSet {
+			add(port)
+		}
+	}
+	return ports
+}
@@ -0,0 +1,156 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestPortSets(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestPortSets")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	webPorts := []Port{{Protocol: TCP, Number: 80}, {Protocol: TCP, Number: 443}, {Protocol: TCP, Number: 8080}}
+
+	// ingress allowed from pod2 to web ports and SSH, egress to anywhere on DNS
+	inlinePolicy := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyAll,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 443}, {Protocol: TCP, Number: 22},
+					{Protocol: TCP, Number: 80}, {Protocol: TCP, Number: 8080}},
+			},
+			{
+				Type:  MatchEgress,
+				Ports: []Port{{Protocol: UDP, Number: 53}, {Protocol: TCP, Number: 53}},
+			},
+		},
+	}
+	// the same with port-sets (overlapping with the inline ports)
+	portSetPolicy := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyAll,
+		Matches: []Match{
+			{
+				Type:     MatchIngress,
+				Pods:     []podmodel.ID{pod2},
+				Ports:    []Port{{Protocol: TCP, Number: 443}, {Protocol: TCP, Number: 22}},
+				PortSets: []string{"web"},
+			},
+			{
+				Type:     MatchEgress,
+				PortSets: []string{"dns", "dns"},
+			},
+		},
+	}
+	gomega.Expect(portSetPolicy.Matches[0].String()).To(gomega.ContainSubstring(", PortSets:[web]"))
+	gomega.Expect(portSetPolicy.Matches[1].DeepCopy().PortSets).To(gomega.Equal(portSetPolicy.Matches[1].PortSets))
+	gomega.Expect(portSetPolicy.Matches[1].Normalize().PortSets).To(gomega.Equal([]string{"dns"}))
+
+	newConfigurator := func(renderer *MockRenderer) *PolicyConfigurator {
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator
+	}
+
+	// Render the policy with inlined ports.
+	inlineRenderer := NewMockRenderer("A", logger)
+	inlineConfigurator := newConfigurator(inlineRenderer)
+	txn := inlineConfigurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{inlinePolicy})
+	err := txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Render the policy with port-sets where "dns" is not registered yet.
+	portSetRenderer := NewMockRenderer("B", logger)
+	portSetConfigurator := newConfigurator(portSetRenderer)
+	portSetConfigurator.RegisterPortSet("web", webPorts)
+	txn = portSetConfigurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{portSetPolicy})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Match with unknown port-sets only does not allow anything.
+	action := portSetRenderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP("8.8.8.8"), rendererAPI.UDP, 123, 53)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = portSetRenderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP("8.8.8.8"), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = portSetRenderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 8080)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Once registered, the port-set is used with the next commit.
+	portSetConfigurator.RegisterPortSet("dns", []Port{{Protocol: UDP, Number: 53}, {Protocol: TCP, Number: 53}})
+	txn = portSetConfigurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{portSetPolicy})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	action = portSetRenderer.TestTraffic(pod1, IngressTraffic,
+		parseIP(pod1IP), parseIP("8.8.8.8"), rendererAPI.UDP, 123, 53)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Referencing port-sets yields the same rules as inlining their ports.
+	inlineIngress, inlineEgress := inlineRenderer.GetRules(pod1)
+	ingress, egress := portSetRenderer.GetRules(pod1)
+	gomega.Expect(ingress).To(gomega.Equal(inlineIngress))
+	gomega.Expect(egress).To(gomega.Equal(inlineEgress))
+}
@@ -0,0 +1,71 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestParsePort(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	port, err := ParsePort("TCP:443")
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(port).To(gomega.Equal(Port{Protocol: TCP, Number: 443}))
+
+	port, err = ParsePort("UDP:ANY")
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(port).To(gomega.Equal(Port{Protocol: UDP, Number: 0}))
+
+	port, err = ParsePort("udp:53")
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(port).To(gomega.Equal(Port{Protocol: UDP, Number: 53}))
+
+	port, err = ParsePort("TCP:65535")
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(port).To(gomega.Equal(Port{Protocol: TCP, Number: 65535}))
+
+	// Invalid inputs.
+	for _, invalid := range []string{"", "TCP", "TCP:", ":80", "ICMP:80", "TCP:65536",
+		"TCP:-1", "TCP:http", "TCP:80:81", "TCP: 80"} {
+		_, err = ParsePort(invalid)
+		gomega.Expect(err).ToNot(gomega.BeNil(), invalid)
+	}
+}
+
+func TestPortRoundTrip(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	numbers := []uint16{0, 1, 53, 80, 443, 1024, 8080, 32767, 32768, 65534, 65535}
+	for _, protocol := range []ProtocolType{TCP, UDP} {
+		for _, number := range numbers {
+			port := Port{Protocol: protocol, Number: number}
+			parsed, err := ParsePort(port.String())
+			gomega.Expect(err).To(gomega.BeNil(), port.String())
+			gomega.Expect(parsed).To(gomega.Equal(port))
+		}
+	}
+
+	// Ports with an invalid protocol must not parse back.
+	for _, protocol := range []ProtocolType{-1, UDP + 1, 100} {
+		port := Port{Protocol: protocol, Number: 80}
+		_, err := ParsePort(port.String())
+		gomega.Expect(err).ToNot(gomega.BeNil(), port.String())
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"sort"
+)
+
+// WithAllowedProtocols restricts the set of protocols that policies are allowed
+// to reference in their ports. A commit of a transaction with a policy referencing
+// any other protocol fails with an error and nothing gets rendered.
+// Allow matches without any ports, which would otherwise open all protocols,
+// are restricted to all ports of the allowed protocols.
+// By default, all protocols are allowed.
+func WithAllowedProtocols(protocols ...ProtocolType) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.allowedProtocols = make(map[ProtocolType]struct{})
+		for _, protocol := range protocols {
+			pc.allowedProtocols[protocol] = struct{}{}
+		}
+	}
+}
+
+// checkProtocols returns an error if any of the policies in the transaction
+// references a protocol not allowed by WithAllowedProtocols, either directly
+// or through a port-set.
+func (pct *PolicyConfiguratorTxn) checkProtocols() error {
+	if pct.configurator.allowedProtocols == nil {
+		return nil
+	}
+	for _, policies := range pct.config {
+		for _, policy := range policies {
+			for _, match := range policy.Matches {
+				ports := match.Ports
+				if len(match.PortSets) > 0 {
+					ports = pct.configurator.expandPortSets(match)
+				}
+				for _, ports := range [][]Port{ports, match.SourcePorts} {
+					for _, port := range ports {
+						if _, allowed := pct.configurator.allowedProtocols[port.Protocol]; !allowed {
+							return fmt.Errorf("policy %s references disallowed protocol %s",
+								policy.ID, port.Protocol)
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// allowedProtocolPorts returns ports matching all traffic of every protocol
+// allowed by WithAllowedProtocols, ordered by the protocol.
+func (pc *PolicyConfigurator) allowedProtocolPorts() []Port {
+	ports := []Port{}
+	for protocol := range pc.allowedProtocols {
+		ports = append(ports, Port{Protocol: protocol})
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Protocol < ports[j].Protocol
+	})
+	return ports
+}
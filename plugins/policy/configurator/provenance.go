@@ -0,0 +1,129 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+const (
+	// natLoopbackLabel labels the rule allowing access from the NAT-loopback.
+	natLoopbackLabel = "nat-loopback"
+
+	// denyRestLabel labels the final rule denying the unmatched traffic.
+	denyRestLabel = "deny-rest"
+)
+
+// RuleContributor identifies a source which made the configurator
+// to generate a given rule.
+type RuleContributor struct {
+	// Policy and index of the policy match that the rule was generated from.
+	Policy     policymodel.ID
+	MatchIndex int
+
+	// Pinned is true if the policy is pinned (see ContivPolicy.Pinned).
+	Pinned bool
+
+	// Label is set instead of Policy (and MatchIndex is -1) for rules
+	// injected by the configurator itself.
+	Label string
+}
+
+// String converts RuleContributor into a human-readable string.
+func (rc RuleContributor) String() string {
+	if rc.Label != "" {
+		return "<" + rc.Label + ">"
+	}
+	if rc.Pinned {
+		return fmt.Sprintf("<%s, Match:%d, Pinned>", rc.Policy, rc.MatchIndex)
+	}
+	return fmt.Sprintf("<%s, Match:%d>", rc.Policy, rc.MatchIndex)
+}
+
+// ProvenanceRecord lists all contributors of a single rule generated
+// for a given pod. Since duplicate rules are merged, a single rule may
+// have multiple contributors.
+type ProvenanceRecord struct {
+	// Ingress is true for ingress rules, false for egress rules
+	// (from the vswitch point of view).
+	Ingress bool
+
+	Rule         *renderer.ContivRule
+	Contributors []RuleContributor
+}
+
+// WithRuleProvenance enables tracking of the origin of every generated rule.
+// The tracking comes with a performance penalty and is intended for debugging
+// only. The collected data are available via RuleProvenance().
+func WithRuleProvenance() Option {
+	return func(pc *PolicyConfigurator) {
+		pc.trackProvenance = true
+	}
+}
+
+// RuleProvenance returns for every rule currently configured for the given
+// pod the list of policies and their matches that the rule was generated from.
+// Returns nil if the pod is not configured or if the option WithRuleProvenance
+// is not enabled.
+func (pc *PolicyConfigurator) RuleProvenance(pod podmodel.ID) []ProvenanceRecord {
+	pc.Lock()
+	defer pc.Unlock()
+	records, hasRecords := pc.provenance[pod]
+	if !hasRecords {
+		return nil
+	}
+	recordsCopy := make([]ProvenanceRecord, len(records))
+	for idx, record := range records {
+		recordsCopy[idx] = ProvenanceRecord{
+			Ingress:      record.Ingress,
+			Rule:         record.Rule.Copy(),
+			Contributors: append([]RuleContributor{}, record.Contributors...),
+		}
+	}
+	return recordsCopy
+}
+
+// addContributor associates the rule with the currently processed policy match.
+func (pct *PolicyConfiguratorTxn) addContributor(rule *renderer.ContivRule) {
+	if pct.origins == nil {
+		return
+	}
+	for _, contributor := range pct.origins[rule] {
+		if contributor == pct.origin {
+			return
+		}
+	}
+	pct.origins[rule] = append(pct.origins[rule], pct.origin)
+}
+
+// buildProvenance builds provenance records for the given lists of generated rules.
+func (pct *PolicyConfiguratorTxn) buildProvenance(ingress, egress ContivRules) []ProvenanceRecord {
+	records := []ProvenanceRecord{}
+	for _, rule := range ingress {
+		records = append(records,
+			ProvenanceRecord{Ingress: true, Rule: rule, Contributors: pct.origins[rule]})
+	}
+	for _, rule := range egress {
+		records = append(records,
+			ProvenanceRecord{Ingress: false, Rule: rule, Contributors: pct.origins[rule]})
+	}
+	return records
+}
@@ -0,0 +1,170 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestRuleProvenance(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRuleProvenance")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{
+					pod2,
+				},
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: UDP, Number: 53},
+				},
+			},
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{
+					pod2,
+				},
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithRuleProvenance())
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Test provenance of the egress rules.
+	records := configurator.RuleProvenance(pod1)
+	gomega.Expect(records).To(gomega.HaveLen(4))
+	contributors := map[string][]RuleContributor{}
+	for _, record := range records {
+		gomega.Expect(record.Ingress).To(gomega.BeFalse())
+		contributors[record.Rule.String()] = record.Contributors
+	}
+
+	tcpRule := &rendererAPI.ContivRule{
+		Action:      rendererAPI.ActionPermit,
+		SrcNetwork:  ipNetwork(pod2IP + "/32"),
+		DestNetwork: ipNetwork(""),
+		Protocol:    rendererAPI.TCP,
+		DestPort:    80,
+	}
+	gomega.Expect(contributors[tcpRule.String()]).To(gomega.ConsistOf(
+		RuleContributor{Policy: policy1.ID, MatchIndex: 0},
+		RuleContributor{Policy: policy2.ID, MatchIndex: 1}))
+
+	udpRule := &rendererAPI.ContivRule{
+		Action:      rendererAPI.ActionPermit,
+		SrcNetwork:  ipNetwork(""),
+		DestNetwork: ipNetwork(""),
+		Protocol:    rendererAPI.UDP,
+		DestPort:    53,
+	}
+	gomega.Expect(contributors[udpRule.String()]).To(gomega.ConsistOf(
+		RuleContributor{Policy: policy2.ID, MatchIndex: 0}))
+
+	natRule := &rendererAPI.ContivRule{
+		Action:      rendererAPI.ActionPermit,
+		SrcNetwork:  ipNetwork(natLoopbackIP + "/32"),
+		DestNetwork: ipNetwork(""),
+		Protocol:    rendererAPI.ANY,
+	}
+	gomega.Expect(contributors[natRule.String()]).To(gomega.ConsistOf(
+		RuleContributor{MatchIndex: -1, Label: natLoopbackLabel}))
+
+	denyRule := &rendererAPI.ContivRule{
+		Action:      rendererAPI.ActionDeny,
+		SrcNetwork:  ipNetwork(""),
+		DestNetwork: ipNetwork(""),
+		Protocol:    rendererAPI.ANY,
+	}
+	gomega.Expect(contributors[denyRule.String()]).To(gomega.ConsistOf(
+		RuleContributor{MatchIndex: -1, Label: denyRestLabel}))
+
+	// Pod2 is not configured.
+	gomega.Expect(configurator.RuleProvenance(pod2)).To(gomega.BeNil())
+}
@@ -0,0 +1,47 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import "errors"
+
+// ErrReadOnly is returned by Txn.Commit() while the configurator is read-only.
+var ErrReadOnly = errors.New("policy configurator is read-only")
+
+// SetReadOnly enables/disables the read-only mode. While read-only,
+// transactions can be still created (NewTxn), but their Commit() fails with
+// ErrReadOnly and nothing is applied. The introspection methods (e.g.
+// ConfiguredPods, LastCommitStatus) and RequestResync, which only re-renders
+// the committed state, keep working.
+// A transaction in the middle of the commit is let finish - the call waits
+// for it. Transactions not yet committed when the mode is enabled are rejected
+// on Commit(), even if they were created before.
+// Changes triggered internally from the committed configuration (delayed
+// teardowns, policy expiration, DNS, FQDN and API server refreshes) are still
+// applied.
+func (pc *PolicyConfigurator) SetReadOnly(readOnly bool) {
+	pc.Lock()
+	defer pc.Unlock()
+	pc.Log.WithField("readOnly", readOnly).Info("Setting read-only mode")
+	pc.readOnly = readOnly
+}
+
+// ReadOnly returns true if the configurator is in the read-only mode.
+func (pc *PolicyConfigurator) ReadOnly() bool {
+	pc.Lock()
+	defer pc.Unlock()
+	return pc.readOnly
+}
@@ -0,0 +1,169 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestReadOnly(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestReadOnly")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed only from pod2
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.ReadOnly()).To(gomega.BeFalse())
+
+	// Commit policy for pod1.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	commitTime, _ := configurator.LastCommitStatus()
+
+	// Transaction created before the read-only mode is enabled.
+	staleTxn := configurator.NewTxn(false)
+	staleTxn.Configure(pod1, []*ContivPolicy{})
+
+	// Enable the read-only mode.
+	configurator.SetReadOnly(true)
+	gomega.Expect(configurator.ReadOnly()).To(gomega.BeTrue())
+
+	err = staleTxn.Commit()
+	gomega.Expect(err).To(gomega.Equal(ErrReadOnly))
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.Equal(ErrReadOnly))
+
+	// Nothing was applied.
+	action := renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod3IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Introspection and resync keep working.
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.ConsistOf(pod1))
+	lastCommitTime, lastCommitErr := configurator.LastCommitStatus()
+	gomega.Expect(lastCommitTime).To(gomega.Equal(commitTime))
+	gomega.Expect(lastCommitErr).To(gomega.BeNil())
+	err = configurator.RequestResync(podmodel.Pod_Label{})
+	gomega.Expect(err).To(gomega.BeNil())
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod3IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Clear the read-only mode, commits are applied again.
+	configurator.SetReadOnly(false)
+	gomega.Expect(configurator.ReadOnly()).To(gomega.BeFalse())
+	err = staleTxn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod3IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+
+	// Commits running concurrently with the mode changes either fully succeed
+	// or are rejected.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			txn := configurator.NewTxn(false)
+			if i%2 == 0 {
+				txn.Configure(pod1, []*ContivPolicy{policy1})
+			} else {
+				txn.Configure(pod1, []*ContivPolicy{})
+			}
+			errs <- txn.Commit()
+		}(i)
+		configurator.SetReadOnly(i%3 == 0)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			gomega.Expect(err).To(gomega.Equal(ErrReadOnly))
+		}
+	}
+}
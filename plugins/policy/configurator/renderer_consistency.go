@@ -0,0 +1,120 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// PodRuleDiscrepancy describes a difference between the rules installed
+// by a renderer for a pod and the rules intended by the configurator.
+type PodRuleDiscrepancy struct {
+	// Pod is the pod with the discrepancy.
+	Pod podmodel.ID
+
+	// Renderer is the label of the renderer with the discrepancy (empty
+	// for default renderers).
+	Renderer podmodel.Pod_Label
+
+	// Intended is true if the pod should be configured in the renderer.
+	Intended bool
+
+	// Configured is true if the renderer reports a configuration for the pod.
+	Configured bool
+
+	// Ingress and Egress describe the changes of the installed rules needed
+	// to get the intended ones: Added lists the missing rules, Removed lists
+	// the unexpected rules. The direction is from the vswitch point of view.
+	Ingress renderer.RuleDelta
+	Egress  renderer.RuleDelta
+}
+
+// CompareRenderers compares the rules installed by the renderers registered
+// with the labels <a> and <b> (empty label for the default renderers) against
+// the committed rules intended for them, for all configured pods. Installed
+// rules are read back via renderer.RuleReader, which all compared renderers
+// have to implement. The discrepancies are returned sorted by the pod
+// namespace and name, empty if both renderers agree with the configurator.
+// Neither the configuration nor the renderers are modified.
+func (pc *PolicyConfigurator) CompareRenderers(a, b podmodel.Pod_Label) ([]PodRuleDiscrepancy, error) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	var compared []int
+	for _, label := range []podmodel.Pod_Label{a, b} {
+		found := false
+		for idx := range pc.renderers {
+			if !pc.hasRendererLabel(idx, label) {
+				continue
+			}
+			found = true
+			if _, isReader := pc.renderers[idx].(renderer.RuleReader); !isReader {
+				return nil, fmt.Errorf("renderer registered for label %s=%s does not support reading back rules",
+					label.Key, label.Value)
+			}
+			if !hasRenderer(compared, idx) {
+				compared = append(compared, idx)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no renderer registered for label %s=%s", label.Key, label.Value)
+		}
+	}
+
+	pods := []podmodel.ID{}
+	for pod := range pc.assignments {
+		pods = append(pods, pod)
+	}
+	sortPodIDs(pods)
+
+	discrepancies := []PodRuleDiscrepancy{}
+	for _, pod := range pods {
+		for _, idx := range compared {
+			if discrepancy, found := pc.compareRenderer(idx, pod); found {
+				discrepancies = append(discrepancies, discrepancy)
+			}
+		}
+	}
+	return discrepancies, nil
+}
+
+// compareRenderer compares the rules installed by the renderer with the given
+// index for the pod against the intended ones.
+func (pc *PolicyConfigurator) compareRenderer(idx int, pod podmodel.ID) (discrepancy PodRuleDiscrepancy, found bool) {
+	rndr := pc.renderers[idx]
+	discrepancy.Pod = pod
+	if label := pc.rendererLabels[idx]; label != nil {
+		discrepancy.Renderer = *label
+	}
+	var intended PodRules
+	if hasRenderer(pc.assignments[pod], idx) {
+		discrepancy.Intended = true
+		rules := pc.rules[pod]
+		intended.Ingress = pc.rendererRules(rndr, rules.Ingress)
+		intended.Egress = pc.rendererRules(rndr, rules.Egress)
+	}
+	var installed PodRules
+	installed.Ingress, installed.Egress, discrepancy.Configured = rndr.(renderer.RuleReader).InstalledRules(pod)
+	discrepancy.Ingress = ruleSetDiff(installed.Ingress, intended.Ingress)
+	discrepancy.Egress = ruleSetDiff(installed.Egress, intended.Egress)
+	found = discrepancy.Intended != discrepancy.Configured ||
+		!discrepancy.Ingress.IsEmpty() || !discrepancy.Egress.IsEmpty()
+	return discrepancy, found
+}
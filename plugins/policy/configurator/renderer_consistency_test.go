@@ -0,0 +1,161 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// readbackRenderer reads back the rules installed into the mock renderer,
+// optionally losing the last egress rule.
+type readbackRenderer struct {
+	*MockRenderer
+	loseRule bool
+}
+
+func (rr *readbackRenderer) InstalledRules(pod podmodel.ID) (ingress, egress []*rendererAPI.ContivRule, configured bool) {
+	ingress, egress = rr.GetRules(pod)
+	configured = ingress != nil || egress != nil
+	if rr.loseRule && len(egress) > 0 {
+		egress = egress[:len(egress)-1]
+	}
+	return ingress, egress, configured
+}
+
+func TestCompareRenderers(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestCompareRenderers")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	primary := podmodel.Pod_Label{Key: "renderer", Value: "primary"}
+	backup := podmodel.Pod_Label{Key: "renderer", Value: "backup"}
+
+	// ingress allowed only on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP, &primary, &backup)
+	cache.AddPodConfig(pod2, pod2IP, &primary)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	primaryRenderer := &readbackRenderer{MockRenderer: NewMockRenderer("A", logger)}
+	backupRenderer := &readbackRenderer{MockRenderer: NewMockRenderer("B", logger)}
+	defaultRenderer := NewMockRenderer("C", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterLabeledRenderer(primary, primaryRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterLabeledRenderer(backup, backupRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterRenderer(defaultRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Renderers agree with the configurator.
+	discrepancies, err := configurator.CompareRenderers(primary, backup)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(discrepancies).To(gomega.BeEmpty())
+
+	// Backup renderer loses a rule.
+	backupRenderer.loseRule = true
+	_, egress := backupRenderer.GetRules(pod1)
+	gomega.Expect(egress).ToNot(gomega.BeEmpty())
+	lost := egress[len(egress)-1]
+	discrepancies, err = configurator.CompareRenderers(primary, backup)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(discrepancies).To(gomega.HaveLen(1))
+	gomega.Expect(discrepancies[0].Pod).To(gomega.Equal(pod1))
+	gomega.Expect(discrepancies[0].Renderer).To(gomega.Equal(backup))
+	gomega.Expect(discrepancies[0].Intended).To(gomega.BeTrue())
+	gomega.Expect(discrepancies[0].Configured).To(gomega.BeTrue())
+	gomega.Expect(discrepancies[0].Ingress.IsEmpty()).To(gomega.BeTrue())
+	gomega.Expect(discrepancies[0].Egress.Added).To(gomega.Equal([]*rendererAPI.ContivRule{lost}))
+	gomega.Expect(discrepancies[0].Egress.Removed).To(gomega.BeEmpty())
+
+	// Backup renderer installs stale rules for pod2, handled only by the primary renderer.
+	backupRenderer.loseRule = false
+	ingress, egress := primaryRenderer.GetRules(pod2)
+	pod2Net := parseIPNet(pod2IP + "/32")
+	rTxn := backupRenderer.NewTxn(false)
+	rTxn.Render(pod2, &pod2Net, ingress, egress, false)
+	err = rTxn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	discrepancies, err = configurator.CompareRenderers(primary, backup)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(discrepancies).To(gomega.HaveLen(1))
+	gomega.Expect(discrepancies[0].Pod).To(gomega.Equal(pod2))
+	gomega.Expect(discrepancies[0].Renderer).To(gomega.Equal(backup))
+	gomega.Expect(discrepancies[0].Intended).To(gomega.BeFalse())
+	gomega.Expect(discrepancies[0].Configured).To(gomega.BeTrue())
+	gomega.Expect(discrepancies[0].Egress.Removed).To(gomega.Equal(egress))
+	gomega.Expect(discrepancies[0].Egress.Added).To(gomega.BeEmpty())
+
+	// Comparing a renderer without the readback.
+	_, err = configurator.CompareRenderers(primary, podmodel.Pod_Label{})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+
+	// Comparing an unknown renderer.
+	_, err = configurator.CompareRenderers(primary, podmodel.Pod_Label{Key: "renderer", Value: "other"})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+}
@@ -0,0 +1,77 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// RequestResync re-renders all pods handled by the renderer(s) registered
+// with the given label (see RegisterLabeledRenderer) from the committed state.
+// Empty label selects the default renderers.
+// The call waits for an in-flight transaction to finish and the resync
+// then includes its changes.
+func (pc *PolicyConfigurator) RequestResync(label podmodel.Pod_Label) error {
+	pc.Lock()
+	defer pc.Unlock()
+	pc.waitForRetries()
+
+	var wasError error
+	resynced := false
+	for idx := range pc.renderers {
+		if !pc.hasRendererLabel(idx, label) {
+			continue
+		}
+		resynced = true
+		pc.Log.WithFields(logging.Fields{
+			"label":    label.Key + "=" + label.Value,
+			"renderer": idx,
+		}).Debug("Resync requested by renderer")
+
+		rTxn := pc.renderers[idx].NewTxn(true)
+		for pod, targets := range pc.assignments {
+			if !hasRenderer(targets, idx) {
+				continue
+			}
+			rules := pc.rules[pod]
+			var groups *PodRuleGroups
+			if podGroups, hasGroups := pc.groups[pod]; hasGroups {
+				groups = &podGroups
+			}
+			err := pc.render(rTxn, idx, pod, pc.podIPAddresses[pod], rules.Ingress, rules.Egress, groups, nil, false)
+			if err != nil {
+				pc.Log.WithFields(logging.Fields{
+					"pod": pc.logPod(pod),
+					"err": err,
+				}).Error("Renderer is not able to install rules for the pod")
+				wasError = err
+			}
+		}
+		if err := rTxn.Commit(); err != nil {
+			wasError = err
+		}
+	}
+	if !resynced {
+		return fmt.Errorf("no renderer registered for label %s=%s", label.Key, label.Value)
+	}
+	pc.setLastCommitStatus(wasError)
+	return wasError
+}
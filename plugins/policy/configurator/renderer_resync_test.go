@@ -0,0 +1,143 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestRendererRequestedResync(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRendererRequestedResync")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	dbLabel := podmodel.Pod_Label{Key: "app", Value: "db"}
+
+	// ingress denied completely
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP, &dbLabel)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	defaultRenderer := NewMockRenderer("default", logger)
+	dbRenderer := NewMockRenderer("db", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register default and labeled renderer.
+	err := configurator.RegisterRenderer(defaultRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterLabeledRenderer(dbLabel, dbRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Both renderers have their pods installed.
+	ip, _ := defaultRenderer.GetPodIP(pod1)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod1IP))
+	ip, _ = defaultRenderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+	ip, _ = dbRenderer.GetPodIP(pod1)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+	ip, _ = dbRenderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+
+	// Simulate restart of the labeled renderer.
+	err = dbRenderer.NewTxn(true).Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	ip, _ = dbRenderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+
+	// The renderer requests resync.
+	err = configurator.RequestResync(dbLabel)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	ip, _ = dbRenderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+	ip, _ = dbRenderer.GetPodIP(pod1)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+	action := dbRenderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Default renderer is not affected.
+	ip, _ = defaultRenderer.GetPodIP(pod1)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod1IP))
+
+	// Unknown label.
+	err = configurator.RequestResync(podmodel.Pod_Label{Key: "app", Value: "web"})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+
+	// Simulate restart of the default renderer.
+	err = defaultRenderer.NewTxn(true).Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	ip, _ = defaultRenderer.GetPodIP(pod1)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+
+	// Empty label selects the default renderer.
+	err = configurator.RequestResync(podmodel.Pod_Label{})
+	gomega.Expect(err).To(gomega.BeNil())
+	ip, _ = defaultRenderer.GetPodIP(pod1)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod1IP))
+	ip, _ = defaultRenderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+}
@@ -0,0 +1,170 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"net"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// RegisterLabeledRenderer registers a new renderer for pods with the given label.
+// Pods handled by at least one labeled renderer are not passed to the default
+// renderers. The label also identifies the renderer in RequestResync(),
+// UnregisterRenderer() and CompareRenderers().
+func (pc *PolicyConfigurator) RegisterLabeledRenderer(label podmodel.Pod_Label, renderer renderer.PolicyRendererAPI) error {
+	if label.Key == "" {
+		return fmt.Errorf("renderer label must not be empty")
+	}
+	pc.renderers = append(pc.renderers, renderer)
+	pc.rendererLabels = append(pc.rendererLabels, &label)
+	return nil
+}
+
+// assignRenderers returns indexes of renderers that should handle the given pod.
+func (pc *PolicyConfigurator) assignRenderers(podData *podmodel.Pod) []int {
+	targets := []int{}
+	for idx, rendererLabel := range pc.rendererLabels {
+		if rendererLabel == nil {
+			continue
+		}
+		for _, podLabel := range podData.Label {
+			if podLabel.Key == rendererLabel.Key && podLabel.Value == rendererLabel.Value {
+				targets = append(targets, idx)
+				break
+			}
+		}
+	}
+	if len(targets) > 0 {
+		return targets
+	}
+	// default renderers
+	pod := podmodel.ID{Name: podData.Name, Namespace: podData.Namespace}
+	for idx, rendererLabel := range pc.rendererLabels {
+		if rendererLabel == nil && pc.splitSelects(idx, pod) {
+			targets = append(targets, idx)
+		}
+	}
+	return targets
+}
+
+// hasRendererLabel returns true if the renderer with the given index was
+// registered with the given label (empty label for default renderers).
+func (pc *PolicyConfigurator) hasRendererLabel(idx int, label podmodel.Pod_Label) bool {
+	rendererLabel := pc.rendererLabels[idx]
+	if rendererLabel == nil {
+		return label.Key == "" && label.Value == ""
+	}
+	return rendererLabel.Key == label.Key && rendererLabel.Value == label.Value
+}
+
+// render passes rules of a pod into the transaction of the renderer with
+// the given index. Renderers supporting conntrack zones are given also
+// the zone of the pod (see WithConntrackZones).
+func (pc *PolicyConfigurator) render(rTxn renderer.Txn, idx int, pod podmodel.ID, podIP *net.IPNet,
+	ingress, egress ContivRules, groups *PodRuleGroups, previous *PodRules, removed bool) error {
+
+	err := pc.renderRules(rTxn, idx, pod, podIP, ingress, egress, groups, previous, removed)
+	if err == nil && !removed {
+		pc.renderConntrackZone(rTxn, idx, pod)
+	}
+	return err
+}
+
+// renderRules passes rules of a pod into the transaction of the renderer with
+// the given index. Renderers supporting rule groups are given the groups
+// instead, if they were generated (see WithRuleGroups). Renderers supporting
+// incremental updates are given only the changes against <previous> rules
+// (if not nil) when possible. Renderers supporting explicit priorities are
+// given the priorities of the rules (see WithExplicitRulePriorities).
+func (pc *PolicyConfigurator) renderRules(rTxn renderer.Txn, idx int, pod podmodel.ID, podIP *net.IPNet,
+	ingress, egress ContivRules, groups *PodRuleGroups, previous *PodRules, removed bool) error {
+
+	if rendered, err := pc.renderGroups(rTxn, idx, pod, podIP, groups, removed); rendered {
+		return err
+	}
+	pc.warnRuleFormat(idx, pod, ingress, egress)
+	ingress = pc.rendererRules(pc.renderers[idx], ingress)
+	egress = pc.rendererRules(pc.renderers[idx], egress)
+	err := checkCapabilities(pc.renderers[idx], ingress, egress)
+	if err == nil {
+		err = checkRuleFormat(pc.renderers[idx], ingress, egress)
+	}
+	if err != nil {
+		return err
+	}
+	if pc.renderCombined(rTxn, idx, pod, podIP, ingress, egress, removed) {
+		return nil
+	}
+	if !removed && !pc.prioritizedRenderer(idx) && pc.renderDelta(rTxn, idx, pod, podIP, ingress, egress, previous) {
+		return nil
+	}
+	if pc.sharedRules {
+		rTxn.Render(pod, podIP, ingress, egress, removed)
+	} else {
+		rTxn.Render(pod, podIP, ingress.Copy(), egress.Copy(), removed)
+	}
+	pc.renderRulePriorities(rTxn, idx, pod, ingress, egress, removed)
+	return nil
+}
+
+// rendererRules returns the rules without rate limits, connection rate limits,
+// packet lengths, source ports, TCP flags, tunnel VNIs and L7 matches, and
+// without the fragment rules, if the given renderer is not able to apply them
+// (and it is not required by WithStrictPolicing / WithStrictConnRateLimits /
+// WithStrictPacketLength / WithStrictSourcePorts / WithStrictTCPFlags /
+// WithStrictTunnelVNI / WithStrictL7 / WithStrictFragments), downgraded
+// to the rule format supported by the renderer (see WithStrictRuleFormat).
+func (pc *PolicyConfigurator) rendererRules(rndr renderer.PolicyRendererAPI, rules ContivRules) ContivRules {
+	if !pc.strictPolicing && !hasCapability(rndr, renderer.Policing) {
+		rules = withoutRateLimits(rules)
+	}
+	if !pc.strictConnRate && !hasCapability(rndr, renderer.ConnRateLimiting) {
+		rules = withoutConnRateLimits(rules)
+	}
+	if !pc.strictPacketLen && !hasCapability(rndr, renderer.PacketLength) {
+		rules = withoutPacketLens(rules)
+	}
+	if !pc.strictSourcePorts && !hasCapability(rndr, renderer.SourcePortMatch) {
+		rules = withoutSourcePorts(rules)
+	}
+	if !pc.strictTCPFlags && !hasCapability(rndr, renderer.TCPFlagMatching) {
+		rules = withoutTCPFlags(rules)
+	}
+	if !pc.strictTunnelVNI && !hasCapability(rndr, renderer.TunnelMatching) {
+		rules = withoutTunnelVNIs(rules)
+	}
+	if !pc.strictL7 && !hasCapability(rndr, renderer.L7Filtering) {
+		rules = withoutL7Matches(rules)
+	}
+	if !pc.strictFragments && !hasCapability(rndr, renderer.FragmentMatching) {
+		rules = withoutFragmentRules(rules)
+	}
+	return pc.downgradeRules(rndr, rules)
+}
+
+// hasRenderer returns true if the renderer index is in the list.
+func hasRenderer(targets []int, idx int) bool {
+	for _, target := range targets {
+		if target == idx {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// rendererSplit is a pair of default renderers sharing the pods
+// (see RegisterSplitRenderers).
+type rendererSplit struct {
+	oldIdx     int
+	newIdx     int
+	newPercent int
+}
+
+// RegisterSplitRenderers registers two default renderers which split the pods
+// between themselves, e.g. for a gradual migration between two backends:
+// <newPercent> % of the pods is handled by <newRenderer>, the rest stays with
+// <oldRenderer>. Other default renderers still receive all the pods.
+// The split is deterministic: a pod is assigned by the hash of its ID and
+// therefore always goes to the same renderer for a given ratio. Increasing
+// the ratio (in a new configurator) only moves pods from the old renderer
+// to the new one, never back.
+func (pc *PolicyConfigurator) RegisterSplitRenderers(oldRenderer, newRenderer renderer.PolicyRendererAPI,
+	newPercent int) error {
+	if newPercent < 0 || newPercent > 100 {
+		return fmt.Errorf("invalid percentage of pods for the new renderer: %d", newPercent)
+	}
+	split := rendererSplit{oldIdx: len(pc.renderers), newIdx: len(pc.renderers) + 1, newPercent: newPercent}
+	pc.renderers = append(pc.renderers, oldRenderer, newRenderer)
+	pc.rendererLabels = append(pc.rendererLabels, nil, nil)
+	pc.rendererSplits = append(pc.rendererSplits, split)
+	return nil
+}
+
+// splitSelects returns false if the default renderer with the given index
+// is split with another renderer which is the one handling the pod.
+func (pc *PolicyConfigurator) splitSelects(idx int, pod podmodel.ID) bool {
+	for _, split := range pc.rendererSplits {
+		if idx != split.oldIdx && idx != split.newIdx {
+			continue
+		}
+		toNew := podBucket(pod) < split.newPercent
+		return toNew == (idx == split.newIdx)
+	}
+	return true
+}
+
+// podBucket deterministically maps the pod ID into one of 100 buckets.
+func podBucket(pod podmodel.ID) int {
+	return int(podHash(pod) % 100)
+}
+
+// podHash returns FNV-1a hash of the pod ID.
+func podHash(pod podmodel.ID) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(pod.Namespace))
+	hash.Write([]byte{'/'})
+	hash.Write([]byte(pod.Name))
+	return hash.Sum32()
+}
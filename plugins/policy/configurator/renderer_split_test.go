@@ -0,0 +1,135 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestSplitRenderers(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSplitRenderers")
+
+	const (
+		namespace = "default"
+		numPods   = 400
+	)
+
+	// ingress allowed on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	cache := NewMockPolicyCache()
+	pods := []podmodel.ID{}
+	for i := 0; i < numPods; i++ {
+		pod := podmodel.ID{Name: fmt.Sprintf("pod%d", i), Namespace: namespace}
+		cache.AddPodConfig(pod, fmt.Sprintf("10.1.%d.%d", i/250, i%250+1))
+		pods = append(pods, pod)
+	}
+
+	// split returns pods handled by the new renderer for the given ratio.
+	split := func(newPercent int) map[podmodel.ID]struct{} {
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		oldRenderer := NewMockRenderer("old", logger)
+		newRenderer := NewMockRenderer("new", logger)
+		otherRenderer := NewMockRenderer("other", logger)
+
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false)
+		err := configurator.RegisterSplitRenderers(oldRenderer, newRenderer, newPercent)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(otherRenderer)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		txn := configurator.NewTxn(false)
+		for _, pod := range pods {
+			txn.Configure(pod, []*ContivPolicy{policy1})
+		}
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+
+		onNew := make(map[podmodel.ID]struct{})
+		for _, pod := range pods {
+			_, oldEgress := oldRenderer.GetRules(pod)
+			_, newEgress := newRenderer.GetRules(pod)
+			_, otherEgress := otherRenderer.GetRules(pod)
+			// every pod is handled by exactly one of the split renderers
+			gomega.Expect(len(oldEgress) == 0).ToNot(gomega.Equal(len(newEgress) == 0))
+			// the other default renderer handles all pods
+			gomega.Expect(otherEgress).ToNot(gomega.BeEmpty())
+			if len(newEgress) > 0 {
+				onNew[pod] = struct{}{}
+			}
+		}
+		return onNew
+	}
+
+	// Extreme ratios.
+	gomega.Expect(split(0)).To(gomega.BeEmpty())
+	gomega.Expect(split(100)).To(gomega.HaveLen(numPods))
+
+	// Distribution roughly follows the ratio.
+	split25 := split(25)
+	gomega.Expect(len(split25)).To(gomega.BeNumerically("~", numPods/4, numPods/10))
+
+	// Deterministic for the same ratio.
+	gomega.Expect(split(25)).To(gomega.Equal(split25))
+
+	// Increasing the ratio only moves pods to the new renderer.
+	split50 := split(50)
+	gomega.Expect(len(split50)).To(gomega.BeNumerically("~", numPods/2, numPods/10))
+	for pod := range split25 {
+		gomega.Expect(split50).To(gomega.HaveKey(pod))
+	}
+
+	// Invalid ratio.
+	configurator := &PolicyConfigurator{Deps: Deps{Log: logger, Cache: cache}}
+	configurator.Init(false)
+	err := configurator.RegisterSplitRenderers(NewMockRenderer("old", logger), NewMockRenderer("new", logger), 101)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+}
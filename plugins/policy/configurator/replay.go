@@ -0,0 +1,85 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// ReplayTo renders the committed configuration of all pods into the given
+// renderer, which is not registered with the configurator, e.g. to validate
+// a new renderer against the incumbent ones before switching the traffic over.
+// The renderer receives a single resync transaction with (copies of) the rules
+// each pod would be given as a registered default renderer, as flat lists
+// (rule groups, combined rules and incremental updates are not used).
+// Neither the committed configuration nor the registered renderers are
+// affected. Pods with rules the renderer is not able to apply are skipped
+// and reported by the returned error, together with a failed commit.
+func (pc *PolicyConfigurator) ReplayTo(rndr renderer.PolicyRendererAPI) error {
+	pc.Lock()
+	defer pc.Unlock()
+
+	txn := rndr.NewTxn(true)
+	var failed []string
+	for _, pod := range sortedPods(pc.config) {
+		rules, hasRules := pc.rules[pod]
+		if !hasRules {
+			continue
+		}
+		ingress := pc.rendererRules(rndr, rules.Ingress)
+		egress := pc.rendererRules(rndr, rules.Egress)
+		err := checkCapabilities(rndr, ingress, egress)
+		if err == nil {
+			err = checkRuleFormat(rndr, ingress, egress)
+		}
+		if err != nil {
+			pc.Log.WithFields(logging.Fields{
+				"pod": pc.logPod(pod),
+				"err": err,
+			}).Warn("Replayed renderer is not able to install rules for the pod")
+			failed = append(failed, fmt.Sprintf("%s (%v)", pod, err))
+			continue
+		}
+		txn.Render(pod, pc.podIPAddresses[pod], ingress.Copy(), egress.Copy(), false)
+		pc.replayConntrackZone(rndr, txn, pod)
+	}
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to replay pods: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// replayConntrackZone passes the conntrack zone of the pod into the replayed
+// renderer if it supports the zones.
+func (pc *PolicyConfigurator) replayConntrackZone(rndr renderer.PolicyRendererAPI, txn renderer.Txn, pod podmodel.ID) {
+	zone, assigned := pc.conntrackZones[pod]
+	if !assigned || !hasCapability(rndr, renderer.ConntrackZones) {
+		return
+	}
+	if zonedTxn, isZoned := txn.(renderer.ZonedTxn); isZoned {
+		zonedTxn.SetConntrackZone(pod, zone)
+	}
+}
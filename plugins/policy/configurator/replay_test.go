@@ -0,0 +1,167 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestReplayTo(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestReplayTo")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed from pod2 on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	// egress allowed to pod1, rate-limited
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type:      MatchEgress,
+				Pods:      []podmodel.ID{pod1},
+				RateLimit: &RateSpec{BitsPerSecond: 1000000, BurstBytes: 10000},
+			},
+		},
+	}
+
+	for _, strict := range []bool{false, true} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+		cache.AddPodConfig(pod3, pod3IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		incumbent := NewMockRenderer("A", logger)
+		incumbent.SetCapabilities(rendererAPI.Policing)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithStrictPolicing(strict))
+		err := configurator.RegisterRenderer(incumbent)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		txn.Configure(pod2, []*ContivPolicy{policy2})
+		txn.Configure(pod3, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Pod3 is removed.
+		cache.AddPodConfig(pod3, "") /* IP released */
+		txn = configurator.NewTxn(false)
+		txn.Configure(pod3, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+		commits := incumbent.GetCommitCount()
+
+		// Replay into a renderer with the same capabilities.
+		candidate := NewMockRenderer("B", logger)
+		candidate.SetCapabilities(rendererAPI.Policing)
+		err = configurator.ReplayTo(candidate)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(candidate.GetCommitCount()).To(gomega.Equal(1))
+		for _, pod := range []podmodel.ID{pod1, pod2} {
+			ingress, egress := incumbent.GetRules(pod)
+			candidateIngress, candidateEgress := candidate.GetRules(pod)
+			gomega.Expect(candidateIngress).To(gomega.Equal(ingress))
+			gomega.Expect(candidateEgress).To(gomega.Equal(egress))
+			ip, _ := incumbent.GetPodIP(pod)
+			candidateIP, _ := candidate.GetPodIP(pod)
+			gomega.Expect(candidateIP).To(gomega.Equal(ip))
+		}
+		ingress, egress := candidate.GetRules(pod3)
+		gomega.Expect(ingress).To(gomega.BeEmpty())
+		gomega.Expect(egress).To(gomega.BeEmpty())
+
+		// Replay into a renderer with less capabilities.
+		limited := NewMockRenderer("C", logger)
+		err = configurator.ReplayTo(limited)
+		gomega.Expect(limited.GetCommitCount()).To(gomega.Equal(1))
+		ingress, egress = limited.GetRules(pod1)
+		gomega.Expect(ingress).To(gomega.BeEmpty())
+		gomega.Expect(egress).ToNot(gomega.BeEmpty())
+		ingress, _ = limited.GetRules(pod2)
+		if strict {
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring(pod2.String()))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("POLICING"))
+			gomega.Expect(ingress).To(gomega.BeEmpty())
+		} else {
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(ingress).ToNot(gomega.BeEmpty())
+			for _, rule := range ingress {
+				gomega.Expect(rule.RateLimit).To(gomega.BeNil())
+			}
+		}
+
+		// The live configuration is not affected.
+		gomega.Expect(incumbent.GetCommitCount()).To(gomega.Equal(commits))
+		gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{pod1, pod2}))
+		ingress, _ = incumbent.GetRules(pod2)
+		gomega.Expect(ingress[0].RateLimit).ToNot(gomega.BeNil())
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ligato/cn-infra/logging"
+
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// BackoffStrategy returns the delay to wait before the given retry attempt
+// (counted from 1).
+type BackoffStrategy func(attempt int) time.Duration
+
+// ConstantBackoff waits the same amount of time before every retry.
+func ConstantBackoff(delay time.Duration) BackoffStrategy {
+	return func(attempt int) time.Duration {
+		return delay
+	}
+}
+
+// ExponentialBackoff doubles the delay with every retry, starting with <initial>
+// and never exceeding <max>.
+func ExponentialBackoff(initial, max time.Duration) BackoffStrategy {
+	return func(attempt int) time.Duration {
+		delay := initial
+		for i := 1; i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+		return delay
+	}
+}
+
+// WithRetry enables repeated commits of renderer transactions which failed
+// with a transient error, i.e. an error implementing renderer.TransientError.
+// Every renderer transaction is committed at most <maxAttempts> times,
+// waiting between attempts as given by the backoff strategy. Permanent errors
+// are returned immediately. By default, renderer transactions are committed
+// only once.
+// The time is measured by the clock of the configurator (see WithClock).
+// The configurator is unlocked while waiting between attempts, transactions
+// and other changes committed meanwhile wait for the retried commit to finish.
+func WithRetry(maxAttempts int, backoff BackoffStrategy) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.retryAttempts = maxAttempts
+		pc.retryBackoff = backoff
+	}
+}
+
+// commitRenderers commits the renderer transactions, in parallel if enabled,
+// retrying transient failures as configured by WithRetry.
+// Returns the error of the last failed commit.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) commitRenderers(rendererTxns []renderer.Txn) error {
+	errs := make([]error, len(rendererTxns))
+	pending := make([]int, len(rendererTxns))
+	for idx := range rendererTxns {
+		pending[idx] = idx
+	}
+	for attempt := 1; ; attempt++ {
+		pc.commitRendererTxns(rendererTxns, pending, errs)
+		retry := []int{}
+		for _, idx := range pending {
+			if errs[idx] != nil && attempt < pc.retryAttempts && renderer.IsTransient(errs[idx]) {
+				retry = append(retry, idx)
+			}
+		}
+		if len(retry) == 0 {
+			break
+		}
+		var delay time.Duration
+		if pc.retryBackoff != nil {
+			delay = pc.retryBackoff(attempt)
+		}
+		for _, idx := range retry {
+			pc.Log.WithFields(logging.Fields{
+				"attempt": attempt,
+				"delay":   delay,
+				"err":     errs[idx],
+			}).Warn("Transient renderer failure, retrying commit")
+		}
+		pc.backOff(delay)
+		pending = retry
+	}
+	var wasError error
+	for _, err := range errs {
+		if err != nil {
+			wasError = err
+		}
+	}
+	return wasError
+}
+
+// commitRendererTxns commits the renderer transactions with the given indexes
+// once, in parallel if enabled, and stores their errors under the same indexes.
+func (pc *PolicyConfigurator) commitRendererTxns(rendererTxns []renderer.Txn, indexes []int, errs []error) {
+	if !pc.parallelRendering {
+		for _, idx := range indexes {
+			errs[idx] = rendererTxns[idx].Commit()
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for _, idx := range indexes {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = rendererTxns[idx].Commit()
+		}(idx)
+	}
+	wg.Wait()
+}
+
+// backOff waits for the given delay with the configurator unlocked.
+// Meanwhile, commits wait in waitForRetries for the commit being retried
+// to finish.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) backOff(delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	expired := make(chan struct{}, 1)
+	pc.clock.AfterFunc(delay, func() { expired <- struct{}{} })
+	pc.backingOff = true
+	pc.Unlock()
+	<-expired
+	pc.Lock()
+	pc.backingOff = false
+	pc.retryDone.Broadcast()
+}
+
+// waitForRetries waits until no commit is waiting between retry attempts.
+// Once it returns, the configurator stays locked until the commit being
+// retried, if any, has finished.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) waitForRetries() {
+	for pc.backingOff {
+		pc.retryDone.Wait()
+	}
+}
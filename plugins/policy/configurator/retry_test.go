@@ -0,0 +1,233 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/contiv/vpp/plugins/policy/renderer/composite"
+)
+
+func TestRendererRetry(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRendererRetry")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// ingress allowed from pod2
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{pod2},
+			},
+		},
+	}
+
+	transientErr := rendererAPI.TransientErrorf("VPP is busy")
+	permanentErr := errors.New("invalid configuration")
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	var attempts []int
+	backoff := func(attempt int) time.Duration {
+		attempts = append(attempts, attempt)
+		return time.Millisecond
+	}
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithRetry(3, backoff))
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Renderer fails twice with a transient error, then succeeds.
+	renderer.SetCommitErrors(transientErr, transientErr)
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(attempts).To(gomega.Equal([]int{1, 2}))
+	action := renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Permanent error fails immediately.
+	attempts = nil
+	renderer.SetCommitErrors(permanentErr)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.Equal(permanentErr))
+	gomega.Expect(attempts).To(gomega.BeEmpty())
+
+	// Transient error persisting beyond the maximum number of attempts.
+	attempts = nil
+	renderer.SetCommitErrors(transientErr, transientErr, transientErr)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(rendererAPI.IsTransient(err)).To(gomega.BeTrue())
+	gomega.Expect(attempts).To(gomega.Equal([]int{1, 2}))
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	backoff := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	gomega.Expect(backoff(1)).To(gomega.Equal(10 * time.Millisecond))
+	gomega.Expect(backoff(2)).To(gomega.Equal(20 * time.Millisecond))
+	gomega.Expect(backoff(3)).To(gomega.Equal(40 * time.Millisecond))
+	gomega.Expect(backoff(4)).To(gomega.Equal(50 * time.Millisecond))
+	gomega.Expect(backoff(10)).To(gomega.Equal(50 * time.Millisecond))
+}
+
+func TestRetryBackoffUnlocked(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRetryBackoffUnlocked")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		delay     = time.Second
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	// ingress allowed from pod2
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{pod2},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer1 := NewMockRenderer("A", logger)
+	renderer2 := NewMockRenderer("B", logger)
+	clock := newFakeClock()
+
+	// Initialize configurator with both renderers behind a composite.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithClock(clock), WithRetry(2, ConstantBackoff(delay)))
+	err := configurator.RegisterRenderer(&composite.Renderer{
+		Renderers: []rendererAPI.PolicyRendererAPI{renderer1, renderer2},
+	})
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Both wrapped renderers fail with a transient error, the aggregated
+	// error is transient as well.
+	renderer1.SetCommitErrors(rendererAPI.TransientErrorf("A is busy"))
+	renderer2.SetCommitErrors(rendererAPI.TransientErrorf("B is busy"))
+	done := make(chan error, 1)
+	go func() {
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		done <- txn.Commit()
+	}()
+
+	// The configurator is not locked during the backoff.
+	gomega.Eventually(func() int { return pendingTimers(clock) }).Should(gomega.Equal(1))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.BeEmpty())
+	gomega.Expect(configurator.RuleProvenance(pod1)).To(gomega.BeNil())
+
+	// Another transaction waits for the retried one to finish.
+	done2 := make(chan error, 1)
+	go func() {
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod2, []*ContivPolicy{policy1})
+		done2 <- txn.Commit()
+	}()
+	gomega.Consistently(done2, 50*time.Millisecond).ShouldNot(gomega.Receive())
+	gomega.Expect(done).ToNot(gomega.Receive())
+
+	// The backoff is measured by the clock of the configurator.
+	clock.Advance(delay)
+	gomega.Eventually(done).Should(gomega.Receive(gomega.BeNil()))
+	gomega.Eventually(done2).Should(gomega.Receive(gomega.BeNil()))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{pod1, pod2}))
+	for _, renderer := range []*MockRenderer{renderer1, renderer2} {
+		action := renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	}
+}
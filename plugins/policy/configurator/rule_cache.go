@@ -0,0 +1,332 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ligato/cn-infra/logging"
+
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// ruleCacheVersion is the version of the rule cache file format.
+const ruleCacheVersion = 1
+
+// WithRuleCacheFile enables the rule cache persisted into the given file.
+// Rules generated for a set of policies are cached under a digest of all
+// the inputs of the generation: the normalized policies, IP addresses
+// of the peer pods, the cluster DNS, API server endpoints, cluster pod
+// CIDRs, resolved FQDNs, referenced port-sets and the options affecting
+// the rules. Entries with stale inputs are therefore never used.
+// The cache is loaded from the file by Init() (a missing or invalid file
+// results in an empty cache) and saved by Close() or SaveRuleCache(),
+// with only the entries used since the start. The cache is not used
+// for traced pods and with the rule provenance tracking enabled.
+func WithRuleCacheFile(path string) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.ruleCacheFile = path
+	}
+}
+
+// RuleCacheStats are the statistics of the rule cache.
+type RuleCacheStats struct {
+	// Entries is the number of cached sets of rules.
+	Entries int
+
+	// Hits and Misses count the sets of policies with rules taken from
+	// the cache and generated, respectively, since the start.
+	Hits   int
+	Misses int
+}
+
+// ruleCacheEntry are the rules cached for one digest of the inputs.
+type ruleCacheEntry struct {
+	ingress ContivRules
+	egress  ContivRules
+	used    bool // since the start
+}
+
+// ruleCacheFile is the content of the rule cache file.
+type ruleCacheFile struct {
+	Version int
+	Entries []cachedRules
+}
+
+// cachedRules are the rules of one entry as serialized in the cache file.
+type cachedRules struct {
+	Digest  string
+	Ingress []cachedRule
+	Egress  []cachedRule
+}
+
+// cachedRule is a rule as serialized in the cache file. Networks are
+// serialized separately to preserve their exact form.
+type cachedRule struct {
+	Rule        *renderer.ContivRule
+	SrcNetwork  *cachedNetwork
+	DestNetwork *cachedNetwork
+}
+
+// cachedNetwork is a network as serialized in the cache file.
+type cachedNetwork struct {
+	IP   []byte
+	Mask []byte
+}
+
+// ruleCacheInputs are all the inputs of the rule generation for a set
+// of policies, digested into the cache key.
+type ruleCacheInputs struct {
+	Policies        []*ContivPolicy
+	Peers           []string
+	NatLoopbackIP   net.IP
+	ClusterDNSIP    []net.IP
+	APIServer       []APIServerEndpoint
+	ClusterPodCIDRs []net.IPNet
+	FQDNs           map[string][]net.IP
+	PortSets        map[string][]Port
+	Protocols       []Port
+	RuleOrdering    RuleOrdering
+	Precedence      ActionPrecedence
+	AggregatePodIPs bool
+	MappedAddresses MappedAddressHandling
+}
+
+// RuleCacheStats returns the statistics of the rule cache.
+func (pc *PolicyConfigurator) RuleCacheStats() RuleCacheStats {
+	pc.Lock()
+	defer pc.Unlock()
+	stats := pc.ruleCacheStats
+	stats.Entries = len(pc.ruleCache)
+	return stats
+}
+
+// SaveRuleCache saves the rule cache into the file given to WithRuleCacheFile.
+// Only entries used since the start are saved.
+func (pc *PolicyConfigurator) SaveRuleCache() error {
+	pc.Lock()
+	defer pc.Unlock()
+	return pc.saveRuleCache()
+}
+
+// loadRuleCache loads the rule cache from the file.
+func (pc *PolicyConfigurator) loadRuleCache() {
+	pc.ruleCache = make(map[string]*ruleCacheEntry)
+	content, err := ioutil.ReadFile(pc.ruleCacheFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			pc.Log.WithField("err", err).Warn("Failed to read the rule cache, starting empty")
+		}
+		return
+	}
+	file := ruleCacheFile{}
+	if err := json.Unmarshal(content, &file); err != nil || file.Version != ruleCacheVersion {
+		pc.Log.WithFields(logging.Fields{
+			"err":     err,
+			"version": file.Version,
+		}).Warn("Invalid rule cache, starting empty")
+		return
+	}
+	for _, entry := range file.Entries {
+		ingress, ingressValid := decodeCachedRules(entry.Ingress)
+		egress, egressValid := decodeCachedRules(entry.Egress)
+		if !ingressValid || !egressValid {
+			pc.Log.WithField("digest", entry.Digest).Warn("Discarding invalid rule cache entry")
+			continue
+		}
+		pc.ruleCache[entry.Digest] = &ruleCacheEntry{ingress: ingress, egress: egress}
+	}
+	pc.Log.WithField("entries", len(pc.ruleCache)).Info("Loaded rule cache")
+}
+
+// saveRuleCache writes the used entries of the rule cache into the file.
+// The file is replaced atomically.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) saveRuleCache() error {
+	if pc.ruleCache == nil {
+		return nil
+	}
+	file := ruleCacheFile{Version: ruleCacheVersion}
+	for digest, entry := range pc.ruleCache {
+		if !entry.used {
+			continue
+		}
+		file.Entries = append(file.Entries, cachedRules{
+			Digest:  digest,
+			Ingress: encodeCachedRules(entry.ingress),
+			Egress:  encodeCachedRules(entry.egress),
+		})
+	}
+	sort.Slice(file.Entries, func(i, j int) bool {
+		return file.Entries[i].Digest < file.Entries[j].Digest
+	})
+	content, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode rule cache: %v", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(pc.ruleCacheFile), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), pc.ruleCacheFile)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	pc.Log.WithField("entries", len(file.Entries)).Debug("Saved rule cache")
+	return nil
+}
+
+// cachedRules returns the rules for the (effective) policies, taken from
+// the rule cache or generated and cached.
+func (pct *PolicyConfiguratorTxn) cachedRules(policies ContivPolicies) (ingress, egress ContivRules) {
+	pc := pct.configurator
+	if pc.ruleCache == nil || pct.tracedPod != nil || pct.origins != nil {
+		return pct.generateDirectionRules(policies)
+	}
+	digest, err := pct.ruleCacheDigest(policies)
+	if err != nil {
+		pct.Log.WithField("err", err).Warn("Failed to compute rule cache digest")
+		return pct.generateDirectionRules(policies)
+	}
+	if entry, cached := pc.ruleCache[digest]; cached {
+		pc.ruleCacheStats.Hits++
+		entry.used = true
+		return entry.ingress, entry.egress
+	}
+	pc.ruleCacheStats.Misses++
+	ingress, egress = pct.generateDirectionRules(policies)
+	pc.ruleCache[digest] = &ruleCacheEntry{ingress: ingress, egress: egress, used: true}
+	return ingress, egress
+}
+
+// generateDirectionRules generates the ingress and egress rules (from the vswitch
+// point of view) for the policies.
+func (pct *PolicyConfiguratorTxn) generateDirectionRules(policies ContivPolicies) (ingress, egress ContivRules) {
+	// Direction in policies is from the pod point of view, whereas rules
+	// are evaluated from the vswitch perspective.
+	egress = pct.generateRules(MatchIngress, policies)
+	ingress = pct.generateRules(MatchEgress, policies)
+	return ingress, egress
+}
+
+// ruleCacheDigest returns the digest of all the inputs of the rule generation
+// for the policies.
+func (pct *PolicyConfiguratorTxn) ruleCacheDigest(policies ContivPolicies) (string, error) {
+	pc := pct.configurator
+	inputs := ruleCacheInputs{
+		NatLoopbackIP:   pc.Contiv.GetNatLoopbackIP(),
+		ClusterDNSIP:    pct.clusterDNSIP,
+		APIServer:       pc.apiServerEndpoints,
+		ClusterPodCIDRs: pc.clusterPodCIDRs,
+		FQDNs:           make(map[string][]net.IP),
+		PortSets:        make(map[string][]Port),
+		Protocols:       pc.allowedProtocolPorts(),
+		RuleOrdering:    pc.ruleOrdering,
+		Precedence:      pc.actionPrecedence,
+		AggregatePodIPs: pc.aggregatePodIPs,
+		MappedAddresses: pc.mappedAddresses,
+	}
+	peers := make(map[string]struct{})
+	for _, policy := range policies {
+		inputs.Policies = append(inputs.Policies, policy.Normalize())
+		for _, match := range policy.Matches {
+			for _, peer := range pct.peerPods(match) {
+				_, peerData := pc.Cache.LookupPod(peer)
+				peers[peer.String()+"="+peerData.GetIpAddress()] = struct{}{}
+			}
+			for _, fqdn := range match.FQDNs {
+				inputs.FQDNs[fqdn] = pc.resolveFQDN(fqdn)
+			}
+			for _, name := range match.PortSets {
+				inputs.PortSets[name] = pc.portSets[name]
+			}
+		}
+	}
+	for peer := range peers {
+		inputs.Peers = append(inputs.Peers, peer)
+	}
+	sort.Strings(inputs.Peers)
+	encoded, err := json.Marshal(inputs)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(encoded)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// encodeCachedRules converts rules into the form serialized in the cache file.
+func encodeCachedRules(rules ContivRules) []cachedRule {
+	encoded := []cachedRule{}
+	for _, rule := range rules {
+		ruleCopy := *rule
+		ruleCopy.SrcNetwork = nil
+		ruleCopy.DestNetwork = nil
+		encoded = append(encoded, cachedRule{
+			Rule:        &ruleCopy,
+			SrcNetwork:  encodeCachedNetwork(rule.SrcNetwork),
+			DestNetwork: encodeCachedNetwork(rule.DestNetwork),
+		})
+	}
+	return encoded
+}
+
+// decodeCachedRules converts rules from the form serialized in the cache file.
+// Returns false if any of the rules is invalid.
+func decodeCachedRules(encoded []cachedRule) (ContivRules, bool) {
+	rules := ContivRules{}
+	for _, cached := range encoded {
+		if cached.Rule == nil {
+			return nil, false
+		}
+		rule := cached.Rule
+		rule.SrcNetwork = decodeCachedNetwork(cached.SrcNetwork)
+		rule.DestNetwork = decodeCachedNetwork(cached.DestNetwork)
+		rules = append(rules, rule)
+	}
+	return rules, true
+}
+
+// encodeCachedNetwork converts network into the form serialized in the cache file.
+func encodeCachedNetwork(network *net.IPNet) *cachedNetwork {
+	if network == nil {
+		return nil
+	}
+	return &cachedNetwork{IP: network.IP, Mask: network.Mask}
+}
+
+// decodeCachedNetwork converts network from the form serialized in the cache file.
+func decodeCachedNetwork(network *cachedNetwork) *net.IPNet {
+	if network == nil {
+		return nil
+	}
+	return &net.IPNet{IP: network.IP, Mask: network.Mask}
+}
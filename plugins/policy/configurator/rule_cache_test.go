@@ -0,0 +1,188 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestRuleCache(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRuleCache")
+
+	dir, err := ioutil.TempDir("", "rule-cache")
+	gomega.Expect(err).To(gomega.BeNil())
+	defer os.RemoveAll(dir)
+	cacheFile := filepath.Join(dir, "rules.json")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+		pod4IP    = "192.168.1.4"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	pod3 := podmodel.ID{Name: "pod3", Namespace: namespace}
+	pod4 := podmodel.ID{Name: "pod4", Namespace: namespace}
+	pods := []podmodel.ID{pod1, pod2, pod3, pod4}
+
+	// ingress allowed from pod3 on TCP:80 (rate-limited) and from 10.0.0.0/8
+	// except 10.1.0.0/16, egress allowed to pod4 for HTTP GETs
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyAll,
+		Matches: []Match{
+			{
+				Type:      MatchIngress,
+				Pods:      []podmodel.ID{pod3},
+				Ports:     []Port{{Protocol: TCP, Number: 80}},
+				RateLimit: &RateSpec{BitsPerSecond: 1000000, BurstBytes: 1000},
+			},
+			{
+				Type: MatchIngress,
+				IPBlocks: []IPBlock{{
+					Network: parseIPNet("10.0.0.0/8"),
+					Except:  []net.IPNet{parseIPNet("10.1.0.0/16")},
+				}},
+			},
+			{
+				Type: MatchEgress,
+				Pods: []podmodel.ID{pod4},
+				L7:   &L7Match{Method: "GET"},
+			},
+		},
+	}
+	// egress allowed to pod1 on UDP:53
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type:  MatchEgress,
+				Pods:  []podmodel.ID{pod1},
+				Ports: []Port{{Protocol: UDP, Number: 53}},
+			},
+		},
+	}
+	config := map[podmodel.ID][]*ContivPolicy{
+		pod1: {policy1},
+		pod2: {policy2},
+		pod3: {policy1, policy2},
+	}
+
+	// Restart runs the configurator with the given pod IPs until Close().
+	restart := func(podIPs map[podmodel.ID]string, options ...Option) (*PolicyConfigurator, *MockRenderer) {
+		cache := NewMockPolicyCache()
+		for pod, ip := range podIPs {
+			cache.AddPodConfig(pod, ip)
+		}
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+		renderer := NewMockRenderer("A", logger)
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, options...)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		txn := configurator.NewTxn(true)
+		for pod, policies := range config {
+			txn.Configure(pod, policies)
+		}
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator, renderer
+	}
+	expectSameRules := func(renderer, reference *MockRenderer) {
+		for _, pod := range pods {
+			ingress, egress := renderer.GetRules(pod)
+			refIngress, refEgress := reference.GetRules(pod)
+			gomega.Expect(ingress).To(gomega.Equal(refIngress))
+			gomega.Expect(egress).To(gomega.Equal(refEgress))
+		}
+	}
+	podIPs := map[podmodel.ID]string{pod1: pod1IP, pod2: pod2IP, pod3: pod3IP, pod4: pod4IP}
+	_, reference := restart(podIPs)
+
+	// The first run starts with an empty cache.
+	configurator, renderer := restart(podIPs, WithRuleCacheFile(cacheFile))
+	gomega.Expect(configurator.RuleCacheStats()).To(gomega.Equal(RuleCacheStats{Entries: 3, Hits: 0, Misses: 3}))
+	expectSameRules(renderer, reference)
+	err = configurator.Close()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// After restart, the rules are taken from the cache.
+	configurator, renderer = restart(podIPs, WithRuleCacheFile(cacheFile))
+	gomega.Expect(configurator.RuleCacheStats()).To(gomega.Equal(RuleCacheStats{Entries: 3, Hits: 3, Misses: 0}))
+	expectSameRules(renderer, reference)
+	err = configurator.Close()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Entries with stale inputs are not used: pod4 (peer of policy1) has another IP.
+	podIPs[pod4] = "192.168.1.44"
+	_, reference = restart(podIPs)
+	configurator, renderer = restart(podIPs, WithRuleCacheFile(cacheFile))
+	gomega.Expect(configurator.RuleCacheStats()).To(gomega.Equal(RuleCacheStats{Entries: 5, Hits: 1, Misses: 2}))
+	expectSameRules(renderer, reference)
+	err = configurator.Close()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Stale entries are discarded when saved.
+	configurator, renderer = restart(podIPs, WithRuleCacheFile(cacheFile))
+	gomega.Expect(configurator.RuleCacheStats()).To(gomega.Equal(RuleCacheStats{Entries: 3, Hits: 3, Misses: 0}))
+	expectSameRules(renderer, reference)
+
+	// Invalid cache file results in an empty cache.
+	err = ioutil.WriteFile(cacheFile, []byte("{invalid"), 0644)
+	gomega.Expect(err).To(gomega.BeNil())
+	configurator, renderer = restart(podIPs, WithRuleCacheFile(cacheFile))
+	gomega.Expect(configurator.RuleCacheStats()).To(gomega.Equal(RuleCacheStats{Entries: 3, Hits: 0, Misses: 3}))
+	expectSameRules(renderer, reference)
+	err = configurator.SaveRuleCache()
+	gomega.Expect(err).To(gomega.BeNil())
+	configurator, _ = restart(podIPs, WithRuleCacheFile(cacheFile))
+	gomega.Expect(configurator.RuleCacheStats().Hits).To(gomega.Equal(3))
+
+	// Entries generated with another action precedence are not used.
+	configurator, _ = restart(podIPs, WithRuleCacheFile(cacheFile), WithActionPrecedence(PriorityOrder))
+	gomega.Expect(configurator.RuleCacheStats()).To(gomega.Equal(RuleCacheStats{Entries: 6, Hits: 0, Misses: 3}))
+}
@@ -0,0 +1,191 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"sync"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// DefaultRuleChangeBuffer is the default number of events buffered for each
+// subscriber of rule changes (see WithRuleChangeBuffer).
+const DefaultRuleChangeBuffer = 256
+
+// RuleChangeEvent reports the change of the committed rules of a single pod.
+type RuleChangeEvent struct {
+	// Pod is the ID of the pod with changed rules.
+	Pod podmodel.ID
+
+	// Ingress and Egress describe the changes of the rules from the vswitch
+	// point of view (i.e. as passed to renderers). The rules are copies
+	// owned by the subscriber.
+	Ingress renderer.RuleDelta
+	Egress  renderer.RuleDelta
+
+	// Removed is true if the pod was removed from the configuration
+	// (all its rules are reported as removed).
+	Removed bool
+
+	// CorrelationIDs lists IDs attached to the committed transaction
+	// (see AuditRecord.CorrelationIDs).
+	CorrelationIDs []string
+}
+
+// ruleChangeSubscriber is a single subscription created by Subscribe.
+type ruleChangeSubscriber struct {
+	events chan RuleChangeEvent
+}
+
+// WithRuleChangeBuffer sets the number of rule-change events buffered for each
+// subscriber (DefaultRuleChangeBuffer by default).
+func WithRuleChangeBuffer(size int) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.ruleChangeBuffer = size
+	}
+}
+
+// Subscribe returns a channel receiving an event for every pod whose rules
+// changed with a commit, including commits where a renderer failed (the rules
+// are committed nonetheless, see LastCommitStatus). Events of one commit are
+// sent together after the commit, sorted by pod.
+// Commits never wait for subscribers: if the buffer of the subscriber
+// (see WithRuleChangeBuffer) is full, the oldest event is dropped to make
+// space for the new one. The returned function cancels the subscription
+// and closes the channel (so does Close()); it must not be called from
+// an audit or metrics sink.
+func (pc *PolicyConfigurator) Subscribe() (<-chan RuleChangeEvent, func()) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	size := pc.ruleChangeBuffer
+	if size <= 0 {
+		size = DefaultRuleChangeBuffer
+	}
+	subscriber := &ruleChangeSubscriber{events: make(chan RuleChangeEvent, size)}
+	pc.ruleChangeSubscribers = append(pc.ruleChangeSubscribers, subscriber)
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			pc.Lock()
+			defer pc.Unlock()
+			pc.removeRuleChangeSubscriber(subscriber)
+		})
+	}
+	return subscriber.events, unsubscribe
+}
+
+// removeRuleChangeSubscriber cancels the subscription and closes its channel,
+// unless it was already closed by Close().
+func (pc *PolicyConfigurator) removeRuleChangeSubscriber(subscriber *ruleChangeSubscriber) {
+	for idx, other := range pc.ruleChangeSubscribers {
+		if other == subscriber {
+			pc.ruleChangeSubscribers = append(pc.ruleChangeSubscribers[:idx], pc.ruleChangeSubscribers[idx+1:]...)
+			close(subscriber.events)
+			return
+		}
+	}
+}
+
+// closeRuleChangeSubscribers cancels all subscriptions.
+func (pc *PolicyConfigurator) closeRuleChangeSubscribers() {
+	for _, subscriber := range pc.ruleChangeSubscribers {
+		close(subscriber.events)
+	}
+	pc.ruleChangeSubscribers = nil
+}
+
+// buildRuleChangeEvents builds events for pods with changed rules. It is
+// expected to be called before the changes are saved to the configurator.
+func (pct *PolicyConfiguratorTxn) buildRuleChangeEvents() []RuleChangeEvent {
+	pc := pct.configurator
+	var pods []podmodel.ID
+	for pod := range pct.config {
+		pods = append(pods, pod)
+	}
+	if pct.resync {
+		for pod := range pc.rules {
+			if _, configured := pct.config[pod]; !configured {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	sortPodIDs(pods)
+
+	var events []RuleChangeEvent
+	for _, pod := range pods {
+		oldRules, hadRules := pc.rules[pod]
+		newRules, hasRules := pct.rules[pod]
+		if !hadRules && !hasRules {
+			continue
+		}
+		event := RuleChangeEvent{
+			Pod:            pod,
+			Ingress:        copyRuleDelta(ruleSetDiff(oldRules.Ingress, newRules.Ingress)),
+			Egress:         copyRuleDelta(ruleSetDiff(oldRules.Egress, newRules.Egress)),
+			Removed:        !hasRules,
+			CorrelationIDs: copyStrings(pct.correlationIDs),
+		}
+		if event.Ingress.IsEmpty() && event.Egress.IsEmpty() && !event.Removed {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// copyRuleDelta returns a deep copy of the delta.
+func copyRuleDelta(delta renderer.RuleDelta) renderer.RuleDelta {
+	deltaCopy := renderer.RuleDelta{}
+	if delta.Added != nil {
+		deltaCopy.Added = ContivRules(delta.Added).Copy()
+	}
+	if delta.Removed != nil {
+		deltaCopy.Removed = ContivRules(delta.Removed).Copy()
+	}
+	return deltaCopy
+}
+
+// publishRuleChanges sends the events to all subscribers, dropping the oldest
+// buffered events of subscribers falling behind.
+func (pc *PolicyConfigurator) publishRuleChanges(events []RuleChangeEvent) {
+	for _, subscriber := range pc.ruleChangeSubscribers {
+		dropped := 0
+		for _, event := range events {
+			for sent := false; !sent; {
+				select {
+				case subscriber.events <- event:
+					sent = true
+				default:
+					select {
+					case <-subscriber.events:
+						dropped++
+					default:
+					}
+				}
+			}
+		}
+		if dropped > 0 {
+			pc.Log.WithFields(logging.Fields{
+				"dropped": dropped,
+			}).Warn("Rule-change subscriber falls behind, oldest events were dropped")
+		}
+	}
+}
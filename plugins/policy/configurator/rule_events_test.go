@@ -0,0 +1,181 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestRuleChangeEvents(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRuleChangeEvents")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress denied completely
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+	}
+	// ingress allowed from pod2 only
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{pod2},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithRuleChangeBuffer(2))
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Subscriber reading the events and a subscriber falling behind.
+	events, unsubscribe := configurator.Subscribe()
+	slowEvents, slowUnsubscribe := configurator.Subscribe()
+	receive := func(count int) []RuleChangeEvent {
+		var received []RuleChangeEvent
+		for i := 0; i < count; i++ {
+			received = append(received, <-events)
+		}
+		gomega.Expect(events).To(gomega.BeEmpty())
+		return received
+	}
+
+	// New pods: all their rules are added.
+	txn := configurator.NewTxn(false).WithCorrelationID("add-pods")
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	received := receive(2)
+	for idx, pod := range []podmodel.ID{pod1, pod2} {
+		ingress, egress := renderer.GetRules(pod)
+		event := received[idx]
+		gomega.Expect(event.Pod).To(gomega.Equal(pod))
+		gomega.Expect(event.Removed).To(gomega.BeFalse())
+		gomega.Expect(event.CorrelationIDs).To(gomega.Equal([]string{"add-pods"}))
+		gomega.Expect(event.Ingress.Added).To(gomega.HaveLen(len(ingress)))
+		gomega.Expect(event.Ingress.Removed).To(gomega.BeEmpty())
+		gomega.Expect(event.Egress.Added).To(gomega.Equal(egress))
+		gomega.Expect(event.Egress.Removed).To(gomega.BeEmpty())
+		for i := range egress {
+			gomega.Expect(event.Egress.Added[i]).ToNot(gomega.BeIdenticalTo(egress[i]))
+		}
+	}
+
+	// Changed rules of pod1: only the difference is reported.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	received = receive(1)
+	event := received[0]
+	gomega.Expect(event.Pod).To(gomega.Equal(pod1))
+	gomega.Expect(event.Ingress.IsEmpty()).To(gomega.BeTrue())
+	gomega.Expect(event.Egress.Removed).To(gomega.BeEmpty())
+	gomega.Expect(event.Egress.Added).To(gomega.HaveLen(1))
+	gomega.Expect(event.Egress.Added[0].Action).To(gomega.Equal(rendererAPI.ActionPermit))
+	gomega.Expect(event.Egress.Added[0].SrcNetwork.String()).To(gomega.Equal(pod2IP + "/32"))
+
+	// Unchanged commit produces no events.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	receive(0)
+
+	// Removed pod: all its rules are removed.
+	_, pod2Egress := renderer.GetRules(pod2)
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	received = receive(1)
+	event = received[0]
+	gomega.Expect(event.Pod).To(gomega.Equal(pod2))
+	gomega.Expect(event.Removed).To(gomega.BeTrue())
+	gomega.Expect(event.Egress.Added).To(gomega.BeEmpty())
+	gomega.Expect(event.Egress.Removed).To(gomega.Equal(pod2Egress))
+
+	// Subscriber falling behind is left with the latest events.
+	gomega.Expect(slowEvents).To(gomega.HaveLen(2))
+	gomega.Expect((<-slowEvents).Pod).To(gomega.Equal(pod1))
+	gomega.Expect((<-slowEvents).Removed).To(gomega.BeTrue())
+
+	// Unsubscribing stops the delivery.
+	unsubscribe()
+	unsubscribe()
+	_, open := <-events
+	gomega.Expect(open).To(gomega.BeFalse())
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect((<-slowEvents).Pod).To(gomega.Equal(pod2))
+
+	// Close ends the remaining subscriptions.
+	err = configurator.Close()
+	gomega.Expect(err).To(gomega.BeNil())
+	_, open = <-slowEvents
+	gomega.Expect(open).To(gomega.BeFalse())
+	slowUnsubscribe()
+}
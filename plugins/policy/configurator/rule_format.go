@@ -0,0 +1,124 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithStrictRuleFormat selects how rules are handled for renderers supporting
+// only an older version of the rule format (see renderer.RuleFormatAdvertiser).
+// By default, the fields the renderer does not understand are removed from
+// the rules passed to it (with a warning), i.e. the traffic is matched
+// regardless of them, and the rules matching only IP fragments are not passed
+// at all. Rules scoped to a pod network cannot be downgraded and always fail
+// the commit. With the strict rule format, the commit fails instead.
+func WithStrictRuleFormat(strict bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.strictRuleFormat = strict
+	}
+}
+
+// rendererRuleFormat returns the version of the rule format supported
+// by the renderer. Renderers not advertising the format support RuleFormatV1.
+func rendererRuleFormat(rndr renderer.PolicyRendererAPI) renderer.RuleFormat {
+	advertiser, isAdvertiser := rndr.(renderer.RuleFormatAdvertiser)
+	if !isAdvertiser {
+		return renderer.RuleFormatV1
+	}
+	return advertiser.SupportedRuleFormat()
+}
+
+// downgradeRules returns the rules in the format supported by the renderer,
+// unless the strict rule format is enabled. Rules which become duplicates
+// are skipped. If all the rules are supported, the same list is returned.
+func (pc *PolicyConfigurator) downgradeRules(rndr renderer.PolicyRendererAPI, rules ContivRules) ContivRules {
+	format := rendererRuleFormat(rndr)
+	if pc.strictRuleFormat || !hasNewerRuleFormat(rules, format) {
+		return rules
+	}
+	if format < renderer.RuleFormatV2 {
+		rules = withoutFragmentRules(rules)
+	}
+	return withoutRuleFeature(rules,
+		func(rule *renderer.ContivRule) bool { return rule.RuleFormat() > format },
+		func(rule *renderer.ContivRule) { downgradeRule(rule, format) })
+}
+
+// downgradeRule removes the fields newer than the given format from the rule,
+// except for the network scope.
+func downgradeRule(rule *renderer.ContivRule, format renderer.RuleFormat) {
+	if format < renderer.RuleFormatV2 {
+		rule.RateLimit = nil
+		rule.ConnRateLimit = nil
+		rule.PacketLen = nil
+		rule.L7 = nil
+		rule.TCPFlags = nil
+		rule.TunnelVNI = nil
+		rule.Description = ""
+	}
+}
+
+// warnRuleFormat logs a warning if the rules of the pod are to be downgraded
+// for the renderer with the given index.
+func (pc *PolicyConfigurator) warnRuleFormat(idx int, pod podmodel.ID, ruleLists ...ContivRules) {
+	if pc.strictRuleFormat {
+		return
+	}
+	format := rendererRuleFormat(pc.renderers[idx])
+	for _, rules := range ruleLists {
+		if hasNewerRuleFormat(rules, format) {
+			pc.Log.WithFields(logging.Fields{
+				"pod":      pc.logPod(pod),
+				"renderer": idx,
+				"format":   format,
+			}).Warn("Downgrading rules for the rule format supported by the renderer")
+			return
+		}
+	}
+}
+
+// checkRuleFormat returns an error if any of the given rules is not expressible
+// in the rule format supported by the renderer.
+func checkRuleFormat(rndr renderer.PolicyRendererAPI, ruleLists ...ContivRules) error {
+	format := rendererRuleFormat(rndr)
+	for _, rules := range ruleLists {
+		for _, rule := range rules {
+			if required := rule.RuleFormat(); required > format {
+				return fmt.Errorf("renderer supports rule format %s, %s requires %s",
+					format, rule, required)
+			}
+		}
+	}
+	return nil
+}
+
+// hasNewerRuleFormat returns true if any of the rules requires a newer rule
+// format than the given one.
+func hasNewerRuleFormat(rules ContivRules, format renderer.RuleFormat) bool {
+	for _, rule := range rules {
+		if rule.RuleFormat() > format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	lg "github.com/sirupsen/logrus"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// warningHook collects warnings.
+type warningHook struct {
+	warnings []*lg.Entry
+}
+
+func (wh *warningHook) Levels() []lg.Level {
+	return []lg.Level{lg.WarnLevel}
+}
+
+func (wh *warningHook) Fire(entry *lg.Entry) error {
+	wh.warnings = append(wh.warnings, entry)
+	return nil
+}
+
+func TestRuleFormat(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.NewLogger("rule-format-test")
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRuleFormat")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress allowed from pod2 to TCP:80 for established connections,
+	// rate-limited
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:        MatchIngress,
+				Pods:        []podmodel.ID{pod2},
+				Ports:       []Port{{Protocol: TCP, Number: 80}},
+				TCPFlags:    &TCPFlagMatch{Required: TCPFlagACK},
+				RateLimit:   &RateSpec{BitsPerSecond: 1000000, BurstBytes: 10000},
+				Description: "web",
+			},
+		},
+	}
+
+	for _, strict := range []bool{false, true} {
+		hook := &warningHook{}
+		logger.AddHook(hook)
+
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		// Both renderers are capable, only renderer2 understands the current format.
+		renderer1 := NewMockRenderer("A", logger)
+		renderer1.SetCapabilities(rendererAPI.TCPFlagMatching, rendererAPI.Policing)
+		renderer1.SetRuleFormat(rendererAPI.RuleFormatV1)
+		renderer2 := NewMockRenderer("B", logger)
+		renderer2.SetCapabilities(rendererAPI.TCPFlagMatching, rendererAPI.Policing)
+		gomega.Expect(renderer2.SupportedRuleFormat()).To(gomega.Equal(rendererAPI.RuleFormatV2))
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithStrictRuleFormat(strict))
+
+		// Register two renderers.
+		err := configurator.RegisterRenderer(renderer1)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(renderer2)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		if strict {
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("renderer supports rule format V1"))
+			gomega.Expect(hook.warnings).To(gomega.BeEmpty())
+			continue
+		}
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// V1 renderer receives the rules with the V2 fields stripped.
+		_, egress := renderer1.GetRules(pod1)
+		gomega.Expect(egress).ToNot(gomega.BeEmpty())
+		for _, rule := range egress {
+			gomega.Expect(rule.RuleFormat()).To(gomega.Equal(rendererAPI.RuleFormatV1))
+		}
+		gomega.Expect(renderer1.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(renderer1.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+		gomega.Expect(hook.warnings).To(gomega.HaveLen(1))
+		gomega.Expect(hook.warnings[0].Data["format"]).To(gomega.Equal(rendererAPI.RuleFormatV1))
+
+		// V2 renderer gets the full rule.
+		_, egress = renderer2.GetRules(pod1)
+		var fullRules []*rendererAPI.ContivRule
+		for _, rule := range egress {
+			if rule.RuleFormat() == rendererAPI.RuleFormatV2 {
+				fullRules = append(fullRules, rule)
+			}
+		}
+		gomega.Expect(fullRules).To(gomega.HaveLen(1))
+		gomega.Expect(fullRules[0].TCPFlags).ToNot(gomega.BeNil())
+		gomega.Expect(fullRules[0].RateLimit).ToNot(gomega.BeNil())
+		gomega.Expect(fullRules[0].Description).To(gomega.Equal("web"))
+	}
+}
+
+// legacyRenderer is a renderer advertising capabilities but not the rule format.
+type legacyRenderer struct {
+	mock *MockRenderer
+}
+
+func (lr *legacyRenderer) NewTxn(resync bool) rendererAPI.Txn {
+	return lr.mock.NewTxn(resync)
+}
+
+func (lr *legacyRenderer) HasCapability(capability rendererAPI.Capability) bool {
+	return lr.mock.HasCapability(capability)
+}
+
+func TestDefaultRuleFormat(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestDefaultRuleFormat")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress allowed from pod2 to TCP:80, rate-limited
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:        MatchIngress,
+				Pods:        []podmodel.ID{pod2},
+				Ports:       []Port{{Protocol: TCP, Number: 80}},
+				RateLimit:   &RateSpec{BitsPerSecond: 1000000, BurstBytes: 10000},
+				Description: "web",
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	// The renderer is capable of policing, but does not advertise the format.
+	mockRenderer := NewMockRenderer("A", logger)
+	mockRenderer.SetCapabilities(rendererAPI.Policing)
+	renderer := &legacyRenderer{mock: mockRenderer}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// The renderer is given the rules in the V1 format.
+	_, egress := mockRenderer.GetRules(pod1)
+	gomega.Expect(egress).ToNot(gomega.BeEmpty())
+	for _, rule := range egress {
+		gomega.Expect(rule.RuleFormat()).To(gomega.Equal(rendererAPI.RuleFormatV1))
+		gomega.Expect(rule.RateLimit).To(gomega.BeNil())
+		gomega.Expect(rule.Description).To(gomega.BeEmpty())
+	}
+	gomega.Expect(mockRenderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(mockRenderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+}
@@ -0,0 +1,233 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithRuleGroups enables/disables coalescing of rules into groups shared
+// between pods (see renderer.GroupTxn). Rules generated for a policy form
+// a group shared by all pods the policy is applied to, regardless of the other
+// policies of the pods. Rules injected by the configurator (NAT-loopback,
+// cluster DNS, deny-the-rest, ...) form the last group. With overlapping
+// (but not equal) sets of policies across pods, renderers therefore need
+// to install fewer rules in total than with one list of rules per set.
+// Rule groups are passed only to renderers with the renderer.RuleGroups
+// capability. The other renderers, and renderers that would be given rate
+// limits, connection rate limits, packet lengths, source ports, TCP flags,
+// tunnel VNIs, fragment rules or L7 matches they are not able to apply (see
+// WithStrictPolicing, WithStrictConnRateLimits, WithStrictPacketLength,
+// WithStrictSourcePorts, WithStrictTCPFlags, WithStrictTunnelVNI,
+// WithStrictFragments and WithStrictL7), receive the flat lists of rules
+// as usual.
+// Within a group, the SpecificityFirst ordering is applied, but not across
+// the groups. Rules of pods with deny matches (see Match.Action) form a single
+// group, as their order matters across the policies.
+func WithRuleGroups(enabled bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.ruleGroups = enabled
+	}
+}
+
+// PodRuleGroups stores ingress and egress rule groups rendered for a single pod.
+// The direction is from the vswitch point of view.
+type PodRuleGroups struct {
+	Ingress []*renderer.RuleGroup
+	Egress  []*renderer.RuleGroup
+}
+
+// generatePodRuleGroups generates ingress and egress rule groups implementing
+// a given list of policies.
+func (pct *PolicyConfiguratorTxn) generatePodRuleGroups(policies ContivPolicies) PodRuleGroups {
+	// The rules were already traced and their provenance recorded
+	// when the flat lists were generated.
+	tracedPod, origins := pct.tracedPod, pct.origins
+	pct.tracedPod, pct.origins = nil, nil
+	defer func() {
+		pct.tracedPod, pct.origins = tracedPod, origins
+	}()
+
+	// Direction in policies is from the pod point of view, whereas rules
+	// are evaluated from the vswitch perspective.
+	return PodRuleGroups{
+		Ingress: pct.generateRuleGroups(MatchEgress, policies),
+		Egress:  pct.generateRuleGroups(MatchIngress, policies),
+	}
+}
+
+// generateRuleGroups generates a list of ingress or egress rule groups
+// implementing a given list of policies. The rules of the groups concatenated
+// allow the same traffic as the rules returned by generateRules().
+func (pct *PolicyConfiguratorTxn) generateRuleGroups(direction MatchType, policies ContivPolicies) []*renderer.RuleGroup {
+	groupDirection := "ingress" // vswitch point of view
+	if direction == MatchIngress {
+		groupDirection = "egress"
+	}
+
+	if hasDenyMatch(policies) {
+		// The order of the rules matters across the policies, all the rules
+		// form a single group.
+		name := "rules:" + groupDirection
+		return []*renderer.RuleGroup{pct.ruleGroup(name, pct.generateRules(direction, policies))}
+	}
+
+	groups := []*renderer.RuleGroup{}
+	restricted := make(map[AddressFamily]bool)
+	allowed := make(map[AddressFamily]bool)
+	for _, policy := range policies {
+		rules := pct.appendPolicyRules(ContivRules{}, direction, policy, restricted, allowed)
+		if len(rules) == 0 {
+			continue
+		}
+		if pct.configurator.ruleOrdering == SpecificityFirst {
+			sortBySpecificity(rules)
+		}
+		name := fmt.Sprintf("policy:%s/%s:%s", policy.ID.Namespace, policy.ID.Name, groupDirection)
+		groups = append(groups, pct.ruleGroup(name, rules))
+	}
+
+	rules, denyRest := pct.appendInjectedRules(ContivRules{}, direction, restricted, allowed)
+	if len(rules) > 0 {
+		if pct.configurator.ruleOrdering == SpecificityFirst {
+			permitRules := rules
+			if denyRest {
+				permitRules = rules[:len(rules)-1]
+			}
+			sortBySpecificity(permitRules)
+		}
+		groups = append(groups, pct.ruleGroup("injected:"+groupDirection, rules))
+	}
+	return groups
+}
+
+// ruleGroup returns a group with the given rules. The ID of the group is
+// the name suffixed with a (128-bit) hash of the rules. Groups with the same
+// ID are generated only once per transaction. Should the hash collide with
+// a group of different rules generated in the transaction, a counter is
+// appended to the ID.
+func (pct *PolicyConfiguratorTxn) ruleGroup(name string, rules ContivRules) *renderer.RuleGroup {
+	hash := sha256.New()
+	for _, rule := range rules {
+		hash.Write([]byte(rule.String() + "\n"))
+	}
+	digest := hash.Sum(nil)[:16]
+	id := fmt.Sprintf("%s#%x", name, digest)
+	for collisions := 1; ; collisions++ {
+		group, generated := pct.ruleGroups[id]
+		if !generated {
+			break
+		}
+		if equalRules(group.Rules, rules) {
+			return group
+		}
+		id = fmt.Sprintf("%s#%x-%d", name, digest, collisions)
+	}
+	group := &renderer.RuleGroup{ID: id, Rules: rules}
+	pct.ruleGroups[id] = group
+	return group
+}
+
+// equalRules returns true if both lists contain equal rules in the same order.
+func equalRules(rules1, rules2 ContivRules) bool {
+	if len(rules1) != len(rules2) {
+		return false
+	}
+	for idx := range rules1 {
+		if rules1[idx].Compare(rules2[idx]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// renderGroups passes rule groups of a pod into the transaction of the renderer
+// with the given index. Returns false if the renderer should be given
+// the flat lists of rules instead.
+func (pc *PolicyConfigurator) renderGroups(rTxn renderer.Txn, idx int, pod podmodel.ID, podIP *net.IPNet,
+	groups *PodRuleGroups, removed bool) (bool, error) {
+
+	if !pc.ruleGroups || !hasCapability(pc.renderers[idx], renderer.RuleGroups) {
+		return false, nil
+	}
+	groupTxn, isGroupTxn := rTxn.(renderer.GroupTxn)
+	if !isGroupTxn {
+		return false, nil
+	}
+	if removed {
+		groupTxn.RenderGroups(pod, podIP, nil, nil, true)
+		return true, nil
+	}
+	if groups == nil {
+		return false, nil
+	}
+	stripRateLimits := !pc.strictPolicing && !hasCapability(pc.renderers[idx], renderer.Policing)
+	stripConnRates := !pc.strictConnRate && !hasCapability(pc.renderers[idx], renderer.ConnRateLimiting)
+	stripPacketLens := !pc.strictPacketLen && !hasCapability(pc.renderers[idx], renderer.PacketLength)
+	stripSourcePorts := !pc.strictSourcePorts && !hasCapability(pc.renderers[idx], renderer.SourcePortMatch)
+	stripTCPFlags := !pc.strictTCPFlags && !hasCapability(pc.renderers[idx], renderer.TCPFlagMatching)
+	stripTunnelVNIs := !pc.strictTunnelVNI && !hasCapability(pc.renderers[idx], renderer.TunnelMatching)
+	stripFragments := !pc.strictFragments && !hasCapability(pc.renderers[idx], renderer.FragmentMatching)
+	stripL7Matches := !pc.strictL7 && !hasCapability(pc.renderers[idx], renderer.L7Filtering)
+	ruleFormat := rendererRuleFormat(pc.renderers[idx])
+	downgrade := !pc.strictRuleFormat
+	for _, dirGroups := range [][]*renderer.RuleGroup{groups.Ingress, groups.Egress} {
+		for _, group := range dirGroups {
+			if (stripRateLimits && hasRateLimits(group.Rules)) ||
+				(stripConnRates && hasConnRateLimits(group.Rules)) ||
+				(stripPacketLens && hasPacketLens(group.Rules)) ||
+				(stripSourcePorts && hasSourcePorts(group.Rules)) ||
+				(stripTCPFlags && hasTCPFlags(group.Rules)) ||
+				(stripTunnelVNIs && hasTunnelVNIs(group.Rules)) ||
+				(stripFragments && hasFragmentRules(group.Rules)) ||
+				(stripL7Matches && hasL7Matches(group.Rules)) ||
+				(downgrade && hasNewerRuleFormat(group.Rules, ruleFormat)) {
+				return false, nil
+			}
+			err := checkCapabilities(pc.renderers[idx], group.Rules)
+			if err == nil {
+				err = checkRuleFormat(pc.renderers[idx], group.Rules)
+			}
+			if err != nil {
+				return true, err
+			}
+		}
+	}
+	if pc.sharedRules {
+		groupTxn.RenderGroups(pod, podIP, groups.Ingress, groups.Egress, false)
+	} else {
+		groupTxn.RenderGroups(pod, podIP, copyRuleGroups(groups.Ingress), copyRuleGroups(groups.Egress), false)
+	}
+	return true, nil
+}
+
+// copyRuleGroups returns a deep copy of the rule groups.
+func copyRuleGroups(groups []*renderer.RuleGroup) []*renderer.RuleGroup {
+	groupsCopy := []*renderer.RuleGroup{}
+	for _, group := range groups {
+		groupsCopy = append(groupsCopy, &renderer.RuleGroup{
+			ID:    group.ID,
+			Rules: ContivRules(group.Rules).Copy(),
+		})
+	}
+	return groupsCopy
+}
@@ -0,0 +1,272 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestRuleGroups(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRuleGroups")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		clientName = "client"
+		clientIP   = "192.168.2.1"
+		otherName  = "other"
+		otherIP    = "192.168.2.2"
+		numPods    = 8
+	)
+	client := podmodel.ID{Name: clientName, Namespace: namespace}
+	other := podmodel.ID{Name: otherName, Namespace: namespace}
+
+	// policies shared by all pods
+	webPolicy := &ContivPolicy{
+		ID:   policymodel.ID{Name: "web", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:     MatchIngress,
+				IPBlocks: []IPBlock{{Network: parseIPNet("10.0.0.0/16")}},
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+					{Protocol: TCP, Number: 443},
+					{Protocol: TCP, Number: 8080},
+				},
+			},
+		},
+	}
+	monitoringPolicy := &ContivPolicy{
+		ID:   policymodel.ID{Name: "monitoring", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{client},
+				Ports: []Port{{Protocol: TCP, Number: 9100}, {Protocol: UDP, Number: 9100}},
+			},
+		},
+	}
+
+	// every pod has one extra policy of its own
+	var pods []podmodel.ID
+	podIPs := make(map[podmodel.ID]string)
+	podPolicies := make(map[podmodel.ID][]*ContivPolicy)
+	for i := 0; i < numPods; i++ {
+		pod := podmodel.ID{Name: fmt.Sprintf("pod%d", i), Namespace: namespace}
+		pods = append(pods, pod)
+		podIPs[pod] = fmt.Sprintf("192.168.1.%d", i+1)
+		podPolicies[pod] = []*ContivPolicy{webPolicy, monitoringPolicy, {
+			ID:   policymodel.ID{Name: fmt.Sprintf("app%d", i), Namespace: namespace},
+			Type: PolicyIngress,
+			Matches: []Match{
+				{
+					Type:  MatchIngress,
+					Pods:  []podmodel.ID{client},
+					Ports: []Port{{Protocol: TCP, Number: uint16(5000 + i)}},
+				},
+			},
+		}}
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(client, clientIP)
+	cache.AddPodConfig(other, otherIP)
+	for _, pod := range pods {
+		cache.AddPodConfig(pod, podIPs[pod])
+	}
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer1 := NewMockRenderer("A", logger)
+	renderer1.SetCapabilities(rendererAPI.RuleGroups)
+	renderer2 := NewMockRenderer("B", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithRuleGroups(true))
+
+	// Register two renderers.
+	err := configurator.RegisterRenderer(renderer1)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterRenderer(renderer2)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	for _, pod := range pods {
+		txn.Configure(pod, podPolicies[pod])
+	}
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Renderer without the capability receives flat lists of rules.
+	for _, pod := range pods {
+		ingressGroups, egressGroups := renderer2.GetRuleGroups(pod)
+		gomega.Expect(ingressGroups).To(gomega.BeNil())
+		gomega.Expect(egressGroups).To(gomega.BeNil())
+	}
+
+	// Shared policies are rendered as shared groups.
+	groups := make(map[string]*rendererAPI.RuleGroup)
+	for _, pod := range pods {
+		_, egressGroups := renderer1.GetRuleGroups(pod)
+		// web, monitoring, app, injected
+		gomega.Expect(egressGroups).To(gomega.HaveLen(4))
+		gomega.Expect(egressGroups[3].ID).To(gomega.HavePrefix("injected:egress#"))
+		for _, group := range egressGroups {
+			if existing, hasGroup := groups[group.ID]; hasGroup {
+				gomega.Expect(existing == group).To(gomega.BeTrue())
+			}
+			groups[group.ID] = group
+		}
+	}
+	// web + monitoring + injected + one app group per pod
+	gomega.Expect(groups).To(gomega.HaveLen(3 + numPods))
+
+	// Fewer rules are installed in total with groups.
+	groupedRules := 0
+	for _, group := range groups {
+		groupedRules += len(group.Rules)
+	}
+	flatRules := 0
+	for _, pod := range pods {
+		_, egress := renderer2.GetRules(pod)
+		flatRules += len(egress)
+	}
+	gomega.Expect(groupedRules).To(gomega.BeNumerically("<", flatRules))
+
+	// Both renderers allow the same traffic.
+	for i, pod := range pods {
+		podIP := parseIP(podIPs[pod])
+		flows := []struct {
+			srcIP    string
+			protocol rendererAPI.ProtocolType
+			port     uint16
+			allowed  bool
+		}{
+			{"10.0.1.1", rendererAPI.TCP, 443, true},
+			{"10.0.1.1", rendererAPI.TCP, 9100, false},
+			{clientIP, rendererAPI.UDP, 9100, true},
+			{clientIP, rendererAPI.TCP, uint16(5000 + i), true},
+			{clientIP, rendererAPI.TCP, uint16(5001 + i), false},
+			{otherIP, rendererAPI.TCP, uint16(5000 + i), false},
+			{natLoopbackIP, rendererAPI.TCP, 22, true},
+		}
+		for _, flow := range flows {
+			expected := DeniedTraffic
+			if flow.allowed {
+				expected = AllowedTraffic
+			}
+			for _, renderer := range []*MockRenderer{renderer1, renderer2} {
+				action := renderer.TestTraffic(pod, EgressTraffic,
+					parseIP(flow.srcIP), podIP, flow.protocol, 123, flow.port)
+				gomega.Expect(action).To(gomega.BeEquivalentTo(expected))
+			}
+		}
+	}
+
+	// Remove pod0.
+	cache.AddPodConfig(pods[0], "")
+	txn = configurator.NewTxn(false)
+	txn.Configure(pods[0], podPolicies[pods[0]])
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	for _, renderer := range []*MockRenderer{renderer1, renderer2} {
+		ingress, egress := renderer.GetRules(pods[0])
+		gomega.Expect(ingress).To(gomega.BeEmpty())
+		gomega.Expect(egress).To(gomega.BeEmpty())
+	}
+
+	// Resync re-renders the committed groups.
+	err = configurator.RequestResync(podmodel.Pod_Label{})
+	gomega.Expect(err).To(gomega.BeNil())
+	_, egressGroups1 := renderer1.GetRuleGroups(pods[1])
+	_, egressGroups2 := renderer1.GetRuleGroups(pods[2])
+	gomega.Expect(egressGroups1).To(gomega.HaveLen(4))
+	gomega.Expect(egressGroups1[2].ID).To(gomega.HavePrefix("policy:default/web:egress#"))
+	gomega.Expect(egressGroups1[2] == egressGroups2[2]).To(gomega.BeTrue())
+}
+
+func TestRuleGroupIDCollision(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRuleGroupIDCollision")
+
+	newRule := func(port uint16) *rendererAPI.ContivRule {
+		return &rendererAPI.ContivRule{
+			Action:      rendererAPI.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: &net.IPNet{},
+			Protocol:    rendererAPI.TCP,
+			DestPort:    port,
+		}
+	}
+	rules1 := ContivRules{newRule(80)}
+	rules2 := ContivRules{newRule(443)}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  NewMockPolicyCache(),
+			Contiv: NewMockContiv(),
+		},
+	}
+	configurator.Init(false, WithRuleGroups(true))
+	txn := configurator.NewTxn(false).(*PolicyConfiguratorTxn)
+
+	// Groups with equal rules are the same.
+	group1 := txn.ruleGroup("policy:default/web:ingress", rules1)
+	gomega.Expect(txn.ruleGroup("policy:default/web:ingress", ContivRules{newRule(80)})).To(gomega.BeIdenticalTo(group1))
+
+	// Simulate a hash collision with a group of other rules.
+	txn.ruleGroups[group1.ID] = &rendererAPI.RuleGroup{ID: group1.ID, Rules: rules2}
+	group2 := txn.ruleGroup("policy:default/web:ingress", rules1)
+	gomega.Expect(group2.ID).ToNot(gomega.Equal(group1.ID))
+	gomega.Expect(group2.ID).To(gomega.HavePrefix(group1.ID))
+	gomega.Expect(group2.Rules).To(gomega.Equal([]*rendererAPI.ContivRule(rules1)))
+	gomega.Expect(txn.ruleGroup("policy:default/web:ingress", rules1)).To(gomega.BeIdenticalTo(group2))
+}
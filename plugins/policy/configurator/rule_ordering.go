@@ -0,0 +1,66 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import "sort"
+
+// RuleOrdering selects the order in which the generated rules are passed
+// to renderers.
+type RuleOrdering int
+
+const (
+	// DefaultOrdering preserves the order in which the rules were generated
+	// from policies. The order is deterministic but not based on specificity.
+	DefaultOrdering RuleOrdering = iota
+
+	// SpecificityFirst sorts rules such that rules matching a subset of
+	// the traffic of other rules (narrower networks, specific ports) precede
+	// the broader ones, as given by renderer.ContivRule.Compare().
+	// The deny-the-rest rule remains the last.
+	SpecificityFirst
+)
+
+// String converts RuleOrdering into a human-readable string.
+func (ro RuleOrdering) String() string {
+	switch ro {
+	case DefaultOrdering:
+		return "DEFAULT"
+	case SpecificityFirst:
+		return "SPECIFICITY-FIRST"
+	}
+	return "INVALID"
+}
+
+// WithRuleOrdering selects the ordering of generated rules.
+// Useful for renderers that match rules top-down.
+// The deny-the-rest rule is never reordered. For pods with deny matches
+// (see Match.Action), the ordering applies only among the rules of the same
+// rank given by the action precedence (see WithActionPrecedence), i.e. it
+// never moves a PERMIT rule in front of a DENY rule which takes precedence
+// (or vice versa), and has therefore no effect on what traffic is allowed.
+func WithRuleOrdering(ordering RuleOrdering) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.ruleOrdering = ordering
+	}
+}
+
+// sortBySpecificity sorts rules from the most specific to the broadest.
+func sortBySpecificity(rules ContivRules) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Compare(rules[j]) < 0
+	})
+}
@@ -0,0 +1,122 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestSpecificityFirstOrdering(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSpecificityFirstOrdering")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod1IP    = "192.168.1.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+
+	// egress allowed to 10.0.0.0/24 and 10.0.0.1/32:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type: MatchEgress,
+				IPBlocks: []IPBlock{
+					{Network: *ipNetwork("10.0.0.0/24")},
+				},
+			},
+			{
+				Type: MatchEgress,
+				IPBlocks: []IPBlock{
+					{Network: *ipNetwork("10.0.0.1/32")},
+				},
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+
+	for _, ordering := range []RuleOrdering{DefaultOrdering, SpecificityFirst} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer := NewMockRenderer("A", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithRuleOrdering(ordering))
+
+		// Register one renderer.
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+
+		ingress, _ := renderer.GetRules(pod1)
+		gomega.Expect(ingress).To(gomega.HaveLen(3))
+		if ordering == SpecificityFirst {
+			gomega.Expect(ingress[0].DestNetwork.String()).To(gomega.Equal("10.0.0.1/32"))
+			gomega.Expect(ingress[1].DestNetwork.String()).To(gomega.Equal("10.0.0.0/24"))
+		} else {
+			gomega.Expect(ingress[0].DestNetwork.String()).To(gomega.Equal("10.0.0.0/24"))
+			gomega.Expect(ingress[1].DestNetwork.String()).To(gomega.Equal("10.0.0.1/32"))
+		}
+		gomega.Expect(ingress[2].Action).To(gomega.BeEquivalentTo(rendererAPI.ActionDeny))
+
+		// The ordering does not change what is allowed.
+		action := renderer.TestTraffic(pod1, IngressTraffic,
+			parseIP(pod1IP), parseIP("10.0.0.1"), rendererAPI.UDP, 123, 53)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer.TestTraffic(pod1, IngressTraffic,
+			parseIP(pod1IP), parseIP("10.0.1.1"), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+}
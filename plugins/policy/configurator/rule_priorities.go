@@ -0,0 +1,180 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"math"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// rulePriorityStep is the gap between priorities of consecutive rules
+// numbered from scratch, leaving room for rules inserted later.
+const rulePriorityStep = 100
+
+// WithExplicitRulePriorities enables assignment of priority numbers to the rules
+// passed to renderers with the renderer.ExplicitPriorities capability
+// (see renderer.PrioritizedTxn). The numbers follow the order of the rules,
+// which is derived from the specificity (see WithRuleOrdering) and from
+// the priorities of policies (see WithActionPrecedence), so that renderers
+// honoring them do not need to re-sort the rules. Unchanged rules of a pod
+// keep their numbers across commits, new rules are numbered in the gaps
+// between them and the rules of the pod are re-numbered only if there is
+// no gap left. Renderers with priorities are given the entire lists
+// of rules with Render(), never deltas (see renderer.IncrementalUpdate).
+func WithExplicitRulePriorities() Option {
+	return func(pc *PolicyConfigurator) {
+		pc.rulePriorities = make(map[rulePrioritiesKey]*podRulePriorities)
+	}
+}
+
+// rulePrioritiesKey identifies the rules of a pod rendered by a renderer.
+type rulePrioritiesKey struct {
+	pod      podmodel.ID
+	renderer int
+}
+
+// podRulePriorities stores the priorities assigned to the rules of a pod,
+// keyed by the rule (in the string form) for every direction.
+type podRulePriorities struct {
+	ingress map[string]renderer.RulePriority
+	egress  map[string]renderer.RulePriority
+}
+
+// prioritizedRenderer returns true if the renderer with the given index is
+// given priorities of the rules.
+func (pc *PolicyConfigurator) prioritizedRenderer(idx int) bool {
+	return pc.rulePriorities != nil && hasCapability(pc.renderers[idx], renderer.ExplicitPriorities)
+}
+
+// renderRulePriorities passes the priorities of the rules of the pod rendered
+// with Render() into the transaction of the renderer with the given index
+// if it has the capability. The priorities of removed pods are released.
+func (pc *PolicyConfigurator) renderRulePriorities(rTxn renderer.Txn, idx int, pod podmodel.ID,
+	ingress, egress ContivRules, removed bool) {
+
+	if !pc.prioritizedRenderer(idx) {
+		return
+	}
+	key := rulePrioritiesKey{pod: pod, renderer: idx}
+	if removed {
+		delete(pc.rulePriorities, key)
+		return
+	}
+	prioritizedTxn, isPrioritized := rTxn.(renderer.PrioritizedTxn)
+	if !isPrioritized {
+		pc.Log.WithField("renderer", idx).Warn(
+			"Renderer advertises explicit priorities without implementing PrioritizedTxn")
+		return
+	}
+	previous, hasPrevious := pc.rulePriorities[key]
+	if !hasPrevious {
+		previous = &podRulePriorities{}
+	}
+	ingressPriorities, ingressAssigned := assignRulePriorities(ingress, previous.ingress)
+	egressPriorities, egressAssigned := assignRulePriorities(egress, previous.egress)
+	pc.rulePriorities[key] = &podRulePriorities{ingress: ingressAssigned, egress: egressAssigned}
+	pc.Log.WithFields(logging.Fields{
+		"pod":     pc.logPod(pod),
+		"ingress": ingressPriorities,
+		"egress":  egressPriorities,
+	}).Debug("Assigning rule priorities")
+	prioritizedTxn.SetRulePriorities(pod, ingressPriorities, egressPriorities)
+}
+
+// releaseRulePriorities releases priorities of pods which are no longer
+// configured.
+func (pct *PolicyConfiguratorTxn) releaseRulePriorities() {
+	pc := pct.configurator
+	for key := range pc.rulePriorities {
+		if _, configured := pc.config[key.pod]; !configured {
+			delete(pc.rulePriorities, key)
+		}
+	}
+}
+
+// assignRulePriorities returns strictly increasing priorities of the rules,
+// keeping the previously assigned priorities of the rules in the same
+// relative order, together with the new assignment keyed by the rules.
+func assignRulePriorities(rules ContivRules, previous map[string]renderer.RulePriority) (
+	priorities []renderer.RulePriority, assigned map[string]renderer.RulePriority) {
+
+	keys := make([]string, len(rules))
+	for i, rule := range rules {
+		keys[i] = rule.String()
+	}
+	priorities = make([]renderer.RulePriority, len(rules))
+	kept := make([]bool, len(rules))
+	var last renderer.RulePriority
+	for i, key := range keys {
+		if priority, hasPriority := previous[key]; hasPriority && priority > last {
+			priorities[i] = priority
+			kept[i] = true
+			last = priority
+		}
+	}
+	if !fillRulePriorities(priorities, kept) {
+		for i := range priorities {
+			priorities[i] = renderer.RulePriority((i + 1) * rulePriorityStep)
+		}
+	}
+	assigned = make(map[string]renderer.RulePriority)
+	for i, key := range keys {
+		assigned[key] = priorities[i]
+	}
+	return priorities, assigned
+}
+
+// fillRulePriorities numbers the rules without a kept priority in the gaps
+// between the kept ones. Returns false if some gap is too small.
+func fillRulePriorities(priorities []renderer.RulePriority, kept []bool) bool {
+	var lower uint64
+	for i := 0; i < len(priorities); {
+		if kept[i] {
+			lower = uint64(priorities[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(priorities) && !kept[end] {
+			end++
+		}
+		count := uint64(end - i)
+		if end == len(priorities) {
+			// trailing rules
+			if lower+count*rulePriorityStep > math.MaxUint32 {
+				return false
+			}
+			for n := uint64(0); n < count; n++ {
+				priorities[i+int(n)] = renderer.RulePriority(lower + (n+1)*rulePriorityStep)
+			}
+		} else {
+			gap := uint64(priorities[end]) - lower
+			if gap <= count {
+				return false
+			}
+			for n := uint64(0); n < count; n++ {
+				priorities[i+int(n)] = renderer.RulePriority(lower + gap*(n+1)/(count+1))
+			}
+		}
+		i = end
+	}
+	return true
+}
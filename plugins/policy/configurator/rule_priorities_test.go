@@ -0,0 +1,299 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestExplicitRulePriorities(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestExplicitRulePriorities")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+
+	newPolicy := func(name string, ports ...uint16) *ContivPolicy {
+		policy := &ContivPolicy{
+			ID:      policymodel.ID{Name: name, Namespace: namespace},
+			Type:    PolicyIngress,
+			Matches: []Match{{Type: MatchIngress}},
+		}
+		for _, port := range ports {
+			policy.Matches[0].Ports = append(policy.Matches[0].Ports, Port{Protocol: TCP, Number: port})
+		}
+		return policy
+	}
+	policy1 := newPolicy("policy1", 80, 8080)
+	policy2 := newPolicy("policy2", 443)
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer1 := NewMockRenderer("A", logger)
+	renderer1.SetCapabilities(rendererAPI.ExplicitPriorities, rendererAPI.IncrementalUpdate)
+	renderer2 := NewMockRenderer("B", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithExplicitRulePriorities())
+	err := configurator.RegisterRenderer(renderer1)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterRenderer(renderer2)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// priorities returns the priorities of the rules for the ingress of the pod
+	// (vswitch egress) keyed by the rules.
+	priorities := func() map[string]rendererAPI.RulePriority {
+		_, egress := renderer1.GetRules(pod1)
+		_, egressPrio := renderer1.GetRulePriorities(pod1)
+		gomega.Expect(egressPrio).To(gomega.HaveLen(len(egress)))
+		byRule := make(map[string]rendererAPI.RulePriority)
+		for i, rule := range egress {
+			if i > 0 {
+				gomega.Expect(egressPrio[i]).To(gomega.BeNumerically(">", egressPrio[i-1]))
+			}
+			byRule[rule.String()] = egressPrio[i]
+		}
+		return byRule
+	}
+
+	// Rules are numbered in their order.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	first := priorities()
+	_, egress := renderer1.GetRules(pod1)
+	_, egressPrio := renderer1.GetRulePriorities(pod1)
+	gomega.Expect(egress).ToNot(gomega.BeEmpty())
+	for i := range egress {
+		gomega.Expect(egressPrio[i]).To(gomega.BeEquivalentTo((i + 1) * 100))
+	}
+
+	// Renderers without the capability are not given the priorities.
+	_, egressPrio = renderer2.GetRulePriorities(pod1)
+	gomega.Expect(egressPrio).To(gomega.BeNil())
+	_, egress2 := renderer2.GetRules(pod1)
+	gomega.Expect(egress2).To(gomega.Equal(egress))
+
+	// Unchanged rules keep their numbers, the new rule is numbered in a gap.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	second := priorities()
+	gomega.Expect(second).To(gomega.HaveLen(len(first) + 1))
+	for rule, priority := range first {
+		gomega.Expect(second).To(gomega.HaveKeyWithValue(rule, priority))
+	}
+
+	// The numbering is deterministic.
+	configurator2 := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	renderer3 := NewMockRenderer("C", logger)
+	renderer3.SetCapabilities(rendererAPI.ExplicitPriorities)
+	configurator2.Init(false, WithExplicitRulePriorities())
+	err = configurator2.RegisterRenderer(renderer3)
+	gomega.Expect(err).To(gomega.BeNil())
+	for _, policies := range [][]*ContivPolicy{{policy1}, {policy1, policy2}} {
+		txn = configurator2.NewTxn(false)
+		txn.Configure(pod1, policies)
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+	}
+	_, egressPrio = renderer1.GetRulePriorities(pod1)
+	_, egressPrio3 := renderer3.GetRulePriorities(pod1)
+	gomega.Expect(egressPrio3).To(gomega.Equal(egressPrio))
+
+	// Removed rules release their numbers.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	third := priorities()
+	gomega.Expect(third).To(gomega.HaveLen(len(first) - 1))
+	for rule, priority := range third {
+		gomega.Expect(second).To(gomega.HaveKeyWithValue(rule, priority))
+	}
+}
+
+func TestAssignRulePriorities(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	newRule := func(port uint16) *rendererAPI.ContivRule {
+		return &rendererAPI.ContivRule{
+			Action:      rendererAPI.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: &net.IPNet{},
+			Protocol:    rendererAPI.TCP,
+			DestPort:    port,
+		}
+	}
+	rule1, rule2, rule3 := newRule(1), newRule(2), newRule(3)
+
+	// Numbered from scratch.
+	priorities, assigned := assignRulePriorities(ContivRules{rule1, rule3}, nil)
+	gomega.Expect(priorities).To(gomega.Equal([]rendererAPI.RulePriority{100, 200}))
+
+	// Inserted into the gap.
+	priorities, assigned = assignRulePriorities(ContivRules{rule1, rule2, rule3}, assigned)
+	gomega.Expect(priorities).To(gomega.Equal([]rendererAPI.RulePriority{100, 150, 200}))
+
+	// Re-ordered rules keep the numbers while increasing.
+	priorities, _ = assignRulePriorities(ContivRules{rule3, rule1, rule2}, assigned)
+	gomega.Expect(priorities).To(gomega.Equal([]rendererAPI.RulePriority{200, 300, 400}))
+
+	// Re-numbered if there is no gap left.
+	assigned = map[string]rendererAPI.RulePriority{rule1.String(): 1, rule3.String(): 2}
+	priorities, _ = assignRulePriorities(ContivRules{rule1, rule2, rule3}, assigned)
+	gomega.Expect(priorities).To(gomega.Equal([]rendererAPI.RulePriority{100, 200, 300}))
+}
+
+func TestRulePrioritiesAfterUnregister(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRulePrioritiesAfterUnregister")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	dbLabel := podmodel.Pod_Label{Key: "app", Value: "db"}
+	webLabel := podmodel.Pod_Label{Key: "app", Value: "web"}
+
+	newPolicy := func(name string, ports ...uint16) *ContivPolicy {
+		policy := &ContivPolicy{
+			ID:      policymodel.ID{Name: name, Namespace: namespace},
+			Type:    PolicyIngress,
+			Matches: []Match{{Type: MatchIngress}},
+		}
+		for _, port := range ports {
+			policy.Matches[0].Ports = append(policy.Matches[0].Ports, Port{Protocol: TCP, Number: port})
+		}
+		return policy
+	}
+	policy1 := newPolicy("policy1", 80, 8080)
+	policy2 := newPolicy("policy2", 443)
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP, &dbLabel)
+	cache.AddPodConfig(pod2, pod2IP, &webLabel)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	defaultRenderer := NewMockRenderer("default", logger)
+	dbRenderer := NewMockRenderer("db", logger)
+	webRenderer := NewMockRenderer("web", logger)
+	for _, rndr := range []*MockRenderer{defaultRenderer, dbRenderer, webRenderer} {
+		rndr.SetCapabilities(rendererAPI.ExplicitPriorities)
+	}
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithExplicitRulePriorities())
+	err := configurator.RegisterRenderer(defaultRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterLabeledRenderer(dbLabel, dbRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterLabeledRenderer(webLabel, webRenderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// priorities returns the priorities of the rules for the ingress of pod2
+	// (vswitch egress) keyed by the rules.
+	priorities := func() map[string]rendererAPI.RulePriority {
+		_, egress := webRenderer.GetRules(pod2)
+		_, egressPrio := webRenderer.GetRulePriorities(pod2)
+		gomega.Expect(egressPrio).To(gomega.HaveLen(len(egress)))
+		byRule := make(map[string]rendererAPI.RulePriority)
+		for i, rule := range egress {
+			byRule[rule.String()] = egressPrio[i]
+		}
+		return byRule
+	}
+
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	first := priorities()
+	gomega.Expect(first).ToNot(gomega.BeEmpty())
+
+	// Renderer registered before the web renderer is removed.
+	err = configurator.UnregisterRenderer(dbLabel)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Unchanged rules of pod2 still keep their numbers.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{policy1, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	second := priorities()
+	gomega.Expect(second).To(gomega.HaveLen(len(first) + 1))
+	for rule, priority := range first {
+		gomega.Expect(second).To(gomega.HaveKeyWithValue(rule, priority))
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"strings"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// ScaleLimits lists rule-count limits checked by ValidateAtScale.
+// Zero value of a limit means unlimited.
+type ScaleLimits struct {
+	// MaxRulesPerPod limits the number of rules (ingress + egress) of one pod.
+	MaxRulesPerPod int
+
+	// MaxRulesTotal limits the number of rules summed across all the pods
+	// (cluster-wide rule budget).
+	MaxRulesTotal int
+}
+
+// ValidateAtScale simulates the translation of the given configuration
+// (policies of all the given pods) into rules and returns an error listing
+// the limits that would be exceeded. Renderers are not involved and neither
+// the configuration nor the committed state is modified (summed rules are
+// counted in the flat form, i.e. without any sharing of rules between pods
+// done by some renderers). Pods without an entry in <policies> are evaluated
+// with an empty set of policies.
+func (pc *PolicyConfigurator) ValidateAtScale(pods []podmodel.ID, policies map[podmodel.ID][]*ContivPolicy,
+	limits ScaleLimits) error {
+	pc.Lock()
+	defer pc.Unlock()
+
+	// Rules are generated in a scratch transaction, never committed.
+	pct := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	pct.podIPAddresses = pc.podIPAddresses.Copy()
+	pct.clusterDNSIP = pc.clusterDNSIP
+	for _, pod := range pods {
+		pct.config[pod] = pc.canonicalPolicies(deepCopyPolicies(policies[pod]))
+	}
+	pct.applyPolicyToggles()
+
+	processed := []ProcessedPolicySet{}
+	exceeded := []string{}
+	total := 0
+	sortedPods := append([]podmodel.ID{}, pods...)
+	sortPodIDs(sortedPods)
+	for _, pod := range sortedPods {
+		podPolicies := pct.effectivePolicies(pod, pct.config[pod])
+		var ingress, egress ContivRules
+		alreadyProcessed := false
+		for _, policySet := range processed {
+			if policySet.policies.Equals(podPolicies) {
+				ingress = policySet.ingress
+				egress = policySet.egress
+				alreadyProcessed = true
+				break
+			}
+		}
+		if !alreadyProcessed {
+			egress = pct.generateRules(MatchIngress, podPolicies)
+			ingress = pct.generateRules(MatchEgress, podPolicies)
+			processed = append(processed,
+				ProcessedPolicySet{policies: podPolicies, ingress: ingress, egress: egress})
+		}
+		podRules := len(ingress) + len(egress)
+		total += podRules
+		if limits.MaxRulesPerPod > 0 && podRules > limits.MaxRulesPerPod {
+			exceeded = append(exceeded,
+				fmt.Sprintf("pod %s with %d rules (limit %d)", pod, podRules, limits.MaxRulesPerPod))
+		}
+	}
+	if limits.MaxRulesTotal > 0 && total > limits.MaxRulesTotal {
+		exceeded = append(exceeded,
+			fmt.Sprintf("%d rules in total (limit %d)", total, limits.MaxRulesTotal))
+	}
+	if len(exceeded) > 0 {
+		return fmt.Errorf("scale limits exceeded: %s", strings.Join(exceeded, ", "))
+	}
+	return nil
+}
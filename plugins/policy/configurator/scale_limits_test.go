@@ -0,0 +1,129 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestValidateAtScale(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestValidateAtScale")
+
+	const (
+		namespace = "default"
+		numPods   = 10
+	)
+
+	// ingress allowed on 4 TCP ports from anywhere
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 22},
+					{Protocol: TCP, Number: 80},
+					{Protocol: TCP, Number: 443},
+					{Protocol: TCP, Number: 8080},
+				},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	pods := []podmodel.ID{}
+	policies := make(map[podmodel.ID][]*ContivPolicy)
+	for i := 0; i < numPods; i++ {
+		pod := podmodel.ID{Name: fmt.Sprintf("pod%d", i), Namespace: namespace}
+		cache.AddPodConfig(pod, fmt.Sprintf("192.168.1.%d", i+1))
+		pods = append(pods, pod)
+		policies[pod] = []*ContivPolicy{policy1}
+	}
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// 4 ports + NAT-loopback + deny-the-rest in the egress direction
+	// of the vswitch, nothing in the ingress direction.
+	const rulesPerPod = 6
+
+	// Within the limits.
+	err = configurator.ValidateAtScale(pods, policies, ScaleLimits{
+		MaxRulesPerPod: rulesPerPod,
+		MaxRulesTotal:  numPods * rulesPerPod,
+	})
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.ValidateAtScale(pods, policies, ScaleLimits{})
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Cluster-wide rule budget exceeded.
+	err = configurator.ValidateAtScale(pods, policies, ScaleLimits{
+		MaxRulesTotal: numPods*rulesPerPod - 1,
+	})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(
+		fmt.Sprintf("%d rules in total (limit %d)", numPods*rulesPerPod, numPods*rulesPerPod-1)))
+	gomega.Expect(err.Error()).ToNot(gomega.ContainSubstring("pod"))
+
+	// Per-pod limit exceeded only by the pods with the policy.
+	delete(policies, pods[0])
+	err = configurator.ValidateAtScale(pods, policies, ScaleLimits{MaxRulesPerPod: rulesPerPod - 1})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).ToNot(gomega.ContainSubstring(pods[0].String() + " "))
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(
+		fmt.Sprintf("pod %s with %d rules (limit %d)", pods[1], rulesPerPod, rulesPerPod-1)))
+
+	// No renderer was involved and nothing was committed.
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.BeEmpty())
+	for _, pod := range pods {
+		ingress, egress := renderer.GetRules(pod)
+		gomega.Expect(ingress).To(gomega.BeEmpty())
+		gomega.Expect(egress).To(gomega.BeEmpty())
+	}
+}
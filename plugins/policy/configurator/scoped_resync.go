@@ -0,0 +1,93 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// NewScopedResyncTxn starts a transaction with the resync semantics limited
+// to the pods of the given namespace: the supplied configuration replaces
+// the committed configuration of the namespace, i.e. committed pods
+// of the namespace not mentioned in the transaction are removed (after
+// the grace period if WithTeardownGracePeriod is used). Pods of other
+// namespaces are not affected, Configure() ignores them. Renderers receive
+// only the changes of the namespace (not a resync). RemoveBySource(),
+// SetPolicyEnabled() and UnpinPolicy() apply to all pods as with other
+// transactions.
+func (pc *PolicyConfigurator) NewScopedResyncTxn(namespace string) Txn {
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	txn.resyncScopes = map[string]struct{}{namespace: {}}
+	return txn
+}
+
+// inResyncScope returns true if the pod can be configured by the transaction,
+// i.e. the transaction is not scoped or the pod is from a namespace
+// in the scope.
+func (pct *PolicyConfiguratorTxn) inResyncScope(pod podmodel.ID) bool {
+	if pct.resyncScopes == nil {
+		return true
+	}
+	_, inScope := pct.resyncScopes[pod.Namespace]
+	return inScope
+}
+
+// applyResyncScopes removes committed pods from namespaces in the scope
+// of the transaction which were not configured by the transaction.
+func (pct *PolicyConfiguratorTxn) applyResyncScopes() {
+	if pct.resyncScopes == nil || pct.resync {
+		return
+	}
+	pc := pct.configurator
+	for _, committed := range []map[podmodel.ID]ContivPolicies{pc.config, pc.skippedPods} {
+		for _, pod := range sortedPods(committed) {
+			if _, configured := pct.config[pod]; configured || !pct.inResyncScope(pod) {
+				continue
+			}
+			pct.Log.WithFields(logging.Fields{
+				"pod":       pc.logPod(pod),
+				"namespace": pod.Namespace,
+			}).Debug("Removing pod omitted from the scoped resync")
+			pct.tearDownOmitted(pod)
+		}
+	}
+}
+
+// mergeResyncScopes merges the scopes of the transaction into the queued
+// one. Pods of the scope not configured by the transaction are dropped
+// from the queued transaction, so that they get removed once it is applied.
+func (queued *PolicyConfiguratorTxn) mergeResyncScopes(pct *PolicyConfiguratorTxn) {
+	if pct.resyncScopes == nil {
+		return
+	}
+	for pod := range queued.config {
+		if _, configured := pct.config[pod]; !configured && pct.inResyncScope(pod) {
+			delete(queued.config, pod)
+		}
+	}
+	if queued.resync {
+		return
+	}
+	if queued.resyncScopes == nil {
+		queued.resyncScopes = make(map[string]struct{})
+	}
+	for namespace := range pct.resyncScopes {
+		queued.resyncScopes[namespace] = struct{}{}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestScopedResync(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestScopedResync")
+
+	// Prepare input data.
+	const (
+		namespace1 = "ns1"
+		namespace2 = "ns2"
+		podA1IP    = "192.168.1.1"
+		podA2IP    = "192.168.1.2"
+		podA3IP    = "192.168.1.3"
+		podB1IP    = "192.168.2.1"
+		podB2IP    = "192.168.2.2"
+		period     = 100 * time.Millisecond
+	)
+	podA1 := podmodel.ID{Name: "a1", Namespace: namespace1}
+	podA2 := podmodel.ID{Name: "a2", Namespace: namespace1}
+	podA3 := podmodel.ID{Name: "a3", Namespace: namespace1}
+	podB1 := podmodel.ID{Name: "b1", Namespace: namespace2}
+	podB2 := podmodel.ID{Name: "b2", Namespace: namespace2}
+	newPolicy := func(name, namespace string, port uint16) *ContivPolicy {
+		return &ContivPolicy{
+			ID:   policymodel.ID{Name: name, Namespace: namespace},
+			Type: PolicyIngress,
+			Matches: []Match{
+				{
+					Type:  MatchIngress,
+					Ports: []Port{{Protocol: TCP, Number: port}},
+				},
+			},
+		}
+	}
+	policyA := newPolicy("web", namespace1, 80)
+	policyA2 := newPolicy("web-tls", namespace1, 443)
+	policyB := newPolicy("web", namespace2, 80)
+	policyB2 := newPolicy("web-tls", namespace2, 443)
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(podA1, podA1IP)
+	cache.AddPodConfig(podA2, podA2IP)
+	cache.AddPodConfig(podA3, podA3IP)
+	cache.AddPodConfig(podB1, podB1IP)
+	cache.AddPodConfig(podB2, podB2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	clock := newFakeClock()
+	newConfigurator := func(renderer rendererAPI.PolicyRendererAPI, options ...Option) *PolicyConfigurator {
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, append(options, WithClock(clock))...)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Configure pods of both namespaces.
+		txn := configurator.NewTxn(true)
+		txn.Configure(podA1, []*ContivPolicy{policyA})
+		txn.Configure(podA2, []*ContivPolicy{policyA})
+		txn.Configure(podA3, []*ContivPolicy{policyA})
+		txn.Configure(podB1, []*ContivPolicy{policyB})
+		txn.Configure(podB2, []*ContivPolicy{policyB})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+		clock.Advance(period) /* debounced */
+		gomega.Expect(configurator.ConfiguredPods()).To(gomega.HaveLen(5))
+		return configurator
+	}
+	testTraffic := func(renderer *MockRenderer, pod podmodel.ID, podIP string, port uint16) TrafficAction {
+		return renderer.TestTraffic(pod, EgressTraffic,
+			parseIP("10.0.0.1"), parseIP(podIP), rendererAPI.TCP, 123, port)
+	}
+
+	// Scoped resync of the first namespace, mentioning also a pod
+	// of the other namespace.
+	renderer := &recordingRenderer{
+		MockRenderer: NewMockRenderer("A", logger),
+		rendered:     make(map[podmodel.ID]struct{}),
+	}
+	configurator := newConfigurator(renderer)
+	rulesB1Ingress, rulesB1Egress := renderer.GetRules(podB1)
+	renderer.rendered = make(map[podmodel.ID]struct{})
+	txn := configurator.NewScopedResyncTxn(namespace1)
+	txn.Configure(podA1, []*ContivPolicy{policyA2})
+	txn.Configure(podB1, []*ContivPolicy{policyB2})
+	err := txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Pods omitted in the namespace are torn down, other namespaces
+	// are not touched.
+	gomega.Expect(renderer.resyncs).To(gomega.Equal(1)) /* the initial one */
+	gomega.Expect(renderer.rendered).To(gomega.Equal(map[podmodel.ID]struct{}{
+		podA1: {}, podA2: {}, podA3: {},
+	}))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{podA1, podB1, podB2}))
+	gomega.Expect(testTraffic(renderer.MockRenderer, podA1, podA1IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(renderer.MockRenderer, podA1, podA1IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(renderer.MockRenderer, podA2, podA2IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	gomega.Expect(testTraffic(renderer.MockRenderer, podA3, podA3IP, 80)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	for _, pod := range []podmodel.ID{podB1, podB2} {
+		ingress, egress := renderer.GetRules(pod)
+		gomega.Expect(ingress).To(gomega.Equal(rulesB1Ingress))
+		gomega.Expect(egress).To(gomega.Equal(rulesB1Egress))
+	}
+
+	// Pending changes of the namespace merged with a scoped resync
+	// are overridden by the resync.
+	debounced := NewMockRenderer("B", logger)
+	configurator = newConfigurator(debounced, WithCommitDebounce(period))
+	txn = configurator.NewTxn(false)
+	txn.Configure(podA2, []*ContivPolicy{policyA2})
+	txn.Configure(podB2, []*ContivPolicy{policyB2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	txn = configurator.NewScopedResyncTxn(namespace1)
+	txn.Configure(podA1, []*ContivPolicy{policyA2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	clock.Advance(period)
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.Equal([]podmodel.ID{podA1, podB1, podB2}))
+	gomega.Expect(testTraffic(debounced, podA1, podA1IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(debounced, podA2, podA2IP, 443)).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	gomega.Expect(testTraffic(debounced, podB2, podB2IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(debounced, podB2, podB2IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+}
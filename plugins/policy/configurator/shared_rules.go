@@ -0,0 +1,66 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// SharedRules returns the committed rules of pod <a> which are identical
+// to rules of pod <b> in the same direction: ingress rules first, followed
+// by egress rules, each in the order of pod <a>. The returned rules are
+// the instances of pod <a>, which with WithSharedRules (the default) are
+// also the instances of pod <b> if both pods are configured with the same
+// policies. Returns nil if any of the pods is not configured.
+// Neither the configuration nor the rules are modified.
+func (pc *PolicyConfigurator) SharedRules(a, b podmodel.ID) []*renderer.ContivRule {
+	pc.Lock()
+	defer pc.Unlock()
+
+	aRules, aConfigured := pc.rules[a]
+	bRules, bConfigured := pc.rules[b]
+	if !aConfigured || !bConfigured {
+		return nil
+	}
+	shared := []*renderer.ContivRule{}
+	shared = appendSharedRules(shared, aRules.Ingress, bRules.Ingress)
+	shared = appendSharedRules(shared, aRules.Egress, bRules.Egress)
+	return shared
+}
+
+// appendSharedRules appends rules of <a> which are also in <b> (the same
+// instance or an equal one).
+func appendSharedRules(shared []*renderer.ContivRule, a, b ContivRules) []*renderer.ContivRule {
+	if sameRules(a, b) {
+		return append(shared, a...)
+	}
+	for _, rule := range a {
+		for _, other := range b {
+			if rule == other || rule.Compare(other) == 0 {
+				shared = append(shared, rule)
+				break
+			}
+		}
+	}
+	return shared
+}
+
+// sameRules returns true if both lists are backed by the same array of rules.
+func sameRules(a, b ContivRules) bool {
+	return len(a) > 0 && len(a) == len(b) && &a[0] == &b[0]
+}
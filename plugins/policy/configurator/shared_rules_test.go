@@ -0,0 +1,159 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestSharedRules(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSharedRules")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+		pod4IP    = "192.168.1.4"
+		pod5IP    = "192.168.1.5"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	pod3 := podmodel.ID{Name: "pod3", Namespace: namespace}
+	pod4 := podmodel.ID{Name: "pod4", Namespace: namespace}
+	pod5 := podmodel.ID{Name: "pod5", Namespace: namespace}
+
+	// ingress allowed from pod4 on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod4},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	// ingress allowed from pod5 on TCP:443
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod5},
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+	cache.AddPodConfig(pod4, pod4IP)
+	cache.AddPodConfig(pod5, pod5IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction: pod1 and pod2 configured identically,
+	// pod3 with a subset of the policies.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	txn.Configure(pod2, []*ContivPolicy{policy1, policy2})
+	txn.Configure(pod3, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Identically configured pods share all the rules by reference.
+	pod1Ingress, pod1Egress := renderer.GetRules(pod1)
+	pod2Ingress, pod2Egress := renderer.GetRules(pod2)
+	pod1Rules := append(append([]*rendererAPI.ContivRule{}, pod1Ingress...), pod1Egress...)
+	pod2Rules := append(append([]*rendererAPI.ContivRule{}, pod2Ingress...), pod2Egress...)
+	shared := configurator.SharedRules(pod1, pod2)
+	gomega.Expect(shared).To(gomega.HaveLen(len(pod1Rules)))
+	for idx, rule := range shared {
+		gomega.Expect(rule).To(gomega.BeIdenticalTo(pod1Rules[idx]))
+		gomega.Expect(rule).To(gomega.BeIdenticalTo(pod2Rules[idx]))
+	}
+
+	// Partially overlapping pods share only the common rules.
+	contains := func(rules []*rendererAPI.ContivRule, rule *rendererAPI.ContivRule) bool {
+		for _, other := range rules {
+			if other.Compare(rule) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	_, pod3Egress := renderer.GetRules(pod3)
+	shared = configurator.SharedRules(pod1, pod3)
+	gomega.Expect(shared).ToNot(gomega.BeEmpty())
+	gomega.Expect(len(shared)).To(gomega.BeNumerically("<", len(pod1Rules)))
+	for _, rule := range pod1Egress {
+		gomega.Expect(contains(shared, rule)).To(gomega.Equal(contains(pod3Egress, rule)), "rule %s", rule)
+	}
+	for _, rule := range shared {
+		gomega.Expect(rule.SrcNetwork.String()).ToNot(gomega.Equal(pod5IP + "/32"))
+	}
+	pod4Shared := false
+	for _, rule := range shared {
+		if rule.SrcNetwork.String() == pod4IP+"/32" {
+			pod4Shared = true
+			gomega.Expect(rule.DestPort).To(gomega.BeEquivalentTo(80))
+		}
+	}
+	gomega.Expect(pod4Shared).To(gomega.BeTrue())
+	gomega.Expect(configurator.SharedRules(pod3, pod1)).To(gomega.HaveLen(len(shared)))
+
+	// Pods without configuration do not share any rules.
+	gomega.Expect(configurator.SharedRules(pod1, pod4)).To(gomega.BeNil())
+}
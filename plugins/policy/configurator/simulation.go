@@ -0,0 +1,153 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// Flow is a 5-tuple describing a unidirectional flow of traffic.
+type Flow struct {
+	SrcIP    net.IP
+	DstIP    net.IP
+	Protocol ProtocolType
+	SrcPort  uint16 // 0 = any
+	DstPort  uint16
+}
+
+// String converts Flow into a human-readable string.
+func (f Flow) String() string {
+	return fmt.Sprintf("<%s:%d -> %s:%d %s>", f.SrcIP, f.SrcPort, f.DstIP, f.DstPort, f.Protocol)
+}
+
+// EvaluateFlow simulates the given flow against the committed configuration.
+// The flow is allowed if it is allowed by the (egress) rules of the source pod
+// and by the (ingress) rules of the destination pod, where either side may
+// also be outside of the configured pods and therefore unrestricted.
+func (pc *PolicyConfigurator) EvaluateFlow(flow Flow) (allowed bool) {
+	pc.Lock()
+	defer pc.Unlock()
+	return pc.evaluateFlow(flow)
+}
+
+// evaluateFlow implements EvaluateFlow with the configurator already locked.
+func (pc *PolicyConfigurator) evaluateFlow(flow Flow) (allowed bool) {
+	for pod, podIP := range pc.podIPAddresses {
+		rules, hasRules := pc.rules[pod]
+		if !hasRules {
+			continue
+		}
+		if podIP.IP.Equal(flow.SrcIP) && !evaluateRules(rules.Ingress, flow) {
+			// denied by egress of the source pod (= ingress of the vswitch)
+			return false
+		}
+		if podIP.IP.Equal(flow.DstIP) && !evaluateRules(rules.Egress, flow) {
+			// denied by ingress of the destination pod (= egress of the vswitch)
+			return false
+		}
+	}
+	return true
+}
+
+// AssertReachable checks against the committed configuration if
+// all the given pods are able to reach the target IP address on the given
+// protocol and port. Returns an error listing the pods that are not.
+func (pc *PolicyConfigurator) AssertReachable(from []podmodel.ID, to net.IP, proto ProtocolType, port uint16) error {
+	pc.Lock()
+	defer pc.Unlock()
+
+	unreachable := []string{}
+	for _, pod := range from {
+		podIP, err := pc.getPodIP(pod)
+		if err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s (%v)", pod, err))
+			continue
+		}
+		flow := Flow{SrcIP: podIP, DstIP: to, Protocol: proto, DstPort: port}
+		if !pc.evaluateFlow(flow) {
+			unreachable = append(unreachable, pod.String())
+		}
+	}
+	if len(unreachable) > 0 {
+		return fmt.Errorf("pods unable to reach %s on %s: %s",
+			to, Port{Protocol: proto, Number: port}, strings.Join(unreachable, ", "))
+	}
+	return nil
+}
+
+// getPodIP returns the IP address of a configured pod or from the cache.
+func (pc *PolicyConfigurator) getPodIP(pod podmodel.ID) (net.IP, error) {
+	if podIP, configured := pc.podIPAddresses[pod]; configured {
+		return podIP.IP, nil
+	}
+	found, podData := pc.Cache.LookupPod(pod)
+	if !found || podData.IpAddress == "" {
+		return nil, fmt.Errorf("pod has no IP address assigned")
+	}
+	podIP := net.ParseIP(podData.IpAddress)
+	if podIP == nil {
+		return nil, fmt.Errorf("pod has invalid IP address assigned")
+	}
+	return podIP, nil
+}
+
+// evaluateRules evaluates the flow against a list of rules.
+// The first matching rule decides; unmatched traffic is allowed.
+func evaluateRules(rules ContivRules, flow Flow) (allowed bool) {
+	for _, rule := range rules {
+		if ruleMatchesFlow(rule, flow) {
+			return rule.Action == renderer.ActionPermit
+		}
+	}
+	return true
+}
+
+// ruleMatchesFlow returns true if the rule matches the given flow.
+func ruleMatchesFlow(rule *renderer.ContivRule, flow Flow) bool {
+	if len(rule.SrcNetwork.IP) > 0 && !rule.SrcNetwork.Contains(flow.SrcIP) {
+		return false
+	}
+	if len(rule.DestNetwork.IP) > 0 && !rule.DestNetwork.Contains(flow.DstIP) {
+		return false
+	}
+	if rule.Protocol == renderer.ANY {
+		return true
+	}
+	if rule.Protocol != rendererProtocol(flow.Protocol) {
+		return false
+	}
+	if rule.SrcPort != 0 && rule.SrcPort != flow.SrcPort {
+		return false
+	}
+	if rule.DestPort != 0 && rule.DestPort != flow.DstPort {
+		return false
+	}
+	return true
+}
+
+// rendererProtocol converts configurator protocol into the renderer protocol.
+func rendererProtocol(protocol ProtocolType) renderer.ProtocolType {
+	if protocol == TCP {
+		return renderer.TCP
+	}
+	return renderer.UDP
+}
@@ -0,0 +1,150 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestAssertReachable(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestAssertReachable")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		app1Name  = "app1"
+		app2Name  = "app2"
+		app3Name  = "app3"
+		app4Name  = "app4" /* not created */
+		dbName    = "db"
+		app1IP    = "192.168.1.1"
+		app2IP    = "192.168.1.2"
+		app3IP    = "192.168.1.3"
+		dbIP      = "192.168.2.1"
+	)
+	app1 := podmodel.ID{Name: app1Name, Namespace: namespace}
+	app2 := podmodel.ID{Name: app2Name, Namespace: namespace}
+	app3 := podmodel.ID{Name: app3Name, Namespace: namespace}
+	app4 := podmodel.ID{Name: app4Name, Namespace: namespace}
+	db := podmodel.ID{Name: dbName, Namespace: namespace}
+
+	// database accessible from app1, app2 and app3
+	dbPolicy := &ContivPolicy{
+		ID:   policymodel.ID{Name: "db", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{
+					app1, app2, app3,
+				},
+				Ports: []Port{
+					{Protocol: TCP, Number: 5432},
+				},
+			},
+		},
+	}
+
+	// app3 can only access the web
+	webOnlyPolicy := &ContivPolicy{
+		ID:   policymodel.ID{Name: "web-only", Namespace: namespace},
+		Type: PolicyEgress,
+		Matches: []Match{
+			{
+				Type: MatchEgress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(app1, app1IP)
+	cache.AddPodConfig(app2, app2IP)
+	cache.AddPodConfig(app3, app3IP)
+	cache.AddPodConfig(db, dbIP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Run single transaction.
+	txn := configurator.NewTxn(false)
+	txn.Configure(db, []*ContivPolicy{dbPolicy})
+	txn.Configure(app3, []*ContivPolicy{webOnlyPolicy})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// App1 and app2 can reach the database.
+	err = configurator.AssertReachable([]podmodel.ID{app1, app2}, net.ParseIP(dbIP), TCP, 5432)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// But not on any other port.
+	err = configurator.AssertReachable([]podmodel.ID{app1, app2}, net.ParseIP(dbIP), TCP, 5433)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(app1.String()))
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(app2.String()))
+
+	// App3 is blocked by its own egress policy, app4 has no IP address.
+	err = configurator.AssertReachable([]podmodel.ID{app1, app2, app3, app4}, net.ParseIP(dbIP), TCP, 5432)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).ToNot(gomega.ContainSubstring(app1.String()))
+	gomega.Expect(err.Error()).ToNot(gomega.ContainSubstring(app2.String()))
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(app3.String()))
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(app4.String()))
+
+	// Traffic outside of configured pods is not restricted.
+	err = configurator.AssertReachable([]podmodel.ID{app1, app2}, net.ParseIP("8.8.8.8"), UDP, 53)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.AssertReachable([]podmodel.ID{app3}, net.ParseIP("8.8.8.8"), TCP, 80)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.AssertReachable([]podmodel.ID{app3}, net.ParseIP("8.8.8.8"), UDP, 53)
+	gomega.Expect(err).ToNot(gomega.BeNil())
+}
@@ -0,0 +1,177 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// snapshotVersion is the version of the format produced by Snapshot().
+const snapshotVersion = 1
+
+// configSnapshot is the committed configuration as serialized by Snapshot().
+type configSnapshot struct {
+	Version      int
+	Pods         []podSnapshot
+	Toggles      []policyToggle
+	LastApplySeq uint64
+}
+
+// podSnapshot is the committed configuration of a single pod.
+type podSnapshot struct {
+	Pod            podmodel.ID
+	Policies       []*ContivPolicy
+	Retained       []policymodel.ID   // pinned policies retained only because of the pin
+	ExclusiveOrder []appliedExclusive // order of applied exclusive policies
+}
+
+// appliedExclusive is the order in which an exclusive policy was applied.
+type appliedExclusive struct {
+	Policy policymodel.ID
+	Seq    uint64
+}
+
+// policyToggle is the state of a policy set by SetPolicyEnabled().
+type policyToggle struct {
+	Policy  policymodel.ID
+	Enabled bool
+}
+
+// Snapshot serializes the complete committed configuration: policies
+// of all pods together with the state remembered between transactions
+// (policies toggled by SetPolicyEnabled, pinned policies retained, order
+// of applied exclusive policies). The output is JSON, sorted by pod and policy
+// IDs, and can be loaded by Restore(), possibly into another configurator.
+func (pc *PolicyConfigurator) Snapshot() ([]byte, error) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	snapshot := configSnapshot{Version: snapshotVersion, LastApplySeq: pc.lastApplySeq}
+	for pod, policies := range pc.config {
+		podSnap := podSnapshot{Pod: pod, Policies: policies.Copy()}
+		sort.Sort(ContivPolicies(podSnap.Policies))
+		for policy := range pc.retainedPolicies[pod] {
+			podSnap.Retained = append(podSnap.Retained, policy)
+		}
+		sortPolicyIDs(podSnap.Retained)
+		for policy, seq := range pc.appliedAt[pod] {
+			podSnap.ExclusiveOrder = append(podSnap.ExclusiveOrder, appliedExclusive{Policy: policy, Seq: seq})
+		}
+		sort.Slice(podSnap.ExclusiveOrder, func(i, j int) bool {
+			return podSnap.ExclusiveOrder[i].Seq < podSnap.ExclusiveOrder[j].Seq
+		})
+		snapshot.Pods = append(snapshot.Pods, podSnap)
+	}
+	sort.Slice(snapshot.Pods, func(i, j int) bool {
+		if snapshot.Pods[i].Pod.Namespace != snapshot.Pods[j].Pod.Namespace {
+			return snapshot.Pods[i].Pod.Namespace < snapshot.Pods[j].Pod.Namespace
+		}
+		return snapshot.Pods[i].Pod.Name < snapshot.Pods[j].Pod.Name
+	})
+	for policy, enabled := range pc.policyToggles {
+		snapshot.Toggles = append(snapshot.Toggles, policyToggle{Policy: policy, Enabled: enabled})
+	}
+	sort.Slice(snapshot.Toggles, func(i, j int) bool {
+		return policyIDLess(snapshot.Toggles[i].Policy, snapshot.Toggles[j].Policy)
+	})
+	return json.Marshal(snapshot)
+}
+
+// Restore replaces the committed configuration with the one serialized
+// by Snapshot(). The configuration is applied by a resync transaction, i.e.
+// the rules of all pods are rebuilt and re-rendered.
+// Returns ErrReadOnly if the configurator is in the read-only mode.
+func (pc *PolicyConfigurator) Restore(data []byte) error {
+	snapshot := configSnapshot{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("invalid configurator snapshot: %v", err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return fmt.Errorf("unsupported version of configurator snapshot: %d", snapshot.Version)
+	}
+	policyLists := make([]ContivPolicies, 0, len(snapshot.Pods))
+	for _, podSnap := range snapshot.Pods {
+		policyLists = append(policyLists, podSnap.Policies)
+	}
+	pc.prefetchFQDNs(policyLists)
+
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.readOnly {
+		pc.Log.Warn("Refusing to restore policies, the configurator is read-only")
+		return ErrReadOnly
+	}
+	pc.Log.WithField("pods", len(snapshot.Pods)).Info("Restoring configurator snapshot")
+
+	// State remembered between transactions is restored before the commit,
+	// which then takes it into account.
+	pc.policyToggles = make(map[policymodel.ID]bool)
+	for _, toggle := range snapshot.Toggles {
+		pc.policyToggles[toggle.Policy] = toggle.Enabled
+	}
+	pc.appliedAt = make(map[podmodel.ID]map[policymodel.ID]uint64)
+	pc.lastApplySeq = snapshot.LastApplySeq
+	for _, podSnap := range snapshot.Pods {
+		for _, applied := range podSnap.ExclusiveOrder {
+			if pc.appliedAt[podSnap.Pod] == nil {
+				pc.appliedAt[podSnap.Pod] = make(map[policymodel.ID]uint64)
+			}
+			pc.appliedAt[podSnap.Pod][applied.Policy] = applied.Seq
+		}
+	}
+
+	txn := pc.NewTxn(true).(*PolicyConfiguratorTxn)
+	for _, podSnap := range snapshot.Pods {
+		txn.configure(podSnap.Pod, podSnap.Policies)
+	}
+	err := txn.commit()
+
+	// Retained policies are recognized by the commit only for policies
+	// committed before, hence they are restored afterwards.
+	for _, podSnap := range snapshot.Pods {
+		for _, policy := range podSnap.Retained {
+			if pc.config[podSnap.Pod].lookup(policy) == nil {
+				continue
+			}
+			if pc.retainedPolicies[podSnap.Pod] == nil {
+				pc.retainedPolicies[podSnap.Pod] = make(map[policymodel.ID]struct{})
+			}
+			pc.retainedPolicies[podSnap.Pod][policy] = struct{}{}
+		}
+	}
+	return err
+}
+
+// sortPolicyIDs sorts the policy IDs by namespace and name.
+func sortPolicyIDs(ids []policymodel.ID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return policyIDLess(ids[i], ids[j])
+	})
+}
+
+// policyIDLess compares policy IDs by namespace and name.
+func policyIDLess(id1, id2 policymodel.ID) bool {
+	if id1.Namespace != id2.Namespace {
+		return id1.Namespace < id2.Namespace
+	}
+	return id1.Name < id2.Name
+}
@@ -0,0 +1,239 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSnapshotRestore")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		pod3IP     = "192.168.1.3"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	pod3 := podmodel.ID{Name: "pod3", Namespace: namespace}
+
+	// ingress allowed on TCP:80 from 10.0.0.0/8 except 10.1.0.0/16
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				IPBlocks: []IPBlock{
+					{
+						Network: parseIPNet("10.0.0.0/8"),
+						Except:  []net.IPNet{parseIPNet("10.1.0.0/16")},
+					},
+				},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// pinned policy, egress allowed to pod1
+	policy2 := &ContivPolicy{
+		ID:     policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type:   PolicyEgress,
+		Pinned: true,
+		Matches: []Match{
+			{
+				Type: MatchEgress,
+				Pods: []podmodel.ID{pod1},
+			},
+		},
+	}
+
+	// policy to be disabled, ingress allowed on UDP:53
+	policy3 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy3", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: UDP, Number: 53}},
+			},
+		},
+	}
+
+	// exclusive profiles
+	profile := func(name string, port uint16) *ContivPolicy {
+		return &ContivPolicy{
+			ID:        policymodel.ID{Name: name, Namespace: namespace},
+			Type:      PolicyIngress,
+			Group:     "environment",
+			Exclusive: true,
+			Matches: []Match{
+				{
+					Type:  MatchIngress,
+					Ports: []Port{{Protocol: TCP, Number: port}},
+				},
+			},
+		}
+	}
+	profileA := profile("profile-a", 8080)
+	profileB := profile("profile-b", 9090)
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	newConfigurator := func(renderer *MockRenderer) *PolicyConfigurator {
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator
+	}
+
+	// Build the original configuration.
+	renderer1 := NewMockRenderer("A", logger)
+	configurator1 := newConfigurator(renderer1)
+
+	txn := configurator1.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, profileB})
+	txn.Configure(pod2, []*ContivPolicy{policy2})
+	txn.Configure(pod3, []*ContivPolicy{policy1, policy3})
+	err := txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	txn = configurator1.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, profileB, profileA}) /* profile-a applied last */
+	txn.Configure(pod2, []*ContivPolicy{})                            /* policy2 retained by the pin */
+	txn.SetPolicyEnabled(policy3.ID, false)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	data, err := configurator1.Snapshot()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Restore into a new instance.
+	renderer2 := NewMockRenderer("B", logger)
+	configurator2 := newConfigurator(renderer2)
+	err = configurator2.Restore(data)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Identical committed state.
+	data2, err := configurator2.Snapshot()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(string(data2)).To(gomega.Equal(string(data)))
+	gomega.Expect(configurator2.ConfiguredPods()).To(gomega.ConsistOf(pod1, pod2, pod3))
+
+	// Identical rules.
+	for _, pod := range []podmodel.ID{pod1, pod2, pod3} {
+		ingress1, egress1 := renderer1.GetRules(pod)
+		ingress2, egress2 := renderer2.GetRules(pod)
+		gomega.Expect(ingress2).To(gomega.Equal(ingress1))
+		gomega.Expect(egress2).To(gomega.Equal(egress1))
+	}
+	gomega.Expect(renderer2.TestTraffic(pod1, EgressTraffic,
+		parseIP(externalIP), parseIP(pod1IP), rendererAPI.TCP, 123, 8080)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(renderer2.TestTraffic(pod1, EgressTraffic,
+		parseIP(externalIP), parseIP(pod1IP), rendererAPI.TCP, 123, 9090)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(renderer2.TestTraffic(pod3, EgressTraffic,
+		parseIP(externalIP), parseIP(pod3IP), rendererAPI.UDP, 123, 53)).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// The restored state is effective in the following transactions.
+	txn = configurator2.NewTxn(false)
+	txn.UnpinPolicy(policy2.ID)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	ingress, egress := renderer2.GetRules(pod2)
+	gomega.Expect(ingress).To(gomega.BeEmpty())
+	gomega.Expect(egress).To(gomega.BeEmpty())
+
+	// Restore replaces the configuration.
+	err = configurator2.Restore(data)
+	gomega.Expect(err).To(gomega.BeNil())
+	data2, err = configurator2.Snapshot()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(string(data2)).To(gomega.Equal(string(data)))
+
+	// Invalid snapshots.
+	err = configurator2.Restore([]byte("{"))
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	err = configurator2.Restore([]byte(`{"Version": 2}`))
+	gomega.Expect(err).ToNot(gomega.BeNil())
+}
+
+func TestIPJSON(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	block := IPBlock{
+		Network: parseIPNet("10.0.0.0/8"),
+		Except:  []net.IPNet{parseIPNet("10.1.0.0/16"), parseIPNet("fd00::/64")},
+	}
+	data, err := json.Marshal(block)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(string(data)).To(gomega.Equal(
+		`{"Network":"10.0.0.0/ff000000","Except":["10.1.0.0/ffff0000","fd00::/ffffffffffffffff0000000000000000"]}`))
+	decoded := IPBlock{}
+	err = json.Unmarshal(data, &decoded)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(decoded).To(gomega.Equal(block))
+
+	mask := IPMask{Address: net.ParseIP("10.0.0.1").To4(), Mask: net.IPv4Mask(255, 0, 0, 255)}
+	data, err = json.Marshal(mask)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(string(data)).To(gomega.Equal(`"10.0.0.1/ff0000ff"`))
+	decodedMask := IPMask{}
+	err = json.Unmarshal(data, &decodedMask)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(decodedMask).To(gomega.Equal(mask))
+
+	for _, invalid := range []string{`"10.0.0.1"`, `"10.0.0.1/ff"`, `"fd00::1/ffffffff"`, `"x/ffffffff"`} {
+		err = json.Unmarshal([]byte(invalid), &decodedMask)
+		gomega.Expect(err).ToNot(gomega.BeNil())
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithStrictSourcePorts selects how source ports (Match.SourcePorts) are
+// handled for renderers without the renderer.SourcePortMatch capability.
+// By default the source ports are not passed to such renderers and
+// the traffic is matched regardless of the source port number (but still
+// only for the protocol of the source port). With strict source ports,
+// the commit fails instead.
+func WithStrictSourcePorts(strict bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.strictSourcePorts = strict
+	}
+}
+
+// sourcePortRules returns copies of the rule restricted to each of the given
+// source ports. A rule matching any protocol is narrowed down to the protocol
+// of the source port, rules of other protocols are not combined with the port.
+func sourcePortRules(rule *renderer.ContivRule, srcPorts []Port) []*renderer.ContivRule {
+	var rules []*renderer.ContivRule
+	for _, port := range srcPorts {
+		protocol := rendererProtocol(port.Protocol)
+		if rule.Protocol != renderer.ANY && rule.Protocol != protocol {
+			continue
+		}
+		srcPortRule := rule.Copy()
+		srcPortRule.Protocol = protocol
+		srcPortRule.SrcPort = port.Number
+		rules = append(rules, srcPortRule)
+	}
+	return rules
+}
+
+// withoutSourcePorts returns the rules with source ports removed. Rules which
+// become duplicates are skipped. If none of the rules is restricted by source
+// port, the same list is returned.
+func withoutSourcePorts(rules ContivRules) ContivRules {
+	return withoutRuleFeature(rules,
+		func(rule *renderer.ContivRule) bool { return rule.SrcPort != 0 },
+		func(rule *renderer.ContivRule) { rule.SrcPort = 0 })
+}
+
+// hasSourcePorts returns true if any of the rules is restricted by source port.
+func hasSourcePorts(rules ContivRules) bool {
+	for _, rule := range rules {
+		if rule.SrcPort != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestSourcePorts(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSourcePorts")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed from pod2 TCP:1024 to TCP:80 (UDP:53 has no source
+	// port of the same protocol) and from anywhere with UDP source port 53
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:        MatchIngress,
+				Pods:        []podmodel.ID{pod2},
+				Ports:       []Port{{Protocol: TCP, Number: 80}, {Protocol: UDP, Number: 53}},
+				SourcePorts: []Port{{Protocol: TCP, Number: 1024}},
+			},
+			{
+				Type:        MatchIngress,
+				SourcePorts: []Port{{Protocol: UDP, Number: 53}},
+			},
+		},
+	}
+	gomega.Expect(policy1.Matches[0].String()).To(gomega.ContainSubstring(", SourcePorts:[TCP:1024]"))
+	gomega.Expect(policy1.Matches[1].String()).To(gomega.ContainSubstring(", SourcePorts:[UDP:53]"))
+	gomega.Expect(policy1.Matches[0].DeepCopy().SourcePorts).To(gomega.Equal(policy1.Matches[0].SourcePorts))
+
+	for _, strict := range []bool{false, true} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+		cache.AddPodConfig(pod3, pod3IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer1 := NewMockRenderer("A", logger)
+		renderer1.SetCapabilities(rendererAPI.SourcePortMatch)
+		renderer2 := NewMockRenderer("B", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithStrictSourcePorts(strict))
+
+		// Register two renderers.
+		err := configurator.RegisterRenderer(renderer1)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(renderer2)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		if strict {
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("SOURCE-PORT-MATCH"))
+		} else {
+			gomega.Expect(err).To(gomega.BeNil())
+		}
+
+		// Renderer with the capability receives the source ports combined
+		// with the destination ports of the same protocol.
+		_, egress := renderer1.GetRules(pod1)
+		var srcPortRules []*rendererAPI.ContivRule
+		for _, rule := range egress {
+			if rule.SrcPort != 0 {
+				srcPortRules = append(srcPortRules, rule)
+				gomega.Expect(rule.RequiredCapabilities()).To(gomega.ConsistOf(rendererAPI.SourcePortMatch))
+			}
+		}
+		gomega.Expect(srcPortRules).To(gomega.HaveLen(2))
+		for _, rule := range srcPortRules {
+			if rule.Protocol == rendererAPI.TCP {
+				gomega.Expect(rule.SrcNetwork.String()).To(gomega.Equal(pod2IP + "/32"))
+				gomega.Expect(rule.SrcPort).To(gomega.BeEquivalentTo(1024))
+				gomega.Expect(rule.DestPort).To(gomega.BeEquivalentTo(80))
+			} else {
+				gomega.Expect(rule.Protocol).To(gomega.Equal(rendererAPI.UDP))
+				gomega.Expect(rule.SrcPort).To(gomega.BeEquivalentTo(53))
+				gomega.Expect(rule.DestPort).To(gomega.BeEquivalentTo(0))
+			}
+		}
+
+		for _, traffic := range []struct {
+			srcIP   string
+			proto   rendererAPI.ProtocolType
+			srcPort uint16
+			dstPort uint16
+			action  TrafficAction
+		}{
+			{pod2IP, rendererAPI.TCP, 1024, 80, AllowedTraffic},
+			{pod2IP, rendererAPI.TCP, 1025, 80, DeniedTraffic},
+			{pod2IP, rendererAPI.UDP, 1024, 53, DeniedTraffic},
+			{pod3IP, rendererAPI.TCP, 1024, 80, DeniedTraffic},
+			{pod3IP, rendererAPI.UDP, 53, 5000, AllowedTraffic},
+			{pod3IP, rendererAPI.UDP, 54, 5000, DeniedTraffic},
+		} {
+			action := renderer1.TestTraffic(pod1, EgressTraffic,
+				parseIP(traffic.srcIP), parseIP(pod1IP), traffic.proto, traffic.srcPort, traffic.dstPort)
+			gomega.Expect(action).To(gomega.BeEquivalentTo(traffic.action))
+		}
+
+		if strict {
+			// Renderer without the capability is not given any rules.
+			ingress, egress := renderer2.GetRules(pod1)
+			gomega.Expect(ingress).To(gomega.BeEmpty())
+			gomega.Expect(egress).To(gomega.BeEmpty())
+			continue
+		}
+
+		// Renderer without the capability receives the rules without
+		// the source ports.
+		_, egress = renderer2.GetRules(pod1)
+		gomega.Expect(egress).ToNot(gomega.BeEmpty())
+		for _, rule := range egress {
+			gomega.Expect(rule.SrcPort).To(gomega.BeEquivalentTo(0))
+		}
+		action := renderer2.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 1025, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = renderer2.TestTraffic(pod1, EgressTraffic,
+			parseIP(pod3IP), parseIP(pod1IP), rendererAPI.TCP, 1024, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	}
+}
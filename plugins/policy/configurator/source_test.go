@@ -0,0 +1,266 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestRemoveBySource(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestRemoveBySource")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+		sourceA   = "controllerA"
+		sourceB   = "controllerB"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	policyA := &ContivPolicy{
+		ID:     policymodel.ID{Name: "policyA", Namespace: namespace},
+		Type:   PolicyIngress,
+		Source: sourceA,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+	policyB := &ContivPolicy{
+		ID:     policymodel.ID{Name: "policyB", Namespace: namespace},
+		Type:   PolicyIngress,
+		Source: sourceB,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 443},
+				},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Configure policies from both sources.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policyA, policyB})
+	txn.Configure(pod2, []*ContivPolicy{policyA})
+	txn.Configure(pod3, []*ContivPolicy{policyB})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	action := renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Remove everything contributed by controller A.
+	txn = configurator.NewTxn(false)
+	txn.RemoveBySource(sourceA)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Pod1 retains policyB only.
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Pod2 is left with no policies -> unrestricted.
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	ip, _ := renderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+
+	// Pod3 is not affected.
+	action = renderer.TestTraffic(pod3, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod3IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod3, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod3IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Policies staged in the same transaction are removed as well.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod3, []*ContivPolicy{policyA, policyB})
+	txn.RemoveBySource(sourceB)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	action = renderer.TestTraffic(pod3, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod3IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod3, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod3IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+}
+
+func TestSameIDFromDifferentSources(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSameIDFromDifferentSources")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	policyID := policymodel.ID{Name: "web", Namespace: namespace}
+
+	// The same policy ID contributed by two sources with different content.
+	policyA := &ContivPolicy{
+		ID:     policyID,
+		Type:   PolicyIngress,
+		Source: "controllerA",
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+	policyB := &ContivPolicy{
+		ID:     policyID,
+		Type:   PolicyIngress,
+		Source: "controllerB",
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 443},
+				},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Each pod gets the policy from a different source.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policyA})
+	txn.Configure(pod2, []*ContivPolicy{policyB})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Pod2 must not reuse the rules generated for pod1.
+	action := renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Lists of same-ID policies from different sources are not equal.
+	gomega.Expect(ContivPolicies{policyA}.Equals(ContivPolicies{policyB})).To(gomega.BeFalse())
+	gomega.Expect(ContivPolicies{policyA}.Equals(ContivPolicies{policyA})).To(gomega.BeTrue())
+}
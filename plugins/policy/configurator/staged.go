@@ -0,0 +1,35 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// StagedPods returns configuration staged by Configure() in this transaction
+// (not yet committed). Pods not included are, for non-resync transactions,
+// left with the committed configuration, whereas resync transactions will
+// un-configure them. Removals requested by RemoveBySource() are only evaluated
+// during Commit() and therefore not reflected.
+// The returned policies are deep copies, safe to inspect or modify.
+func (pct *PolicyConfiguratorTxn) StagedPods() map[podmodel.ID][]*ContivPolicy {
+	staged := make(map[podmodel.ID][]*ContivPolicy, len(pct.config))
+	for pod, policies := range pct.config {
+		staged[pod] = deepCopyPolicies(policies)
+	}
+	return staged
+}
@@ -0,0 +1,130 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestStagedPods(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestStagedPods")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{pod2},
+				IPBlocks: []IPBlock{
+					{
+						Network: *ipNetwork("10.0.0.0/8"),
+						Except:  []net.IPNet{*ipNetwork("10.1.0.0/16")},
+					},
+				},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Nothing staged yet.
+	txn := configurator.NewTxn(false)
+	gomega.Expect(txn.StagedPods()).To(gomega.BeEmpty())
+
+	// Stage configuration for both pods.
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{})
+	staged := txn.StagedPods()
+	gomega.Expect(staged).To(gomega.HaveLen(2))
+	gomega.Expect(staged[pod1]).To(gomega.HaveLen(1))
+	gomega.Expect(*staged[pod1][0]).To(gomega.Equal(*policy1))
+	gomega.Expect(staged[pod2]).To(gomega.BeEmpty())
+
+	// Returned policies are copies.
+	staged[pod1][0].Type = PolicyEgress
+	staged[pod1][0].Matches[0].Pods[0] = pod1
+	staged[pod1][0].Matches[0].IPBlocks[0].Network.IP[0] = 11
+	staged[pod1][0].Matches[0].Ports[0].Number = 8080
+	delete(staged, pod2)
+	gomega.Expect(policy1.Type).To(gomega.BeEquivalentTo(PolicyIngress))
+	gomega.Expect(policy1.Matches[0].Pods[0]).To(gomega.Equal(pod2))
+	gomega.Expect(policy1.Matches[0].IPBlocks[0].Network.String()).To(gomega.Equal("10.0.0.0/8"))
+	gomega.Expect(policy1.Matches[0].Ports[0].Number).To(gomega.BeEquivalentTo(80))
+	gomega.Expect(txn.StagedPods()).To(gomega.HaveLen(2))
+
+	// Re-configuring a pod replaces the staged configuration.
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	gomega.Expect(txn.StagedPods()[pod2]).To(gomega.HaveLen(1))
+
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Committed configuration is not staged in a new transaction.
+	txn = configurator.NewTxn(false)
+	gomega.Expect(txn.StagedPods()).To(gomega.BeEmpty())
+}
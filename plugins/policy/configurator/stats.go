@@ -0,0 +1,140 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// ConfiguratorStats is a snapshot of the committed state of the configurator.
+type ConfiguratorStats struct {
+	// Pods is the number of pods with committed configuration.
+	Pods int
+
+	// Policies is the number of distinct policies committed for at least
+	// one pod, PolicyAssignments the number of pod-policy pairs.
+	Policies          int
+	PolicyAssignments int
+
+	// IngressRules and EgressRules are the numbers of rules currently
+	// installed for the ingress and the egress of all pods (from the pod
+	// point of view, i.e. vswitch egress and ingress, respectively).
+	IngressRules int
+	EgressRules  int
+
+	// CachedPods and CachedPolicies are the numbers of pods and policies
+	// held by the policy cache (Deps.Cache).
+	CachedPods     int
+	CachedPolicies int
+}
+
+// Stats returns statistics of the committed state. The counters are
+// maintained by the commits, the method does not wait for an ongoing commit
+// to finish and returns the state after the last one.
+func (pc *PolicyConfigurator) Stats() ConfiguratorStats {
+	pc.statsLock.Lock()
+	stats := pc.stats
+	pc.statsLock.Unlock()
+	stats.CachedPods = len(pc.Cache.ListAllPods())
+	stats.CachedPolicies = len(pc.Cache.ListAllPolicies())
+	return stats
+}
+
+// RegisterStatsGauges registers gauges reporting Stats() with the given
+// Prometheus registerer. The gauges are evaluated on every scrape.
+func (pc *PolicyConfigurator) RegisterStatsGauges(registerer prometheus.Registerer) error {
+	gauges := []struct {
+		name  string
+		help  string
+		value func(stats ConfiguratorStats) int
+	}{
+		{"policy_configured_pods", "Number of pods with committed policy configuration",
+			func(stats ConfiguratorStats) int { return stats.Pods }},
+		{"policy_committed_policies", "Number of distinct policies committed for at least one pod",
+			func(stats ConfiguratorStats) int { return stats.Policies }},
+		{"policy_assignments", "Number of policies committed for pods, summed over the pods",
+			func(stats ConfiguratorStats) int { return stats.PolicyAssignments }},
+		{"policy_ingress_rules", "Number of rules installed for the ingress of pods",
+			func(stats ConfiguratorStats) int { return stats.IngressRules }},
+		{"policy_egress_rules", "Number of rules installed for the egress of pods",
+			func(stats ConfiguratorStats) int { return stats.EgressRules }},
+		{"policy_cached_pods", "Number of pods held by the policy cache",
+			func(stats ConfiguratorStats) int { return stats.CachedPods }},
+		{"policy_cached_policies", "Number of policies held by the policy cache",
+			func(stats ConfiguratorStats) int { return stats.CachedPolicies }},
+	}
+	for _, gauge := range gauges {
+		value := gauge.value
+		err := registerer.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: gauge.name,
+			Help: gauge.help,
+		}, func() float64 {
+			return float64(value(pc.Stats()))
+		}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveStats updates the statistics with the changes of the transaction.
+// It is expected to be called before the changes are saved to the configurator.
+func (pct *PolicyConfiguratorTxn) saveStats() {
+	pc := pct.configurator
+	pc.statsLock.Lock()
+	defer pc.statsLock.Unlock()
+	if pct.resync {
+		pc.stats = ConfiguratorStats{}
+		pc.policyRefs = make(map[policymodel.ID]int)
+	} else {
+		for pod := range pct.config {
+			if policies, committed := pc.config[pod]; committed {
+				pc.countPod(policies, pc.rules[pod], -1)
+			}
+		}
+	}
+	for pod, policies := range pct.config {
+		if _, hasIPAddr := pct.podIPAddresses[pod]; hasIPAddr {
+			pc.countPod(policies, pct.rules[pod], 1)
+		}
+	}
+}
+
+// countPod adds (sign=1) or subtracts (sign=-1) committed configuration
+// of a pod to/from the statistics.
+func (pc *PolicyConfigurator) countPod(policies ContivPolicies, rules PodRules, sign int) {
+	pc.stats.Pods += sign
+	pc.stats.PolicyAssignments += sign * len(policies)
+	pc.stats.IngressRules += sign * len(rules.Egress)
+	pc.stats.EgressRules += sign * len(rules.Ingress)
+	for _, policy := range policies {
+		refs := pc.policyRefs[policy.ID] + sign
+		switch {
+		case refs == 0:
+			delete(pc.policyRefs, policy.ID)
+			pc.stats.Policies--
+		case refs == 1 && sign > 0:
+			pc.policyRefs[policy.ID] = refs
+			pc.stats.Policies++
+		default:
+			pc.policyRefs[policy.ID] = refs
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestStats(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestStats")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	newPolicy := func(name string, policyType PolicyType, matchType MatchType, port uint16) *ContivPolicy {
+		return &ContivPolicy{
+			ID:   policymodel.ID{Name: name, Namespace: namespace},
+			Type: policyType,
+			Matches: []Match{
+				{
+					Type:  matchType,
+					Ports: []Port{{Protocol: TCP, Number: port}},
+				},
+			},
+		}
+	}
+	policy1 := newPolicy("policy1", PolicyIngress, MatchIngress, 80)
+	policy2 := newPolicy("policy2", PolicyEgress, MatchEgress, 53)
+	policy3 := newPolicy("policy3", PolicyIngress, MatchIngress, 443)
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	registry := prometheus.NewRegistry()
+	err = configurator.RegisterStatsGauges(registry)
+	gomega.Expect(err).To(gomega.BeNil())
+	gauge := func(name string) float64 {
+		families, err := registry.Gather()
+		gomega.Expect(err).To(gomega.BeNil())
+		for _, family := range families {
+			if family.GetName() == name {
+				return family.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		return -1
+	}
+
+	// expectedStats computes the statistics from the rules installed
+	// in the renderer.
+	expectedStats := func(policies int, configured map[podmodel.ID]int) ConfiguratorStats {
+		stats := ConfiguratorStats{Policies: policies, CachedPods: 3}
+		for pod, assignments := range configured {
+			stats.Pods++
+			stats.PolicyAssignments += assignments
+			ingress, egress := renderer.GetRules(pod)
+			stats.IngressRules += len(egress)
+			stats.EgressRules += len(ingress)
+		}
+		return stats
+	}
+
+	// Nothing is configured initially.
+	gomega.Expect(configurator.Stats()).To(gomega.Equal(ConfiguratorStats{CachedPods: 3}))
+	gomega.Expect(gauge("policy_configured_pods")).To(gomega.BeEquivalentTo(0))
+	gomega.Expect(gauge("policy_cached_pods")).To(gomega.BeEquivalentTo(3))
+
+	// Configure two pods.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	stats := configurator.Stats()
+	gomega.Expect(stats).To(gomega.Equal(expectedStats(2, map[podmodel.ID]int{pod1: 2, pod2: 1})))
+	gomega.Expect(stats.IngressRules).To(gomega.BeNumerically(">", 0))
+	gomega.Expect(stats.EgressRules).To(gomega.BeNumerically(">", 0))
+	gomega.Expect(gauge("policy_configured_pods")).To(gomega.BeEquivalentTo(2))
+	gomega.Expect(gauge("policy_committed_policies")).To(gomega.BeEquivalentTo(2))
+	gomega.Expect(gauge("policy_assignments")).To(gomega.BeEquivalentTo(3))
+	gomega.Expect(gauge("policy_ingress_rules")).To(gomega.BeEquivalentTo(stats.IngressRules))
+	gomega.Expect(gauge("policy_egress_rules")).To(gomega.BeEquivalentTo(stats.EgressRules))
+
+	// Change policies of one pod and configure another one.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod2, []*ContivPolicy{})
+	txn.Configure(pod3, []*ContivPolicy{policy3})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.Stats()).To(gomega.Equal(
+		expectedStats(3, map[podmodel.ID]int{pod1: 2, pod2: 0, pod3: 1})))
+
+	// Remove a pod.
+	cache.AddPodConfig(pod1, "") /* IP released */
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1, policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.Stats()).To(gomega.Equal(
+		expectedStats(1, map[podmodel.ID]int{pod2: 0, pod3: 1})))
+
+	// Resync replaces everything.
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod2, []*ContivPolicy{policy1, policy3})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.Stats()).To(gomega.Equal(
+		expectedStats(2, map[podmodel.ID]int{pod2: 2})))
+	gomega.Expect(gauge("policy_configured_pods")).To(gomega.BeEquivalentTo(1))
+
+	// Stats are safe to read concurrently with commits.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			configurator.Stats()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		txn = configurator.NewTxn(false)
+		txn.Configure(pod3, []*ContivPolicy{policy3})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+	}
+	<-done
+	gomega.Expect(configurator.Stats().Pods).To(gomega.Equal(2))
+}
@@ -0,0 +1,39 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import "time"
+
+// LastCommitStatus returns the time and the outcome of the most recent commit,
+// including those triggered internally (e.g. by DNS changes or delayed
+// teardowns). The error is nil if the commit fully succeeded across all
+// renderers. Zero time is returned if nothing was committed yet.
+// The method does not wait for an ongoing commit to finish and can be
+// therefore used by health probes.
+func (pc *PolicyConfigurator) LastCommitStatus() (time.Time, error) {
+	pc.statusLock.Lock()
+	defer pc.statusLock.Unlock()
+	return pc.lastCommitTime, pc.lastCommitErr
+}
+
+// setLastCommitStatus records the outcome of a finished commit.
+func (pc *PolicyConfigurator) setLastCommitStatus(err error) {
+	pc.statusLock.Lock()
+	defer pc.statusLock.Unlock()
+	pc.lastCommitTime = pc.clock.Now()
+	pc.lastCommitErr = err
+}
@@ -0,0 +1,111 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+func TestLastCommitStatus(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestLastCommitStatus")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod1IP    = "192.168.1.1"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer1 := NewMockRenderer("A", logger)
+	renderer2 := NewMockRenderer("B", logger)
+	clock := newFakeClock()
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithClock(clock))
+
+	// Register two renderers.
+	err := configurator.RegisterRenderer(renderer1)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = configurator.RegisterRenderer(renderer2)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Nothing committed yet.
+	commitTime, err := configurator.LastCommitStatus()
+	gomega.Expect(commitTime.IsZero()).To(gomega.BeTrue())
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// One of the renderers fails.
+	renderErr := errors.New("renderer failure")
+	renderer2.SetCommitError(renderErr)
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.Equal(renderErr))
+
+	commitTime, err = configurator.LastCommitStatus()
+	gomega.Expect(commitTime).To(gomega.Equal(clock.Now()))
+	gomega.Expect(err).To(gomega.Equal(renderErr))
+
+	// The renderer recovers.
+	clock.Advance(time.Minute)
+	renderer2.SetCommitError(nil)
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	commitTime, err = configurator.LastCommitStatus()
+	gomega.Expect(commitTime).To(gomega.Equal(clock.Now()))
+	gomega.Expect(err).To(gomega.BeNil())
+}
@@ -0,0 +1,126 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// SwapBuilder collects a complete new configuration prepared off to the side
+// by PrepareSwap(), to be swapped in atomically by Swap().
+type SwapBuilder struct {
+	configurator *PolicyConfigurator
+	config       map[podmodel.ID]ContivPolicies
+}
+
+// PrepareSwap returns a builder for a complete new configuration, which
+// replaces the committed one once swapped in, the same as with a resync
+// transaction. The builder is not affected by transactions committed
+// in the meantime.
+func (pc *PolicyConfigurator) PrepareSwap() *SwapBuilder {
+	return &SwapBuilder{
+		configurator: pc,
+		config:       make(map[podmodel.ID]ContivPolicies),
+	}
+}
+
+// Configure sets the policies of the pod in the new configuration.
+// The policies are deep-copied, the caller may modify them afterwards.
+// The pod ID is rewritten if selected by WithPodIDRewriter.
+func (sb *SwapBuilder) Configure(pod podmodel.ID, policies []*ContivPolicy) *SwapBuilder {
+	sb.config[sb.configurator.rewritePodID(pod)] = sb.configurator.canonicalPolicies(deepCopyPolicies(policies))
+	return sb
+}
+
+// Swap replaces the committed configuration with the prepared one.
+// Unlike resync, the new configuration is compared against the committed one
+// and only the differences are applied, in a single (non-resync) transaction
+// committed immediately: pods with changed policies are re-configured, pods
+// not included in the new configuration are removed (after the grace period
+// if WithTeardownGracePeriod is used) and pods with unchanged policies are
+// not touched at all.
+// Returns ErrReadOnly if the configurator is in the read-only mode.
+func (sb *SwapBuilder) Swap() error {
+	pc := sb.configurator
+	policyLists := make([]ContivPolicies, 0, len(sb.config))
+	for _, policies := range sb.config {
+		policyLists = append(policyLists, policies)
+	}
+	pc.prefetchFQDNs(policyLists)
+
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.readOnly {
+		pc.Log.Warn("Refusing to swap policies, the configurator is read-only")
+		return ErrReadOnly
+	}
+
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	changed, unchanged, removed := 0, 0, 0
+	for pod, policies := range sb.config {
+		committed, configured := pc.config[pod]
+		if !configured {
+			committed, configured = pc.skippedPods[pod]
+		}
+		if configured && equalPolicySets(committed, policies) {
+			// Unchanged pods are not re-rendered, only kept.
+			pc.cancelTeardown(pod)
+			unchanged++
+			continue
+		}
+		txn.config[pod] = policies
+		changed++
+	}
+	for _, committed := range []map[podmodel.ID]ContivPolicies{pc.config, pc.skippedPods} {
+		for pod := range committed {
+			if _, included := sb.config[pod]; included {
+				continue
+			}
+			removed++
+			txn.tearDownOmitted(pod)
+		}
+	}
+	pc.Log.WithFields(logging.Fields{
+		"changed":   changed,
+		"removed":   removed,
+		"unchanged": unchanged,
+	}).Info("Swapping configuration")
+	return txn.commit()
+}
+
+// equalPolicySets returns true if both sets contain the same policies
+// (compared in the normalized form, including all attributes).
+func equalPolicySets(policies1, policies2 ContivPolicies) bool {
+	if len(policies1) != len(policies2) {
+		return false
+	}
+	sorted1 := policies1.Copy()
+	sort.Sort(sorted1)
+	sorted2 := policies2.Copy()
+	sort.Sort(sorted2)
+	for idx := range sorted1 {
+		if !reflect.DeepEqual(sorted1[idx].Normalize(), sorted2[idx].Normalize()) {
+			return false
+		}
+	}
+	return true
+}
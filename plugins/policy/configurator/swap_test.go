@@ -0,0 +1,212 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// recordingRenderer is a mock renderer remembering which pods were rendered
+// by non-resync transactions and how many resync transactions were started.
+type recordingRenderer struct {
+	*MockRenderer
+	rendered map[podmodel.ID]struct{}
+	resyncs  int
+}
+
+// recordingTxn records pods rendered by the transaction.
+type recordingTxn struct {
+	rendererAPI.Txn
+	renderer *recordingRenderer
+}
+
+// NewTxn starts a recorded transaction.
+func (rr *recordingRenderer) NewTxn(resync bool) rendererAPI.Txn {
+	if resync {
+		rr.resyncs++
+	}
+	return &recordingTxn{Txn: rr.MockRenderer.NewTxn(resync), renderer: rr}
+}
+
+// Render records the pod and passes the rules to the mock renderer.
+func (rt *recordingTxn) Render(pod podmodel.ID, podIP *net.IPNet, ingress []*rendererAPI.ContivRule,
+	egress []*rendererAPI.ContivRule, removed bool) rendererAPI.Txn {
+	rt.renderer.rendered[pod] = struct{}{}
+	rt.Txn.Render(pod, podIP, ingress, egress, removed)
+	return rt
+}
+
+func TestSwap(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestSwap")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		numPods   = 60
+	)
+	pods := []podmodel.ID{}
+	for i := 0; i < numPods; i++ {
+		pods = append(pods, podmodel.ID{Name: fmt.Sprintf("pod%d", i), Namespace: namespace})
+	}
+	podPolicy := func(name string, peers []podmodel.ID, port uint16) *ContivPolicy {
+		return &ContivPolicy{
+			ID:   policymodel.ID{Name: name, Namespace: namespace},
+			Type: PolicyIngress,
+			Matches: []Match{
+				{
+					Type:  MatchIngress,
+					Pods:  peers,
+					Ports: []Port{{Protocol: TCP, Number: port}},
+				},
+			},
+		}
+	}
+
+	// Blue configuration: pods 0-49 in groups of 10, each group allowing
+	// ingress from the next group.
+	blue := make(map[podmodel.ID][]*ContivPolicy)
+	for i := 0; i < 50; i++ {
+		group := i / 10
+		peers := pods[((group+1)%5)*10 : ((group+1)%5)*10+10]
+		blue[pods[i]] = []*ContivPolicy{podPolicy(fmt.Sprintf("group%d", group), peers, 80)}
+	}
+
+	// Green configuration: pods 0-4 changed (other policy), pods 45-49
+	// removed, pods 50-54 added, policies of pods 5-9 re-created with
+	// reordered peers (equivalent), the rest unchanged.
+	green := make(map[podmodel.ID][]*ContivPolicy)
+	expDeltas := make(map[podmodel.ID]struct{})
+	for i := 0; i < 55; i++ {
+		switch {
+		case i < 5:
+			green[pods[i]] = []*ContivPolicy{podPolicy("group0-alt", pods[10:20], 8080)}
+			expDeltas[pods[i]] = struct{}{}
+		case i < 10:
+			reordered := append([]podmodel.ID{}, pods[15:20]...)
+			reordered = append(reordered, pods[10:15]...)
+			green[pods[i]] = []*ContivPolicy{podPolicy("group0", reordered, 80)}
+		case i < 45:
+			green[pods[i]] = blue[pods[i]]
+		case i < 50:
+			expDeltas[pods[i]] = struct{}{}
+		default:
+			green[pods[i]] = []*ContivPolicy{podPolicy("new", pods[0:5], 443)}
+			expDeltas[pods[i]] = struct{}{}
+		}
+	}
+
+	newConfigurator := func(renderer rendererAPI.PolicyRendererAPI) *PolicyConfigurator {
+		cache := NewMockPolicyCache()
+		for i, pod := range pods {
+			cache.AddPodConfig(pod, fmt.Sprintf("192.168.1.%d", i+1))
+		}
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false)
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator
+	}
+	swap := func(configurator *PolicyConfigurator, config map[podmodel.ID][]*ContivPolicy) error {
+		builder := configurator.PrepareSwap()
+		for pod, policies := range config {
+			builder.Configure(pod, policies)
+		}
+		return builder.Swap()
+	}
+
+	// Swap in the blue configuration.
+	renderer := &recordingRenderer{
+		MockRenderer: NewMockRenderer("A", logger),
+		rendered:     make(map[podmodel.ID]struct{}),
+	}
+	configurator := newConfigurator(renderer)
+	err := swap(configurator, blue)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.rendered).To(gomega.HaveLen(50))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.HaveLen(50))
+
+	// Swap in the green configuration, only the deltas are rendered.
+	renderer.rendered = make(map[podmodel.ID]struct{})
+	commits := renderer.GetCommitCount()
+	err = swap(configurator, green)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits + 1))
+	gomega.Expect(renderer.resyncs).To(gomega.Equal(0))
+	gomega.Expect(renderer.rendered).To(gomega.Equal(expDeltas))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.HaveLen(50))
+
+	// The outcome is the same as for a resync with the green configuration.
+	reference := NewMockRenderer("B", logger)
+	referenceConfigurator := newConfigurator(reference)
+	txn := referenceConfigurator.NewTxn(true)
+	for pod, policies := range green {
+		txn.Configure(pod, policies)
+	}
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	for _, pod := range pods {
+		ingress, egress := renderer.GetRules(pod)
+		refIngress, refEgress := reference.GetRules(pod)
+		gomega.Expect(ingress).To(gomega.Equal(refIngress))
+		gomega.Expect(egress).To(gomega.Equal(refEgress))
+	}
+	action := renderer.TestTraffic(pods[0], EgressTraffic,
+		parseIP("192.168.1.11"), parseIP("192.168.1.1"), rendererAPI.TCP, 123, 8080)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pods[45], EgressTraffic,
+		parseIP("192.168.1.1"), parseIP("192.168.1.46"), rendererAPI.TCP, 123, 8080)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+
+	// Swapping in the same configuration again changes nothing.
+	renderer.rendered = make(map[podmodel.ID]struct{})
+	commits = renderer.GetCommitCount()
+	err = swap(configurator, green)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.rendered).To(gomega.BeEmpty())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits))
+
+	// Swap is refused in the read-only mode.
+	configurator.SetReadOnly(true)
+	err = swap(configurator, blue)
+	gomega.Expect(err).To(gomega.Equal(ErrReadOnly))
+}
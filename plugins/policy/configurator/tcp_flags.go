@@ -0,0 +1,73 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithStrictTCPFlags selects how TCP flag matches (Match.TCPFlags) are handled
+// for renderers without the renderer.TCPFlagMatching capability. By default
+// the flag matches are not passed to such renderers and TCP segments are
+// matched regardless of the flags. With strict TCP flags, the commit fails
+// instead.
+func WithStrictTCPFlags(strict bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.strictTCPFlags = strict
+	}
+}
+
+// rendererTCPFlagMatch converts TCP flag match into the renderer representation.
+func rendererTCPFlagMatch(tcpFlags *TCPFlagMatch) *renderer.TCPFlagMatch {
+	if tcpFlags == nil {
+		return nil
+	}
+	return &renderer.TCPFlagMatch{
+		Required:  renderer.TCPFlags(tcpFlags.Required),
+		Forbidden: renderer.TCPFlags(tcpFlags.Forbidden),
+	}
+}
+
+// restrictTCPFlags restricts the rule by the TCP flags of the match given
+// by the attributes, if the rule is for TCP. Rules of other protocols
+// (including ANY) are not restricted.
+func (attrs ruleAttrs) restrictTCPFlags(rule *renderer.ContivRule) {
+	if attrs.tcpFlags == nil || rule.Protocol != renderer.TCP {
+		return
+	}
+	tcpFlags := *attrs.tcpFlags
+	rule.TCPFlags = &tcpFlags
+}
+
+// withoutTCPFlags returns the rules with TCP flag matches removed. Rules which
+// become duplicates are skipped. If none of the rules is restricted by TCP
+// flags, the same list is returned.
+func withoutTCPFlags(rules ContivRules) ContivRules {
+	return withoutRuleFeature(rules,
+		func(rule *renderer.ContivRule) bool { return rule.TCPFlags != nil },
+		func(rule *renderer.ContivRule) { rule.TCPFlags = nil })
+}
+
+// hasTCPFlags returns true if any of the rules is restricted by TCP flags.
+func hasTCPFlags(rules ContivRules) bool {
+	for _, rule := range rules {
+		if rule.TCPFlags != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"time"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// Clock abstracts the passing of time so that time-dependent features
+// of the configurator can be tested.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc waits for the duration to elapse and then calls <f>
+	// in its own goroutine.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer represents a single event scheduled using Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the Timer from firing. Returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+}
+
+// scheduledTimer is a Timer scheduled by the configurator, together with
+// the generation it was scheduled with. A timer may fire just before it is
+// stopped and its callback then waits for the configurator lock while the timer
+// is being replaced. The callback therefore proceeds only if the stored timer
+// still has the generation that the callback was scheduled with.
+type scheduledTimer struct {
+	Timer
+	generation uint64
+}
+
+// owns returns true if the timer was scheduled with the given generation.
+func (st *scheduledTimer) owns(generation uint64) bool {
+	return st != nil && st.generation == generation
+}
+
+// afterFunc schedules <f> using the clock of the configurator. The callback
+// receives the generation of the returned timer.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) afterFunc(d time.Duration, f func(generation uint64)) *scheduledTimer {
+	pc.timerGeneration++
+	generation := pc.timerGeneration
+	return &scheduledTimer{
+		Timer:      pc.clock.AfterFunc(d, func() { f(generation) }),
+		generation: generation,
+	}
+}
+
+// realClock implements Clock using the time package.
+type realClock struct{}
+
+// Now returns time.Now().
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc wraps time.AfterFunc.
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// WithClock replaces the system clock used by the configurator.
+// Intended for testing.
+func WithClock(clock Clock) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.clock = clock
+	}
+}
+
+// WithTeardownGracePeriod delays the removal of rules for pods which were
+// omitted by a resync transaction. The rules of such pods are retained for
+// the given period of time and only then removed from renderers. If the pod
+// re-appears in a transaction (with the same or different policies) before
+// the grace period expires, the teardown is cancelled.
+// Pods removed from the cache (no longer running) are unaffected.
+func WithTeardownGracePeriod(d time.Duration) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.gracePeriod = d
+	}
+}
+
+// scheduleTeardowns cancels teardown of pods configured by the transaction
+// and for resync transactions schedules delayed teardown of committed pods
+// not mentioned in the transaction. Rules of such pods are retained by
+// re-rendering their committed configuration.
+func (pct *PolicyConfiguratorTxn) scheduleTeardowns() {
+	pc := pct.configurator
+	for pod := range pct.config {
+		if _, teardown := pct.teardown[pod]; teardown {
+			continue
+		}
+		pc.cancelTeardown(pod)
+	}
+
+	if !pct.resync || pc.gracePeriod == 0 {
+		return
+	}
+	for pod, policies := range pc.config {
+		if _, configured := pct.config[pod]; configured {
+			continue
+		}
+		pct.config[pod] = policies
+		pc.scheduleTeardown(pod)
+	}
+}
+
+// tearDownOmitted removes the pod omitted from a resync of some scope
+// (see Swap, NewScopedResyncTxn) by the transaction, or schedules its teardown
+// if the grace period is configured.
+func (pct *PolicyConfiguratorTxn) tearDownOmitted(pod podmodel.ID) {
+	if pct.configurator.gracePeriod > 0 {
+		pct.configurator.scheduleTeardown(pod)
+		return
+	}
+	pct.config[pod] = nil
+	pct.teardown[pod] = struct{}{}
+}
+
+// cancelTeardown cancels the scheduled teardown of the pod, if any.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) cancelTeardown(pod podmodel.ID) {
+	if timer, pending := pc.teardowns[pod]; pending {
+		pc.Log.WithField("pod", pc.logPod(pod)).Debug("Cancelling scheduled teardown of the pod")
+		timer.Stop()
+		delete(pc.teardowns, pod)
+	}
+}
+
+// scheduleTeardown schedules teardown of the pod after the grace period,
+// unless already scheduled.
+// The configurator is expected to be locked by the caller.
+func (pc *PolicyConfigurator) scheduleTeardown(pod podmodel.ID) {
+	if _, pending := pc.teardowns[pod]; pending {
+		return
+	}
+	pc.Log.WithFields(logging.Fields{
+		"pod":         pc.logPod(pod),
+		"gracePeriod": pc.gracePeriod,
+	}).Debug("Scheduling teardown of the pod")
+	pc.teardowns[pod] = pc.afterFunc(pc.gracePeriod, func(generation uint64) {
+		pc.tearDown(pod, generation)
+	})
+}
+
+// tearDown removes rules of a pod after the grace period has expired.
+func (pc *PolicyConfigurator) tearDown(pod podmodel.ID, generation uint64) {
+	pc.Lock()
+	defer pc.Unlock()
+	if !pc.teardowns[pod].owns(generation) {
+		/* cancelled or re-scheduled in the meantime */
+		return
+	}
+	delete(pc.teardowns, pod)
+
+	pc.Log.WithField("pod", pc.logPod(pod)).Debug("Grace period expired, tearing down the pod")
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	txn.config[pod] = nil
+	txn.teardown[pod] = struct{}{}
+	if err := txn.commit(); err != nil {
+		pc.Log.WithFields(logging.Fields{
+			"pod": pc.logPod(pod),
+			"err": err,
+		}).Error("Failed to tear down the pod")
+	}
+}
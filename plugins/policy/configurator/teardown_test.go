@@ -0,0 +1,354 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// fakeClock is a Clock whose time moves only with Advance().
+// Timers fire synchronously from Advance().
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	expires time.Time
+	f       func()
+	stopped bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	timer := &fakeTimer{clock: fc, expires: fc.now.Add(d), f: f}
+	fc.timers = append(fc.timers, timer)
+	return timer
+}
+
+// Advance moves the time forward and fires all expired timers.
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.lock.Lock()
+	fc.now = fc.now.Add(d)
+	expired := []*fakeTimer{}
+	pending := []*fakeTimer{}
+	for _, timer := range fc.timers {
+		if !timer.stopped && !timer.expires.After(fc.now) {
+			timer.stopped = true
+			expired = append(expired, timer)
+		} else if !timer.stopped {
+			pending = append(pending, timer)
+		}
+	}
+	fc.timers = pending
+	fc.lock.Unlock()
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].expires.Before(expired[j].expires)
+	})
+	for _, timer := range expired {
+		timer.f()
+	}
+}
+
+// FireStopped runs the callbacks of the timers stopped before expiring, as if
+// they had fired right before being stopped and waited for the configurator.
+func (fc *fakeClock) FireStopped() {
+	fc.lock.Lock()
+	stopped := []*fakeTimer{}
+	pending := []*fakeTimer{}
+	for _, timer := range fc.timers {
+		if timer.stopped {
+			stopped = append(stopped, timer)
+		} else {
+			pending = append(pending, timer)
+		}
+	}
+	fc.timers = pending
+	fc.lock.Unlock()
+
+	for _, timer := range stopped {
+		timer.f()
+	}
+}
+
+func (ft *fakeTimer) Stop() bool {
+	ft.clock.lock.Lock()
+	defer ft.clock.lock.Unlock()
+	wasActive := !ft.stopped
+	ft.stopped = true
+	return wasActive
+}
+
+func TestTeardownGracePeriod(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestTeardownGracePeriod")
+
+	// Prepare input data.
+	const (
+		namespace   = "default"
+		pod1Name    = "pod1"
+		pod2Name    = "pod2"
+		pod1IP      = "192.168.1.1"
+		pod2IP      = "192.168.1.2"
+		gracePeriod = 10 * time.Second
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 443},
+				},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	clock := newFakeClock()
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithClock(clock), WithTeardownGracePeriod(gracePeriod))
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Initial resync.
+	txn := configurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	action := renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Resync omitting pod2 - rules are retained.
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	ip, _ := renderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+
+	// Still within the grace period.
+	clock.Advance(gracePeriod / 2)
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+
+	// Another resync does not prolong the grace period.
+	txn = configurator.NewTxn(true)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Grace period expired - rules are removed.
+	clock.Advance(gracePeriod / 2)
+	action = renderer.TestTraffic(pod2, EgressTraffic,
+		parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(UnmatchedTraffic))
+	ip, _ = renderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+
+	// Pod1 was not affected.
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Resync omitting pod1 - teardown is scheduled.
+	txn = configurator.NewTxn(true)
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	clock.Advance(gracePeriod / 2)
+
+	// Pod1 re-appears with different policies - teardown is cancelled.
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy2})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	clock.Advance(2 * gracePeriod)
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 443)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+	action = renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 123, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+	ip, _ = renderer.GetPodIP(pod1)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod1IP))
+}
+
+func TestTeardownRescheduled(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestTeardownRescheduled")
+
+	// Prepare input data.
+	const (
+		namespace   = "default"
+		pod1Name    = "pod1"
+		pod2Name    = "pod2"
+		pod1IP      = "192.168.1.1"
+		pod2IP      = "192.168.1.2"
+		gracePeriod = 10 * time.Second
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Ports: []Port{
+					{Protocol: TCP, Number: 80},
+				},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+	clock := newFakeClock()
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false, WithClock(clock), WithTeardownGracePeriod(gracePeriod))
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	resync := func(pods ...podmodel.ID) {
+		txn := configurator.NewTxn(true)
+		for _, pod := range pods {
+			txn.Configure(pod, []*ContivPolicy{policy1})
+		}
+		err := txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+	}
+
+	// Teardown of pod2 is scheduled, cancelled and scheduled again.
+	resync(pod1, pod2)
+	resync(pod1)
+	clock.Advance(gracePeriod / 2)
+	resync(pod1, pod2)
+	resync(pod1)
+
+	// The timer of the cancelled teardown fires late - pod2 is retained.
+	clock.FireStopped()
+	ip, _ := renderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+	clock.Advance(gracePeriod / 2)
+	ip, _ = renderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+
+	// The re-scheduled grace period expires.
+	clock.Advance(gracePeriod / 2)
+	ip, _ = renderer.GetPodIP(pod2)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+	ip, _ = renderer.GetPodIP(pod1)
+	gomega.Expect(ip).To(gomega.BeEquivalentTo(pod1IP))
+}
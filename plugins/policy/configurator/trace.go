@@ -0,0 +1,105 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// Events logged for traced pods, in the order of the evaluation.
+const (
+	// tracePodLookup: the pod data were looked up in the cache.
+	tracePodLookup = "pod-lookup"
+
+	// traceRemoved: the pod was removed, its rules are un-configured.
+	traceRemoved = "removed"
+
+	// traceInputPolicies: the (sorted) set of policies to evaluate.
+	traceInputPolicies = "input-policies"
+
+	// traceProcessedSetLookup: rules generated for the same set of policies
+	// (for another pod) were looked up.
+	traceProcessedSetLookup = "processed-set-lookup"
+
+	// tracePolicy: a policy applicable to the traffic direction is evaluated.
+	tracePolicy = "policy"
+
+	// traceMatch: a match of the policy is evaluated.
+	traceMatch = "match"
+
+	// tracePeerLookup: a peer pod was looked up in the cache.
+	tracePeerLookup = "peer-lookup"
+
+	// traceMatchRules: rules added by the match (before rules of other
+	// matches, injected rules and ordering are applied).
+	traceMatchRules = "match-rules"
+
+	// traceDirectionRules: all rules generated for the traffic direction.
+	traceDirectionRules = "direction-rules"
+
+	// traceFinalRules: the rules passed to renderers.
+	traceFinalRules = "final-rules"
+)
+
+// TracePod enables tracing of the policy evaluation for the given pod.
+// Every step of the evaluation of the pod policies is logged at the debug level,
+// with the field "trace" set to the pod ID (or its pseudonym, see
+// WithPodAnonymizer) and "event" identifying the step.
+// Pods not traced are evaluated without the overhead.
+// Note that if the rules for the set of policies of a traced pod were already
+// generated for another pod, they are generated once more only for the trace.
+func (pc *PolicyConfigurator) TracePod(pod podmodel.ID) {
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.tracedPods == nil {
+		pc.tracedPods = make(map[podmodel.ID]struct{})
+	}
+	pc.tracedPods[pod] = struct{}{}
+}
+
+// UntracePod disables tracing enabled by TracePod for the given pod.
+func (pc *PolicyConfigurator) UntracePod(pod podmodel.ID) {
+	pc.Lock()
+	defer pc.Unlock()
+	delete(pc.tracedPods, pod)
+}
+
+// startTrace selects the pod to trace the evaluation for. Tracing is disabled
+// if the pod is not traced.
+func (pct *PolicyConfiguratorTxn) startTrace(pod podmodel.ID) {
+	pct.tracedPod = nil
+	if _, traced := pct.configurator.tracedPods[pod]; traced {
+		pct.tracedPod = &pod
+	}
+}
+
+// trace logs an event of the evaluation for the traced pod.
+func (pct *PolicyConfiguratorTxn) trace(event string, fields logging.Fields) {
+	if pct.tracedPod == nil {
+		return
+	}
+	traceFields := logging.Fields{
+		"trace": pct.configurator.logPod(*pct.tracedPod),
+		"event": event,
+	}
+	for key, value := range fields {
+		traceFields[key] = value
+	}
+	pct.Log.WithFields(traceFields).Debug("Policy evaluation trace")
+}
@@ -0,0 +1,178 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	lg "github.com/sirupsen/logrus"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// traceHook collects trace events logged by the configurator.
+type traceHook struct {
+	pods   []podmodel.ID
+	events []string
+}
+
+func (th *traceHook) Levels() []lg.Level {
+	return lg.AllLevels
+}
+
+func (th *traceHook) Fire(entry *lg.Entry) error {
+	pod, isTrace := entry.Data["trace"]
+	if !isTrace {
+		return nil
+	}
+	th.pods = append(th.pods, pod.(podmodel.ID))
+	th.events = append(th.events, entry.Data["event"].(string))
+	return nil
+}
+
+func (th *traceHook) reset() {
+	th.pods = nil
+	th.events = nil
+}
+
+func TestTracePod(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.NewLogger("trace-test")
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestTracePod")
+	hook := &traceHook{}
+	logger.AddHook(hook)
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed from pod3 on TCP:80
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod3},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// Initialize mocks.
+	cache := NewMockPolicyCache()
+	cache.AddPodConfig(pod1, pod1IP)
+	cache.AddPodConfig(pod2, pod2IP)
+	cache.AddPodConfig(pod3, pod3IP)
+
+	contiv := NewMockContiv()
+	contiv.SetNatLoopbackIP(natLoopbackIP)
+
+	renderer := NewMockRenderer("A", logger)
+
+	// Initialize configurator.
+	configurator := &PolicyConfigurator{
+		Deps: Deps{
+			Log:    logger,
+			Cache:  cache,
+			Contiv: contiv,
+		},
+	}
+	configurator.Init(false)
+
+	// Register one renderer.
+	err := configurator.RegisterRenderer(renderer)
+	gomega.Expect(err).To(gomega.BeNil())
+
+	// Nothing traced by default.
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(hook.events).To(gomega.BeEmpty())
+
+	// Trace pod1 configured with the same policies as pod2.
+	// The evaluation is traced even if pod2 is processed first.
+	configurator.TracePod(pod1)
+	expectedEvents := []string{
+		tracePodLookup,
+		traceInputPolicies,
+		traceProcessedSetLookup,
+		tracePolicy,
+		traceMatch,
+		tracePeerLookup,
+		traceMatchRules,
+		traceDirectionRules, /* ingress */
+		traceDirectionRules, /* egress */
+		traceFinalRules,
+	}
+	for i := 0; i < 5; i++ {
+		hook.reset()
+		txn = configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		txn.Configure(pod2, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(hook.events).To(gomega.Equal(expectedEvents))
+		for _, pod := range hook.pods {
+			gomega.Expect(pod).To(gomega.Equal(pod1))
+		}
+	}
+
+	// Rules of the traced pod are still shared.
+	expectSharedRules(renderer, pod1, pod2)
+
+	// Removed pod.
+	hook.reset()
+	cache.AddPodConfig(pod1, "") /* IP released */
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(hook.events).To(gomega.Equal([]string{tracePodLookup, traceRemoved, traceFinalRules}))
+
+	// Tracing disabled.
+	configurator.UntracePod(pod1)
+	hook.reset()
+	cache.AddPodConfig(pod1, pod1IP)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	txn.Configure(pod2, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(hook.events).To(gomega.BeEmpty())
+}
@@ -0,0 +1,60 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// WithStrictTunnelVNI selects how tunnel matches (Match.TunnelVNI) are handled
+// for renderers without the renderer.TunnelMatching capability. By default
+// the VNIs are not passed to such renderers and the traffic is matched
+// regardless of the encapsulation. With strict tunnel VNIs, the commit fails
+// instead.
+func WithStrictTunnelVNI(strict bool) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.strictTunnelVNI = strict
+	}
+}
+
+// rendererTunnelVNI returns a copy of the tunnel VNI for the rules.
+func rendererTunnelVNI(tunnelVNI *uint32) *uint32 {
+	if tunnelVNI == nil {
+		return nil
+	}
+	vni := *tunnelVNI
+	return &vni
+}
+
+// withoutTunnelVNIs returns the rules with tunnel VNIs removed. Rules which
+// become duplicates are skipped. If none of the rules is restricted to a tunnel,
+// the same list is returned.
+func withoutTunnelVNIs(rules ContivRules) ContivRules {
+	return withoutRuleFeature(rules,
+		func(rule *renderer.ContivRule) bool { return rule.TunnelVNI != nil },
+		func(rule *renderer.ContivRule) { rule.TunnelVNI = nil })
+}
+
+// hasTunnelVNIs returns true if any of the rules is restricted to a tunnel.
+func hasTunnelVNIs(rules ContivRules) bool {
+	for _, rule := range rules {
+		if rule.TunnelVNI != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestTunnelVNI(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestTunnelVNI")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1Name  = "pod1"
+		pod2Name  = "pod2"
+		pod3Name  = "pod3"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: pod1Name, Namespace: namespace}
+	pod2 := podmodel.ID{Name: pod2Name, Namespace: namespace}
+	pod3 := podmodel.ID{Name: pod3Name, Namespace: namespace}
+
+	// ingress allowed from pod2 to TCP:80 only inside the tunnel with VNI 5001
+	// and from pod3 to any port regardless of the encapsulation
+	vni := uint32(5001)
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:      MatchIngress,
+				Pods:      []podmodel.ID{pod2},
+				Ports:     []Port{{Protocol: TCP, Number: 80}},
+				TunnelVNI: &vni,
+			},
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{pod3},
+			},
+		},
+	}
+	gomega.Expect(policy1.Matches[0].String()).To(gomega.ContainSubstring(", TunnelVNI:5001"))
+	gomega.Expect(policy1.Matches[1].String()).ToNot(gomega.ContainSubstring("TunnelVNI"))
+	gomega.Expect(policy1.Matches[0].DeepCopy().TunnelVNI).To(gomega.Equal(&vni))
+	gomega.Expect(policy1.Matches[0].DeepCopy().TunnelVNI).ToNot(gomega.BeIdenticalTo(&vni))
+
+	for _, strict := range []bool{false, true} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+		cache.AddPodConfig(pod3, pod3IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer1 := NewMockRenderer("A", logger)
+		renderer1.SetCapabilities(rendererAPI.TunnelMatching)
+		renderer2 := NewMockRenderer("B", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithStrictTunnelVNI(strict))
+
+		// Register two renderers.
+		err := configurator.RegisterRenderer(renderer1)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(renderer2)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		if strict {
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("TUNNEL-MATCH"))
+		} else {
+			gomega.Expect(err).To(gomega.BeNil())
+		}
+
+		// Renderer with the capability receives the VNI only for the first match.
+		_, egress := renderer1.GetRules(pod1)
+		var tunnelRules []*rendererAPI.ContivRule
+		for _, rule := range egress {
+			if rule.TunnelVNI != nil {
+				tunnelRules = append(tunnelRules, rule)
+				gomega.Expect(rule.RequiredCapabilities()).To(gomega.ConsistOf(rendererAPI.TunnelMatching))
+			}
+		}
+		gomega.Expect(tunnelRules).To(gomega.HaveLen(1))
+		rule := tunnelRules[0]
+		gomega.Expect(rule.Protocol).To(gomega.Equal(rendererAPI.TCP))
+		gomega.Expect(rule.SrcNetwork.String()).To(gomega.Equal(pod2IP + "/32"))
+		gomega.Expect(rule.DestPort).To(gomega.BeEquivalentTo(80))
+		gomega.Expect(*rule.TunnelVNI).To(gomega.Equal(vni))
+		gomega.Expect(rule.String()).To(gomega.HaveSuffix(" vni=5001>"))
+		gomega.Expect(rule.Copy().TunnelVNI).ToNot(gomega.BeIdenticalTo(rule.TunnelVNI))
+
+		// Rule of the match without VNI is not restricted to a tunnel.
+		var pod3Rules []*rendererAPI.ContivRule
+		for _, rule := range egress {
+			if rule.SrcNetwork.String() == pod3IP+"/32" {
+				pod3Rules = append(pod3Rules, rule)
+			}
+		}
+		gomega.Expect(pod3Rules).To(gomega.HaveLen(1))
+		gomega.Expect(pod3Rules[0].TunnelVNI).To(gomega.BeNil())
+		gomega.Expect(pod3Rules[0].String()).ToNot(gomega.ContainSubstring("vni="))
+		rendered := len(egress)
+
+		if strict {
+			// Renderer without the capability is not given any rules.
+			ingress, egress := renderer2.GetRules(pod1)
+			gomega.Expect(ingress).To(gomega.BeEmpty())
+			gomega.Expect(egress).To(gomega.BeEmpty())
+			continue
+		}
+
+		// Renderer without the capability receives the rules without the VNI.
+		_, egress = renderer2.GetRules(pod1)
+		gomega.Expect(egress).To(gomega.HaveLen(rendered))
+		for _, rule := range egress {
+			gomega.Expect(rule.TunnelVNI).To(gomega.BeNil())
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// IntraTxnConflictHandling selects how the configurator handles a pod
+// configured repeatedly with different sets of policies in one transaction
+// (see WithIntraTxnConflict).
+type IntraTxnConflictHandling int
+
+const (
+	// LastConfigureWins replaces the policies given by the earlier Configure()
+	// with the policies given by the last one.
+	LastConfigureWins IntraTxnConflictHandling = iota
+
+	// MergeConflicts configures the pod with the union of the policies given
+	// by all Configure() calls (equal policies are included only once).
+	MergeConflicts
+
+	// RejectConflicts makes Commit() of the transaction fail with an error
+	// naming the pods configured with different sets of policies.
+	RejectConflicts
+)
+
+// String converts IntraTxnConflictHandling into a human-readable string.
+func (itc IntraTxnConflictHandling) String() string {
+	switch itc {
+	case LastConfigureWins:
+		return "LAST-WINS"
+	case MergeConflicts:
+		return "MERGE"
+	case RejectConflicts:
+		return "REJECT"
+	}
+	return "INVALID"
+}
+
+// WithIntraTxnConflict selects how a pod configured repeatedly with different
+// sets of policies in one transaction is handled, e.g. to catch controller bugs.
+// Configuring a pod repeatedly with the same set of policies is never
+// a conflict. Default is LastConfigureWins.
+func WithIntraTxnConflict(handling IntraTxnConflictHandling) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.intraTxnConflict = handling
+	}
+}
+
+// resolveConflict returns the policies to configure for a pod configured
+// already in the transaction with <configured> policies.
+func (pct *PolicyConfiguratorTxn) resolveConflict(pod podmodel.ID, configured, policies ContivPolicies) ContivPolicies {
+	if samePolicySets(configured, policies) {
+		return policies
+	}
+	handling := pct.configurator.intraTxnConflict
+	pct.Log.WithFields(logging.Fields{
+		"pod":      pct.configurator.logPod(pod),
+		"handling": handling,
+	}).Warn("Pod configured repeatedly with different policies in one transaction")
+	switch handling {
+	case MergeConflicts:
+		merged := configured.Copy()
+		for _, policy := range policies {
+			if !containsPolicy(merged, policy) {
+				merged = append(merged, policy)
+			}
+		}
+		return merged
+	case RejectConflicts:
+		pct.conflicts = append(pct.conflicts, pod)
+	}
+	return policies
+}
+
+// checkConflicts returns an error naming the pods configured repeatedly with
+// different policies, if rejected by WithIntraTxnConflict.
+func (pct *PolicyConfiguratorTxn) checkConflicts() error {
+	if len(pct.conflicts) == 0 {
+		return nil
+	}
+	var pods []string
+	seen := make(map[podmodel.ID]struct{})
+	for _, pod := range pct.conflicts {
+		if _, duplicate := seen[pod]; !duplicate {
+			seen[pod] = struct{}{}
+			pods = append(pods, pod.String())
+		}
+	}
+	sort.Strings(pods)
+	return fmt.Errorf("pods configured repeatedly with different policies in one transaction: %s",
+		strings.Join(pods, ", "))
+}
+
+// samePolicySets returns true if both lists contain the same policies
+// (by content, the order is not significant).
+func samePolicySets(a, b ContivPolicies) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	aStrings := policyStrings(a)
+	bStrings := policyStrings(b)
+	for idx := range aStrings {
+		if aStrings[idx] != bStrings[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// policyStrings returns sorted string representations of the policies.
+func policyStrings(policies ContivPolicies) []string {
+	strs := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		strs = append(strs, policy.String())
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+// containsPolicy returns true if a policy equal to the given one is in the list.
+func containsPolicy(policies ContivPolicies, policy *ContivPolicy) bool {
+	str := policy.String()
+	for _, other := range policies {
+		if other.String() == str {
+			return true
+		}
+	}
+	return false
+}
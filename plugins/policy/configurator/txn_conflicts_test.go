@@ -0,0 +1,136 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestIntraTxnConflict(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestIntraTxnConflict")
+
+	// Prepare input data.
+	const (
+		namespace  = "default"
+		pod1IP     = "192.168.1.1"
+		pod2IP     = "192.168.1.2"
+		externalIP = "10.0.0.1"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// ingress allowed only on TCP:80
+	policyA := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policyA", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	// ingress allowed only on TCP:443
+	policyB := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policyB", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Ports: []Port{{Protocol: TCP, Number: 443}},
+			},
+		},
+	}
+
+	for _, handling := range []IntraTxnConflictHandling{LastConfigureWins, MergeConflicts, RejectConflicts} {
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer := NewMockRenderer("A", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithIntraTxnConflict(handling))
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		toPod := func(pod podmodel.ID, podIP string, port uint16) TrafficAction {
+			return renderer.TestTraffic(pod, EgressTraffic,
+				parseIP(externalIP), parseIP(podIP), rendererAPI.TCP, 123, port)
+		}
+
+		// pod1 is configured with different policies, pod2 twice with the same ones
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policyA})
+		txn.Configure(pod2, []*ContivPolicy{policyA, policyB})
+		txn.Configure(pod1, []*ContivPolicy{policyB})
+		txn.Configure(pod2, []*ContivPolicy{policyB, policyA.DeepCopy()})
+		err = txn.Commit()
+
+		switch handling {
+		case LastConfigureWins:
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(toPod(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(DeniedTraffic))
+			gomega.Expect(toPod(pod1, pod1IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		case MergeConflicts:
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(toPod(pod1, pod1IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+			gomega.Expect(toPod(pod1, pod1IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+			gomega.Expect(toPod(pod1, pod1IP, 22)).To(gomega.BeEquivalentTo(DeniedTraffic))
+		case RejectConflicts:
+			gomega.Expect(err).ToNot(gomega.BeNil())
+			gomega.Expect(err.Error()).To(gomega.HaveSuffix(": default/pod1"))
+			_, lastErr := configurator.LastCommitStatus()
+			gomega.Expect(lastErr).To(gomega.Equal(err))
+			gomega.Expect(configurator.ConfiguredPods()).To(gomega.BeEmpty())
+			continue
+		}
+
+		// pod2 is configured with both policies
+		gomega.Expect(toPod(pod2, pod2IP, 80)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(toPod(pod2, pod2IP, 443)).To(gomega.BeEquivalentTo(AllowedTraffic))
+		gomega.Expect(configurator.config[pod2]).To(gomega.HaveLen(2))
+	}
+}
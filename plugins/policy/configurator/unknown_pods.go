@@ -0,0 +1,192 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+)
+
+// UnknownPodHandling selects how pods referenced by Match.Pods which are not
+// known to the configurator (not found in the policy cache or without an IP
+// address assigned yet) are treated (see WithUnknownPodHandling).
+type UnknownPodHandling int
+
+const (
+	// UnknownPodsDropped skips the unknown pods with a warning, i.e. they do
+	// not contribute any rules until the referencing pods are re-configured.
+	UnknownPodsDropped UnknownPodHandling = iota
+
+	// UnknownPodsDeferred skips the unknown pods, but remembers them as pending
+	// references, and the rules of the referencing pods are re-rendered once
+	// the pods become known (see RefreshPendingPeers()).
+	UnknownPodsDeferred
+
+	// UnknownPodsRejected refuses to commit transactions with policies
+	// referencing unknown pods.
+	UnknownPodsRejected
+)
+
+// String converts UnknownPodHandling into a human-readable string.
+func (uph UnknownPodHandling) String() string {
+	switch uph {
+	case UnknownPodsDropped:
+		return "DROPPED"
+	case UnknownPodsDeferred:
+		return "DEFERRED"
+	case UnknownPodsRejected:
+		return "REJECTED"
+	}
+	return "INVALID"
+}
+
+// WithUnknownPodHandling selects how unknown pods referenced by Match.Pods
+// are handled. Default is UnknownPodsDropped. Pods selected by namespace
+// selectors and pod name patterns are looked up in the policy cache and are
+// therefore never unknown.
+func WithUnknownPodHandling(handling UnknownPodHandling) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.unknownPods = handling
+	}
+}
+
+// PendingPeers returns the unknown pods referenced by the committed policies,
+// sorted by namespace and name, which are waiting for RefreshPendingPeers().
+// Empty unless UnknownPodsDeferred is selected.
+func (pc *PolicyConfigurator) PendingPeers() []podmodel.ID {
+	pc.Lock()
+	defer pc.Unlock()
+	peers := []podmodel.ID{}
+	for peer := range pc.pendingPeers {
+		peers = append(peers, peer)
+	}
+	sortPodIDs(peers)
+	return peers
+}
+
+// RefreshPendingPeers re-renders rules of pods with policies referencing
+// any of the given pods as pending peers (see UnknownPodsDeferred), to install
+// the rules deferred until the pods become known. It should be called
+// whenever a pod is added into the policy cache or gets its IP address
+// assigned. Pods still unknown stay pending.
+func (pc *PolicyConfigurator) RefreshPendingPeers(pods ...podmodel.ID) error {
+	pc.Lock()
+	defer pc.Unlock()
+	txn := pc.NewTxn(false).(*PolicyConfiguratorTxn)
+	for _, peer := range pods {
+		if !pc.knownPod(peer) {
+			continue
+		}
+		for pod := range pc.pendingPeers[peer] {
+			if policies, configured := pc.config[pod]; configured {
+				txn.configure(pod, policies)
+			}
+		}
+	}
+	if len(txn.config) == 0 {
+		return nil
+	}
+	pc.Log.WithField("peers", pods).Debug("Installing rules deferred for pending peers")
+	return txn.commit()
+}
+
+// knownPod returns true if the pod is found in the policy cache with an IP
+// address assigned.
+func (pc *PolicyConfigurator) knownPod(pod podmodel.ID) bool {
+	found, podData := pc.Cache.LookupPod(pod)
+	return found && podData.GetIpAddress() != ""
+}
+
+// logUnknownPeer logs the unknown peer skipped during the rule generation.
+func (pct *PolicyConfiguratorTxn) logUnknownPeer(peer podmodel.ID, reason string) {
+	log := pct.Log.WithFields(logging.Fields{
+		"peer":   pct.configurator.logPod(peer),
+		"reason": reason,
+	})
+	if pct.configurator.unknownPods == UnknownPodsDeferred {
+		log.Debug("Deferring rules for the peer pod until it is known")
+		return
+	}
+	log.Warn("Skipping unknown peer pod")
+}
+
+// checkUnknownPods returns an error if any of the policies in the transaction
+// references an unknown pod and UnknownPodsRejected is selected.
+func (pct *PolicyConfiguratorTxn) checkUnknownPods() error {
+	pc := pct.configurator
+	if pc.unknownPods != UnknownPodsRejected {
+		return nil
+	}
+	for _, pod := range sortedPods(pct.config) {
+		for _, policy := range pc.inheritedPolicies(pct.config[pod]) {
+			for _, peer := range referencedPods(policy) {
+				if !pc.knownPod(peer) {
+					return fmt.Errorf("policy %s references unknown pod %s", policy.ID, peer)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// savePendingPeers updates the pending peers of the pods in the transaction.
+// It is expected to be called after the changes are saved to the configurator.
+func (pct *PolicyConfiguratorTxn) savePendingPeers() {
+	pc := pct.configurator
+	if pc.unknownPods != UnknownPodsDeferred {
+		return
+	}
+	if pct.resync {
+		pc.pendingPeers = make(map[podmodel.ID]map[podmodel.ID]struct{})
+	} else {
+		for peer, pods := range pc.pendingPeers {
+			for pod := range pct.config {
+				delete(pods, pod)
+			}
+			if len(pods) == 0 {
+				delete(pc.pendingPeers, peer)
+			}
+		}
+	}
+	for pod := range pct.config {
+		for _, policy := range pc.inheritedPolicies(pc.config[pod]) {
+			for _, peer := range referencedPods(policy) {
+				if pc.knownPod(peer) {
+					continue
+				}
+				if pc.pendingPeers[peer] == nil {
+					pc.pendingPeers[peer] = make(map[podmodel.ID]struct{})
+				}
+				pc.pendingPeers[peer][pod] = struct{}{}
+			}
+		}
+	}
+}
+
+// referencedPods returns the pods referenced by Match.Pods of the policy.
+// Matches inherited from bases (see ContivPolicy.BaseRef) are included only
+// if given the policy returned by inheritedPolicies().
+func referencedPods(policy *ContivPolicy) []podmodel.ID {
+	var pods []podmodel.ID
+	for _, match := range policy.Matches {
+		pods = append(pods, match.Pods...)
+	}
+	return pods
+}
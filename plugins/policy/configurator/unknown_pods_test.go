@@ -0,0 +1,237 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestUnknownPodHandling(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestUnknownPodHandling")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	pod3 := podmodel.ID{Name: "pod3", Namespace: namespace}
+
+	// ingress allowed on TCP:80 from pod2 and pod3
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2, pod3},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+
+	newConfigurator := func(handling UnknownPodHandling) (*PolicyConfigurator, *MockPolicyCache, *MockRenderer) {
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod3, pod3IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer := NewMockRenderer("A", logger)
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithUnknownPodHandling(handling))
+		err := configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator, cache, renderer
+	}
+	testTraffic := func(renderer *MockRenderer, srcIP string) TrafficAction {
+		return renderer.TestTraffic(pod1, EgressTraffic,
+			parseIP(srcIP), parseIP(pod1IP), rendererAPI.TCP, 1024, 80)
+	}
+
+	// Deferred: rules installed once pod2 becomes known.
+	configurator, cache, renderer := newConfigurator(UnknownPodsDeferred)
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err := txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.PendingPeers()).To(gomega.Equal([]podmodel.ID{pod2}))
+	gomega.Expect(testTraffic(renderer, pod2IP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(renderer, pod3IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Known pods without pending references are ignored.
+	commits := renderer.GetCommitCount()
+	err = configurator.RefreshPendingPeers(pod2, pod3)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits))
+
+	// Pod2 is added without IP, then gets one.
+	cache.AddPodConfig(pod2, "")
+	err = configurator.RefreshPendingPeers(pod2)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits))
+	cache.AddPodConfig(pod2, pod2IP)
+	err = configurator.RefreshPendingPeers(pod2)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(commits + 1))
+	gomega.Expect(testTraffic(renderer, pod2IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(testTraffic(renderer, pod3IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+	gomega.Expect(configurator.PendingPeers()).To(gomega.BeEmpty())
+
+	// Pending references of removed pods are forgotten.
+	cache.RemovePodConfig(pod2)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.PendingPeers()).To(gomega.Equal([]podmodel.ID{pod2}))
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.PendingPeers()).To(gomega.BeEmpty())
+
+	// Dropped: the reference is not tracked.
+	configurator, cache, renderer = newConfigurator(UnknownPodsDropped)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.PendingPeers()).To(gomega.BeEmpty())
+	cache.AddPodConfig(pod2, pod2IP)
+	err = configurator.RefreshPendingPeers(pod2)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(testTraffic(renderer, pod2IP)).To(gomega.BeEquivalentTo(DeniedTraffic))
+	gomega.Expect(testTraffic(renderer, pod3IP)).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Rejected: the transaction is refused.
+	configurator, _, renderer = newConfigurator(UnknownPodsRejected)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(pod2.String()))
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(0))
+	gomega.Expect(configurator.ConfiguredPods()).To(gomega.BeEmpty())
+}
+
+func TestUnknownPodsOfBasePolicy(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestUnknownPodsOfBasePolicy")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+
+	// base allowing ingress on TCP:80 from pod2
+	base := &ContivPolicy{
+		ID: policymodel.ID{Name: "base", Namespace: namespace},
+		Matches: []Match{
+			{
+				Type:  MatchIngress,
+				Pods:  []podmodel.ID{pod2},
+				Ports: []Port{{Protocol: TCP, Number: 80}},
+			},
+		},
+	}
+	// ingress allowed only as inherited from the base
+	policy1 := &ContivPolicy{
+		ID:      policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type:    PolicyIngress,
+		BaseRef: base.ID,
+	}
+
+	newConfigurator := func(handling UnknownPodHandling) (*PolicyConfigurator, *MockPolicyCache, *MockRenderer) {
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		renderer := NewMockRenderer("A", logger)
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithUnknownPodHandling(handling))
+		err := configurator.RegisterBasePolicy(base)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterRenderer(renderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		return configurator, cache, renderer
+	}
+
+	// Deferred: the inherited reference is pending until pod2 becomes known.
+	configurator, cache, renderer := newConfigurator(UnknownPodsDeferred)
+	txn := configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err := txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.PendingPeers()).To(gomega.Equal([]podmodel.ID{pod2}))
+	cache.AddPodConfig(pod2, pod2IP)
+	err = configurator.RefreshPendingPeers(pod2)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(configurator.PendingPeers()).To(gomega.BeEmpty())
+	action := renderer.TestTraffic(pod1, EgressTraffic,
+		parseIP(pod2IP), parseIP(pod1IP), rendererAPI.TCP, 1024, 80)
+	gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+
+	// Rejected: the inherited reference refuses the transaction.
+	configurator, _, renderer = newConfigurator(UnknownPodsRejected)
+	txn = configurator.NewTxn(false)
+	txn.Configure(pod1, []*ContivPolicy{policy1})
+	err = txn.Commit()
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring(pod2.String()))
+	gomega.Expect(renderer.GetCommitCount()).To(gomega.Equal(0))
+}
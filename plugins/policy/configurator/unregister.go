@@ -0,0 +1,212 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ligato/cn-infra/logging"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// UnregisteredRendererHandling selects what happens with the pods served
+// by a renderer removed with UnregisterRenderer.
+type UnregisteredRendererHandling int
+
+const (
+	// TearDownUnregistered removes the rules of the pods from the renderer
+	// and leaves the pods without any other renderer. The pods are assigned
+	// to renderers as usual when their configuration changes next time
+	// (or with the next resync).
+	TearDownUnregistered UnregisteredRendererHandling = iota
+
+	// ReassignUnregistered removes the rules of the pods from the renderer
+	// and installs them into the default renderers, unless the pods are
+	// still handled by another labeled renderer.
+	ReassignUnregistered
+)
+
+// String converts UnregisteredRendererHandling into a human-readable string.
+func (urh UnregisteredRendererHandling) String() string {
+	switch urh {
+	case TearDownUnregistered:
+		return "TEAR-DOWN-UNREGISTERED"
+	case ReassignUnregistered:
+		return "REASSIGN-UNREGISTERED"
+	}
+	return "INVALID"
+}
+
+// WithUnregisteredRenderers selects the handling of pods served by renderers
+// removed with UnregisterRenderer (TearDownUnregistered by default).
+func WithUnregisteredRenderers(handling UnregisteredRendererHandling) Option {
+	return func(pc *PolicyConfigurator) {
+		pc.unregisteredRenderers = handling
+	}
+}
+
+// UnregisterRenderer removes the renderer(s) registered with the given label
+// (see RegisterLabeledRenderer), e.g. to decommission a network stack.
+// The rules of all pods handled by the renderer are first removed from it,
+// the pods are then handled as selected by WithUnregisteredRenderers.
+// If the removal of the rules fails, the renderer remains registered
+// and the call can be repeated. The default renderers cannot be unregistered,
+// there would be no renderer left to reassign their pods to.
+// The call waits for an in-flight transaction to finish.
+func (pc *PolicyConfigurator) UnregisterRenderer(label podmodel.Pod_Label) error {
+	pc.Lock()
+	defer pc.Unlock()
+	pc.waitForRetries()
+
+	if label.Key == "" {
+		return fmt.Errorf("default renderers cannot be unregistered")
+	}
+	var removed []int
+	for idx := range pc.renderers {
+		if pc.hasRendererLabel(idx, label) {
+			removed = append(removed, idx)
+		}
+	}
+	if len(removed) == 0 {
+		return fmt.Errorf("no renderer registered for label %s=%s", label.Key, label.Value)
+	}
+
+	// Remove the rules of all pods from the renderers.
+	for _, idx := range removed {
+		pc.Log.WithFields(logging.Fields{
+			"label":    label.Key + "=" + label.Value,
+			"renderer": idx,
+		}).Info("Unregistering renderer")
+		rTxn := pc.renderers[idx].NewTxn(false)
+		for pod, targets := range pc.assignments {
+			if hasRenderer(targets, idx) {
+				pc.render(rTxn, idx, pod, pc.podIPAddresses[pod], nil, nil, nil, nil, true)
+			}
+		}
+		if err := pc.commitRenderers([]renderer.Txn{rTxn}); err != nil {
+			pc.setLastCommitStatus(err)
+			return fmt.Errorf("failed to remove rules from the renderer: %v", err)
+		}
+	}
+
+	// Remove the renderers and shift the indexes of those registered later.
+	newIndexes := make([]int, len(pc.renderers))
+	renderers := []renderer.PolicyRendererAPI{}
+	rendererLabels := []*podmodel.Pod_Label{}
+	for idx := range pc.renderers {
+		if hasRenderer(removed, idx) {
+			newIndexes[idx] = -1
+			continue
+		}
+		newIndexes[idx] = len(renderers)
+		renderers = append(renderers, pc.renderers[idx])
+		rendererLabels = append(rendererLabels, pc.rendererLabels[idx])
+	}
+	pc.renderers = renderers
+	pc.rendererLabels = rendererLabels
+	for idx := range pc.rendererSplits {
+		pc.rendererSplits[idx].oldIdx = newIndexes[pc.rendererSplits[idx].oldIdx]
+		pc.rendererSplits[idx].newIdx = newIndexes[pc.rendererSplits[idx].newIdx]
+	}
+	var orphaned []podmodel.ID
+	for pod, targets := range pc.assignments {
+		newTargets := []int{}
+		for _, idx := range targets {
+			if newIndexes[idx] >= 0 {
+				newTargets = append(newTargets, newIndexes[idx])
+			}
+		}
+		if len(newTargets) == 0 {
+			orphaned = append(orphaned, pod)
+			delete(pc.assignments, pod)
+			continue
+		}
+		pc.assignments[pod] = newTargets
+	}
+	if pc.rulePriorities != nil {
+		rulePriorities := make(map[rulePrioritiesKey]*podRulePriorities)
+		for key, priorities := range pc.rulePriorities {
+			if newIdx := newIndexes[key.renderer]; newIdx >= 0 {
+				rulePriorities[rulePrioritiesKey{pod: key.pod, renderer: newIdx}] = priorities
+			}
+		}
+		pc.rulePriorities = rulePriorities
+	}
+	if pc.unregisteredRenderers != ReassignUnregistered || len(orphaned) == 0 {
+		pc.setLastCommitStatus(nil)
+		return nil
+	}
+
+	// Reassign the orphaned pods.
+	sortPodIDs(orphaned)
+	rendererTxns := make(map[int]renderer.Txn)
+	var wasError error
+	for _, pod := range orphaned {
+		found, podData := pc.Cache.LookupPod(pod)
+		if !found {
+			continue
+		}
+		targets := pc.assignRenderers(podData)
+		rules := pc.rules[pod]
+		var groups *PodRuleGroups
+		if podGroups, hasGroups := pc.groups[pod]; hasGroups {
+			groups = &podGroups
+		}
+		for _, idx := range targets {
+			rTxn, hasTxn := rendererTxns[idx]
+			if !hasTxn {
+				rTxn = pc.renderers[idx].NewTxn(false)
+				rendererTxns[idx] = rTxn
+			}
+			err := pc.render(rTxn, idx, pod, pc.podIPAddresses[pod], rules.Ingress, rules.Egress, groups, nil, false)
+			if err != nil {
+				pc.Log.WithFields(logging.Fields{
+					"pod": pc.logPod(pod),
+					"err": err,
+				}).Error("Renderer is not able to install rules for the pod")
+				wasError = err
+			}
+		}
+		pc.assignments[pod] = targets
+		pc.Log.WithFields(logging.Fields{
+			"pod":       pc.logPod(pod),
+			"renderers": targets,
+		}).Debug("Pod reassigned after renderer unregistration")
+	}
+	if err := pc.commitRenderers(orderedRendererTxns(rendererTxns)); err != nil {
+		wasError = err
+	}
+	pc.setLastCommitStatus(wasError)
+	return wasError
+}
+
+// orderedRendererTxns returns the transactions ordered by the renderer index.
+func orderedRendererTxns(rendererTxns map[int]renderer.Txn) []renderer.Txn {
+	indexes := []int{}
+	for idx := range rendererTxns {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	ordered := []renderer.Txn{}
+	for _, idx := range indexes {
+		ordered = append(ordered, rendererTxns[idx])
+	}
+	return ordered
+}
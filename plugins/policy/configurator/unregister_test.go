@@ -0,0 +1,180 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/contiv"
+	. "github.com/contiv/vpp/mock/policycache"
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+	rendererAPI "github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestUnregisterRenderer(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestUnregisterRenderer")
+
+	// Prepare input data.
+	const (
+		namespace = "default"
+		pod1IP    = "192.168.1.1"
+		pod2IP    = "192.168.1.2"
+		pod3IP    = "192.168.1.3"
+	)
+	pod1 := podmodel.ID{Name: "pod1", Namespace: namespace}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: namespace}
+	pod3 := podmodel.ID{Name: "pod3", Namespace: namespace}
+	dbLabel := podmodel.Pod_Label{Key: "app", Value: "db"}
+	webLabel := podmodel.Pod_Label{Key: "app", Value: "web"}
+
+	// ingress denied completely
+	policy1 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy1", Namespace: namespace},
+		Type: PolicyIngress,
+	}
+	// ingress allowed from pod1 only
+	policy2 := &ContivPolicy{
+		ID:   policymodel.ID{Name: "policy2", Namespace: namespace},
+		Type: PolicyIngress,
+		Matches: []Match{
+			{
+				Type: MatchIngress,
+				Pods: []podmodel.ID{pod1},
+			},
+		},
+	}
+
+	for _, handling := range []UnregisteredRendererHandling{TearDownUnregistered, ReassignUnregistered} {
+		logger.Debugf("Unregistered renderers: %s", handling)
+
+		// Initialize mocks.
+		cache := NewMockPolicyCache()
+		cache.AddPodConfig(pod1, pod1IP)
+		cache.AddPodConfig(pod2, pod2IP, &dbLabel)
+		cache.AddPodConfig(pod3, pod3IP, &webLabel)
+
+		contiv := NewMockContiv()
+		contiv.SetNatLoopbackIP(natLoopbackIP)
+
+		defaultRenderer := NewMockRenderer("default", logger)
+		dbRenderer := NewMockRenderer("db", logger)
+		webRenderer := NewMockRenderer("web", logger)
+
+		// Initialize configurator.
+		configurator := &PolicyConfigurator{
+			Deps: Deps{
+				Log:    logger,
+				Cache:  cache,
+				Contiv: contiv,
+			},
+		}
+		configurator.Init(false, WithUnregisteredRenderers(handling))
+
+		// Register default and two labeled renderers.
+		err := configurator.RegisterRenderer(defaultRenderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterLabeledRenderer(dbLabel, dbRenderer)
+		gomega.Expect(err).To(gomega.BeNil())
+		err = configurator.RegisterLabeledRenderer(webLabel, webRenderer)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Run single transaction.
+		txn := configurator.NewTxn(false)
+		txn.Configure(pod1, []*ContivPolicy{policy1})
+		txn.Configure(pod2, []*ContivPolicy{policy1})
+		txn.Configure(pod3, []*ContivPolicy{policy1})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+		ip, _ := dbRenderer.GetPodIP(pod2)
+		gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+
+		// Default renderers and unknown labels cannot be unregistered.
+		err = configurator.UnregisterRenderer(podmodel.Pod_Label{})
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		err = configurator.UnregisterRenderer(podmodel.Pod_Label{Key: "app", Value: "cache"})
+		gomega.Expect(err).ToNot(gomega.BeNil())
+
+		// Renderer failing to remove the rules remains registered.
+		dbRenderer.SetCommitError(errors.New("renderer failure"))
+		err = configurator.UnregisterRenderer(dbLabel)
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		dbRenderer.SetCommitError(nil)
+		ip, _ = dbRenderer.GetPodIP(pod2)
+		gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+		err = configurator.RequestResync(dbLabel)
+		gomega.Expect(err).To(gomega.BeNil())
+
+		// Unregister the renderer.
+		err = configurator.UnregisterRenderer(dbLabel)
+		gomega.Expect(err).To(gomega.BeNil())
+		ip, _ = dbRenderer.GetPodIP(pod2)
+		gomega.Expect(ip).To(gomega.BeEmpty())
+		err = configurator.RequestResync(dbLabel)
+		gomega.Expect(err).ToNot(gomega.BeNil())
+		gomega.Expect(configurator.ConfiguredPods()).To(gomega.ConsistOf(pod1, pod2, pod3))
+
+		ip, _ = defaultRenderer.GetPodIP(pod2)
+		if handling == ReassignUnregistered {
+			// The pod is handed over to the default renderer.
+			gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+			action := defaultRenderer.TestTraffic(pod2, EgressTraffic,
+				parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+			gomega.Expect(action).To(gomega.BeEquivalentTo(DeniedTraffic))
+		} else {
+			// The pod is left without rules until re-configured.
+			gomega.Expect(ip).To(gomega.BeEmpty())
+		}
+
+		// Other renderers are not affected.
+		ip, _ = defaultRenderer.GetPodIP(pod1)
+		gomega.Expect(ip).To(gomega.BeEquivalentTo(pod1IP))
+		ip, _ = webRenderer.GetPodIP(pod3)
+		gomega.Expect(ip).To(gomega.BeEquivalentTo(pod3IP))
+
+		// Pods are still routed correctly by the next transaction.
+		dbCommits := dbRenderer.GetCommitCount()
+		txn = configurator.NewTxn(false)
+		txn.Configure(pod2, []*ContivPolicy{policy2})
+		txn.Configure(pod3, []*ContivPolicy{policy2})
+		err = txn.Commit()
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(dbRenderer.GetCommitCount()).To(gomega.Equal(dbCommits))
+
+		ip, _ = defaultRenderer.GetPodIP(pod2)
+		gomega.Expect(ip).To(gomega.BeEquivalentTo(pod2IP))
+		action := defaultRenderer.TestTraffic(pod2, EgressTraffic,
+			parseIP(pod1IP), parseIP(pod2IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		action = webRenderer.TestTraffic(pod3, EgressTraffic,
+			parseIP(pod1IP), parseIP(pod3IP), rendererAPI.TCP, 123, 80)
+		gomega.Expect(action).To(gomega.BeEquivalentTo(AllowedTraffic))
+		ip, _ = defaultRenderer.GetPodIP(pod3)
+		gomega.Expect(ip).To(gomega.BeEmpty())
+	}
+}
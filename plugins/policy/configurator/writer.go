@@ -0,0 +1,73 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// bufferPool is a pool of buffers used by String() methods.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buffer back to the pool.
+func putBuffer(buf *bytes.Buffer) {
+	bufferPool.Put(buf)
+}
+
+// stringWriter writes strings into the underlying writer, counting
+// the written bytes and remembering the first error (further writes are
+// then skipped).
+type stringWriter struct {
+	w       io.Writer
+	n       int64
+	err     error
+	scratch [20]byte
+}
+
+// write writes a string.
+func (sw *stringWriter) write(s string) {
+	if sw.err != nil {
+		return
+	}
+	n, err := io.WriteString(sw.w, s)
+	sw.n += int64(n)
+	sw.err = err
+}
+
+// writeUint writes a decimal representation of an unsigned integer.
+func (sw *stringWriter) writeUint(u uint64) {
+	if sw.err != nil {
+		return
+	}
+	n, err := sw.w.Write(strconv.AppendUint(sw.scratch[:0], u, 10))
+	sw.n += int64(n)
+	sw.err = err
+}
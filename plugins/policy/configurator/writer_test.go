@@ -0,0 +1,243 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package configurator
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	policymodel "github.com/contiv/vpp/plugins/ksr/model/policy"
+)
+
+// concatMatchString is the original implementation of Match.String(),
+// kept to verify that the output is unchanged and to compare allocations.
+func concatMatchString(m Match) string {
+	pods := "<nil>"
+	if m.Pods != nil {
+		pods = "["
+		for idx, pod := range m.Pods {
+			pods += pod.String()
+			if idx < len(m.Pods)-1 {
+				pods += ", "
+			}
+		}
+		pods += "]"
+	}
+
+	blocks := "<nil>"
+	if m.IPBlocks != nil {
+		blocks = "["
+		for idx, block := range m.IPBlocks {
+			blocks += concatIPBlockString(block)
+			if idx < len(m.IPBlocks)-1 {
+				blocks += ", "
+			}
+		}
+		blocks += "]"
+	}
+
+	masks := ""
+	if m.IPMasks != nil {
+		masks = ", Masks:["
+		for idx, mask := range m.IPMasks {
+			masks += mask.String()
+			if idx < len(m.IPMasks)-1 {
+				masks += ", "
+			}
+		}
+		masks += "]"
+	}
+
+	fqdns := ""
+	if m.FQDNs != nil {
+		fqdns = ", FQDNs:[" + strings.Join(m.FQDNs, ", ") + "]"
+	}
+
+	ports := "<nil>"
+	if m.Ports != nil {
+		ports = "["
+		for idx, port := range m.Ports {
+			ports += port.String()
+			if idx < len(m.Ports)-1 {
+				ports += ", "
+			}
+		}
+		ports += "]"
+	}
+	return fmt.Sprintf("<Type:%s, Pods:%s, Blocks:%s%s%s, Ports:%s>",
+		m.Type, pods, blocks, masks, fqdns, ports)
+}
+
+// concatIPBlockString is the original implementation of IPBlock.String().
+func concatIPBlockString(ipb IPBlock) string {
+	excepts := ""
+	for idx, except := range ipb.Except {
+		excepts += except.String()
+		if idx < len(ipb.Except)-1 {
+			excepts += ", "
+		}
+	}
+	return fmt.Sprintf("<Net:%s, Except:[%s]>",
+		ipb.Network, excepts)
+}
+
+// concatPolicyString is the original implementation of ContivPolicy.String().
+func concatPolicyString(cp ContivPolicy) string {
+	matches := ""
+	for idx, match := range cp.Matches {
+		matches += concatMatchString(match)
+		if idx < len(cp.Matches)-1 {
+			matches += ", "
+		}
+	}
+	return fmt.Sprintf("ContivPolicy %s <Type:%s, Matches:[%s]>",
+		cp.ID, cp.Type, matches)
+}
+
+func testMatches() []Match {
+	return []Match{
+		{},
+		{
+			Type:     MatchEgress,
+			Pods:     []podmodel.ID{},
+			IPBlocks: []IPBlock{},
+			Ports:    []Port{},
+		},
+		{
+			Type: MatchIngress,
+			Pods: []podmodel.ID{
+				{Name: "pod1", Namespace: "default"},
+				{Name: "pod2", Namespace: "other"},
+			},
+			IPBlocks: []IPBlock{
+				{Network: *ipNetwork("10.0.0.0/8")},
+				{
+					Network: *ipNetwork("192.168.0.0/16"),
+					Except: []net.IPNet{
+						*ipNetwork("192.168.1.0/24"),
+						*ipNetwork("192.168.2.1/32"),
+					},
+				},
+				{},
+			},
+			IPMasks: []IPMask{
+				{Address: net.ParseIP("10.0.0.1"), Mask: net.IPv4Mask(255, 0, 0, 255)},
+			},
+			FQDNs: []string{"example.com", "api.example.com"},
+			Ports: []Port{
+				{Protocol: TCP, Number: 0},
+				{Protocol: UDP, Number: 53},
+				{Protocol: TCP, Number: 65535},
+			},
+		},
+	}
+}
+
+func TestMatchWriteTo(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	for _, match := range testMatches() {
+		expected := concatMatchString(match)
+		gomega.Expect(match.String()).To(gomega.Equal(expected))
+
+		buf := &bytes.Buffer{}
+		n, err := match.WriteTo(buf)
+		gomega.Expect(err).To(gomega.BeNil())
+		gomega.Expect(n).To(gomega.BeEquivalentTo(len(expected)))
+		gomega.Expect(buf.String()).To(gomega.Equal(expected))
+
+		for _, block := range match.IPBlocks {
+			gomega.Expect(block.String()).To(gomega.Equal(concatIPBlockString(block)))
+		}
+	}
+
+	policy := ContivPolicy{
+		ID:      policymodel.ID{Name: "policy1", Namespace: "default"},
+		Type:    PolicyAll,
+		Matches: testMatches(),
+	}
+	expected := concatPolicyString(policy)
+	gomega.Expect(policy.String()).To(gomega.Equal(expected))
+	buf := &bytes.Buffer{}
+	n, err := policy.WriteTo(buf)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(n).To(gomega.BeEquivalentTo(len(expected)))
+	gomega.Expect(buf.String()).To(gomega.Equal(expected))
+	gomega.Expect(ContivPolicy{}.String()).To(gomega.Equal(concatPolicyString(ContivPolicy{})))
+}
+
+func TestPolicyStringSourceAndExpiration(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	id := policymodel.ID{Name: "policy1", Namespace: "default"}
+	expiresAt := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	plain := &ContivPolicy{ID: id, Type: PolicyIngress}
+	sourced := &ContivPolicy{ID: id, Type: PolicyIngress, Source: "ctrl"}
+	expiring := &ContivPolicy{ID: id, Type: PolicyIngress, ExpiresAt: expiresAt}
+	later := &ContivPolicy{ID: id, Type: PolicyIngress, ExpiresAt: expiresAt.Add(time.Hour)}
+
+	gomega.Expect(sourced.String()).To(gomega.Equal(
+		"ContivPolicy default/policy1 <Type:INGRESS, Matches:[], Source:ctrl>"))
+	gomega.Expect(expiring.String()).To(gomega.Equal(
+		"ContivPolicy default/policy1 <Type:INGRESS, Matches:[], ExpiresAt:2018-05-01T12:00:00Z>"))
+
+	// Policies differing only in the expiration are strictly ordered.
+	sorted1 := ContivPolicies{plain, later, expiring}
+	sorted2 := ContivPolicies{later, expiring, plain}
+	sort.Sort(sorted1)
+	sort.Sort(sorted2)
+	for idx := range sorted1 {
+		gomega.Expect(sorted1[idx]).To(gomega.BeIdenticalTo(sorted2[idx]))
+	}
+}
+
+func BenchmarkMatchString(b *testing.B) {
+	gomega.RegisterTestingT(b)
+	match := testMatches()[2]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = match.String()
+	}
+}
+
+func BenchmarkMatchStringConcat(b *testing.B) {
+	gomega.RegisterTestingT(b)
+	match := testMatches()[2]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = concatMatchString(match)
+	}
+}
+
+func BenchmarkMatchWriteTo(b *testing.B) {
+	gomega.RegisterTestingT(b)
+	match := testMatches()[2]
+	buf := &bytes.Buffer{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		match.WriteTo(buf)
+	}
+}
@@ -18,8 +18,10 @@ package renderer
 
 import (
 	"fmt"
+	"math/bits"
 	"net"
 	"strconv"
+	"strings"
 
 	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
 	"github.com/contiv/vpp/plugins/policy/utils"
@@ -40,6 +42,208 @@ type PolicyRendererAPI interface {
 	NewTxn(resync bool) Txn
 }
 
+// Capability is a feature of Contiv rules beyond the basic n-tuple, which
+// not every destination network stack is able to implement.
+type Capability int
+
+const (
+	// MaskedMatch is the ability to match IP addresses by non-contiguous
+	// (wildcard) masks, i.e. SrcNetwork/DestNetwork with non-canonical mask.
+	MaskedMatch Capability = iota
+
+	// NetworkScoping is the ability to install rules only on the pod interface
+	// connected into a given pod network (see ContivRule.Network), for pods
+	// attached into multiple networks.
+	NetworkScoping
+
+	// Policing is the ability to limit the rate of the traffic permitted
+	// by a rule (see ContivRule.RateLimit).
+	Policing
+
+	// PacketLength is the ability to match packets by their length
+	// (see ContivRule.PacketLen).
+	PacketLength
+
+	// RuleGroups is the ability to install groups of rules shared between
+	// pods with different (but overlapping) sets of rules (see GroupTxn).
+	RuleGroups
+
+	// CombinedRules is the ability to install ingress and egress rules
+	// of a pod as a single ordered list (see CombinedTxn), e.g. for network
+	// stacks with one table shared by both directions.
+	CombinedRules
+
+	// IncrementalUpdate is the ability to apply changes of the rules of a pod
+	// as deltas against the previously rendered rules (see DeltaTxn).
+	IncrementalUpdate
+
+	// SourcePortMatch is the ability to match traffic by the L4 source port
+	// (see ContivRule.SrcPort).
+	SourcePortMatch
+
+	// ConntrackZones is the ability to isolate connection tracking state
+	// of pods in per-pod zones (see ZonedTxn).
+	ConntrackZones
+
+	// L7Filtering is the ability to restrict permitted traffic by HTTP
+	// request attributes (see ContivRule.L7), e.g. by configuring
+	// an L7 proxy (sidecar) of the pod.
+	L7Filtering
+
+	// ConnRateLimiting is the ability to limit the rate of new connections
+	// permitted by a rule (see ContivRule.ConnRateLimit), e.g. with session
+	// limits of the network stack.
+	ConnRateLimiting
+
+	// FragmentMatching is the ability to install rules matching only
+	// non-initial IP fragments (see ContivRule.Fragments).
+	FragmentMatching
+
+	// TCPFlagMatching is the ability to match TCP segments by the flags set
+	// or cleared in the header (see ContivRule.TCPFlags).
+	TCPFlagMatching
+
+	// TunnelMatching is the ability to match encapsulated traffic by the tunnel
+	// metadata, i.e. by the VNI of GENEVE/VXLAN (see ContivRule.TunnelVNI).
+	TunnelMatching
+
+	// ExplicitPriorities is the ability to install rules with priority
+	// (sequence) numbers assigned by the configurator (see PrioritizedTxn),
+	// e.g. for ACL-based network stacks.
+	ExplicitPriorities
+
+	// OrderedRules is the ability to evaluate rules in the order they are
+	// given (first match wins), required for lists with DENY rules preceding
+	// the last rule. Renderers based on renderer/cache do not have it,
+	// the cache re-sorts the rules (see ContivRule.Compare()).
+	OrderedRules
+)
+
+// String converts Capability into a human-readable string.
+func (c Capability) String() string {
+	switch c {
+	case MaskedMatch:
+		return "MASKED-MATCH"
+	case NetworkScoping:
+		return "NETWORK-SCOPING"
+	case Policing:
+		return "POLICING"
+	case RuleGroups:
+		return "RULE-GROUPS"
+	case PacketLength:
+		return "PACKET-LENGTH"
+	case CombinedRules:
+		return "COMBINED-RULES"
+	case IncrementalUpdate:
+		return "INCREMENTAL-UPDATE"
+	case SourcePortMatch:
+		return "SOURCE-PORT-MATCH"
+	case ConntrackZones:
+		return "CONNTRACK-ZONES"
+	case L7Filtering:
+		return "L7-FILTERING"
+	case ConnRateLimiting:
+		return "CONN-RATE-LIMITING"
+	case FragmentMatching:
+		return "FRAGMENT-MATCHING"
+	case TCPFlagMatching:
+		return "TCP-FLAG-MATCH"
+	case TunnelMatching:
+		return "TUNNEL-MATCH"
+	case ExplicitPriorities:
+		return "EXPLICIT-PRIORITIES"
+	case OrderedRules:
+		return "ORDERED-RULES"
+	}
+	return "INVALID"
+}
+
+// CapabilityAdvertiser is an optional interface that a renderer may implement
+// to advertise the supported rule features beyond the basic n-tuple.
+// Renderers not implementing the interface are assumed not to support any.
+type CapabilityAdvertiser interface {
+	// HasCapability returns true if the renderer is able to render rules
+	// using the given feature.
+	HasCapability(capability Capability) bool
+}
+
+// RuleFormat is a version of the format of Contiv rules. Every field
+// of ContivRule is introduced in a version of the format, renderers supporting
+// only an older version are given the rules without the newer fields.
+type RuleFormat int
+
+const (
+	// RuleFormatV1 is the basic n-tuple rule: Action, SrcNetwork, DestNetwork,
+	// Protocol, SrcPort and DestPort.
+	RuleFormatV1 RuleFormat = iota + 1
+
+	// RuleFormatV2 adds Network, RateLimit, ConnRateLimit, PacketLen,
+	// Fragments, L7, TCPFlags, TunnelVNI and Description.
+	RuleFormatV2
+
+	// CurrentRuleFormat is the latest version of the rule format.
+	CurrentRuleFormat = RuleFormatV2
+)
+
+// String converts RuleFormat into a human-readable string.
+func (rf RuleFormat) String() string {
+	switch rf {
+	case RuleFormatV1:
+		return "V1"
+	case RuleFormatV2:
+		return "V2"
+	}
+	return "INVALID"
+}
+
+// RuleFormatAdvertiser is an optional interface that a renderer may implement
+// to advertise the latest version of the rule format it understands,
+// for gradual upgrades of renderers. Renderers not implementing the interface
+// are assumed to support only RuleFormatV1, i.e. the fields introduced later
+// are never given to a renderer which has not declared it understands them.
+type RuleFormatAdvertiser interface {
+	// SupportedRuleFormat returns the latest supported version of the rule
+	// format.
+	SupportedRuleFormat() RuleFormat
+}
+
+// RuleCost is the estimated cost of installing rules into a renderer.
+type RuleCost struct {
+	// TableEntries is the number of entries occupied in the tables
+	// of the destination network stack.
+	TableEntries uint64
+
+	// MemoryBytes is the amount of memory consumed in the destination
+	// network stack.
+	MemoryBytes uint64
+}
+
+// Add returns the sum of both costs.
+func (rc RuleCost) Add(other RuleCost) RuleCost {
+	return RuleCost{
+		TableEntries: rc.TableEntries + other.TableEntries,
+		MemoryBytes:  rc.MemoryBytes + other.MemoryBytes,
+	}
+}
+
+// CostEstimator is an optional interface that a renderer may implement
+// to advertise the cost of installing rules, used for capacity planning.
+type CostEstimator interface {
+	// EstimateRuleCost returns the estimated cost of installing the rule
+	// (without any sharing of rules between pods).
+	EstimateRuleCost(rule *ContivRule) RuleCost
+}
+
+// RuleReader is an optional interface that a renderer may implement to read
+// back the installed rules, used to verify the consistency of renderers with
+// the configurator.
+type RuleReader interface {
+	// InstalledRules returns the rules installed for the pod, in the form
+	// they were given to Render(). The order of the rules is not significant.
+	// <configured> is false if the renderer has no configuration for the pod.
+	InstalledRules(pod podmodel.ID) (ingress, egress []*ContivRule, configured bool)
+}
+
 // Txn defines API of PolicyRenderer transaction.
 type Txn interface {
 	// Render applies the set of ingress & egress rules for a given pod.
@@ -53,13 +257,189 @@ type Txn interface {
 	// Empty set of rules should allow any traffic in that direction.
 	// The flag *removed* is set to true if the pod was just removed - in such
 	// case *podIP* may be nil and both list of rules are empty.
+	// Pods with the same set of policies may be given the same instances
+	// of rules, therefore the renderer should not modify them (unless rule
+	// sharing is disabled in the configurator).
 	Render(pod podmodel.ID, podIP *net.IPNet /* one host subnet */, ingress []*ContivRule, egress []*ContivRule, removed bool) Txn
 
 	// Commit proceeds with the rendering. The changes are propagated into
 	// the destination network stack.
+	// Errors which may disappear if the commit is repeated should implement
+	// TransientError. The same transaction may be then committed again.
 	Commit() error
 }
 
+// TransientError should be implemented by errors returned from Txn.Commit()
+// when the failure is only temporary (e.g. the destination network stack
+// is busy) and the same transaction may succeed if committed again.
+type TransientError interface {
+	error
+
+	// Transient returns true if the failure is only temporary.
+	Transient() bool
+}
+
+// IsTransient returns true if the error implements TransientError
+// and reports the failure as temporary.
+func IsTransient(err error) bool {
+	transientErr, isTransientErr := err.(TransientError)
+	return isTransientErr && transientErr.Transient()
+}
+
+// TransientErrorf formats an error implementing TransientError.
+func TransientErrorf(format string, args ...interface{}) error {
+	return transientError(fmt.Sprintf(format, args...))
+}
+
+// transientError is the TransientError returned by TransientErrorf.
+type transientError string
+
+// Error returns the error message.
+func (e transientError) Error() string {
+	return string(e)
+}
+
+// Transient always returns true.
+func (e transientError) Transient() bool {
+	return true
+}
+
+// GroupTxn is an optional interface of renderer transactions, used
+// for renderers with the RuleGroups capability if the configurator has
+// the rule grouping enabled.
+type GroupTxn interface {
+	// RenderGroups is an alternative to Render(), with the rules of the pod
+	// factored into groups which are shared between pods. The rules to apply
+	// for the pod in each direction are the rules of the groups concatenated
+	// in the given order. All groups but the last one contain only permit
+	// rules, the order of the groups (except for the last one) does not
+	// therefore change what traffic is allowed.
+	// Groups with the same ID contain the same rules, also across
+	// transactions, and the renderer may therefore install each of them only
+	// once and reference it from every pod. Unless rule sharing is disabled
+	// in the configurator, groups with the same ID passed within a transaction
+	// are also the same instances, which must not be modified.
+	// For removed pods both lists of groups are empty.
+	RenderGroups(pod podmodel.ID, podIP *net.IPNet, ingress []*RuleGroup, egress []*RuleGroup, removed bool) Txn
+}
+
+// RuleGroup is a named list of Contiv rules which can be shared between pods.
+type RuleGroup struct {
+	// ID identifies the group and its content.
+	ID string
+
+	// Rules of the group.
+	Rules []*ContivRule
+}
+
+// CombinedTxn is an optional interface of renderer transactions, used
+// for renderers with the CombinedRules capability if the configurator has
+// the combined rules enabled.
+type CombinedTxn interface {
+	// RenderCombined is an alternative to Render(), with the ingress and egress
+	// rules of the pod merged into one list, each rule tagged with its
+	// direction. All rules of one direction precede all rules of the other
+	// one (the order of directions is selected in the configurator) and rules
+	// of each direction keep the order they would have in Render().
+	// For removed pods the list is empty. The same rule instances as in
+	// Render() may be shared between pods and must not be modified.
+	RenderCombined(pod podmodel.ID, podIP *net.IPNet, rules []*DirectedRule, removed bool) Txn
+}
+
+// DeltaTxn is an optional interface of renderer transactions, used
+// for renderers with the IncrementalUpdate capability.
+type DeltaTxn interface {
+	// RenderDelta is an alternative to Render() for a pod already rendered
+	// by a previous (successfully committed) transaction, with the same IP
+	// address. Only the changes of the ingress and egress rules are given.
+	// The last rule of each list (deny-the-rest) is never added or removed
+	// by a delta, added rules should be installed before it. All the other
+	// rules permit traffic and their order has no effect on what is allowed,
+	// the delta therefore does not convey the position of the added rules.
+	// Pods with rules that cannot be expressed by a delta (e.g. becoming
+	// restricted for the first time) are passed to Render() instead.
+	RenderDelta(pod podmodel.ID, podIP *net.IPNet, ingress RuleDelta, egress RuleDelta) Txn
+}
+
+// ZonedTxn is an optional interface of renderer transactions, used
+// for renderers with the ConntrackZones capability.
+type ZonedTxn interface {
+	// SetConntrackZone assigns the connection tracking zone to the pod
+	// rendered in the transaction (called after the rules of the pod were
+	// given). Each pod is assigned a distinct zone, stable for as long as
+	// the pod stays configured. Connection state of the traffic of the pod
+	// should be tracked only within its zone.
+	SetConntrackZone(pod podmodel.ID, zone ConntrackZone) Txn
+}
+
+// PrioritizedTxn is an optional interface of renderer transactions, used
+// for renderers with the ExplicitPriorities capability.
+type PrioritizedTxn interface {
+	// SetRulePriorities assigns priority numbers to the rules of the pod
+	// given to Render() in the transaction (called after the rules).
+	// The i-th number belongs to the i-th rule of the list. The numbers
+	// strictly increase along the list, i.e. rules with lower numbers are
+	// to be evaluated first, and unchanged rules of the pod keep their
+	// numbers across transactions whenever possible.
+	SetRulePriorities(pod podmodel.ID, ingress, egress []RulePriority) Txn
+}
+
+// RulePriority is a priority (sequence) number of a rule. Zero is never
+// assigned.
+type RulePriority uint32
+
+// ConntrackZone identifies a connection tracking zone. Zero value
+// (the default zone of most network stacks) is never assigned to a pod.
+type ConntrackZone uint16
+
+// RuleDelta describes changes of a list of rules. Rules are matched by their
+// content (see ContivRule.Compare()), not by instances.
+type RuleDelta struct {
+	// Removed lists rules no longer present in the list.
+	Removed []*ContivRule
+
+	// Added lists new rules of the list.
+	Added []*ContivRule
+}
+
+// IsEmpty returns true if the list of rules does not change.
+func (rd RuleDelta) IsEmpty() bool {
+	return len(rd.Removed) == 0 && len(rd.Added) == 0
+}
+
+// RuleDirection is the direction of a rule from the vswitch point of view.
+type RuleDirection int
+
+const (
+	// IngressRule applies to the traffic coming from the pod into the vswitch.
+	IngressRule RuleDirection = iota
+
+	// EgressRule applies to the traffic leaving the vswitch towards the pod.
+	EgressRule
+)
+
+// String converts RuleDirection into a human-readable string.
+func (rd RuleDirection) String() string {
+	switch rd {
+	case IngressRule:
+		return "INGRESS"
+	case EgressRule:
+		return "EGRESS"
+	}
+	return "INVALID"
+}
+
+// DirectedRule is a Contiv rule tagged with its direction.
+type DirectedRule struct {
+	Direction RuleDirection
+	Rule      *ContivRule
+}
+
+// String converts DirectedRule into a human-readable string.
+func (dr *DirectedRule) String() string {
+	return dr.Direction.String() + " " + dr.Rule.String()
+}
+
 // ContivRule is an n-tuple with the most basic policy rule definition that the
 // destination network stack must support.
 type ContivRule struct {
@@ -72,8 +452,213 @@ type ContivRule struct {
 
 	// L4
 	Protocol ProtocolType
-	SrcPort  uint16 // 0 = match all
+	SrcPort  uint16 // 0 = match all, otherwise requires SourcePortMatch
 	DestPort uint16 // 0 = match all
+
+	// Network selects the pod network (i.e. the pod interface) that the rule
+	// should be installed on. Empty = all networks (interfaces) of the pod.
+	// Requires the NetworkScoping capability.
+	Network string
+
+	// RateLimit optionally limits the rate of the permitted traffic.
+	// nil = not limited. Requires the Policing capability.
+	RateLimit *RateSpec
+
+	// ConnRateLimit optionally limits the rate of new connections permitted
+	// by the rule. nil = not limited. Requires the ConnRateLimiting capability.
+	ConnRateLimit *ConnRateSpec
+
+	// PacketLen optionally restricts the rule to packets with the length
+	// within the range. nil = any length. Requires the PacketLength capability.
+	PacketLen *LenRange
+
+	// Fragments selects whether the rule matches only non-initial fragments
+	// of IP packets, which carry no L4 header (ports of such rules are unset).
+	// FragmentsOnly requires the FragmentMatching capability.
+	Fragments FragmentMatch
+
+	// L7 optionally restricts the permitted traffic to matching HTTP requests.
+	// nil = not restricted. Requires the L7Filtering capability.
+	L7 *L7Match
+
+	// TCPFlags optionally restricts the rule to TCP segments with the given
+	// flags set and cleared. Used only with Protocol TCP, nil = any flags.
+	// Requires the TCPFlagMatching capability.
+	TCPFlags *TCPFlagMatch
+
+	// TunnelVNI optionally restricts the rule to traffic encapsulated in
+	// GENEVE/VXLAN tunnel with the given VNI (virtual network identifier),
+	// nil = any traffic. Requires the TunnelMatching capability.
+	TunnelVNI *uint32
+
+	// Description is an optional human-readable description of the rule,
+	// e.g. of the policy match the rule was generated from. It is purely
+	// informational: ignored by Compare() and not included in String(),
+	// so that rules differing only in the description are equal.
+	Description string
+}
+
+// RateSpec describes a policer: the allowed rate of the traffic
+// and the burst size.
+type RateSpec struct {
+	BitsPerSecond uint64
+	BurstBytes    uint64
+}
+
+// String converts RateSpec into a human-readable string.
+func (rs *RateSpec) String() string {
+	return fmt.Sprintf("%dbps/%dB", rs.BitsPerSecond, rs.BurstBytes)
+}
+
+// FragmentMatch selects which IP packets the rule matches with respect
+// to fragmentation.
+type FragmentMatch int
+
+const (
+	// AllPackets matches packets regardless of fragmentation, i.e. as done
+	// by the network stack for rules without fragment handling.
+	AllPackets FragmentMatch = iota
+
+	// FragmentsOnly matches only non-initial fragments of IP packets.
+	FragmentsOnly
+)
+
+// String converts FragmentMatch into a human-readable string.
+func (fm FragmentMatch) String() string {
+	switch fm {
+	case AllPackets:
+		return "ALL-PACKETS"
+	case FragmentsOnly:
+		return "FRAGMENTS-ONLY"
+	}
+	return "INVALID"
+}
+
+// ConnRateSpec describes a connection-rate policer: the allowed rate of new
+// connections and the burst size. Connections above the rate are dropped.
+type ConnRateSpec struct {
+	ConnsPerSecond uint64
+	Burst          uint64
+
+	// PerPeer selects whether the rate applies to each peer (source IP
+	// for ingress, destination IP for egress) separately. Otherwise it applies
+	// to all connections matched by the rule together.
+	PerPeer bool
+}
+
+// String converts ConnRateSpec into a human-readable string.
+func (crs *ConnRateSpec) String() string {
+	if crs.PerPeer {
+		return fmt.Sprintf("%dcps/%d/peer", crs.ConnsPerSecond, crs.Burst)
+	}
+	return fmt.Sprintf("%dcps/%d", crs.ConnsPerSecond, crs.Burst)
+}
+
+// LenRange is an inclusive range of packet lengths (whole IP packet) in bytes.
+type LenRange struct {
+	Min uint16
+	Max uint16
+}
+
+// String converts LenRange into a human-readable string.
+func (lr *LenRange) String() string {
+	return fmt.Sprintf("%d-%dB", lr.Min, lr.Max)
+}
+
+// L7Match describes HTTP requests permitted by a rule. Empty fields match
+// anything.
+type L7Match struct {
+	Method     string
+	PathPrefix string
+	Host       string
+}
+
+// String converts L7Match into a human-readable string.
+func (lm *L7Match) String() string {
+	const any = "ANY"
+	method := any
+	if lm.Method != "" {
+		method = lm.Method
+	}
+	host := any
+	if lm.Host != "" {
+		host = lm.Host
+	}
+	return fmt.Sprintf("%s %s%s*", method, host, lm.PathPrefix)
+}
+
+// TCPFlags is a set of TCP flags, with the bit values of the TCP header.
+type TCPFlags uint8
+
+const (
+	// TCPFlagFIN is the FIN flag.
+	TCPFlagFIN TCPFlags = 0x01
+
+	// TCPFlagSYN is the SYN flag.
+	TCPFlagSYN TCPFlags = 0x02
+
+	// TCPFlagRST is the RST flag.
+	TCPFlagRST TCPFlags = 0x04
+
+	// TCPFlagACK is the ACK flag.
+	TCPFlagACK TCPFlags = 0x10
+)
+
+// tcpFlagNames lists the supported flags in the order used by String().
+var tcpFlagNames = []struct {
+	flag TCPFlags
+	name string
+}{
+	{TCPFlagSYN, "SYN"},
+	{TCPFlagACK, "ACK"},
+	{TCPFlagFIN, "FIN"},
+	{TCPFlagRST, "RST"},
+}
+
+// String converts TCPFlags into a human-readable string, e.g. SYN|ACK.
+func (tf TCPFlags) String() string {
+	var names []string
+	for _, flag := range tcpFlagNames {
+		if tf&flag.flag != 0 {
+			names = append(names, flag.name)
+		}
+	}
+	if len(names) == 0 {
+		return "NONE"
+	}
+	return strings.Join(names, "|")
+}
+
+// TCPFlagMatch describes TCP segments by flags which must be set (Required)
+// and which must be cleared (Forbidden). Other flags may have any value.
+type TCPFlagMatch struct {
+	Required  TCPFlags
+	Forbidden TCPFlags
+}
+
+// Mask returns the set of flags examined by the match.
+func (tfm *TCPFlagMatch) Mask() TCPFlags {
+	return tfm.Required | tfm.Forbidden
+}
+
+// String converts TCPFlagMatch into a human-readable string, with required
+// flags prefixed by + and forbidden ones by -, e.g. +SYN-ACK.
+func (tfm *TCPFlagMatch) String() string {
+	str := ""
+	for _, flag := range tcpFlagNames {
+		if tfm.Required&flag.flag != 0 {
+			str += "+" + flag.name
+		}
+	}
+	for _, flag := range tcpFlagNames {
+		if tfm.Forbidden&flag.flag != 0 {
+			str += "-" + flag.name
+		}
+	}
+	if str == "" {
+		return "ANY"
+	}
+	return str
 }
 
 // String converts Contiv Rule (pointer) into a human-readable string
@@ -96,17 +681,122 @@ func (cr *ContivRule) String() string {
 	if cr.DestPort != 0 {
 		dstPort = strconv.Itoa(int(cr.DestPort))
 	}
-	return fmt.Sprintf("Rule <%s %s[%s:%s] -> %s[%s:%s]>",
-		cr.Action, srcNet, cr.Protocol, srcPort, dstNet, cr.Protocol, dstPort)
+	network := ""
+	if cr.Network != "" {
+		network = " @" + cr.Network
+	}
+	rateLimit := ""
+	if cr.RateLimit != nil {
+		rateLimit = " rate=" + cr.RateLimit.String()
+	}
+	connRateLimit := ""
+	if cr.ConnRateLimit != nil {
+		connRateLimit = " connrate=" + cr.ConnRateLimit.String()
+	}
+	packetLen := ""
+	if cr.PacketLen != nil {
+		packetLen = " len=" + cr.PacketLen.String()
+	}
+	fragments := ""
+	if cr.Fragments == FragmentsOnly {
+		fragments = " fragments"
+	}
+	l7 := ""
+	if cr.L7 != nil {
+		l7 = " l7=" + cr.L7.String()
+	}
+	tcpFlags := ""
+	if cr.TCPFlags != nil {
+		tcpFlags = " flags=" + cr.TCPFlags.String()
+	}
+	tunnelVNI := ""
+	if cr.TunnelVNI != nil {
+		tunnelVNI = " vni=" + strconv.FormatUint(uint64(*cr.TunnelVNI), 10)
+	}
+	return fmt.Sprintf("Rule <%s %s[%s:%s] -> %s[%s:%s]%s%s%s%s%s%s%s%s>",
+		cr.Action, srcNet, cr.Protocol, srcPort, dstNet, cr.Protocol, dstPort, network, rateLimit, connRateLimit,
+		packetLen, fragments, l7, tcpFlags, tunnelVNI)
 }
 
 // Copy creates a deep copy of the Contiv rule.
 func (cr *ContivRule) Copy() *ContivRule {
 	crCopy := &ContivRule{}
 	*(crCopy) = *cr
+	if cr.RateLimit != nil {
+		rateLimit := *cr.RateLimit
+		crCopy.RateLimit = &rateLimit
+	}
+	if cr.ConnRateLimit != nil {
+		connRateLimit := *cr.ConnRateLimit
+		crCopy.ConnRateLimit = &connRateLimit
+	}
+	if cr.PacketLen != nil {
+		packetLen := *cr.PacketLen
+		crCopy.PacketLen = &packetLen
+	}
+	if cr.L7 != nil {
+		l7 := *cr.L7
+		crCopy.L7 = &l7
+	}
+	if cr.TCPFlags != nil {
+		tcpFlags := *cr.TCPFlags
+		crCopy.TCPFlags = &tcpFlags
+	}
+	if cr.TunnelVNI != nil {
+		tunnelVNI := *cr.TunnelVNI
+		crCopy.TunnelVNI = &tunnelVNI
+	}
 	return crCopy
 }
 
+// RequiredCapabilities returns the list of capabilities that a renderer
+// must have in order to render the rule.
+func (cr *ContivRule) RequiredCapabilities() []Capability {
+	var capabilities []Capability
+	if !utils.IsContiguousMask(cr.SrcNetwork.Mask) || !utils.IsContiguousMask(cr.DestNetwork.Mask) {
+		capabilities = append(capabilities, MaskedMatch)
+	}
+	if cr.Network != "" {
+		capabilities = append(capabilities, NetworkScoping)
+	}
+	if cr.RateLimit != nil {
+		capabilities = append(capabilities, Policing)
+	}
+	if cr.ConnRateLimit != nil {
+		capabilities = append(capabilities, ConnRateLimiting)
+	}
+	if cr.PacketLen != nil {
+		capabilities = append(capabilities, PacketLength)
+	}
+	if cr.SrcPort != 0 {
+		capabilities = append(capabilities, SourcePortMatch)
+	}
+	if cr.Fragments == FragmentsOnly {
+		capabilities = append(capabilities, FragmentMatching)
+	}
+	if cr.L7 != nil {
+		capabilities = append(capabilities, L7Filtering)
+	}
+	if cr.TCPFlags != nil {
+		capabilities = append(capabilities, TCPFlagMatching)
+	}
+	if cr.TunnelVNI != nil {
+		capabilities = append(capabilities, TunnelMatching)
+	}
+	return capabilities
+}
+
+// RuleFormat returns the oldest version of the rule format able to express
+// the rule.
+func (cr *ContivRule) RuleFormat() RuleFormat {
+	if cr.Network != "" || cr.RateLimit != nil || cr.ConnRateLimit != nil || cr.PacketLen != nil ||
+		cr.Fragments != AllPackets || cr.L7 != nil || cr.TCPFlags != nil || cr.TunnelVNI != nil ||
+		cr.Description != "" {
+		return RuleFormatV2
+	}
+	return RuleFormatV1
+}
+
 // Compare returns -1, 0, 1 if this<cr2 or this==cr2 or this>cr2, respectively.
 // Contiv rules have a total order defined on them.
 // It holds that if cr matches subset of the traffic matched by cr2, then cr<cr2.
@@ -133,9 +823,209 @@ func (cr *ContivRule) Compare(cr2 *ContivRule) int {
 			return dstPortOrder
 		}
 	}
+	if cr.Network != cr2.Network {
+		// rule scoped to a network matches subset of the unscoped rule
+		if cr.Network == "" {
+			return 1
+		}
+		if cr2.Network == "" {
+			return -1
+		}
+		return strings.Compare(cr.Network, cr2.Network)
+	}
+	if cr.Fragments != cr2.Fragments {
+		// rule matching only fragments matches subset of the other rule
+		if cr.Fragments == FragmentsOnly {
+			return -1
+		}
+		return 1
+	}
+	tunnelVNIOrder := compareTunnelVNIs(cr.TunnelVNI, cr2.TunnelVNI)
+	if tunnelVNIOrder != 0 {
+		return tunnelVNIOrder
+	}
+	tcpFlagsOrder := compareTCPFlagMatches(cr.TCPFlags, cr2.TCPFlags)
+	if tcpFlagsOrder != 0 {
+		return tcpFlagsOrder
+	}
+	packetLenOrder := compareLenRanges(cr.PacketLen, cr2.PacketLen)
+	if packetLenOrder != 0 {
+		return packetLenOrder
+	}
+	l7Order := compareL7Matches(cr.L7, cr2.L7)
+	if l7Order != 0 {
+		return l7Order
+	}
+	rateLimitOrder := compareRateLimits(cr.RateLimit, cr2.RateLimit)
+	if rateLimitOrder != 0 {
+		return rateLimitOrder
+	}
+	connRateLimitOrder := compareConnRateLimits(cr.ConnRateLimit, cr2.ConnRateLimit)
+	if connRateLimitOrder != 0 {
+		return connRateLimitOrder
+	}
 	return utils.CompareInts(int(cr.Action), int(cr2.Action))
 }
 
+// compareRateLimits orders rate-limited rules before the unlimited ones
+// and lower rates before higher rates.
+func compareRateLimits(a, b *RateSpec) int {
+	if a == nil || b == nil {
+		if a == b {
+			return 0
+		}
+		if a == nil {
+			return 1
+		}
+		return -1
+	}
+	if a.BitsPerSecond != b.BitsPerSecond {
+		if a.BitsPerSecond < b.BitsPerSecond {
+			return -1
+		}
+		return 1
+	}
+	if a.BurstBytes != b.BurstBytes {
+		if a.BurstBytes < b.BurstBytes {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// compareConnRateLimits orders connection-rate limited rules before
+// the unlimited ones, per-peer limits before the aggregate ones and lower
+// rates before higher rates.
+func compareConnRateLimits(a, b *ConnRateSpec) int {
+	if a == nil || b == nil {
+		if a == b {
+			return 0
+		}
+		if a == nil {
+			return 1
+		}
+		return -1
+	}
+	if a.PerPeer != b.PerPeer {
+		if a.PerPeer {
+			return -1
+		}
+		return 1
+	}
+	if a.ConnsPerSecond != b.ConnsPerSecond {
+		if a.ConnsPerSecond < b.ConnsPerSecond {
+			return -1
+		}
+		return 1
+	}
+	if a.Burst != b.Burst {
+		if a.Burst < b.Burst {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// compareLenRanges orders rules restricted to a length range before
+// the unrestricted ones and narrower ranges before the wider ones (a range
+// contained in another is always narrower).
+func compareLenRanges(a, b *LenRange) int {
+	if a == nil || b == nil {
+		if a == b {
+			return 0
+		}
+		if a == nil {
+			return 1
+		}
+		return -1
+	}
+	widthOrder := utils.CompareInts(int(a.Max)-int(a.Min), int(b.Max)-int(b.Min))
+	if widthOrder != 0 {
+		return widthOrder
+	}
+	return utils.CompareInts(int(a.Min), int(b.Min))
+}
+
+// compareL7Matches orders rules restricted by L7 before the unrestricted ones.
+// Specific methods and hosts are ordered before any method/host and longer
+// path prefixes before the shorter ones (a prefix extending another one is
+// always longer).
+func compareL7Matches(a, b *L7Match) int {
+	if a == nil || b == nil {
+		if a == b {
+			return 0
+		}
+		if a == nil {
+			return 1
+		}
+		return -1
+	}
+	if order := compareWildcards(a.Method, b.Method); order != 0 {
+		return order
+	}
+	if order := compareWildcards(a.Host, b.Host); order != 0 {
+		return order
+	}
+	if order := utils.CompareInts(len(b.PathPrefix), len(a.PathPrefix)); order != 0 {
+		return order
+	}
+	return strings.Compare(a.PathPrefix, b.PathPrefix)
+}
+
+// compareTunnelVNIs orders rules restricted to a tunnel before the unrestricted
+// ones and the tunnels by VNI.
+func compareTunnelVNIs(a, b *uint32) int {
+	if a == nil || b == nil {
+		if a == b {
+			return 0
+		}
+		if a == nil {
+			return 1
+		}
+		return -1
+	}
+	if *a == *b {
+		return 0
+	}
+	if *a < *b {
+		return -1
+	}
+	return 1
+}
+
+// compareTCPFlagMatches orders rules restricted by TCP flags before
+// the unrestricted ones and matches examining more flags before those
+// examining fewer (a match examining a superset of flags is always ordered
+// first).
+func compareTCPFlagMatches(a, b *TCPFlagMatch) int {
+	if a == nil || b == nil {
+		if a == b {
+			return 0
+		}
+		if a == nil {
+			return 1
+		}
+		return -1
+	}
+	if order := utils.CompareInts(bits.OnesCount8(uint8(b.Mask())), bits.OnesCount8(uint8(a.Mask()))); order != 0 {
+		return order
+	}
+	if order := utils.CompareInts(int(a.Mask()), int(b.Mask())); order != 0 {
+		return order
+	}
+	return utils.CompareInts(int(a.Required), int(b.Required))
+}
+
+// compareWildcards orders non-empty strings before the empty one (wildcard).
+func compareWildcards(a, b string) int {
+	if a == "" || b == "" {
+		return utils.CompareInts(len(b), len(a))
+	}
+	return strings.Compare(a, b)
+}
+
 // ActionType is either DENY or PERMIT.
 type ActionType int
 
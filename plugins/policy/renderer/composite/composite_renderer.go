@@ -0,0 +1,188 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package composite
+
+import (
+	"net"
+	"strings"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// Renderer applies rules into all the wrapped renderers.
+// It can be registered with the configurator like any other renderer.
+// Every wrapped renderer receives the very same lists of rules (instances)
+// in the same order. Transactions of the wrapped renderers are committed
+// sequentially in the order of Renderers, all of them regardless of failures.
+// The wrapped renderers are therefore expected to be idempotent - a failed
+// commit is typically retried with the same configuration, which then gets
+// re-applied into renderers that already succeeded.
+// Capabilities of the composite are those supported by all the wrapped
+// renderers, the optional transaction interfaces (GroupTxn, CombinedTxn,
+// DeltaTxn, ZonedTxn and PrioritizedTxn) are forwarded into the wrapped
+// transactions implementing them.
+type Renderer struct {
+	Renderers []renderer.PolicyRendererAPI
+}
+
+// RendererTxn represents a single transaction of the composite Renderer.
+type RendererTxn struct {
+	txns []renderer.Txn
+}
+
+// Errors aggregates errors returned by the wrapped renderers.
+type Errors []error
+
+// Error returns all the errors joined into one string.
+func (e Errors) Error() string {
+	errs := []string{}
+	for _, err := range e {
+		errs = append(errs, err.Error())
+	}
+	return strings.Join(errs, "; ")
+}
+
+// Transient returns true if all the aggregated errors are transient
+// (see renderer.TransientError), i.e. the composite transaction may be
+// committed again.
+func (e Errors) Transient() bool {
+	for _, err := range e {
+		if !renderer.IsTransient(err) {
+			return false
+		}
+	}
+	return len(e) > 0
+}
+
+// NewTxn starts a new transaction on every wrapped renderer.
+func (r *Renderer) NewTxn(resync bool) renderer.Txn {
+	txn := &RendererTxn{}
+	for _, rndr := range r.Renderers {
+		txn.txns = append(txn.txns, rndr.NewTxn(resync))
+	}
+	return txn
+}
+
+// HasCapability returns true only if the capability is supported by all
+// the wrapped renderers (and there is at least one).
+func (r *Renderer) HasCapability(capability renderer.Capability) bool {
+	if len(r.Renderers) == 0 {
+		return false
+	}
+	for _, rndr := range r.Renderers {
+		advertiser, isAdvertiser := rndr.(renderer.CapabilityAdvertiser)
+		if !isAdvertiser || !advertiser.HasCapability(capability) {
+			return false
+		}
+	}
+	return true
+}
+
+// SupportedRuleFormat returns the oldest of the rule formats supported
+// by the wrapped renderers, i.e. every one of them understands the rules.
+func (r *Renderer) SupportedRuleFormat() renderer.RuleFormat {
+	format := renderer.CurrentRuleFormat
+	for _, rndr := range r.Renderers {
+		rndrFormat := renderer.RuleFormatV1 /* assumed for non-advertisers */
+		if advertiser, isAdvertiser := rndr.(renderer.RuleFormatAdvertiser); isAdvertiser {
+			rndrFormat = advertiser.SupportedRuleFormat()
+		}
+		if rndrFormat < format {
+			format = rndrFormat
+		}
+	}
+	return format
+}
+
+// Render passes the rules for a given pod into all the wrapped renderers.
+func (rt *RendererTxn) Render(pod podmodel.ID, podIP *net.IPNet, ingress []*renderer.ContivRule, egress []*renderer.ContivRule, removed bool) renderer.Txn {
+	for _, txn := range rt.txns {
+		txn.Render(pod, podIP, ingress, egress, removed)
+	}
+	return rt
+}
+
+// RenderGroups passes the groups of rules for a given pod into all the wrapped
+// renderers (implementing renderer.GroupTxn).
+func (rt *RendererTxn) RenderGroups(pod podmodel.ID, podIP *net.IPNet, ingress []*renderer.RuleGroup, egress []*renderer.RuleGroup, removed bool) renderer.Txn {
+	for _, txn := range rt.txns {
+		if groupTxn, isGroupTxn := txn.(renderer.GroupTxn); isGroupTxn {
+			groupTxn.RenderGroups(pod, podIP, ingress, egress, removed)
+		}
+	}
+	return rt
+}
+
+// RenderCombined passes the combined rules for a given pod into all the wrapped
+// renderers (implementing renderer.CombinedTxn).
+func (rt *RendererTxn) RenderCombined(pod podmodel.ID, podIP *net.IPNet, rules []*renderer.DirectedRule, removed bool) renderer.Txn {
+	for _, txn := range rt.txns {
+		if combinedTxn, isCombinedTxn := txn.(renderer.CombinedTxn); isCombinedTxn {
+			combinedTxn.RenderCombined(pod, podIP, rules, removed)
+		}
+	}
+	return rt
+}
+
+// RenderDelta passes the changes of the rules for a given pod into all
+// the wrapped renderers (implementing renderer.DeltaTxn).
+func (rt *RendererTxn) RenderDelta(pod podmodel.ID, podIP *net.IPNet, ingress renderer.RuleDelta, egress renderer.RuleDelta) renderer.Txn {
+	for _, txn := range rt.txns {
+		if deltaTxn, isDeltaTxn := txn.(renderer.DeltaTxn); isDeltaTxn {
+			deltaTxn.RenderDelta(pod, podIP, ingress, egress)
+		}
+	}
+	return rt
+}
+
+// SetConntrackZone passes the connection tracking zone of a given pod into all
+// the wrapped renderers (implementing renderer.ZonedTxn).
+func (rt *RendererTxn) SetConntrackZone(pod podmodel.ID, zone renderer.ConntrackZone) renderer.Txn {
+	for _, txn := range rt.txns {
+		if zonedTxn, isZonedTxn := txn.(renderer.ZonedTxn); isZonedTxn {
+			zonedTxn.SetConntrackZone(pod, zone)
+		}
+	}
+	return rt
+}
+
+// SetRulePriorities passes the priorities of the rules of a given pod into all
+// the wrapped renderers (implementing renderer.PrioritizedTxn).
+func (rt *RendererTxn) SetRulePriorities(pod podmodel.ID, ingress, egress []renderer.RulePriority) renderer.Txn {
+	for _, txn := range rt.txns {
+		if prioritizedTxn, isPrioritizedTxn := txn.(renderer.PrioritizedTxn); isPrioritizedTxn {
+			prioritizedTxn.SetRulePriorities(pod, ingress, egress)
+		}
+	}
+	return rt
+}
+
+// Commit commits transactions of all the wrapped renderers.
+// Returns Errors if any of them failed.
+func (rt *RendererTxn) Commit() error {
+	var errs Errors
+	for _, txn := range rt.txns {
+		if err := txn.Commit(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
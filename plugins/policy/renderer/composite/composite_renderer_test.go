@@ -0,0 +1,136 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package composite
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+func TestCompositeRenderer(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestCompositeRenderer")
+
+	pod1 := podmodel.ID{Name: "pod1", Namespace: "default"}
+	_, pod1IP, _ := net.ParseCIDR("192.168.1.1/32")
+	_, dstNet, _ := net.ParseCIDR("10.0.0.0/24")
+
+	ingress := []*renderer.ContivRule{
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: dstNet,
+			Protocol:    renderer.TCP,
+			DestPort:    80,
+		},
+		{
+			Action:      renderer.ActionDeny,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: &net.IPNet{},
+			Protocol:    renderer.ANY,
+		},
+	}
+	egress := []*renderer.ContivRule{}
+
+	renderer1 := NewMockRenderer("A", logger)
+	renderer2 := NewMockRenderer("B", logger)
+	composite := &Renderer{
+		Renderers: []renderer.PolicyRendererAPI{renderer1, renderer2},
+	}
+
+	// Both renderers receive identical rule lists.
+	err := composite.NewTxn(false).Render(pod1, pod1IP, ingress, egress, false).Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+
+	for _, rndr := range []*MockRenderer{renderer1, renderer2} {
+		rndrIngress, rndrEgress := rndr.GetRules(pod1)
+		gomega.Expect(rndrIngress).To(gomega.HaveLen(len(ingress)))
+		for idx := range ingress {
+			gomega.Expect(rndrIngress[idx]).To(gomega.BeIdenticalTo(ingress[idx]))
+		}
+		gomega.Expect(rndrEgress).To(gomega.BeEmpty())
+	}
+
+	// Capabilities are the intersection.
+	renderer1.SetCapabilities(renderer.MaskedMatch)
+	gomega.Expect(composite.HasCapability(renderer.MaskedMatch)).To(gomega.BeFalse())
+	renderer2.SetCapabilities(renderer.MaskedMatch)
+	gomega.Expect(composite.HasCapability(renderer.MaskedMatch)).To(gomega.BeTrue())
+	empty := &Renderer{}
+	gomega.Expect(empty.HasCapability(renderer.MaskedMatch)).To(gomega.BeFalse())
+
+	// Rule format is the oldest one.
+	gomega.Expect(composite.SupportedRuleFormat()).To(gomega.Equal(renderer.CurrentRuleFormat))
+	renderer2.SetRuleFormat(renderer.RuleFormatV1)
+	gomega.Expect(composite.SupportedRuleFormat()).To(gomega.Equal(renderer.RuleFormatV1))
+
+	// Optional transaction interfaces are forwarded.
+	group := &renderer.RuleGroup{ID: "group1", Rules: ingress}
+	txn := composite.NewTxn(false).(*RendererTxn)
+	txn.RenderGroups(pod1, pod1IP, []*renderer.RuleGroup{group}, []*renderer.RuleGroup{}, false)
+	txn.SetConntrackZone(pod1, 10)
+	txn.SetRulePriorities(pod1, []renderer.RulePriority{1, 2}, []renderer.RulePriority{})
+	err = txn.Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	for _, rndr := range []*MockRenderer{renderer1, renderer2} {
+		rndrIngress, _ := rndr.GetRuleGroups(pod1)
+		gomega.Expect(rndrIngress).To(gomega.Equal([]*renderer.RuleGroup{group}))
+		gomega.Expect(rndr.GetConntrackZone(pod1)).To(gomega.BeEquivalentTo(10))
+		prioIngress, _ := rndr.GetRulePriorities(pod1)
+		gomega.Expect(prioIngress).To(gomega.Equal([]renderer.RulePriority{1, 2}))
+	}
+
+	// Errors are aggregated, the other renderer still gets the change applied.
+	err1 := errors.New("failure A")
+	renderer1.SetCommitError(err1)
+	err = composite.NewTxn(false).Render(pod1, pod1IP, nil, nil, true).Commit()
+	gomega.Expect(err).To(gomega.Equal(Errors{err1}))
+	ip, _ := renderer2.GetPodIP(pod1)
+	gomega.Expect(ip).To(gomega.BeEmpty())
+
+	err2 := errors.New("failure B")
+	renderer2.SetCommitError(err2)
+	err = composite.NewTxn(true).Commit()
+	gomega.Expect(err).To(gomega.Equal(Errors{err1, err2}))
+	gomega.Expect(err.Error()).To(gomega.Equal("failure A; failure B"))
+	gomega.Expect(renderer.IsTransient(err)).To(gomega.BeFalse())
+
+	// Aggregated errors are transient only if all of them are.
+	transientErr1 := renderer.TransientErrorf("failure A")
+	transientErr2 := renderer.TransientErrorf("failure B")
+	renderer1.SetCommitError(transientErr1)
+	err = composite.NewTxn(true).Commit()
+	gomega.Expect(renderer.IsTransient(err)).To(gomega.BeFalse())
+	renderer2.SetCommitError(transientErr2)
+	err = composite.NewTxn(true).Commit()
+	gomega.Expect(err).To(gomega.Equal(Errors{transientErr1, transientErr2}))
+	gomega.Expect(renderer.IsTransient(err)).To(gomega.BeTrue())
+	gomega.Expect(renderer.IsTransient(Errors{})).To(gomega.BeFalse())
+}
@@ -0,0 +1,351 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+// Package conformance provides a reusable test of the contract between
+// the policy configurator and renderers (see renderer.PolicyRendererAPI).
+//
+// A conforming renderer must:
+//   - install exactly the rules given by the last Render() of a pod
+//     (with resync or not) once the transaction is committed,
+//   - be idempotent: rendering the same rules again, within the same
+//     or a later transaction, leaves the installed configuration unchanged,
+//   - keep pods not mentioned in a non-resync transaction unchanged,
+//   - remove pods not mentioned in a resync transaction,
+//   - un-configure pods rendered with *removed* set to true (possibly
+//     with nil IP address); removal of an unknown or already removed pod
+//     is a no-op,
+//   - handle empty lists of rules (allow all traffic in that direction),
+//   - accept the same rule instances for multiple pods and never modify
+//     the rules it was given.
+package conformance
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// Inspector provides the conformance test with the view of the configuration
+// installed by the renderer under test.
+type Inspector interface {
+	// InstalledRules returns the rules installed for the pod, in the form
+	// they were given to Render(). The order of the rules is not significant.
+	// <configured> is false if the renderer has no configuration for the pod
+	// (i.e. it was never rendered or it was removed).
+	InstalledRules(pod podmodel.ID) (ingress, egress []*renderer.ContivRule, configured bool)
+}
+
+// Factory creates a new instance of the renderer under test, without any
+// configuration installed, together with its Inspector.
+type Factory func(t *testing.T) (renderer.PolicyRendererAPI, Inspector)
+
+var (
+	pod1 = podmodel.ID{Name: "pod1", Namespace: "default"}
+	pod2 = podmodel.ID{Name: "pod2", Namespace: "default"}
+	pod3 = podmodel.ID{Name: "pod3", Namespace: "other"}
+
+	pod1IP = oneHostNet("10.1.1.1")
+	pod2IP = oneHostNet("10.1.1.2")
+	pod3IP = oneHostNet("10.1.1.3")
+)
+
+// RendererConformance runs the conformance test of a renderer. Every case
+// is run as a sub-test with a fresh renderer created by the factory.
+func RendererConformance(t *testing.T, factory Factory) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, rndr renderer.PolicyRendererAPI, inspector Inspector)
+	}{
+		{"Apply", testApply},
+		{"DuplicateApply", testDuplicateApply},
+		{"EmptyRules", testEmptyRules},
+		{"Incremental", testIncremental},
+		{"Resync", testResync},
+		{"EmptyResync", testEmptyResync},
+		{"Teardown", testTeardown},
+		{"SharedRules", testSharedRules},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rndr, inspector := factory(t)
+			tc.run(t, rndr, inspector)
+		})
+	}
+}
+
+// testApply: rendered rules are installed after commit.
+func testApply(t *testing.T, rndr renderer.PolicyRendererAPI, inspector Inspector) {
+	ingress, egress := podRules(80)
+	commit(t, rndr.NewTxn(false).Render(pod1, pod1IP, ingress, egress, false))
+	expectInstalled(t, inspector, pod1, ingress, egress)
+}
+
+// testDuplicateApply: re-applying the same rules is a no-op.
+func testDuplicateApply(t *testing.T, rndr renderer.PolicyRendererAPI, inspector Inspector) {
+	ingress, egress := podRules(80)
+	txn := rndr.NewTxn(false)
+	txn.Render(pod1, pod1IP, ingress, egress, false)
+	txn.Render(pod1, pod1IP, ingress, egress, false)
+	commit(t, txn)
+	expectInstalled(t, inspector, pod1, ingress, egress)
+
+	// the same rules (different instances) in the following transactions
+	for _, resync := range []bool{false, true, false} {
+		ingressCopy, egressCopy := podRules(80)
+		commit(t, rndr.NewTxn(resync).Render(pod1, pod1IP, ingressCopy, egressCopy, false))
+		expectInstalled(t, inspector, pod1, ingress, egress)
+	}
+
+	// the last Render() of the pod applies
+	newIngress, newEgress := podRules(443)
+	txn = rndr.NewTxn(false)
+	txn.Render(pod1, pod1IP, ingress, egress, false)
+	txn.Render(pod1, pod1IP, newIngress, newEgress, false)
+	commit(t, txn)
+	expectInstalled(t, inspector, pod1, newIngress, newEgress)
+}
+
+// testEmptyRules: empty (nil or non-nil) lists of rules are valid.
+func testEmptyRules(t *testing.T, rndr renderer.PolicyRendererAPI, inspector Inspector) {
+	commit(t, rndr.NewTxn(false).Render(pod1, pod1IP, []*renderer.ContivRule{}, nil, false))
+	expectInstalled(t, inspector, pod1, nil, nil)
+
+	// from non-empty to empty
+	ingress, egress := podRules(80)
+	commit(t, rndr.NewTxn(false).Render(pod2, pod2IP, ingress, egress, false))
+	expectInstalled(t, inspector, pod2, ingress, egress)
+	commit(t, rndr.NewTxn(false).Render(pod2, pod2IP, nil, []*renderer.ContivRule{}, false))
+	expectInstalled(t, inspector, pod2, nil, nil)
+
+	// resync with empty rules
+	commit(t, rndr.NewTxn(true).Render(pod1, pod1IP, nil, nil, false))
+	expectInstalled(t, inspector, pod1, nil, nil)
+	expectNotInstalled(t, inspector, pod2)
+}
+
+// testIncremental: non-resync transactions leave other pods unchanged.
+func testIncremental(t *testing.T, rndr renderer.PolicyRendererAPI, inspector Inspector) {
+	ingress1, egress1 := podRules(80)
+	ingress2, egress2 := podRules(443)
+	commit(t, rndr.NewTxn(false).Render(pod1, pod1IP, ingress1, egress1, false))
+	commit(t, rndr.NewTxn(false).Render(pod2, pod2IP, ingress2, egress2, false))
+	expectInstalled(t, inspector, pod1, ingress1, egress1)
+	expectInstalled(t, inspector, pod2, ingress2, egress2)
+
+	// empty transaction
+	commit(t, rndr.NewTxn(false))
+	expectInstalled(t, inspector, pod1, ingress1, egress1)
+	expectInstalled(t, inspector, pod2, ingress2, egress2)
+}
+
+// testResync: resync transactions replace the whole configuration.
+func testResync(t *testing.T, rndr renderer.PolicyRendererAPI, inspector Inspector) {
+	ingress1, egress1 := podRules(80)
+	ingress2, egress2 := podRules(443)
+	ingress3, egress3 := podRules(8080)
+	txn := rndr.NewTxn(false)
+	txn.Render(pod1, pod1IP, ingress1, egress1, false)
+	txn.Render(pod2, pod2IP, ingress2, egress2, false)
+	commit(t, txn)
+
+	for i := 0; i < 2; i++ {
+		txn = rndr.NewTxn(true)
+		txn.Render(pod2, pod2IP, ingress3, egress3, false)
+		txn.Render(pod3, pod3IP, ingress1, egress1, false)
+		commit(t, txn)
+		expectNotInstalled(t, inspector, pod1)
+		expectInstalled(t, inspector, pod2, ingress3, egress3)
+		expectInstalled(t, inspector, pod3, ingress1, egress1)
+	}
+}
+
+// testEmptyResync: resync with no pods removes everything.
+func testEmptyResync(t *testing.T, rndr renderer.PolicyRendererAPI, inspector Inspector) {
+	ingress, egress := podRules(80)
+	txn := rndr.NewTxn(false)
+	txn.Render(pod1, pod1IP, ingress, egress, false)
+	txn.Render(pod2, pod2IP, ingress, egress, false)
+	commit(t, txn)
+
+	commit(t, rndr.NewTxn(true))
+	expectNotInstalled(t, inspector, pod1)
+	expectNotInstalled(t, inspector, pod2)
+}
+
+// testTeardown: removed pods are un-configured, repeated removal is a no-op.
+func testTeardown(t *testing.T, rndr renderer.PolicyRendererAPI, inspector Inspector) {
+	ingress, egress := podRules(80)
+	txn := rndr.NewTxn(false)
+	txn.Render(pod1, pod1IP, ingress, egress, false)
+	txn.Render(pod2, pod2IP, ingress, egress, false)
+	commit(t, txn)
+
+	// removal with and without the IP address
+	txn = rndr.NewTxn(false)
+	txn.Render(pod1, nil, nil, nil, true)
+	txn.Render(pod2, pod2IP, nil, nil, true)
+	commit(t, txn)
+	expectNotInstalled(t, inspector, pod1)
+	expectNotInstalled(t, inspector, pod2)
+
+	// already removed and unknown pods
+	txn = rndr.NewTxn(false)
+	txn.Render(pod1, nil, nil, nil, true)
+	txn.Render(pod3, nil, nil, nil, true)
+	commit(t, txn)
+	expectNotInstalled(t, inspector, pod1)
+	expectNotInstalled(t, inspector, pod3)
+
+	// removed and re-added within the same transaction
+	txn = rndr.NewTxn(false)
+	txn.Render(pod1, pod1IP, ingress, egress, false)
+	txn.Render(pod1, nil, nil, nil, true)
+	txn.Render(pod2, nil, nil, nil, true)
+	txn.Render(pod2, pod2IP, ingress, egress, false)
+	commit(t, txn)
+	expectNotInstalled(t, inspector, pod1)
+	expectInstalled(t, inspector, pod2, ingress, egress)
+}
+
+// testSharedRules: the same rule instances for multiple pods, never modified.
+func testSharedRules(t *testing.T, rndr renderer.PolicyRendererAPI, inspector Inspector) {
+	ingress, egress := podRules(80)
+	original := rulesString(ingress) + rulesString(egress)
+	txn := rndr.NewTxn(false)
+	txn.Render(pod1, pod1IP, ingress, egress, false)
+	txn.Render(pod2, pod2IP, ingress, egress, false)
+	txn.Render(pod3, pod3IP, egress, ingress, false)
+	commit(t, txn)
+	expectInstalled(t, inspector, pod1, ingress, egress)
+	expectInstalled(t, inspector, pod2, ingress, egress)
+	expectInstalled(t, inspector, pod3, egress, ingress)
+	if modified := rulesString(ingress) + rulesString(egress); modified != original {
+		t.Errorf("renderer modified the rules: %s -> %s", original, modified)
+	}
+}
+
+// podRules returns a typical pair of rule lists: a few permit rules
+// followed by deny-the-rest.
+func podRules(port uint16) (ingress, egress []*renderer.ContivRule) {
+	ingress = []*renderer.ContivRule{
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: network("10.2.0.0/16"),
+			Protocol:    renderer.TCP,
+			DestPort:    port,
+		},
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: network("10.3.0.1/32"),
+			Protocol:    renderer.UDP,
+			DestPort:    53,
+		},
+		denyAll(),
+	}
+	egress = []*renderer.ContivRule{
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  network("10.1.0.0/16"),
+			DestNetwork: &net.IPNet{},
+			Protocol:    renderer.TCP,
+			DestPort:    port,
+		},
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  network("10.4.0.0/24"),
+			DestNetwork: &net.IPNet{},
+			Protocol:    renderer.ANY,
+		},
+		denyAll(),
+	}
+	return ingress, egress
+}
+
+func denyAll() *renderer.ContivRule {
+	return &renderer.ContivRule{
+		Action:      renderer.ActionDeny,
+		SrcNetwork:  &net.IPNet{},
+		DestNetwork: &net.IPNet{},
+		Protocol:    renderer.ANY,
+	}
+}
+
+func network(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+func oneHostNet(ip string) *net.IPNet {
+	return network(ip + "/32")
+}
+
+// commit commits the transaction, failing the test on error.
+func commit(t *testing.T, txn renderer.Txn) {
+	t.Helper()
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+}
+
+// expectInstalled checks that the renderer has exactly the given rules
+// installed for the pod.
+func expectInstalled(t *testing.T, inspector Inspector, pod podmodel.ID, ingress, egress []*renderer.ContivRule) {
+	t.Helper()
+	installedIngress, installedEgress, configured := inspector.InstalledRules(pod)
+	if !configured {
+		t.Errorf("pod %s is not configured", pod)
+		return
+	}
+	if expected, installed := rulesString(ingress), rulesString(installedIngress); expected != installed {
+		t.Errorf("unexpected ingress rules of pod %s: expected %s, installed %s", pod, expected, installed)
+	}
+	if expected, installed := rulesString(egress), rulesString(installedEgress); expected != installed {
+		t.Errorf("unexpected egress rules of pod %s: expected %s, installed %s", pod, expected, installed)
+	}
+}
+
+// expectNotInstalled checks that the renderer has no configuration for the pod.
+func expectNotInstalled(t *testing.T, inspector Inspector, pod podmodel.ID) {
+	t.Helper()
+	ingress, egress, configured := inspector.InstalledRules(pod)
+	if configured {
+		t.Errorf("pod %s is still configured: ingress %s, egress %s",
+			pod, rulesString(ingress), rulesString(egress))
+	}
+}
+
+// rulesString returns an order-independent string representation of rules.
+func rulesString(rules []*renderer.ContivRule) string {
+	sorted := append([]*renderer.ContivRule{}, rules...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Compare(sorted[j]) < 0
+	})
+	strs := []string{}
+	for _, rule := range sorted {
+		strs = append(strs, rule.String())
+	}
+	return fmt.Sprintf("[%s]", strings.Join(strs, ", "))
+}
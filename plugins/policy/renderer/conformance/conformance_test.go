@@ -0,0 +1,68 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package conformance
+
+import (
+	"testing"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	. "github.com/contiv/vpp/mock/renderer"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/contiv/vpp/plugins/policy/renderer/composite"
+)
+
+// mockInspector implements Inspector for the mock renderer.
+type mockInspector struct {
+	renderer *MockRenderer
+}
+
+func (mi mockInspector) InstalledRules(pod podmodel.ID) (ingress, egress []*renderer.ContivRule, configured bool) {
+	ip, _ := mi.renderer.GetPodIP(pod)
+	ingress, egress = mi.renderer.GetRules(pod)
+	return ingress, egress, ip != ""
+}
+
+func TestMockRendererConformance(t *testing.T) {
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestMockRendererConformance")
+
+	RendererConformance(t, func(t *testing.T) (renderer.PolicyRendererAPI, Inspector) {
+		rndr := NewMockRenderer("A", logger)
+		return rndr, mockInspector{renderer: rndr}
+	})
+}
+
+func TestCompositeRendererConformance(t *testing.T) {
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestCompositeRendererConformance")
+
+	for _, inspected := range []int{0, 1} {
+		RendererConformance(t, func(t *testing.T) (renderer.PolicyRendererAPI, Inspector) {
+			renderers := []*MockRenderer{NewMockRenderer("A", logger), NewMockRenderer("B", logger)}
+			rndr := &composite.Renderer{
+				Renderers: []renderer.PolicyRendererAPI{renderers[0], renderers[1]},
+			}
+			return rndr, mockInspector{renderer: renderers[inspected]}
+		})
+	}
+}
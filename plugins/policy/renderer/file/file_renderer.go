@@ -0,0 +1,332 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+// Package file implements a renderer which, instead of configuring
+// a network stack, writes the rules of every pod into a file of a directory
+// tree, e.g. to be committed into git for auditing and diffing of the rendered
+// policies. The files are deterministic - the same rules always produce
+// the same content.
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/contiv/vpp/plugins/policy/renderer/neutral"
+)
+
+// Format of the written files.
+type Format string
+
+const (
+	// JSON formats the files as indented JSON (file extension ".json").
+	JSON Format = "json"
+
+	// YAML formats the files as YAML (file extension ".yaml").
+	YAML Format = "yaml"
+)
+
+// Renderer writes the rules of each pod into the file <Dir>/<namespace>/<name>.<format>.
+// Files of removed pods are deleted, resync deletes files of all pods not
+// mentioned in the transaction. Files without the extension of the format
+// are left untouched. Files are only rewritten when their content changes.
+type Renderer struct {
+	// Dir is the root directory of the tree, created if it does not exist.
+	Dir string
+
+	// Format of the files, JSON if empty.
+	Format Format
+
+	sync.Mutex // serializes commits
+}
+
+// RendererTxn represents a single transaction of the file Renderer.
+type RendererTxn struct {
+	renderer *Renderer
+	resync   bool
+	pods     map[podmodel.ID]*PodRules // nil = removed
+}
+
+// PodRules is the content of the file written for a pod. Rules are
+// expressed from the pod point of view and evaluated in the given order
+// (the first match wins).
+type PodRules struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	FromPod   []Rule `json:"fromPod"`
+	ToPod     []Rule `json:"toPod"`
+}
+
+// Rule is a single rule of the file, with empty fields matching all.
+type Rule struct {
+	Action        neutral.Action   `json:"action"`
+	Protocol      neutral.Protocol `json:"protocol"`
+	SrcNetwork    string           `json:"srcNetwork,omitempty"`
+	SrcPort       uint16           `json:"srcPort,omitempty"`
+	DestNetwork   string           `json:"destNetwork,omitempty"`
+	DestPort      uint16           `json:"destPort,omitempty"`
+	Network       string           `json:"network,omitempty"`
+	RateLimit     string           `json:"rateLimit,omitempty"`
+	ConnRateLimit string           `json:"connRateLimit,omitempty"`
+	PacketLen     string           `json:"packetLen,omitempty"`
+	FragmentsOnly bool             `json:"fragmentsOnly,omitempty"`
+	L7            string           `json:"l7,omitempty"`
+	TCPFlags      string           `json:"tcpFlags,omitempty"`
+	TunnelVNI     *uint32          `json:"tunnelVNI,omitempty"`
+	Description   string           `json:"description,omitempty"`
+}
+
+// NewTxn starts a new transaction.
+func (r *Renderer) NewTxn(resync bool) renderer.Txn {
+	return &RendererTxn{
+		renderer: r,
+		resync:   resync,
+		pods:     make(map[podmodel.ID]*PodRules),
+	}
+}
+
+// HasCapability returns true for all features of the rules which can be
+// written into the file. The rules are written in the given order.
+func (r *Renderer) HasCapability(capability renderer.Capability) bool {
+	switch capability {
+	case renderer.MaskedMatch, renderer.NetworkScoping, renderer.Policing,
+		renderer.PacketLength, renderer.SourcePortMatch, renderer.L7Filtering, renderer.ConnRateLimiting,
+		renderer.FragmentMatching, renderer.TCPFlagMatching, renderer.TunnelMatching, renderer.OrderedRules:
+		return true
+	}
+	return false
+}
+
+// SupportedRuleFormat returns the current rule format, all the fields
+// of the rules are written into the file.
+func (r *Renderer) SupportedRuleFormat() renderer.RuleFormat {
+	return renderer.CurrentRuleFormat
+}
+
+// Render remembers the rules of the pod to write.
+func (rt *RendererTxn) Render(pod podmodel.ID, podIP *net.IPNet, ingress []*renderer.ContivRule,
+	egress []*renderer.ContivRule, removed bool) renderer.Txn {
+
+	if removed {
+		rt.pods[pod] = nil
+		return rt
+	}
+	podRules := &PodRules{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		FromPod:   fileRules(ingress, neutral.FromPod),
+		ToPod:     fileRules(egress, neutral.ToPod),
+	}
+	if podIP != nil {
+		podRules.IP = podIP.IP.String()
+	}
+	rt.pods[pod] = podRules
+	return rt
+}
+
+// Commit writes the files of the rendered pods and deletes files of
+// the removed ones.
+func (rt *RendererTxn) Commit() error {
+	r := rt.renderer
+	r.Lock()
+	defer r.Unlock()
+
+	if rt.resync {
+		existing, err := r.listPods()
+		if err != nil {
+			return err
+		}
+		for _, pod := range existing {
+			if _, rendered := rt.pods[pod]; !rendered {
+				rt.pods[pod] = nil
+			}
+		}
+	}
+	for pod, podRules := range rt.pods {
+		var err error
+		if podRules == nil {
+			err = r.removeFile(pod)
+		} else {
+			err = r.writeFile(pod, podRules)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// format returns the format of the files.
+func (r *Renderer) format() Format {
+	if r.Format == "" {
+		return JSON
+	}
+	return r.Format
+}
+
+// podFile returns path to the file of the pod.
+func (r *Renderer) podFile(pod podmodel.ID) string {
+	return filepath.Join(r.Dir, pod.Namespace, pod.Name+"."+string(r.format()))
+}
+
+// writeFile writes the rules of the pod unless the file already has
+// the same content. The file is replaced atomically.
+func (r *Renderer) writeFile(pod podmodel.ID, podRules *PodRules) error {
+	content, err := r.encode(podRules)
+	if err != nil {
+		return fmt.Errorf("failed to encode rules of pod %s: %v", pod, err)
+	}
+	path := r.podFile(pod)
+	if current, err := ioutil.ReadFile(path); err == nil && string(current) == string(content) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// removeFile deletes the file of the pod, together with the namespace
+// directory if it becomes empty.
+func (r *Renderer) removeFile(pod podmodel.ID) error {
+	path := r.podFile(pod)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Fails if the directory is not empty.
+	os.Remove(filepath.Dir(path))
+	return nil
+}
+
+// listPods returns pods with a file in the tree.
+func (r *Renderer) listPods() ([]podmodel.ID, error) {
+	ext := "." + string(r.format())
+	namespaces, err := ioutil.ReadDir(r.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pods []podmodel.ID
+	for _, namespace := range namespaces {
+		if !namespace.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(r.Dir, namespace.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ext) {
+				continue
+			}
+			pods = append(pods, podmodel.ID{
+				Namespace: namespace.Name(),
+				Name:      strings.TrimSuffix(file.Name(), ext),
+			})
+		}
+	}
+	return pods, nil
+}
+
+// encode converts the rules of a pod into the content of the file.
+func (r *Renderer) encode(podRules *PodRules) ([]byte, error) {
+	content, err := json.MarshalIndent(podRules, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	switch r.format() {
+	case JSON:
+		return append(content, '\n'), nil
+	case YAML:
+		return yaml.JSONToYAML(content)
+	}
+	return nil, fmt.Errorf("unsupported format: %s", r.Format)
+}
+
+// fileRules converts Contiv rules of the given direction into the rules
+// of the file.
+func fileRules(rules []*renderer.ContivRule, direction neutral.Direction) []Rule {
+	converted := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		neutralRule := neutral.FromContivRule(rule, direction)
+		fileRule := Rule{
+			Action:        neutralRule.Action,
+			Protocol:      neutralRule.Protocol,
+			SrcPort:       rule.SrcPort,
+			DestPort:      rule.DestPort,
+			Network:       rule.Network,
+			FragmentsOnly: rule.Fragments == renderer.FragmentsOnly,
+			Description:   rule.Description,
+		}
+		if neutralRule.SrcNet != nil {
+			fileRule.SrcNetwork = neutralRule.SrcNet.String()
+		}
+		if neutralRule.DstNet != nil {
+			fileRule.DestNetwork = neutralRule.DstNet.String()
+		}
+		if rule.RateLimit != nil {
+			fileRule.RateLimit = rule.RateLimit.String()
+		}
+		if rule.ConnRateLimit != nil {
+			fileRule.ConnRateLimit = rule.ConnRateLimit.String()
+		}
+		if rule.PacketLen != nil {
+			fileRule.PacketLen = rule.PacketLen.String()
+		}
+		if rule.L7 != nil {
+			fileRule.L7 = rule.L7.String()
+		}
+		if rule.TCPFlags != nil {
+			fileRule.TCPFlags = rule.TCPFlags.String()
+		}
+		if rule.TunnelVNI != nil {
+			tunnelVNI := *rule.TunnelVNI
+			fileRule.TunnelVNI = &tunnelVNI
+		}
+		converted = append(converted, fileRule)
+	}
+	return converted
+}
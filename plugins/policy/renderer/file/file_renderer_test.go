@@ -0,0 +1,168 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/contiv/vpp/plugins/policy/renderer/neutral"
+)
+
+func readPodRules(path string) *PodRules {
+	content, err := ioutil.ReadFile(path)
+	gomega.Expect(err).To(gomega.BeNil())
+	podRules := &PodRules{}
+	err = json.Unmarshal(content, podRules)
+	gomega.Expect(err).To(gomega.BeNil())
+	return podRules
+}
+
+func TestFileRenderer(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	logger := logrus.DefaultLogger()
+	logger.SetLevel(logging.DebugLevel)
+	logger.Debug("TestFileRenderer")
+
+	dir, err := ioutil.TempDir("", "file-renderer")
+	gomega.Expect(err).To(gomega.BeNil())
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "rules")
+
+	pod1 := podmodel.ID{Name: "pod1", Namespace: "default"}
+	pod2 := podmodel.ID{Name: "pod2", Namespace: "other"}
+	_, pod1IP, _ := net.ParseCIDR("192.168.1.1/32")
+	_, pod2IP, _ := net.ParseCIDR("192.168.1.2/32")
+	_, dstNet, _ := net.ParseCIDR("10.0.0.0/24")
+	pod1File := filepath.Join(root, "default", "pod1.json")
+	pod2File := filepath.Join(root, "other", "pod2.json")
+
+	ingress := []*renderer.ContivRule{
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: dstNet,
+			Protocol:    renderer.TCP,
+			DestPort:    80,
+			RateLimit:   &renderer.RateSpec{BitsPerSecond: 1000000, BurstBytes: 1500},
+			Description: "web",
+		},
+		{
+			Action:      renderer.ActionDeny,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: &net.IPNet{},
+			Protocol:    renderer.ANY,
+		},
+	}
+	egress := []*renderer.ContivRule{}
+
+	fileRenderer := &Renderer{Dir: root}
+	gomega.Expect(fileRenderer.HasCapability(renderer.Policing)).To(gomega.BeTrue())
+	gomega.Expect(fileRenderer.HasCapability(renderer.OrderedRules)).To(gomega.BeTrue())
+	gomega.Expect(fileRenderer.SupportedRuleFormat()).To(gomega.Equal(renderer.CurrentRuleFormat))
+	gomega.Expect(fileRenderer.HasCapability(renderer.RuleGroups)).To(gomega.BeFalse())
+
+	// Files are written for the rendered pods.
+	err = fileRenderer.NewTxn(false).
+		Render(pod1, pod1IP, ingress, egress, false).
+		Render(pod2, pod2IP, egress, egress, false).
+		Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(readPodRules(pod1File)).To(gomega.Equal(&PodRules{
+		Namespace: "default",
+		Name:      "pod1",
+		IP:        "192.168.1.1",
+		FromPod: []Rule{
+			{
+				Action:      neutral.Permit,
+				Protocol:    neutral.TCP,
+				DestNetwork: "10.0.0.0/24",
+				DestPort:    80,
+				RateLimit:   "1000000bps/1500B",
+				Description: "web",
+			},
+			{
+				Action:   neutral.Deny,
+				Protocol: neutral.Any,
+			},
+		},
+		ToPod: []Rule{},
+	}))
+	gomega.Expect(readPodRules(pod2File).FromPod).To(gomega.BeEmpty())
+
+	// The content is deterministic.
+	content, err := ioutil.ReadFile(pod1File)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = fileRenderer.NewTxn(false).Render(pod1, pod1IP, ingress, egress, false).Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	rewritten, err := ioutil.ReadFile(pod1File)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(rewritten).To(gomega.Equal(content))
+
+	// Changed rules are written.
+	err = fileRenderer.NewTxn(false).Render(pod1, pod1IP, egress, ingress[1:], false).Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	podRules := readPodRules(pod1File)
+	gomega.Expect(podRules.FromPod).To(gomega.BeEmpty())
+	gomega.Expect(podRules.ToPod).To(gomega.Equal([]Rule{{Action: neutral.Deny, Protocol: neutral.Any}}))
+
+	// Files of removed pods are deleted, with the empty namespace directory.
+	err = fileRenderer.NewTxn(false).Render(pod2, nil, nil, nil, true).Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	_, err = os.Stat(pod2File)
+	gomega.Expect(os.IsNotExist(err)).To(gomega.BeTrue())
+	_, err = os.Stat(filepath.Dir(pod2File))
+	gomega.Expect(os.IsNotExist(err)).To(gomega.BeTrue())
+	gomega.Expect(pod1File).To(gomega.BeAnExistingFile())
+
+	// Resync deletes files of pods not rendered, other files are kept.
+	readme := filepath.Join(root, "default", "README.md")
+	err = ioutil.WriteFile(readme, []byte("audit\n"), 0644)
+	gomega.Expect(err).To(gomega.BeNil())
+	err = fileRenderer.NewTxn(true).Render(pod2, pod2IP, ingress, egress, false).Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	_, err = os.Stat(pod1File)
+	gomega.Expect(os.IsNotExist(err)).To(gomega.BeTrue())
+	gomega.Expect(readme).To(gomega.BeAnExistingFile())
+	gomega.Expect(readPodRules(pod2File).FromPod).To(gomega.HaveLen(2))
+
+	// YAML format.
+	yamlRenderer := &Renderer{Dir: root, Format: YAML}
+	err = yamlRenderer.NewTxn(false).Render(pod1, pod1IP, ingress[1:], egress, false).Commit()
+	gomega.Expect(err).To(gomega.BeNil())
+	content, err = ioutil.ReadFile(filepath.Join(root, "default", "pod1.yaml"))
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(string(content)).To(gomega.Equal(
+		"fromPod:\n" +
+			"- action: deny\n" +
+			"  protocol: any\n" +
+			"ip: 192.168.1.1\n" +
+			"name: pod1\n" +
+			"namespace: default\n" +
+			"toPod: []\n"))
+}
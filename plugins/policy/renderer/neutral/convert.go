@@ -0,0 +1,206 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package neutral
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// FromContivRule converts Contiv rule of the given direction into the neutral
+// form. Networks and limits are copied, the result does not share any memory
+// with the original rule.
+func FromContivRule(rule *renderer.ContivRule, direction Direction) Rule {
+	neutral := Rule{
+		Direction:   direction,
+		Action:      fromAction(rule.Action),
+		Protocol:    fromProtocol(rule.Protocol),
+		SrcNet:      copyNet(rule.SrcNetwork),
+		DstNet:      copyNet(rule.DestNetwork),
+		SrcPort:     rule.SrcPort,
+		DstPort:     rule.DestPort,
+		Network:     rule.Network,
+		Description: rule.Description,
+	}
+	neutral.FragmentsOnly = rule.Fragments == renderer.FragmentsOnly
+	if rule.RateLimit != nil {
+		neutral.RateLimit = &RateLimit{
+			BitsPerSecond: rule.RateLimit.BitsPerSecond,
+			BurstBytes:    rule.RateLimit.BurstBytes,
+		}
+	}
+	if rule.ConnRateLimit != nil {
+		neutral.ConnRateLimit = &ConnRateLimit{
+			ConnsPerSecond: rule.ConnRateLimit.ConnsPerSecond,
+			Burst:          rule.ConnRateLimit.Burst,
+			PerPeer:        rule.ConnRateLimit.PerPeer,
+		}
+	}
+	if rule.PacketLen != nil {
+		neutral.PacketLen = &LenRange{Min: rule.PacketLen.Min, Max: rule.PacketLen.Max}
+	}
+	return neutral
+}
+
+// FromContivRules converts the ingress and egress rules (from the vswitch
+// point of view, as given to renderer.Txn.Render()) into one list of neutral
+// rules: FromPod rules first, followed by ToPod rules, each in the original
+// order.
+func FromContivRules(ingress, egress []*renderer.ContivRule) []Rule {
+	rules := make([]Rule, 0, len(ingress)+len(egress))
+	for _, rule := range ingress {
+		rules = append(rules, FromContivRule(rule, FromPod))
+	}
+	for _, rule := range egress {
+		rules = append(rules, FromContivRule(rule, ToPod))
+	}
+	return rules
+}
+
+// ToContivRule converts the neutral rule back into Contiv rule. Unset networks
+// are converted into empty networks (match all), as used by the configurator.
+// Returns error if the rule has invalid action or protocol.
+func ToContivRule(rule Rule) (*renderer.ContivRule, error) {
+	action, err := toAction(rule.Action)
+	if err != nil {
+		return nil, err
+	}
+	protocol, err := toProtocol(rule.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	contivRule := &renderer.ContivRule{
+		Action:      action,
+		SrcNetwork:  &net.IPNet{},
+		DestNetwork: &net.IPNet{},
+		Protocol:    protocol,
+		SrcPort:     rule.SrcPort,
+		DestPort:    rule.DstPort,
+		Network:     rule.Network,
+		Description: rule.Description,
+	}
+	if rule.FragmentsOnly {
+		contivRule.Fragments = renderer.FragmentsOnly
+	}
+	if rule.SrcNet != nil {
+		contivRule.SrcNetwork = copyNet(rule.SrcNet)
+	}
+	if rule.DstNet != nil {
+		contivRule.DestNetwork = copyNet(rule.DstNet)
+	}
+	if rule.RateLimit != nil {
+		contivRule.RateLimit = &renderer.RateSpec{
+			BitsPerSecond: rule.RateLimit.BitsPerSecond,
+			BurstBytes:    rule.RateLimit.BurstBytes,
+		}
+	}
+	if rule.ConnRateLimit != nil {
+		contivRule.ConnRateLimit = &renderer.ConnRateSpec{
+			ConnsPerSecond: rule.ConnRateLimit.ConnsPerSecond,
+			Burst:          rule.ConnRateLimit.Burst,
+			PerPeer:        rule.ConnRateLimit.PerPeer,
+		}
+	}
+	if rule.PacketLen != nil {
+		contivRule.PacketLen = &renderer.LenRange{Min: rule.PacketLen.Min, Max: rule.PacketLen.Max}
+	}
+	return contivRule, nil
+}
+
+// ToContivRules converts the neutral rules back into the ingress and egress
+// rules (from the vswitch point of view), preserving the order within each
+// direction. Returns error if any of the rules is invalid.
+func ToContivRules(rules []Rule) (ingress, egress []*renderer.ContivRule, err error) {
+	ingress = []*renderer.ContivRule{}
+	egress = []*renderer.ContivRule{}
+	for _, rule := range rules {
+		contivRule, err := ToContivRule(rule)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch rule.Direction {
+		case FromPod:
+			ingress = append(ingress, contivRule)
+		case ToPod:
+			egress = append(egress, contivRule)
+		default:
+			return nil, nil, fmt.Errorf("invalid direction of the rule %v", rule)
+		}
+	}
+	return ingress, egress, nil
+}
+
+// fromAction converts the renderer action type.
+func fromAction(action renderer.ActionType) Action {
+	if action == renderer.ActionPermit {
+		return Permit
+	}
+	return Deny
+}
+
+// toAction converts the action into the renderer action type.
+func toAction(action Action) (renderer.ActionType, error) {
+	switch action {
+	case Permit:
+		return renderer.ActionPermit, nil
+	case Deny:
+		return renderer.ActionDeny, nil
+	}
+	return renderer.ActionDeny, fmt.Errorf("invalid rule action: %q", action)
+}
+
+// fromProtocol converts the renderer protocol type.
+func fromProtocol(protocol renderer.ProtocolType) Protocol {
+	switch protocol {
+	case renderer.TCP:
+		return TCP
+	case renderer.UDP:
+		return UDP
+	case renderer.OTHER:
+		return Other
+	}
+	return Any
+}
+
+// toProtocol converts the protocol into the renderer protocol type.
+func toProtocol(protocol Protocol) (renderer.ProtocolType, error) {
+	switch protocol {
+	case TCP:
+		return renderer.TCP, nil
+	case UDP:
+		return renderer.UDP, nil
+	case Other:
+		return renderer.OTHER, nil
+	case Any:
+		return renderer.ANY, nil
+	}
+	return renderer.ANY, fmt.Errorf("invalid rule protocol: %q", protocol)
+}
+
+// copyNet returns a copy of the network, nil for nil or empty (match-all)
+// network.
+func copyNet(ipNet *net.IPNet) *net.IPNet {
+	if ipNet == nil || (len(ipNet.IP) == 0 && len(ipNet.Mask) == 0) {
+		return nil
+	}
+	return &net.IPNet{
+		IP:   append(net.IP(nil), ipNet.IP...),
+		Mask: append(net.IPMask(nil), ipNet.Mask...),
+	}
+}
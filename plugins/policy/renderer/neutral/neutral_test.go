@@ -0,0 +1,212 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package neutral
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+	"github.com/contiv/vpp/plugins/policy/renderer/conformance"
+)
+
+// memBackend is a Backend keeping the rendered rules in memory.
+type memBackend struct {
+	pods         map[podmodel.ID][]Rule
+	capabilities []renderer.Capability
+}
+
+// memBackendTxn is a transaction of memBackend.
+type memBackendTxn struct {
+	backend *memBackend
+	resync  bool
+	pods    map[podmodel.ID][]Rule // nil rules = removed
+}
+
+func newMemBackend(capabilities ...renderer.Capability) *memBackend {
+	return &memBackend{pods: make(map[podmodel.ID][]Rule), capabilities: capabilities}
+}
+
+func (mb *memBackend) NewTxn(resync bool) BackendTxn {
+	return &memBackendTxn{backend: mb, resync: resync, pods: make(map[podmodel.ID][]Rule)}
+}
+
+func (mb *memBackend) HasCapability(capability renderer.Capability) bool {
+	for _, supported := range mb.capabilities {
+		if supported == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func (mbt *memBackendTxn) Render(pod podmodel.ID, podIP *net.IPNet, rules []Rule, removed bool) {
+	if removed {
+		mbt.pods[pod] = nil
+		return
+	}
+	mbt.pods[pod] = append([]Rule{}, rules...)
+}
+
+func (mbt *memBackendTxn) Commit() error {
+	if mbt.resync {
+		mbt.backend.pods = make(map[podmodel.ID][]Rule)
+	}
+	for pod, rules := range mbt.pods {
+		if rules == nil {
+			delete(mbt.backend.pods, pod)
+		} else {
+			mbt.backend.pods[pod] = rules
+		}
+	}
+	return nil
+}
+
+// memInspector implements conformance.Inspector for memBackend.
+type memInspector struct {
+	backend *memBackend
+}
+
+func (mi memInspector) InstalledRules(pod podmodel.ID) (ingress, egress []*renderer.ContivRule, configured bool) {
+	rules, configured := mi.backend.pods[pod]
+	if !configured {
+		return nil, nil, false
+	}
+	ingress, egress, err := ToContivRules(rules)
+	gomega.Expect(err).To(gomega.BeNil())
+	return ingress, egress, true
+}
+
+func parseNet(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	gomega.Expect(err).To(gomega.BeNil())
+	return ipNet
+}
+
+func TestRoundTrip(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	ingress := []*renderer.ContivRule{
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: parseNet("10.0.0.0/24"),
+			Protocol:    renderer.TCP,
+			DestPort:    80,
+		},
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: parseNet("2001:db8::/64"),
+			Protocol:    renderer.UDP,
+			SrcPort:     53,
+			DestPort:    5353,
+			Network:     "storage",
+		},
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: &net.IPNet{IP: net.IP{10, 0, 0, 1}, Mask: net.IPMask{255, 0, 0, 255}},
+			Protocol:    renderer.OTHER,
+		},
+		{
+			Action:      renderer.ActionDeny,
+			SrcNetwork:  &net.IPNet{},
+			DestNetwork: &net.IPNet{},
+			Protocol:    renderer.ANY,
+		},
+	}
+	egress := []*renderer.ContivRule{
+		{
+			Action:      renderer.ActionPermit,
+			SrcNetwork:  parseNet("192.168.0.0/16"),
+			DestNetwork: &net.IPNet{},
+			Protocol:    renderer.TCP,
+			DestPort:    443,
+			RateLimit:   &renderer.RateSpec{BitsPerSecond: 1000000, BurstBytes: 1500},
+			PacketLen:   &renderer.LenRange{Min: 64, Max: 1500},
+		},
+	}
+
+	rules := FromContivRules(ingress, egress)
+	gomega.Expect(rules).To(gomega.HaveLen(5))
+	gomega.Expect(rules[0].Direction).To(gomega.Equal(FromPod))
+	gomega.Expect(rules[0].Action).To(gomega.Equal(Permit))
+	gomega.Expect(rules[0].Protocol).To(gomega.Equal(TCP))
+	gomega.Expect(rules[0].SrcNet).To(gomega.BeNil())
+	gomega.Expect(rules[0].DstNet.String()).To(gomega.Equal("10.0.0.0/24"))
+	gomega.Expect(rules[1].Network).To(gomega.Equal("storage"))
+	gomega.Expect(rules[3].Action).To(gomega.Equal(Deny))
+	gomega.Expect(rules[3].Protocol).To(gomega.Equal(Any))
+	gomega.Expect(rules[4].Direction).To(gomega.Equal(ToPod))
+	gomega.Expect(rules[4].RateLimit).To(gomega.Equal(&RateLimit{BitsPerSecond: 1000000, BurstBytes: 1500}))
+	gomega.Expect(rules[4].PacketLen).To(gomega.Equal(&LenRange{Min: 64, Max: 1500}))
+	gomega.Expect(rules[4].String()).To(gomega.Equal(
+		"<to-pod permit tcp 192.168.0.0/16 -> any:443 rate=1000000bps/1500B len=64-1500B>"))
+
+	// Neutral rules do not share memory with the original ones.
+	rules[0].DstNet.IP[0] = 11
+	gomega.Expect(ingress[0].DestNetwork.String()).To(gomega.Equal("10.0.0.0/24"))
+	rules[0].DstNet.IP[0] = 10
+
+	// Round-trip preserves the rules and their order.
+	ingress2, egress2, err := ToContivRules(rules)
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(ingress2).To(gomega.HaveLen(len(ingress)))
+	gomega.Expect(egress2).To(gomega.HaveLen(len(egress)))
+	for idx := range ingress {
+		gomega.Expect(ingress2[idx].Compare(ingress[idx])).To(gomega.Equal(0), ingress[idx].String())
+		gomega.Expect(ingress2[idx].String()).To(gomega.Equal(ingress[idx].String()))
+	}
+	for idx := range egress {
+		gomega.Expect(egress2[idx].Compare(egress[idx])).To(gomega.Equal(0), egress[idx].String())
+		gomega.Expect(egress2[idx].String()).To(gomega.Equal(egress[idx].String()))
+	}
+	gomega.Expect(ingress2[2].DestNetwork.Mask).To(gomega.Equal(net.IPMask{255, 0, 0, 255}))
+
+	// And the other way round.
+	gomega.Expect(FromContivRules(ingress2, egress2)).To(gomega.Equal(rules))
+
+	// Invalid rules.
+	_, err = ToContivRule(Rule{Direction: FromPod, Action: "allow", Protocol: TCP})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	_, err = ToContivRule(Rule{Direction: FromPod, Action: Permit, Protocol: "sctp"})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+	_, _, err = ToContivRules([]Rule{{Direction: "inbound", Action: Permit, Protocol: TCP}})
+	gomega.Expect(err).ToNot(gomega.BeNil())
+}
+
+func TestRendererCapabilities(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	rndr := &Renderer{Backend: newMemBackend(renderer.Policing, renderer.RuleGroups)}
+	gomega.Expect(rndr.HasCapability(renderer.Policing)).To(gomega.BeTrue())
+	gomega.Expect(rndr.HasCapability(renderer.PacketLength)).To(gomega.BeFalse())
+	gomega.Expect(rndr.HasCapability(renderer.RuleGroups)).To(gomega.BeFalse())
+}
+
+func TestRendererConformance(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	conformance.RendererConformance(t, func(t *testing.T) (renderer.PolicyRendererAPI, conformance.Inspector) {
+		backend := newMemBackend()
+		return &Renderer{Backend: backend}, memInspector{backend: backend}
+	})
+}
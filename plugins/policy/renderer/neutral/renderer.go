@@ -0,0 +1,99 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package neutral
+
+import (
+	"net"
+
+	podmodel "github.com/contiv/vpp/plugins/ksr/model/pod"
+	"github.com/contiv/vpp/plugins/policy/renderer"
+)
+
+// Backend is a network stack consuming the neutral rules.
+// The semantics of transactions is the same as of renderer.PolicyRendererAPI.
+type Backend interface {
+	// NewTxn starts a new transaction. With <resync>, the supplied
+	// configuration should completely replace the existing one.
+	NewTxn(resync bool) BackendTxn
+}
+
+// BackendTxn is a transaction of the Backend.
+type BackendTxn interface {
+	// Render applies the rules of both directions for the given pod,
+	// replacing the existing ones. Rules of each direction are evaluated
+	// in the given order (the first match wins). Direction without any
+	// rules should allow all traffic. For removed pods <podIP> may be nil
+	// and the list of rules is empty. The rules are not shared with other
+	// pods or transactions, the backend may keep and modify them.
+	Render(pod podmodel.ID, podIP *net.IPNet, rules []Rule, removed bool)
+
+	// Commit proceeds with the rendering. Errors which may disappear
+	// if the commit is repeated should implement renderer.TransientError.
+	Commit() error
+}
+
+// Renderer adapts the Backend into renderer.PolicyRendererAPI.
+// Capabilities advertised by the backend (by implementing
+// renderer.CapabilityAdvertiser) are passed through, except for
+// renderer.RuleGroups which the neutral form does not support. So is the rule
+// format advertised by the backend (renderer.RuleFormatAdvertiser).
+type Renderer struct {
+	Backend Backend
+}
+
+// RendererTxn represents a single transaction of the neutral Renderer.
+type RendererTxn struct {
+	txn BackendTxn
+}
+
+// NewTxn starts a new transaction of the backend.
+func (r *Renderer) NewTxn(resync bool) renderer.Txn {
+	return &RendererTxn{txn: r.Backend.NewTxn(resync)}
+}
+
+// HasCapability returns true if the backend advertises the capability.
+func (r *Renderer) HasCapability(capability renderer.Capability) bool {
+	if capability == renderer.RuleGroups {
+		return false
+	}
+	advertiser, isAdvertiser := r.Backend.(renderer.CapabilityAdvertiser)
+	return isAdvertiser && advertiser.HasCapability(capability)
+}
+
+// SupportedRuleFormat returns the rule format advertised by the backend
+// (by implementing renderer.RuleFormatAdvertiser), RuleFormatV1 otherwise.
+func (r *Renderer) SupportedRuleFormat() renderer.RuleFormat {
+	advertiser, isAdvertiser := r.Backend.(renderer.RuleFormatAdvertiser)
+	if !isAdvertiser {
+		return renderer.RuleFormatV1
+	}
+	return advertiser.SupportedRuleFormat()
+}
+
+// Render converts the rules into the neutral form and passes them
+// to the backend.
+func (txn *RendererTxn) Render(pod podmodel.ID, podIP *net.IPNet, ingress []*renderer.ContivRule,
+	egress []*renderer.ContivRule, removed bool) renderer.Txn {
+
+	txn.txn.Render(pod, podIP, FromContivRules(ingress, egress), removed)
+	return txn
+}
+
+// Commit commits the transaction of the backend.
+func (txn *RendererTxn) Commit() error {
+	return txn.txn.Commit()
+}
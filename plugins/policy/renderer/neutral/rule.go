@@ -0,0 +1,175 @@
+/*
+ * // Copyright (c) 2017 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+// Package neutral provides a backend-neutral representation of the rules
+// rendered by the policy configurator, for third-party renderers (e.g. for OVS)
+// that prefer not to consume renderer.ContivRule directly. Rules are expressed
+// from the pod point of view (traffic from/to the pod) with self-describing
+// actions and protocols. Renderer adapts a Backend consuming the neutral rules
+// into renderer.PolicyRendererAPI, to be registered with the configurator like
+// any other renderer.
+package neutral
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Action to perform with the matching traffic.
+type Action string
+
+const (
+	// Permit allows the matching traffic.
+	Permit Action = "permit"
+
+	// Deny blocks the matching traffic.
+	Deny Action = "deny"
+)
+
+// Direction of the traffic from the pod point of view.
+type Direction string
+
+const (
+	// FromPod is the traffic sent by the pod, i.e. coming into the vswitch
+	// (the ingress rules of renderer.Txn.Render()).
+	FromPod Direction = "from-pod"
+
+	// ToPod is the traffic destined to the pod, i.e. leaving the vswitch
+	// (the egress rules of renderer.Txn.Render()).
+	ToPod Direction = "to-pod"
+)
+
+// Protocol is the L4 protocol of the traffic.
+type Protocol string
+
+const (
+	// TCP protocol.
+	TCP Protocol = "tcp"
+
+	// UDP protocol.
+	UDP Protocol = "udp"
+
+	// Other is some non-TCP, non-UDP traffic (used only in unit tests).
+	Other Protocol = "other"
+
+	// Any L4 protocol or even pure L3 traffic (ports are ignored).
+	Any Protocol = "any"
+)
+
+// Rule is a backend-neutral policy rule.
+type Rule struct {
+	Direction Direction
+	Action    Action
+	Protocol  Protocol
+
+	// SrcNet and DstNet select the source and destination addresses,
+	// nil = any. Networks may have non-contiguous masks if the backend
+	// advertises the renderer.MaskedMatch capability.
+	SrcNet *net.IPNet
+	DstNet *net.IPNet
+
+	// SrcPort and DstPort select the L4 ports, 0 = any.
+	SrcPort uint16
+	DstPort uint16
+
+	// Network selects the pod network (interface) the rule applies to,
+	// empty = all networks of the pod.
+	Network string
+
+	// RateLimit optionally limits the rate of the permitted traffic,
+	// nil = not limited.
+	RateLimit *RateLimit
+
+	// ConnRateLimit optionally limits the rate of new connections permitted
+	// by the rule, nil = not limited.
+	ConnRateLimit *ConnRateLimit
+
+	// PacketLen optionally restricts the rule to packets with the length
+	// within the range, nil = any length.
+	PacketLen *LenRange
+
+	// FragmentsOnly restricts the rule to non-initial fragments of IP packets.
+	// Ports of such rules are unset.
+	FragmentsOnly bool
+
+	// Description is an optional informational description of the rule.
+	Description string
+}
+
+// RateLimit is the allowed rate of the traffic and the burst size.
+type RateLimit struct {
+	BitsPerSecond uint64
+	BurstBytes    uint64
+}
+
+// ConnRateLimit is the allowed rate of new connections and the burst size,
+// applied to each peer separately if PerPeer is set.
+type ConnRateLimit struct {
+	ConnsPerSecond uint64
+	Burst          uint64
+	PerPeer        bool
+}
+
+// LenRange is an inclusive range of packet lengths (whole IP packet) in bytes.
+type LenRange struct {
+	Min uint16
+	Max uint16
+}
+
+// String converts Rule into a human-readable string.
+func (r Rule) String() string {
+	const any = "any"
+	fields := []string{string(r.Direction), string(r.Action), string(r.Protocol)}
+	src, dst := any, any
+	if r.SrcNet != nil {
+		src = r.SrcNet.String()
+	}
+	if r.DstNet != nil {
+		dst = r.DstNet.String()
+	}
+	if r.SrcPort != 0 {
+		src = fmt.Sprintf("%s:%d", src, r.SrcPort)
+	}
+	if r.DstPort != 0 {
+		dst = fmt.Sprintf("%s:%d", dst, r.DstPort)
+	}
+	fields = append(fields, src+" -> "+dst)
+	if r.Network != "" {
+		fields = append(fields, "network="+r.Network)
+	}
+	if r.RateLimit != nil {
+		fields = append(fields, fmt.Sprintf("rate=%dbps/%dB", r.RateLimit.BitsPerSecond, r.RateLimit.BurstBytes))
+	}
+	if r.ConnRateLimit != nil {
+		connRate := fmt.Sprintf("connrate=%dcps/%d", r.ConnRateLimit.ConnsPerSecond, r.ConnRateLimit.Burst)
+		if r.ConnRateLimit.PerPeer {
+			connRate += "/peer"
+		}
+		fields = append(fields, connRate)
+	}
+	if r.PacketLen != nil {
+		fields = append(fields, fmt.Sprintf("len=%d-%dB", r.PacketLen.Min, r.PacketLen.Max))
+	}
+	if r.FragmentsOnly {
+		fields = append(fields, "fragments")
+	}
+	if r.Description != "" {
+		fields = append(fields, "# "+strconv.Quote(r.Description))
+	}
+	return "<" + strings.Join(fields, " ") + ">"
+}
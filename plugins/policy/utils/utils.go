@@ -216,6 +216,25 @@ func CompareIPNets(a, b *net.IPNet) int {
 		bNorm = &net.IPNet{IP: b.IP.To16(), Mask: b.Mask}
 	}
 
+	// Non-contiguous masks cannot be ordered by subsets
+	// -> order them after all the prefixes of the same IP version,
+	// by the mask and then by the masked address, to maintain a total order.
+	aContiguous := IsContiguousMask(aNorm.Mask)
+	bContiguous := IsContiguousMask(bNorm.Mask)
+	if aContiguous != bContiguous {
+		if aContiguous {
+			return -1
+		}
+		return 1
+	}
+	if !aContiguous {
+		maskOrder := bytes.Compare(bNorm.Mask, aNorm.Mask)
+		if maskOrder != 0 {
+			return maskOrder
+		}
+		return bytes.Compare(aNorm.IP.Mask(aNorm.Mask), bNorm.IP.Mask(bNorm.Mask))
+	}
+
 	// Compare common prefix
 	aOnes, bits := aNorm.Mask.Size()
 	bOnes, _ := bNorm.Mask.Size()
@@ -238,6 +257,16 @@ func CompareIPNets(a, b *net.IPNet) int {
 	return bytes.Compare(aNorm.IP, bNorm.IP)
 }
 
+// IsContiguousMask returns true if the given mask is in the canonical form,
+// i.e. ones followed by zeros. Empty (nil) mask is considered contiguous.
+func IsContiguousMask(mask net.IPMask) bool {
+	if len(mask) == 0 {
+		return true
+	}
+	_, bits := mask.Size()
+	return bits != 0
+}
+
 // ComparePorts is a comparison function for two ports.
 // Port=0 means "all-ports" and it is higher in the order than any specific port.
 func ComparePorts(a, b uint16) int {
@@ -0,0 +1,108 @@
+/*
+ * // Copyright (c) 2018 Cisco and/or its affiliates.
+ * //
+ * // Licensed under the Apache License, Version 2.0 (the "License");
+ * // you may not use this file except in compliance with the License.
+ * // You may obtain a copy of the License at:
+ * //
+ * //     http://www.apache.org/licenses/LICENSE-2.0
+ * //
+ * // Unless required by applicable law or agreed to in writing, software
+ * // distributed under the License is distributed on an "AS IS" BASIS,
+ * // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * // See the License for the specific language governing permissions and
+ * // limitations under the License.
+ */
+
+package utils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func ipMask(ip, mask string) *net.IPNet {
+	return &net.IPNet{IP: net.ParseIP(ip).To4(), Mask: net.IPMask(net.ParseIP(mask).To4())}
+}
+
+func ipNet(cidr string) *net.IPNet {
+	_, network, _ := net.ParseCIDR(cidr)
+	return network
+}
+
+// expectTotalOrder checks that the comparison function is antisymmetric and
+// transitive over all triples of the given items.
+func expectTotalOrder(count int, compare func(a, b int) int, name func(idx int) string) {
+	for a := 0; a < count; a++ {
+		gomega.Expect(compare(a, a)).To(gomega.Equal(0), name(a))
+		for b := 0; b < count; b++ {
+			gomega.Expect(compare(a, b)).To(gomega.Equal(-compare(b, a)), name(a)+" vs "+name(b))
+			for c := 0; c < count; c++ {
+				if compare(a, b) < 0 && compare(b, c) < 0 {
+					gomega.Expect(compare(a, c)).To(gomega.Equal(-1),
+						name(a)+" < "+name(b)+" < "+name(c))
+				}
+			}
+		}
+	}
+}
+
+func TestCompareIPNetsTransitivity(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	nets := []*net.IPNet{
+		ipNet("10.0.0.0/8"),
+		ipNet("10.1.0.0/16"),
+		ipNet("192.168.0.0/16"),
+		ipNet("192.168.1.0/24"),
+		ipNet("192.168.1.1/32"),
+		ipMask("192.168.0.0", "255.0.255.0"),
+		ipMask("10.0.1.0", "255.0.255.0"),
+		ipMask("10.0.0.1", "255.0.0.255"),
+		ipMask("0.0.0.1", "0.0.0.255"),
+		ipNet("fd00::/64"),
+		ipNet("fd00::1/128"),
+		{IP: net.ParseIP("fd00::1"), Mask: net.IPMask(net.ParseIP("ffff::ffff"))},
+		{},
+	}
+	expectTotalOrder(len(nets),
+		func(a, b int) int { return CompareIPNets(nets[a], nets[b]) },
+		func(idx int) string { return nets[idx].String() })
+
+	// Subsets are ordered before their supersets.
+	gomega.Expect(CompareIPNets(ipNet("10.1.0.0/16"), ipNet("10.0.0.0/8"))).To(gomega.Equal(-1))
+
+	// Prefixes are ordered before non-contiguous masks of the same IP version.
+	gomega.Expect(CompareIPNets(ipNet("10.0.0.0/8"), ipMask("192.168.0.0", "255.0.255.0"))).To(gomega.Equal(-1))
+	gomega.Expect(CompareIPNets(ipNet("192.168.0.0/16"), ipMask("192.168.0.0", "255.0.255.0"))).To(gomega.Equal(-1))
+	gomega.Expect(CompareIPNets(ipMask("10.0.0.1", "255.0.0.255"), ipNet("fd00::/64"))).To(gomega.Equal(-1))
+}
+
+func TestCompareIPNetsBytesTransitivity(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	type prefix struct {
+		len uint8
+		ip  [16]byte
+	}
+	toPrefix := func(cidr string) prefix {
+		network := ipNet(cidr)
+		ones, _ := network.Mask.Size()
+		p := prefix{len: uint8(ones)}
+		copy(p.ip[:], network.IP.To16())
+		return p
+	}
+	cidrs := []string{"10.0.0.0/8", "10.1.0.0/16", "192.168.0.0/16", "192.168.1.0/24",
+		"192.168.1.1/32", "0.0.0.0/0"}
+	prefixes := make([]prefix, len(cidrs))
+	for idx, cidr := range cidrs {
+		prefixes[idx] = toPrefix(cidr)
+	}
+	expectTotalOrder(len(prefixes),
+		func(a, b int) int {
+			return CompareIPNetsBytes(prefixes[a].len, prefixes[a].ip, prefixes[b].len, prefixes[b].ip)
+		},
+		func(idx int) string { return cidrs[idx] })
+}